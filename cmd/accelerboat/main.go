@@ -7,6 +7,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,11 +16,14 @@ import (
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/selfcheck"
 	"github.com/penglongli/accelerboat/pkg/server"
+	"github.com/penglongli/accelerboat/pkg/utils"
 )
 
 var (
-	config = flag.String("f", "", "config file path")
+	config        = flag.String("f", "", "config file path")
+	selfCheckOnly = flag.Bool("self-check", false, "run the startup self-check and exit")
 )
 
 func init() {
@@ -34,6 +38,15 @@ func main() {
 	if err != nil {
 		panic(errors.Wrapf(err, "parse options failed"))
 	}
+	report := selfcheck.Run(context.Background(), op)
+	fmt.Println(string(utils.ToJson(report)))
+	if !report.Passed {
+		logger.Errorf("startup self-check failed: %s", string(utils.ToJson(report)))
+		os.Exit(report.ExitCode())
+	}
+	if *selfCheckOnly {
+		return
+	}
 	opWatcher := options.NewChangeWatcher(*config)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -47,7 +60,7 @@ func main() {
 			return
 		}
 	}()
-	svr := server.NewAccelerboatServer(ctx, op, opWatcher)
+	svr := server.NewAccelerboatServer(ctx, opWatcher)
 	if err = svr.Init(); err != nil {
 		logger.Fatalf("server init failed: %v", err)
 	}
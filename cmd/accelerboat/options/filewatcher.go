@@ -13,13 +13,16 @@ import (
 	"github.com/penglongli/accelerboat/pkg/utils"
 )
 
+// OptionChanges defines the snapshots of options before and after the change
 type OptionChanges struct {
 	Prev    *AccelerBoatOption `json:"prev"`
 	Current *AccelerBoatOption `json:"current"`
 }
 
+// OptionChangeWatcher reloads the options when the config file is modified, the changes are received
+// with Subscribe
 type OptionChangeWatcher interface {
-	Watch(ctx context.Context) <-chan *OptionChanges
+	Watch(ctx context.Context)
 }
 
 func NewChangeWatcher(cfgPath string) OptionChangeWatcher {
@@ -32,52 +35,30 @@ type optionChangeHandler struct {
 	cfgPath string
 }
 
-func (o *optionChangeHandler) Watch(ctx context.Context) <-chan *OptionChanges {
-	ch := make(chan *OptionChanges)
-	go func() {
-		ticker := time.NewTicker(10 * time.Second)
-		defer func() {
-			ticker.Stop()
-			logger.Infof("option change watcher closed")
-		}()
-		bs, _ := os.ReadFile(o.cfgPath) // nolint
-		prevContent := utils.BytesToString(bs)
-		for {
-			select {
-			case <-ticker.C:
-				bs, _ = os.ReadFile(o.cfgPath)
-				currentContent := utils.BytesToString(bs)
-				if prevContent == currentContent {
-					continue
-				}
-				prevContent = currentContent
-				opc := o.handleFileChanged()
-				if opc == nil {
-					continue
-				}
-				logger.Infof("config file '%s' is modified", o.cfgPath)
-				ch <- opc
-
-			case <-ctx.Done():
-				close(ch)
-				return
+// Watch blocks and reloads the options until ctx done
+func (o *optionChangeHandler) Watch(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer func() {
+		ticker.Stop()
+		logger.Infof("option change watcher closed")
+	}()
+	bs, _ := os.ReadFile(o.cfgPath) // nolint
+	prevContent := utils.BytesToString(bs)
+	for {
+		select {
+		case <-ticker.C:
+			bs, _ = os.ReadFile(o.cfgPath)
+			currentContent := utils.BytesToString(bs)
+			if prevContent == currentContent {
+				continue
 			}
+			prevContent = currentContent
+			logger.Infof("config file '%s' is modified", o.cfgPath)
+			if _, err := Parse(o.cfgPath, false); err != nil {
+				logger.Errorf("parse config file failed: %s", err.Error())
+			}
+		case <-ctx.Done():
+			return
 		}
-	}()
-	return ch
-}
-
-func (o *optionChangeHandler) handleFileChanged() *OptionChanges {
-	if _, err := Parse(o.cfgPath, false); err != nil {
-		logger.Errorf("parse config file failed: %s", err.Error())
-		return nil
-	}
-	prevOp := &AccelerBoatOption{}
-	currentOp := &AccelerBoatOption{}
-	_ = utils.DeepCopyStruct(prev, prevOp)
-	_ = utils.DeepCopyStruct(singleton, currentOp)
-	return &OptionChanges{
-		Prev:    prevOp,
-		Current: currentOp,
 	}
 }
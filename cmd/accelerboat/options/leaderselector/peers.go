@@ -0,0 +1,128 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package leaderselector
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	peerCheckTimeout = 3 * time.Second
+	// peerUnhealthyThreshold the consecutive failed checks after which the peer is removed from endpoints
+	peerUnhealthyThreshold = 3
+)
+
+// peerState the health of peer, the peer is not in endpoints until it passed the check once
+type peerState struct {
+	healthy  bool
+	failures int
+}
+
+// WatchPeers discovers the ips of peers every interval and checks their readiness, the ready peers and
+// this node are the endpoints which the master is elected from. The endpoints are kept if discovery
+// failed. It is used without kubernetes, e.g. the VM fleets and edge sites.
+func WatchPeers(discover func() ([]string, error), self string, port int64, preferConfig PreferConfig,
+	interval time.Duration) {
+	serverPort = port
+	preferCfg = preferConfig
+	client := &http.Client{Timeout: peerCheckTimeout}
+	peers := make(map[string]*peerState)
+	var prevMaster string
+	refresh := func() {
+		ips, err := discover()
+		if err != nil {
+			logger.Errorf("[master-election] discover peers failed: %s", err.Error())
+			return
+		}
+		checkPeers(client, ips, self, peers)
+		result := []string{fmt.Sprintf("%s:%d", self, port)}
+		for ip, state := range peers {
+			if state.healthy {
+				result = append(result, fmt.Sprintf("%s:%d", ip, port))
+			}
+		}
+		sort.Strings(result)
+		endpoints = result
+		if currentMaster := CurrentMaster(); prevMaster != currentMaster {
+			logger.Infof("current master: %s => %s (peers: %v)", prevMaster, currentMaster, result)
+			prevMaster = currentMaster
+		}
+	}
+	refresh()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			refresh()
+		}
+	}()
+}
+
+// checkPeers checks the readiness of the discovered peers concurrently, the peers not discovered any more
+// are removed
+func checkPeers(client *http.Client, ips []string, self string, peers map[string]*peerState) {
+	discovered := make(map[string]struct{}, len(ips))
+	for _, ip := range ips {
+		if ip != self {
+			discovered[ip] = struct{}{}
+		}
+	}
+	for ip := range peers {
+		if _, ok := discovered[ip]; !ok {
+			delete(peers, ip)
+			logger.Infof("[master-election] peer '%s' not discovered any more", ip)
+		}
+	}
+	var lock sync.Mutex
+	wg := &sync.WaitGroup{}
+	for ip := range discovered {
+		state, ok := peers[ip]
+		if !ok {
+			state = &peerState{}
+			peers[ip] = state
+		}
+		wg.Add(1)
+		go func(ip string, state *peerState) {
+			defer wg.Done()
+			err := checkPeer(client, ip)
+			lock.Lock()
+			defer lock.Unlock()
+			if err == nil {
+				if !state.healthy {
+					logger.Infof("[master-election] peer '%s' is ready", ip)
+				}
+				state.healthy = true
+				state.failures = 0
+				return
+			}
+			state.failures++
+			if state.healthy && state.failures >= peerUnhealthyThreshold {
+				state.healthy = false
+				logger.Warnf("[master-election] peer '%s' is removed after %d failed checks: %s", ip,
+					state.failures, err.Error())
+			}
+		}(ip, state)
+	}
+	wg.Wait()
+}
+
+func checkPeer(client *http.Client, ip string) error {
+	resp, err := client.Get(fmt.Sprintf("http://%s:%d%s", ip, serverPort, apitypes.APIReadiness))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("readiness responded %d", resp.StatusCode)
+	}
+	return nil
+}
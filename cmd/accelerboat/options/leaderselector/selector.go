@@ -82,6 +82,28 @@ func CurrentMaster() string {
 	return currentEndpoint
 }
 
+// IsMaster returns whether the node of address is the current master
+func IsMaster(address string) bool {
+	return strings.HasPrefix(CurrentMaster(), address+":")
+}
+
+// SetStaticEndpoints sets the endpoints of nodes discovered without kubernetes, the master is elected from
+// them locally as same as the endpoints of service
+func SetStaticEndpoints(ips []string, port int64, preferConfig PreferConfig) {
+	serverPort = port
+	preferCfg = preferConfig
+	result := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		result = append(result, fmt.Sprintf("%s:%d", ip, port))
+	}
+	prevMaster := CurrentMaster()
+	endpoints = result
+	if currentMaster := CurrentMaster(); prevMaster != currentMaster {
+		logger.Infof("current master: %s => %s", prevMaster, currentMaster)
+	}
+	logger.Infof("[master-election] static endpoints: %d", len(result))
+}
+
 func createEndpointsWatcher() (*k8swatch.RetryWatcher, error) {
 	epList, err := k8sClient.CoreV1().Endpoints(namespace).List(context.Background(), metav1.ListOptions{
 		FieldSelector: fmt.Sprintf("metadata.name=%s", serviceName),
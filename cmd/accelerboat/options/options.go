@@ -6,9 +6,14 @@ package options
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"k8s.io/client-go/kubernetes"
 )
 
 // ProxyType defines proxy type
@@ -21,7 +26,33 @@ const (
 	RegistryMirror ProxyType = "RegistryMirror"
 )
 
-// HTTPProxyTransport return the insecure-skip-verify transport
+// RegistryType defines the backend type of registry mapping
+type RegistryType string
+
+const (
+	// RegistryTypeOriginal proxies the original registry, it is the default type
+	RegistryTypeOriginal RegistryType = ""
+	// RegistryTypeOCILayout serves the images from a local OCI layout directory
+	RegistryTypeOCILayout RegistryType = "ocilayout"
+)
+
+// BlobRedirectMode defines how the reverse proxy handles the redirects of blob responses, e.g. ECR/GCR
+// redirect the blob requests to the signed URLs of CDN
+type BlobRedirectMode string
+
+const (
+	// BlobRedirectPassthrough responds the redirect to client, it is the default mode
+	BlobRedirectPassthrough BlobRedirectMode = ""
+	// BlobRedirectFollow follows the redirect on proxy and streams the blob to client, the blob is cached
+	// if the full content is responded
+	BlobRedirectFollow BlobRedirectMode = "follow"
+	// BlobRedirectRewrite rewrites the Location to the proxy, the client requests the redirected URL
+	// through the proxy
+	BlobRedirectRewrite BlobRedirectMode = "rewrite"
+)
+
+// HTTPProxyTransport return the insecure-skip-verify transport, the requests are proxied with the proxy of
+// the registry mapping they belong to, or the global httpProxy
 func (o *AccelerBoatOption) HTTPProxyTransport() http.RoundTripper {
 	netDialer := &net.Dialer{
 		Timeout:   5 * time.Second,
@@ -37,13 +68,36 @@ func (o *AccelerBoatOption) HTTPProxyTransport() http.RoundTripper {
 		ExpectContinueTimeout: 1 * time.Second,
 		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
 	}
-	if o.ExternalConfig.HTTPProxyUrl == nil {
-		return tp
-	}
-	tp.Proxy = http.ProxyURL(o.ExternalConfig.HTTPProxyUrl)
+	tp.Proxy = o.proxyOf
 	return tp
 }
 
+// proxyOf returns the proxy of request. The proxy of registry mapping whose original host or auth host is
+// requested takes precedence, then the global httpProxy, then the proxy of environment.
+func (o *AccelerBoatOption) proxyOf(req *http.Request) (*url.URL, error) {
+	for _, mp := range o.ExternalConfig.RegistryMappings {
+		if !mp.IsAuthHostAllowed(req.URL.Host) && !mp.IsAuthHostAllowed(req.URL.Hostname()) {
+			continue
+		}
+		if mp.NoProxy {
+			return nil, nil
+		}
+		if mp.HTTPProxyUrl != nil {
+			return mp.HTTPProxyUrl, nil
+		}
+		break
+	}
+	if o.ExternalConfig.HTTPProxyUrl != nil {
+		return o.ExternalConfig.HTTPProxyUrl, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// K8sClient returns the kubernetes client created with in-cluster config
+func (o *AccelerBoatOption) K8sClient() *kubernetes.Clientset {
+	return o.k8sClient
+}
+
 // FilterRegistryMapping filter registry mapping
 func (o *AccelerBoatOption) FilterRegistryMapping(proxyHost string, proxyType ProxyType) *RegistryMapping {
 	for _, m := range o.ExternalConfig.RegistryMappings {
@@ -73,6 +127,28 @@ func (o *AccelerBoatOption) FilterRegistryMapping(proxyHost string, proxyType Pr
 	return nil
 }
 
+// MirrorProxyHost returns the proxy host and request uri of RegistryMirror request with the 'ns' query. The
+// client pulls the image of original registry served under path prefix with the prefix in repository, so
+// the mapping is matched by the host and the path prefix, e.g. the ns 'gateway.example.com' with uri
+// '/v2/harbor/library/nginx/manifests/latest' matches the original host 'gateway.example.com/harbor' and the
+// uri is returned without prefix. The longest prefix matched wins, returns them unchanged if not matched.
+func (o *AccelerBoatOption) MirrorProxyHost(ns, requestURI string) (string, string) {
+	var matched *RegistryMapping
+	for _, m := range o.ExternalConfig.RegistryMappings {
+		prefix := m.OriginalPathPrefix()
+		if prefix == "" || m.OriginalHostname() != ns || !strings.HasPrefix(requestURI, "/v2"+prefix+"/") {
+			continue
+		}
+		if matched == nil || len(prefix) > len(matched.OriginalPathPrefix()) {
+			matched = m
+		}
+	}
+	if matched == nil {
+		return ns, requestURI
+	}
+	return matched.OriginalHost, "/v2" + strings.TrimPrefix(requestURI, "/v2"+matched.OriginalPathPrefix())
+}
+
 // FilterRegistryMappingByOriginal filter registry mappings by original registry
 func (o *AccelerBoatOption) FilterRegistryMappingByOriginal(originalHost string) *RegistryMapping {
 	for _, m := range o.ExternalConfig.RegistryMappings {
@@ -82,3 +158,53 @@ func (o *AccelerBoatOption) FilterRegistryMappingByOriginal(originalHost string)
 	}
 	return nil
 }
+
+// secretFields the json names of the options holding secrets, they are masked when the options printed
+var secretFields = map[string]struct{}{
+	"password":      {},
+	"redisPassword": {},
+	"secret":        {},
+	"secretKey":     {},
+	"clientSecret":  {},
+	"encryptionKey": {},
+	"token":         {},
+	"childToken":    {},
+	"proxyKey":      {},
+	"key":           {},
+}
+
+// MaskedJSON returns the json of options with the secrets masked, it is used to print the options into
+// logs which are served by the logs API
+func (o *AccelerBoatOption) MaskedJSON() string {
+	bs, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	}
+	var v interface{}
+	if err = json.Unmarshal(bs, &v); err != nil {
+		return ""
+	}
+	maskSecrets(v)
+	bs, _ = json.Marshal(v)
+	return string(bs)
+}
+
+func maskSecrets(v interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			// only the string values are secrets, e.g. the 'token' rule of fallback is an object
+			if s, ok := item.(string); ok {
+				if _, secret := secretFields[k]; secret && s != "" {
+					value[k] = "******"
+				}
+				continue
+			}
+			maskSecrets(item)
+		}
+	case []interface{}:
+		for _, item := range value {
+			maskSecrets(item)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"testing"
+)
+
+func TestMirrorProxyHost(t *testing.T) {
+	op := &AccelerBoatOption{}
+	op.ExternalConfig.RegistryMappings = []*RegistryMapping{
+		{OriginalHost: "gateway.example.com"},
+		{OriginalHost: "gateway.example.com/harbor"},
+		{OriginalHost: "gateway.example.com/harbor/team"},
+	}
+	tests := []struct {
+		name       string
+		ns         string
+		requestURI string
+		wantHost   string
+		wantURI    string
+	}{
+		{
+			name:       "prefix matched",
+			ns:         "gateway.example.com",
+			requestURI: "/v2/harbor/library/nginx/manifests/latest",
+			wantHost:   "gateway.example.com/harbor",
+			wantURI:    "/v2/library/nginx/manifests/latest",
+		},
+		{
+			name:       "longest prefix matched",
+			ns:         "gateway.example.com",
+			requestURI: "/v2/harbor/team/app/blobs/sha256:abc?ns=gateway.example.com",
+			wantHost:   "gateway.example.com/harbor/team",
+			wantURI:    "/v2/app/blobs/sha256:abc?ns=gateway.example.com",
+		},
+		{
+			name:       "prefix of other repository not matched",
+			ns:         "gateway.example.com",
+			requestURI: "/v2/harbor-dev/app/manifests/latest",
+			wantHost:   "gateway.example.com",
+			wantURI:    "/v2/harbor-dev/app/manifests/latest",
+		},
+		{
+			name:       "other host not matched",
+			ns:         "docker.io",
+			requestURI: "/v2/harbor/library/nginx/manifests/latest",
+			wantHost:   "docker.io",
+			wantURI:    "/v2/harbor/library/nginx/manifests/latest",
+		},
+		{
+			name:       "ns with prefix unchanged",
+			ns:         "gateway.example.com/harbor",
+			requestURI: "/v2/library/nginx/manifests/latest",
+			wantHost:   "gateway.example.com/harbor",
+			wantURI:    "/v2/library/nginx/manifests/latest",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, uri := op.MirrorProxyHost(tt.ns, tt.requestURI)
+			if host != tt.wantHost || uri != tt.wantURI {
+				t.Errorf("MirrorProxyHost() = %s, %s, want %s, %s", host, uri, tt.wantHost, tt.wantURI)
+			}
+			if mp := op.FilterRegistryMapping(host, RegistryMirror); mp.OriginalHost != tt.wantHost {
+				t.Errorf("FilterRegistryMapping() = %s, want %s", mp.OriginalHost, tt.wantHost)
+			}
+		})
+	}
+}
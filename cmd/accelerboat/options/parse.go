@@ -5,65 +5,84 @@
 package options
 
 import (
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
 	"github.com/penglongli/accelerboat/pkg/logger"
-	"github.com/penglongli/accelerboat/pkg/utils"
 )
 
-var (
-	prev      = new(AccelerBoatOption)
-	singleton = new(AccelerBoatOption)
-)
-
-// GlobalOptions returns the global option
-func GlobalOptions() *AccelerBoatOption {
-	return singleton
-}
-
 func changeOption(op *AccelerBoatOption, init bool) {
+	prev := storeOption(op)
 	// initialized for the first time
 	if init {
-		_ = utils.DeepCopyStruct(op, singleton)
-		_ = utils.DeepCopyStruct(op, prev)
-
 		// only init for the first time
 		disc := op.ServiceDiscovery
-		if err := leaderselector.WatchK8sService(disc.ServiceNamespace, disc.ServiceName, op.HTTPPort,
-			disc.PreferConfig, op.k8sClient); err != nil {
-			logger.Fatalf("watch k8s service failed: %s", err)
-		}
-	} else {
-		_ = utils.DeepCopyStruct(singleton, prev)
-		_ = utils.DeepCopyStruct(op, singleton)
-		if prev.LogConfig.LogDir != singleton.LogConfig.LogDir ||
-			prev.LogConfig.LogMaxSize != singleton.LogConfig.LogMaxSize ||
-			prev.LogConfig.LogMaxAge != singleton.LogConfig.LogMaxAge ||
-			prev.LogConfig.LogMaxBackups != singleton.LogConfig.LogMaxBackups {
-			logger.InitLogger(&logger.Option{
-				Filename:   filepath.Join(op.LogConfig.LogDir, "accelerboat.log"),
-				MaxSize:    op.LogConfig.LogMaxSize,
-				MaxAge:     op.LogConfig.LogMaxAge,
-				MaxBackups: op.LogConfig.LogMaxBackups,
-			})
+		switch disc.Type {
+		case ServiceDiscoveryNone:
+			leaderselector.SetStaticEndpoints([]string{op.Address}, op.HTTPPort, disc.PreferConfig)
+		case ServiceDiscoveryStatic, ServiceDiscoveryDNS:
+			leaderselector.WatchPeers(discoverPeers, op.Address, op.HTTPPort, disc.PreferConfig,
+				time.Duration(disc.HealthCheckInterval)*time.Second)
+		default:
+			if err := leaderselector.WatchK8sService(disc.ServiceNamespace, disc.ServiceName, op.HTTPPort,
+				disc.PreferConfig, op.k8sClient); err != nil {
+				logger.Fatalf("watch k8s service failed: %s", err)
+			}
+		}
+	} else if prev.LogConfig.LogDir != op.LogConfig.LogDir ||
+		prev.LogConfig.LogMaxSize != op.LogConfig.LogMaxSize ||
+		prev.LogConfig.LogMaxAge != op.LogConfig.LogMaxAge ||
+		prev.LogConfig.LogMaxBackups != op.LogConfig.LogMaxBackups {
+		logger.InitLogger(&logger.Option{
+			Filename:   filepath.Join(op.LogConfig.LogDir, logger.FileName),
+			MaxSize:    op.LogConfig.LogMaxSize,
+			MaxAge:     op.LogConfig.LogMaxAge,
+			MaxBackups: op.LogConfig.LogMaxBackups,
+		})
+	}
+	logger.Infof("parsed options: %s", op.MaskedJSON())
+}
+
+// discoverPeers returns the ips of nodes with the static endpoints or the DNS SRV records of the reloaded
+// config
+func discoverPeers() ([]string, error) {
+	disc := GlobalOptions().ServiceDiscovery
+	if disc.Type != ServiceDiscoveryDNS {
+		return disc.Endpoints, nil
+	}
+	_, records, err := net.LookupSRV("", "", disc.DNSName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "lookup srv records of '%s' failed", disc.DNSName)
+	}
+	result := make([]string, 0, len(records))
+	for _, srv := range records {
+		target := strings.TrimSuffix(srv.Target, ".")
+		addrs, err := net.LookupHost(target)
+		if err != nil {
+			logger.Warnf("lookup host of srv target '%s' failed: %s", target, err.Error())
+			continue
 		}
+		result = append(result, addrs...)
 	}
-	logger.Infof("parsed options: %s", string(utils.ToJson(op)))
+	return result, nil
 }
 
 func Parse(configFile string, init bool) (*AccelerBoatOption, error) {
@@ -77,7 +96,7 @@ func Parse(configFile string, init bool) (*AccelerBoatOption, error) {
 	}
 	if init {
 		logger.InitLogger(&logger.Option{
-			Filename:   filepath.Join(op.LogConfig.LogDir, "accelerboat.log"),
+			Filename:   filepath.Join(op.LogConfig.LogDir, logger.FileName),
 			MaxSize:    op.LogConfig.LogMaxSize,
 			MaxAge:     op.LogConfig.LogMaxAge,
 			MaxBackups: op.LogConfig.LogMaxBackups,
@@ -99,9 +118,245 @@ func Parse(configFile string, init bool) (*AccelerBoatOption, error) {
 	if err = op.checkTorrentConfig(); err != nil {
 		return nil, errors.Wrapf(err, "check option torrent config failed")
 	}
+	if err = op.checkBandwidthConfig(); err != nil {
+		return nil, errors.Wrapf(err, "check option bandwidth config failed")
+	}
 	if err = op.checkExternalConfig(); err != nil {
 		return nil, errors.Wrapf(err, "check option external config failed")
 	}
+	if err = op.applyUpstreamOverrides(); err != nil {
+		return nil, errors.Wrapf(err, "apply upstream overrides failed")
+	}
+	if err = op.checkObjectStorage(); err != nil {
+		return nil, errors.Wrapf(err, "check option object storage failed")
+	}
+	if err = op.checkLayerScan(); err != nil {
+		return nil, errors.Wrapf(err, "check option layer scan failed")
+	}
+	if err = op.checkAccessLog(); err != nil {
+		return nil, errors.Wrapf(err, "check option access log failed")
+	}
+	if err = op.checkClientQuota(); err != nil {
+		return nil, errors.Wrapf(err, "check option client quota failed")
+	}
+	if err = op.checkClientVerify(); err != nil {
+		return nil, errors.Wrapf(err, "check option client verify failed")
+	}
+	if err = op.checkPeerTLS(); err != nil {
+		return nil, errors.Wrapf(err, "check option peer tls failed")
+	}
+	if err = op.checkFederation(); err != nil {
+		return nil, errors.Wrapf(err, "check option federation failed")
+	}
+	if err = op.checkParent(); err != nil {
+		return nil, errors.Wrapf(err, "check option parent failed")
+	}
+	if err = op.checkPreheat(); err != nil {
+		return nil, errors.Wrapf(err, "check option preheat failed")
+	}
+	if op.TokenCache.Enable && op.TokenCache.EncryptionKey == "" {
+		return nil, errors.Errorf("check option token cache failed: encryptionKey is required if enabled")
+	}
+	if op.TokenRefresh.HotThreshold <= 0 {
+		op.TokenRefresh.HotThreshold = 5
+	}
+	if op.TokenRefresh.HotWindow <= 0 {
+		op.TokenRefresh.HotWindow = 300
+	}
+	if op.TokenRefresh.RefreshBefore <= 0 {
+		op.TokenRefresh.RefreshBefore = 30
+	}
+	if op.LayerQueryCache.TTL <= 0 {
+		op.LayerQueryCache.TTL = 1000
+	}
+	if op.BlobUpload.SessionTimeout <= 0 {
+		op.BlobUpload.SessionTimeout = 3600
+	}
+	if op.OCIReport.Interval <= 0 {
+		op.OCIReport.Interval = 60
+	}
+	if op.OCIReport.FullInterval <= 0 {
+		op.OCIReport.FullInterval = 600
+	}
+	if op.OCIReport.FullInterval < op.OCIReport.Interval {
+		op.OCIReport.FullInterval = op.OCIReport.Interval
+	}
+	if op.OCISeed.MaxLayers <= 0 {
+		op.OCISeed.MaxLayers = 20
+	}
+	if err = op.checkUpstreamError(); err != nil {
+		return nil, errors.Wrapf(err, "check option upstream error failed")
+	}
+	if err = op.checkFallback(); err != nil {
+		return nil, errors.Wrapf(err, "check option fallback failed")
+	}
+	if err = op.checkPlacement(); err != nil {
+		return nil, errors.Wrapf(err, "check option placement failed")
+	}
+	if op.TransferConfig.MaxResumeAttempts <= 0 {
+		op.TransferConfig.MaxResumeAttempts = 3
+	}
+	if op.TransferConfig.Watchdog.MinThroughput <= 0 {
+		op.TransferConfig.Watchdog.MinThroughput = 1024
+	}
+	if op.TransferConfig.Watchdog.StallWindow <= 0 {
+		op.TransferConfig.Watchdog.StallWindow = 120
+	}
+	if ms := &op.TransferConfig.MultiSource; ms.Enable {
+		if ms.MinSize <= 0 {
+			ms.MinSize = 64
+		}
+		if ms.MaxSize <= 0 {
+			ms.MaxSize = 2048
+		}
+		if ms.ChunkSize <= 0 {
+			ms.ChunkSize = 16
+		}
+		if ms.MaxSources <= 1 {
+			ms.MaxSources = 4
+		}
+	}
+	if c := op.TransferConfig.Compression; c != "" && c != TransferCompressionZstd {
+		return nil, errors.Errorf("check option transfer compression failed: '%s' not supported", c)
+	}
+	if op.LocalServe.MaxConcurrency <= 0 {
+		op.LocalServe.MaxConcurrency = 20
+	}
+	if op.LocalServe.MaxWait <= 0 {
+		op.LocalServe.MaxWait = 30
+	}
+	switch op.LocalServe.IO.Mode {
+	case "":
+		op.LocalServe.IO.Mode = "direct"
+	case "direct", "buffered", "sendfile":
+	default:
+		return nil, errors.Errorf("localServe io mode '%s' not supported", op.LocalServe.IO.Mode)
+	}
+	if op.LocalServe.IO.BufferSize <= 0 {
+		op.LocalServe.IO.BufferSize = 32
+	}
+	if op.APIValidation.MaxBodySize <= 0 {
+		op.APIValidation.MaxBodySize = 1024
+	}
+	if op.APIValidation.MaxHeaderSize <= 0 {
+		op.APIValidation.MaxHeaderSize = 256
+	}
+	if op.BlobMemoryCache.MaxSize <= 0 {
+		op.BlobMemoryCache.MaxSize = 256
+	}
+	if op.BlobMemoryCache.MaxBlobSize <= 0 {
+		op.BlobMemoryCache.MaxBlobSize = 1024
+	}
+	if op.ServerConfig.ReadHeaderTimeout <= 0 {
+		op.ServerConfig.ReadHeaderTimeout = 10
+	}
+	if op.ServerConfig.IdleTimeout <= 0 {
+		op.ServerConfig.IdleTimeout = 120
+	}
+	if op.ServerConfig.MaxConcurrentStreams <= 0 {
+		op.ServerConfig.MaxConcurrentStreams = 250
+	}
+	if op.DownloadCancel.CompleteThreshold <= 0 || op.DownloadCancel.CompleteThreshold > 100 {
+		op.DownloadCancel.CompleteThreshold = 80
+	}
+	if op.IntegrityVerify.LayersPerHour <= 0 {
+		op.IntegrityVerify.LayersPerHour = 60
+	}
+	if op.IntegrityVerify.BandwidthLimit <= 0 {
+		op.IntegrityVerify.BandwidthLimit = 20
+	}
+	if op.ImageIndex.Retention <= 0 {
+		op.ImageIndex.Retention = 30
+	}
+	if op.Exemplars.SlowThreshold <= 0 {
+		op.Exemplars.SlowThreshold = 1000
+	}
+	if op.Recorder.BufferSize <= 0 {
+		op.Recorder.BufferSize = 1000
+	}
+	if op.Recorder.MaxSizeMB <= 0 {
+		op.Recorder.MaxSizeMB = 1024
+	}
+	if op.Recorder.MaxBackups <= 0 {
+		op.Recorder.MaxBackups = 5
+	}
+	if op.Recorder.RetentionDays < 0 {
+		op.Recorder.RetentionDays = 0
+	}
+	if op.ResponseLimit.MaxBodySize <= 0 {
+		op.ResponseLimit.MaxBodySize = 32
+	}
+	if op.ResponseLimit.MaxErrorBodySize <= 0 {
+		op.ResponseLimit.MaxErrorBodySize = 4
+	}
+	if op.SchedulerExtender.CacheTTL <= 0 {
+		op.SchedulerExtender.CacheTTL = 30
+	}
+	if op.KubeletCredential.CacheDuration <= 0 {
+		op.KubeletCredential.CacheDuration = 300
+	}
+	if op.ClientRedirect.MinSize <= 0 {
+		op.ClientRedirect.MinSize = 512
+	}
+	if op.ClientRedirect.Expiration <= 0 {
+		op.ClientRedirect.Expiration = 300
+	}
+	if op.ClientRedirect.Enable && op.ClientRedirect.Secret == "" {
+		return nil, errors.Errorf("check option client redirect failed: secret cannot be empty")
+	}
+	switch op.Estargz.Compression {
+	case "":
+		op.Estargz.Compression = EstargzCompressionGzip
+	case EstargzCompressionGzip, EstargzCompressionZstd:
+	default:
+		return nil, errors.Errorf("check option estargz failed: compression '%s' not supported",
+			op.Estargz.Compression)
+	}
+	if op.Estargz.MinSize <= 0 {
+		op.Estargz.MinSize = 10
+	}
+	if op.Estargz.ScanInterval <= 0 {
+		op.Estargz.ScanInterval = 300
+	}
+	if op.Estargz.TagSuffix == "" {
+		op.Estargz.TagSuffix = "-esgz"
+	}
+	if !tagSuffixRegexp.MatchString(op.Estargz.TagSuffix) {
+		return nil, errors.Errorf("check option estargz failed: tag suffix '%s' is invalid",
+			op.Estargz.TagSuffix)
+	}
+	if op.Savings.CostPerGB < 0 {
+		return nil, errors.Errorf("check option savings failed: costPerGB cannot be negative")
+	}
+	if op.Savings.CostPerGB == 0 {
+		op.Savings.CostPerGB = 0.09
+	}
+	if op.Savings.Retention <= 0 {
+		op.Savings.Retention = 400
+	}
+	if op.Autoscaling.NodeBandwidth <= 0 {
+		op.Autoscaling.NodeBandwidth = 1250
+	}
+	if op.Autoscaling.LatencyWindow <= 0 {
+		op.Autoscaling.LatencyWindow = 300
+	}
+	if op.UpstreamHealth.Interval <= 0 {
+		op.UpstreamHealth.Interval = 30
+	}
+	if op.UpstreamHealth.Timeout <= 0 {
+		op.UpstreamHealth.Timeout = 5
+	}
+	if op.UpstreamHealth.FailureThreshold <= 0 {
+		op.UpstreamHealth.FailureThreshold = 3
+	}
+	if op.InternalGRPC.Port <= 0 {
+		op.InternalGRPC.Port = 2084
+	}
+	for _, cidr := range op.TrustedRequestIDCIDRs {
+		if _, _, err = net.ParseCIDR(cidr); err != nil {
+			return nil, errors.Wrapf(err, "check option trusted request-id cidr '%s' failed", cidr)
+		}
+	}
 	localIP := os.Getenv("localIP")
 	if localIP == "" {
 		return nil, fmt.Errorf("env 'localIP' is empty")
@@ -134,21 +389,42 @@ func (o *AccelerBoatOption) checkLogConfig() error {
 	return nil
 }
 
+const (
+	// DefaultContainerdSocket the default socket of containerd
+	DefaultContainerdSocket = "/run/containerd/containerd.sock"
+	// DefaultContainerdNamespace the default namespace of containerd used by kubernetes
+	DefaultContainerdNamespace = "k8s.io"
+)
+
 func (o *AccelerBoatOption) checkStorageConfig() error {
-	if err := os.MkdirAll(o.StorageConfig.TransferPath, 0600); err != nil {
-		return errors.Wrapf(err, "create file-path '%s' failed", o.StorageConfig.TransferPath)
+	if _, err := parseFileMode(o.StorageConfig.DirMode); err != nil {
+		return errors.Wrapf(err, "check dirMode failed")
+	}
+	if _, err := parseFileMode(o.StorageConfig.FileMode); err != nil {
+		return errors.Wrapf(err, "check fileMode failed")
+	}
+	// the directories should be executable for the user to access the files under them
+	dirPerm := o.StorageConfig.DirPerm()
+	if dirPerm&0700 != 0700 {
+		return errors.Errorf("dirMode '%o' should be readable, writable and executable for owner", dirPerm)
 	}
-	if err := os.MkdirAll(o.StorageConfig.DownloadPath, 0600); err != nil {
-		return errors.Wrapf(err, "create file-path '%s' failed", o.StorageConfig.DownloadPath)
+	if o.StorageConfig.FilePerm()&0600 != 0600 {
+		return errors.Errorf("fileMode '%o' should be readable and writable for owner", o.StorageConfig.FilePerm())
+	}
+	for _, p := range []string{o.StorageConfig.TransferPath, o.StorageConfig.DownloadPath,
+		o.StorageConfig.SmallFilePath, o.StorageConfig.TorrentPath, o.StorageConfig.OCIPath} {
+		if err := os.MkdirAll(p, dirPerm); err != nil {
+			return errors.Wrapf(err, "create file-path '%s' failed", p)
+		}
 	}
-	if err := os.MkdirAll(o.StorageConfig.SmallFilePath, 0600); err != nil {
-		return errors.Wrapf(err, "create file-path '%s' failed", o.StorageConfig.SmallFilePath)
+	if o.ContainerdConfig.Socket == "" {
+		o.ContainerdConfig.Socket = DefaultContainerdSocket
 	}
-	if err := os.MkdirAll(o.StorageConfig.TorrentPath, 0600); err != nil {
-		return errors.Wrapf(err, "create file-path '%s' failed", o.StorageConfig.TorrentPath)
+	if len(o.ContainerdConfig.Namespaces) == 0 {
+		o.ContainerdConfig.Namespaces = []string{DefaultContainerdNamespace}
 	}
-	if err := os.MkdirAll(o.StorageConfig.OCIPath, 0600); err != nil {
-		return errors.Wrapf(err, "create file-path '%s' failed", o.StorageConfig.OCIPath)
+	if o.ContainerdConfig.Timeout <= 0 {
+		o.ContainerdConfig.Timeout = 10
 	}
 	return nil
 }
@@ -177,11 +453,12 @@ func (o *AccelerBoatOption) checkCleanConfig() error {
 	return nil
 }
 
+var cronParser = cron.NewParser(
+	cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
 func ParseCron(expr string) error {
-	parser := cron.NewParser(
-		cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
-	)
-	schedule, err := parser.Parse(expr)
+	schedule, err := cronParser.Parse(expr)
 	if err != nil {
 		return errors.Wrapf(err, "parse cron expression '%s' failed", expr)
 	}
@@ -195,6 +472,35 @@ func ParseCron(expr string) error {
 }
 
 func (o *AccelerBoatOption) checkServiceDiscovery() error {
+	sd := &o.ServiceDiscovery
+	if sd.Type == "" {
+		sd.Type = ServiceDiscoveryKubernetes
+	}
+	if sd.HealthCheckInterval <= 0 {
+		sd.HealthCheckInterval = 10
+	}
+	switch sd.Type {
+	case ServiceDiscoveryKubernetes:
+	case ServiceDiscoveryStatic:
+		if len(sd.Endpoints) == 0 {
+			return errors.Errorf("endpoints cannot be empty for static type")
+		}
+		for _, ip := range sd.Endpoints {
+			if net.ParseIP(ip) == nil {
+				return errors.Errorf("endpoint '%s' is not an ip", ip)
+			}
+		}
+		return o.checkStandalone()
+	case ServiceDiscoveryDNS:
+		if sd.DNSName == "" {
+			return errors.Errorf("dnsName cannot be empty for dns type")
+		}
+		return o.checkStandalone()
+	case ServiceDiscoveryNone:
+		return o.checkStandalone()
+	default:
+		return errors.Errorf("type '%s' not supported, should be kubernetes, static, dns or none", sd.Type)
+	}
 	if o.ServiceDiscovery.ServiceNamespace == "" {
 		return fmt.Errorf("namespace cannot be empty")
 	}
@@ -215,8 +521,31 @@ func (o *AccelerBoatOption) checkServiceDiscovery() error {
 	return nil
 }
 
+// checkStandalone checks the features needing kubernetes are not enabled while running without it
+func (o *AccelerBoatOption) checkStandalone() error {
+	needKubernetes := []struct {
+		name    string
+		enabled bool
+	}{
+		{"preheat", o.Preheat.Enable},
+		{"podIdentity", o.PodIdentity.Enable},
+		{"schedulerExtender", o.SchedulerExtender.Enable},
+		{"externalConfig.pullSecrets", len(o.ExternalConfig.PullSecrets) != 0},
+		{"preferConfig.preferNodes", o.ServiceDiscovery.PreferConfig.PreferNodes.LabelSelectors != ""},
+	}
+	for _, feature := range needKubernetes {
+		if feature.enabled {
+			return errors.Errorf("'%s' needs kubernetes, not supported with type '%s'", feature.name,
+				o.ServiceDiscovery.Type)
+		}
+	}
+	return nil
+}
+
 var (
 	labelSelectorRegexp, _ = regexp.Compile(`^[^=,]+=[^=,]+(,[^=,]+=[^=,]+)*$`)
+	// tagSuffixRegexp the suffix appended to the image tags, it has the same charset of tags
+	tagSuffixRegexp = regexp.MustCompile(`^[\w.-]{1,64}$`)
 )
 
 func (o *AccelerBoatOption) checkPreferConfig() error {
@@ -246,6 +575,73 @@ func (o *AccelerBoatOption) checkTorrentConfig() error {
 	if o.TorrentConfig.DownloadLimit > 0 && o.TorrentConfig.DownloadLimit < 10 {
 		o.TorrentConfig.DownloadLimit = 10
 	}
+	if o.TorrentConfig.GenerateWorkers <= 0 {
+		o.TorrentConfig.GenerateWorkers = 2
+	}
+	if o.TorrentConfig.GenerateQueueSize <= 0 {
+		o.TorrentConfig.GenerateQueueSize = 100
+	}
+	if o.TorrentConfig.MinSeeders <= 0 {
+		o.TorrentConfig.MinSeeders = 2
+	}
+	if hedge := &o.TorrentConfig.Hedge; hedge.Enable {
+		if hedge.Threshold <= 0 {
+			hedge.Threshold = 1024
+		}
+		if hedge.Delay <= 0 {
+			hedge.Delay = 10
+		}
+		if hedge.MinProgress <= 0 || hedge.MinProgress > 100 {
+			hedge.MinProgress = 20
+		}
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkBandwidthConfig() error {
+	if o.BandwidthConfig.OriginLimit < 0 {
+		return errors.Errorf("originLimit cannot be negative")
+	}
+	for i, s := range o.BandwidthConfig.Schedules {
+		if s == nil {
+			return errors.Errorf("schedule[%d] cannot be empty", i)
+		}
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("schedule-%d", i)
+		}
+		if _, err := cronParser.Parse(s.Cron); err != nil {
+			return errors.Wrapf(err, "schedule '%s' parse cron expression '%s' failed", s.Name, s.Cron)
+		}
+		duration, err := time.ParseDuration(s.Duration)
+		if err != nil {
+			return errors.Wrapf(err, "schedule '%s' parse duration '%s' failed", s.Name, s.Duration)
+		}
+		if duration <= 0 {
+			return errors.Errorf("schedule '%s' duration must be positive", s.Name)
+		}
+		if s.UploadLimit < 0 || s.DownloadLimit < 0 || s.OriginLimit < 0 {
+			return errors.Errorf("schedule '%s' limits cannot be negative", s.Name)
+		}
+	}
+	return nil
+}
+
+// checkHTTPProxy parses the http proxy of registry mapping
+func (mp *RegistryMapping) checkHTTPProxy() error {
+	if mp.HTTPProxy == "" {
+		return nil
+	}
+	if mp.NoProxy {
+		return errors.Errorf("httpProxy and noProxy cannot be set together")
+	}
+	var err error
+	if mp.HTTPProxyUrl, err = url.Parse(mp.HTTPProxy); err != nil {
+		return errors.Wrapf(err, "http_proxy '%s' is invalid", mp.HTTPProxy)
+	}
+	if err = checkNetConnectivity(mp.HTTPProxy); err != nil {
+		return errors.Wrapf(err, "check http_proxy connectivity failed")
+	}
+	logger.Infof("set http_proxy '%s' for registry '%s' success", mp.HTTPProxy, mp.OriginalHost)
 	return nil
 }
 
@@ -274,7 +670,62 @@ func (o *AccelerBoatOption) checkExternalConfig() error {
 		v.Key = string(keyBase64)
 		v.Cert = string(certBase64)
 	}
+	for _, secret := range o.ExternalConfig.PullSecrets {
+		parts := strings.Split(secret, "/")
+		if len(parts) > 2 || slices.Contains(parts, "") {
+			return errors.Errorf("pull secret '%s' not in 'namespace/name' format", secret)
+		}
+	}
 	for _, mp := range o.ExternalConfig.RegistryMappings {
+		// original host accepts the base url with path prefix, e.g. https://gateway.example.com/harbor
+		mp.OriginalHost = strings.TrimSuffix(strings.TrimPrefix(mp.OriginalHost, "https://"), "/")
+		for i := range mp.Replicas {
+			mp.Replicas[i] = strings.TrimSuffix(strings.TrimPrefix(mp.Replicas[i], "https://"), "/")
+			if mp.Replicas[i] == "" || mp.Replicas[i] == mp.OriginalHost {
+				return errors.Errorf("registry mapping '%s' replica '%s' invalid", mp.ProxyHost, mp.Replicas[i])
+			}
+		}
+		switch mp.Type {
+		case RegistryTypeOriginal:
+		case RegistryTypeOCILayout:
+			if mp.Path == "" {
+				return errors.Errorf("registry mapping '%s' with type '%s' must have path", mp.ProxyHost, mp.Type)
+			}
+			if _, err := os.Stat(filepath.Join(mp.Path, "index.json")); err != nil {
+				return errors.Wrapf(err, "registry mapping '%s' path '%s' is not oci layout", mp.ProxyHost, mp.Path)
+			}
+		default:
+			return errors.Errorf("registry mapping '%s' type '%s' not supported", mp.ProxyHost, mp.Type)
+		}
+		if err := mp.checkSignatureVerification(); err != nil {
+			return errors.Wrapf(err, "registry mapping '%s' signature verification invalid", mp.ProxyHost)
+		}
+		if err := mp.checkCredentialProvider(); err != nil {
+			return errors.Wrapf(err, "registry mapping '%s' credential provider invalid", mp.ProxyHost)
+		}
+		switch mp.BlobRedirect {
+		case BlobRedirectPassthrough, BlobRedirectFollow, BlobRedirectRewrite:
+		default:
+			return errors.Errorf("registry mapping '%s' blob redirect '%s' not supported", mp.ProxyHost,
+				mp.BlobRedirect)
+		}
+		if mp.Shadow != nil {
+			mp.Shadow.OriginalHost = strings.TrimSuffix(strings.TrimPrefix(mp.Shadow.OriginalHost, "https://"), "/")
+			if mp.Shadow.Enable && mp.Shadow.OriginalHost == "" {
+				return errors.Errorf("registry mapping '%s' shadow must have originalHost", mp.ProxyHost)
+			}
+		}
+		if err := mp.checkHTTPProxy(); err != nil {
+			return errors.Wrapf(err, "registry mapping '%s' http proxy invalid", mp.ProxyHost)
+		}
+		if err := mp.checkHeaderPolicy(); err != nil {
+			return errors.Wrapf(err, "registry mapping '%s' header policy invalid", mp.ProxyHost)
+		}
+		for _, cidr := range mp.AllowedClientCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return errors.Wrapf(err, "registry mapping '%s' allowed client cidr '%s' invalid", mp.ProxyHost, cidr)
+			}
+		}
 		v, ok := o.ExternalConfig.BuiltInCerts[mp.ProxyHost]
 		if ok {
 			mp.ProxyCert = v.Cert
@@ -311,6 +762,374 @@ func (o *AccelerBoatOption) checkExternalConfig() error {
 	return nil
 }
 
+func (mp *RegistryMapping) checkHeaderPolicy() error {
+	policy := mp.HeaderPolicy
+	if policy == nil {
+		return nil
+	}
+	for _, name := range policy.Deny {
+		for _, required := range requiredHeaders {
+			if strings.EqualFold(name, required) {
+				return errors.Errorf("header '%s' cannot be denied", name)
+			}
+		}
+	}
+	for name, value := range policy.Inject {
+		if name == "" || strings.ContainsAny(name, ": \r\n") || strings.ContainsAny(value, "\r\n") {
+			return errors.Errorf("injected header '%s' is invalid", name)
+		}
+	}
+	if strings.ContainsAny(policy.UserAgent, "\r\n") {
+		return errors.Errorf("user agent '%s' is invalid", policy.UserAgent)
+	}
+	return nil
+}
+
+func (mp *RegistryMapping) checkCredentialProvider() error {
+	cp := mp.CredentialProvider
+	if cp == nil {
+		return nil
+	}
+	switch cp.Type {
+	case CredentialProviderECR:
+		if cp.Region == "" {
+			cp.Region = parseECRRegion(mp.OriginalHostname())
+		}
+		if cp.Region == "" {
+			return errors.Errorf("region is required, cannot parse from '%s'", mp.OriginalHost)
+		}
+	case CredentialProviderGAR:
+	case CredentialProviderACR:
+		if cp.ClientSecret != "" && (cp.TenantID == "" || cp.ClientID == "") {
+			return errors.Errorf("tenantID and clientID are required with clientSecret")
+		}
+	default:
+		return errors.Errorf("type '%s' not supported", cp.Type)
+	}
+	return nil
+}
+
+// parseECRRegion returns the region of ECR host, e.g. 123456789012.dkr.ecr.us-east-1.amazonaws.com
+func parseECRRegion(host string) string {
+	parts := strings.Split(host, ".")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] == "dkr" && parts[i+1] == "ecr" {
+			return parts[i+2]
+		}
+	}
+	return ""
+}
+
+func (mp *RegistryMapping) checkSignatureVerification() error {
+	sv := mp.SignatureVerification
+	if sv == nil || !sv.Enable {
+		return nil
+	}
+	switch sv.Mode {
+	case "":
+		sv.Mode = SignatureVerifyEnforce
+	case SignatureVerifyEnforce, SignatureVerifyWarn:
+	default:
+		return errors.Errorf("mode '%s' not supported", sv.Mode)
+	}
+	if len(sv.PublicKeys) == 0 && len(sv.KeylessIdentities) == 0 {
+		return errors.Errorf("publicKeys and keylessIdentities cannot both be empty")
+	}
+	if len(sv.KeylessIdentities) != 0 && len(sv.KeylessRoots) == 0 {
+		return errors.Errorf("keylessRoots cannot be empty when keylessIdentities set")
+	}
+	for _, identity := range sv.KeylessIdentities {
+		if identity == nil || identity.Subject == "" {
+			return errors.Errorf("keyless identity subject cannot be empty")
+		}
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkClientQuota() error {
+	cq := &o.ClientQuota
+	if !cq.Enable {
+		return nil
+	}
+	switch cq.IdentifyBy {
+	case "":
+		cq.IdentifyBy = ClientIdentifyIP
+	case ClientIdentifyIP:
+	case ClientIdentifyCert:
+		if cq.ClientCA == "" {
+			return errors.Errorf("clientCA cannot be empty when identify client by cert")
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM([]byte(cq.ClientCA)) {
+			return errors.Errorf("parse clientCA failed")
+		}
+	default:
+		return errors.Errorf("identifyBy '%s' not supported", cq.IdentifyBy)
+	}
+	quotas := []ClientQuota{cq.DefaultQuota}
+	for _, q := range cq.Clients {
+		if q != nil {
+			quotas = append(quotas, *q)
+		}
+	}
+	for _, q := range quotas {
+		if q.MaxConcurrency < 0 || q.BandwidthLimit < 0 {
+			return errors.Errorf("quota cannot be negative")
+		}
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkClientVerify() error {
+	cv := &o.ClientVerify
+	if !cv.Enable {
+		return nil
+	}
+	switch cv.Mode {
+	case "":
+		cv.Mode = ClientVerifyRequire
+	case ClientVerifyRequire, ClientVerifyIfGiven:
+	default:
+		return errors.Errorf("mode '%s' not supported", cv.Mode)
+	}
+	if cv.ClientCA == "" {
+		return errors.Errorf("clientCA cannot be empty")
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(cv.ClientCA)) {
+		return errors.Errorf("parse clientCA failed")
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkUpstreamError() error {
+	ue := &o.UpstreamError
+	defaults := []struct {
+		name  string
+		mode  *UpstreamErrorMode
+		value UpstreamErrorMode
+	}{
+		{"auth", &ue.Auth, UpstreamErrorPropagate},
+		{"clientError", &ue.ClientError, UpstreamErrorFallback},
+		{"serverError", &ue.ServerError, UpstreamErrorFallback},
+	}
+	for _, d := range defaults {
+		switch *d.mode {
+		case "":
+			*d.mode = d.value
+		case UpstreamErrorPropagate, UpstreamErrorFallback:
+		default:
+			return errors.Errorf("upstream error '%s' mode '%s' not supported, should be '%s' or '%s'",
+				d.name, *d.mode, UpstreamErrorPropagate, UpstreamErrorFallback)
+		}
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkFallback() error {
+	rules := []struct {
+		name string
+		rule *FallbackRule
+	}{
+		{FallbackCategoryToken, &o.Fallback.Token},
+		{FallbackCategoryManifest, &o.Fallback.Manifest},
+		{FallbackCategoryBlob, &o.Fallback.Blob},
+	}
+	for _, r := range rules {
+		switch r.rule.Mode {
+		case "":
+			r.rule.Mode = FallbackAlways
+		case FallbackAlways, FallbackNever:
+		case FallbackBudgeted:
+			if r.rule.Budget <= 0 {
+				r.rule.Budget = 60
+			}
+		default:
+			return errors.Errorf("fallback '%s' mode '%s' not supported, should be '%s', '%s' or '%s'",
+				r.name, r.rule.Mode, FallbackAlways, FallbackNever, FallbackBudgeted)
+		}
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkPlacement() error {
+	pc := &o.Placement
+	switch pc.Mode {
+	case "":
+		pc.Mode = PlacementLeastTasks
+	case PlacementLeastTasks, PlacementConsistentHash:
+	default:
+		return errors.Errorf("mode '%s' not supported, should be '%s' or '%s'",
+			pc.Mode, PlacementLeastTasks, PlacementConsistentHash)
+	}
+	if pc.Owners <= 0 {
+		pc.Owners = 2
+	}
+	if pc.VirtualNodes <= 0 {
+		pc.VirtualNodes = 100
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkPeerTLS() error {
+	pt := &o.PeerTLS
+	if !pt.Enable {
+		return nil
+	}
+	if pt.Port <= 0 {
+		pt.Port = 2083
+	}
+	if pt.CAFile == "" {
+		return errors.Errorf("caFile cannot be empty")
+	}
+	if pt.CAKeyFile == "" && (pt.CertFile == "" || pt.KeyFile == "") {
+		return errors.Errorf("caKeyFile or certFile/keyFile should be given")
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkPreheat() error {
+	pc := &o.Preheat
+	if pc.Namespace == "" {
+		pc.Namespace = o.ServiceDiscovery.ServiceNamespace
+	}
+	if pc.LabelSelector == "" {
+		pc.LabelSelector = "accelerboat.github.com/preheat-task=true"
+	}
+	if _, err := labels.Parse(pc.LabelSelector); err != nil {
+		return errors.Wrapf(err, "labelSelector '%s' invalid", pc.LabelSelector)
+	}
+	if pc.SyncInterval <= 0 {
+		pc.SyncInterval = 30
+	}
+	if pc.HistoryLimit <= 0 {
+		pc.HistoryLimit = 50
+	}
+	wc := &pc.Webhook
+	if !wc.Enable {
+		return nil
+	}
+	if wc.Secret == "" && wc.Token == "" {
+		return errors.Errorf("webhook secret and token cannot be both empty")
+	}
+	for _, pattern := range wc.Repositories {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "webhook repository pattern '%s' invalid", pattern)
+		}
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkFederation() error {
+	fc := &o.Federation
+	if !fc.Enable {
+		return nil
+	}
+	if fc.ClusterName == "" {
+		return errors.Errorf("clusterName cannot be empty")
+	}
+	if fc.RedisAddress == "" {
+		return errors.Errorf("redisAddress cannot be empty")
+	}
+	if fc.Token == "" {
+		return errors.Errorf("token cannot be empty")
+	}
+	if fc.GatewayEndpoint == "" {
+		return errors.Errorf("gatewayEndpoint cannot be empty")
+	}
+	if !strings.HasPrefix(fc.GatewayEndpoint, "http://") && !strings.HasPrefix(fc.GatewayEndpoint, "https://") {
+		fc.GatewayEndpoint = "http://" + fc.GatewayEndpoint
+	}
+	fc.GatewayEndpoint = strings.TrimSuffix(fc.GatewayEndpoint, "/")
+	if fc.PublishInterval <= 0 {
+		fc.PublishInterval = 60
+	}
+	if fc.BandwidthLimit < 0 {
+		fc.BandwidthLimit = 0
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkParent() error {
+	pc := &o.Parent
+	if !pc.Enable {
+		return nil
+	}
+	if pc.Endpoint == "" {
+		return errors.Errorf("endpoint cannot be empty")
+	}
+	if pc.Token == "" {
+		return errors.Errorf("token cannot be empty")
+	}
+	if !strings.HasPrefix(pc.Endpoint, "http://") && !strings.HasPrefix(pc.Endpoint, "https://") {
+		pc.Endpoint = "http://" + pc.Endpoint
+	}
+	pc.Endpoint = strings.TrimSuffix(pc.Endpoint, "/")
+	return nil
+}
+
+func (o *AccelerBoatOption) checkAccessLog() error {
+	al := &o.AccessLog
+	if !al.Enable {
+		return nil
+	}
+	switch al.Output {
+	case "":
+		al.Output = AccessLogFile
+	case AccessLogFile, AccessLogStdout:
+	default:
+		return errors.Errorf("access log output '%s' not supported", al.Output)
+	}
+	if al.PingSampleRate < 0 || al.PingSampleRate > 1 {
+		return errors.Errorf("access log pingSampleRate '%v' should be in [0, 1]", al.PingSampleRate)
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkLayerScan() error {
+	ls := &o.LayerScan
+	if !ls.Enable {
+		return nil
+	}
+	switch ls.Type {
+	case LayerScanExec:
+		if len(ls.Command) == 0 {
+			return errors.Errorf("layer scan command cannot be empty for exec hook")
+		}
+	case LayerScanHTTP:
+		if ls.URL == "" {
+			return errors.Errorf("layer scan url cannot be empty for http hook")
+		}
+	default:
+		return errors.Errorf("layer scan type '%s' not supported", ls.Type)
+	}
+	switch ls.Action {
+	case "":
+		ls.Action = LayerScanBlock
+	case LayerScanBlock, LayerScanWarn:
+	default:
+		return errors.Errorf("layer scan action '%s' not supported", ls.Action)
+	}
+	if ls.Timeout <= 0 {
+		ls.Timeout = 300
+	}
+	return nil
+}
+
+func (o *AccelerBoatOption) checkObjectStorage() error {
+	if !o.ObjectStorage.Enable {
+		return nil
+	}
+	if o.ObjectStorage.Endpoint == "" {
+		return fmt.Errorf("object storage endpoint cannot be empty")
+	}
+	if o.ObjectStorage.Bucket == "" {
+		return fmt.Errorf("object storage bucket cannot be empty")
+	}
+	o.ObjectStorage.Endpoint = strings.TrimPrefix(strings.TrimPrefix(o.ObjectStorage.Endpoint, "http://"),
+		"https://")
+	o.ObjectStorage.Prefix = strings.Trim(o.ObjectStorage.Prefix, "/")
+	return nil
+}
+
 // checkNetConnectivity check whether the target can connect
 func checkNetConnectivity(target string) error {
 	afterTrim := strings.TrimPrefix(strings.TrimPrefix(target, "http://"), "https://")
@@ -0,0 +1,105 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+// subscriberBuffer the buffered changes of one subscriber, the changes are dropped for the slow subscriber
+// and it should read the latest options with GlobalOptions
+const subscriberBuffer = 8
+
+var (
+	// current holds the snapshot of options, the snapshot is immutable after stored. Config reload and
+	// runtime changes store a new snapshot instead of modifying it, so the readers never race with them.
+	current atomic.Pointer[AccelerBoatOption]
+	// emptyOption is returned before the options are parsed
+	emptyOption = new(AccelerBoatOption)
+	// storeLock serializes the stores of snapshot, so that the changes are published in order
+	storeLock   sync.Mutex
+	subscribers = newOptionSubscribers()
+)
+
+// GlobalOptions returns the current snapshot of options. The snapshot should not be modified, and the
+// callers should keep it for one operation only to see the later changes.
+func GlobalOptions() *AccelerBoatOption {
+	if op := current.Load(); op != nil {
+		return op
+	}
+	return emptyOption
+}
+
+// storeOption stores the snapshot and publishes the changes to the subscribers, returns the previous one
+func storeOption(op *AccelerBoatOption) *AccelerBoatOption {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	prev := current.Swap(op)
+	if prev != nil {
+		subscribers.publish(&OptionChanges{Prev: prev, Current: op})
+	}
+	return prev
+}
+
+// updateOption stores the snapshot generated from the current one by update, the update should copy the
+// parts it modifies
+func updateOption(update func(cur *AccelerBoatOption) (*AccelerBoatOption, error)) error {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	prev := GlobalOptions()
+	next, err := update(prev)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return errors.Errorf("updated options cannot be nil")
+	}
+	current.Store(next)
+	subscribers.publish(&OptionChanges{Prev: prev, Current: next})
+	return nil
+}
+
+type optionSubscribers struct {
+	sync.Mutex
+	subs map[chan *OptionChanges]struct{}
+}
+
+func newOptionSubscribers() *optionSubscribers {
+	return &optionSubscribers{subs: make(map[chan *OptionChanges]struct{})}
+}
+
+func (s *optionSubscribers) publish(changes *OptionChanges) {
+	s.Lock()
+	defer s.Unlock()
+	for ch := range s.subs {
+		select {
+		case ch <- changes:
+		default:
+			logger.Warnf("option changes dropped for slow subscriber")
+		}
+	}
+}
+
+// Subscribe returns the channel receiving the changes of options (config reload or runtime changes), the
+// channel is closed when ctx done
+func Subscribe(ctx context.Context) <-chan *OptionChanges {
+	ch := make(chan *OptionChanges, subscriberBuffer)
+	subscribers.Lock()
+	subscribers.subs[ch] = struct{}{}
+	subscribers.Unlock()
+	context.AfterFunc(ctx, func() {
+		subscribers.Lock()
+		defer subscribers.Unlock()
+		delete(subscribers.subs, ch)
+		close(ch)
+	})
+	return ch
+}
@@ -5,11 +5,20 @@
 package options
 
 import (
+	"net"
+	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/version"
 )
 
 // AccelerBoatOption defines the option of accelerboat
@@ -29,12 +38,25 @@ type AccelerBoatOption struct {
 
 	// ServiceDiscovery defines the discovery between all nodes
 	ServiceDiscovery ServiceDiscovery `json:"serviceDiscovery"`
+	// TrustedRequestIDCIDRs the clients in these CIDRs are allowed to pass the request id (X-Request-ID or
+	// traceparent), loopback and cluster nodes are always trusted
+	TrustedRequestIDCIDRs []string `json:"trustedRequestIDCIDRs,omitempty"`
 
 	// EnableContainerd enable containerd image discovery
 	EnableContainerd bool `json:"enableContainerd"`
+	// ContainerdConfig defines the socket and namespaces of containerd image discovery
+	ContainerdConfig ContainerdConfig `json:"containerdConfig"`
+	// RunAs defines the expected user of process, it is checked at startup
+	RunAs RunAsConfig `json:"runAs"`
+	// OCIReport defines the interval of reporting the containerd layers into cache store
+	OCIReport OCIReportConfig `json:"ociReport"`
+	// OCISeed defines the seeding of containerd layers into the torrent swarm at startup
+	OCISeed OCISeedConfig `json:"ociSeed"`
 
 	// TorrentConfig defines the config for torrent
 	TorrentConfig TorrentConfig `json:"torrentConfig"`
+	// BandwidthConfig defines the origin egress limit and the scheduled bandwidth profiles
+	BandwidthConfig BandwidthConfig `json:"bandwidthConfig"`
 
 	// Redis used to save some cache
 	RedisAddress  string `json:"redisAddress"`
@@ -43,6 +65,87 @@ type AccelerBoatOption struct {
 	// ExternalConfig defines the external config
 	ExternalConfig ExternalConfig `json:"externalConfig"`
 
+	// ObjectStorage defines the S3-compatible object storage used as the shared layer cache tier
+	ObjectStorage ObjectStorageConfig `json:"objectStorage"`
+
+	// LayerScan defines the hook to scan the downloaded layers before they are promoted into cache
+	LayerScan LayerScanConfig `json:"layerScan"`
+
+	// AccessLog defines the access log of proxied registry requests
+	AccessLog AccessLogConfig `json:"accessLog"`
+
+	// ClientQuota defines the client identification and per-client quotas of proxied registry requests
+	ClientQuota ClientQuotaConfig `json:"clientQuota"`
+	// ClientVerify defines the mutual-TLS verification of clients on the HTTPS port
+	ClientVerify ClientVerifyConfig `json:"clientVerify"`
+	// HostValidation defines the validation of Host header against the registry mappings and TLS server name
+	HostValidation HostValidationConfig `json:"hostValidation"`
+	// PeerTLS defines the mutual-TLS channel of node-to-node layer transfer
+	PeerTLS PeerTLSConfig `json:"peerTLS"`
+	// TransferConfig defines the node-to-node layer transfer with tcp
+	TransferConfig TransferConfig `json:"transferConfig"`
+	// LocalServe defines the concurrency of serving the local layers to clients
+	LocalServe LocalServeConfig `json:"localServe"`
+	// BlobMemoryCache defines the in-memory cache of small blobs served to clients
+	BlobMemoryCache BlobMemoryCacheConfig `json:"blobMemoryCache"`
+	// ServerConfig defines the timeouts and connection limits of the HTTP/HTTPS listeners
+	ServerConfig ServerConfig `json:"serverConfig"`
+	// APIValidation defines the validation of custom api requests between nodes
+	APIValidation APIValidationConfig `json:"apiValidation"`
+	// DownloadCancel defines the cancellation of layer downloads whose pulling clients are disconnected
+	DownloadCancel DownloadCancelConfig `json:"downloadCancel"`
+	// InternalGRPC defines the gRPC internal API between nodes
+	InternalGRPC InternalGRPCConfig `json:"internalGRPC"`
+	// UpstreamError defines whether the failures of original registry are propagated to clients
+	UpstreamError UpstreamErrorConfig `json:"upstreamError"`
+	// Fallback defines whether the failed requests fall back to reverse proxy per category
+	Fallback FallbackConfig `json:"fallback"`
+	// BlobUpload defines the proxying of blob upload sessions pushed through the proxy
+	BlobUpload BlobUploadConfig `json:"blobUpload"`
+
+	// ArtifactConfig defines the handling of non-image OCI artifacts, e.g. helm charts and wasm modules
+	ArtifactConfig ArtifactConfig `json:"artifactConfig"`
+	// TokenCache defines the cluster-wide service token cache in cache store
+	TokenCache TokenCacheConfig `json:"tokenCache"`
+	// TokenRefresh defines the background refresh of service tokens of hot scopes
+	TokenRefresh TokenRefreshConfig `json:"tokenRefresh"`
+	// LayerQueryCache defines the in-memory cache of layer locations queried from cache store
+	LayerQueryCache LayerQueryCacheConfig `json:"layerQueryCache"`
+	// Federation defines the sharing of layer locations with the clusters of the same federation
+	Federation FederationConfig `json:"federation"`
+	// Preheat defines the declarative image preheating driven by ConfigMaps
+	Preheat PreheatConfig `json:"preheat"`
+	// IntegrityVerify defines the background verification of cached layers
+	IntegrityVerify IntegrityVerifyConfig `json:"integrityVerify"`
+	// ImageIndex defines the index of images pulled through the proxy
+	ImageIndex ImageIndexConfig `json:"imageIndex"`
+	// Exemplars defines the exemplars attached to the latency metrics of slow requests
+	Exemplars ExemplarsConfig `json:"exemplars"`
+	// Recorder defines the buffer and event file rotation of the recorder
+	Recorder RecorderConfig `json:"recorder"`
+	// ResponseLimit defines the limits of the response bodies buffered in memory
+	ResponseLimit ResponseLimitConfig `json:"responseLimit"`
+	// SchedulerExtender defines the layer availability API and the prioritize webhook of kube-scheduler
+	SchedulerExtender SchedulerExtenderConfig `json:"schedulerExtender"`
+	// KubeletCredential defines the registry credentials served to the kubelet credential provider
+	KubeletCredential KubeletCredentialConfig `json:"kubeletCredential"`
+	// PodIdentity defines the attribution of pulls to the client pods
+	PodIdentity PodIdentityConfig `json:"podIdentity"`
+	// Placement defines the assignment of layer downloads and the cached layers served to nodes
+	Placement PlacementConfig `json:"placement"`
+	// ClientRedirect defines the redirect of clients to the nodes holding the layers
+	ClientRedirect ClientRedirectConfig `json:"clientRedirect"`
+	// Estargz defines the conversion of cached layers to eStargz and the lazy pulling through proxy
+	Estargz EstargzConfig `json:"estargz"`
+	// Savings defines the accounting of the bytes downloaded from original registries
+	Savings SavingsConfig `json:"savings"`
+	// Autoscaling defines the load signals for autoscaling the proxy tier
+	Autoscaling AutoscalingConfig `json:"autoscaling"`
+	// UpstreamHealth defines the active probing of the original hosts
+	UpstreamHealth UpstreamHealthConfig `json:"upstreamHealth"`
+	// Parent defines the regional parent cluster checked before the original registry
+	Parent ParentConfig `json:"parent"`
+
 	k8sClient *kubernetes.Clientset
 }
 
@@ -52,6 +155,9 @@ type LogConfig struct {
 	LogMaxSize    int    `json:"logMaxSize"`
 	LogMaxBackups int    `json:"logMaxBackups"`
 	LogMaxAge     int    `json:"logMaxAge"`
+	// DumpGoroutineOnPanic dumps the traces of all goroutines into LogDir when http handler panic, once per
+	// stack in 10 minutes and at most 32MiB
+	DumpGoroutineOnPanic bool `json:"dumpGoroutineOnPanic"`
 }
 
 // StorageConfig defines the config of storage
@@ -71,6 +177,84 @@ type StorageConfig struct {
 	OCIPath string `json:"ociPath"`
 	// EventFile defines the file to store events
 	EventFile string `json:"eventFile"`
+	// RedisQueueFile defines the file to persist the layer writes while redis unavailable, they are
+	// replayed when redis returns. The writes are only kept in memory if empty.
+	RedisQueueFile string `json:"redisQueueFile"`
+	// DirMode/FileMode the octal permissions (e.g. "0750") of the created storage directories and layer
+	// files, default is 0755 and 0644. They are masked by the umask of process.
+	DirMode  string `json:"dirMode,omitempty"`
+	FileMode string `json:"fileMode,omitempty"`
+}
+
+const (
+	defaultDirMode  os.FileMode = 0755
+	defaultFileMode os.FileMode = 0644
+)
+
+// LayerDirs returns the directories of complete layer files, only the files under them are served to
+// the other nodes
+func (c *StorageConfig) LayerDirs() []string {
+	return []string{c.TransferPath, c.SmallFilePath, c.TorrentPath, c.OCIPath}
+}
+
+// DirPerm returns the permission of created storage directories
+func (c *StorageConfig) DirPerm() os.FileMode {
+	if perm, err := parseFileMode(c.DirMode); err == nil && perm != 0 {
+		return perm
+	}
+	return defaultDirMode
+}
+
+// FilePerm returns the permission of created layer files
+func (c *StorageConfig) FilePerm() os.FileMode {
+	if perm, err := parseFileMode(c.FileMode); err == nil && perm != 0 {
+		return perm
+	}
+	return defaultFileMode
+}
+
+// parseFileMode parses the octal permission, returns 0 if empty
+func parseFileMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse mode '%s' failed", mode)
+	}
+	if perm > 0777 {
+		return 0, errors.Errorf("mode '%s' is not permission bits", mode)
+	}
+	return os.FileMode(perm), nil
+}
+
+// ContainerdConfig defines the containerd client of image discovery. The layers of all the namespaces
+// are reported, and the client is reconnected with the report interval if the socket is not available
+// at startup.
+type ContainerdConfig struct {
+	// Socket the socket of containerd, default is /run/containerd/containerd.sock
+	Socket string `json:"socket"`
+	// Namespaces the containerd namespaces to be scanned, default is [k8s.io]
+	Namespaces []string `json:"namespaces"`
+	// Timeout the timeout(seconds) of connecting and listing containerd, default is 10
+	Timeout int64 `json:"timeout"`
+}
+
+// RunAsConfig defines the user the process is expected to run as. Accelerboat does not need root if:
+//   - the storage paths and log dir are owned by (or writable for) the user, they are verified at startup;
+//   - the ports are not less than 1024, or the process has CAP_NET_BIND_SERVICE;
+//   - the containerd socket (only if EnableContainerd) is readable and writable for the user or its group,
+//     it is owned by root:root with 0660 by default, so the socket group should be granted or the socket
+//     of a rootless containerd is configured with ContainerdConfig.Socket.
+//
+// The hard links between storage paths require them on the same file system, and the O_DIRECT reads and
+// sendfile do not need any capability.
+type RunAsConfig struct {
+	// NonRoot the startup fails if the effective user is root
+	NonRoot bool `json:"nonRoot"`
+	// UID/GID the expected effective user and group, they are not checked if 0
+	UID int `json:"uid,omitempty"`
+	GID int `json:"gid,omitempty"`
 }
 
 // TorrentConfig defines the config of torrent
@@ -86,6 +270,742 @@ type TorrentConfig struct {
 	DownloadLimit int64 `json:"downloadLimit"`
 	// Announce defines the announce address for torrent
 	Announce string `json:"announce"`
+	// GenerateWorkers the number of workers to generate torrents asynchronously
+	GenerateWorkers int `json:"generateWorkers"`
+	// GenerateQueueSize the max number of layers waiting for torrent generation, the layers exceed
+	// the size are transferred with tcp directly
+	GenerateQueueSize int `json:"generateQueueSize"`
+	// MinSeeders the layers cached by fewer nodes are transferred with tcp directly, because the torrent
+	// is not faster than tcp with few seeders
+	MinSeeders int `json:"minSeeders"`
+	// Hedge defines the hedged download of large layers
+	Hedge TorrentHedgeConfig `json:"hedge"`
+}
+
+// BandwidthConfig defines the bandwidth limits which are applied by schedule
+type BandwidthConfig struct {
+	// OriginLimit download speed limit(MB/s) from the original registries. 0 means no limit.
+	OriginLimit int64 `json:"originLimit"`
+	// Schedules the bandwidth profiles of time windows, the first matched schedule overrides the limits
+	// of TorrentConfig and OriginLimit. The limits of config are applied out of the windows.
+	Schedules []*BandwidthSchedule `json:"schedules,omitempty"`
+}
+
+// BandwidthSchedule defines the bandwidth limits(MB/s) in the time window, 0 means no limit. The window
+// starts at the times of Cron expression and lasts for Duration, e.g. cron '0 9 * * 1-5' with duration
+// '9h' is the business hours of weekdays.
+type BandwidthSchedule struct {
+	Name          string `json:"name"`
+	Cron          string `json:"cron"`
+	Duration      string `json:"duration"`
+	UploadLimit   int64  `json:"uploadLimit"`
+	DownloadLimit int64  `json:"downloadLimit"`
+	OriginLimit   int64  `json:"originLimit"`
+}
+
+// Contains returns whether the time is in the window of schedule
+func (s *BandwidthSchedule) Contains(now time.Time) bool {
+	schedule, err := cronParser.Parse(s.Cron)
+	if err != nil {
+		return false
+	}
+	duration, err := time.ParseDuration(s.Duration)
+	if err != nil {
+		return false
+	}
+	return !schedule.Next(now.Add(-duration)).After(now)
+}
+
+// ActiveSchedule returns the first schedule whose window contains the time, returns nil if not found
+func (c *BandwidthConfig) ActiveSchedule(now time.Time) *BandwidthSchedule {
+	for _, s := range c.Schedules {
+		if s != nil && s.Contains(now) {
+			return s
+		}
+	}
+	return nil
+}
+
+// TorrentHedgeConfig defines the hedged download of large layers. The layer is downloaded with torrent
+// first, and a parallel tcp transfer is started if the torrent progress is not sufficient after Delay.
+// The first completed wins and the loser is canceled, it cuts the latency of slow swarm bootstrap. The
+// hedged layers are not streamed to client while downloading.
+type TorrentHedgeConfig struct {
+	Enable bool `json:"enable"`
+	// Threshold only the layers larger than the threshold(MB) are hedged
+	Threshold int64 `json:"threshold"`
+	// Delay the seconds waiting for torrent before check the progress
+	Delay int64 `json:"delay"`
+	// MinProgress the percent of torrent progress after Delay, the tcp transfer is started if less than it
+	MinProgress int64 `json:"minProgress"`
+}
+
+// ObjectStorageConfig defines the config of S3-compatible object storage. The layers are stored in the
+// bucket keyed by digest, master will check the bucket before download layer from original registry.
+type ObjectStorageConfig struct {
+	Enable    bool   `json:"enable"`
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+	// UseSSL whether to access the endpoint with https
+	UseSSL bool `json:"useSSL"`
+	// Upload whether to upload the layers downloaded from original registry into the bucket
+	Upload bool `json:"upload"`
+}
+
+// ClientIdentifyType defines how to identify the client
+type ClientIdentifyType string
+
+const (
+	// ClientIdentifyIP identifies the client by source IP
+	ClientIdentifyIP ClientIdentifyType = "ip"
+	// ClientIdentifyCert identifies the client by the CN of mTLS client cert, falls back to source IP
+	// if the client not present the cert
+	ClientIdentifyCert ClientIdentifyType = "cert"
+)
+
+// TransferConfig defines the config of node-to-node layer transfer with tcp
+type TransferConfig struct {
+	// MaxResumeAttempts the max attempts to resume the broken transfer with Range requests, the partial
+	// file is kept and the remainder is requested from the peer. The attempts are backed off exponentially
+	// from 500ms up to 10s with jitter.
+	MaxResumeAttempts int `json:"maxResumeAttempts"`
+	// Compression re-compresses the layers which are not compressed (e.g. uncompressed tar) on the fly
+	// between nodes, it saves the traffic of cross-DC links with cpu cost. Empty or "zstd".
+	Compression string `json:"compression"`
+	// Watchdog aborts the stalled transfers from origin and peers
+	Watchdog TransferWatchdogConfig `json:"watchdog"`
+	// MultiSource downloads the layers cached on several nodes from them in parallel
+	MultiSource TransferMultiSourceConfig `json:"multiSource"`
+}
+
+// TransferMultiSourceConfig defines the download of layers from multiple nodes. The layers between
+// MinSize(MB) and MaxSize(MB) cached on more than one node are split into ChunkSize(MB) chunks, and the
+// chunks are fetched from at most MaxSources nodes in parallel with tcp range requests. It is a simpler
+// alternative to torrent for mid-size layers on fast networks.
+type TransferMultiSourceConfig struct {
+	Enable     bool  `json:"enable"`
+	MinSize    int64 `json:"minSize"`
+	MaxSize    int64 `json:"maxSize"`
+	ChunkSize  int64 `json:"chunkSize"`
+	MaxSources int   `json:"maxSources"`
+}
+
+// TransferWatchdogConfig defines the watchdog of layer transfers(origin, peer tcp and torrent). The transfer
+// is aborted if it progressed less than MinThroughput(KB per minute) within StallWindow(seconds), and is
+// retried with the alternate method.
+type TransferWatchdogConfig struct {
+	Enable        bool  `json:"enable"`
+	MinThroughput int64 `json:"minThroughput"`
+	StallWindow   int64 `json:"stallWindow"`
+}
+
+// TransferCompressionZstd re-compresses the transferred layers with zstd
+const TransferCompressionZstd = "zstd"
+
+// LocalServeConfig defines the limit of serving the local layers to clients(docker/containerd), the requests
+// exceeded MaxConcurrency wait for the free slot, and are responded 503 with Retry-After if they waited for
+// MaxWait seconds.
+type LocalServeConfig struct {
+	MaxConcurrency int   `json:"maxConcurrency"`
+	MaxWait        int64 `json:"maxWait"`
+	// IO defines the I/O strategy of reading the local layers
+	IO LocalServeIOConfig `json:"io"`
+}
+
+// LocalServeIOConfig defines how the local layers are read. Mode is one of "direct"(O_DIRECT, default),
+// "buffered"(pread through page cache) or "sendfile". The direct mode keeps the page cache from being
+// thrashed by the layers streamed simultaneously, the others suit the nodes serving the same layers to
+// many pods. BufferSize(KB) is the read buffer of direct and buffered modes. Fadvise advises SEQUENTIAL
+// before reading and drops the page cache of layer after its last reader done.
+type LocalServeIOConfig struct {
+	Mode       string `json:"mode"`
+	BufferSize int    `json:"bufferSize"`
+	Fadvise    bool   `json:"fadvise"`
+}
+
+// BlobUploadConfig defines the proxying of chunked blob uploads(/v2/<repo>/blobs/uploads/<uuid>). The requests
+// of an upload session are streamed to the same upstream address resolved when the session started, because
+// the registries behind load balancers keep the session state on one instance. The Location headers of
+// responses are rewritten to the proxy host. The session is forgotten if idle for SessionTimeout seconds.
+type BlobUploadConfig struct {
+	Enable         bool  `json:"enable"`
+	SessionTimeout int64 `json:"sessionTimeout"`
+}
+
+// BlobMemoryCacheConfig defines the LRU cache of small blobs(e.g. config blobs) in memory, the blobs not larger
+// than MaxBlobSize(KB) are kept after served from local, until the total size exceeds MaxSize(MB). The blobs
+// are checked in memory before the local storage, which cuts the disk reads of the same tiny blobs pulled
+// thousands of times in the rollouts.
+type BlobMemoryCacheConfig struct {
+	Enable      bool  `json:"enable"`
+	MaxSize     int64 `json:"maxSize"`
+	MaxBlobSize int64 `json:"maxBlobSize"`
+}
+
+// ServerConfig defines the connection settings of the HTTP and HTTPS listeners, the timeouts are in seconds.
+// The write timeout is not provided because the blob streams last as long as the layers are transferred.
+type ServerConfig struct {
+	// ReadHeaderTimeout the timeout of reading request headers, it closes the slowloris connections
+	ReadHeaderTimeout int64 `json:"readHeaderTimeout"`
+	// ReadTimeout the timeout of reading the whole request, 0 means no timeout because of the blob uploads
+	ReadTimeout int64 `json:"readTimeout"`
+	// IdleTimeout the timeout of keep-alive connections waiting for the next request
+	IdleTimeout int64 `json:"idleTimeout"`
+	// MaxConns the max connections accepted by each listener, 0 means no limit
+	MaxConns int `json:"maxConns"`
+	// DisableHTTP2 disables the h2 of HTTPS listener, the blob streams of a client are multiplexed on one
+	// connection with h2
+	DisableHTTP2 bool `json:"disableHTTP2"`
+	// EnableH2C enables the h2 without TLS(h2c) of HTTP listener, it is the internal port of nodes and
+	// containerd mirrors
+	EnableH2C bool `json:"enableH2C"`
+	// MaxConcurrentStreams the max concurrent streams of each h2 connection
+	MaxConcurrentStreams int `json:"maxConcurrentStreams"`
+}
+
+// APIValidationConfig defines the limits of custom api requests between nodes, the fields of requests are
+// always validated and the headers of client connection are not replayed to original registry.
+type APIValidationConfig struct {
+	// MaxBodySize the max body size(KB) of custom api requests, the layer import is not limited
+	MaxBodySize int64 `json:"maxBodySize"`
+	// MaxHeaderSize the max header size(KB) of http requests
+	MaxHeaderSize int64 `json:"maxHeaderSize"`
+	// MappedHostsOnly rejects the original hosts not in registry mappings, e.g. the registries proxied by
+	// containerd mirror without mapping
+	MappedHostsOnly bool `json:"mappedHostsOnly"`
+}
+
+// DownloadCancelConfig defines the cancellation of layer downloads from original registry. The downloads
+// are detached from the requests, they are canceled when all the pulling clients are disconnected if
+// enabled, unless the progress reached CompleteThreshold percent so the layer is still cached for the
+// next pulls.
+type DownloadCancelConfig struct {
+	Enable            bool  `json:"enable"`
+	CompleteThreshold int64 `json:"completeThreshold"`
+}
+
+// IntegrityVerifyConfig defines the background verifier of the layers in transfer and small-file paths.
+// LayersPerHour layers are re-hashed every hour, the least recently verified first, and the reading is
+// limited by BandwidthLimit(MB/s) so it does not compete with serving. The mismatched layers are
+// quarantined: deleted and removed from cache store.
+type IntegrityVerifyConfig struct {
+	Enable         bool  `json:"enable"`
+	LayersPerHour  int64 `json:"layersPerHour"`
+	BandwidthLimit int64 `json:"bandwidthLimit"`
+}
+
+// ImageIndexConfig defines the index of the repos and tags pulled through the proxy, they are recorded into
+// cache store with the first and last seen time when the manifests are served. The images not seen within
+// Retention(days) are removed from the index.
+type ImageIndexConfig struct {
+	Enable    bool  `json:"enable"`
+	Retention int64 `json:"retention"`
+}
+
+// ExemplarsConfig defines the exemplars of the registry request latency, the request id(and trace id if it
+// is a W3C trace-id) of the observation exceeds SlowThreshold(milliseconds) is attached, so the latency
+// spike can be linked to the recorder events and trace. They are exposed with the OpenMetrics format.
+type ExemplarsConfig struct {
+	Enable        bool  `json:"enable"`
+	SlowThreshold int64 `json:"slowThreshold"`
+}
+
+// RecorderConfig defines the recorder of events. BufferSize is the number of events kept in memory,
+// MaxSizeMB(megabytes) and MaxBackups define the rotation of StorageConfig.EventFile, the rotated files older
+// than RetentionDays are removed(0 means not removed by age).
+type RecorderConfig struct {
+	BufferSize    int `json:"bufferSize"`
+	MaxSizeMB     int `json:"maxSizeMB"`
+	MaxBackups    int `json:"maxBackups"`
+	RetentionDays int `json:"retentionDays"`
+}
+
+// ResponseLimitConfig defines the limits of the response bodies read into memory by the http requests of
+// metadata APIs(e.g. token, manifest, the custom APIs between nodes). The responses larger than
+// MaxBodySize(MB) are refused instead of buffered, the blobs must be streamed. The error bodies are
+// truncated to MaxErrorBodySize(KB).
+type ResponseLimitConfig struct {
+	MaxBodySize      int64 `json:"maxBodySize"`
+	MaxErrorBodySize int64 `json:"maxErrorBodySize"`
+}
+
+// SchedulerExtenderConfig defines the layer availability API which reports the percentage of image bytes
+// cached on each node, and the prioritize webhook of kube-scheduler extender which prefers the nodes holding
+// the layers of pod images. Platform(e.g. linux/amd64) selects the manifest of image index, the platform of
+// accelerboat is used by default. The availability of image is cached for CacheTTL seconds.
+type SchedulerExtenderConfig struct {
+	Enable   bool   `json:"enable"`
+	Platform string `json:"platform,omitempty"`
+	CacheTTL int64  `json:"cacheTTL"`
+}
+
+// KubeletCredentialConfig defines the registry credentials served to the kubelet image credential provider
+// (cmd/credential-provider) on the same node, only the loopback clients are served. The credentials of the
+// registry mapping are returned for its proxy host and original host, the kubelet caches them for
+// CacheDuration seconds.
+type KubeletCredentialConfig struct {
+	Enable        bool  `json:"enable"`
+	CacheDuration int64 `json:"cacheDuration"`
+}
+
+// PodIdentityConfig defines the attribution of pulls to the pods by correlating the client ip with pod ip
+// through an informer cache over pods. The namespace and pod are attached to the logs, recorder events and
+// access logs, and the response bytes are counted by them.
+type PodIdentityConfig struct {
+	Enable bool `json:"enable"`
+}
+
+// PlacementMode defines how master assigns the layer downloads to nodes
+type PlacementMode string
+
+const (
+	// PlacementLeastTasks assigns the download to the node with the least download tasks
+	PlacementLeastTasks PlacementMode = "leastTasks"
+	// PlacementConsistentHash assigns the download to the owner nodes of the layer digest on the
+	// consistent hash ring of nodes
+	PlacementConsistentHash PlacementMode = "consistentHash"
+)
+
+// PlacementConfig defines the assignment of layer downloads to nodes. With consistentHash each digest is
+// owned by Owners nodes on the hash ring(VirtualNodes per node), the download is assigned to the owner with
+// the least tasks and the cached layers on the owners are served first, so each layer is cached on the
+// predictable nodes. The nodes after the owners in ring order are used if the owners failed or cordoned.
+type PlacementConfig struct {
+	Mode         PlacementMode `json:"mode"`
+	Owners       int           `json:"owners"`
+	VirtualNodes int           `json:"virtualNodes"`
+}
+
+// ClientRedirectConfig defines the redirect of get-blob requests to the node holding the layer. The layers
+// not smaller than MinSize(MB) and located on other nodes are responded with 307 to the blob endpoint of
+// holder signed with Secret, the signed URL expires after Expiration seconds. The client fetches from the
+// holder directly, the layer is not copied to the requesting node.
+type ClientRedirectConfig struct {
+	Enable     bool   `json:"enable"`
+	MinSize    int64  `json:"minSize"`
+	Expiration int64  `json:"expiration"`
+	Secret     string `json:"secret"`
+}
+
+// EstargzConfig defines the eStargz support of stargz-snapshotter. The cached layers not smaller than
+// MinSize(MB) in transfer path are converted to eStargz every ScanInterval seconds, compressed with
+// Compression("gzip" or "zstd" for zstd:chunked). The converted layers are cached as static layers and
+// mapped with the original digests in cache store. The range requests of layers not cached on this node
+// are served with the ranges of the node holding it, so the snapshotter lazy-pulls only the files read.
+// The manifest of tag with TagSuffix(e.g. 'nginx:1.25-esgz') is generated from the original tag, its
+// layers are replaced with the converted ones and annotated with the TOC digests(and zstd:chunked
+// manifest positions), the generated manifests and configs are served from cache store.
+type EstargzConfig struct {
+	Enable       bool   `json:"enable"`
+	Compression  string `json:"compression"`
+	MinSize      int64  `json:"minSize"`
+	ScanInterval int64  `json:"scanInterval"`
+	TagSuffix    string `json:"tagSuffix"`
+}
+
+const (
+	// EstargzCompressionGzip converts the layers to eStargz with gzip
+	EstargzCompressionGzip = "gzip"
+	// EstargzCompressionZstd converts the layers to zstd:chunked
+	EstargzCompressionZstd = "zstd"
+)
+
+// SavingsConfig defines the accounting of the blob bytes downloaded from original registries and served to
+// clients per registry per day, they are flushed into cache store every minute and kept for Retention days.
+// The egress cost avoided is estimated with CostPerGB(per GiB) in the savings report.
+type SavingsConfig struct {
+	Enable    bool    `json:"enable"`
+	CostPerGB float64 `json:"costPerGB"`
+	Retention int64   `json:"retention"`
+}
+
+// AutoscalingConfig defines the load signals of nodes for autoscaling the replicas of registry-mirror
+// Deployment: queued downloads, bandwidth saturation(served throughput of the last minute divided by
+// NodeBandwidth MB/s) and p95 latency of blob responses within LatencyWindow seconds. The signals are
+// reported with /customapi/scaling-signals for KEDA metrics-api scaler, and served as the external metrics
+// of HPA if ExternalMetrics enabled.
+type AutoscalingConfig struct {
+	Enable          bool  `json:"enable"`
+	NodeBandwidth   int64 `json:"nodeBandwidth"`
+	LatencyWindow   int64 `json:"latencyWindow"`
+	ExternalMetrics bool  `json:"externalMetrics"`
+}
+
+// UpstreamHealthConfig defines the prober pinging the /v2/ and token endpoints of the original hosts(and
+// replicas) of the enabled registry mappings every Interval seconds with Timeout seconds. The host failed
+// FailureThreshold consecutive probes is down, the token and manifest requests of it skip the custom path
+// and fall back directly until it is probed healthy.
+type UpstreamHealthConfig struct {
+	Enable           bool  `json:"enable"`
+	Interval         int64 `json:"interval"`
+	Timeout          int64 `json:"timeout"`
+	FailureThreshold int64 `json:"failureThreshold"`
+}
+
+// ParentConfig defines the hierarchy of clusters for the edge sites. The layer missed in cluster is
+// downloaded from the parent accelerboat at Endpoint(e.g. http://10.0.0.1:2080) before the original
+// registry, the parent fetches it through its own cluster, parent or origin. The registries of child must
+// be configured on parent too. ChildToken enables serving the child clusters, the requests of them must
+// carry it as Token.
+type ParentConfig struct {
+	Enable   bool   `json:"enable"`
+	Endpoint string `json:"endpoint"`
+	Token    string `json:"token"`
+	// ChildToken the token required from the child clusters, serving them is disabled if empty
+	ChildToken string `json:"childToken,omitempty"`
+}
+
+// InternalGRPCConfig defines the gRPC internal API between nodes on Port, it is served with the peer tls
+// if enabled. The nodes request master and the other nodes with gRPC, and fall back to the HTTP endpoints
+// if the target not serves gRPC (e.g. during rolling upgrade).
+type InternalGRPCConfig struct {
+	Enable bool  `json:"enable"`
+	Port   int64 `json:"port"`
+}
+
+// UpstreamErrorMode defines how to handle the failure status of original registry got by master
+type UpstreamErrorMode string
+
+const (
+	// UpstreamErrorPropagate responds the status code and WWW-Authenticate header of original registry to
+	// client directly, e.g. docker/containerd re-authenticates with the 401 challenge
+	UpstreamErrorPropagate UpstreamErrorMode = "propagate"
+	// UpstreamErrorFallback reverses the request to original registry
+	UpstreamErrorFallback UpstreamErrorMode = "fallback"
+)
+
+// UpstreamErrorConfig defines the handling of the failure status got by master from original registry
+// per status class. Default propagates the authentication failures(401/403) and falls back the others.
+type UpstreamErrorConfig struct {
+	// Auth the mode of 401 and 403
+	Auth UpstreamErrorMode `json:"auth"`
+	// ClientError the mode of other 4xx
+	ClientError UpstreamErrorMode `json:"clientError"`
+	// ServerError the mode of 5xx
+	ServerError UpstreamErrorMode `json:"serverError"`
+}
+
+// ShouldFallback returns whether the request should be reversed to original registry with the failure
+// status code
+func (c *UpstreamErrorConfig) ShouldFallback(statusCode int) bool {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return c.Auth == UpstreamErrorFallback
+	case statusCode >= 400 && statusCode < 500:
+		return c.ClientError == UpstreamErrorFallback
+	case statusCode >= 500:
+		return c.ServerError == UpstreamErrorFallback
+	}
+	return true
+}
+
+// FallbackMode defines whether the failed request of token/manifest/blob falls back to reverse proxy
+type FallbackMode string
+
+const (
+	// FallbackAlways reverses every failed request to original registry
+	FallbackAlways FallbackMode = "always"
+	// FallbackNever responds 502 to client for the failed request
+	FallbackNever FallbackMode = "never"
+	// FallbackBudgeted reverses at most Budget failed requests per minute per registry, the others are
+	// responded 502, so the upstream traffic is not doubled during incidents
+	FallbackBudgeted FallbackMode = "budgeted"
+)
+
+// FallbackRule defines the fallback mode of one category
+type FallbackRule struct {
+	Mode FallbackMode `json:"mode"`
+	// Budget the max fallbacks per minute per registry of budgeted mode
+	Budget int `json:"budget"`
+}
+
+// FallbackConfig defines the fallback policy of the failed requests per category, default always falls
+// back to reverse proxy
+type FallbackConfig struct {
+	Token    FallbackRule `json:"token"`
+	Manifest FallbackRule `json:"manifest"`
+	Blob     FallbackRule `json:"blob"`
+}
+
+// Fallback categories
+const (
+	FallbackCategoryToken    = "token"
+	FallbackCategoryManifest = "manifest"
+	FallbackCategoryBlob     = "blob"
+)
+
+// RuleOf returns the fallback rule of category
+func (c *FallbackConfig) RuleOf(category string) FallbackRule {
+	switch category {
+	case FallbackCategoryToken:
+		return c.Token
+	case FallbackCategoryManifest:
+		return c.Manifest
+	case FallbackCategoryBlob:
+		return c.Blob
+	}
+	return FallbackRule{Mode: FallbackAlways}
+}
+
+// PeerTLSConfig defines the mutual-TLS channel of node-to-node layer transfer, the layers are transferred
+// with https on Port instead of plain http on HTTPPort. Every node identifies itself by the cert with its
+// IP in SANs, the cert is issued by the cluster CA at startup if CAKeyFile is given (self-managed CA), or
+// loaded from CertFile/KeyFile (e.g. projected by cert-manager).
+type PeerTLSConfig struct {
+	Enable    bool   `json:"enable"`
+	Port      int64  `json:"port"`
+	CAFile    string `json:"caFile"`
+	CAKeyFile string `json:"caKeyFile,omitempty"`
+	CertFile  string `json:"certFile,omitempty"`
+	KeyFile   string `json:"keyFile,omitempty"`
+}
+
+// ClientVerifyMode defines when the client certs are verified
+type ClientVerifyMode string
+
+const (
+	// ClientVerifyRequire rejects the TLS handshake of clients without valid cert, except the server name
+	// is the proxy host of exempted registry mapping
+	ClientVerifyRequire ClientVerifyMode = "require"
+	// ClientVerifyIfGiven accepts the TLS handshake without cert, and rejects the requests of not
+	// exempted registry mappings with 403
+	ClientVerifyIfGiven ClientVerifyMode = "verifyIfGiven"
+)
+
+// ClientVerifyConfig defines the mutual-TLS verification of clients, so that only the trusted clients
+// (e.g. the cluster nodes) can use the proxy
+type ClientVerifyConfig struct {
+	Enable bool `json:"enable"`
+	// ClientCA the PEM encoded CA bundle to verify the client certs
+	ClientCA string           `json:"clientCA"`
+	Mode     ClientVerifyMode `json:"mode"`
+	// AllowedCNs the allowed CNs of client certs, empty means all certs signed by ClientCA are allowed
+	AllowedCNs []string `json:"allowedCNs,omitempty"`
+}
+
+// HostValidationConfig defines the validation of the Host header of DomainProxy requests on both ports.
+// The proxy host is derived from the Host header, so the request is rejected if the Host header is not the
+// proxy host of registry mapping, and on the HTTPS port not the TLS server name(SNI), or not covered by the
+// served cert when the client not sent SNI. It protects the
+// cache and credentials of one mapping from being used through the connection of another mapping.
+type HostValidationConfig struct {
+	Enable bool `json:"enable"`
+}
+
+// IsCNAllowed returns whether the client cert with the CN is allowed
+func (c *ClientVerifyConfig) IsCNAllowed(cn string) bool {
+	if len(c.AllowedCNs) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedCNs {
+		if allowed == cn {
+			return true
+		}
+	}
+	return false
+}
+
+// ArtifactConfig defines the config of non-image OCI artifacts
+type ArtifactConfig struct {
+	// BypassThreshold the blobs of artifacts smaller than the threshold(MB) are reversed to the original
+	// registry directly instead of the torrent/peer distribution. 0 means not bypass.
+	BypassThreshold int64 `json:"bypassThreshold"`
+}
+
+// TokenCacheConfig defines the service token cache in cache store, the tokens are encrypted with
+// AES-GCM by the key derived from EncryptionKey. The tokens survive the restart of master and are shared
+// by the masters after failover.
+type TokenCacheConfig struct {
+	Enable        bool   `json:"enable"`
+	EncryptionKey string `json:"encryptionKey"`
+}
+
+// TokenRefreshConfig defines the background refresh of service tokens. The scope requested at least
+// HotThreshold times within HotWindow(seconds) is hot, its token is refreshed RefreshBefore(seconds)
+// before expiry so the requests during rollouts always hit the warm cache.
+type TokenRefreshConfig struct {
+	Enable        bool  `json:"enable"`
+	HotThreshold  int   `json:"hotThreshold"`
+	HotWindow     int64 `json:"hotWindow"`
+	RefreshBefore int64 `json:"refreshBefore"`
+}
+
+// OCIReportConfig defines the report of containerd layers. Only the added and removed layers are reported
+// every Interval(seconds), all the layers are reported every FullInterval(seconds) to keep them alive, the
+// reported layers expire after twice the FullInterval.
+type OCIReportConfig struct {
+	Interval     int64 `json:"interval"`
+	FullInterval int64 `json:"fullInterval"`
+}
+
+// OCISeedConfig defines the startup task that exports the containerd layers into OCIPath, so a new node
+// with pre-pulled images contributes to the cluster before any peer requests them. The layers referenced
+// by more images are exported first and then the larger ones, at most MaxLayers are exported. The torrents
+// are generated for the layers exceed the torrent threshold and seeded immediately.
+type OCISeedConfig struct {
+	Enable    bool `json:"enable"`
+	MaxLayers int  `json:"maxLayers"`
+}
+
+// LayerQueryCacheConfig defines the short-lived cache of layer locations, the concurrent queries of the
+// same layer are coalesced into one redis request. TTL is in milliseconds.
+type LayerQueryCacheConfig struct {
+	Enable bool  `json:"enable"`
+	TTL    int64 `json:"ttl"`
+}
+
+// FederationConfig defines the federation of clusters. The masters publish the layers of their clusters
+// into the shared redis, and the master fetches the layer from other clusters through the gateway nodes
+// before downloading from original registry. Intervals are in seconds, BandwidthLimit is in MB/s.
+type FederationConfig struct {
+	Enable bool `json:"enable"`
+	// ClusterName the unique name of cluster in federation
+	ClusterName string `json:"clusterName"`
+	// RedisAddress the redis shared by the clusters of federation
+	RedisAddress  string `json:"redisAddress"`
+	RedisPassword string `json:"redisPassword,omitempty"`
+	// Token the shared token to authorize the layer requests between clusters
+	Token string `json:"token"`
+	// GatewayNode the node IP of gateway which fetches and serves the layers across clusters, the master
+	// is the gateway if empty
+	GatewayNode string `json:"gatewayNode,omitempty"`
+	// GatewayEndpoint the endpoint of gateway reachable by other clusters, e.g. http://10.0.0.1:2080
+	GatewayEndpoint string `json:"gatewayEndpoint"`
+	// PublishInterval the interval of publishing the layers of cluster
+	PublishInterval int64 `json:"publishInterval"`
+	// BandwidthLimit the max speed of layers served to every other cluster, 0 means no limit
+	BandwidthLimit int64 `json:"bandwidthLimit"`
+}
+
+// PreheatConfig defines the preheat controller on master. It watches the ConfigMaps with LabelSelector in
+// Namespace, every ConfigMap is a preheat task listing the images and the optional cron schedule, the images
+// are pulled through the local proxy so the layers are cached in cluster. The status of task is recorded in
+// the annotation of ConfigMap. SyncInterval is in seconds.
+type PreheatConfig struct {
+	Enable bool `json:"enable"`
+	// Namespace the namespace of task ConfigMaps, default is the namespace of service
+	Namespace     string `json:"namespace"`
+	LabelSelector string `json:"labelSelector"`
+	SyncInterval  int64  `json:"syncInterval"`
+	// HistoryLimit the max runs kept in the history
+	HistoryLimit int `json:"historyLimit"`
+	// Webhook receives the push notifications of registry to preheat the pushed images
+	Webhook PreheatWebhookConfig `json:"webhook"`
+}
+
+// PreheatWebhookConfig defines the receiver of registry push notifications (Harbor and registry:2). The
+// notification is validated with the HMAC-SHA256 of body signed by Secret, or the static bearer Token in the
+// Authorization header which the stock senders can set. The pushed images matched Repositories (path
+// patterns of registry/repository, e.g. registry.example.com/app/*) are preheated with Platforms (comma
+// separated, the platform of node if empty).
+type PreheatWebhookConfig struct {
+	Enable bool   `json:"enable"`
+	Secret string `json:"secret"`
+	// Token the static token accepted with header 'Authorization: Bearer <token>'
+	Token        string   `json:"token"`
+	Repositories []string `json:"repositories"`
+	Platforms    string   `json:"platforms"`
+}
+
+// MatchRepository returns whether the repository (registry/repository) is configured to preheat
+func (c *PreheatWebhookConfig) MatchRepository(repository string) bool {
+	for _, pattern := range c.Repositories {
+		if ok, _ := path.Match(pattern, repository); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientQuotaConfig defines the client identification and quotas
+type ClientQuotaConfig struct {
+	Enable     bool               `json:"enable"`
+	IdentifyBy ClientIdentifyType `json:"identifyBy"`
+	// ClientCA the PEM encoded CA to verify the client certs, required for cert identification
+	ClientCA string `json:"clientCA,omitempty"`
+	// DefaultQuota the quota of clients not in Clients
+	DefaultQuota ClientQuota `json:"defaultQuota"`
+	// Clients the quotas of specified clients, keyed by the client IP or cert CN
+	Clients map[string]*ClientQuota `json:"clients,omitempty"`
+}
+
+// ClientQuota defines the quota of one client, zero means unlimited
+type ClientQuota struct {
+	// MaxConcurrency the max concurrent requests of client, the exceeded requests wait in queue
+	MaxConcurrency int `json:"maxConcurrency"`
+	// BandwidthLimit the max response bandwidth of client (unit: MB/s)
+	BandwidthLimit int64 `json:"bandwidthLimit"`
+}
+
+// QuotaOf returns the quota of client
+func (c *ClientQuotaConfig) QuotaOf(clientID string) ClientQuota {
+	if q, ok := c.Clients[clientID]; ok && q != nil {
+		return *q
+	}
+	return c.DefaultQuota
+}
+
+// AccessLogOutput defines the output of access log
+type AccessLogOutput string
+
+const (
+	// AccessLogFile writes the access log into rotating file
+	AccessLogFile AccessLogOutput = "file"
+	// AccessLogStdout writes the access log into stdout
+	AccessLogStdout AccessLogOutput = "stdout"
+)
+
+// AccessLogConfig defines the access log config, the entries are written as JSON lines
+type AccessLogConfig struct {
+	Enable bool            `json:"enable"`
+	Output AccessLogOutput `json:"output"`
+	// File the access log file for file output, default is 'access.log' under log dir. It is rotated
+	// with the log config.
+	File string `json:"file,omitempty"`
+	// PingSampleRate the sample rate (0~1) of '/v2/' ping requests, 0 means not log the pings
+	PingSampleRate float64 `json:"pingSampleRate"`
+}
+
+// LayerScanType defines the type of layer scan hook
+type LayerScanType string
+
+const (
+	// LayerScanExec executes the command with env LAYER_DIGEST/LAYER_PATH/LAYER_REGISTRY/LAYER_REPO,
+	// the layer is passed if the command exit with code 0
+	LayerScanExec LayerScanType = "exec"
+	// LayerScanHTTP posts the layer info to scanner server, the server should respond with the verdict
+	LayerScanHTTP LayerScanType = "http"
+)
+
+// LayerScanAction defines the handling of failed verdict
+type LayerScanAction string
+
+const (
+	// LayerScanBlock removes the layer and rejects the blob request
+	LayerScanBlock LayerScanAction = "block"
+	// LayerScanWarn only records the warning and keeps the layer
+	LayerScanWarn LayerScanAction = "warn"
+)
+
+// LayerScanConfig defines the config of layer scan hook, the hook is invoked after layer downloaded and
+// before it is moved into the transfer/small-file path.
+type LayerScanConfig struct {
+	Enable bool          `json:"enable"`
+	Type   LayerScanType `json:"type"`
+	// Command the command and args for exec hook
+	Command []string `json:"command,omitempty"`
+	// URL the scanner server for http hook, request body is {"digest","path","registry","repo"} and
+	// response body is {"passed","message"}
+	URL string `json:"url,omitempty"`
+	// Timeout the timeout seconds of each scan
+	Timeout int64           `json:"timeout"`
+	Action  LayerScanAction `json:"action"`
+	// FailOpen whether to keep the layer if the hook failed (not a failed verdict)
+	FailOpen bool `json:"failOpen"`
 }
 
 // ProxyKeyCert defines the key/cert for proxy host
@@ -103,19 +1023,267 @@ type RegistryAuth struct {
 // RegistryMapping defines the mapping for original registry with proxy. There also defines the
 // username/password for registry when use RegistryMirror mode.
 type RegistryMapping struct {
-	Enable       bool   `json:"enable"`
-	ProxyHost    string `json:"proxyHost"`
-	ProxyCert    string `json:"proxyCert"`
-	ProxyKey     string `json:"proxyKey"`
+	Enable    bool   `json:"enable"`
+	ProxyHost string `json:"proxyHost"`
+	ProxyCert string `json:"proxyCert"`
+	ProxyKey  string `json:"proxyKey"`
+	// OriginalHost the host of original registry, it can have a path prefix if the registry is served
+	// under a gateway, e.g. gateway.example.com/harbor. The RegistryMirror requests of the images
+	// 'gateway.example.com/harbor/<repo>' are matched by the host and prefix.
 	OriginalHost string `json:"originalHost"`
+	// Replicas the hosts serving the same content as original host, they are failed over to in order when
+	// the original host is unhealthy. The original host is still the identity of the mapping.
+	Replicas []string `json:"replicas,omitempty"`
+	// Type defines the backend of the mapping, empty means the original registry. "ocilayout" serves
+	// the images from the OCI layout directory in Path without any original registry.
+	Type RegistryType `json:"type,omitempty"`
+	Path string       `json:"path,omitempty"`
+	// SignatureVerification defines the cosign signature verification of the proxied images
+	SignatureVerification *SignatureVerification `json:"signatureVerification,omitempty"`
+	// AuthHost the host of token service if it is not the original host (e.g. auth.docker.io for
+	// registry-1.docker.io), the token requests to the realm on it are proxied through master
+	AuthHost string `json:"authHost,omitempty"`
+	// AuthRewrites the rules to rewrite the original realm before requesting the token service
+	AuthRewrites []*AuthRewrite `json:"authRewrites,omitempty"`
+	// AuthRealmAddr the scheme and host(with port) the realm of WWW-Authenticate is rewritten to, e.g.
+	// http://10.0.0.1:2080. The address client requested is used by default.
+	AuthRealmAddr string `json:"authRealmAddr,omitempty"`
+	// SkipClientVerify exempts the mapping from the client verification of HTTPS port
+	SkipClientVerify bool `json:"skipClientVerify,omitempty"`
+	// AllowedClientCIDRs the client networks allowed to use the mapping, empty means all clients are allowed
+	AllowedClientCIDRs []string `json:"allowedClientCIDRs,omitempty"`
+	// BlobRedirect defines how the redirects of blob responses are handled when the blob request is
+	// reversed to original registry, the clients bypass the proxy with the redirects by default
+	BlobRedirect BlobRedirectMode `json:"blobRedirect,omitempty"`
+	// HTTPProxy the proxy of the requests to original host and auth host of the mapping, it overrides the
+	// global httpProxy. NoProxy requests them directly even if the global httpProxy is set.
+	HTTPProxy    string   `json:"httpProxy,omitempty"`
+	HTTPProxyUrl *url.URL `json:"-"`
+	NoProxy      bool     `json:"noProxy,omitempty"`
+	// Shadow mirrors the manifest requests to a secondary registry and compares the responses, it is used
+	// to validate the migration of original registry
+	Shadow *ShadowConfig `json:"shadow,omitempty"`
+	// AccountRotation requests the service tokens with the users of mapping in rotation by their remaining
+	// pull quota, e.g. the accounts of Docker Hub
+	AccountRotation *AccountRotation `json:"accountRotation,omitempty"`
+	// HeaderPolicy defines the client headers forwarded to original registry, all the headers are forwarded
+	// by default
+	HeaderPolicy *HeaderPolicy `json:"headerPolicy,omitempty"`
 
 	Username string          `json:"username"`
 	Password string          `json:"password"`
 	Users    []*RegistryAuth `json:"users,omitempty"`
+	// CredentialProvider mints the upstream credentials of cloud registry instead of static username/password
+	CredentialProvider *CredentialProvider `json:"credentialProvider,omitempty"`
 	// temporary store the legal auths
 	LegalUsers []*RegistryAuth `json:"-"`
 }
 
+// AccountRotation defines the rotation of the Users of mapping by the remaining quota of RateLimit headers
+// (ratelimit-remaining) in the manifest responses. The service tokens are requested with the account having
+// the most remaining quota instead of anonymously, the accounts not above MinRemaining are used only when all
+// accounts are exhausted. The account responded 429 is exhausted until the rate limit window passed.
+type AccountRotation struct {
+	Enable       bool  `json:"enable"`
+	MinRemaining int64 `json:"minRemaining"`
+}
+
+// HeaderPolicy defines the client headers forwarded to original registry, it is applied to the requests of
+// proxy before reversed or sent to master, so the manifest, token and blob requests are the same. Only the
+// headers in Allow are forwarded if it is not empty, and the headers in Deny are dropped. Authorization,
+// Accept, Range, Content-Type and Content-Range are always forwarded. The headers in Inject are set on every
+// request, and UserAgent overrides the User-Agent of clients, '{version}' in it is replaced with the version
+// of accelerboat.
+type HeaderPolicy struct {
+	Allow     []string          `json:"allow,omitempty"`
+	Deny      []string          `json:"deny,omitempty"`
+	Inject    map[string]string `json:"inject,omitempty"`
+	UserAgent string            `json:"userAgent,omitempty"`
+}
+
+// ShadowConfig defines the secondary registry which the manifest and HEAD requests are mirrored to, the
+// status codes and digests are compared with the original registry and the divergences are reported. The
+// responses of shadow registry never affect clients. The shadow is requested with basic auth of
+// Username/Password if set.
+type ShadowConfig struct {
+	Enable       bool   `json:"enable"`
+	OriginalHost string `json:"originalHost"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+}
+
+// AuthRewrite rewrites the realm which has the prefix From with To
+type AuthRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RewriteRealm returns the realm after the first matched rewrite rule applied
+func (mp *RegistryMapping) RewriteRealm(realm string) string {
+	for _, rw := range mp.AuthRewrites {
+		if rw != nil && rw.From != "" && strings.HasPrefix(realm, rw.From) {
+			return rw.To + strings.TrimPrefix(realm, rw.From)
+		}
+	}
+	return realm
+}
+
+// IsAuthHostAllowed returns whether the token service host is allowed for the mapping
+func (mp *RegistryMapping) IsAuthHostAllowed(host string) bool {
+	if host == mp.OriginalHostname() || (mp.AuthHost != "" && host == mp.AuthHost) {
+		return true
+	}
+	for _, replica := range mp.Replicas {
+		if hostname, _, _ := strings.Cut(replica, "/"); host == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTokenURLAllowed returns whether the token service url is allowed for the mapping, it should be on the
+// allowed auth host or the host rewritten to
+func (mp *RegistryMapping) IsTokenURLAllowed(tokenURL *url.URL) bool {
+	if mp.IsAuthHostAllowed(tokenURL.Host) || mp.IsAuthHostAllowed(tokenURL.Hostname()) {
+		return true
+	}
+	for _, rw := range mp.AuthRewrites {
+		if rw == nil || rw.To == "" {
+			continue
+		}
+		if to, err := url.Parse(rw.To); err == nil && to.Host == tokenURL.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// IsClientAllowed returns whether the client ip is allowed to use the mapping
+func (mp *RegistryMapping) IsClientAllowed(ip net.IP) bool {
+	if len(mp.AllowedClientCIDRs) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range mp.AllowedClientCIDRs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// OriginalHosts returns the original host and replicas in priority order
+func (mp *RegistryMapping) OriginalHosts() []string {
+	return append([]string{mp.OriginalHost}, mp.Replicas...)
+}
+
+// OriginalHostname returns the original host without path prefix
+func (mp *RegistryMapping) OriginalHostname() string {
+	hostname, _, _ := strings.Cut(mp.OriginalHost, "/")
+	return hostname
+}
+
+// requiredHeaders the headers of registry protocol which the header policy cannot drop, the ranged pulls
+// and blob uploads are broken without Range, Content-Type and Content-Range
+var requiredHeaders = []string{"Authorization", "Accept", "Range", "Content-Type", "Content-Range"}
+
+// ApplyHeaderPolicy scrubs the client headers with the header policy of mapping in place
+func (mp *RegistryMapping) ApplyHeaderPolicy(header http.Header) {
+	policy := mp.HeaderPolicy
+	if policy == nil {
+		return
+	}
+	if len(policy.Allow) != 0 {
+		allowed := make(map[string]struct{}, len(policy.Allow)+len(requiredHeaders))
+		for _, name := range append(policy.Allow, requiredHeaders...) {
+			allowed[http.CanonicalHeaderKey(name)] = struct{}{}
+		}
+		for name := range header {
+			if _, ok := allowed[http.CanonicalHeaderKey(name)]; !ok {
+				delete(header, name)
+			}
+		}
+	}
+	for _, name := range policy.Deny {
+		header.Del(name)
+	}
+	for name, value := range policy.Inject {
+		header.Set(name, value)
+	}
+	if policy.UserAgent != "" {
+		header.Set("User-Agent", strings.ReplaceAll(policy.UserAgent, "{version}", version.Version))
+	}
+}
+
+// OriginalPathPrefix returns the path prefix of original host, returns empty if not have
+func (mp *RegistryMapping) OriginalPathPrefix() string {
+	if _, prefix, ok := strings.Cut(mp.OriginalHost, "/"); ok {
+		return "/" + prefix
+	}
+	return ""
+}
+
+// CredentialProviderType defines the type of credential provider
+type CredentialProviderType string
+
+const (
+	// CredentialProviderECR exchanges the AWS credentials for the ECR authorization token
+	CredentialProviderECR CredentialProviderType = "ecr"
+	// CredentialProviderGAR uses the access token of GCP service account for Artifact Registry
+	CredentialProviderGAR CredentialProviderType = "gar"
+	// CredentialProviderACR exchanges the Azure AD access token for the ACR refresh token
+	CredentialProviderACR CredentialProviderType = "acr"
+)
+
+// CredentialProvider defines the provider that mints and refreshes the upstream credentials.
+//   - ecr: AWS credentials from environment (AWS_ACCESS_KEY_ID etc.), or web identity (AWS_ROLE_ARN and
+//     AWS_WEB_IDENTITY_TOKEN_FILE) if the access key not set.
+//   - gar: the default service account of GCP metadata server (workload identity).
+//   - acr: the service principal if ClientSecret is set, otherwise the managed identity of Azure IMDS.
+type CredentialProvider struct {
+	Type CredentialProviderType `json:"type"`
+	// Region the region of ECR, parsed from original host if empty
+	Region string `json:"region,omitempty"`
+	// TenantID, ClientID and ClientSecret the Azure service principal, ClientID selects the user-assigned
+	// managed identity if ClientSecret is empty
+	TenantID     string `json:"tenantID,omitempty"`
+	ClientID     string `json:"clientID,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+// SignatureVerifyMode defines the behavior when signature verification failed
+type SignatureVerifyMode string
+
+const (
+	// SignatureVerifyEnforce rejects the manifest if signature verification failed
+	SignatureVerifyEnforce SignatureVerifyMode = "enforce"
+	// SignatureVerifyWarn only records a warning event if signature verification failed
+	SignatureVerifyWarn SignatureVerifyMode = "warn"
+)
+
+// SignatureVerification defines the cosign signature verification. The manifest is verified if any
+// signature is signed by one of the public keys or keyless identities.
+type SignatureVerification struct {
+	Enable bool                `json:"enable"`
+	Mode   SignatureVerifyMode `json:"mode"`
+	// PublicKeys the PEM encoded public keys
+	PublicKeys []string `json:"publicKeys,omitempty"`
+	// KeylessIdentities the identities of keyless signing certificates
+	KeylessIdentities []*KeylessIdentity `json:"keylessIdentities,omitempty"`
+	// KeylessRoots the PEM encoded root certificates (e.g. Fulcio root) of keyless signing certificates
+	KeylessRoots []string `json:"keylessRoots,omitempty"`
+}
+
+// KeylessIdentity defines the identity of keyless signing certificate
+type KeylessIdentity struct {
+	// Issuer the OIDC issuer, e.g. https://token.actions.githubusercontent.com
+	Issuer string `json:"issuer"`
+	// Subject the email or URI in certificate SAN
+	Subject string `json:"subject"`
+}
+
 // LocalhostCert defines localhost proxy
 const LocalhostCert = "localhost"
 
@@ -125,11 +1293,36 @@ type ExternalConfig struct {
 	HTTPProxyUrl     *url.URL                 `json:"-"`
 	BuiltInCerts     map[string]*ProxyKeyCert `json:"builtInCerts"`
 	RegistryMappings []*RegistryMapping       `json:"registryMappings"`
+	// PullSecrets the docker config secrets (namespace/name, or name in the namespace of service) whose
+	// entries are imported as the credentials of registry mappings
+	PullSecrets []string `json:"pullSecrets,omitempty"`
 }
 
+const (
+	// ServiceDiscoveryKubernetes discovers the nodes with the endpoints of kubernetes service
+	ServiceDiscoveryKubernetes = "kubernetes"
+	// ServiceDiscoveryStatic the nodes are the fixed endpoints in config
+	ServiceDiscoveryStatic = "static"
+	// ServiceDiscoveryDNS the nodes are the addresses of the DNS SRV records
+	ServiceDiscoveryDNS = "dns"
+	// ServiceDiscoveryNone runs as the single node
+	ServiceDiscoveryNone = "none"
+)
+
+// ServiceDiscovery defines how the nodes discover each other, kubernetes by default. The static, dns and
+// none types run without kubernetes(e.g. bare-metal, VM fleets and edge sites), the master is elected
+// locally from the endpoints. The peers of static and dns types are health-checked every
+// HealthCheckInterval seconds, only the ready ones are the endpoints.
 type ServiceDiscovery struct {
+	Type             string `json:"type"`
 	ServiceNamespace string `json:"serviceNamespace"`
 	ServiceName      string `json:"serviceName"`
+	// Endpoints the ips of all nodes for static type, the nodes serve on the same HTTP port
+	Endpoints []string `json:"endpoints,omitempty"`
+	// DNSName the name of SRV records for dns type, e.g. '_accelerboat._tcp.edge.example.com'. The
+	// targets are resolved to the ips of nodes, the ports of records are not used.
+	DNSName             string `json:"dnsName,omitempty"`
+	HealthCheckInterval int64  `json:"healthCheckInterval,omitempty"`
 
 	// PreferConfig with the priority configuration strategy, users can specify the Master node
 	// and designate certain nodes as preferred roles.
@@ -0,0 +1,111 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+// upstreamOverridesFile stores the enable/disable of registry mappings changed at runtime, the config file
+// is always mounted read-only so the overrides are stored separately and applied after every parsing.
+const upstreamOverridesFile = "upstream-overrides.json"
+
+var upstreamOverridesLock sync.Mutex
+
+func (o *AccelerBoatOption) upstreamOverridesPath() string {
+	return filepath.Join(o.StorageConfig.SmallFilePath, upstreamOverridesFile)
+}
+
+// loadUpstreamOverrides returns the overrides with proxyHost as key
+func (o *AccelerBoatOption) loadUpstreamOverrides() (map[string]bool, error) {
+	overrides := make(map[string]bool)
+	bs, err := os.ReadFile(o.upstreamOverridesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return overrides, nil
+		}
+		return nil, errors.Wrapf(err, "read upstream overrides '%s' failed", o.upstreamOverridesPath())
+	}
+	if err = json.Unmarshal(bs, &overrides); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal upstream overrides failed")
+	}
+	return overrides, nil
+}
+
+// applyUpstreamOverrides overrides the enable of registry mappings with the runtime changes
+func (o *AccelerBoatOption) applyUpstreamOverrides() error {
+	upstreamOverridesLock.Lock()
+	defer upstreamOverridesLock.Unlock()
+	overrides, err := o.loadUpstreamOverrides()
+	if err != nil {
+		return err
+	}
+	for _, mp := range o.ExternalConfig.RegistryMappings {
+		if enable, ok := overrides[mp.ProxyHost]; ok && enable != mp.Enable {
+			logger.Infof("registry mapping '%s' enable is overridden to '%t'", mp.ProxyHost, enable)
+			mp.Enable = enable
+		}
+	}
+	return nil
+}
+
+// SetUpstreamEnable enables or disables the registry mapping of proxyHost at runtime. The change is persisted
+// into the upstream overrides file, and takes effect immediately with the new snapshot of options because
+// the proxies look up the registry mapping with every request.
+func SetUpstreamEnable(proxyHost string, enable bool) (*RegistryMapping, error) {
+	var mapping *RegistryMapping
+	err := updateOption(func(cur *AccelerBoatOption) (*AccelerBoatOption, error) {
+		idx := slices.IndexFunc(cur.ExternalConfig.RegistryMappings, func(mp *RegistryMapping) bool {
+			return mp.ProxyHost == proxyHost
+		})
+		if idx < 0 {
+			return nil, errors.Errorf("registry mapping with proxyHost '%s' not found", proxyHost)
+		}
+		if cur.ExternalConfig.RegistryMappings[idx].Type == RegistryTypeOCILayout {
+			return nil, errors.Errorf("registry mapping '%s' is oci layout, not have upstream", proxyHost)
+		}
+		if err := cur.saveUpstreamOverride(proxyHost, enable); err != nil {
+			return nil, err
+		}
+		mpCopy := *cur.ExternalConfig.RegistryMappings[idx]
+		mpCopy.Enable = enable
+		mapping = &mpCopy
+		next := *cur
+		next.ExternalConfig.RegistryMappings = slices.Clone(cur.ExternalConfig.RegistryMappings)
+		next.ExternalConfig.RegistryMappings[idx] = mapping
+		return &next, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// saveUpstreamOverride persists the enable of registry mapping into the upstream overrides file
+func (o *AccelerBoatOption) saveUpstreamOverride(proxyHost string, enable bool) error {
+	upstreamOverridesLock.Lock()
+	defer upstreamOverridesLock.Unlock()
+	overrides, err := o.loadUpstreamOverrides()
+	if err != nil {
+		return err
+	}
+	overrides[proxyHost] = enable
+	bs, err := json.Marshal(overrides)
+	if err != nil {
+		return errors.Wrapf(err, "marshal upstream overrides failed")
+	}
+	if err = os.WriteFile(o.upstreamOverridesPath(), bs, 0600); err != nil {
+		return errors.Wrapf(err, "write upstream overrides '%s' failed", o.upstreamOverridesPath())
+	}
+	return nil
+}
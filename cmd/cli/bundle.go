@@ -0,0 +1,506 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
+	"github.com/penglongli/accelerboat/pkg/utils/formatutils"
+)
+
+const (
+	customapiImportLayer = "/customapi/import-layer"
+	defaultRegistry      = "docker.io"
+	blobsDir             = "blobs/sha256/"
+
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// NewExportCmd returns the command that exports an image into an OCI layout tarball through the proxy.
+func NewExportCmd() *cobra.Command {
+	var (
+		instance string
+		image    string
+		output   string
+		platform string
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export an image (manifest and layers) into an OCI layout tarball through the proxy",
+		Long: "Downloads the manifest and layers of the image through an accelerboat pod (port-forward) and writes " +
+			"them into an OCI layout tarball, which can be imported into an air-gapped cluster with 'import'.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if image == "" {
+				return fmt.Errorf("--image is required")
+			}
+			if output == "" {
+				return fmt.Errorf("--output (-o) is required")
+			}
+			return runExport(instance, image, output, platform)
+		},
+	}
+	cmd.Flags().StringVarP(&instance, "instance", "i", "", "Pod name to export through (optional; default: first running pod)")
+	cmd.Flags().StringVar(&image, "image", "", "Image reference to export, e.g. docker.io/library/nginx:1.27 (required)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output tarball path (required)")
+	cmd.Flags().StringVar(&platform, "platform", "linux/amd64", "Platform to select when the image is a multi-arch index")
+	return cmd
+}
+
+// NewImportCmd returns the command that uploads the blobs of an OCI layout tarball into the cluster cache.
+func NewImportCmd() *cobra.Command {
+	var instance string
+	cmd := &cobra.Command{
+		Use:   "import <bundle.tar>",
+		Short: "Import the layers of an OCI layout tarball into the cluster cache",
+		Long: "Uploads every blob of the OCI layout tarball (created by 'export') to an accelerboat pod via " +
+			customapiImportLayer + ", so that the layers are served from the cluster cache.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImport(instance, args[0])
+		},
+	}
+	cmd.Flags().StringVarP(&instance, "instance", "i", "", "Pod name to import into (optional; default: first running pod)")
+	return cmd
+}
+
+// pickInstance returns the pod with the given name, or the first running accelerboat pod if name is empty.
+func pickInstance(ctx context.Context, client *kube.Client, name string) (*corev1.Pod, error) {
+	if name != "" {
+		return client.GetPod(ctx, name)
+	}
+	list, err := client.ListPods(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	for i := range list.Items {
+		if list.Items[i].Status.Phase == corev1.PodRunning {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no running accelerboat pod in namespace %s", client.Namespace())
+}
+
+// imageRef is the parsed image reference, e.g. docker.io/library/nginx:1.27
+type imageRef struct {
+	registry  string
+	repo      string
+	reference string
+}
+
+func (r *imageRef) String() string {
+	if strings.HasPrefix(r.reference, "sha256:") {
+		return fmt.Sprintf("%s/%s@%s", r.registry, r.repo, r.reference)
+	}
+	return fmt.Sprintf("%s/%s:%s", r.registry, r.repo, r.reference)
+}
+
+func parseImageRef(ref string) (*imageRef, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, fmt.Errorf("image reference is empty")
+	}
+	result := &imageRef{registry: defaultRegistry}
+	name := ref
+	if i := strings.Index(ref, "@"); i >= 0 {
+		name = ref[:i]
+		result.reference = ref[i+1:]
+	}
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			result.registry = first
+			name = name[i+1:]
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		if result.reference == "" {
+			result.reference = name[i+1:]
+		}
+		name = name[:i]
+	}
+	if result.reference == "" {
+		result.reference = "latest"
+	}
+	if result.registry == defaultRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid image reference '%s'", ref)
+	}
+	result.repo = name
+	return result, nil
+}
+
+// registryClient requests the registry API through the port-forwarded accelerboat pod, which serves as
+// RegistryMirror with the 'ns' query param.
+type registryClient struct {
+	baseURL string
+	ref     *imageRef
+	token   string
+}
+
+func (rc *registryClient) buildURL(p string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("ns", rc.ref.registry)
+	return rc.baseURL + p + "?" + query.Encode()
+}
+
+func (rc *registryClient) get(ctx context.Context, p string, accept []string) (*http.Response, error) {
+	resp, err := rc.doGet(ctx, p, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	authenticate := resp.Header.Get("Www-Authenticate")
+	_ = resp.Body.Close()
+	if err = rc.refreshToken(ctx, authenticate); err != nil {
+		return nil, err
+	}
+	return rc.doGet(ctx, p, accept)
+}
+
+func (rc *registryClient) doGet(ctx context.Context, p string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rc.buildURL(p, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range accept {
+		req.Header.Add("Accept", a)
+	}
+	if rc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+rc.token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// refreshToken gets the service token through the proxy with the service/scope of the authenticate header.
+func (rc *registryClient) refreshToken(ctx context.Context, authenticate string) error {
+	_, service, scope := utils.ParseAuthRequest(authenticate)
+	if service == "" || scope == "" {
+		return fmt.Errorf("unauthorized and cannot parse authenticate header '%s'", authenticate)
+	}
+	query := url.Values{}
+	query.Set("service", service)
+	query.Set("scope", scope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rc.buildURL("/service/token", query), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("get service token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read service token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get service token: %s: %s", resp.Status, string(body))
+	}
+	token := &apitypes.RegistryAuthToken{}
+	if err = json.Unmarshal(body, token); err != nil {
+		return fmt.Errorf("unmarshal service token: %w", err)
+	}
+	rc.token = token.Token
+	if rc.token == "" {
+		rc.token = token.AccessToken
+	}
+	return nil
+}
+
+func (rc *registryClient) getManifest(ctx context.Context, reference string) ([]byte, string, error) {
+	resp, err := rc.get(ctx, fmt.Sprintf("/v2/%s/manifests/%s", rc.ref.repo, reference), []string{
+		ocispec.MediaTypeImageIndex, mediaTypeDockerManifestList, ocispec.MediaTypeImageManifest,
+		mediaTypeDockerManifest,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("get manifest %s: %w", reference, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("read manifest %s: %w", reference, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("get manifest %s: %s: %s", reference, resp.Status, string(body))
+	}
+	mediaType := struct {
+		MediaType string `json:"mediaType"`
+	}{}
+	_ = json.Unmarshal(body, &mediaType)
+	if mediaType.MediaType == "" {
+		mediaType.MediaType = strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	}
+	return body, mediaType.MediaType, nil
+}
+
+// resolveManifest returns the image manifest of the reference, the platform manifest is selected if the
+// reference is an index.
+func (rc *registryClient) resolveManifest(ctx context.Context, platform string) ([]byte, string, error) {
+	body, mediaType, err := rc.getManifest(ctx, rc.ref.reference)
+	if err != nil {
+		return nil, "", err
+	}
+	if mediaType != ocispec.MediaTypeImageIndex && mediaType != mediaTypeDockerManifestList {
+		return body, mediaType, nil
+	}
+	index := &ocispec.Index{}
+	if err = json.Unmarshal(body, index); err != nil {
+		return nil, "", fmt.Errorf("unmarshal index: %w", err)
+	}
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return nil, "", fmt.Errorf("invalid platform '%s', expected os/arch[/variant]", platform)
+	}
+	for _, m := range index.Manifests {
+		if m.Platform == nil || m.Platform.OS != parts[0] || m.Platform.Architecture != parts[1] {
+			continue
+		}
+		if len(parts) > 2 && m.Platform.Variant != parts[2] {
+			continue
+		}
+		return rc.getManifest(ctx, m.Digest.String())
+	}
+	return nil, "", fmt.Errorf("platform '%s' not found in index of %s", platform, rc.ref.String())
+}
+
+func runExport(instance, image, output, platform string) error {
+	ref, err := parseImageRef(image)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pod, err := pickInstance(ctx, client, instance)
+	if err != nil {
+		return err
+	}
+	baseURL, stop, err := client.PortForward(ctx, pod.Name, kube.HTTPPortNumber)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	rc := &registryClient{baseURL: baseURL, ref: ref}
+	manifestBody, mediaType, err := rc.resolveManifest(ctx, platform)
+	if err != nil {
+		return err
+	}
+	manifest := &ocispec.Manifest{}
+	if err = json.Unmarshal(manifestBody, manifest); err != nil {
+		return fmt.Errorf("unmarshal manifest: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Exporting %s through pod %s: %d layer(s)\n", ref.String(), pod.Name, len(manifest.Layers))
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", output, err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+
+	manifestDesc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(manifestBody),
+		Size:      int64(len(manifestBody)),
+		Annotations: map[string]string{
+			ocispec.AnnotationRefName:  ref.reference,
+			"io.containerd.image.name": ref.String(),
+		},
+	}
+	indexBody, err := json.Marshal(&ocispec.Index{
+		Versioned: manifest.Versioned,
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{manifestDesc},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal index: %w", err)
+	}
+	layoutBody, _ := json.Marshal(&ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	for _, entry := range []struct {
+		name string
+		body []byte
+	}{
+		{name: ocispec.ImageLayoutFile, body: layoutBody},
+		{name: ocispec.ImageIndexFile, body: indexBody},
+		{name: blobsDir + manifestDesc.Digest.Encoded(), body: manifestBody},
+	} {
+		if err = writeTarFile(tw, entry.name, int64(len(entry.body)), bytes.NewReader(entry.body)); err != nil {
+			return err
+		}
+	}
+
+	written := map[digest.Digest]struct{}{manifestDesc.Digest: {}}
+	blobs := append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...)
+	var total int64
+	for _, desc := range blobs {
+		if _, ok := written[desc.Digest]; ok {
+			continue
+		}
+		start := time.Now()
+		if err = exportBlob(ctx, rc, tw, desc); err != nil {
+			return err
+		}
+		written[desc.Digest] = struct{}{}
+		total += desc.Size
+		fmt.Fprintf(os.Stdout, "  %s | %s | %s\n", desc.Digest.String(), formatutils.FormatSize(desc.Size),
+			time.Since(start).Round(time.Millisecond))
+	}
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("close tarball: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Exported %s to %s (%d blob(s), %s)\n", ref.String(), output, len(written),
+		formatutils.FormatSize(total))
+	return nil
+}
+
+func exportBlob(ctx context.Context, rc *registryClient, tw *tar.Writer, desc ocispec.Descriptor) error {
+	resp, err := rc.get(ctx, fmt.Sprintf("/v2/%s/blobs/%s", rc.ref.repo, desc.Digest.String()), nil)
+	if err != nil {
+		return fmt.Errorf("get blob %s: %w", desc.Digest, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("get blob %s: %s: %s", desc.Digest, resp.Status, string(body))
+	}
+	verifier := desc.Digest.Verifier()
+	if err = writeTarFile(tw, blobsDir+desc.Digest.Encoded(), desc.Size,
+		io.TeeReader(resp.Body, verifier)); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("blob %s digest mismatch", desc.Digest)
+	}
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+		ModTime:  time.Now(),
+	}); err != nil {
+		return fmt.Errorf("write tar header %s: %w", name, err)
+	}
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		return fmt.Errorf("write tar file %s: %w", name, err)
+	}
+	return nil
+}
+
+func runImport(instance, bundle string) error {
+	f, err := os.Open(bundle)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", bundle, err)
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pod, err := pickInstance(ctx, client, instance)
+	if err != nil {
+		return err
+	}
+	baseURL, stop, err := client.PortForward(ctx, pod.Name, kube.HTTPPortNumber)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	fmt.Fprintf(os.Stdout, "Importing %s into pod %s\n", bundle, pod.Name)
+
+	tr := tar.NewReader(f)
+	var count int
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read tarball %s: %w", bundle, err)
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if hdr.Typeflag != tar.TypeReg || !strings.HasPrefix(name, blobsDir) {
+			continue
+		}
+		dgst := digest.NewDigestFromEncoded(digest.SHA256, strings.TrimPrefix(name, blobsDir))
+		if err = dgst.Validate(); err != nil {
+			return fmt.Errorf("invalid blob %s: %w", name, err)
+		}
+		start := time.Now()
+		resp, err := importBlob(ctx, baseURL, dgst, hdr.Size, tr)
+		if err != nil {
+			return err
+		}
+		count++
+		total += hdr.Size
+		fmt.Fprintf(os.Stdout, "  %s | %s | %s | %s\n", dgst.String(), formatutils.FormatSize(hdr.Size),
+			resp.Located, time.Since(start).Round(time.Millisecond))
+	}
+	fmt.Fprintf(os.Stdout, "Imported %d blob(s), %s\n", count, formatutils.FormatSize(total))
+	return nil
+}
+
+func importBlob(ctx context.Context, baseURL string, dgst digest.Digest, size int64, r io.Reader) (
+	*apitypes.ImportLayerResponse, error) {
+	query := url.Values{}
+	query.Set("digest", dgst.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		baseURL+customapiImportLayer+"?"+query.Encode(), io.LimitReader(r, size))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("import blob %s: %w", dgst, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read import response of %s: %w", dgst, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("import blob %s: %s: %s", dgst, resp.Status, string(body))
+	}
+	result := &apitypes.ImportLayerResponse{}
+	if err = json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("unmarshal import response of %s: %w", dgst, err)
+	}
+	return result, nil
+}
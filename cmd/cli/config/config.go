@@ -38,7 +38,11 @@ func ExpandPath(path string) string {
 // Config holds CLI configuration persisted to file.
 type Config struct {
 	Kubeconfig string `yaml:"kubeconfig,omitempty"`
-	Namespace  string `yaml:"namespace,omitempty"`
+	// Context the kubeconfig context to use, the current context of kubeconfig if empty
+	Context string `yaml:"context,omitempty"`
+	// Cluster the kubeconfig cluster overrides the cluster of context if not empty
+	Cluster   string `yaml:"cluster,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
 }
 
 // Load reads config from path. Returns nil config if file does not exist or is invalid.
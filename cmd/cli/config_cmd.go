@@ -10,8 +10,6 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
-
-	"github.com/penglongli/accelerboat/cmd/cli/kube"
 )
 
 const (
@@ -25,7 +23,7 @@ func NewConfigCmd() *cobra.Command {
 		Short: "Get ConfigMap accelerboat-config accelerboat.json content in the namespace",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			client, err := kube.NewClient(effectiveKubeconfig(), effectiveNamespace())
+			client, err := newKubeClient()
 			if err != nil {
 				return err
 			}
@@ -41,5 +39,6 @@ func NewConfigCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.AddCommand(NewUseContextCmd())
 	return cmd
 }
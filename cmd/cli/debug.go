@@ -0,0 +1,113 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+)
+
+// pprofPaths the pprof endpoints registered on the http server of accelerboat
+var pprofPaths = map[string]string{
+	"cpu":       "/debug/pprof/profile",
+	"heap":      "/debug/pprof/heap",
+	"goroutine": "/debug/pprof/goroutine",
+	"allocs":    "/debug/pprof/allocs",
+	"block":     "/debug/pprof/block",
+	"mutex":     "/debug/pprof/mutex",
+}
+
+// NewDebugCmd returns the command group of debugging an instance.
+func NewDebugCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug",
+		Short: "Debug an instance, e.g. fetch its pprof profiles",
+	}
+	cmd.AddCommand(newDebugProfileCmd())
+	return cmd
+}
+
+func newDebugProfileCmd() *cobra.Command {
+	var (
+		instanceID  string
+		profileType string
+		seconds     int
+		output      string
+	)
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Fetch the pprof profile of an instance via port-forward and write it locally",
+		Long: "Fetch the profile given by --type from the pprof endpoints of the pod and write it to --output " +
+			"(default <pod>-<type>-<time>.pprof). The cpu profile is sampled for --seconds, the goroutine " +
+			"profile is written as text with the stacks of all goroutines. Open the file with 'go tool pprof'.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDebugProfile(instanceID, profileType, seconds, output)
+		},
+	}
+	cmd.Flags().StringVarP(&instanceID, "instance-id", "i", "", "Instance (pod) ID (optional; default: master or any ready pod)")
+	cmd.Flags().StringVar(&profileType, "type", "cpu", "Profile type: cpu, heap, goroutine, allocs, block or mutex")
+	cmd.Flags().IntVar(&seconds, "seconds", 30, "Seconds to sample the cpu profile")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write the profile")
+	return cmd
+}
+
+func runDebugProfile(instanceID, profileType string, seconds int, output string) error {
+	path, ok := pprofPaths[profileType]
+	if !ok {
+		return fmt.Errorf("unknown profile type '%s'", profileType)
+	}
+	if seconds <= 0 {
+		return fmt.Errorf("--seconds must be positive")
+	}
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pod, err := selectPod(ctx, client, instanceID)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	switch profileType {
+	case "cpu":
+		query.Set("seconds", strconv.Itoa(seconds))
+	case "goroutine":
+		query.Set("debug", "2")
+	}
+	if output == "" {
+		ext := "pprof"
+		if profileType == "goroutine" {
+			ext = "txt"
+		}
+		output = fmt.Sprintf("%s-%s-%s.%s", pod.Name, profileType, time.Now().Format("20060102150405"), ext)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", output, err)
+	}
+	if profileType == "cpu" {
+		fmt.Fprintf(os.Stderr, "sampling cpu profile of %s for %ds...\n", pod.Name, seconds)
+	}
+	if err = client.PortForwardAndStream(ctx, pod.Name, kube.HTTPPortNumber, path, query, f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(output)
+		return fmt.Errorf("fetch %s profile: %w", profileType, err)
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "%s profile of %s written to %s\n", profileType, pod.Name, output)
+	return nil
+}
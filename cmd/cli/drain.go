@@ -0,0 +1,105 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	customapiDrain    = "/customapi/drain"
+	customapiUncordon = "/customapi/uncordon"
+)
+
+// NewDrainCmd returns the command that cordons the node of pod before maintenance.
+func NewDrainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "drain <pod>",
+		Short: "Cordon the node of pod: stop assigning downloads to it and advertising its layers",
+		Long: "The master does not assign downloads to the cordoned node, and the layers of it are not returned " +
+			"to the other nodes. The node still serves its local clients. The state is kept in the cache store " +
+			"until 'uncordon'.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCordon(args[0], customapiDrain)
+		},
+	}
+}
+
+// NewUncordonCmd returns the command that removes the cordon of the node of pod.
+func NewUncordonCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "uncordon <pod>",
+		Short: "Uncordon the node of pod drained before",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCordon(args[0], customapiUncordon)
+		},
+	}
+}
+
+func runCordon(podName, path string) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pod, err := client.GetPod(ctx, podName)
+	if err != nil {
+		return err
+	}
+	resp, err := cordonRequest(ctx, client, pod.Name, path)
+	if err != nil {
+		return err
+	}
+	if resp.Cordoned && resp.Since != nil {
+		fmt.Fprintf(os.Stdout, "  %s | node %s cordoned since %s\n", pod.Name, resp.Node,
+			resp.Since.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(os.Stdout, "  %s | node %s uncordoned\n", pod.Name, resp.Node)
+	}
+	return nil
+}
+
+func cordonRequest(ctx context.Context, client *kube.Client, podName, path string) (
+	*apitypes.NodeCordonResponse, error) {
+	baseURL, stop, err := client.PortForward(ctx, podName, kube.HTTPPortNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request %s: %s: %s", path, resp.Status, string(body))
+	}
+	result := &apitypes.NodeCordonResponse{}
+	if err = json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return result, nil
+}
@@ -10,7 +10,9 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/spf13/cobra"
@@ -23,6 +25,14 @@ const (
 	defaultTail       = 300
 )
 
+// eventTypes the event types recorded by accelerboat, used to validate the --type filter
+var eventTypes = []string{
+	"service_token", "head_manifest", "get_manifest", "serve_blob_from_local", "get_blob_from_master",
+	"download_blob_by_tcp", "download_blob_by_torrent", "get_layer_info", "download_layer",
+	"check_static_layer", "check_oci_layer", "reverse_proxy", "transfer_layer_tcp", "verify_signature",
+	"panic", "layer_evicted", "torrent_added", "torrent_dropped", "cache_reconciled",
+}
+
 func NewEventsCmd() *cobra.Command {
 	var (
 		instanceID   string
@@ -31,13 +41,17 @@ func NewEventsCmd() *cobra.Command {
 		tail         int
 		registry     string
 		search       string
+		types        []string
 	)
 	cmd := &cobra.Command{
 		Use:   "events",
 		Short: "Get recorder events from an instance via port-forward",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if instanceID == "" {
-				return fmt.Errorf("--instance-id (-i) is required")
+			for _, t := range types {
+				if !slices.Contains(eventTypes, t) {
+					return fmt.Errorf("unknown event type %q, should be one of: %s", t,
+						strings.Join(eventTypes, ", "))
+				}
 			}
 			ctx := context.Background()
 			if follow {
@@ -51,11 +65,11 @@ func NewEventsCmd() *cobra.Command {
 				}()
 				defer cancel()
 			}
-			client, err := kube.NewClient(effectiveKubeconfig(), effectiveNamespace())
+			client, err := newKubeClient()
 			if err != nil {
 				return err
 			}
-			pod, err := client.GetPod(ctx, instanceID)
+			pod, err := selectPod(ctx, client, instanceID)
 			if err != nil {
 				return err
 			}
@@ -73,6 +87,9 @@ func NewEventsCmd() *cobra.Command {
 			if search != "" {
 				query.Set("search", search)
 			}
+			if len(types) != 0 {
+				query.Set("type", strings.Join(types, ","))
+			}
 			if follow {
 				return client.PortForwardAndStream(ctx, pod.Name, kube.HTTPPortNumber, customapiRecorder, query, os.Stdout)
 			}
@@ -84,11 +101,13 @@ func NewEventsCmd() *cobra.Command {
 			return nil
 		},
 	}
-	cmd.Flags().StringVarP(&instanceID, "instance-id", "i", "", "Instance (pod) ID (required)")
+	cmd.Flags().StringVarP(&instanceID, "instance-id", "i", "", "Instance (pod) ID (optional; default: master or any ready pod)")
 	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json")
 	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Stream events (like kubectl logs -f)")
 	cmd.Flags().IntVar(&tail, "tail", defaultTail, "Number of recent events to fetch")
 	cmd.Flags().StringVar(&registry, "registry", "", "Filter by registry (exact match)")
 	cmd.Flags().StringVar(&search, "search", "", "Filter by substring match on repo/extra")
+	cmd.Flags().StringSliceVar(&types, "type", nil, "Filter by event types (comma-separated), one of: "+
+		strings.Join(eventTypes, ", "))
 	return cmd
 }
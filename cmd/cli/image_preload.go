@@ -6,9 +6,12 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -25,27 +28,40 @@ import (
 const (
 	imagePreloadLabelApp  = "image-preload"
 	imagePreloadTaskLabel = "accelerboat.github.com/image-preload-task"
+	// imagePreloadImagesAnnotation holds the hash of the image set of task, the task is resumed only with the
+	// same images
+	imagePreloadImagesAnnotation = "accelerboat.github.com/image-preload-images"
 )
 
+// imagePreloadOptions holds the flags of the image-preload command.
+type imagePreloadOptions struct {
+	namespace   string
+	images      string
+	pullSecrets string
+	nodes       string
+	parallelism int
+	timeout     time.Duration
+	taskName    string
+}
+
 func NewImagePreloadCmd() *cobra.Command {
-	var (
-		namespace   string
-		images      string
-		pullSecrets string
-		nodes       string
-	)
+	opts := &imagePreloadOptions{}
 	cmd := &cobra.Command{
 		Use:   "image-preload",
 		Short: "Preload container images on cluster nodes by running one-off Jobs",
-		Long:  "Creates Jobs that pull the given images on each target node, then watches until completion and cleans up.",
+		Long: "Creates Jobs that pull the given images on each target node, then watches until completion and cleans up. " +
+			"Use --task to rerun a previous task: nodes that already succeeded for that task are skipped.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runImagePreload(cmd, namespace, images, pullSecrets, nodes)
+			return runImagePreload(cmd, opts)
 		},
 	}
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace for preload Jobs (default: accelerboat or value from -n/config)")
-	cmd.Flags().StringVar(&images, "images", "", "Comma-separated list of images to preload (required)")
-	cmd.Flags().StringVar(&pullSecrets, "pullsecrets", "", "Comma-separated list of image pull secret names (optional)")
-	cmd.Flags().StringVar(&nodes, "nodes", "", "Comma-separated list of node names to preload on (optional; default: all nodes)")
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "Namespace for preload Jobs (default: accelerboat or value from -n/config)")
+	cmd.Flags().StringVar(&opts.images, "images", "", "Comma-separated list of images to preload (required)")
+	cmd.Flags().StringVar(&opts.pullSecrets, "pullsecrets", "", "Comma-separated list of image pull secret names (optional)")
+	cmd.Flags().StringVar(&opts.nodes, "nodes", "", "Comma-separated list of node names to preload on (optional; default: all nodes)")
+	cmd.Flags().IntVar(&opts.parallelism, "parallelism", 0, "Max number of node Jobs running at the same time (0 = all nodes at once)")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 0, "Overall timeout for the preload task, e.g. 30m (0 = no timeout)")
+	cmd.Flags().StringVar(&opts.taskName, "task", "", "Task name to resume with the same --images; nodes that already succeeded for this task are skipped")
 	return cmd
 }
 
@@ -75,7 +91,7 @@ func runImagePreloadClean(namespace string) error {
 		ns = defaultNamespace
 	}
 
-	client, err := kube.NewClient(kubeconfig, ns)
+	client, err := kube.NewClient(kubeconfig, effectiveContext(), effectiveCluster(), ns)
 	if err != nil {
 		return err
 	}
@@ -118,15 +134,23 @@ func runImagePreloadClean(namespace string) error {
 	return nil
 }
 
-func runImagePreload(cmd *cobra.Command, namespace, imagesStr, pullSecretsStr, nodesStr string) error {
-	imagesList := parseCommaList(imagesStr)
+func runImagePreload(cmd *cobra.Command, opts *imagePreloadOptions) error {
+	imagesList := parseCommaList(opts.images)
 	if len(imagesList) == 0 {
 		return fmt.Errorf("--images is required and must contain at least one image")
 	}
+	if opts.parallelism < 0 {
+		return fmt.Errorf("--parallelism must not be negative")
+	}
 
 	ctx := context.Background()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
 	kubeconfig := effectiveKubeconfig()
-	ns := namespace
+	ns := opts.namespace
 	if ns == "" {
 		ns = effectiveNamespace()
 	}
@@ -134,12 +158,12 @@ func runImagePreload(cmd *cobra.Command, namespace, imagesStr, pullSecretsStr, n
 		ns = defaultNamespace
 	}
 
-	client, err := kube.NewClient(kubeconfig, ns)
+	client, err := kube.NewClient(kubeconfig, effectiveContext(), effectiveCluster(), ns)
 	if err != nil {
 		return err
 	}
 
-	nodeNames, err := resolveNodeNames(ctx, client, nodesStr)
+	nodeNames, err := resolveNodeNames(ctx, client, opts.nodes)
 	if err != nil {
 		return err
 	}
@@ -147,26 +171,115 @@ func runImagePreload(cmd *cobra.Command, namespace, imagesStr, pullSecretsStr, n
 		return fmt.Errorf("no target nodes found")
 	}
 
-	taskName := fmt.Sprintf("image-preload-%d", time.Now().UnixMilli())
-	pullSecretNames := parseCommaList(pullSecretsStr)
+	taskName := opts.taskName
+	if taskName == "" {
+		taskName = fmt.Sprintf("image-preload-%d", time.Now().UnixMilli())
+	}
+	pullSecretNames := parseCommaList(opts.pullSecrets)
 
 	fmt.Fprintf(os.Stdout, "Image preload task: %s\n", taskName)
-	fmt.Fprintf(os.Stdout, "Namespace: %s | Images: %v | Nodes: %d\n\n", ns, imagesList, len(nodeNames))
+	fmt.Fprintf(os.Stdout, "Namespace: %s | Images: %v | Nodes: %d | Parallelism: %s\n\n", ns, imagesList,
+		len(nodeNames), formatParallelism(opts.parallelism))
 
-	createdJobs, err := createPreloadJobs(ctx, client, taskName, imagesList, pullSecretNames, nodeNames)
+	pendingNodes, err := resumePreloadTask(ctx, client, taskName, nodeNames, imageSetHash(imagesList))
 	if err != nil {
 		return err
 	}
-
-	// Watch and report status until all jobs complete (success or failure)
-	if err := watchPreloadJobs(ctx, client, taskName, createdJobs); err != nil {
-		cleanupPreloadJobs(ctx, client, taskName)
+	results := newImageResults(imagesList)
+	if len(pendingNodes) == 0 {
+		fmt.Fprintln(os.Stdout, "All target nodes already succeeded for this task, nothing to do.")
+	} else if err = runPreloadJobs(ctx, client, taskName, imagesList, pullSecretNames, pendingNodes,
+		opts.parallelism, results); err != nil {
+		results.print()
+		// Keep the succeeded Jobs so that the task can be resumed with --task
+		cleanupUnfinishedPreloadJobs(context.Background(), client, taskName)
+		fmt.Fprintf(os.Stdout, "\nRerun with --task %s to resume, nodes that already succeeded will be skipped.\n",
+			taskName)
 		return err
 	}
+	results.print()
 
 	// Cleanup
 	fmt.Fprintln(os.Stdout, "\nCleaning up Jobs...")
-	return cleanupPreloadJobs(ctx, client, taskName)
+	return cleanupPreloadJobs(context.Background(), client, taskName)
+}
+
+// imageSetHash returns the hash of the images, it is not changed by the order or duplicates of images
+func imageSetHash(images []string) string {
+	set := make(map[string]struct{}, len(images))
+	sorted := make([]string, 0, len(images))
+	for _, image := range images {
+		if _, ok := set[image]; !ok {
+			set[image] = struct{}{}
+			sorted = append(sorted, image)
+		}
+	}
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func formatParallelism(parallelism int) string {
+	if parallelism <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", parallelism)
+}
+
+// resumePreloadTask returns the nodes that still need to run for the task. Nodes whose Job already succeeded are
+// skipped, Jobs that did not succeed are deleted so that they can be created again. The task created with a
+// different image set is refused, the succeeded nodes of it may not have the images.
+func resumePreloadTask(ctx context.Context, client *kube.Client, taskName string, nodeNames []string,
+	imagesHash string) ([]string, error) {
+	selector := fmt.Sprintf("app=%s,%s=%s", imagePreloadLabelApp, imagePreloadTaskLabel, taskName)
+	list, err := client.ListJobs(ctx, selector)
+	if err != nil {
+		return nil, fmt.Errorf("list jobs of task %s: %w", taskName, err)
+	}
+	for i := range list.Items {
+		if list.Items[i].Annotations[imagePreloadImagesAnnotation] != imagesHash {
+			return nil, fmt.Errorf("task %s was created with a different image set, rerun with the same --images "+
+				"or without --task to start a new task", taskName)
+		}
+	}
+	succeededNodes := make(map[string]struct{})
+	for i := range list.Items {
+		j := &list.Items[i]
+		if preloadJobState(j) == jobStateSucceeded {
+			succeededNodes[j.Spec.Template.Spec.NodeName] = struct{}{}
+			continue
+		}
+		if err = client.DeleteJob(ctx, j.Name); err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("delete unfinished job %s: %w", j.Name, err)
+		}
+		if err = waitJobDeleted(ctx, client, j.Name); err != nil {
+			return nil, err
+		}
+	}
+	pending := make([]string, 0, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		if _, ok := succeededNodes[nodeName]; ok {
+			fmt.Fprintf(os.Stdout, "Skip node %s: already succeeded for task %s\n", nodeName, taskName)
+			continue
+		}
+		pending = append(pending, nodeName)
+	}
+	return pending, nil
+}
+
+func waitJobDeleted(ctx context.Context, client *kube.Client, jobName string) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		if _, err := client.GetJob(ctx, jobName); errors.IsNotFound(err) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait job %s deleted: %w", jobName, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
 
 func parseCommaList(s string) []string {
@@ -204,20 +317,15 @@ func resolveNodeNames(ctx context.Context, client *kube.Client, nodesStr string)
 	return client.ListWorkerNodeNames(ctx)
 }
 
-func createPreloadJobs(ctx context.Context, client *kube.Client, taskName string, images []string, pullSecretNames,
-	nodeNames []string) ([]string, error) {
-	var created []string
-	for _, nodeName := range nodeNames {
-		jobName := buildJobName(taskName, nodeName)
-		job := buildPreloadJob(jobName, taskName, nodeName, images, pullSecretNames)
-		_, err := client.CreateJob(ctx, job)
-		if err != nil {
-			return created, fmt.Errorf("create job %s: %w", jobName, err)
-		}
-		created = append(created, jobName)
-		fmt.Fprintf(os.Stdout, "Created Job %s on node %s\n", jobName, nodeName)
+func createPreloadJob(ctx context.Context, client *kube.Client, taskName string, images []string, pullSecretNames []string,
+	nodeName string) (string, error) {
+	jobName := buildJobName(taskName, nodeName)
+	job := buildPreloadJob(jobName, taskName, nodeName, images, pullSecretNames)
+	if _, err := client.CreateJob(ctx, job); err != nil {
+		return "", fmt.Errorf("create job %s: %w", jobName, err)
 	}
-	return created, nil
+	fmt.Fprintf(os.Stdout, "Created Job %s on node %s\n", jobName, nodeName)
+	return jobName, nil
 }
 
 func buildJobName(taskName, nodeName string) string {
@@ -259,8 +367,9 @@ func buildPreloadJob(jobName, taskName, nodeName string, images, pullSecretNames
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   jobName,
-			Labels: map[string]string{"app": imagePreloadLabelApp, imagePreloadTaskLabel: taskName},
+			Name:        jobName,
+			Labels:      map[string]string{"app": imagePreloadLabelApp, imagePreloadTaskLabel: taskName},
+			Annotations: map[string]string{imagePreloadImagesAnnotation: imageSetHash(images)},
 		},
 		Spec: batchv1.JobSpec{
 			BackoffLimit: ptr(int32(3)),
@@ -282,59 +391,99 @@ func buildPreloadJob(jobName, taskName, nodeName string, images, pullSecretNames
 
 func ptr(i int32) *int32 { return &i }
 
-func watchPreloadJobs(ctx context.Context, client *kube.Client, taskName string, jobNames []string) error {
+const (
+	jobStateActive    = "Active"
+	jobStateSucceeded = "Succeeded"
+	jobStateFailed    = "Failed"
+)
+
+// preloadJobState returns the state of the preload Job. A Job is only treated as succeeded when the controller has
+// reported a succeeded Pod, so that a Job which has not been synced yet is not mistaken for a finished one.
+func preloadJobState(j *batchv1.Job) string {
+	if j.Status.Succeeded > 0 {
+		return jobStateSucceeded
+	}
+	for _, cond := range j.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return jobStateFailed
+		}
+	}
+	return jobStateActive
+}
+
+// runPreloadJobs creates the node Jobs with at most parallelism Jobs running at the same time, and watches them
+// until all of them are finished (success or failure) or ctx is done.
+func runPreloadJobs(ctx context.Context, client *kube.Client, taskName string, images, pullSecretNames,
+	nodeNames []string, parallelism int, results *imageResults) error {
 	selector := fmt.Sprintf("app=%s,%s=%s", imagePreloadLabelApp, imagePreloadTaskLabel, taskName)
+	if parallelism <= 0 || parallelism > len(nodeNames) {
+		parallelism = len(nodeNames)
+	}
+	pending := append([]string{}, nodeNames...)
+	created := make(map[string]struct{})
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
 	// Track which jobs have had their terminal-state logged to avoid duplicate output
 	loggedTerminal := make(map[string]bool)
-
+	var failedNames []string
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-		}
-
 		list, err := client.ListJobs(ctx, selector)
 		if err != nil {
 			return fmt.Errorf("list jobs: %w", err)
 		}
 
 		var succeeded, active, failedCount int
-		var failedNames []string
 		for i := range list.Items {
 			j := &list.Items[i]
+			if _, ok := created[j.Name]; !ok {
+				// Jobs that succeeded in a previous run of the task
+				continue
+			}
 			nodeName := j.Spec.Template.Spec.NodeName
 			if nodeName == "" {
 				nodeName = "<unknown>"
 			}
-			if j.Status.Active > 0 {
+			state := preloadJobState(j)
+			switch state {
+			case jobStateActive:
 				active++
-			} else if j.Status.Failed > 0 {
+				results.watchPullErrors(ctx, client, j, nodeName)
+				continue
+			case jobStateFailed:
 				failedCount++
-				failedNames = append(failedNames, j.Name)
-				if !loggedTerminal[j.Name] {
-					loggedTerminal[j.Name] = true
-					elapsed := jobElapsed(j)
-					fmt.Fprintf(os.Stdout, "[terminal] Job %s | node: %s | status: Failed | duration: %s\n", j.Name, nodeName, elapsed)
-				}
-			} else {
+			default:
 				succeeded++
-				if !loggedTerminal[j.Name] {
-					loggedTerminal[j.Name] = true
-					elapsed := jobElapsed(j)
-					fmt.Fprintf(os.Stdout, "[terminal] Job %s | node: %s | status: Succeeded | duration: %s\n", j.Name, nodeName, elapsed)
-				}
 			}
+			if loggedTerminal[j.Name] {
+				continue
+			}
+			loggedTerminal[j.Name] = true
+			if state == jobStateFailed {
+				failedNames = append(failedNames, j.Name)
+			}
+			fmt.Fprintf(os.Stdout, "[terminal] Job %s | node: %s | status: %s | duration: %s\n", j.Name, nodeName,
+				state, jobElapsed(j))
+			results.collect(ctx, client, j, nodeName, state)
+		}
+		// Jobs just created may not be listed yet, treat them as active
+		active = len(created) - succeeded - failedCount
+
+		for active < parallelism && len(pending) > 0 {
+			nodeName := pending[0]
+			jobName, err := createPreloadJob(ctx, client, taskName, images, pullSecretNames, nodeName)
+			if err != nil {
+				return err
+			}
+			pending = pending[1:]
+			created[jobName] = struct{}{}
+			active++
 		}
 
-		total := len(list.Items)
-		fmt.Fprintf(os.Stdout, "[%s] Jobs: %d total, %d succeeded, %d active, %d failed\n",
-			time.Now().Format("15:04:05"), total, succeeded, active, failedCount)
+		fmt.Fprintf(os.Stdout, "[%s] Jobs: %d total, %d pending, %d succeeded, %d active, %d failed\n",
+			time.Now().Format("15:04:05"), len(nodeNames), len(pending), succeeded, active, failedCount)
 
-		if active == 0 {
+		if active == 0 && len(pending) == 0 {
 			if failedCount > 0 {
 				fmt.Fprintf(os.Stdout, "Failed Jobs: %s\n", strings.Join(failedNames, ", "))
 				return fmt.Errorf("one or more Jobs failed: %v", failedNames)
@@ -342,6 +491,210 @@ func watchPreloadJobs(ctx context.Context, client *kube.Client, taskName string,
 			fmt.Fprintln(os.Stdout, "All preload Jobs completed successfully.")
 			return nil
 		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait preload jobs: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// imagePullErrorReasons are the waiting reasons of a container whose image cannot be pulled.
+var imagePullErrorReasons = map[string]struct{}{
+	"ErrImagePull":      {},
+	"ImagePullBackOff":  {},
+	"InvalidImageName":  {},
+	"ErrImageNeverPull": {},
+}
+
+// imagePullError describes why an image cannot be pulled on a node.
+type imagePullError struct {
+	image   string
+	node    string
+	reason  string
+	message string
+}
+
+func (e *imagePullError) String() string {
+	msg := e.reason
+	if cause := classifyPullError(e.message); cause != "" {
+		msg += " (" + cause + ")"
+	}
+	if e.message != "" {
+		msg += ": " + e.message
+	}
+	return msg
+}
+
+// classifyPullError returns a short cause of the pull error message, empty if the cause is unknown.
+func classifyPullError(message string) string {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "unauthorized") || strings.Contains(lower, "authorization failed") ||
+		strings.Contains(lower, "403 forbidden"):
+		return "unauthorized"
+	case strings.Contains(lower, "not found") || strings.Contains(lower, "manifest unknown"):
+		return "not found"
+	case strings.Contains(lower, "timeout"):
+		return "timeout"
+	}
+	return ""
+}
+
+// inspectPreloadPods returns the images that were pulled successfully by the Pods of the Job, and the pull errors
+// of the images that failed. The messages of the Pod Warning events are used when the container status carries no
+// message.
+func inspectPreloadPods(ctx context.Context, client *kube.Client, jobName, nodeName string) (
+	map[string]bool, map[string]*imagePullError, error) {
+	pods, err := client.ListPodsBySelector(ctx, "job-name="+jobName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list pods of job %s: %w", jobName, err)
+	}
+	pulled := make(map[string]bool)
+	pullErrors := make(map[string]*imagePullError)
+	for i := range pods.Items {
+		p := &pods.Items[i]
+		containerImages := make(map[string]string)
+		for _, c := range p.Spec.Containers {
+			containerImages[c.Name] = c.Image
+		}
+		podErrors := make([]*imagePullError, 0)
+		for _, cs := range p.Status.ContainerStatuses {
+			image := containerImages[cs.Name]
+			if cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0 {
+				pulled[image] = true
+				continue
+			}
+			if cs.State.Waiting == nil {
+				continue
+			}
+			if _, ok := imagePullErrorReasons[cs.State.Waiting.Reason]; !ok {
+				continue
+			}
+			pullErr := &imagePullError{
+				image:   image,
+				node:    nodeName,
+				reason:  cs.State.Waiting.Reason,
+				message: cs.State.Waiting.Message,
+			}
+			pullErrors[image] = pullErr
+			podErrors = append(podErrors, pullErr)
+		}
+		if len(podErrors) == 0 {
+			continue
+		}
+		events, err := client.ListEvents(ctx, "involvedObject.kind=Pod,involvedObject.name="+p.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: list events of pod %s: %v\n", p.Name, err)
+			continue
+		}
+		for _, pullErr := range podErrors {
+			for j := range events.Items {
+				ev := &events.Items[j]
+				if ev.Type != corev1.EventTypeWarning || !strings.Contains(ev.Message, `"`+pullErr.image+`"`) {
+					continue
+				}
+				// The "Failed" event carries the error from the registry, e.g. unauthorized or not found
+				if ev.Reason == "Failed" || pullErr.message == "" {
+					pullErr.message = ev.Message
+				}
+			}
+		}
+	}
+	return pulled, pullErrors, nil
+}
+
+// imageResults aggregates the per-image preload result of every node.
+type imageResults struct {
+	images     []string
+	succeeded  map[string][]string
+	failed     map[string][]string
+	pullErrors map[string]map[string]*imagePullError
+}
+
+func newImageResults(images []string) *imageResults {
+	return &imageResults{
+		images:     images,
+		succeeded:  make(map[string][]string),
+		failed:     make(map[string][]string),
+		pullErrors: make(map[string]map[string]*imagePullError),
+	}
+}
+
+// recordPullError saves the pull error of the image on the node, returns true if the error was not seen before.
+func (r *imageResults) recordPullError(pullErr *imagePullError) bool {
+	nodeErrors, ok := r.pullErrors[pullErr.image]
+	if !ok {
+		nodeErrors = make(map[string]*imagePullError)
+		r.pullErrors[pullErr.image] = nodeErrors
+	}
+	prev, ok := nodeErrors[pullErr.node]
+	nodeErrors[pullErr.node] = pullErr
+	return !ok || prev.reason != pullErr.reason || prev.message != pullErr.message
+}
+
+// watchPullErrors prints the pull errors of the active Job when they are first seen. The kubelet keeps retrying
+// in ImagePullBackOff, so a Job with a wrong image or missing credential is otherwise only reported as active.
+func (r *imageResults) watchPullErrors(ctx context.Context, client *kube.Client, j *batchv1.Job, nodeName string) {
+	_, pullErrors, err := inspectPreloadPods(ctx, client, j.Name, nodeName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	for _, image := range r.images {
+		pullErr, ok := pullErrors[image]
+		if !ok || !r.recordPullError(pullErr) {
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "[pull-error] Job %s | node: %s | image: %s | %s\n", j.Name, nodeName, image,
+			pullErr.String())
+	}
+}
+
+// collect records the per-image result of the terminated Job. A succeeded Job means all images were pulled,
+// otherwise the container statuses of the Job's Pods are used to find out which image failed.
+func (r *imageResults) collect(ctx context.Context, client *kube.Client, j *batchv1.Job, nodeName, state string) {
+	if state == jobStateSucceeded {
+		for _, image := range r.images {
+			r.succeeded[image] = append(r.succeeded[image], nodeName)
+			delete(r.pullErrors[image], nodeName)
+		}
+		return
+	}
+	pulled, pullErrors, err := inspectPreloadPods(ctx, client, j.Name, nodeName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	for _, image := range r.images {
+		if pulled[image] {
+			r.succeeded[image] = append(r.succeeded[image], nodeName)
+			continue
+		}
+		r.failed[image] = append(r.failed[image], nodeName)
+		if pullErr, ok := pullErrors[image]; ok {
+			r.recordPullError(pullErr)
+		}
+	}
+}
+
+func (r *imageResults) print() {
+	fmt.Fprintln(os.Stdout, "\nImages:")
+	for _, image := range r.images {
+		fmt.Fprintf(os.Stdout, "  %s | succeeded: %d | failed: %d\n", image, len(r.succeeded[image]),
+			len(r.failed[image]))
+		if len(r.failed[image]) != 0 {
+			fmt.Fprintf(os.Stdout, "    failed nodes: %s\n", strings.Join(r.failed[image], ", "))
+		}
+		nodeErrors := r.pullErrors[image]
+		nodes := make([]string, 0, len(nodeErrors))
+		for node := range nodeErrors {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+		for _, node := range nodes {
+			fmt.Fprintf(os.Stdout, "    node %s: %s\n", node, nodeErrors[node].String())
+		}
 	}
 }
 
@@ -372,3 +725,25 @@ func cleanupPreloadJobs(ctx context.Context, client *kube.Client, taskName strin
 	}
 	return nil
 }
+
+// cleanupUnfinishedPreloadJobs deletes the Jobs of the task that did not succeed, the succeeded Jobs are kept to
+// mark the nodes as done when the task is resumed.
+func cleanupUnfinishedPreloadJobs(ctx context.Context, client *kube.Client, taskName string) {
+	selector := fmt.Sprintf("app=%s,%s=%s", imagePreloadLabelApp, imagePreloadTaskLabel, taskName)
+	list, err := client.ListJobs(ctx, selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: list jobs for cleanup: %v\n", err)
+		return
+	}
+	for i := range list.Items {
+		j := &list.Items[i]
+		if preloadJobState(j) == jobStateSucceeded {
+			continue
+		}
+		if err = client.DeleteJob(ctx, j.Name); err != nil && !errors.IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "Warning: delete job %s: %v\n", j.Name, err)
+		} else {
+			fmt.Fprintf(os.Stdout, "Deleted Job %s\n", j.Name)
+		}
+	}
+}
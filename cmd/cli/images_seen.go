@@ -0,0 +1,117 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const customapiImagesSeen = "/customapi/images-seen"
+
+// NewImagesSeenCmd returns the command that lists the images pulled through the cluster recently.
+func NewImagesSeenCmd() *cobra.Command {
+	var (
+		days         int
+		registry     string
+		repo         string
+		outputFormat string
+	)
+	cmd := &cobra.Command{
+		Use:   "images-seen",
+		Short: "List the images pulled through accelerboat in the last N days",
+		Long: "List the repos and tags pulled through the proxies of the cluster with the first and last seen " +
+			"time, the last seen first. The index is shared by all pods and needs imageIndex enabled. The " +
+			"output can be used for audit or as the image list of preheating.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImagesSeen(days, registry, repo, outputFormat)
+		},
+	}
+	cmd.Flags().IntVar(&days, "days", 7, "Only list the images pulled in the last N days")
+	cmd.Flags().StringVar(&registry, "registry", "", "Only list the images of the original registry")
+	cmd.Flags().StringVar(&repo, "repo", "", "Only list the images whose repo contains the value")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json, or name (one image per line)")
+	return cmd
+}
+
+func runImagesSeen(days int, registry, repo, outputFormat string) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pods, err := selectPods(ctx, client, "")
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("days", strconv.Itoa(days))
+	if registry != "" {
+		query.Set("registry", registry)
+	}
+	if repo != "" {
+		query.Set("repo", repo)
+	}
+	// the index is in the cache store, any pod answers it
+	var body []byte
+	for i := range pods {
+		if body, err = client.PortForwardAndRequest(ctx, pods[i].Name, kube.HTTPPortNumber, customapiImagesSeen,
+			query); err == nil {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("query images seen: %w", err)
+	}
+	resp := &apitypes.ImagesSeenResponse{}
+	if err = json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("unmarshal images seen: %w", err)
+	}
+	switch outputFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	case "name":
+		for _, img := range resp.Images {
+			fmt.Fprintln(os.Stdout, imageSeenName(img))
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tFIRST SEEN\tLAST SEEN")
+	for _, img := range resp.Images {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", imageSeenName(img), img.FirstSeen.Format(time.RFC3339),
+			img.LastSeen.Format(time.RFC3339))
+	}
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "\n%d images seen since %s\n", len(resp.Images), resp.Since.Format(time.RFC3339))
+	return nil
+}
+
+// imageSeenName returns the reference of image, the tag seen can be a digest
+func imageSeenName(img *apitypes.ImageSeen) string {
+	sep := ":"
+	if strings.HasPrefix(img.Tag, "sha256:") {
+		sep = "@"
+	}
+	return img.Registry + "/" + img.Repo + sep + img.Tag
+}
@@ -6,7 +6,6 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"net/url"
 	"os"
 
@@ -25,17 +24,14 @@ func NewImagesShowCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "images-show",
 		Short: "Get OCI images and layer digests via /customapi/oci-images",
-		Long:  "Calls GET /customapi/oci-images on the target pod and prints image and digest info. Use -i to specify the pod name (e.g. accelerboat-5bj67).",
+		Long:  "Calls GET /customapi/oci-images on the target pod and prints image and digest info. Use -i to specify the pod name (e.g. accelerboat-5bj67), the master or any ready pod is selected if not specified.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if instanceOrNode == "" {
-				return fmt.Errorf("--instance (-i) is required: pass the pod name (e.g. accelerboat-5bj67)")
-			}
 			ctx := context.Background()
-			client, err := kube.NewClient(effectiveKubeconfig(), effectiveNamespace())
+			client, err := newKubeClient()
 			if err != nil {
 				return err
 			}
-			pod, err := client.GetPod(ctx, instanceOrNode)
+			pod, err := selectPod(ctx, client, instanceOrNode)
 			if err != nil {
 				return err
 			}
@@ -51,7 +47,7 @@ func NewImagesShowCmd() *cobra.Command {
 			return nil
 		},
 	}
-	cmd.Flags().StringVarP(&instanceOrNode, "instance", "i", "", "Pod name to query (required)")
+	cmd.Flags().StringVarP(&instanceOrNode, "instance", "i", "", "Pod name to query (optional; default: master or any ready pod)")
 	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json (default: human-readable text)")
 	return cmd
 }
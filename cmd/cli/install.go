@@ -0,0 +1,283 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/cmd/cli/manifests"
+)
+
+// installOptions holds the flags of the install and upgrade commands.
+type installOptions struct {
+	valuesFile  string
+	sets        []string
+	registries  []string
+	dryRun      bool
+	resetConfig bool
+}
+
+func (o *installOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.valuesFile, "values", "f", "", "Values file in the format of chart charts/accelerboat (e.g. its values.yaml)")
+	cmd.Flags().StringArrayVar(&o.sets, "set", nil, "Override value with the key of chart values, e.g. image.tag=v0.1.0, runtime=serverless, "+
+		"env.httpPort=2080, env.downloadPath=/data/accelerboat/storage, hostPath=/data/accelerboat (can be repeated)")
+	cmd.Flags().StringArrayVar(&o.registries, "registry", nil, "Registry mapping in the format proxyHost=originalHost, "+
+		"e.g. docker.example.com=registry-1.docker.io (can be repeated)")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "Print the rendered manifests instead of applying them")
+}
+
+// values returns the default values overridden by the values file, --set and --registry
+func (o *installOptions) values() (*manifests.Values, error) {
+	values := manifests.DefaultValues()
+	if o.valuesFile != "" {
+		if err := values.LoadFile(expandPath(o.valuesFile)); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range o.sets {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("--set '%s' not in 'key=value' format", s)
+		}
+		if err := values.Set(key, value); err != nil {
+			return nil, fmt.Errorf("--set '%s': %w", s, err)
+		}
+	}
+	for _, r := range o.registries {
+		proxyHost, originalHost, ok := strings.Cut(r, "=")
+		if !ok || proxyHost == "" || originalHost == "" {
+			return nil, fmt.Errorf("--registry '%s' not in 'proxyHost=originalHost' format", r)
+		}
+		values.AddRegistry(proxyHost, originalHost)
+	}
+	return values, nil
+}
+
+// changesConfig returns whether the flags override the values rendered into ConfigMap
+func (o *installOptions) changesConfig() bool {
+	if o.valuesFile != "" || len(o.registries) != 0 {
+		return true
+	}
+	for _, s := range o.sets {
+		if strings.HasPrefix(s, "env.") {
+			return true
+		}
+	}
+	return false
+}
+
+// NewInstallCmd returns the command that deploys accelerboat without helm.
+func NewInstallCmd() *cobra.Command {
+	opts := &installOptions{}
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install accelerboat into the namespace with the manifests of chart",
+		Long: "Render the DaemonSet (runtime standalone) or Deployment (runtime serverless), Service, ConfigMap " +
+			"and RBAC the same as chart charts/accelerboat, and create them in the namespace (created if not exists). " +
+			"Fails if accelerboat is installed already, use 'upgrade' instead.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInstall(opts)
+		},
+	}
+	opts.addFlags(cmd)
+	return cmd
+}
+
+// NewUpgradeCmd returns the command that upgrades the installed accelerboat.
+func NewUpgradeCmd() *cobra.Command {
+	opts := &installOptions{}
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Upgrade the installed accelerboat, the existing ConfigMap is kept",
+		Long: "Render the manifests and update the workload, Service and RBAC in the namespace. The existing ConfigMap " +
+			"accelerboat-config is kept (use --reset-config to overwrite it), and the ports of workload and Service " +
+			"follow it. The selector of the existing workload (e.g. installed by helm) is kept.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUpgrade(opts)
+		},
+	}
+	opts.addFlags(cmd)
+	cmd.Flags().BoolVar(&opts.resetConfig, "reset-config", false, "Overwrite the existing ConfigMap with the rendered one")
+	return cmd
+}
+
+func runInstall(opts *installOptions) error {
+	values, err := opts.values()
+	if err != nil {
+		return err
+	}
+	namespace := effectiveNamespace()
+	m, err := manifests.Render(values, namespace)
+	if err != nil {
+		return err
+	}
+	if opts.dryRun {
+		return printManifests(m)
+	}
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	if _, err = client.GetConfigMap(ctx, manifests.ConfigMapName); err == nil {
+		return fmt.Errorf("ConfigMap %s exists in namespace %s, accelerboat is installed already, "+
+			"use 'accelerboat upgrade' instead", manifests.ConfigMapName, namespace)
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("get ConfigMap %s: %w", manifests.ConfigMapName, err)
+	}
+	if err = client.EnsureNamespace(ctx); err != nil {
+		return fmt.Errorf("ensure namespace %s: %w", namespace, err)
+	}
+	if err = applyManifests(ctx, client, m, true); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "accelerboat %s installed in namespace %s\n", values.Image.Tag, namespace)
+	return nil
+}
+
+func runUpgrade(opts *installOptions) error {
+	values, err := opts.values()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	namespace := client.Namespace()
+	cm, err := client.GetConfigMap(ctx, manifests.ConfigMapName)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("get ConfigMap %s: %w", manifests.ConfigMapName, err)
+	}
+	keepConfig := err == nil && !opts.resetConfig
+	if keepConfig {
+		if opts.changesConfig() {
+			return fmt.Errorf("the values of config (env.*, --values, --registry) take effect only with --reset-config, " +
+				"the existing ConfigMap is kept otherwise")
+		}
+		if err = values.LoadConfig(cm.Data[manifests.ConfigMapKey]); err != nil {
+			return fmt.Errorf("ConfigMap %s: %w", manifests.ConfigMapName, err)
+		}
+	}
+	selector, err := existingSelector(ctx, client, values.Runtime)
+	if err != nil {
+		return err
+	}
+	m, err := manifests.Render(values, namespace)
+	if err != nil {
+		return err
+	}
+	if keepConfig {
+		m.SetConfig(cm.Data[manifests.ConfigMapKey])
+	}
+	m.SetSelector(selector)
+	if opts.dryRun {
+		return printManifests(m)
+	}
+	if err = applyManifests(ctx, client, m, !keepConfig); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "accelerboat upgraded to %s in namespace %s\n", values.Image.Tag, namespace)
+	return nil
+}
+
+// existingSelector returns the selector of the existing workload, nil if not installed. The workload of
+// the other runtime is not replaced silently.
+func existingSelector(ctx context.Context, client *kube.Client, runtime string) (*metav1.LabelSelector, error) {
+	ds, err := client.GetDaemonSet(ctx, manifests.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get DaemonSet %s: %w", manifests.Name, err)
+	}
+	if err == nil {
+		if runtime != manifests.RuntimeStandalone {
+			return nil, fmt.Errorf("DaemonSet %s exists, runtime must be %s", manifests.Name, manifests.RuntimeStandalone)
+		}
+		return ds.Spec.Selector, nil
+	}
+	deploy, err := client.GetDeployment(ctx, manifests.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get Deployment %s: %w", manifests.Name, err)
+	}
+	if err == nil {
+		if runtime != manifests.RuntimeServerless {
+			return nil, fmt.Errorf("Deployment %s exists, runtime must be %s (e.g. --set runtime=%s)",
+				manifests.Name, manifests.RuntimeServerless, manifests.RuntimeServerless)
+		}
+		return deploy.Spec.Selector, nil
+	}
+	return nil, nil
+}
+
+func printManifests(m *manifests.Manifests) error {
+	bs, err := m.YAML()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(bs)
+	return err
+}
+
+// applyManifests applies the objects in order, the ConfigMap is created if not exists when config is false
+func applyManifests(ctx context.Context, client *kube.Client, m *manifests.Manifests, config bool) error {
+	type step struct {
+		kind  string
+		name  string
+		apply func() (string, error)
+	}
+	steps := []step{
+		{"ServiceAccount", m.ServiceAccount.Name, func() (string, error) {
+			return client.ApplyServiceAccount(ctx, m.ServiceAccount)
+		}},
+		{"Role", m.Role.Name, func() (string, error) { return client.ApplyRole(ctx, m.Role) }},
+		{"RoleBinding", m.RoleBinding.Name, func() (string, error) { return client.ApplyRoleBinding(ctx, m.RoleBinding) }},
+		{"ClusterRole", m.ClusterRole.Name, func() (string, error) { return client.ApplyClusterRole(ctx, m.ClusterRole) }},
+		{"ClusterRoleBinding", m.ClusterRoleBinding.Name, func() (string, error) {
+			return client.ApplyClusterRoleBinding(ctx, m.ClusterRoleBinding)
+		}},
+		{"ConfigMap", m.ConfigMap.Name, func() (string, error) {
+			if config {
+				return client.ApplyConfigMap(ctx, m.ConfigMap)
+			}
+			_, err := client.CreateConfigMap(ctx, m.ConfigMap)
+			if apierrors.IsAlreadyExists(err) {
+				return "kept", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			return kube.ApplyCreated, nil
+		}},
+		{"Service", m.Service.Name, func() (string, error) { return client.ApplyService(ctx, m.Service) }},
+	}
+	if m.DaemonSet != nil {
+		steps = append(steps, step{"DaemonSet", m.DaemonSet.Name, func() (string, error) {
+			return client.ApplyDaemonSet(ctx, m.DaemonSet)
+		}})
+	}
+	if m.Deployment != nil {
+		steps = append(steps, step{"Deployment", m.Deployment.Name, func() (string, error) {
+			return client.ApplyDeployment(ctx, m.Deployment)
+		}})
+	}
+	for _, s := range steps {
+		result, err := s.apply()
+		if err != nil {
+			return fmt.Errorf("apply %s %s: %w", s.kind, s.name, err)
+		}
+		fmt.Fprintf(os.Stdout, "  %s/%s %s\n", s.kind, s.name, result)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ApplyCreated is the result of applying the object not existing
+	ApplyCreated = "created"
+	// ApplyConfigured is the result of applying the existing object
+	ApplyConfigured = "configured"
+)
+
+// applyObject creates obj, or updates the existing object with obj. The labels and annotations of the
+// existing object (e.g. the ownership of helm) are kept, merge copies the fields assigned by server.
+func applyObject[T metav1.Object](ctx context.Context, obj T,
+	get func(context.Context, string, metav1.GetOptions) (T, error),
+	create func(context.Context, T, metav1.CreateOptions) (T, error),
+	update func(context.Context, T, metav1.UpdateOptions) (T, error),
+	merge func(existing, obj T)) (string, error) {
+	existing, err := get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err = create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			return "", err
+		}
+		return ApplyCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	obj.SetLabels(mergeMap(existing.GetLabels(), obj.GetLabels()))
+	obj.SetAnnotations(mergeMap(existing.GetAnnotations(), obj.GetAnnotations()))
+	if merge != nil {
+		merge(existing, obj)
+	}
+	if _, err = update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		return "", err
+	}
+	return ApplyConfigured, nil
+}
+
+func mergeMap(existing, m map[string]string) map[string]string {
+	result := make(map[string]string, len(existing)+len(m))
+	for k, v := range existing {
+		result[k] = v
+	}
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// EnsureNamespace creates the configured namespace if not exists.
+func (c *Client) EnsureNamespace(ctx context.Context) error {
+	if err := c.requireCluster(); err != nil {
+		return err
+	}
+	_, err := c.clientset.CoreV1().Namespaces().Get(ctx, c.namespace, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	_, err = c.clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: c.namespace},
+	}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// CreateConfigMap creates the ConfigMap in the configured namespace.
+func (c *Client) CreateConfigMap(ctx context.Context, cm *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
+	return c.clientset.CoreV1().ConfigMaps(c.namespace).Create(ctx, cm, metav1.CreateOptions{})
+}
+
+// GetDaemonSet returns the named DaemonSet in the configured namespace.
+func (c *Client) GetDaemonSet(ctx context.Context, name string) (*appsv1.DaemonSet, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
+	return c.clientset.AppsV1().DaemonSets(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// GetDeployment returns the named Deployment in the configured namespace.
+func (c *Client) GetDeployment(ctx context.Context, name string) (*appsv1.Deployment, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
+	return c.clientset.AppsV1().Deployments(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// ApplyServiceAccount creates or updates the ServiceAccount in the configured namespace.
+func (c *Client) ApplyServiceAccount(ctx context.Context, sa *corev1.ServiceAccount) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.CoreV1().ServiceAccounts(c.namespace)
+	return applyObject(ctx, sa, client.Get, client.Create, client.Update, func(existing, obj *corev1.ServiceAccount) {
+		obj.Secrets = existing.Secrets
+		obj.ImagePullSecrets = existing.ImagePullSecrets
+	})
+}
+
+// ApplyRole creates or updates the Role in the configured namespace.
+func (c *Client) ApplyRole(ctx context.Context, role *rbacv1.Role) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.RbacV1().Roles(c.namespace)
+	return applyObject(ctx, role, client.Get, client.Create, client.Update, nil)
+}
+
+// ApplyRoleBinding creates or updates the RoleBinding in the configured namespace.
+func (c *Client) ApplyRoleBinding(ctx context.Context, binding *rbacv1.RoleBinding) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.RbacV1().RoleBindings(c.namespace)
+	return applyObject(ctx, binding, client.Get, client.Create, client.Update, nil)
+}
+
+// ApplyClusterRole creates or updates the ClusterRole.
+func (c *Client) ApplyClusterRole(ctx context.Context, role *rbacv1.ClusterRole) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.RbacV1().ClusterRoles()
+	return applyObject(ctx, role, client.Get, client.Create, client.Update, nil)
+}
+
+// ApplyClusterRoleBinding creates or updates the ClusterRoleBinding.
+func (c *Client) ApplyClusterRoleBinding(ctx context.Context, binding *rbacv1.ClusterRoleBinding) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.RbacV1().ClusterRoleBindings()
+	return applyObject(ctx, binding, client.Get, client.Create, client.Update, nil)
+}
+
+// ApplyConfigMap creates or updates the ConfigMap in the configured namespace.
+func (c *Client) ApplyConfigMap(ctx context.Context, cm *corev1.ConfigMap) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.CoreV1().ConfigMaps(c.namespace)
+	return applyObject(ctx, cm, client.Get, client.Create, client.Update, nil)
+}
+
+// ApplyService creates or updates the Service in the configured namespace, the cluster IPs allocated
+// are kept.
+func (c *Client) ApplyService(ctx context.Context, svc *corev1.Service) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.CoreV1().Services(c.namespace)
+	return applyObject(ctx, svc, client.Get, client.Create, client.Update, func(existing, obj *corev1.Service) {
+		obj.Spec.ClusterIP = existing.Spec.ClusterIP
+		obj.Spec.ClusterIPs = existing.Spec.ClusterIPs
+		obj.Spec.IPFamilies = existing.Spec.IPFamilies
+		obj.Spec.IPFamilyPolicy = existing.Spec.IPFamilyPolicy
+	})
+}
+
+// ApplyDaemonSet creates or updates the DaemonSet in the configured namespace.
+func (c *Client) ApplyDaemonSet(ctx context.Context, ds *appsv1.DaemonSet) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.AppsV1().DaemonSets(c.namespace)
+	return applyObject(ctx, ds, client.Get, client.Create, client.Update, nil)
+}
+
+// ApplyDeployment creates or updates the Deployment in the configured namespace.
+func (c *Client) ApplyDeployment(ctx context.Context, deploy *appsv1.Deployment) (string, error) {
+	if err := c.requireCluster(); err != nil {
+		return "", err
+	}
+	client := c.clientset.AppsV1().Deployments(c.namespace)
+	return applyObject(ctx, deploy, client.Get, client.Create, client.Update, nil)
+}
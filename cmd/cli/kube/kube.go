@@ -11,7 +11,10 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -37,17 +40,31 @@ type Client struct {
 	clientset *kubernetes.Clientset
 	config    *restclient.Config
 	namespace string
+	// address the base URL of accelerboat (e.g. NodePort or Ingress) requested directly without port-forward
+	address string
+
+	forwardsLock sync.Mutex
+	// forwards the port-forwards reused by the requests to the same pod and port, released by Close
+	forwards map[string]*forward
 }
 
-// NewClient builds a Kubernetes client from kubeconfig path and namespace.
-func NewClient(kubeconfig, namespace string) (*Client, error) {
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	if kubeconfig != "" {
-		loadingRules.ExplicitPath = kubeconfig
+// forward is the running port-forward, done is closed when it exits
+type forward struct {
+	baseURL string
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+// NewClient builds a Kubernetes client from kubeconfig path and namespace. The kubeContext and cluster
+// override the current context and its cluster of kubeconfig if not empty.
+func NewClient(kubeconfig, kubeContext, cluster, namespace string) (*Client, error) {
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
 	}
+	overrides.Context.Cluster = cluster
 	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		loadingRules,
-		&clientcmd.ConfigOverrides{},
+		loadingRules(kubeconfig),
+		overrides,
 	).ClientConfig()
 	if err != nil {
 		return nil, fmt.Errorf("build rest config: %w", err)
@@ -60,9 +77,63 @@ func NewClient(kubeconfig, namespace string) (*Client, error) {
 		clientset: clientset,
 		config:    config,
 		namespace: namespace,
+		forwards:  make(map[string]*forward),
 	}, nil
 }
 
+// NewDirectClient returns the client requesting the accelerboat at address directly (e.g.
+// http://10.0.0.1:32080), without kubeconfig and port-forward. The address is treated as the only pod.
+func NewDirectClient(address, namespace string) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &Client{
+		namespace: namespace,
+		address:   strings.TrimSuffix(address, "/"),
+		forwards:  make(map[string]*forward),
+	}
+}
+
+// Close stops the port-forwards of client
+func (c *Client) Close() {
+	c.forwardsLock.Lock()
+	defer c.forwardsLock.Unlock()
+	for key, f := range c.forwards {
+		close(f.stopCh)
+		delete(c.forwards, key)
+	}
+}
+
+// requireCluster returns error if the client cannot access the cluster, i.e. created with address
+func (c *Client) requireCluster() error {
+	if c.clientset == nil {
+		return fmt.Errorf("the command requires kubeconfig, not supported with address %s", c.address)
+	}
+	return nil
+}
+
+func loadingRules(kubeconfig string) *clientcmd.ClientConfigLoadingRules {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.ExplicitPath = kubeconfig
+	}
+	return rules
+}
+
+// ListContexts returns the context names of kubeconfig, and the current context
+func ListContexts(kubeconfig string) ([]string, string, error) {
+	raw, err := loadingRules(kubeconfig).Load()
+	if err != nil {
+		return nil, "", fmt.Errorf("load kubeconfig: %w", err)
+	}
+	names := make([]string, 0, len(raw.Contexts))
+	for name := range raw.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, raw.CurrentContext, nil
+}
+
 // Namespace returns the configured namespace.
 func (c *Client) Namespace() string {
 	return c.namespace
@@ -70,6 +141,9 @@ func (c *Client) Namespace() string {
 
 // ListPods returns pods matching the accelerboat app label in the configured namespace.
 func (c *Client) ListPods(ctx context.Context) (*corev1.PodList, error) {
+	if c.address != "" {
+		return &corev1.PodList{Items: []corev1.Pod{directPod(c.address)}}, nil
+	}
 	return c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: AccelerboatAppLabel,
 	})
@@ -77,100 +151,117 @@ func (c *Client) ListPods(ctx context.Context) (*corev1.PodList, error) {
 
 // GetConfigMap returns the named ConfigMap in the configured namespace.
 func (c *Client) GetConfigMap(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
 	return c.clientset.CoreV1().ConfigMaps(c.namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
 // PortForwardAndRequest runs a port-forward to the given pod/port, calls the given path with optional query,
-// and returns the response body. The port-forward is stopped when ctx is cancelled.
+// and returns the response body. The port-forward is reused by the later requests to the same pod.
 func (c *Client) PortForwardAndRequest(ctx context.Context, podName string, port int, path string, query url.Values) ([]byte, error) {
-	localPort, err := freeLocalPort()
-	if err != nil {
-		return nil, err
-	}
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-	readyCh := make(chan struct{})
-	errCh := make(chan error, 1)
-	go func() {
-		errCh <- c.portForward(ctx, podName, port, localPort, stopCh, readyCh)
-	}()
-	select {
-	case err := <-errCh:
-		if err != nil {
-			return nil, err
-		}
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-readyCh:
-	}
-	u := url.URL{
-		Scheme:   "http",
-		Host:     fmt.Sprintf("127.0.0.1:%d", localPort),
-		Path:     path,
-		RawQuery: query.Encode(),
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, u, err := c.get(ctx, podName, port, path, query)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("GET %s: %s: %s", u.String(), resp.Status, string(body))
+		return nil, fmt.Errorf("GET %s: %s: %s", u, resp.Status, string(body))
 	}
 	return io.ReadAll(resp.Body)
 }
 
 // PortForwardAndStream runs a port-forward and streams the response body to the given writer until context is done.
 func (c *Client) PortForwardAndStream(ctx context.Context, podName string, port int, path string, query url.Values, w io.Writer) error {
-	localPort, err := freeLocalPort()
+	resp, u, err := c.get(ctx, podName, port, path, query)
 	if err != nil {
 		return err
 	}
-	stopCh := make(chan struct{})
-	defer close(stopCh)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("GET %s: %s: %s", u, resp.Status, string(body))
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *Client) get(ctx context.Context, podName string, port int, path string, query url.Values) (
+	*http.Response, string, error) {
+	baseURL, _, err := c.PortForward(ctx, podName, port)
+	if err != nil {
+		return nil, "", err
+	}
+	u := baseURL + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp, u, nil
+}
+
+// PortForward runs a port-forward to the given pod/port and returns the local base URL (e.g. http://127.0.0.1:port).
+// The port-forward is reused by the requests to the same pod until Close, the returned stop func is kept for
+// compatibility and does nothing. The address of client is returned directly if set.
+func (c *Client) PortForward(ctx context.Context, podName string, port int) (string, func(), error) {
+	if c.address != "" {
+		return c.address, func() {}, nil
+	}
+	key := fmt.Sprintf("%s:%d", podName, port)
+	c.forwardsLock.Lock()
+	defer c.forwardsLock.Unlock()
+	if f, ok := c.forwards[key]; ok {
+		select {
+		case <-f.done:
+			delete(c.forwards, key)
+		default:
+			return f.baseURL, func() {}, nil
+		}
+	}
+	localPort, err := freeLocalPort()
+	if err != nil {
+		return "", nil, err
+	}
+	f := &forward{
+		baseURL: fmt.Sprintf("http://127.0.0.1:%d", localPort),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
 	readyCh := make(chan struct{})
 	errCh := make(chan error, 1)
 	go func() {
-		errCh <- c.portForward(ctx, podName, port, localPort, stopCh, readyCh)
+		defer close(f.done)
+		// the forward outlives the request, it is stopped by Close
+		errCh <- c.portForward(context.Background(), podName, port, localPort, f.stopCh, readyCh)
 	}()
 	select {
-	case err := <-errCh:
-		if err != nil {
-			return err
+	case err = <-errCh:
+		close(f.stopCh)
+		if err == nil {
+			err = fmt.Errorf("port-forward to pod %s exited", podName)
 		}
+		return "", nil, err
 	case <-ctx.Done():
-		return ctx.Err()
+		close(f.stopCh)
+		return "", nil, ctx.Err()
 	case <-readyCh:
 	}
-	u := url.URL{
-		Scheme:   "http",
-		Host:     fmt.Sprintf("127.0.0.1:%d", localPort),
-		Path:     path,
-		RawQuery: query.Encode(),
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
-	if err != nil {
-		return err
-	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("GET %s: %s: %s", u.String(), resp.Status, string(body))
-	}
-	_, err = io.Copy(w, resp.Body)
-	return err
+	c.forwards[key] = f
+	return f.baseURL, func() {}, nil
 }
 
 func (c *Client) portForward(ctx context.Context, podName string, remotePort, localPort int, stopCh chan struct{}, readyCh chan struct{}) error {
+	if err := c.requireCluster(); err != nil {
+		return err
+	}
 	roundTripper, upgrader, err := spdy.RoundTripperFor(c.config)
 	if err != nil {
 		return err
@@ -200,8 +291,21 @@ func (c *Client) portForward(ctx context.Context, podName string, remotePort, lo
 	}
 }
 
+// directPod returns the pod standing for the address of direct client
+func directPod(address string) corev1.Pod {
+	pod := corev1.Pod{}
+	pod.Name = strings.TrimPrefix(strings.TrimPrefix(address, "http://"), "https://")
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	return pod
+}
+
 // GetPod finds a pod by name (or unique prefix) in the accelerboat namespace. Name can be full pod name or instance id (e.g. accelerboat-0).
 func (c *Client) GetPod(ctx context.Context, name string) (*corev1.Pod, error) {
+	if c.address != "" {
+		pod := directPod(c.address)
+		return &pod, nil
+	}
 	if name == "" {
 		return nil, fmt.Errorf("pod name is required")
 	}
@@ -277,6 +381,9 @@ func freeLocalPort() (int, error) {
 
 // ListNodeNames returns the names of all nodes in the cluster.
 func (c *Client) ListNodeNames(ctx context.Context) ([]string, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
 	list, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("list nodes: %w", err)
@@ -290,6 +397,9 @@ func (c *Client) ListNodeNames(ctx context.Context) ([]string, error) {
 
 // ListWorkerNodeNames returns the names of worker nodes only (master/control-plane nodes excluded).
 func (c *Client) ListWorkerNodeNames(ctx context.Context) ([]string, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
 	list, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("list nodes: %w", err)
@@ -310,21 +420,33 @@ func (c *Client) ListWorkerNodeNames(ctx context.Context) ([]string, error) {
 
 // CreateJob creates a Job in the configured namespace.
 func (c *Client) CreateJob(ctx context.Context, job *batchv1.Job) (*batchv1.Job, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
 	return c.clientset.BatchV1().Jobs(c.namespace).Create(ctx, job, metav1.CreateOptions{})
 }
 
 // ListJobs returns Jobs in the configured namespace matching the label selector.
 func (c *Client) ListJobs(ctx context.Context, labelSelector string) (*batchv1.JobList, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
 	return c.clientset.BatchV1().Jobs(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
 }
 
 // GetJob returns the named Job in the configured namespace.
 func (c *Client) GetJob(ctx context.Context, name string) (*batchv1.Job, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
 	return c.clientset.BatchV1().Jobs(c.namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
 // DeleteJob deletes the named Job in the configured namespace and its dependent Pods (cascading delete).
 func (c *Client) DeleteJob(ctx context.Context, name string) error {
+	if err := c.requireCluster(); err != nil {
+		return err
+	}
 	propagation := metav1.DeletePropagationBackground
 	return c.clientset.BatchV1().Jobs(c.namespace).Delete(ctx, name, metav1.DeleteOptions{
 		PropagationPolicy: &propagation,
@@ -333,15 +455,24 @@ func (c *Client) DeleteJob(ctx context.Context, name string) error {
 
 // ListPodsBySelector returns pods in the configured namespace matching the label selector.
 func (c *Client) ListPodsBySelector(ctx context.Context, labelSelector string) (*corev1.PodList, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
 	return c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
 }
 
 // DeletePod deletes the named Pod in the configured namespace.
 func (c *Client) DeletePod(ctx context.Context, name string) error {
+	if err := c.requireCluster(); err != nil {
+		return err
+	}
 	return c.clientset.CoreV1().Pods(c.namespace).Delete(ctx, name, metav1.DeleteOptions{})
 }
 
 // ListEvents returns events in the configured namespace for the given field selector (e.g. involvedObject.name=pod-name).
 func (c *Client) ListEvents(ctx context.Context, fieldSelector string) (*corev1.EventList, error) {
+	if err := c.requireCluster(); err != nil {
+		return nil, err
+	}
 	return c.clientset.CoreV1().Events(c.namespace).List(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
 }
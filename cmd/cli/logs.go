@@ -0,0 +1,197 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+)
+
+const (
+	customapiLogs = "/customapi/logs"
+	// logTimeLayout the time layout at the beginning of log line
+	logTimeLayout = "2006-01-02 15:04:05.000"
+)
+
+// NewLogsCmd returns the command that shows the accelerboat.log of one or all pods.
+func NewLogsCmd() *cobra.Command {
+	var (
+		instanceID string
+		all        bool
+		follow     bool
+		tail       int
+		grep       string
+	)
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Get the logs of one instance or all instances via port-forward",
+		Long: "Show the accelerboat.log of the pod given by --instance-id (the master or any ready pod if not " +
+			"given), or of all running pods with --all. " +
+			"The lines of multiple pods are merged by time and prefixed with the pod name.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if instanceID != "" && all {
+				return fmt.Errorf("--instance-id (-i) and --all cannot be used together")
+			}
+			ctx := context.Background()
+			if follow {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				sigCh := make(chan os.Signal, 1)
+				signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+				go func() {
+					<-sigCh
+					cancel()
+				}()
+				defer cancel()
+			}
+			client, err := newKubeClient()
+			if err != nil {
+				return err
+			}
+			var pods []corev1.Pod
+			if all {
+				pods, err = selectPods(ctx, client, "")
+			} else {
+				var pod *corev1.Pod
+				if pod, err = selectPod(ctx, client, instanceID); err == nil {
+					pods = []corev1.Pod{*pod}
+				}
+			}
+			if err != nil {
+				return err
+			}
+			query := url.Values{}
+			query.Set("limit", strconv.Itoa(tail))
+			if grep != "" {
+				query.Set("grep", grep)
+			}
+			if follow {
+				query.Set("follow", "true")
+				return streamLogs(ctx, client, pods, query, all)
+			}
+			return printLogs(ctx, client, pods, query, all)
+		},
+	}
+	cmd.Flags().StringVarP(&instanceID, "instance-id", "i", "", "Instance (pod) ID (optional; default: master or any ready pod)")
+	cmd.Flags().BoolVar(&all, "all", false, "Get the logs of all running pods")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Stream logs (like kubectl logs -f)")
+	cmd.Flags().IntVar(&tail, "tail", defaultTail, "Number of recent lines to fetch of every pod")
+	cmd.Flags().StringVar(&grep, "grep", "", "Filter lines by substring")
+	return cmd
+}
+
+// logLine is the log line with the pod and the time parsed from it
+type logLine struct {
+	pod  string
+	time time.Time
+	text string
+}
+
+// printLogs prints the logs of pods, the lines of multiple pods are merged by time
+func printLogs(ctx context.Context, client *kube.Client, pods []corev1.Pod, query url.Values, prefix bool) error {
+	lines := make([]*logLine, 0)
+	for i := range pods {
+		body, err := client.PortForwardAndRequest(ctx, pods[i].Name, kube.HTTPPortNumber, customapiLogs, query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+			continue
+		}
+		var last time.Time
+		for _, text := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+			if text == "" {
+				continue
+			}
+			// the lines without time (e.g. stack traces) follow the previous line
+			if len(text) >= len(logTimeLayout) {
+				if t, err := time.ParseInLocation(logTimeLayout, text[:len(logTimeLayout)], time.Local); err == nil {
+					last = t
+				}
+			}
+			lines = append(lines, &logLine{pod: pods[i].Name, time: last, text: text})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].time.Before(lines[j].time)
+	})
+	for _, line := range lines {
+		if prefix {
+			fmt.Fprintf(os.Stdout, "[%s] %s\n", line.pod, line.text)
+		} else {
+			fmt.Fprintln(os.Stdout, line.text)
+		}
+	}
+	return nil
+}
+
+// streamLogs streams the logs of pods concurrently, the lines are written as they arrive
+func streamLogs(ctx context.Context, client *kube.Client, pods []corev1.Pod, query url.Values, prefix bool) error {
+	if !prefix {
+		return client.PortForwardAndStream(ctx, pods[0].Name, kube.HTTPPortNumber, customapiLogs, query, os.Stdout)
+	}
+	out := &syncWriter{w: os.Stdout}
+	wg := &sync.WaitGroup{}
+	for i := range pods {
+		wg.Add(1)
+		go func(pod string) {
+			defer wg.Done()
+			w := &linePrefixWriter{out: out, prefix: "[" + pod + "] "}
+			if err := client.PortForwardAndStream(ctx, pod, kube.HTTPPortNumber, customapiLogs, query,
+				w); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pod, err.Error())
+			}
+		}(pods[i].Name)
+	}
+	wg.Wait()
+	return nil
+}
+
+// syncWriter serializes the writes of multiple streams
+type syncWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.w.Write(p)
+}
+
+// linePrefixWriter writes the complete lines with prefix, the incomplete line is buffered until the rest
+type linePrefixWriter struct {
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (l *linePrefixWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		idx := bytes.IndexByte(l.buf, '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+		if _, err := l.out.Write([]byte(l.prefix + string(l.buf[:idx+1]))); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[idx+1:]
+	}
+}
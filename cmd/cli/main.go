@@ -5,12 +5,17 @@
 package main
 
 import (
+	"net/http"
 	"os"
 )
 
 func main() {
+	http.DefaultClient.Transport = serverVersions
 	root := NewRootCmd()
-	if err := root.Execute(); err != nil {
+	err := root.Execute()
+	closeKubeClient()
+	warnVersionSkew()
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,422 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package manifests renders the Kubernetes objects of accelerboat the same as the helm chart
+// charts/accelerboat, so that accelerboat can be deployed by the CLI without helm.
+package manifests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Name is the name of the workload, service and RBAC objects, the same as fullnameOverride of chart
+	Name = "accelerboat"
+	// ConfigMapName is the name of ConfigMap mounted by the workload
+	ConfigMapName = "accelerboat-config"
+	// ConfigMapKey is the key of config in ConfigMap
+	ConfigMapKey = "accelerboat.json"
+	// ConfigChecksumAnnotation is the pod annotation to roll the pods on config change
+	ConfigChecksumAnnotation = "checksum/config"
+
+	managedBy  = "accelerboat-cli"
+	configDir  = "/data/workspace/config"
+	hostVolume = "host-volume"
+)
+
+// Manifests are the objects of one accelerboat deployment, only one of DaemonSet and Deployment is set
+// by the runtime
+type Manifests struct {
+	ServiceAccount     *corev1.ServiceAccount
+	Role               *rbacv1.Role
+	RoleBinding        *rbacv1.RoleBinding
+	ClusterRole        *rbacv1.ClusterRole
+	ClusterRoleBinding *rbacv1.ClusterRoleBinding
+	ConfigMap          *corev1.ConfigMap
+	Service            *corev1.Service
+	DaemonSet          *appsv1.DaemonSet
+	Deployment         *appsv1.Deployment
+}
+
+// Objects returns the objects in the order of applying
+func (m *Manifests) Objects() []runtime.Object {
+	result := []runtime.Object{m.ServiceAccount, m.Role, m.RoleBinding, m.ClusterRole, m.ClusterRoleBinding,
+		m.ConfigMap, m.Service}
+	if m.DaemonSet != nil {
+		result = append(result, m.DaemonSet)
+	}
+	if m.Deployment != nil {
+		result = append(result, m.Deployment)
+	}
+	return result
+}
+
+// YAML returns the multi-document yaml of the objects
+func (m *Manifests) YAML() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, obj := range m.Objects() {
+		bs, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(bs)
+	}
+	return buf.Bytes(), nil
+}
+
+// SetConfig replaces the config of ConfigMap (e.g. with the existing one on upgrade), the checksum
+// annotation of pods is updated accordingly
+func (m *Manifests) SetConfig(data string) {
+	m.ConfigMap.Data[ConfigMapKey] = data
+	template := m.podTemplate()
+	template.Annotations[ConfigChecksumAnnotation] = checksum(data)
+}
+
+// SetSelector replaces the selector of workload and service (e.g. with the existing immutable one of
+// workload installed by helm), the pods are labeled with it
+func (m *Manifests) SetSelector(selector *metav1.LabelSelector) {
+	if selector == nil {
+		return
+	}
+	template := m.podTemplate()
+	for k, v := range selector.MatchLabels {
+		template.Labels[k] = v
+	}
+	if m.DaemonSet != nil {
+		m.DaemonSet.Spec.Selector = selector
+	}
+	if m.Deployment != nil {
+		m.Deployment.Spec.Selector = selector
+	}
+	m.Service.Spec.Selector = selector.MatchLabels
+}
+
+func (m *Manifests) podTemplate() *corev1.PodTemplateSpec {
+	if m.DaemonSet != nil {
+		return &m.DaemonSet.Spec.Template
+	}
+	return &m.Deployment.Spec.Template
+}
+
+// Render renders the objects of values in namespace, a new self-signed localhost cert is generated into
+// the config for the HTTPS server
+func Render(v *Values, namespace string) (*Manifests, error) {
+	if err := v.Validate(); err != nil {
+		return nil, err
+	}
+	data, err := renderConfig(v, namespace)
+	if err != nil {
+		return nil, err
+	}
+	selectorLabels := map[string]string{
+		"app.kubernetes.io/name":     Name,
+		"app.kubernetes.io/instance": Name,
+	}
+	labels := map[string]string{
+		"app.kubernetes.io/version":    v.Image.Tag,
+		"app.kubernetes.io/managed-by": managedBy,
+	}
+	for k, val := range selectorLabels {
+		labels[k] = val
+	}
+	meta := func(name string, namespaced bool) metav1.ObjectMeta {
+		om := metav1.ObjectMeta{Name: name, Labels: copyLabels(labels)}
+		if namespaced {
+			om.Namespace = namespace
+		}
+		return om
+	}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: Name, Namespace: namespace}}
+	readVerbs := []string{"get", "watch", "list"}
+	m := &Manifests{
+		ServiceAccount: &corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: meta(Name, true),
+		},
+		Role: &rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+			ObjectMeta: meta(Name, true),
+			Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"endpoints"}, Verbs: readVerbs},
+			},
+		},
+		RoleBinding: &rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: meta(Name, true),
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: Name},
+			Subjects:   subjects,
+		},
+		ClusterRole: &rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			ObjectMeta: meta(Name, false),
+			Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: readVerbs},
+			},
+		},
+		ClusterRoleBinding: &rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: meta(Name, false),
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: Name},
+			Subjects:   subjects,
+		},
+		ConfigMap: &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: meta(ConfigMapName, true),
+			Data:       map[string]string{ConfigMapKey: data},
+		},
+		Service: &corev1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: meta(Name, true),
+			Spec: corev1.ServiceSpec{
+				Type: corev1.ServiceTypeClusterIP,
+				Ports: []corev1.ServicePort{
+					servicePort("http", v.Env.HTTPPort),
+					servicePort("https", v.Env.HTTPSPort),
+					servicePort("torrent", v.Env.TorrentPort),
+				},
+				Selector: copyLabels(selectorLabels),
+			},
+		},
+	}
+	template := podTemplate(v, labels, data)
+	selector := &metav1.LabelSelector{MatchLabels: copyLabels(selectorLabels)}
+	if v.Runtime == RuntimeStandalone {
+		maxUnavailable := intstr.FromString("100%")
+		m.DaemonSet = &appsv1.DaemonSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "DaemonSet"},
+			ObjectMeta: meta(Name, true),
+			Spec: appsv1.DaemonSetSpec{
+				Selector: selector,
+				Template: template,
+				UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
+					Type:          appsv1.RollingUpdateDaemonSetStrategyType,
+					RollingUpdate: &appsv1.RollingUpdateDaemonSet{MaxUnavailable: &maxUnavailable},
+				},
+			},
+		}
+	} else {
+		replicas := v.Replicas
+		m.Deployment = &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: meta(Name, true),
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: selector,
+				Template: template,
+			},
+		}
+	}
+	return m, nil
+}
+
+func podTemplate(v *Values, labels map[string]string, data string) corev1.PodTemplateSpec {
+	volumes := []corev1.Volume{{
+		Name: "config",
+		VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: ConfigMapName},
+		}},
+	}}
+	mounts := []corev1.VolumeMount{{Name: "config", MountPath: configDir}}
+	if v.Runtime == RuntimeStandalone {
+		hostPathType := corev1.HostPathDirectoryOrCreate
+		volumes = append(volumes, corev1.Volume{
+			Name: hostVolume,
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+				Path: v.HostPath, Type: &hostPathType,
+			}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: hostVolume, MountPath: v.HostPath})
+	}
+	probe := func(path string, period int32) *corev1.Probe {
+		return &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path: path, Port: intstr.FromString("http"),
+			}},
+			InitialDelaySeconds: 5,
+			PeriodSeconds:       period,
+			TimeoutSeconds:      3,
+			SuccessThreshold:    1,
+			FailureThreshold:    3,
+		}
+	}
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      copyLabels(labels),
+			Annotations: map[string]string{ConfigChecksumAnnotation: checksum(data)},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: Name,
+			Containers: []corev1.Container{{
+				Name:            Name,
+				Image:           v.Image.Repository + ":" + v.Image.Tag,
+				ImagePullPolicy: corev1.PullPolicy(v.Image.PullPolicy),
+				Command:         []string{"/data/workspace/accelerboat"},
+				Args:            []string{"-f", configDir + "/" + ConfigMapKey},
+				Env: []corev1.EnvVar{{
+					Name: "localIP",
+					ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{
+						APIVersion: "v1", FieldPath: "status.podIP",
+					}},
+				}},
+				Ports: []corev1.ContainerPort{
+					{Name: "http", ContainerPort: v.Env.HTTPPort},
+					{Name: "https", ContainerPort: v.Env.HTTPSPort},
+					{Name: "torrent", ContainerPort: v.Env.TorrentPort},
+				},
+				LivenessProbe:  probe("/customapi/recorder", 5),
+				ReadinessProbe: probe("/customapi/readiness", 10),
+				VolumeMounts:   mounts,
+			}},
+			Volumes:       volumes,
+			RestartPolicy: corev1.RestartPolicyAlways,
+			HostNetwork:   true,
+			DNSPolicy:     corev1.DNSClusterFirstWithHostNet,
+		},
+	}
+}
+
+func servicePort(name string, port int32) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:       name,
+		Port:       port,
+		TargetPort: intstr.FromString(name),
+		Protocol:   corev1.ProtocolTCP,
+	}
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels))
+	for k, v := range labels {
+		result[k] = v
+	}
+	return result
+}
+
+func checksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// config is the accelerboat.json rendered by the CLI, the options not set use the defaults of accelerboat
+type config struct {
+	HTTPPort    int32 `json:"httpPort"`
+	HTTPSPort   int32 `json:"httpsPort"`
+	TorrentPort int32 `json:"torrentPort"`
+	LogConfig   struct {
+		LogDir string `json:"logDir"`
+	} `json:"logConfig"`
+	StorageConfig struct {
+		DownloadPath   string `json:"downloadPath"`
+		TorrentPath    string `json:"torrentPath"`
+		TransferPath   string `json:"transferPath"`
+		SmallFilePath  string `json:"smallFilePath"`
+		OCIPath        string `json:"ociPath"`
+		EventFile      string `json:"eventFile"`
+		RedisQueueFile string `json:"redisQueueFile"`
+	} `json:"storageConfig"`
+	ServiceDiscovery struct {
+		ServiceNamespace string `json:"serviceNamespace"`
+		ServiceName      string `json:"serviceName"`
+	} `json:"serviceDiscovery"`
+	ExternalConfig struct {
+		BuiltInCerts     map[string]*keyCert      `json:"builtInCerts"`
+		RegistryMappings []map[string]interface{} `json:"registryMappings"`
+	} `json:"externalConfig"`
+}
+
+// keyCert is the base64 encoded PEM cert and key
+type keyCert struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+func renderConfig(v *Values, namespace string) (string, error) {
+	cfg := &config{
+		HTTPPort:    v.Env.HTTPPort,
+		HTTPSPort:   v.Env.HTTPSPort,
+		TorrentPort: v.Env.TorrentPort,
+	}
+	cfg.LogConfig.LogDir = v.Env.LogDir
+	cfg.StorageConfig.DownloadPath = v.Env.DownloadPath
+	cfg.StorageConfig.TorrentPath = v.Env.TorrentPath
+	cfg.StorageConfig.TransferPath = v.Env.TransferPath
+	cfg.StorageConfig.SmallFilePath = v.Env.SmallFilePath
+	cfg.StorageConfig.OCIPath = v.Env.OCIPath
+	cfg.StorageConfig.EventFile = v.Env.EventFile
+	cfg.StorageConfig.RedisQueueFile = v.Env.RedisQueueFile
+	cfg.ServiceDiscovery.ServiceNamespace = namespace
+	cfg.ServiceDiscovery.ServiceName = Name
+	cert, err := localhostCert()
+	if err != nil {
+		return "", err
+	}
+	cfg.ExternalConfig.BuiltInCerts = map[string]*keyCert{"localhost": cert}
+	cfg.ExternalConfig.RegistryMappings = v.ExternalConfig.RegistryMappings
+	if cfg.ExternalConfig.RegistryMappings == nil {
+		cfg.ExternalConfig.RegistryMappings = make([]map[string]interface{}, 0)
+	}
+	bs, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal config: %w", err)
+	}
+	return string(bs), nil
+}
+
+// localhostCert generates the self-signed cert of localhost, which is the default cert of HTTPS server
+func localhostCert() (*keyCert, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost", Organization: []string{"localhost"}},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate: %w", err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal key: %w", err)
+	}
+	return &keyCert{
+		Cert: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Key:  base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})),
+	}, nil
+}
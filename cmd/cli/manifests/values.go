@@ -0,0 +1,196 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package manifests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// RuntimeStandalone deploys accelerboat as DaemonSet with the host path storage
+	RuntimeStandalone = "standalone"
+	// RuntimeServerless deploys accelerboat as Deployment for the clusters without the concept of nodes
+	RuntimeServerless = "serverless"
+)
+
+// Values is the subset of the values of helm chart charts/accelerboat that the CLI renders, so that the
+// values file of chart can be used by the CLI directly.
+type Values struct {
+	Image          ImageValues    `yaml:"image"`
+	Runtime        string         `yaml:"runtime"`
+	Replicas       int32          `yaml:"replicas"`
+	HostPath       string         `yaml:"hostPath"`
+	Env            EnvValues      `yaml:"env"`
+	ExternalConfig ExternalValues `yaml:"externalConfig"`
+}
+
+// ImageValues defines the image of accelerboat
+type ImageValues struct {
+	Repository string `yaml:"repository"`
+	Tag        string `yaml:"tag"`
+	PullPolicy string `yaml:"pullPolicy"`
+}
+
+// EnvValues defines the ports and storage paths of accelerboat
+type EnvValues struct {
+	HTTPPort       int32  `yaml:"httpPort"`
+	HTTPSPort      int32  `yaml:"httpsPort"`
+	TorrentPort    int32  `yaml:"torrentPort"`
+	LogDir         string `yaml:"logDir"`
+	DownloadPath   string `yaml:"downloadPath"`
+	TransferPath   string `yaml:"transferPath"`
+	SmallFilePath  string `yaml:"smallFilePath"`
+	OCIPath        string `yaml:"ociPath"`
+	TorrentPath    string `yaml:"torrentPath"`
+	EventFile      string `yaml:"eventFile"`
+	RedisQueueFile string `yaml:"redisQueueFile"`
+}
+
+// ExternalValues defines the registry mappings, they are written to the config without modification
+type ExternalValues struct {
+	RegistryMappings []map[string]interface{} `yaml:"registryMappings"`
+}
+
+// DefaultValues returns the default values, the same as the values.yaml of chart
+func DefaultValues() *Values {
+	return &Values{
+		Image: ImageValues{
+			Repository: "accelerboat/accelerboat",
+			Tag:        "v0.1.0",
+			PullPolicy: "IfNotPresent",
+		},
+		Runtime:  RuntimeStandalone,
+		Replicas: 1,
+		HostPath: "/data/accelerboat",
+		Env: EnvValues{
+			HTTPPort:       2080,
+			HTTPSPort:      2081,
+			TorrentPort:    2082,
+			LogDir:         "/data/accelerboat/logs",
+			DownloadPath:   "/data/accelerboat/storage",
+			TransferPath:   "/data/accelerboat/transfer",
+			SmallFilePath:  "/data/accelerboat/smallfile",
+			OCIPath:        "/data/accelerboat/oci",
+			TorrentPath:    "/data/accelerboat/torrent",
+			EventFile:      "/data/accelerboat/accelerboat.event",
+			RedisQueueFile: "/data/accelerboat/redis-queue.json",
+		},
+	}
+}
+
+// LoadFile overrides the values with the values file (e.g. the values.yaml of chart), the keys not
+// rendered by the CLI are ignored
+func (v *Values) LoadFile(file string) error {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("read values file '%s': %w", file, err)
+	}
+	if err = yaml.Unmarshal(bs, v); err != nil {
+		return fmt.Errorf("unmarshal values file '%s': %w", file, err)
+	}
+	return nil
+}
+
+// Set overrides the value of key with the key path of chart values, e.g. env.httpPort=2080
+func (v *Values) Set(key, value string) error {
+	strValues := map[string]*string{
+		"image.repository":   &v.Image.Repository,
+		"image.tag":          &v.Image.Tag,
+		"image.pullPolicy":   &v.Image.PullPolicy,
+		"runtime":            &v.Runtime,
+		"hostPath":           &v.HostPath,
+		"env.logDir":         &v.Env.LogDir,
+		"env.downloadPath":   &v.Env.DownloadPath,
+		"env.transferPath":   &v.Env.TransferPath,
+		"env.smallFilePath":  &v.Env.SmallFilePath,
+		"env.ociPath":        &v.Env.OCIPath,
+		"env.torrentPath":    &v.Env.TorrentPath,
+		"env.eventFile":      &v.Env.EventFile,
+		"env.redisQueueFile": &v.Env.RedisQueueFile,
+	}
+	intValues := map[string]*int32{
+		"replicas":        &v.Replicas,
+		"env.httpPort":    &v.Env.HTTPPort,
+		"env.httpsPort":   &v.Env.HTTPSPort,
+		"env.torrentPort": &v.Env.TorrentPort,
+	}
+	if p, ok := strValues[key]; ok {
+		*p = value
+		return nil
+	}
+	if p, ok := intValues[key]; ok {
+		i, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("value of '%s' is not integer: %w", key, err)
+		}
+		*p = int32(i)
+		return nil
+	}
+	return fmt.Errorf("unsupported key '%s'", key)
+}
+
+// AddRegistry adds the enabled registry mapping from the proxy host to original host
+func (v *Values) AddRegistry(proxyHost, originalHost string) {
+	v.ExternalConfig.RegistryMappings = append(v.ExternalConfig.RegistryMappings, map[string]interface{}{
+		"enable":       true,
+		"proxyHost":    proxyHost,
+		"originalHost": originalHost,
+	})
+}
+
+// LoadConfig overrides the ports and storage paths with the existing accelerboat.json, so that the
+// workload and service upgraded are consistent with the config kept
+func (v *Values) LoadConfig(data string) error {
+	cfg := &config{}
+	if err := json.Unmarshal([]byte(data), cfg); err != nil {
+		return fmt.Errorf("unmarshal config: %w", err)
+	}
+	if cfg.HTTPPort != 0 {
+		v.Env.HTTPPort = cfg.HTTPPort
+	}
+	if cfg.HTTPSPort != 0 {
+		v.Env.HTTPSPort = cfg.HTTPSPort
+	}
+	if cfg.TorrentPort != 0 {
+		v.Env.TorrentPort = cfg.TorrentPort
+	}
+	return nil
+}
+
+// Validate checks the values before rendering
+func (v *Values) Validate() error {
+	if v.Runtime != RuntimeStandalone && v.Runtime != RuntimeServerless {
+		return fmt.Errorf("runtime '%s' is not one of [%s, %s]", v.Runtime, RuntimeStandalone, RuntimeServerless)
+	}
+	if v.Image.Repository == "" || v.Image.Tag == "" {
+		return fmt.Errorf("image repository and tag cannot be empty")
+	}
+	for key, port := range map[string]int32{
+		"env.httpPort": v.Env.HTTPPort, "env.httpsPort": v.Env.HTTPSPort, "env.torrentPort": v.Env.TorrentPort,
+	} {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("%s %d is not a valid port", key, port)
+		}
+	}
+	if v.Env.HTTPPort == v.Env.HTTPSPort || v.Env.HTTPPort == v.Env.TorrentPort ||
+		v.Env.HTTPSPort == v.Env.TorrentPort {
+		return fmt.Errorf("httpPort, httpsPort and torrentPort must be different")
+	}
+	if v.Runtime == RuntimeStandalone && !strings.HasPrefix(v.HostPath, "/") {
+		return fmt.Errorf("hostPath '%s' must be absolute", v.HostPath)
+	}
+	for _, mp := range v.ExternalConfig.RegistryMappings {
+		if mp["proxyHost"] == nil || mp["originalHost"] == nil {
+			return fmt.Errorf("registry mapping must have proxyHost and originalHost")
+		}
+	}
+	return nil
+}
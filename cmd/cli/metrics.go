@@ -6,7 +6,6 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"net/url"
 	"os"
 
@@ -26,15 +25,12 @@ func NewMetricsCmd() *cobra.Command {
 		Use:   "metrics",
 		Short: "Get metrics from an instance via port-forward to /customapi/metrics",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if instanceID == "" {
-				return fmt.Errorf("--instance-id (-i) is required")
-			}
 			ctx := context.Background()
-			client, err := kube.NewClient(effectiveKubeconfig(), effectiveNamespace())
+			client, err := newKubeClient()
 			if err != nil {
 				return err
 			}
-			pod, err := client.GetPod(ctx, instanceID)
+			pod, err := selectPod(ctx, client, instanceID)
 			if err != nil {
 				return err
 			}
@@ -50,7 +46,7 @@ func NewMetricsCmd() *cobra.Command {
 			return nil
 		},
 	}
-	cmd.Flags().StringVarP(&instanceID, "instance-id", "i", "", "Instance (pod) ID (required)")
+	cmd.Flags().StringVarP(&instanceID, "instance-id", "i", "", "Instance (pod) ID (optional; default: master or any ready pod)")
 	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json")
 	return cmd
 }
@@ -28,7 +28,7 @@ func NewNodesCmd() *cobra.Command {
 
 func runNodes(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
-	client, err := kube.NewClient(effectiveKubeconfig(), effectiveNamespace())
+	client, err := newKubeClient()
 	if err != nil {
 		return err
 	}
@@ -36,8 +36,9 @@ func runNodes(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	versions := podVersions(ctx, client, list.Items)
 	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "NAME\tREADY\tSTATUS\tRESTARTS\tAGE\tIP\tNODE")
+	fmt.Fprintln(tw, "NAME\tREADY\tSTATUS\tRESTARTS\tAGE\tIP\tNODE\tVERSION")
 	for i := range list.Items {
 		p := &list.Items[i]
 		ready := fmt.Sprintf("%d/%d", podReadyCount(p), len(p.Spec.Containers))
@@ -50,7 +51,7 @@ func runNodes(cmd *cobra.Command, args []string) error {
 		if node == "" {
 			node = "<none>"
 		}
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
 			p.Name,
 			ready,
 			string(p.Status.Phase),
@@ -58,11 +59,33 @@ func runNodes(cmd *cobra.Command, args []string) error {
 			age,
 			ip,
 			node,
+			orDash(versions[ip]),
 		)
 	}
 	return tw.Flush()
 }
 
+// podVersions returns the versions of pods by ip, they are reported by the heartbeats of nodes and
+// queried from any ready pod
+func podVersions(ctx context.Context, client *kube.Client, pods []corev1.Pod) map[string]string {
+	result := make(map[string]string)
+	for i := range pods {
+		if !podReady(&pods[i]) {
+			continue
+		}
+		resp, err := nodeVersions(ctx, client, pods[i].Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s | get versions failed: %s\n", pods[i].Name, err.Error())
+			return result
+		}
+		for _, n := range resp.Nodes {
+			result[n.Node] = n.Version
+		}
+		return result
+	}
+	return result
+}
+
 func podReadyCount(p *corev1.Pod) int {
 	var n int
 	for _, c := range p.Status.ContainerStatuses {
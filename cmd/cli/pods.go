@@ -0,0 +1,84 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+)
+
+// selectPod returns the pod given by instance, or selects the healthy pod automatically: the current master
+// is preferred, and any ready pod if the master is not known
+func selectPod(ctx context.Context, client *kube.Client, instance string) (*corev1.Pod, error) {
+	if instance != "" {
+		return client.GetPod(ctx, instance)
+	}
+	list, err := client.ListPods(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	ready := make([]*corev1.Pod, 0, len(list.Items))
+	for i := range list.Items {
+		if podReady(&list.Items[i]) {
+			ready = append(ready, &list.Items[i])
+		}
+	}
+	if len(ready) == 0 {
+		return nil, fmt.Errorf("no ready accelerboat pod in namespace %s", client.Namespace())
+	}
+	if len(ready) == 1 {
+		return ready[0], nil
+	}
+	master := currentMaster(ctx, client, ready[0].Name)
+	for _, pod := range ready {
+		if master != "" && (pod.Status.PodIP == master || pod.Status.HostIP == master) {
+			fmt.Fprintf(os.Stderr, "using master pod %s\n", pod.Name)
+			return pod, nil
+		}
+	}
+	fmt.Fprintf(os.Stderr, "using ready pod %s\n", ready[0].Name)
+	return ready[0], nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// currentMaster returns the IP of current master reported by the pod, empty if failed
+func currentMaster(ctx context.Context, client *kube.Client, podName string) string {
+	query := url.Values{}
+	query.Set("output", "json")
+	body, err := client.PortForwardAndRequest(ctx, podName, kube.HTTPPortNumber, customapiStats, query)
+	if err != nil {
+		return ""
+	}
+	stats := &struct {
+		Master string `json:"master"`
+	}{}
+	if err = json.Unmarshal(body, stats); err != nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(stats.Master)
+	if err != nil {
+		return stats.Master
+	}
+	return host
+}
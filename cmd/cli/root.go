@@ -11,6 +11,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/penglongli/accelerboat/cmd/cli/config"
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
 )
 
 const (
@@ -20,8 +21,14 @@ const (
 
 var (
 	globalKubeconfig string
+	globalContext    string
+	globalCluster    string
 	globalNamespace  string
+	globalAddress    string
 	configFilePath   string
+
+	// kubeClient is shared by the requests of one invocation, so that the port-forwards are reused
+	kubeClient *kube.Client
 )
 
 func expandPath(p string) string {
@@ -49,6 +56,28 @@ func effectiveKubeconfig() string {
 	return expandPath(defaultKubeconfig)
 }
 
+func effectiveContext() string {
+	if globalContext != "" {
+		return globalContext
+	}
+	cfg, _ := config.Load(configFilePath)
+	if cfg != nil {
+		return cfg.Context
+	}
+	return ""
+}
+
+func effectiveCluster() string {
+	if globalCluster != "" {
+		return globalCluster
+	}
+	cfg, _ := config.Load(configFilePath)
+	if cfg != nil {
+		return cfg.Cluster
+	}
+	return ""
+}
+
 func effectiveNamespace() string {
 	if globalNamespace != "" {
 		return globalNamespace
@@ -60,6 +89,31 @@ func effectiveNamespace() string {
 	return defaultNamespace
 }
 
+// newKubeClient returns the client of the effective kubeconfig, context, cluster and namespace
+func newKubeClient() (*kube.Client, error) {
+	if kubeClient != nil {
+		return kubeClient, nil
+	}
+	if globalAddress != "" {
+		kubeClient = kube.NewDirectClient(globalAddress, effectiveNamespace())
+		return kubeClient, nil
+	}
+	client, err := kube.NewClient(effectiveKubeconfig(), effectiveContext(), effectiveCluster(),
+		effectiveNamespace())
+	if err != nil {
+		return nil, err
+	}
+	kubeClient = client
+	return kubeClient, nil
+}
+
+// closeKubeClient stops the port-forwards of the shared client
+func closeKubeClient() {
+	if kubeClient != nil {
+		kubeClient.Close()
+	}
+}
+
 // NewRootCmd returns the root command with global flags and subcommands.
 func NewRootCmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -68,6 +122,9 @@ func NewRootCmd() *cobra.Command {
 		Long:  Logo(),
 	}
 	cmd.PersistentFlags().StringVar(&globalKubeconfig, "kubeconfig", "", "Path to kubeconfig file (default: ~/.kube/config or value from config file)")
+	cmd.PersistentFlags().StringVar(&globalContext, "context", "", "Kubeconfig context to use (default: current context or value from config file)")
+	cmd.PersistentFlags().StringVar(&globalCluster, "cluster", "", "Kubeconfig cluster to use, overrides the cluster of context (default: value from config file)")
+	cmd.PersistentFlags().StringVar(&globalAddress, "address", "", "Address of accelerboat (e.g. NodePort or Ingress) to request directly without port-forward")
 	cmd.PersistentFlags().StringVarP(&globalNamespace, "namespace", "n", "", "Default namespace (default: accelerboat or value from config file)")
 	cmd.PersistentFlags().StringVar(&configFilePath, "config-file", config.DefaultConfigPath(), "Path to accelerboat CLI config file")
 
@@ -78,9 +135,24 @@ func NewRootCmd() *cobra.Command {
 	cmd.AddCommand(NewMetricsCmd())
 	cmd.AddCommand(NewConfigCmd())
 	cmd.AddCommand(NewEventsCmd())
+	cmd.AddCommand(NewLogsCmd())
 	cmd.AddCommand(NewImagePreloadCmd())
 	cmd.AddCommand(NewImagePreloadCleanCmd())
 	cmd.AddCommand(NewImagesShowCmd())
+	cmd.AddCommand(NewImagesSeenCmd())
+	cmd.AddCommand(NewSavingsCmd())
+	cmd.AddCommand(NewExportCmd())
+	cmd.AddCommand(NewImportCmd())
+	cmd.AddCommand(NewUpstreamCmd())
+	cmd.AddCommand(NewTraceCmd())
+	cmd.AddCommand(NewTorrentsCmd())
+	cmd.AddCommand(NewStorageCmd())
+	cmd.AddCommand(NewInstallCmd())
+	cmd.AddCommand(NewUpgradeCmd())
+	cmd.AddCommand(NewDrainCmd())
+	cmd.AddCommand(NewUncordonCmd())
+	cmd.AddCommand(NewDebugCmd())
+	cmd.AddCommand(NewVersionCmd())
 
 	return cmd
 }
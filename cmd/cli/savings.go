@@ -0,0 +1,109 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils/formatutils"
+)
+
+const customapiSavings = "/customapi/savings"
+
+// NewSavingsCmd returns the command that reports the bytes and egress cost saved from original registries.
+func NewSavingsCmd() *cobra.Command {
+	var (
+		since        string
+		costPerGB    float64
+		daily        bool
+		outputFormat string
+	)
+	cmd := &cobra.Command{
+		Use:   "savings",
+		Short: "Report the bytes and egress cost saved from original registries",
+		Long: "Report the blob bytes downloaded from original registries compared with the bytes served to " +
+			"clients per registry, and the egress cost avoided. The traffic of all pods is accounted in the " +
+			"cache store per day(UTC) and needs savings enabled.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSavings(since, costPerGB, daily, outputFormat)
+		},
+	}
+	cmd.Flags().StringVar(&since, "since", "30d", "Report the traffic of the last N days, e.g. 30d")
+	cmd.Flags().Float64Var(&costPerGB, "cost-per-gb", 0, "Egress cost per GB to estimate with (default: "+
+		"savings.costPerGB of accelerboat)")
+	cmd.Flags().BoolVar(&daily, "daily", false, "Show the traffic of each day")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json")
+	return cmd
+}
+
+func runSavings(since string, costPerGB float64, daily bool, outputFormat string) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pods, err := selectPods(ctx, client, "")
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("since", since)
+	if costPerGB > 0 {
+		query.Set("costPerGB", strconv.FormatFloat(costPerGB, 'f', -1, 64))
+	}
+	// the traffic is in the cache store, any pod answers it
+	var body []byte
+	for i := range pods {
+		if body, err = client.PortForwardAndRequest(ctx, pods[i].Name, kube.HTTPPortNumber, customapiSavings,
+			query); err == nil {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("query savings: %w", err)
+	}
+	resp := &apitypes.SavingsResponse{}
+	if err = json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("unmarshal savings: %w", err)
+	}
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGISTRY\tORIGIN\tSERVED\tSAVED\tCOST AVOIDED")
+	for _, rs := range resp.Registries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t$%.2f\n", rs.Registry, formatutils.FormatSize(rs.OriginBytes),
+			formatutils.FormatSize(rs.ServedBytes), formatutils.FormatSize(rs.SavedBytes), rs.SavedCost)
+		if !daily {
+			continue
+		}
+		for _, d := range rs.Days {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t\t\n", d.Date, formatutils.FormatSize(d.OriginBytes),
+				formatutils.FormatSize(d.ServedBytes))
+		}
+	}
+	t := resp.Total
+	fmt.Fprintf(tw, "TOTAL\t%s\t%s\t%s\t$%.2f\n", formatutils.FormatSize(t.OriginBytes),
+		formatutils.FormatSize(t.ServedBytes), formatutils.FormatSize(t.SavedBytes), t.SavedCost)
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "\n%s ~ %s (UTC), $%.4f per GB\n", resp.Since, resp.Until, resp.CostPerGB)
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils/formatutils"
+)
+
+const customapiStorage = "/customapi/storage"
+
+// NewStorageCmd returns the command that inspects the storage directories of instances.
+func NewStorageCmd() *cobra.Command {
+	var (
+		instance     string
+		outputFormat string
+		top          int
+	)
+	cmd := &cobra.Command{
+		Use:   "storage",
+		Short: "Inspect the storage directories of instances without exec into pods",
+		Long: "Show the file counts and sizes of storage directories, the largest layers, the orphaned .part " +
+			"files and the sparse files of all running pods by default (or only the pod given by --instance).",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStorage(instance, outputFormat, top)
+		},
+	}
+	cmd.Flags().StringVarP(&instance, "instance", "i", "", "Pod name to query (optional; default: all running pods)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json")
+	cmd.Flags().IntVar(&top, "top", 10, "Number of the largest layers and sparse files to show")
+	return cmd
+}
+
+func runStorage(instance, outputFormat string, top int) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pods, err := selectPods(ctx, client, instance)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("top", strconv.Itoa(top))
+	result := make(map[string]*apitypes.StorageResponse)
+	for i := range pods {
+		body, err := client.PortForwardAndRequest(ctx, pods[i].Name, kube.HTTPPortNumber, customapiStorage, query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+			continue
+		}
+		storage := &apitypes.StorageResponse{}
+		if err = json.Unmarshal(body, storage); err != nil {
+			return fmt.Errorf("unmarshal storage of pod %s: %w", pods[i].Name, err)
+		}
+		result[pods[i].Name] = storage
+	}
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	for i := range pods {
+		if storage, ok := result[pods[i].Name]; ok {
+			printStorage(pods[i].Name, storage)
+		}
+	}
+	return nil
+}
+
+func printStorage(pod string, storage *apitypes.StorageResponse) {
+	fmt.Fprintf(os.Stdout, "=== %s ===\n\n", pod)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTORY\tPATH\tFILES\tSIZE\tALLOCATED\tERROR")
+	for _, d := range storage.Directories {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", d.Label, orDash(d.Path), d.Files,
+			formatutils.FormatSize(d.Size), formatutils.FormatSize(d.AllocatedSize), orDash(d.Error))
+	}
+	_ = tw.Flush()
+	printStorageFiles("Largest layers", storage.LargestLayers)
+	printStorageFiles("Orphaned .part files", storage.OrphanedParts)
+	printStorageFiles("Sparse files", storage.SparseFiles)
+	fmt.Fprintln(os.Stdout)
+}
+
+func printStorageFiles(title string, files []*apitypes.StorageFile) {
+	fmt.Fprintf(os.Stdout, "\n%s:\n", title)
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stdout, "  (none)")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  DIRECTORY\tSIZE\tALLOCATED\tMODIFIED\tPATH")
+	for _, f := range files {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", f.Label, formatutils.FormatSize(f.Size),
+			formatutils.FormatSize(f.AllocatedSize), f.ModTime.Format(time.RFC3339), f.Path)
+	}
+	_ = tw.Flush()
+}
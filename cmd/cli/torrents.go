@@ -0,0 +1,175 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const customapiTorrents = "/customapi/torrents"
+
+// NewTorrentsCmd returns the command that manages the torrents of pods.
+func NewTorrentsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "torrents",
+		Short: "List, drop or re-verify the torrents of instances",
+	}
+	cmd.AddCommand(newTorrentsListCmd())
+	cmd.AddCommand(newTorrentActionCmd("drop",
+		"Drop the torrent of layer, it is added again on the next download or serving of the layer"))
+	cmd.AddCommand(newTorrentActionCmd("verify",
+		"Re-verify the torrent data on disk, the pieces failed are downloaded from the swarm again"))
+	return cmd
+}
+
+// podTorrent is the torrent with the pod it is on
+type podTorrent struct {
+	Pod string `json:"pod"`
+	*apitypes.TorrentInfo
+}
+
+func newTorrentsListCmd() *cobra.Command {
+	var (
+		instance     string
+		outputFormat string
+	)
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the active torrents with completion and peer counts",
+		Long:  "List the torrents of all running pods by default (or only the pod given by --instance).",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTorrentsList(instance, outputFormat)
+		},
+	}
+	cmd.Flags().StringVarP(&instance, "instance", "i", "", "Pod name to query (optional; default: all running pods)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json")
+	return cmd
+}
+
+func runTorrentsList(instance, outputFormat string) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pods, err := selectPods(ctx, client, instance)
+	if err != nil {
+		return err
+	}
+	torrents := make([]*podTorrent, 0)
+	for i := range pods {
+		body, err := client.PortForwardAndRequest(ctx, pods[i].Name, kube.HTTPPortNumber, customapiTorrents,
+			url.Values{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+			continue
+		}
+		resp := &apitypes.TorrentListResponse{}
+		if err = json.Unmarshal(body, resp); err != nil {
+			return fmt.Errorf("unmarshal torrents of pod %s: %w", pods[i].Name, err)
+		}
+		for _, t := range resp.Torrents {
+			torrents = append(torrents, &podTorrent{Pod: pods[i].Name, TorrentInfo: t})
+		}
+	}
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(torrents)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tDIGEST\tINFOHASH\tSIZE\tPROGRESS\tSEEDING\tPEERS(ACTIVE/TOTAL)\tSEEDERS")
+	for _, t := range torrents {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.1f%%\t%t\t%d/%d\t%d\n", t.Pod, orDash(shortDigest(t.Digest)),
+			t.InfoHash, t.Size, t.Progress, t.Seeding, t.ActivePeers, t.TotalPeers, t.Seeders)
+	}
+	return tw.Flush()
+}
+
+func newTorrentActionCmd(action, short string) *cobra.Command {
+	var instance string
+	cmd := &cobra.Command{
+		Use:   action + " <digest>",
+		Short: short,
+		Long:  "The action is applied to all running pods by default (or only the pod given by --instance).",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTorrentAction(instance, args[0], action)
+		},
+	}
+	cmd.Flags().StringVarP(&instance, "instance", "i", "", "Pod name to apply (optional; default: all running pods)")
+	return cmd
+}
+
+func runTorrentAction(instance, digest, action string) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pods, err := selectPods(ctx, client, instance)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for i := range pods {
+		info, err := torrentAction(ctx, client, pods[i].Name, digest, action)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "  %s | %s %s | progress=%.1f%% peers=%d/%d\n", pods[i].Name, action,
+			info.Digest, info.Progress, info.ActivePeers, info.TotalPeers)
+	}
+	if failed != 0 {
+		return fmt.Errorf("%s torrent %s failed on %d/%d pod(s)", action, digest, failed, len(pods))
+	}
+	return nil
+}
+
+func torrentAction(ctx context.Context, client *kube.Client, podName, digest, action string) (
+	*apitypes.TorrentInfo, error) {
+	baseURL, stop, err := client.PortForward(ctx, podName, kube.HTTPPortNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s%s/%s:%s", baseURL, customapiTorrents, digest, action), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s torrent %s: %w", action, digest, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s torrent %s: %s: %s", action, digest, resp.Status, string(body))
+	}
+	result := &apitypes.TorrentInfo{}
+	if err = json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const customapiPullTimeline = "/customapi/pull-timeline"
+
+// traceEntry is the timeline entry with the pod it recorded on
+type traceEntry struct {
+	Pod string `json:"pod"`
+	*apitypes.PullTimelineEntry
+}
+
+// NewTraceCmd returns the command that shows the timeline of one image pull.
+func NewTraceCmd() *cobra.Command {
+	var (
+		instance     string
+		outputFormat string
+		window       string
+	)
+	cmd := &cobra.Command{
+		Use:   "trace <requestID>",
+		Short: "Show the timeline of one image pull correlated by request ID",
+		Long: "Collect the recorder events of the pull from all running pods by default (or only the pod given " +
+			"by --instance), including the events recorded by master for the same request, and show them " +
+			"ordered by time.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTrace(instance, args[0], window, outputFormat)
+		},
+	}
+	cmd.Flags().StringVarP(&instance, "instance", "i", "", "Pod name to query (optional; default: all running pods)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json")
+	cmd.Flags().StringVar(&window, "window", "", "Window to correlate the events of same image (default 10m)")
+	return cmd
+}
+
+func runTrace(instance, requestID, window, outputFormat string) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pods, err := selectPods(ctx, client, instance)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("requestID", requestID)
+	query.Set("output", "json")
+	if window != "" {
+		query.Set("window", window)
+	}
+	var image string
+	entries := make([]*traceEntry, 0)
+	for i := range pods {
+		body, err := client.PortForwardAndRequest(ctx, pods[i].Name, kube.HTTPPortNumber, customapiPullTimeline, query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+			continue
+		}
+		timeline := &apitypes.PullTimelineResponse{}
+		if err = json.Unmarshal(body, timeline); err != nil {
+			return fmt.Errorf("unmarshal timeline of pod %s: %w", pods[i].Name, err)
+		}
+		if image == "" && timeline.Repo != "" {
+			image = timeline.Registry + "/" + timeline.Repo
+			if timeline.Tag != "" {
+				image += ":" + timeline.Tag
+			}
+		}
+		for _, e := range timeline.Entries {
+			entries = append(entries, &traceEntry{Pod: pods[i].Name, PullTimelineEntry: e})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]interface{}{"image": image, "entries": entries})
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no events found for request %s", requestID)
+	}
+	printTrace(image, entries)
+	return nil
+}
+
+func printTrace(image string, entries []*traceEntry) {
+	start := entries[0].Timestamp
+	var end time.Time
+	for _, e := range entries {
+		if t := e.Timestamp.Add(time.Duration(e.DurationMs) * time.Millisecond); t.After(end) {
+			end = t
+		}
+	}
+	if image != "" {
+		fmt.Fprintf(os.Stdout, "Image:    %s\n", image)
+	}
+	fmt.Fprintf(os.Stdout, "Start:    %s\n", start.Format(time.RFC3339))
+	fmt.Fprintf(os.Stdout, "Duration: %.3fs\n\n", end.Sub(start).Seconds())
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OFFSET\tPOD\tTYPE\tSTATUS\tDIGEST\tMETHOD\tDURATION\tREQUEST-ID\tMESSAGE")
+	for _, e := range entries {
+		duration := "-"
+		if e.DurationMs != 0 {
+			duration = fmt.Sprintf("%.3fs", float64(e.DurationMs)/1000)
+		}
+		fmt.Fprintf(tw, "+%.3fs\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Timestamp.Sub(start).Seconds(), e.Pod,
+			e.Type, e.Status, orDash(shortDigest(e.Digest)), orDash(e.Method), duration, orDash(e.RequestID),
+			strings.ReplaceAll(e.Message, "\n", " "))
+	}
+	_ = tw.Flush()
+}
+
+// shortDigest returns the digest with the first 12 hex characters
+func shortDigest(digest string) string {
+	hex := strings.TrimPrefix(digest, "sha256:")
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
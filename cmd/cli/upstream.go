@@ -0,0 +1,217 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const customapiUpstreams = "/customapi/upstreams"
+
+// NewUpstreamCmd returns the command that enables/disables the registry mappings at runtime.
+func NewUpstreamCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upstream",
+		Short: "Enable or disable the upstream registry mappings at runtime",
+	}
+	cmd.AddCommand(newUpstreamSwitchCmd("enable", "Enable the registry mapping, requests are accelerated again"))
+	cmd.AddCommand(newUpstreamSwitchCmd("disable",
+		"Disable the registry mapping, requests are reversed to the original registry directly"))
+	cmd.AddCommand(newUpstreamHealthCmd())
+	return cmd
+}
+
+// podUpstreamHealth the probed health of upstreams reported by pod
+type podUpstreamHealth struct {
+	Pod    string                     `json:"pod"`
+	Health []*apitypes.UpstreamHealth `json:"health"`
+}
+
+func newUpstreamHealthCmd() *cobra.Command {
+	var (
+		instance     string
+		outputFormat string
+	)
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Show the probed health of the original hosts of registry mappings",
+		Long: "Every pod probes the /v2/ and token endpoints of the original hosts(and replicas) through its " +
+			"configured proxy, the health of all running pods is shown by default. Needs upstreamHealth enabled.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUpstreamHealth(instance, outputFormat)
+		},
+	}
+	cmd.Flags().StringVarP(&instance, "instance", "i", "", "Pod name to query (optional; default: all running pods)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json")
+	return cmd
+}
+
+func runUpstreamHealth(instance, outputFormat string) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pods, err := selectPods(ctx, client, instance)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("output", "json")
+	result := make([]*podUpstreamHealth, 0, len(pods))
+	for i := range pods {
+		body, err := client.PortForwardAndRequest(ctx, pods[i].Name, kube.HTTPPortNumber, customapiStats, query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+			continue
+		}
+		stats := &struct {
+			Upstreams []struct {
+				Health []*apitypes.UpstreamHealth `json:"health"`
+			} `json:"upstreams"`
+		}{}
+		if err = json.Unmarshal(body, stats); err != nil {
+			fmt.Fprintf(os.Stderr, "  %s | unmarshal stats failed: %s\n", pods[i].Name, err.Error())
+			continue
+		}
+		ph := &podUpstreamHealth{Pod: pods[i].Name, Health: make([]*apitypes.UpstreamHealth, 0)}
+		for _, u := range stats.Upstreams {
+			ph.Health = append(ph.Health, u.Health...)
+		}
+		result = append(result, ph)
+	}
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tREGISTRY\tHOST\tSTATUS\tV2\tTOKEN\tAVAILABILITY\tLAST PROBE\tLAST ERROR")
+	for _, ph := range result {
+		for _, h := range ph.Health {
+			status := "up"
+			if !h.Healthy {
+				status = "down"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%dms\t%dms\t%.0f%%\t%s\t%s\n", ph.Pod, h.Registry, h.Host, status,
+				h.V2LatencyMs, h.TokenLatencyMs, h.Availability*100, h.LastProbe.Format(time.RFC3339), h.LastError)
+		}
+	}
+	return tw.Flush()
+}
+
+func newUpstreamSwitchCmd(action, short string) *cobra.Command {
+	var instance string
+	cmd := &cobra.Command{
+		Use:   action + " <proxyHost>",
+		Short: short,
+		Long: "The change is applied to all running pods by default (or only the pod given by --instance), " +
+			"and persisted by each pod so it survives restarts and config reloads.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUpstreamSwitch(instance, args[0], action)
+		},
+	}
+	cmd.Flags().StringVarP(&instance, "instance", "i", "", "Pod name to apply (optional; default: all running pods)")
+	return cmd
+}
+
+func runUpstreamSwitch(instance, proxyHost, action string) error {
+	ctx := context.Background()
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	pods, err := selectPods(ctx, client, instance)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for i := range pods {
+		resp, err := switchUpstream(ctx, client, pods[i].Name, proxyHost, action)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  %s | failed: %s\n", pods[i].Name, err.Error())
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "  %s | %s -> %s | enable=%t\n", pods[i].Name, resp.ProxyHost,
+			resp.OriginalHost, resp.Enable)
+	}
+	if failed != 0 {
+		return fmt.Errorf("%s upstream %s failed on %d/%d pod(s)", action, proxyHost, failed, len(pods))
+	}
+	return nil
+}
+
+// selectPods returns the pod given by instance, or all running pods if instance is empty
+func selectPods(ctx context.Context, client *kube.Client, instance string) ([]corev1.Pod, error) {
+	if instance != "" {
+		pod, err := client.GetPod(ctx, instance)
+		if err != nil {
+			return nil, err
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+	list, err := client.ListPods(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	var pods []corev1.Pod
+	for i := range list.Items {
+		if list.Items[i].Status.Phase == corev1.PodRunning {
+			pods = append(pods, list.Items[i])
+		}
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no running accelerboat pod in namespace %s", client.Namespace())
+	}
+	return pods, nil
+}
+
+func switchUpstream(ctx context.Context, client *kube.Client, podName, proxyHost, action string) (
+	*apitypes.UpstreamSwitchResponse, error) {
+	baseURL, stop, err := client.PortForward(ctx, podName, kube.HTTPPortNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s%s/%s:%s", baseURL, customapiUpstreams, proxyHost, action), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s upstream %s: %w", action, proxyHost, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s upstream %s: %s: %s", action, proxyHost, resp.Status, string(body))
+	}
+	result := &apitypes.UpstreamSwitchResponse{}
+	if err = json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return result, nil
+}
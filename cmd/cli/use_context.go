@@ -0,0 +1,65 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/config"
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+)
+
+// NewUseContextCmd returns the command that saves the kubeconfig context (and cluster) into config file.
+func NewUseContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "use-context [context]",
+		Short: "Set default kubeconfig context in config file",
+		Long: "Saves the kubeconfig context (and the cluster given by --cluster) to the CLI config file, so " +
+			"the commands run against the cluster without switching KUBECONFIG. Global --context/--cluster " +
+			"still override at runtime. Lists the contexts of kubeconfig if no context given.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			contexts, current, err := kube.ListContexts(effectiveKubeconfig())
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				selected := effectiveContext()
+				if selected == "" {
+					selected = current
+				}
+				for _, name := range contexts {
+					mark := " "
+					if name == selected {
+						mark = "*"
+					}
+					fmt.Fprintf(os.Stdout, "%s %s\n", mark, name)
+				}
+				return nil
+			}
+			if !slices.Contains(contexts, args[0]) {
+				return fmt.Errorf("context %q not found in kubeconfig, should be one of: %s", args[0],
+					strings.Join(contexts, ", "))
+			}
+			cfg, err := config.Load(configFilePath)
+			if err != nil {
+				return err
+			}
+			cfg.Context = args[0]
+			cfg.Cluster = globalCluster
+			if err := cfg.Save(configFilePath); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "context set to %s (saved to %s)\n", args[0], configFilePath)
+			return nil
+		},
+	}
+	return cmd
+}
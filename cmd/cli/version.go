@@ -0,0 +1,129 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penglongli/accelerboat/cmd/cli/kube"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/version"
+)
+
+const customapiVersion = "/customapi/version"
+
+// serverVersions records the versions of the servers the CLI talks to, from the version header of responses
+var serverVersions = &versionRecorder{base: http.DefaultTransport, versions: make(map[string]struct{})}
+
+// versionRecorder is the transport of http.DefaultClient that records the server versions
+type versionRecorder struct {
+	sync.Mutex
+	base     http.RoundTripper
+	versions map[string]struct{}
+}
+
+func (v *versionRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := v.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if ver := resp.Header.Get(apitypes.VersionHeader); ver != "" {
+		v.Lock()
+		v.versions[ver] = struct{}{}
+		v.Unlock()
+	}
+	return resp, nil
+}
+
+// warnVersionSkew prints the warning if the versions of servers differ from the CLI, the CLI built
+// without version is not checked
+func warnVersionSkew() {
+	if version.Version == version.DevVersion {
+		return
+	}
+	serverVersions.Lock()
+	defer serverVersions.Unlock()
+	skewed := make([]string, 0)
+	for ver := range serverVersions.versions {
+		if ver != version.Version {
+			skewed = append(skewed, ver)
+		}
+	}
+	if len(skewed) == 0 {
+		return
+	}
+	sort.Strings(skewed)
+	fmt.Fprintf(os.Stderr, "WARNING: the CLI version %s differs from the server version(s) %s\n",
+		version.Version, strings.Join(skewed, ", "))
+}
+
+// NewVersionCmd returns the command that shows the versions of CLI and all nodes.
+func NewVersionCmd() *cobra.Command {
+	var clientOnly bool
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Show the version of CLI and the versions of all nodes",
+		Long:  "Show the build of CLI, and the versions of all alive nodes reported by their heartbeats.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := version.Get()
+			fmt.Fprintf(os.Stdout, "Client: %s (commit: %s, built: %s, %s)\n", info.Version, orDash(info.GitCommit),
+				orDash(info.BuildTime), info.GoVersion)
+			if clientOnly {
+				return nil
+			}
+			ctx := context.Background()
+			client, err := newKubeClient()
+			if err != nil {
+				return err
+			}
+			pod, err := selectPod(ctx, client, "")
+			if err != nil {
+				return err
+			}
+			resp, err := nodeVersions(ctx, client, pod.Name)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stdout)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NODE\tVERSION\tCOMMIT\tLAST HEARTBEAT")
+			for _, n := range resp.Nodes {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", n.Node, n.Version, orDash(n.GitCommit),
+					durationShort(time.Since(n.LastHeartbeat))+" ago")
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().BoolVar(&clientOnly, "client", false, "Show the version of CLI only")
+	return cmd
+}
+
+// nodeVersions returns the versions of all alive nodes from the pod
+func nodeVersions(ctx context.Context, client *kube.Client, podName string) (*apitypes.VersionResponse, error) {
+	query := url.Values{}
+	query.Set("nodes", "true")
+	body, err := client.PortForwardAndRequest(ctx, podName, kube.HTTPPortNumber, customapiVersion, query)
+	if err != nil {
+		return nil, err
+	}
+	resp := &apitypes.VersionResponse{}
+	if err = json.Unmarshal(body, resp); err != nil {
+		return nil, fmt.Errorf("unmarshal versions: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// The credential-provider implements the kubelet image credential provider API
+// (credentialprovider.kubelet.k8s.io/v1). The kubelet execs it with the CredentialProviderRequest on stdin,
+// it asks accelerboat on the same node for the credentials of the image registry and writes the
+// CredentialProviderResponse to stdout.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	credentialProviderAPIVersion = "credentialprovider.kubelet.k8s.io/v1"
+	credentialProviderKind       = "CredentialProviderResponse"
+	// cacheKeyTypeRegistry the kubelet caches the response for the registry of image
+	cacheKeyTypeRegistry = "Registry"
+)
+
+var (
+	endpoint = flag.String("endpoint", "http://127.0.0.1:2080", "the http endpoint of accelerboat on this node")
+	timeout  = flag.Duration("timeout", 10*time.Second, "the timeout of requesting accelerboat")
+)
+
+// credentialProviderRequest defines the request of kubelet, only the image is used
+type credentialProviderRequest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Image      string `json:"image"`
+}
+
+// credentialProviderResponse defines the response to kubelet
+type credentialProviderResponse struct {
+	APIVersion    string                     `json:"apiVersion"`
+	Kind          string                     `json:"kind"`
+	CacheKeyType  string                     `json:"cacheKeyType"`
+	CacheDuration string                     `json:"cacheDuration,omitempty"`
+	Auth          map[string]authCredentials `json:"auth,omitempty"`
+}
+
+type authCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func main() {
+	flag.Parse()
+	if err := run(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "accelerboat credential provider failed: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(in io.Reader, out io.Writer) error {
+	req := &credentialProviderRequest{}
+	if err := json.NewDecoder(in).Decode(req); err != nil {
+		return errors.Wrapf(err, "decode request failed")
+	}
+	if req.APIVersion != "" && req.APIVersion != credentialProviderAPIVersion {
+		return errors.Errorf("api version '%s' not supported", req.APIVersion)
+	}
+	if req.Image == "" {
+		return errors.Errorf("request not have image")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cred, err := queryCredential(ctx, req.Image)
+	if err != nil {
+		return err
+	}
+	resp := &credentialProviderResponse{
+		APIVersion:    credentialProviderAPIVersion,
+		Kind:          credentialProviderKind,
+		CacheKeyType:  cacheKeyTypeRegistry,
+		CacheDuration: (time.Duration(cred.CacheDuration) * time.Second).String(),
+		Auth:          make(map[string]authCredentials, len(cred.Auths)),
+	}
+	for host, auth := range cred.Auths {
+		resp.Auth[host] = authCredentials{Username: auth.Username, Password: auth.Password}
+	}
+	return json.NewEncoder(out).Encode(resp)
+}
+
+func queryCredential(ctx context.Context, image string) (*apitypes.RegistryCredentialResponse, error) {
+	u := strings.TrimSuffix(*endpoint, "/") + apitypes.APIRegistryCredential + "?" +
+		url.Values{"image": []string{image}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create request failed")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request accelerboat '%s' failed", *endpoint)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read response failed")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("accelerboat responded status '%d': %s", resp.StatusCode, string(body))
+	}
+	cred := &apitypes.RegistryCredentialResponse{}
+	if err = json.Unmarshal(body, cred); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal response failed")
+	}
+	return cred, nil
+}
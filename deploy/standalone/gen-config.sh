@@ -0,0 +1,13 @@
+#!/bin/sh
+# Generates config.json from config.template.json with a self-signed certificate of localhost.
+set -e
+cd "$(dirname "$0")"
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+openssl req -x509 -newkey rsa:2048 -nodes -days 365 -subj "/CN=localhost" \
+  -keyout "$tmp/localhost.key" -out "$tmp/localhost.crt" >/dev/null 2>&1
+cert=$(base64 < "$tmp/localhost.crt" | tr -d '\n')
+key=$(base64 < "$tmp/localhost.key" | tr -d '\n')
+sed -e "s|__LOCALHOST_CERT__|$cert|" -e "s|__LOCALHOST_KEY__|$key|" config.template.json > config.json
+echo "generated $(pwd)/config.json"
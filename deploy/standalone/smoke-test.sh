@@ -0,0 +1,55 @@
+#!/bin/sh
+# Starts the nodes of docker-compose.yaml and checks they elect the same master and proxy the registry.
+set -e
+cd "$(dirname "$0")"
+
+cleanup() {
+  docker compose logs --no-color > smoke-test.log 2>&1 || true
+  docker compose down -v >/dev/null 2>&1 || true
+}
+trap cleanup EXIT
+
+./gen-config.sh
+docker compose up -d
+
+wait_ready() {
+  for _ in $(seq 1 60); do
+    if curl -sf "http://127.0.0.1:$1/customapi/readiness" >/dev/null; then
+      return 0
+    fi
+    sleep 2
+  done
+  echo "node on port $1 not ready" >&2
+  return 1
+}
+
+master_of() {
+  curl -sf "http://127.0.0.1:$1/customapi/stats?output=json" | sed -n 's/.*"master":"\([^"]*\)".*/\1/p'
+}
+
+wait_ready 2080
+wait_ready 3080
+
+# the peers join the endpoints after they passed the health check
+for _ in $(seq 1 15); do
+  master1=$(master_of 2080)
+  master2=$(master_of 3080)
+  if [ -n "$master1" ] && [ "$master1" = "$master2" ]; then
+    break
+  fi
+  sleep 2
+done
+if [ -z "$master1" ] || [ "$master1" != "$master2" ]; then
+  echo "nodes elected different masters: '$master1' and '$master2'" >&2
+  exit 1
+fi
+echo "both nodes elected master $master1"
+
+# the /v2/ of original registry challenges for token, the realm is rewritten to the proxy
+code=$(curl -s -o /dev/null -w '%{http_code}' -H 'Host: docker.local' http://127.0.0.1:2080/v2/)
+if [ "$code" != "401" ] && [ "$code" != "200" ]; then
+  echo "proxy /v2/ responded $code" >&2
+  exit 1
+fi
+echo "proxy /v2/ responded $code"
+echo "smoke test passed"
@@ -0,0 +1,147 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package accesslog provides the structured access log of all the proxied registry requests.
+package accesslog
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+)
+
+// The cache outcomes of request
+const (
+	// CacheLocal the blob is served from the local cache
+	CacheLocal = "local"
+	// CacheMemory the small blob is served from the in-memory cache
+	CacheMemory = "memory"
+	// CacheCluster the blob is fetched by master from the cluster cache or original registry
+	CacheCluster = "cluster"
+	// CacheMaster the token/manifest is responded by master
+	CacheMaster = "master"
+	// CacheReverse the request is reversed to the original registry
+	CacheReverse = "reverse"
+	// CacheRejected the request is rejected by signature verification or layer scan
+	CacheRejected = "rejected"
+	// CacheUpstreamError the failure status of original registry is responded to client
+	CacheUpstreamError = "upstream_error"
+	// CacheOCILayout the request is served from local OCI layout directory
+	CacheOCILayout = "ocilayout"
+	// CacheRedirect the client is redirected to the node holding the blob
+	CacheRedirect = "redirect"
+)
+
+// Entry defines one access log entry
+type Entry struct {
+	RequestID string
+	Method    string
+	Path      string
+	Registry  string
+	Digest    string
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	ClientIP  string
+	Cache     string
+	// Namespace and Pod of client, they are empty if the client not resolved to pod
+	Namespace string
+	Pod       string
+}
+
+// Logger writes the access log entries as JSON lines
+type Logger struct {
+	logger         *zap.Logger
+	pingSampleRate float64
+}
+
+// Global is the global access logger, it writes nothing before Init
+var Global = &Logger{}
+
+// Init initializes the access logger with config, the file output is rotated with the log config
+func (l *Logger) Init(cfg *options.AccessLogConfig, logConfig *options.LogConfig) {
+	var syncer zapcore.WriteSyncer
+	switch cfg.Output {
+	case options.AccessLogStdout:
+		syncer = zapcore.AddSync(os.Stdout)
+	default:
+		file := cfg.File
+		if file == "" {
+			file = filepath.Join(logConfig.LogDir, "access.log")
+		}
+		syncer = zapcore.AddSync(&lumberjack.Logger{
+			Filename:   file,
+			MaxSize:    logConfig.LogMaxSize,
+			MaxAge:     logConfig.LogMaxAge,
+			MaxBackups: logConfig.LogMaxBackups,
+			Compress:   true,
+		})
+	}
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+			TimeKey:    "time",
+			MessageKey: "msg",
+			EncodeTime: zapcore.TimeEncoderOfLayout("2006-01-02T15:04:05.000Z07:00"),
+		}),
+		syncer,
+		zap.InfoLevel,
+	)
+	l.logger = zap.New(core)
+	l.pingSampleRate = cfg.PingSampleRate
+}
+
+// Log writes the entry, the '/v2/' ping requests are sampled with the ping sample rate
+func (l *Logger) Log(e *Entry) {
+	if l.logger == nil {
+		return
+	}
+	if (e.Path == "/v2/" || e.Path == "/v2") && rand.Float64() >= l.pingSampleRate {
+		return
+	}
+	l.logger.Info("access",
+		zap.String("requestID", e.RequestID),
+		zap.String("method", e.Method),
+		zap.String("path", e.Path),
+		zap.String("registry", e.Registry),
+		zap.String("digest", e.Digest),
+		zap.Int("status", e.Status),
+		zap.Int64("bytes", e.Bytes),
+		zap.Int64("durationMs", e.Duration.Milliseconds()),
+		zap.String("clientIP", e.ClientIP),
+		zap.String("cache", e.Cache),
+		zap.String("namespace", e.Namespace),
+		zap.String("pod", e.Pod),
+	)
+}
+
+type cacheOutcomeKey struct{}
+
+// WithCacheOutcome returns the context which can hold the cache outcome set by the handlers
+func WithCacheOutcome(ctx context.Context) context.Context {
+	outcome := ""
+	return context.WithValue(ctx, cacheOutcomeKey{}, &outcome)
+}
+
+// SetCacheOutcome sets the cache outcome of the request
+func SetCacheOutcome(ctx context.Context, outcome string) {
+	if v, ok := ctx.Value(cacheOutcomeKey{}).(*string); ok {
+		*v = outcome
+	}
+}
+
+// CacheOutcome returns the cache outcome of the request
+func CacheOutcome(ctx context.Context) string {
+	if v, ok := ctx.Value(cacheOutcomeKey{}).(*string); ok {
+		return *v
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package bandwidth applies the bandwidth profiles of schedules, e.g. full-speed preheating at night
+// but capped P2P traffic during business hours.
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/bittorrent"
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	scheduleInterval = 30 * time.Second
+	originChunkSize  = 256 << 10
+)
+
+// originLimiter limits the download speed from original registries, it is unlimited by default
+var originLimiter = rate.NewLimiter(rate.Inf, originChunkSize)
+
+// OriginReader returns the reader limited by the origin egress limit
+func OriginReader(ctx context.Context, r io.Reader) io.Reader {
+	return &limitedReader{ctx: ctx, reader: r}
+}
+
+type limitedReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// Read reads the bytes no larger than chunk size, and waits for the limiter before return
+func (r *limitedReader) Read(bs []byte) (int, error) {
+	if len(bs) > originChunkSize {
+		bs = bs[:originChunkSize]
+	}
+	n, err := r.reader.Read(bs)
+	if n > 0 {
+		if waitErr := originLimiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, errors.Wrapf(waitErr, "origin bandwidth limit wait failed")
+		}
+	}
+	return n, err
+}
+
+func setOriginLimit(limitMB int64) {
+	if limitMB <= 0 {
+		originLimiter.SetLimit(rate.Inf)
+		return
+	}
+	originLimiter.SetLimit(rate.Limit(limitMB * options.MB))
+}
+
+// Scheduler applies the limits of active bandwidth schedule periodically, the limits of config are
+// applied when no schedule is active
+type Scheduler struct {
+	torrentHandler *bittorrent.TorrentHandler
+
+	active      string
+	originLimit int64
+}
+
+// NewScheduler creates the bandwidth scheduler
+func NewScheduler(torrentHandler *bittorrent.TorrentHandler) *Scheduler {
+	return &Scheduler{
+		torrentHandler: torrentHandler,
+		originLimit:    -1,
+	}
+}
+
+// op returns the current snapshot of options, the scheduler lives across config reloads so it is not kept
+func (s *Scheduler) op() *options.AccelerBoatOption {
+	return options.GlobalOptions()
+}
+
+// Run applies the schedules until context done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	s.apply(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.apply(now)
+		}
+	}
+}
+
+func (s *Scheduler) apply(now time.Time) {
+	originLimit := s.op().BandwidthConfig.OriginLimit
+	schedule := s.op().BandwidthConfig.ActiveSchedule(now)
+	if schedule != nil {
+		originLimit = schedule.OriginLimit
+		s.torrentHandler.SetScheduleLimits(&bittorrent.RateLimits{
+			UploadLimit:   schedule.UploadLimit,
+			DownloadLimit: schedule.DownloadLimit,
+			Schedule:      schedule.Name,
+		})
+	} else {
+		s.torrentHandler.SetScheduleLimits(nil)
+	}
+	var name string
+	if schedule != nil {
+		name = schedule.Name
+	}
+	if name != s.active {
+		if name != "" {
+			logger.Infof("bandwidth schedule '%s' is active", name)
+		} else {
+			logger.Infof("bandwidth schedule '%s' is inactive, limits revert to config", s.active)
+		}
+		s.active = name
+	}
+	if originLimit != s.originLimit {
+		setOriginLimit(originLimit)
+		s.originLimit = originLimit
+		logger.Infof("origin bandwidth limit applied: %dMB/s", originLimit)
+	}
+}
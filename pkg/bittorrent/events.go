@@ -0,0 +1,72 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bittorrent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/penglongli/accelerboat/pkg/recorder"
+)
+
+const (
+	addReasonDownload = "download"
+	addReasonStream   = "stream"
+	addReasonServe    = "serve"
+	addReasonStored   = "join_stored"
+
+	dropReasonStaleInfoHash = "stale_infohash"
+	dropReasonInfoTimeout   = "info_timeout"
+	dropReasonVerifyFailed  = "verify_failed"
+	dropReasonIncomplete    = "incomplete_data"
+)
+
+// addTorrent adds the torrent into client, the torrent_added event is recorded only if the torrent is not
+// in client before
+func (th *TorrentHandler) addTorrent(ctx context.Context, digest string, mi *metainfo.MetaInfo,
+	reason string) (*torrent.Torrent, error) {
+	_, existed := th.client.Torrent(mi.HashInfoBytes())
+	to, err := th.client.AddTorrent(mi)
+	if err != nil {
+		return nil, err
+	}
+	if existed {
+		return to, nil
+	}
+	var size int64
+	if info, err := mi.UnmarshalInfo(); err == nil {
+		size = info.TotalLength()
+	}
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeTorrentAdded,
+		EventStatus: recorder.Normal,
+		Details: map[string]interface{}{
+			"digest": digest, "size": size, "reason": reason, "infoHash": to.InfoHash().HexString(),
+		},
+		Message: fmt.Sprintf("Torrent added for %s", reason),
+	})
+	return to, nil
+}
+
+// dropTorrent drops the torrent from client and records the torrent_dropped event with reason
+func (th *TorrentHandler) dropTorrent(ctx context.Context, digest string, to *torrent.Torrent, reason string) {
+	var size int64
+	if to.Info() != nil {
+		size = to.Length()
+	}
+	infoHash := to.InfoHash().HexString()
+	to.Drop()
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeTorrentDropped,
+		EventStatus: recorder.Warning,
+		Details: map[string]interface{}{
+			"digest": digest, "size": size, "reason": reason, "infoHash": infoHash,
+		},
+		Message: fmt.Sprintf("Torrent dropped because of %s", reason),
+	})
+}
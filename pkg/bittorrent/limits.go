@@ -0,0 +1,182 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bittorrent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+// RateLimits defines the upload/download rate limits(MB/s) of torrent client, 0 means no limit
+type RateLimits struct {
+	UploadLimit   int64 `json:"uploadLimit"`
+	DownloadLimit int64 `json:"downloadLimit"`
+	// Schedule the name of bandwidth schedule if the limits are from the active schedule
+	Schedule string `json:"schedule,omitempty"`
+	// Override whether the limits are the temporary override, ExpireAt is the time it reverts to config
+	Override bool      `json:"override"`
+	ExpireAt time.Time `json:"expireAt,omitempty"`
+}
+
+// rateLimiters holds the limiters of torrent client, the limits are updated in place so the changes take
+// effect on the running client without restart. The temporary override takes precedence over the active
+// bandwidth schedule, and the schedule takes precedence over config.
+type rateLimiters struct {
+	sync.Mutex
+	upload   *rate.Limiter
+	download *rate.Limiter
+
+	schedule      *RateLimits
+	override      *RateLimits
+	overrideTimer *time.Timer
+}
+
+func newRateLimiters(uploadLimit, downloadLimit int64) *rateLimiters {
+	rl := &rateLimiters{
+		upload:   rate.NewLimiter(rate.Inf, 0),
+		download: rate.NewLimiter(rate.Inf, 0),
+	}
+	setLimit(rl.upload, uploadLimit)
+	setLimit(rl.download, downloadLimit)
+	return rl
+}
+
+func setLimit(limiter *rate.Limiter, limitMB int64) {
+	if limitMB <= 0 {
+		limiter.SetLimit(rate.Inf)
+		return
+	}
+	limiter.SetLimit(rate.Limit(limitMB * options.MB))
+	limiter.SetBurst(2 * int(limitMB*options.MB))
+}
+
+// RateLimits returns the effective rate limits of torrent client
+func (th *TorrentHandler) RateLimits() *RateLimits {
+	th.limiters.Lock()
+	defer th.limiters.Unlock()
+	if th.limiters.override != nil {
+		result := *th.limiters.override
+		return &result
+	}
+	return th.baseLimits()
+}
+
+// baseLimits returns the limits of active schedule, or the limits of config if no active schedule
+func (th *TorrentHandler) baseLimits() *RateLimits {
+	if th.limiters.schedule != nil {
+		result := *th.limiters.schedule
+		return &result
+	}
+	torrentConfig := options.GlobalOptions().TorrentConfig
+	return &RateLimits{
+		UploadLimit:   torrentConfig.UploadLimit,
+		DownloadLimit: torrentConfig.DownloadLimit,
+	}
+}
+
+// ApplyConfigLimits applies the rate limits of config to the running client, it is ignored when the
+// temporary override or active schedule exists and takes effect after them expired
+func (th *TorrentHandler) ApplyConfigLimits() {
+	th.limiters.Lock()
+	defer th.limiters.Unlock()
+	if th.limiters.override != nil {
+		logger.Infof("torrent rate limits changed in config, the temporary override is kept until %s",
+			th.limiters.override.ExpireAt.Format(time.RFC3339))
+		return
+	}
+	th.applyBaseLimits()
+}
+
+// SetScheduleLimits applies the limits of active bandwidth schedule, nil means no active schedule and the
+// limits revert to config
+func (th *TorrentHandler) SetScheduleLimits(schedule *RateLimits) {
+	th.limiters.Lock()
+	defer th.limiters.Unlock()
+	prev := th.limiters.schedule
+	if (prev == nil && schedule == nil) || (prev != nil && schedule != nil && *prev == *schedule) {
+		return
+	}
+	th.limiters.schedule = schedule
+	if th.limiters.override != nil {
+		return
+	}
+	th.applyBaseLimits()
+}
+
+func (th *TorrentHandler) applyBaseLimits() {
+	limits := th.baseLimits()
+	setLimit(th.limiters.upload, limits.UploadLimit)
+	setLimit(th.limiters.download, limits.DownloadLimit)
+	source := "config"
+	if limits.Schedule != "" {
+		source = "schedule '" + limits.Schedule + "'"
+	}
+	logger.Infof("torrent rate limits applied from %s, upload: %dMB/s, download: %dMB/s", source,
+		limits.UploadLimit, limits.DownloadLimit)
+}
+
+// OverrideLimits overrides the rate limits temporarily, the limits revert to schedule or config after
+// duration
+func (th *TorrentHandler) OverrideLimits(uploadLimit, downloadLimit int64, duration time.Duration) (
+	*RateLimits, error) {
+	if uploadLimit < 0 || downloadLimit < 0 {
+		return nil, errors.Errorf("rate limits cannot be negative")
+	}
+	if duration <= 0 {
+		return nil, errors.Errorf("override duration must be positive")
+	}
+	th.limiters.Lock()
+	defer th.limiters.Unlock()
+	if th.limiters.overrideTimer != nil {
+		th.limiters.overrideTimer.Stop()
+	}
+	override := &RateLimits{
+		UploadLimit:   uploadLimit,
+		DownloadLimit: downloadLimit,
+		Override:      true,
+		ExpireAt:      time.Now().Add(duration),
+	}
+	th.limiters.override = override
+	th.limiters.overrideTimer = time.AfterFunc(duration, func() {
+		th.limiters.Lock()
+		defer th.limiters.Unlock()
+		if th.limiters.override != override {
+			return
+		}
+		th.clearOverride()
+	})
+	setLimit(th.limiters.upload, uploadLimit)
+	setLimit(th.limiters.download, downloadLimit)
+	logger.Infof("torrent rate limits overridden until %s, upload: %dMB/s, download: %dMB/s",
+		override.ExpireAt.Format(time.RFC3339), uploadLimit, downloadLimit)
+	result := *override
+	return &result, nil
+}
+
+// ClearOverrideLimits removes the temporary override and reverts the rate limits to schedule or config
+func (th *TorrentHandler) ClearOverrideLimits() {
+	th.limiters.Lock()
+	defer th.limiters.Unlock()
+	if th.limiters.override == nil {
+		return
+	}
+	th.clearOverride()
+}
+
+func (th *TorrentHandler) clearOverride() {
+	if th.limiters.overrideTimer != nil {
+		th.limiters.overrideTimer.Stop()
+	}
+	th.limiters.override = nil
+	th.limiters.overrideTimer = nil
+	logger.Infof("torrent rate limits override removed")
+	th.applyBaseLimits()
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bittorrent
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const dropReasonManual = "manual"
+
+// ListTorrents returns the torrents in client, sorted by digest
+func (th *TorrentHandler) ListTorrents() []*apitypes.TorrentInfo {
+	result := make([]*apitypes.TorrentInfo, 0)
+	for _, to := range th.client.Torrents() {
+		if to == nil {
+			continue
+		}
+		result = append(result, torrentInfo(to))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Digest < result[j].Digest
+	})
+	return result
+}
+
+func torrentInfo(to *torrent.Torrent) *apitypes.TorrentInfo {
+	stats := to.Stats()
+	info := &apitypes.TorrentInfo{
+		InfoHash:    to.InfoHash().HexString(),
+		TotalPeers:  stats.TotalPeers,
+		ActivePeers: stats.ActivePeers,
+		Seeders:     stats.ConnectedSeeders,
+	}
+	ti := to.Info()
+	if ti == nil {
+		return info
+	}
+	info.Digest = strings.TrimSuffix(ti.Name, ".tar.gzip")
+	info.Size = to.Length()
+	info.BytesCompleted = to.BytesCompleted()
+	if info.Size != 0 {
+		info.Progress = float64(info.BytesCompleted) * 100 / float64(info.Size)
+	}
+	info.Seeding = to.Seeding()
+	return info
+}
+
+// DropTorrent drops the torrent of digest from client, e.g. recovering from the stuck swarm. The torrent is
+// added again on the next download or serving of the layer.
+func (th *TorrentHandler) DropTorrent(ctx context.Context, digest string) (*apitypes.TorrentInfo, error) {
+	to, _ := th.localTorrent(ctx, digest)
+	if to == nil {
+		return nil, errors.Errorf("torrent '%s' not found", digest)
+	}
+	info := torrentInfo(to)
+	th.dropTorrent(ctx, digest, to, dropReasonManual)
+	logger.InfoContextf(ctx, "torrent '%s' dropped manually", digest)
+	return info, nil
+}
+
+// VerifyTorrent re-verifies the pieces of torrent with the data on disk, the pieces failed are downloaded
+// from the swarm again
+func (th *TorrentHandler) VerifyTorrent(ctx context.Context, digest string) (*apitypes.TorrentInfo, error) {
+	to, _ := th.localTorrent(ctx, digest)
+	if to == nil {
+		return nil, errors.Errorf("torrent '%s' not found", digest)
+	}
+	logger.InfoContextf(ctx, "torrent '%s' verifying data", digest)
+	if err := to.VerifyDataContext(ctx); err != nil {
+		return nil, errors.Wrapf(err, "verify torrent '%s' failed", digest)
+	}
+	info := torrentInfo(to)
+	logger.InfoContextf(ctx, "torrent '%s' verified, completed: %d/%d", digest, info.BytesCompleted, info.Size)
+	return info, nil
+}
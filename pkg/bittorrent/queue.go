@@ -0,0 +1,137 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bittorrent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+const (
+	// generateTimeout the timeout of generating one torrent in queue
+	generateTimeout = 10 * time.Minute
+)
+
+// generateTask defines the layer waiting for torrent generation. The requested times is the priority
+// of task, the frequently-requested layers are generated first, and the earlier queued first if the same.
+type generateTask struct {
+	digest     string
+	sourceFile string
+	requested  int
+	// seq the order of task queued
+	seq uint64
+}
+
+// generateQueue is the bounded queue of torrent generation, the same digest is only queued once.
+type generateQueue struct {
+	sync.Mutex
+	cond    *sync.Cond
+	size    int
+	pending map[string]*generateTask
+	running map[string]struct{}
+	seq     uint64
+}
+
+func newGenerateQueue(size int) *generateQueue {
+	q := &generateQueue{
+		size:    size,
+		pending: make(map[string]*generateTask),
+		running: make(map[string]struct{}),
+	}
+	q.cond = sync.NewCond(q)
+	return q
+}
+
+// push adds the task into queue, returns false if the queue is full
+func (q *generateQueue) push(digest, sourceFile string) bool {
+	q.Lock()
+	defer q.Unlock()
+	if _, ok := q.running[digest]; ok {
+		return true
+	}
+	if task, ok := q.pending[digest]; ok {
+		task.requested++
+		return true
+	}
+	if len(q.pending) >= q.size {
+		return false
+	}
+	q.seq++
+	q.pending[digest] = &generateTask{digest: digest, sourceFile: sourceFile, requested: 1, seq: q.seq}
+	metrics.TorrentGenerateQueueLength.Set(float64(len(q.pending)))
+	q.cond.Signal()
+	return true
+}
+
+// pop waits and returns the task with the highest priority, it is marked as running until done
+func (q *generateQueue) pop() *generateTask {
+	q.Lock()
+	defer q.Unlock()
+	for len(q.pending) == 0 {
+		q.cond.Wait()
+	}
+	var result *generateTask
+	for _, task := range q.pending {
+		if result == nil || task.requested > result.requested ||
+			(task.requested == result.requested && task.seq < result.seq) {
+			result = task
+		}
+	}
+	delete(q.pending, result.digest)
+	q.running[result.digest] = struct{}{}
+	metrics.TorrentGenerateQueueLength.Set(float64(len(q.pending)))
+	return result
+}
+
+func (q *generateQueue) done(digest string) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.running, digest)
+}
+
+// startGenerateWorkers starts the workers to generate torrents from queue
+func (th *TorrentHandler) startGenerateWorkers(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				task := th.generateQueue.pop()
+				th.generateQueuedTorrent(task)
+				th.generateQueue.done(task.digest)
+			}
+		}()
+	}
+}
+
+func (th *TorrentHandler) generateQueuedTorrent(task *generateTask) {
+	ctx := logger.WithContextFields(context.Background(), "digest", task.digest)
+	ctx, cancel := context.WithTimeout(ctx, generateTimeout)
+	defer cancel()
+	if _, err := th.GenerateTorrent(ctx, task.digest, task.sourceFile); err != nil {
+		logger.ErrorContextf(ctx, "generate torrent for '%s' failed: %s", task.sourceFile, err.Error())
+		return
+	}
+	logger.InfoContextf(ctx, "generate torrent for '%s' success (requested %d times)",
+		task.sourceFile, task.requested)
+}
+
+// RequestTorrent returns the torrent of layer if it is generated. Otherwise the layer is queued for
+// generation and returns pending, the caller should not wait for the torrent and transfer with tcp.
+func (th *TorrentHandler) RequestTorrent(ctx context.Context, digest, sourceFile string) (string, bool) {
+	if to, torrentBase64 := th.CheckTorrentLocalExist(ctx, digest); to != nil {
+		return torrentBase64, false
+	}
+	if !th.generateQueue.push(digest, sourceFile) {
+		metrics.TorrentOperationsTotal.WithLabelValues("enqueue", "dropped").Inc()
+		logger.WarnContextf(ctx, "torrent generate queue is full, layer '%s' will be transferred with tcp",
+			sourceFile)
+		return "", false
+	}
+	logger.InfoContextf(ctx, "torrent of layer '%s' is pending for generation", sourceFile)
+	return "", true
+}
@@ -0,0 +1,75 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bittorrent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateQueueOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		pushes []string
+		want   []string
+	}{
+		{
+			name:   "same priority in queued order",
+			pushes: []string{"d1", "d2", "d3", "d4"},
+			want:   []string{"d1", "d2", "d3", "d4"},
+		},
+		{
+			name:   "frequently requested first",
+			pushes: []string{"d1", "d2", "d3", "d3", "d2", "d3"},
+			want:   []string{"d3", "d2", "d1"},
+		},
+		{
+			name:   "same requested times in first queued order",
+			pushes: []string{"d1", "d2", "d2", "d1", "d3"},
+			want:   []string{"d1", "d2", "d3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newGenerateQueue(10)
+			for _, digest := range tt.pushes {
+				q.push(digest, "/data/"+digest)
+			}
+			got := make([]string, 0, len(tt.want))
+			for range tt.want {
+				task := q.pop()
+				got = append(got, task.digest)
+				q.done(task.digest)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pop order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateQueuePush(t *testing.T) {
+	q := newGenerateQueue(2)
+	if !q.push("d1", "/data/d1") || !q.push("d2", "/data/d2") {
+		t.Fatalf("push into queue not full failed")
+	}
+	if q.push("d3", "/data/d3") {
+		t.Errorf("push into full queue = true, want false")
+	}
+	if !q.push("d1", "/data/d1") {
+		t.Errorf("push the queued digest into full queue = false, want true")
+	}
+	task := q.pop()
+	if task.digest != "d1" || task.requested != 2 {
+		t.Errorf("pop = %s requested %d, want d1 requested 2", task.digest, task.requested)
+	}
+	if !q.push("d1", "/data/d1") || len(q.pending) != 1 {
+		t.Errorf("push the running digest should not queue it again, pending %d", len(q.pending))
+	}
+	q.done("d1")
+	if !q.push("d1", "/data/d1") || len(q.pending) != 2 {
+		t.Errorf("push the done digest should queue it again, pending %d", len(q.pending))
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bittorrent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+const (
+	// repairStallTimeout the repair with torrent is given up if no piece completed within it
+	repairStallTimeout = 60 * time.Second
+)
+
+// RangeFetcher fetches the byte range of layer from the peer, it repairs the holes of torrent file that
+// cannot be downloaded with torrent
+type RangeFetcher func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// repairTorrentFile fills the holes of downloaded torrent file instead of discarding it. The pieces of
+// holes are verified and downloaded again with torrent, and the remained holes are fetched from the peer
+// with fetcher if not nil. Returns error only if the holes cannot be repaired, or the repaired content is
+// not verified.
+func (th *TorrentHandler) repairTorrentFile(ctx context.Context, digest, torrentFile string,
+	fetcher RangeFetcher) error {
+	holes, err := utils.FileHoles(torrentFile)
+	if err != nil {
+		return errors.Wrapf(err, "find holes of torrent file failed")
+	}
+	if len(holes) == 0 {
+		return nil
+	}
+	logger.WarnContextf(ctx, "torrent file '%s' has %d holes, repairing", torrentFile, len(holes))
+	to, _ := th.localTorrent(ctx, digest)
+	if to != nil {
+		if err = repairPiecesByTorrent(ctx, to, holes); err != nil {
+			logger.WarnContextf(ctx, "repair torrent file with torrent failed: %s", err.Error())
+		}
+		if holes, err = utils.FileHoles(torrentFile); err != nil {
+			return errors.Wrapf(err, "find holes of torrent file failed")
+		}
+		if len(holes) == 0 {
+			metrics.TorrentOperationsTotal.WithLabelValues("repair", "torrent").Inc()
+			logger.InfoContextf(ctx, "torrent file '%s' repaired with torrent", torrentFile)
+			return nil
+		}
+	}
+	if fetcher == nil {
+		metrics.TorrentOperationsTotal.WithLabelValues("repair", "error").Inc()
+		return errors.Errorf("torrent file '%s' has %d holes not repaired", torrentFile, len(holes))
+	}
+	if err = repairHolesByRange(ctx, torrentFile, holes, fetcher); err != nil {
+		metrics.TorrentOperationsTotal.WithLabelValues("repair", "error").Inc()
+		return errors.Wrapf(err, "repair torrent file with tcp failed")
+	}
+	if to == nil {
+		// the ranges are not verified by pieces without torrent, the whole file is verified with digest
+		if err = verifyRepairedFile(ctx, digest, torrentFile); err != nil {
+			metrics.TorrentOperationsTotal.WithLabelValues("repair", "error").Inc()
+			return err
+		}
+	} else {
+		// the repaired pieces are verified to be seeded
+		for _, i := range holePieces(holes, to.Info().PieceLength, to.NumPieces()) {
+			if err = to.Piece(i).VerifyDataContext(ctx); err != nil {
+				return errors.Wrapf(err, "verify repaired piece %d failed", i)
+			}
+			if !to.PieceState(i).Complete {
+				metrics.TorrentOperationsTotal.WithLabelValues("repair", "error").Inc()
+				return errors.Errorf("repaired piece %d of torrent file '%s' not matches its hash", i,
+					torrentFile)
+			}
+		}
+	}
+	metrics.TorrentOperationsTotal.WithLabelValues("repair", "tcp").Inc()
+	logger.InfoContextf(ctx, "torrent file '%s' repaired with tcp, %d holes", torrentFile, len(holes))
+	return nil
+}
+
+// verifyRepairedFile verifies the digest of repaired file, the file is quarantined if not matched so that
+// it will be downloaded again
+func verifyRepairedFile(ctx context.Context, digest, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "open repaired file '%s' failed", filePath)
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, f)
+	_ = f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "read repaired file '%s' failed", filePath)
+	}
+	expected := strings.TrimPrefix(digest, "sha256:")
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if actual == expected {
+		return nil
+	}
+	if err = os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		logger.ErrorContextf(ctx, "remove corrupted repaired file '%s' failed: %s", filePath, err.Error())
+	}
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeLayerQuarantined,
+		EventStatus: recorder.Warning,
+		Details: map[string]interface{}{
+			"digest": "sha256:" + expected, "file": filePath, "actualDigest": "sha256:" + actual,
+		},
+		Message: "Layer quarantined because its content not matches the digest after repaired",
+	})
+	return errors.Errorf("repaired file '%s' digest '%s' not same as expected '%s'", filePath, actual, expected)
+}
+
+// repairPiecesByTorrent re-verifies the pieces of holes so they are marked incomplete, and downloads them
+// again until all completed or stalled
+func repairPiecesByTorrent(ctx context.Context, to *torrent.Torrent, holes []utils.FileRange) error {
+	pieces := holePieces(holes, to.Info().PieceLength, to.NumPieces())
+	for _, i := range pieces {
+		if err := to.Piece(i).VerifyDataContext(ctx); err != nil {
+			return errors.Wrapf(err, "verify piece %d failed", i)
+		}
+		to.DownloadPieces(i, i+1)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastCompleted, lastProgress := -1, time.Now()
+	for {
+		completed := 0
+		for _, i := range pieces {
+			if to.PieceState(i).Complete {
+				completed++
+			}
+		}
+		if completed == len(pieces) {
+			return nil
+		}
+		if completed > lastCompleted {
+			lastCompleted, lastProgress = completed, time.Now()
+		}
+		if time.Since(lastProgress) > repairStallTimeout {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("repair torrent pieces context exceeded")
+		case <-ticker.C:
+		}
+	}
+	// stop downloading the pieces, they are written by the repair with tcp
+	for _, i := range pieces {
+		if !to.PieceState(i).Complete {
+			to.CancelPieces(i, i+1)
+		}
+	}
+	return errors.Errorf("repair torrent pieces stalled, %d/%d completed", lastCompleted, len(pieces))
+}
+
+// repairHolesByRange fetches the ranges of holes with fetcher and writes them into file
+func repairHolesByRange(ctx context.Context, filePath string, holes []utils.FileRange,
+	fetcher RangeFetcher) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, "open file '%s' failed", filePath)
+	}
+	defer f.Close()
+	for _, hole := range holes {
+		body, err := fetcher(ctx, hole.Offset, hole.Length)
+		if err != nil {
+			return errors.Wrapf(err, "fetch range %d-%d failed", hole.Offset, hole.Offset+hole.Length-1)
+		}
+		n, err := io.Copy(io.NewOffsetWriter(f, hole.Offset), io.LimitReader(body, hole.Length))
+		_ = body.Close()
+		if err != nil {
+			return errors.Wrapf(err, "write range %d-%d failed", hole.Offset, hole.Offset+hole.Length-1)
+		}
+		if n != hole.Length {
+			return errors.Errorf("fetched range %d-%d is short, %d bytes", hole.Offset,
+				hole.Offset+hole.Length-1, n)
+		}
+	}
+	return f.Sync()
+}
+
+// holePieces returns the indexes of pieces overlapped with holes
+func holePieces(holes []utils.FileRange, pieceLength int64, numPieces int) []int {
+	result := make([]int, 0)
+	seen := make(map[int]struct{})
+	for _, hole := range holes {
+		begin := int(hole.Offset / pieceLength)
+		end := int((hole.Offset + hole.Length - 1) / pieceLength)
+		for i := begin; i <= end && i < numPieces; i++ {
+			if _, ok := seen[i]; ok {
+				continue
+			}
+			seen[i] = struct{}{}
+			result = append(result, i)
+		}
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bittorrent
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+const (
+	// streamStallTimeout the max duration of waiting for the next verified piece when streaming
+	streamStallTimeout = 60 * time.Second
+	// streamReadahead the bytes ahead of reading position that are prioritized to download
+	streamReadahead  = 32 << 20
+	streamBufferSize = 256 << 10
+)
+
+// StreamTorrent downloads the layer with torrent, and writes the verified pieces into w in order while
+// downloading. The layer file is copied into targetPath after download completed. Returns whether there
+// are bytes written into w, the caller cannot fall back to other transfer if started. The holes of layer
+// file are repaired with fetcher before copied.
+func (th *TorrentHandler) StreamTorrent(ctx context.Context, digest, torrentBase64, targetPath string,
+	w io.Writer, fetcher RangeFetcher) (bool, error) {
+	started, err := th.handleStreamTorrent(ctx, digest, torrentBase64, targetPath, w, fetcher)
+	if err != nil {
+		metrics.TorrentOperationsTotal.WithLabelValues("stream", "error").Inc()
+	} else {
+		metrics.TorrentOperationsTotal.WithLabelValues("stream", "success").Inc()
+	}
+	return started, err
+}
+
+func (th *TorrentHandler) handleStreamTorrent(ctx context.Context, digest, torrentBase64, targetPath string,
+	w io.Writer, fetcher RangeFetcher) (bool, error) {
+	mi, err := loadMetainfo(torrentBase64)
+	if err != nil {
+		return false, err
+	}
+	t, err := th.addTorrent(ctx, digest, mi, addReasonStream)
+	if err != nil {
+		return false, errors.Wrapf(err, "add torrent '%s' failed", torrentBase64)
+	}
+	if err = th.gotTorrentInfo(t); err != nil {
+		return false, err
+	}
+	// ignore chunk error
+	t.SetOnWriteChunkError(func(err error) {})
+	th.semaphore <- struct{}{}
+	defer func() { <-th.semaphore }()
+	t.DownloadAll()
+
+	reader := t.NewReader()
+	defer reader.Close()
+	reader.SetReadahead(streamReadahead)
+	logger.InfoContextf(ctx, "torrent start streaming")
+	start := time.Now()
+	buf := make([]byte, streamBufferSize)
+	var written int64
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, streamStallTimeout)
+		reader.SetContext(readCtx)
+		n, readErr := reader.Read(buf)
+		cancel()
+		if n > 0 {
+			if _, err = w.Write(buf[:n]); err != nil {
+				return true, errors.Wrapf(err, "write streaming bytes failed")
+			}
+			written += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return written != 0, errors.Wrapf(readErr, "read torrent at offset %d failed", written)
+		}
+	}
+	if written != t.Length() {
+		return written != 0, errors.Errorf("torrent streamed %d bytes, not same as length %d",
+			written, t.Length())
+	}
+	logger.InfoContextf(ctx, "torrent stream completed, cost: %v", time.Since(start))
+	if err = th.linkTorrentFile(ctx, digest, targetPath, fetcher); err != nil {
+		// the client already received the whole layer, only the local cache is missing
+		logger.WarnContextf(ctx, "link streamed torrent file failed: %s", err.Error())
+	}
+	return true, nil
+}
@@ -50,7 +50,9 @@ type TorrentHandler struct {
 	cacheStore   store.CacheStore
 	torrentCache *sync.Map
 
-	semaphore chan struct{}
+	semaphore     chan struct{}
+	generateQueue *generateQueue
+	limiters      *rateLimiters
 }
 
 // NewTorrentHandler create the torrent handler instance
@@ -85,19 +87,17 @@ func (th *TorrentHandler) Init() error {
 	clientConfig.DisableAcceptRateLimiting = true
 	clientConfig.AcceptPeerConnections = true
 	clientConfig.DefaultStorage = storage.NewMMap(th.op.StorageConfig.TorrentPath)
-	if th.op.TorrentConfig.UploadLimit > 0 {
-		clientConfig.UploadRateLimiter = rate.NewLimiter(rate.Limit(th.op.TorrentConfig.UploadLimit*options.MB),
-			2*int(th.op.TorrentConfig.UploadLimit*options.MB))
-	}
-	if th.op.TorrentConfig.DownloadLimit > 0 {
-		clientConfig.DownloadRateLimiter = rate.NewLimiter(rate.Limit(th.op.TorrentConfig.DownloadLimit*options.MB),
-			2*int(th.op.TorrentConfig.DownloadLimit*options.MB))
-	}
+	// the limiters are always set, so the limits can be changed on the running client
+	th.limiters = newRateLimiters(th.op.TorrentConfig.UploadLimit, th.op.TorrentConfig.DownloadLimit)
+	clientConfig.UploadRateLimiter = th.limiters.upload
+	clientConfig.DownloadRateLimiter = th.limiters.download
 	tc, err := torrent.NewClient(clientConfig)
 	if err != nil {
 		return errors.Wrapf(err, "create torrent client failed")
 	}
 	th.client = tc
+	th.generateQueue = newGenerateQueue(th.op.TorrentConfig.GenerateQueueSize)
+	th.startGenerateWorkers(th.op.TorrentConfig.GenerateWorkers)
 	go func() {
 		ticker := time.NewTicker(10 * time.Second)
 		for range ticker.C {
@@ -149,20 +149,28 @@ func (th *TorrentHandler) handleGenerateTorrent(ctx context.Context, digest, sou
 		return torrentBase64, nil
 	}
 
-	// copy source-file to torrent path
+	// link source-file to torrent path, the torrent storage and target share the same data
 	torrentFile := path.Join(th.op.StorageConfig.TorrentPath, utils.LayerFileName(digest))
-	if err := utils.CopyFile(sourceFile, torrentFile); err != nil {
+	if err := utils.LinkOrCopyFile(sourceFile, torrentFile); err != nil {
 		return "", err
 	}
+	// join the swarm with the torrent generated by other seeder, the local data only need to be verified
+	joinTo, joinBase64, err := th.joinStoredTorrent(ctx, digest)
+	if err != nil {
+		logger.WarnContextf(ctx, "join stored torrent failed and will generate new one: %s", err.Error())
+	} else if joinTo != nil {
+		logger.InfoContextf(ctx, "join stored torrent success")
+		return joinBase64, nil
+	}
+
 	var serveTo *torrent.Torrent
-	var err error
 	generateRetry := 3
 	for i := 0; i < generateRetry; i++ {
 		serveTo, err = th.generateServeTorrent(ctx, digest, torrentFile)
 		if err != nil {
 			return "", errors.Wrapf(err, "generate serve torrent failed")
 		}
-		v, _ := th.CheckTorrentLocalExist(ctx, digest)
+		v, _ := th.localTorrent(ctx, digest)
 		if v != nil {
 			logger.InfoContextf(ctx, "check torrent exist in db")
 			break
@@ -183,7 +191,86 @@ func (th *TorrentHandler) handleGenerateTorrent(ctx context.Context, digest, sou
 	}
 	torrentBase64 = base64.StdEncoding.EncodeToString(buffer.Bytes())
 	logger.InfoContextf(ctx, "generate serve torrent success")
-	return torrentBase64, nil
+	storedBase64, err := th.cacheStore.SaveTorrent(ctx, digest, torrentBase64)
+	if err != nil {
+		logger.WarnContextf(ctx, "save torrent into cache store failed: %s", err.Error())
+		return torrentBase64, nil
+	}
+	if storedBase64 == torrentBase64 {
+		return torrentBase64, nil
+	}
+	// the torrent is saved by other seeder at the same time, adopt it to join the same swarm
+	joinTo, joinBase64, err = th.joinStoredTorrent(ctx, digest)
+	if err != nil || joinTo == nil {
+		logger.WarnContextf(ctx, "adopt the torrent saved by other seeder failed: %v", err)
+		return torrentBase64, nil
+	}
+	logger.InfoContextf(ctx, "adopt the torrent saved by other seeder success")
+	return joinBase64, nil
+}
+
+// joinStoredTorrent adds the torrent stored in cache store and verifies the local data of it. Returns nil
+// if there is no stored torrent.
+func (th *TorrentHandler) joinStoredTorrent(ctx context.Context, digest string) (*torrent.Torrent, string, error) {
+	torrentBase64, err := th.cacheStore.GetTorrent(ctx, digest)
+	if err != nil {
+		return nil, "", err
+	}
+	if torrentBase64 == "" {
+		return nil, "", nil
+	}
+	mi, err := loadMetainfo(torrentBase64)
+	if err != nil {
+		return nil, "", err
+	}
+	// drop the local torrent which not same as the stored one
+	if to, _ := th.localTorrent(ctx, digest); to != nil && to.InfoHash() != mi.HashInfoBytes() {
+		th.dropTorrent(ctx, digest, to, dropReasonStaleInfoHash)
+	}
+	to, err := th.addTorrent(ctx, digest, mi, addReasonStored)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "add stored torrent failed")
+	}
+	if err = th.gotTorrentInfo(to); err != nil {
+		th.dropTorrent(ctx, digest, to, dropReasonInfoTimeout)
+		return nil, "", err
+	}
+	if err = to.VerifyDataContext(ctx); err != nil {
+		th.dropTorrent(ctx, digest, to, dropReasonVerifyFailed)
+		return nil, "", errors.Wrapf(err, "verify torrent data failed")
+	}
+	if to.BytesCompleted() != to.Length() {
+		th.dropTorrent(ctx, digest, to, dropReasonIncomplete)
+		return nil, "", errors.Errorf("local data not match the stored torrent, completed %d/%d",
+			to.BytesCompleted(), to.Length())
+	}
+	return to, torrentBase64, nil
+}
+
+func loadMetainfo(torrentBase64 string) (*metainfo.MetaInfo, error) {
+	torrentBytes, err := base64.StdEncoding.DecodeString(torrentBase64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "base64 decode '%s' failed", torrentBase64)
+	}
+	mi, err := metainfo.Load(bytes.NewBuffer(torrentBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "load metainfo '%s' failed", torrentBase64)
+	}
+	return mi, nil
+}
+
+// TorrentProgress returns the completed and total bytes of the torrent in client, returns zero if the
+// torrent is not added or its info is not got yet
+func (th *TorrentHandler) TorrentProgress(torrentBase64 string) (int64, int64) {
+	mi, err := loadMetainfo(torrentBase64)
+	if err != nil {
+		return 0, 0
+	}
+	t, ok := th.client.Torrent(mi.HashInfoBytes())
+	if !ok || t.Info() == nil {
+		return 0, 0
+	}
+	return t.BytesCompleted(), t.Length()
 }
 
 func (th *TorrentHandler) generateServeTorrent(ctx context.Context, digest, layerFile string) (*torrent.Torrent, error) {
@@ -203,7 +290,7 @@ func (th *TorrentHandler) generateServeTorrent(ctx context.Context, digest, laye
 	}
 	logger.InfoContextf(ctx, "load torrent metainfor from file '%s' success", layerFile)
 	mi.AnnounceList = [][]string{{th.op.TorrentConfig.Announce}}
-	to, err := th.client.AddTorrent(mi)
+	to, err := th.addTorrent(ctx, digest, mi, addReasonServe)
 	if err != nil {
 		return nil, errors.Wrapf(err, "add torrent to metainfo failed")
 	}
@@ -223,8 +310,31 @@ func (th *TorrentHandler) generateServeTorrent(ctx context.Context, digest, laye
 	return to, nil
 }
 
-// CheckTorrentLocalExist check torrent local exist
+// CheckTorrentLocalExist check torrent local exist. The local torrent is treated as not exist if it is
+// not the same as the torrent stored in cache store, it should join the stored one.
 func (th *TorrentHandler) CheckTorrentLocalExist(ctx context.Context, digest string) (*torrent.Torrent, string) {
+	to, torrentBase64 := th.localTorrent(ctx, digest)
+	if to == nil {
+		return nil, ""
+	}
+	storedBase64, err := th.cacheStore.GetTorrent(ctx, digest)
+	if err != nil {
+		logger.WarnContextf(ctx, "get torrent from cache store failed: %s", err.Error())
+		return to, torrentBase64
+	}
+	if storedBase64 == "" {
+		if storedBase64, err = th.cacheStore.SaveTorrent(ctx, digest, torrentBase64); err != nil {
+			logger.WarnContextf(ctx, "save torrent into cache store failed: %s", err.Error())
+			return to, torrentBase64
+		}
+	}
+	if mi, err := loadMetainfo(storedBase64); err == nil && mi.HashInfoBytes() != to.InfoHash() {
+		return nil, ""
+	}
+	return to, torrentBase64
+}
+
+func (th *TorrentHandler) localTorrent(ctx context.Context, digest string) (*torrent.Torrent, string) {
 	torrentObjs, torrentStrings := th.returnLocalTorrents(ctx)
 	return torrentObjs[digest], torrentStrings[digest]
 }
@@ -265,8 +375,11 @@ func (th *TorrentHandler) gotTorrentInfo(t *torrent.Torrent) error {
 	}
 }
 
-func (th *TorrentHandler) DownloadTorrent(ctx context.Context, digest, torrentBase64, targetPath string) error {
-	err := th.handleDownloadTorrent(ctx, digest, torrentBase64, targetPath)
+// DownloadTorrent downloads the layer with torrent into targetPath, the holes of downloaded file are
+// repaired with fetcher if they cannot be downloaded with torrent
+func (th *TorrentHandler) DownloadTorrent(ctx context.Context, digest, torrentBase64, targetPath string,
+	fetcher RangeFetcher) error {
+	err := th.handleDownloadTorrent(ctx, digest, torrentBase64, targetPath, fetcher)
 	if err != nil {
 		metrics.TorrentOperationsTotal.WithLabelValues("download", "error").Inc()
 	} else {
@@ -275,12 +388,37 @@ func (th *TorrentHandler) DownloadTorrent(ctx context.Context, digest, torrentBa
 	return err
 }
 
-// DownloadTorrent download the file by torrent
-func (th *TorrentHandler) handleDownloadTorrent(ctx context.Context, digest, torrentBase64, targetPath string) error {
+func (th *TorrentHandler) handleDownloadTorrent(ctx context.Context, digest, torrentBase64, targetPath string,
+	fetcher RangeFetcher) error {
 	if err := th.downloadTorrent(ctx, digest, torrentBase64); err != nil {
 		return err
 	}
+	return th.linkTorrentFile(ctx, digest, targetPath, fetcher)
+}
+
+type linkGateKey struct{}
+
+// WithLinkGate returns the context which gates the layer downloaded into target path, the layer is put
+// into target path only if gate returns true. It is used when the layer is downloaded with multiple methods
+// at the same time, only the first completed is put into target path.
+func WithLinkGate(ctx context.Context, gate func() bool) context.Context {
+	return context.WithValue(ctx, linkGateKey{}, gate)
+}
+
+// LinkAllowed returns whether the layer downloaded is allowed to put into target path
+func LinkAllowed(ctx context.Context) bool {
+	gate, ok := ctx.Value(linkGateKey{}).(func() bool)
+	return !ok || gate()
+}
+
+// linkTorrentFile links the downloaded torrent file to target path, it is copied if cross-device. The
+// holes of file are repaired before linking, it fails only if the file is still sparse.
+func (th *TorrentHandler) linkTorrentFile(ctx context.Context, digest, targetPath string,
+	fetcher RangeFetcher) error {
 	torrentFile := path.Join(th.op.StorageConfig.TorrentPath, utils.LayerFileName(digest))
+	if err := th.repairTorrentFile(ctx, digest, torrentFile, fetcher); err != nil {
+		return err
+	}
 	logical, physical, isSparse, err := utils.IsSparseFile(torrentFile)
 	if err != nil {
 		return errors.Wrapf(err, "check sparse file failed")
@@ -291,23 +429,22 @@ func (th *TorrentHandler) handleDownloadTorrent(ctx context.Context, digest, tor
 	}
 	logger.InfoContextf(ctx, "torrent file '%s' is normal, logical: %d, physical: %d",
 		torrentFile, logical, physical)
-	if err = utils.CopyFile(torrentFile, targetPath); err != nil {
+	if !LinkAllowed(ctx) {
+		return errors.Errorf("layer '%s' is already downloaded by other method, not link", digest)
+	}
+	if err = utils.LinkOrCopyFile(torrentFile, targetPath); err != nil {
 		return err
 	}
-	logger.InfoContextf(ctx, "copy torrent file %s to %s success", torrentFile, targetPath)
+	logger.InfoContextf(ctx, "link torrent file %s to %s success", torrentFile, targetPath)
 	return nil
 }
 
 func (th *TorrentHandler) downloadTorrent(ctx context.Context, digest, torrentBase64 string) error {
-	torrentBytes, err := base64.StdEncoding.DecodeString(torrentBase64)
+	mi, err := loadMetainfo(torrentBase64)
 	if err != nil {
-		return errors.Wrapf(err, "base64 decode '%s' failed", torrentBase64)
-	}
-	mi, err := metainfo.Load(bytes.NewBuffer(torrentBytes))
-	if err != nil {
-		return errors.Wrapf(err, "load metainfo '%s' failed", torrentBase64)
+		return err
 	}
-	t, err := th.client.AddTorrent(mi)
+	t, err := th.addTorrent(ctx, digest, mi, addReasonDownload)
 	if err != nil {
 		return errors.Wrapf(err, "add torrent '%s' failed", torrentBase64)
 	}
@@ -8,6 +8,7 @@ package cleaner
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -29,19 +30,24 @@ type ImageCleaner interface {
 }
 
 type imageCleaner struct {
-	op       *options.AccelerBoatOption
 	cronExpr string
 	cronObj  *cron.Cron
 }
 
-func NewImageCleaner(op *options.AccelerBoatOption) ImageCleaner {
+func NewImageCleaner() ImageCleaner {
 	return &imageCleaner{
-		op:       op,
-		cronExpr: op.CleanConfig.Cron,
+		cronExpr: options.GlobalOptions().CleanConfig.Cron,
 	}
 }
 
+// op returns the current snapshot of options, the cleaner lives across config reloads so it is not kept
+func (c *imageCleaner) op() *options.AccelerBoatOption {
+	return options.GlobalOptions()
+}
+
 func (c *imageCleaner) Init() error {
+	// the partial files left by the crashed process are never resumed
+	cleanStalePartFiles(context.Background(), c.op().StorageConfig.DownloadPath)
 	if c.cronExpr == "" {
 		return nil
 	}
@@ -59,8 +65,9 @@ func (c *imageCleaner) Init() error {
 }
 
 func (c *imageCleaner) runClean(ctx context.Context) error {
-	cfg := &c.op.CleanConfig
-	storage := &c.op.StorageConfig
+	cfg := &c.op().CleanConfig
+	storage := &c.op().StorageConfig
+	cleanStalePartFiles(ctx, storage.DownloadPath)
 	dirs := []struct {
 		label string
 		dir   string
@@ -81,7 +88,7 @@ func (c *imageCleaner) runClean(ctx context.Context) error {
 		}
 	}
 	// logger.InfoContextf(ctx, "[clean] disk used: %.2fGB, threshold: %dGB", totalGB, cfg.Threshold)
-	digestLastUsed := buildDigestLastUsedFromEvents(c.op.StorageConfig.EventFile, c.op.CleanConfig.RetainDays)
+	digestLastUsed := buildDigestLastUsed(c.op().CleanConfig.RetainDays)
 	candidates, err := collectLayerFilesWithLRU(dirs, digestLastUsed)
 	if err != nil {
 		return errors.Wrap(err, "collect layer files with lru failed")
@@ -103,6 +110,7 @@ func (c *imageCleaner) runClean(ctx context.Context) error {
 		}
 		freedGB += c.sizeGB
 		logger.InfoContextf(ctx, "[clean] removed layer file %s (%.4g GB)", c.path, c.sizeGB)
+		recordLayerEvicted(ctx, c, totalGB, cfg.Threshold)
 	}
 	if freedGB > 0 {
 		logger.InfoContextf(ctx, "[clean] freed %.4g GB (total was %.4g GB, threshold %d GB)",
@@ -111,6 +119,64 @@ func (c *imageCleaner) runClean(ctx context.Context) error {
 	return nil
 }
 
+// stalePartFileAge the partial file not modified within the duration is stale, the transfer writing it is
+// broken or the process writing it crashed
+const stalePartFileAge = time.Hour
+
+// isPartFile returns whether the file is the partial file of layer transfer or import
+func isPartFile(name string) bool {
+	return strings.HasSuffix(name, ".part") || strings.Contains(name, ".import-")
+}
+
+// cleanStalePartFiles removes the stale partial files under dir
+func cleanStalePartFiles(ctx context.Context, dir string) {
+	if dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.ErrorContextf(ctx, "[clean] read dir %s failed: %s", dir, err.Error())
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isPartFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < stalePartFileAge {
+			continue
+		}
+		fp := filepath.Join(dir, entry.Name())
+		if err = os.Remove(fp); err != nil && !os.IsNotExist(err) {
+			logger.ErrorContextf(ctx, "[clean] remove stale part file %s failed: %s", fp, err.Error())
+			continue
+		}
+		logger.InfoContextf(ctx, "[clean] removed stale part file %s, last modified at %s", fp,
+			info.ModTime().Format(time.RFC3339))
+	}
+}
+
+// recordLayerEvicted records the layer_evicted event, the reason tells whether the layer has no recent use
+// recorded in events or only evicted as least recently used
+func recordLayerEvicted(ctx context.Context, lf *layerFile, totalGB float64, threshold int64) {
+	reason := "lru"
+	lastUsed := "-"
+	if lf.lastUsed.IsZero() {
+		reason = "no_recent_use"
+	} else {
+		lastUsed = lf.lastUsed.Format(time.RFC3339)
+	}
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeLayerEvicted,
+		EventStatus: recorder.Normal,
+		Details: map[string]interface{}{
+			"digest": lf.digest, "size": lf.size, "reason": reason, "dir": lf.label,
+			"file": lf.path, "lastUsed": lastUsed,
+		},
+		Message: fmt.Sprintf("Layer evicted because disk used %.2fGB exceeds threshold %dGB", totalGB, threshold),
+	})
+}
+
 func (c *imageCleaner) totalDiskUsed(dirs []struct {
 	label string
 	dir   string
@@ -127,61 +193,15 @@ func (c *imageCleaner) totalDiskUsed(dirs []struct {
 	return float64(total) / bytesPerGB
 }
 
-const (
-	// listEventsLimit is the max events to read from event file for LRU ordering.
-	listEventsLimit = 500000
-)
-
-// buildDigestLastUsedFromEvents reads events (from recorder when event file is set) and returns
-// digest -> latest timestamp for blob-related events that carry a digest in Details.
-func buildDigestLastUsedFromEvents(eventFile string, retainDays int64) map[string]time.Time {
-	out := make(map[string]time.Time)
-	var events []recorder.Event
-	if eventFile != "" {
-		var startTime *time.Time
-		if retainDays != 0 {
-			t := time.Now().Add(-time.Duration(retainDays) * 24 * time.Hour)
-			startTime = &t
-		}
-		events = recorder.Global.List(listEventsLimit, []string{
-			string(recorder.EventServeBlobFromLocal),
-			string(recorder.EventTypeGetBlobFromMaster),
-			string(recorder.EventTypeDownloadBlobByTCP),
-			string(recorder.EventTypeDownloadBlobByTorrent),
-		}, startTime)
-	}
-	blobTypes := map[recorder.EventType]bool{
-		recorder.EventServeBlobFromLocal:        true,
-		recorder.EventTypeGetBlobFromMaster:     true,
-		recorder.EventTypeDownloadBlobByTCP:     true,
-		recorder.EventTypeDownloadBlobByTorrent: true,
-	}
-	for _, e := range events {
-		if !blobTypes[e.Type] {
-			continue
-		}
-		digest := digestFromDetails(e.Details)
-		if digest == "" {
-			continue
-		}
-		norm := normalizeDigest(digest)
-		if e.Timestamp.After(out[norm]) {
-			out[norm] = e.Timestamp
-		}
-	}
-	return out
-}
-
-func digestFromDetails(details map[string]interface{}) string {
-	if details == nil {
-		return ""
-	}
-	v, ok := details["digest"]
-	if !ok {
-		return ""
+// buildDigestLastUsed returns digest -> last used of the layers from the usage index of recorder, the layers
+// not used within retainDays are omitted
+func buildDigestLastUsed(retainDays int64) map[string]time.Time {
+	var since *time.Time
+	if retainDays != 0 {
+		t := time.Now().Add(-time.Duration(retainDays) * 24 * time.Hour)
+		since = &t
 	}
-	s, _ := v.(string)
-	return strings.TrimSpace(s)
+	return recorder.Global.LayerUsage(since)
 }
 
 func normalizeDigest(d string) string {
@@ -193,7 +213,10 @@ func normalizeDigest(d string) string {
 }
 
 type layerFile struct {
+	label    string
 	path     string
+	digest   string
+	size     int64
 	sizeGB   float64
 	lastUsed time.Time
 }
@@ -220,7 +243,10 @@ func collectLayerFilesWithLRU(dirs []struct{ label, dir string }, digestLastUsed
 			digest := digestFromLayerFileName(de.Name(), d.label == "oci")
 			lastUsed := digestLastUsed[normalizeDigest(digest)]
 			out = append(out, &layerFile{
+				label:    d.label,
 				path:     entryPath,
+				digest:   digest,
+				size:     info.Size(),
 				sizeGB:   float64(info.Size()) / bytesPerGB,
 				lastUsed: lastUsed,
 			})
@@ -0,0 +1,192 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package clientquota identifies the clients of proxied registry requests and enforces the per-client
+// concurrency and bandwidth quotas.
+package clientquota
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+// ClientID returns the identification of request client. The CN of verified client cert is used for cert
+// identification, otherwise the source IP.
+func ClientID(req *http.Request, identifyBy options.ClientIdentifyType) string {
+	if identifyBy == options.ClientIdentifyCert && req.TLS != nil && len(req.TLS.VerifiedChains) != 0 {
+		if cn := req.TLS.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+			return cn
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// clientIdleExpiration the expiration of idle client state, the metric labels of client are deleted
+// together with the state
+const clientIdleExpiration = 10 * time.Minute
+
+type clientState struct {
+	quota   options.ClientQuota
+	sem     chan struct{}
+	limiter *rate.Limiter
+	// active the number of requests of client which are not finished
+	active atomic.Int64
+}
+
+func newClientState(quota options.ClientQuota) *clientState {
+	cs := &clientState{quota: quota}
+	if quota.MaxConcurrency > 0 {
+		cs.sem = make(chan struct{}, quota.MaxConcurrency)
+	}
+	if quota.BandwidthLimit > 0 {
+		bytesPerSecond := int(quota.BandwidthLimit * options.MB)
+		cs.limiter = rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)
+	}
+	return cs
+}
+
+// Manager holds the quota states of all clients, the idle clients are evicted after expiration
+type Manager struct {
+	sync.Mutex
+	clients *cache.Cache
+}
+
+// NewManager create the client quota manager
+func NewManager() *Manager {
+	m := &Manager{clients: cache.New(clientIdleExpiration, time.Minute)}
+	m.clients.OnEvicted(m.evicted)
+	return m
+}
+
+// Global is the global client quota manager
+var Global = NewManager()
+
+// state returns the client state, it is re-created if the quota of client changed. The expiration of
+// client is refreshed on every access.
+func (m *Manager) state(clientID string, quota options.ClientQuota) *clientState {
+	m.Lock()
+	defer m.Unlock()
+	var cs *clientState
+	if v, ok := m.clients.Get(clientID); ok {
+		cs = v.(*clientState)
+	}
+	if cs == nil || cs.quota != quota {
+		cs = newClientState(quota)
+	}
+	m.clients.SetDefault(clientID, cs)
+	return cs
+}
+
+// evicted deletes the metric labels of the expired client. The client which still has requests in
+// flight, e.g. a long blob download, is put back to keep its concurrency slots.
+func (m *Manager) evicted(clientID string, v interface{}) {
+	cs := v.(*clientState)
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.clients.Get(clientID); ok {
+		return
+	}
+	if cs.active.Load() > 0 {
+		m.clients.SetDefault(clientID, cs)
+		return
+	}
+	labels := prometheus.Labels{"client": clientID}
+	metrics.ClientRequestsTotal.DeletePartialMatch(labels)
+	metrics.ClientBytesTotal.DeletePartialMatch(labels)
+	metrics.ClientThrottledTotal.DeletePartialMatch(labels)
+}
+
+// Acquire waits for the concurrency slot of client, returns the release function. The request waits in
+// queue until the slot is released or the context is done.
+func (m *Manager) Acquire(ctx context.Context, clientID string, quota options.ClientQuota) (func(), error) {
+	cs := m.state(clientID, quota)
+	cs.active.Add(1)
+	done := func() { cs.active.Add(-1) }
+	if cs.sem == nil {
+		return done, nil
+	}
+	select {
+	case cs.sem <- struct{}{}:
+	default:
+		metrics.ClientThrottledTotal.WithLabelValues(clientID, "concurrency").Inc()
+		select {
+		case cs.sem <- struct{}{}:
+		case <-ctx.Done():
+			done()
+			return nil, errors.Errorf("client '%s' exceeds max concurrency %d", clientID, quota.MaxConcurrency)
+		}
+	}
+	return func() {
+		<-cs.sem
+		done()
+	}, nil
+}
+
+// LimitWriter returns the response writer limited by the bandwidth quota of client, the written bytes
+// are counted into client metrics.
+func (m *Manager) LimitWriter(ctx context.Context, clientID string, quota options.ClientQuota,
+	rw http.ResponseWriter) http.ResponseWriter {
+	return &limitedWriter{
+		ResponseWriter: rw,
+		ctx:            ctx,
+		clientID:       clientID,
+		limiter:        m.state(clientID, quota).limiter,
+	}
+}
+
+type limitedWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	clientID string
+	limiter  *rate.Limiter
+}
+
+// Write writes the bytes in chunks no larger than the limiter burst
+func (w *limitedWriter) Write(bs []byte) (int, error) {
+	if w.limiter == nil {
+		n, err := w.ResponseWriter.Write(bs)
+		metrics.ClientBytesTotal.WithLabelValues(w.clientID).Add(float64(n))
+		return n, err
+	}
+	var written int
+	for len(bs) > 0 {
+		chunk := len(bs)
+		if burst := w.limiter.Burst(); chunk > burst {
+			chunk = burst
+		}
+		if err := w.limiter.WaitN(w.ctx, chunk); err != nil {
+			return written, errors.Wrapf(err, "client '%s' bandwidth limit wait failed", w.clientID)
+		}
+		n, err := w.ResponseWriter.Write(bs[:chunk])
+		written += n
+		metrics.ClientBytesTotal.WithLabelValues(w.clientID).Add(float64(n))
+		if err != nil {
+			return written, err
+		}
+		bs = bs[chunk:]
+	}
+	return written, nil
+}
+
+func (w *limitedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
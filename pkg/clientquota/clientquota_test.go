@@ -0,0 +1,145 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package clientquota
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		quota    options.ClientQuota
+		acquires int
+		want     int
+	}{
+		{name: "no concurrency limit", quota: options.ClientQuota{}, acquires: 5, want: 5},
+		{name: "within concurrency", quota: options.ClientQuota{MaxConcurrency: 3}, acquires: 3, want: 3},
+		{name: "exceeds concurrency", quota: options.ClientQuota{MaxConcurrency: 2}, acquires: 4, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			clientID := "acquire-" + tt.name
+			releases := make([]func(), 0, tt.acquires)
+			for i := 0; i < tt.acquires; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				release, err := m.Acquire(ctx, clientID, tt.quota)
+				cancel()
+				if err == nil {
+					releases = append(releases, release)
+				}
+			}
+			if len(releases) != tt.want {
+				t.Fatalf("acquired %d, want %d", len(releases), tt.want)
+			}
+			cs := m.state(clientID, tt.quota)
+			if active := cs.active.Load(); active != int64(tt.want) {
+				t.Errorf("active = %d, want %d", active, tt.want)
+			}
+			for _, release := range releases {
+				release()
+			}
+			if active := cs.active.Load(); active != 0 {
+				t.Errorf("active = %d after released, want 0", active)
+			}
+			if tt.quota.MaxConcurrency > 0 {
+				release, err := m.Acquire(context.Background(), clientID, tt.quota)
+				if err != nil {
+					t.Fatalf("acquire after released failed: %s", err.Error())
+				}
+				release()
+			}
+		})
+	}
+}
+
+func TestStateQuotaChanged(t *testing.T) {
+	m := NewManager()
+	quota := options.ClientQuota{MaxConcurrency: 1}
+	cs := m.state("state-client", quota)
+	if m.state("state-client", quota) != cs {
+		t.Errorf("state re-created with the same quota")
+	}
+	if m.state("state-client", options.ClientQuota{MaxConcurrency: 2}) == cs {
+		t.Errorf("state not re-created with the changed quota")
+	}
+}
+
+func TestEvicted(t *testing.T) {
+	tests := []struct {
+		name       string
+		active     bool
+		wantKept   bool
+		wantSeries int
+	}{
+		{name: "idle client", active: false, wantKept: false, wantSeries: 0},
+		{name: "client in flight", active: true, wantKept: true, wantSeries: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			clientID := "evicted-" + tt.name
+			quota := options.ClientQuota{MaxConcurrency: 1}
+			release, err := m.Acquire(context.Background(), clientID, quota)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metrics.ClientRequestsTotal.WithLabelValues(clientID, "200").Inc()
+			if _, err = m.LimitWriter(context.Background(), clientID, quota, httptest.NewRecorder()).
+				Write([]byte("x")); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.active {
+				release()
+			}
+			// the eviction of expired client is the same as deleted
+			m.clients.Delete(clientID)
+
+			if _, kept := m.clients.Get(clientID); kept != tt.wantKept {
+				t.Errorf("client kept = %v, want %v", kept, tt.wantKept)
+			}
+			if n := clientSeries(metrics.ClientRequestsTotal, clientID); n != tt.wantSeries {
+				t.Errorf("series of client requests = %d, want %d", n, tt.wantSeries)
+			}
+			if n := clientSeries(metrics.ClientBytesTotal, clientID); n != tt.wantSeries {
+				t.Errorf("series of client bytes = %d, want %d", n, tt.wantSeries)
+			}
+			if tt.active {
+				release()
+			}
+		})
+	}
+}
+
+// clientSeries returns the number of series of client in the counter vec
+func clientSeries(vec *prometheus.CounterVec, clientID string) int {
+	ch := make(chan prometheus.Metric, testutil.CollectAndCount(vec))
+	vec.Collect(ch)
+	close(ch)
+	count := 0
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			continue
+		}
+		for _, label := range pb.GetLabel() {
+			if label.GetName() == "client" && label.GetValue() == clientID {
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,280 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package cosign verifies the cosign signatures of image manifests. The signatures are fetched from the
+// "sha256-<hex>.sig" tag of the same repository which is the default storage of cosign.
+package cosign
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+)
+
+const (
+	signatureAnnotation   = "dev.cosignproject.cosign/signature"
+	certificateAnnotation = "dev.sigstore.cosign/certificate"
+	chainAnnotation       = "dev.sigstore.cosign/chain"
+	bundleAnnotation      = "dev.sigstore.cosign/bundle"
+)
+
+var (
+	// oidIssuerV1 is the raw string OIDC issuer extension of Fulcio certificate
+	oidIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	// oidIssuerV2 is the DER encoded OIDC issuer extension of Fulcio certificate
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+var (
+	// ErrNotFound should be wrapped by the errors of Fetcher if the manifest or blob not exists
+	ErrNotFound = errors.New("not found")
+	// ErrVerifyFailed is wrapped by the errors of Verify if the manifest not signed or the signatures are
+	// invalid, the other errors (e.g. the fetch failures) are not the verification result
+	ErrVerifyFailed = errors.New("signature verify failed")
+)
+
+// Fetcher fetches the signature manifest and payload blobs from the registry
+type Fetcher interface {
+	FetchManifest(ctx context.Context, reference string) ([]byte, error)
+	FetchBlob(ctx context.Context, dgst digest.Digest) ([]byte, error)
+}
+
+// Verifier verifies the signatures with public keys or keyless identities
+type Verifier struct {
+	publicKeys []crypto.PublicKey
+	identities []*options.KeylessIdentity
+	roots      *x509.CertPool
+}
+
+// NewVerifier creates the verifier with the signature verification config
+func NewVerifier(cfg *options.SignatureVerification) (*Verifier, error) {
+	v := &Verifier{
+		identities: cfg.KeylessIdentities,
+	}
+	for i, key := range cfg.PublicKeys {
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return nil, errors.Errorf("decode public key[%d] failed", i)
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse public key[%d] failed", i)
+		}
+		v.publicKeys = append(v.publicKeys, pub)
+	}
+	if len(cfg.KeylessRoots) != 0 {
+		v.roots = x509.NewCertPool()
+		for i, root := range cfg.KeylessRoots {
+			if !v.roots.AppendCertsFromPEM([]byte(root)) {
+				return nil, errors.Errorf("parse keyless root[%d] failed", i)
+			}
+		}
+	}
+	return v, nil
+}
+
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+type signatureBundle struct {
+	Payload struct {
+		IntegratedTime int64 `json:"integratedTime"`
+	} `json:"Payload"`
+}
+
+// Verify verifies the manifest digest has at least one valid signature. The Rekor SignedEntryTimestamp
+// in bundle is not verified, its integrated time is only used to check the validity of the short-lived
+// keyless certificate. The error wraps ErrVerifyFailed only if the manifest not signed, or any signature
+// is invalid and none is valid.
+func (v *Verifier) Verify(ctx context.Context, fetcher Fetcher, manifestDigest digest.Digest) error {
+	sigTag := strings.Replace(manifestDigest.String(), ":", "-", 1) + ".sig"
+	bs, err := fetcher.FetchManifest(ctx, sigTag)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return errors.Wrapf(ErrVerifyFailed, "signature '%s' not found: %s", sigTag, err.Error())
+		}
+		return errors.Wrapf(err, "fetch signature '%s' failed", sigTag)
+	}
+	sigManifest := &ocispec.Manifest{}
+	if err = json.Unmarshal(bs, sigManifest); err != nil {
+		return errors.Wrapf(ErrVerifyFailed, "unmarshal signature '%s' failed: %s", sigTag, err.Error())
+	}
+	if len(sigManifest.Layers) == 0 {
+		return errors.Wrapf(ErrVerifyFailed, "signature '%s' has no layers", sigTag)
+	}
+	errs := make([]string, 0, len(sigManifest.Layers))
+	verifyFailed := false
+	for _, layer := range sigManifest.Layers {
+		if err = v.verifyLayer(ctx, fetcher, manifestDigest, layer); err == nil {
+			return nil
+		}
+		verifyFailed = verifyFailed || errors.Is(err, ErrVerifyFailed)
+		errs = append(errs, err.Error())
+	}
+	if verifyFailed {
+		return errors.Wrapf(ErrVerifyFailed, "no valid signature: %s", strings.Join(errs, "; "))
+	}
+	return errors.Errorf("no signature verified: %s", strings.Join(errs, "; "))
+}
+
+func (v *Verifier) verifyLayer(ctx context.Context, fetcher Fetcher, manifestDigest digest.Digest,
+	layer ocispec.Descriptor) error {
+	sig, err := base64.StdEncoding.DecodeString(layer.Annotations[signatureAnnotation])
+	if err != nil || len(sig) == 0 {
+		return errors.Wrapf(ErrVerifyFailed, "layer '%s' signature annotation invalid", layer.Digest)
+	}
+	payload, err := fetcher.FetchBlob(ctx, layer.Digest)
+	if err != nil {
+		return errors.Wrapf(err, "fetch payload '%s' failed", layer.Digest)
+	}
+	if actual := digest.FromBytes(payload); actual != layer.Digest {
+		return errors.Wrapf(ErrVerifyFailed, "payload digest mismatch, expect '%s' but got '%s'",
+			layer.Digest, actual)
+	}
+	ss := &simpleSigning{}
+	if err = json.Unmarshal(payload, ss); err != nil {
+		return errors.Wrapf(ErrVerifyFailed, "unmarshal payload '%s' failed: %s", layer.Digest, err.Error())
+	}
+	if ss.Critical.Image.DockerManifestDigest != manifestDigest.String() {
+		return errors.Wrapf(ErrVerifyFailed, "payload '%s' signed for '%s'", layer.Digest,
+			ss.Critical.Image.DockerManifestDigest)
+	}
+
+	// the signature with keyless certificate might also be signed by the configured public keys, they
+	// are checked if the keyless verification failed
+	var keylessErr error
+	if certPEM := layer.Annotations[certificateAnnotation]; certPEM != "" {
+		var pub crypto.PublicKey
+		if pub, keylessErr = v.verifyCertificate(layer.Annotations); keylessErr == nil {
+			if keylessErr = verifySignature(pub, payload, sig); keylessErr == nil {
+				return nil
+			}
+		}
+	}
+	for _, pub := range v.publicKeys {
+		if err = verifySignature(pub, payload, sig); err == nil {
+			return nil
+		}
+	}
+	if keylessErr != nil {
+		return errors.Wrapf(ErrVerifyFailed, "layer '%s' keyless certificate invalid and not signed by any "+
+			"public key: %s", layer.Digest, keylessErr.Error())
+	}
+	return errors.Wrapf(ErrVerifyFailed, "layer '%s' not signed by any public key", layer.Digest)
+}
+
+// verifyCertificate verifies the keyless certificate chains to the roots and matches one of the
+// identities, returns the public key of the certificate
+func (v *Verifier) verifyCertificate(annotations map[string]string) (crypto.PublicKey, error) {
+	if v.roots == nil || len(v.identities) == 0 {
+		return nil, errors.Errorf("keyless verification not configured")
+	}
+	cert, err := parseCertificate(annotations[certificateAnnotation])
+	if err != nil {
+		return nil, err
+	}
+	bundle := &signatureBundle{}
+	if err = json.Unmarshal([]byte(annotations[bundleAnnotation]), bundle); err != nil ||
+		bundle.Payload.IntegratedTime == 0 {
+		return nil, errors.Errorf("bundle annotation missing or invalid")
+	}
+	intermediates := x509.NewCertPool()
+	if chain := annotations[chainAnnotation]; chain != "" {
+		intermediates.AppendCertsFromPEM([]byte(chain))
+	}
+	if _, err = cert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Unix(bundle.Payload.IntegratedTime, 0),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, errors.Wrapf(err, "verify certificate chain failed")
+	}
+	issuer := certificateIssuer(cert)
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	for _, identity := range v.identities {
+		if identity.Issuer != "" && identity.Issuer != issuer {
+			continue
+		}
+		for _, subject := range subjects {
+			if subject == identity.Subject {
+				return cert.PublicKey, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("certificate identity '%v' (issuer '%s') not allowed", subjects, issuer)
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, errors.Errorf("decode certificate failed")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse certificate failed")
+	}
+	return cert, nil
+}
+
+func certificateIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(oidIssuerV1):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+func verifySignature(pub crypto.PublicKey, payload, sig []byte) error {
+	hash := sha256.Sum256(payload)
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hash[:], sig) {
+			return errors.Errorf("ecdsa signature invalid")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig); err != nil {
+			return errors.Wrapf(err, "rsa signature invalid")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, payload, sig) {
+			return errors.Errorf("ed25519 signature invalid")
+		}
+	default:
+		return errors.Errorf("public key type '%T' not supported", pub)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package credprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	azureIMDSTokenURL  = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureIMDSVersion   = "2018-02-01"
+	azureResource      = "https://management.azure.com/"
+	azureLoginTokenURL = "https://login.microsoftonline.com/%s/oauth2/v2.0/token"
+	// acrUsername the username of ACR refresh token
+	acrUsername = "00000000-0000-0000-0000-000000000000"
+)
+
+// acrProvider exchanges the Azure AD access token of service principal or managed identity for the
+// refresh token of ACR
+type acrProvider struct {
+	registry     string
+	tenantID     string
+	clientID     string
+	clientSecret string
+}
+
+type azureAccessToken struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresIn is string in the response of IMDS
+	ExpiresIn json.Number `json:"expires_in"`
+}
+
+type acrExchangeResponse struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Credential implements Provider, the credential expires with the Azure AD access token
+func (p *acrProvider) Credential(ctx context.Context) (*Credential, error) {
+	var token *azureAccessToken
+	var err error
+	if p.clientSecret != "" {
+		token, err = p.servicePrincipalToken(ctx)
+	} else {
+		token, err = p.managedIdentityToken(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	expiresIn, err := token.ExpiresIn.Int64()
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse expires_in '%s' failed", token.ExpiresIn)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "access_token")
+	form.Set("service", p.registry)
+	form.Set("access_token", token.AccessToken)
+	if p.tenantID != "" {
+		form.Set("tenant", p.tenantID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("https://%s/oauth2/exchange", p.registry), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "create acr exchange request failed")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	result := new(acrExchangeResponse)
+	if err = doRequest(externalClient(), req, result); err != nil {
+		return nil, err
+	}
+	if result.RefreshToken == "" {
+		return nil, errors.Errorf("acr exchange responds empty refresh token")
+	}
+	return &Credential{
+		Username: acrUsername,
+		Password: result.RefreshToken,
+		ExpireAt: time.Now().Add(time.Duration(expiresIn) * time.Second),
+	}, nil
+}
+
+func (p *acrProvider) servicePrincipalToken(ctx context.Context) (*azureAccessToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", p.clientID)
+	form.Set("client_secret", p.clientSecret)
+	form.Set("scope", azureResource+".default")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(azureLoginTokenURL, p.tenantID),
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "create azure login request failed")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := new(azureAccessToken)
+	if err = doRequest(externalClient(), req, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (p *acrProvider) managedIdentityToken(ctx context.Context) (*azureAccessToken, error) {
+	query := url.Values{}
+	query.Set("api-version", azureIMDSVersion)
+	query.Set("resource", azureResource)
+	if p.clientID != "" {
+		query.Set("client_id", p.clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureIMDSTokenURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create imds request failed")
+	}
+	req.Header.Set("Metadata", "true")
+	token := new(azureAccessToken)
+	if err = doRequest(metadataClient(), req, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package credprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ecrTarget         = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+	stsVersion        = "2011-06-15"
+	stsRoleSession    = "accelerboat"
+	awsSigV4Algorithm = "AWS4-HMAC-SHA256"
+)
+
+// awsCredentials defines the credentials to sign the AWS api requests
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// ecrProvider exchanges the AWS credentials for the authorization token of ECR
+type ecrProvider struct {
+	region string
+}
+
+type ecrAuthorizationResponse struct {
+	AuthorizationData []struct {
+		AuthorizationToken string  `json:"authorizationToken"`
+		ExpiresAt          float64 `json:"expiresAt"`
+	} `json:"authorizationData"`
+}
+
+// Credential implements Provider, the username is always 'AWS'
+func (p *ecrProvider) Credential(ctx context.Context) (*Credential, error) {
+	creds, err := p.awsCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body := []byte("{}")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("https://api.ecr.%s.amazonaws.com/", p.region), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "create ecr request failed")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecrTarget)
+	signAWSRequest(req, body, creds, p.region, "ecr", time.Now().UTC())
+	result := new(ecrAuthorizationResponse)
+	if err = doRequest(externalClient(), req, result); err != nil {
+		return nil, err
+	}
+	if len(result.AuthorizationData) == 0 {
+		return nil, errors.Errorf("ecr response not have authorization data")
+	}
+	data := result.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decode ecr authorization token failed")
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, errors.Errorf("ecr authorization token not in 'user:password' format")
+	}
+	return &Credential{
+		Username: username,
+		Password: password,
+		ExpireAt: time.Unix(int64(data.ExpiresAt), 0),
+	}, nil
+}
+
+// awsCredentials returns the static credentials from environment, or assumes the role with web identity
+// token (e.g. IRSA of EKS)
+func (p *ecrProvider) awsCredentials(ctx context.Context) (*awsCredentials, error) {
+	if accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyID != "" {
+		return &awsCredentials{
+			accessKeyID:     accessKeyID,
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	roleARN := os.Getenv("AWS_ROLE_ARN")
+	tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if roleARN == "" || tokenFile == "" {
+		return nil, errors.Errorf("aws credentials not found, AWS_ACCESS_KEY_ID or AWS_ROLE_ARN with " +
+			"AWS_WEB_IDENTITY_TOKEN_FILE is required")
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read web identity token '%s' failed", tokenFile)
+	}
+	return p.assumeRoleWithWebIdentity(ctx, roleARN, strings.TrimSpace(string(token)))
+}
+
+type stsAssumeRoleResponse struct {
+	Credentials struct {
+		AccessKeyID     string `xml:"AccessKeyId"`
+		SecretAccessKey string `xml:"SecretAccessKey"`
+		SessionToken    string `xml:"SessionToken"`
+	} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+func (p *ecrProvider) assumeRoleWithWebIdentity(ctx context.Context, roleARN, token string) (*awsCredentials,
+	error) {
+	query := url.Values{}
+	query.Set("Action", "AssumeRoleWithWebIdentity")
+	query.Set("Version", stsVersion)
+	query.Set("RoleArn", roleARN)
+	query.Set("RoleSessionName", stsRoleSession)
+	query.Set("WebIdentityToken", token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("https://sts.%s.amazonaws.com/?%s", p.region, query.Encode()), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create sts request failed")
+	}
+	resp, err := externalClient().Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "assume role '%s' failed", roleARN)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read sts response failed")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("assume role '%s' response %d: %s", roleARN, resp.StatusCode, string(body))
+	}
+	result := new(stsAssumeRoleResponse)
+	if err = xml.Unmarshal(body, result); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal sts response failed")
+	}
+	return &awsCredentials{
+		accessKeyID:     result.Credentials.AccessKeyID,
+		secretAccessKey: result.Credentials.SecretAccessKey,
+		sessionToken:    result.Credentials.SessionToken,
+	}, nil
+}
+
+// signAWSRequest signs the request with AWS signature version 4, all the headers set before signing and
+// the host are signed
+func signAWSRequest(req *http.Request, body []byte, creds *awsCredentials, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+	values := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		values[strings.ToLower(k)] = strings.Join(strings.Fields(strings.Join(v, ",")), " ")
+	}
+	headers := make([]string, 0, len(values))
+	for h := range values {
+		headers = append(headers, h)
+	}
+	sort.Strings(headers)
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+	canonicalURI := req.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{req.Method, canonicalURI, canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payloadHash[:])}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{awsSigV4Algorithm, amzDate, scope,
+		hex.EncodeToString(requestHash[:])}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(creds.secretAccessKey, date, region, service),
+		stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigV4Algorithm, creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the query sorted by key and value, encoded with '%20' for space
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return awsURIEncode(keys[i]) < awsURIEncode(keys[j])
+	})
+	params := make([]string, 0, len(query))
+	for _, k := range keys {
+		vs := make([]string, 0, len(query[k]))
+		for _, v := range query[k] {
+			vs = append(vs, awsURIEncode(v))
+		}
+		sort.Strings(vs)
+		for _, v := range vs {
+			params = append(params, awsURIEncode(k)+"="+v)
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func awsURIEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// awsSigningKey derives the signing key of the date, region and service from secret access key
+func awsSigningKey(secretAccessKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
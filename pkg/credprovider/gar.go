@@ -0,0 +1,48 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package credprovider
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/" +
+		"default/token"
+	garUsername = "oauth2accesstoken"
+)
+
+// garProvider uses the access token of default service account from GCP metadata server
+type garProvider struct{}
+
+type gcpAccessToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Credential implements Provider
+func (p *garProvider) Credential(ctx context.Context) (*Credential, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create metadata request failed")
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	token := new(gcpAccessToken)
+	if err = doRequest(metadataClient(), req, token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.Errorf("metadata server responds empty access token")
+	}
+	return &Credential{
+		Username: garUsername,
+		Password: token.AccessToken,
+		ExpireAt: time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
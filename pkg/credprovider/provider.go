@@ -0,0 +1,146 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package credprovider mints and refreshes the upstream credentials of cloud registries, the credentials
+// are used as the username/password of registry mapping.
+package credprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	// refreshBefore the credential is refreshed if it expires within the duration
+	refreshBefore  = 5 * time.Minute
+	requestTimeout = 10 * time.Second
+)
+
+// Credential defines the credential minted by provider
+type Credential struct {
+	Username string
+	Password string
+	ExpireAt time.Time
+}
+
+// Provider defines the interface of credential provider
+type Provider interface {
+	// Credential mints a new credential for the registry
+	Credential(ctx context.Context) (*Credential, error)
+}
+
+// NewProvider returns the provider of registry mapping
+func NewProvider(mp *options.RegistryMapping) (Provider, error) {
+	cp := mp.CredentialProvider
+	switch cp.Type {
+	case options.CredentialProviderECR:
+		return &ecrProvider{region: cp.Region}, nil
+	case options.CredentialProviderGAR:
+		return &garProvider{}, nil
+	case options.CredentialProviderACR:
+		return &acrProvider{registry: mp.OriginalHostname(), tenantID: cp.TenantID, clientID: cp.ClientID,
+			clientSecret: cp.ClientSecret}, nil
+	default:
+		return nil, errors.Errorf("credential provider '%s' not supported", cp.Type)
+	}
+}
+
+type cachedCredential struct {
+	sync.Mutex
+	provider   Provider
+	credential *Credential
+}
+
+var (
+	credentialsLock sync.Mutex
+	credentials     = make(map[string]*cachedCredential)
+)
+
+func cacheKey(mp *options.RegistryMapping) string {
+	cp := mp.CredentialProvider
+	return fmt.Sprintf("%s,%s,%s,%s,%s", mp.OriginalHost, cp.Type, cp.Region, cp.TenantID, cp.ClientID)
+}
+
+// GetCredential returns the credential of registry mapping, returns nil if the mapping not have credential
+// provider. The credential is cached and minted again before it expires.
+func GetCredential(ctx context.Context, mp *options.RegistryMapping) (*options.RegistryAuth, error) {
+	if mp == nil || mp.CredentialProvider == nil {
+		return nil, nil
+	}
+	key := cacheKey(mp)
+	credentialsLock.Lock()
+	cc, ok := credentials[key]
+	if !ok {
+		provider, err := NewProvider(mp)
+		if err != nil {
+			credentialsLock.Unlock()
+			return nil, err
+		}
+		cc = &cachedCredential{provider: provider}
+		credentials[key] = cc
+	}
+	credentialsLock.Unlock()
+
+	cc.Lock()
+	defer cc.Unlock()
+	if cc.credential == nil || time.Until(cc.credential.ExpireAt) < refreshBefore {
+		timeoutCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+		credential, err := cc.provider.Credential(timeoutCtx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "mint credential with provider '%s' failed", mp.CredentialProvider.Type)
+		}
+		logger.InfoContextf(ctx, "mint credential with provider '%s' for '%s' success, expire at %s",
+			mp.CredentialProvider.Type, mp.OriginalHost, credential.ExpireAt.Format(time.RFC3339))
+		cc.credential = credential
+	}
+	return &options.RegistryAuth{Username: cc.credential.Username, Password: cc.credential.Password}, nil
+}
+
+// doRequest sends the request and decodes the json response into result
+func doRequest(client *http.Client, req *http.Request, result interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "request '%s' failed", req.URL.Host)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "read response of '%s' failed", req.URL.Host)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("request '%s' response %d: %s", req.URL.Host, resp.StatusCode,
+			strings.ReplaceAll(string(body), "\n", "\\n"))
+	}
+	if err = json.Unmarshal(body, result); err != nil {
+		return errors.Wrapf(err, "unmarshal response of '%s' failed", req.URL.Host)
+	}
+	return nil
+}
+
+// externalClient returns the client to request the cloud api with the proxy of options, the certificates
+// are verified because the cloud credentials are sent
+func externalClient() *http.Client {
+	tp := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if proxyURL := options.GlobalOptions().ExternalConfig.HTTPProxyUrl; proxyURL != nil {
+		tp.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Transport: tp}
+}
+
+// metadataClient returns the client to request the metadata server of node, proxy is not used
+func metadataClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{Proxy: nil}}
+}
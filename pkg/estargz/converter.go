@@ -0,0 +1,190 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package estargz converts the cached layers to eStargz(or zstd:chunked) for the lazy pulling of
+// stargz-snapshotter. The converted layers are put into the transfer path named by their digests, so they
+// are registered as static layers and distributed like the others, and the digests are mapped with the
+// original layers in cache store.
+package estargz
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/store"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+const layerSuffix = ".tar.gzip"
+
+// zstdChunkedCompression builds the layers in zstd:chunked format
+type zstdChunkedCompression struct {
+	*zstdchunked.Compressor
+	*zstdchunked.Decompressor
+}
+
+// Converter converts the cached layers to eStargz every scan interval
+type Converter struct {
+	cacheStore store.CacheStore
+	// handled the digests converted, converted from or failed, they are not converted again until restart
+	handled map[string]struct{}
+}
+
+// NewConverter creates the eStargz converter
+func NewConverter(cacheStore store.CacheStore) *Converter {
+	return &Converter{
+		cacheStore: cacheStore,
+		handled:    make(map[string]struct{}),
+	}
+}
+
+// Run converts the layers not converted every ScanInterval until ctx done
+func (c *Converter) Run(ctx context.Context) {
+	for {
+		op := options.GlobalOptions()
+		if op.Estargz.Enable {
+			c.convertAll(ctx, op)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(op.Estargz.ScanInterval) * time.Second):
+		}
+	}
+}
+
+// convertAll converts the layers in transfer path one by one, the conversion is cpu intensive
+func (c *Converter) convertAll(ctx context.Context, op *options.AccelerBoatOption) {
+	entries, err := os.ReadDir(op.StorageConfig.TransferPath)
+	if err != nil {
+		logger.WarnContextf(ctx, "read transfer path for estargz failed: %s", err.Error())
+		return
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, layerSuffix) {
+			continue
+		}
+		digest := strings.TrimSuffix(name, layerSuffix)
+		if _, ok := c.handled[digest]; ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() < op.Estargz.MinSize*options.MB {
+			continue
+		}
+		c.handled[digest] = struct{}{}
+		if layer, err := c.cacheStore.GetEstargzLayer(ctx, digest); err != nil || layer != nil {
+			if layer != nil {
+				c.handled[layer.Converted] = struct{}{}
+			}
+			continue
+		}
+		layer, err := convert(ctx, op, digest, filepath.Join(op.StorageConfig.TransferPath, name))
+		if err != nil {
+			metrics.EstargzConversionsTotal.WithLabelValues("failed").Inc()
+			logger.WarnContextf(ctx, "convert layer '%s' to estargz failed: %s", digest, err.Error())
+			continue
+		}
+		c.handled[layer.Converted] = struct{}{}
+		if err = c.cacheStore.SaveEstargzLayer(ctx, layer); err != nil {
+			logger.WarnContextf(ctx, "save estargz layer '%s' failed: %s", digest, err.Error())
+		}
+	}
+}
+
+// convert converts the layer file to eStargz in download path and moves it into transfer path, the layer
+// is only mapped to itself if it is eStargz already
+func convert(ctx context.Context, op *options.AccelerBoatOption, digest, file string) (*apitypes.EstargzLayer,
+	error) {
+	if tocDigest, err := ReadTOCDigest(file); err == nil {
+		var size int64
+		if fi, err := os.Stat(file); err == nil {
+			size = fi.Size()
+		}
+		metrics.EstargzConversionsTotal.WithLabelValues("already").Inc()
+		return &apitypes.EstargzLayer{Digest: digest, Converted: digest, TOCDigest: tocDigest, Size: size,
+			CreatedAt: time.Now(), Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: tocDigest}}, nil
+	}
+	start := time.Now()
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open layer file '%s' failed", file)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "stat layer file '%s' failed", file)
+	}
+	// the zstd:chunked compressor writes the manifest checksum and position into annotations
+	annotations := make(map[string]string)
+	var mediaType string
+	opts := []estargz.Option{estargz.WithContext(ctx)}
+	if op.Estargz.Compression == options.EstargzCompressionZstd {
+		mediaType = ocispec.MediaTypeImageLayerZstd
+		opts = append(opts, estargz.WithCompression(&zstdChunkedCompression{
+			Compressor:   &zstdchunked.Compressor{Metadata: annotations},
+			Decompressor: &zstdchunked.Decompressor{},
+		}))
+	}
+	blob, err := estargz.Build(io.NewSectionReader(f, 0, fi.Size()), opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "build estargz failed")
+	}
+	defer blob.Close()
+
+	tmpPath := path.Join(op.StorageConfig.DownloadPath, fmt.Sprintf("%s.estargz-%d", digest,
+		time.Now().UnixNano()))
+	out, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, op.StorageConfig.FilePerm())
+	if err != nil {
+		return nil, errors.Wrapf(err, "create file '%s' failed", tmpPath)
+	}
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hasher), blob)
+	_ = out.Close()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, errors.Wrapf(err, "write estargz file '%s' failed", tmpPath)
+	}
+	converted := hex.EncodeToString(hasher.Sum(nil))
+	destPath := path.Join(op.StorageConfig.TransferPath, utils.LayerFileName(converted))
+	if err = os.Rename(tmpPath, destPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, errors.Wrapf(err, "rename estargz file to '%s' failed", destPath)
+	}
+	metrics.EstargzConversionsTotal.WithLabelValues("converted").Inc()
+	logger.InfoContextf(ctx, "convert layer '%s' to estargz '%s' success, size: %d, cost: %v", digest, converted,
+		size, time.Since(start))
+	annotations[estargz.TOCJSONDigestAnnotation] = blob.TOCDigest().String()
+	return &apitypes.EstargzLayer{
+		Digest:      digest,
+		Converted:   converted,
+		TOCDigest:   blob.TOCDigest().String(),
+		DiffID:      blob.DiffID().String(),
+		Size:        size,
+		CreatedAt:   time.Now(),
+		MediaType:   mediaType,
+		Annotations: annotations,
+	}, nil
+}
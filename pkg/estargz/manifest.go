@@ -0,0 +1,126 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package estargz
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/store"
+)
+
+// ConvertedManifest defines the image manifest referencing the eStargz layers, the config is changed with
+// the diff ids of converted layers
+type ConvertedManifest struct {
+	Manifest  []byte
+	MediaType string
+	Config    []byte
+	// Layers the count of layers which can be lazy-pulled
+	Layers int
+}
+
+// rootFS defines the rootfs of image config, the other fields of config are kept as is
+type rootFS struct {
+	Type    string          `json:"type"`
+	DiffIDs []digest.Digest `json:"diff_ids"`
+}
+
+// ConvertManifest replaces the layers of image manifest with their eStargz layers and annotates them with
+// the TOC digests(and zstd:chunked manifest position), the layers not converted yet are kept. Returns nil
+// if no layer can be lazy-pulled.
+func ConvertManifest(ctx context.Context, cacheStore store.CacheStore, manifest, config []byte) (
+	*ConvertedManifest, error) {
+	m := &ocispec.Manifest{}
+	if err := json.Unmarshal(manifest, m); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal manifest failed")
+	}
+	cfg := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal image config failed")
+	}
+	rootfs := &rootFS{}
+	if err := json.Unmarshal(cfg["rootfs"], rootfs); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal rootfs of image config failed")
+	}
+	if len(rootfs.DiffIDs) != len(m.Layers) {
+		return nil, errors.Errorf("image config has %d diff ids but manifest has %d layers",
+			len(rootfs.DiffIDs), len(m.Layers))
+	}
+
+	result := &ConvertedManifest{MediaType: m.MediaType}
+	var changeMediaType bool
+	for i := range m.Layers {
+		desc := &m.Layers[i]
+		layer, err := cacheStore.GetEstargzLayer(ctx, desc.Digest.Encoded())
+		if err != nil {
+			return nil, err
+		}
+		if layer == nil || layer.Digest != desc.Digest.Encoded() {
+			continue
+		}
+		result.Layers++
+		if desc.Annotations == nil {
+			desc.Annotations = make(map[string]string)
+		}
+		for k, v := range layer.Annotations {
+			desc.Annotations[k] = v
+		}
+		// the layer is eStargz already, only the annotations are added
+		if layer.Converted == layer.Digest {
+			continue
+		}
+		desc.Digest = digest.NewDigestFromEncoded(digest.SHA256, layer.Converted)
+		desc.Size = layer.Size
+		if layer.MediaType != "" && layer.MediaType != desc.MediaType {
+			desc.MediaType = layer.MediaType
+			changeMediaType = true
+		}
+		rootfs.DiffIDs[i] = digest.Digest(layer.DiffID)
+	}
+	if result.Layers == 0 {
+		return nil, nil
+	}
+	// the docker schema2 not defines the zstd layers, the manifest is changed to OCI
+	if changeMediaType && m.MediaType == images.MediaTypeDockerSchema2Manifest {
+		toOCIManifest(m)
+		result.MediaType = m.MediaType
+	}
+
+	bs, err := json.Marshal(rootfs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal rootfs failed")
+	}
+	cfg["rootfs"] = bs
+	if result.Config, err = json.Marshal(cfg); err != nil {
+		return nil, errors.Wrapf(err, "marshal image config failed")
+	}
+	m.Config.Digest = digest.FromBytes(result.Config)
+	m.Config.Size = int64(len(result.Config))
+	if result.Manifest, err = json.Marshal(m); err != nil {
+		return nil, errors.Wrapf(err, "marshal manifest failed")
+	}
+	return result, nil
+}
+
+// toOCIManifest changes the media types of docker schema2 manifest to OCI
+func toOCIManifest(m *ocispec.Manifest) {
+	m.MediaType = ocispec.MediaTypeImageManifest
+	if m.Config.MediaType == images.MediaTypeDockerSchema2Config {
+		m.Config.MediaType = ocispec.MediaTypeImageConfig
+	}
+	for i := range m.Layers {
+		switch m.Layers[i].MediaType {
+		case images.MediaTypeDockerSchema2LayerGzip:
+			m.Layers[i].MediaType = ocispec.MediaTypeImageLayerGzip
+		case images.MediaTypeDockerSchema2Layer:
+			m.Layers[i].MediaType = ocispec.MediaTypeImageLayer
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package estargz
+
+import (
+	"io"
+	"os"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
+	"github.com/pkg/errors"
+)
+
+// decompressors the formats of eStargz layers, they are detected by the footer
+var decompressors = []estargz.Decompressor{&estargz.GzipDecompressor{}, &zstdchunked.Decompressor{}}
+
+// ReadTOC reads the TOC of eStargz layer file with its footer, returns error if the file is not eStargz
+func ReadTOC(file string) (*estargz.JTOC, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "open layer file '%s' failed", file)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "stat layer file '%s' failed", file)
+	}
+	size := fi.Size()
+	for _, d := range decompressors {
+		footerSize := d.FooterSize()
+		if size < footerSize {
+			continue
+		}
+		footer := make([]byte, footerSize)
+		if _, err = f.ReadAt(footer, size-footerSize); err != nil {
+			return nil, "", errors.Wrapf(err, "read footer of '%s' failed", file)
+		}
+		_, tocOffset, tocSize, err := d.ParseFooter(footer)
+		if err != nil || tocOffset < 0 || tocOffset >= size-footerSize {
+			continue
+		}
+		if tocSize <= 0 {
+			tocSize = size - tocOffset - footerSize
+		}
+		toc, tocDigest, err := d.ParseTOC(io.NewSectionReader(f, tocOffset, tocSize))
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "parse toc of '%s' failed", file)
+		}
+		return toc, tocDigest.String(), nil
+	}
+	return nil, "", errors.Errorf("layer file '%s' is not estargz", file)
+}
+
+// ReadTOCDigest returns the TOC digest of eStargz layer file
+func ReadTOCDigest(file string) (string, error) {
+	_, tocDigest, err := ReadTOC(file)
+	return tocDigest, err
+}
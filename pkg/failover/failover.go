@@ -0,0 +1,184 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package failover selects the original host of registry mapping which has replicas. The hosts are tried in
+// priority order, the host failed is skipped until it is probed healthy again.
+package failover
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+const (
+	// probeInterval how often the unhealthy hosts are probed
+	probeInterval = 10 * time.Second
+	probeTimeout  = 5 * time.Second
+)
+
+var (
+	unhealthyLock sync.RWMutex
+	// unhealthy the hosts failed and not probed healthy yet, with the time they failed
+	unhealthy = make(map[string]time.Time)
+)
+
+// Hosts returns the original hosts of the mapping in priority order, the unhealthy hosts are moved to the
+// end. It returns the original host only if the mapping not have replicas.
+func Hosts(originalHost string) []string {
+	mp := options.GlobalOptions().FilterRegistryMappingByOriginal(originalHost)
+	if mp == nil || len(mp.Replicas) == 0 {
+		return []string{originalHost}
+	}
+	return orderHosts(mp.OriginalHosts())
+}
+
+// orderHosts moves the unhealthy hosts to the end, the order of hosts is kept otherwise
+func orderHosts(all []string) []string {
+	healthy := make([]string, 0, len(all))
+	failed := make([]string, 0)
+	unhealthyLock.RLock()
+	for _, host := range all {
+		if _, ok := unhealthy[host]; ok {
+			failed = append(failed, host)
+		} else {
+			healthy = append(healthy, host)
+		}
+	}
+	unhealthyLock.RUnlock()
+	return append(healthy, failed...)
+}
+
+// ActiveHost returns the host the requests of original host are sent to
+func ActiveHost(originalHost string) string {
+	return Hosts(originalHost)[0]
+}
+
+// MarkFailed marks the host unhealthy, it is skipped until probed healthy
+func MarkFailed(ctx context.Context, originalHost, host string, err error) {
+	if host == "" {
+		return
+	}
+	mp := options.GlobalOptions().FilterRegistryMappingByOriginal(originalHost)
+	if mp == nil || len(mp.Replicas) == 0 {
+		return
+	}
+	markUnhealthy(ctx, originalHost, host, err)
+}
+
+func markUnhealthy(ctx context.Context, originalHost, host string, err error) {
+	unhealthyLock.Lock()
+	_, exist := unhealthy[host]
+	unhealthy[host] = time.Now()
+	unhealthyLock.Unlock()
+	if !exist {
+		metrics.OriginFailoverTotal.WithLabelValues(originalHost, host).Inc()
+		logger.WarnContextf(ctx, "original host '%s' of registry '%s' marked unhealthy: %v", host,
+			originalHost, err)
+	}
+}
+
+// IsFailure returns whether the response of original host should fail over, the request failed without
+// response or the registry responded server error
+func IsFailure(resp *http.Response, err error) bool {
+	if resp == nil {
+		return err != nil
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// Do calls fn with the hosts of original host in priority order until the response is not failure. The
+// response of the failed hosts is closed except the last one.
+func Do(ctx context.Context, originalHost string, fn func(host string) (*http.Response, error)) (
+	*http.Response, error) {
+	return doHosts(ctx, originalHost, Hosts(originalHost), fn)
+}
+
+// doHosts fails over the hosts in order, the hosts failed are marked unhealthy only if there are replicas
+func doHosts(ctx context.Context, originalHost string, hosts []string,
+	fn func(host string) (*http.Response, error)) (*http.Response, error) {
+	var (
+		resp *http.Response
+		err  error
+	)
+	for i, host := range hosts {
+		resp, err = fn(host)
+		if len(hosts) == 1 || !IsFailure(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		markUnhealthy(ctx, originalHost, host, err)
+		if i == len(hosts)-1 {
+			break
+		}
+		if resp != nil && resp.Body != nil {
+			_ = resp.Body.Close()
+		}
+		logger.WarnContextf(ctx, "request original host '%s' failed, fail over to '%s'", host, hosts[i+1])
+	}
+	return resp, err
+}
+
+// Run probes the unhealthy hosts periodically, they are restored when the /v2/ endpoint is responded
+// without server error
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			probeUnhealthy(ctx)
+		}
+	}
+}
+
+func probeUnhealthy(ctx context.Context) {
+	unhealthyLock.RLock()
+	hosts := make([]string, 0, len(unhealthy))
+	for host := range unhealthy {
+		hosts = append(hosts, host)
+	}
+	unhealthyLock.RUnlock()
+	probeHosts(ctx, &http.Client{Transport: options.GlobalOptions().HTTPProxyTransport(), Timeout: probeTimeout},
+		hosts)
+}
+
+// probeHosts probes the hosts with client, the ones responded without server error are restored
+func probeHosts(ctx context.Context, client *http.Client, hosts []string) {
+	for _, host := range hosts {
+		if err := probe(ctx, client, host); err != nil {
+			logger.V(3).Infof("probe original host '%s' still unhealthy: %s", host, err.Error())
+			continue
+		}
+		unhealthyLock.Lock()
+		delete(unhealthy, host)
+		unhealthyLock.Unlock()
+		logger.Infof("original host '%s' is probed healthy", host)
+	}
+}
+
+func probe(ctx context.Context, client *http.Client, host string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, utils.RegistryURL(host, "/v2/"), nil)
+	if err != nil {
+		return errors.Wrapf(err, "create request failed")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("responded %d", resp.StatusCode)
+	}
+	return nil
+}
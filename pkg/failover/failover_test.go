@@ -0,0 +1,231 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package failover
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// resetUnhealthy sets the unhealthy hosts for test
+func resetUnhealthy(hosts ...string) {
+	unhealthyLock.Lock()
+	defer unhealthyLock.Unlock()
+	unhealthy = make(map[string]time.Time)
+	for _, host := range hosts {
+		unhealthy[host] = time.Now()
+	}
+}
+
+func isUnhealthy(host string) bool {
+	unhealthyLock.RLock()
+	defer unhealthyLock.RUnlock()
+	_, ok := unhealthy[host]
+	return ok
+}
+
+// trackedBody records whether the response body is closed
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func response(code int) *http.Response {
+	return &http.Response{StatusCode: code, Body: &trackedBody{Reader: strings.NewReader("")}}
+}
+
+func TestIsFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{name: "no response with error", err: errors.New("refused"), want: true},
+		{name: "no response without error", want: false},
+		{name: "server error", resp: response(http.StatusBadGateway), want: true},
+		{name: "client error", resp: response(http.StatusNotFound), want: false},
+		{name: "success", resp: response(http.StatusOK), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsFailure(tt.resp, tt.err); got != tt.want {
+				t.Errorf("IsFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderHosts(t *testing.T) {
+	tests := []struct {
+		name      string
+		unhealthy []string
+		want      []string
+	}{
+		{name: "all healthy", want: []string{"a", "b", "c"}},
+		{name: "primary unhealthy", unhealthy: []string{"a"}, want: []string{"b", "c", "a"}},
+		{name: "priority kept in unhealthy", unhealthy: []string{"b", "a"}, want: []string{"c", "a", "b"}},
+		{name: "all unhealthy", unhealthy: []string{"a", "b", "c"}, want: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetUnhealthy(tt.unhealthy...)
+			defer resetUnhealthy()
+			if got := orderHosts([]string{"a", "b", "c"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoHosts(t *testing.T) {
+	tests := []struct {
+		name          string
+		hosts         []string
+		codes         map[string]int
+		wantCalled    []string
+		wantCode      int
+		wantUnhealthy []string
+	}{
+		{
+			name:       "primary success",
+			hosts:      []string{"a", "b"},
+			codes:      map[string]int{"a": http.StatusOK},
+			wantCalled: []string{"a"},
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:          "fail over to replica",
+			hosts:         []string{"a", "b", "c"},
+			codes:         map[string]int{"a": http.StatusBadGateway, "b": http.StatusOK},
+			wantCalled:    []string{"a", "b"},
+			wantCode:      http.StatusOK,
+			wantUnhealthy: []string{"a"},
+		},
+		{
+			name:          "client error not fail over",
+			hosts:         []string{"a", "b"},
+			codes:         map[string]int{"a": http.StatusNotFound},
+			wantCalled:    []string{"a"},
+			wantCode:      http.StatusNotFound,
+			wantUnhealthy: nil,
+		},
+		{
+			name:          "all failed returns last response",
+			hosts:         []string{"a", "b"},
+			codes:         map[string]int{"a": http.StatusServiceUnavailable, "b": http.StatusBadGateway},
+			wantCalled:    []string{"a", "b"},
+			wantCode:      http.StatusBadGateway,
+			wantUnhealthy: []string{"a", "b"},
+		},
+		{
+			name:       "single host not marked",
+			hosts:      []string{"a"},
+			codes:      map[string]int{"a": http.StatusBadGateway},
+			wantCalled: []string{"a"},
+			wantCode:   http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetUnhealthy()
+			defer resetUnhealthy()
+			called := make([]string, 0)
+			responses := make(map[string]*http.Response)
+			resp, err := doHosts(context.Background(), "registry", tt.hosts, func(host string) (*http.Response, error) {
+				called = append(called, host)
+				responses[host] = response(tt.codes[host])
+				return responses[host], nil
+			})
+			if err != nil {
+				t.Fatalf("doHosts() error = %v", err)
+			}
+			if !reflect.DeepEqual(called, tt.wantCalled) {
+				t.Errorf("called hosts = %v, want %v", called, tt.wantCalled)
+			}
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			for host, r := range responses {
+				if closed := r.Body.(*trackedBody).closed; closed != (r != resp) {
+					t.Errorf("body of host '%s' closed = %v, want %v", host, closed, r != resp)
+				}
+			}
+			for _, host := range tt.hosts {
+				want := false
+				for _, h := range tt.wantUnhealthy {
+					want = want || h == host
+				}
+				if got := isUnhealthy(host); got != want {
+					t.Errorf("host '%s' unhealthy = %v, want %v", host, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDoHostsContextCanceled(t *testing.T) {
+	resetUnhealthy()
+	defer resetUnhealthy()
+	ctx, cancel := context.WithCancel(context.Background())
+	called := make([]string, 0)
+	_, err := doHosts(ctx, "registry", []string{"a", "b"}, func(host string) (*http.Response, error) {
+		called = append(called, host)
+		cancel()
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("doHosts() error = %v, want context canceled", err)
+	}
+	if !reflect.DeepEqual(called, []string{"a"}) {
+		t.Errorf("called hosts = %v, want [a]", called)
+	}
+	if isUnhealthy("a") {
+		t.Errorf("host 'a' marked unhealthy after context canceled")
+	}
+}
+
+func TestProbeHosts(t *testing.T) {
+	newServer := func(code int) *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v2/" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(code)
+		}))
+	}
+	// the registry without anonymous access responds 401, it is regarded healthy
+	unauthorized := newServer(http.StatusUnauthorized)
+	defer unauthorized.Close()
+	broken := newServer(http.StatusInternalServerError)
+	defer broken.Close()
+	healthyHost := strings.TrimPrefix(unauthorized.URL, "https://")
+	brokenHost := strings.TrimPrefix(broken.URL, "https://")
+
+	resetUnhealthy(healthyHost, brokenHost)
+	defer resetUnhealthy()
+	// the servers share the certificate of httptest
+	probeHosts(context.Background(), unauthorized.Client(), []string{healthyHost, brokenHost})
+	if isUnhealthy(healthyHost) {
+		t.Errorf("host responded 401 is not restored")
+	}
+	if !isUnhealthy(brokenHost) {
+		t.Errorf("host responded 500 is restored")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package federation shares the layer locations between the clusters of federation. The masters publish
+// the layers of their clusters into the shared redis, and the layers are fetched across clusters through
+// the gateway nodes.
+package federation
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/store"
+)
+
+const (
+	// TokenHeader the header of federation token in the requests between clusters
+	TokenHeader = "X-Accelerboat-Federation-Token"
+	// ClusterHeader the header of requesting cluster name in the requests between clusters
+	ClusterHeader = "X-Accelerboat-Federation-Cluster"
+
+	clustersKey = "federation/clusters"
+	// chunkSize the max bytes written once by the limited writer
+	chunkSize = 256 << 10
+	// expireIntervals the published layers and clusters expire after the number of publish intervals
+	expireIntervals = 3
+)
+
+func layerKey(layer string) string {
+	return fmt.Sprintf("federation/layer/%s", layer)
+}
+
+// Cluster defines the cluster of federation
+type Cluster struct {
+	Name      string `json:"name"`
+	Gateway   string `json:"gateway"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// Federation publishes and queries the layers in the shared redis of federation
+type Federation struct {
+	op          *options.AccelerBoatOption
+	redisClient *redis.Client
+
+	limiterLock sync.Mutex
+	limiters    map[string]*rate.Limiter
+}
+
+var (
+	global   *Federation
+	syncOnce sync.Once
+)
+
+// Global returns the federation, returns nil if federation not enabled
+func Global() *Federation {
+	syncOnce.Do(func() {
+		op := options.GlobalOptions()
+		if !op.Federation.Enable {
+			return
+		}
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     op.Federation.RedisAddress,
+			Password: op.Federation.RedisPassword,
+		})
+		global = &Federation{
+			op:          op,
+			redisClient: redisClient,
+			limiters:    make(map[string]*rate.Limiter),
+		}
+	})
+	return global
+}
+
+func (f *Federation) expiration() time.Duration {
+	return time.Duration(expireIntervals*f.op.Federation.PublishInterval) * time.Second
+}
+
+// GatewayNode returns the gateway node of cluster, it is the master if not configured
+func (f *Federation) GatewayNode() string {
+	if f.op.Federation.GatewayNode != "" {
+		return fmt.Sprintf("%s:%d", f.op.Federation.GatewayNode, f.op.HTTPPort)
+	}
+	return leaderselector.CurrentMaster()
+}
+
+// RunPublisher publishes the layers of cluster periodically while the node is master until ctx done
+func (f *Federation) RunPublisher(ctx context.Context, cacheStore store.CacheStore) {
+	ticker := time.NewTicker(time.Duration(f.op.Federation.PublishInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !leaderselector.IsMaster(f.op.Address) {
+				continue
+			}
+			if err := f.publish(ctx, cacheStore); err != nil {
+				metrics.RecordError(metrics.ComponentFederation, "publish")
+				logger.Errorf("publish layers to federation failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (f *Federation) publish(ctx context.Context, cacheStore store.CacheStore) error {
+	cfg := f.op.Federation
+	now := time.Now()
+	bs, _ := json.Marshal(&Cluster{Name: cfg.ClusterName, Gateway: cfg.GatewayEndpoint, UpdatedAt: now.Unix()})
+	if err := f.redisClient.HSet(ctx, clustersKey, cfg.ClusterName, string(bs)).Err(); err != nil {
+		return errors.Wrapf(err, "redis hset cluster failed")
+	}
+	staleBefore := strconv.FormatInt(now.Add(-f.expiration()).Unix(), 10)
+	counts := 0
+	if err := cacheStore.ScanLayers(ctx, func(layers []string) error {
+		if _, err := f.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, layer := range layers {
+				key := layerKey(layer)
+				pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.Unix()), Member: cfg.ClusterName})
+				pipe.ZRemRangeByScore(ctx, key, "-inf", "("+staleBefore)
+				pipe.Expire(ctx, key, f.expiration())
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "redis pipeline of %d layers failed", len(layers))
+		}
+		counts += len(layers)
+		return nil
+	}); err != nil {
+		return err
+	}
+	logger.V(3).Infof("published %d layers to federation", counts)
+	return nil
+}
+
+// QueryClusters returns the other clusters which have the layer, the recently published ones are first
+func (f *Federation) QueryClusters(ctx context.Context, layer string) ([]*Cluster, error) {
+	staleBefore := time.Now().Add(-f.expiration()).Unix()
+	names, err := f.redisClient.ZRevRangeByScore(ctx, layerKey(layer), &redis.ZRangeBy{
+		Min: strconv.FormatInt(staleBefore, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, errors.Wrapf(err, "redis query clusters of layer failed")
+	}
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != f.op.Federation.ClusterName {
+			fields = append(fields, name)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	values, err := f.redisClient.HMGet(ctx, clustersKey, fields...).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "redis query clusters failed")
+	}
+	result := make([]*Cluster, 0, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		cluster := new(Cluster)
+		if err = json.Unmarshal([]byte(s), cluster); err != nil {
+			logger.Warnf("unmarshal federation cluster '%s' failed: %s", fields[i], err.Error())
+			continue
+		}
+		if cluster.Gateway == "" || cluster.UpdatedAt < staleBefore {
+			continue
+		}
+		result = append(result, cluster)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].UpdatedAt > result[j].UpdatedAt
+	})
+	return result, nil
+}
+
+// SetHeaders sets the token and cluster name into the request to other clusters
+func (f *Federation) SetHeaders(req *http.Request) {
+	req.Header.Set(TokenHeader, f.op.Federation.Token)
+	req.Header.Set(ClusterHeader, f.op.Federation.ClusterName)
+}
+
+// Authorize checks the token of the request from other clusters, returns the name of requesting cluster
+func (f *Federation) Authorize(req *http.Request) (string, error) {
+	token := req.Header.Get(TokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(f.op.Federation.Token)) != 1 {
+		return "", errors.Errorf("federation token not matched")
+	}
+	cluster := req.Header.Get(ClusterHeader)
+	if cluster == "" {
+		return "", errors.Errorf("header '%s' cannot be empty", ClusterHeader)
+	}
+	return cluster, nil
+}
+
+// LimitWriter returns the writer limited by the bandwidth of requesting cluster
+func (f *Federation) LimitWriter(ctx context.Context, cluster string, w io.Writer) io.Writer {
+	limitMB := f.op.Federation.BandwidthLimit
+	if limitMB <= 0 {
+		return w
+	}
+	f.limiterLock.Lock()
+	limiter, ok := f.limiters[cluster]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limitMB*options.MB), chunkSize)
+		f.limiters[cluster] = limiter
+	}
+	f.limiterLock.Unlock()
+	return &limitedWriter{ctx: ctx, writer: w, limiter: limiter}
+}
+
+type limitedWriter struct {
+	ctx     context.Context
+	writer  io.Writer
+	limiter *rate.Limiter
+}
+
+// Write writes the bytes in chunks, and waits for the limiter before every chunk
+func (w *limitedWriter) Write(bs []byte) (int, error) {
+	written := 0
+	for len(bs) > 0 {
+		n := min(len(bs), chunkSize)
+		if err := w.limiter.WaitN(w.ctx, n); err != nil {
+			return written, errors.Wrapf(err, "federation bandwidth limit wait failed")
+		}
+		m, err := w.writer.Write(bs[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		bs = bs[n:]
+	}
+	return written, nil
+}
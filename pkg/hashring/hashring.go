@@ -0,0 +1,91 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package hashring implements the consistent hashing of keys(e.g. layer digests) to nodes. Each node is put
+// on the ring with virtual nodes, a key is owned by the nodes met clockwise from its hash, so only the keys
+// of the joined or left node are moved.
+package hashring
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// Ring the consistent hash ring of nodes, it is immutable after created
+type Ring struct {
+	hashes []uint64
+	nodes  map[uint64]string
+	size   int
+}
+
+// New creates the ring of nodes with virtualNodes per node
+func New(nodes []string, virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = 1
+	}
+	r := &Ring{
+		hashes: make([]uint64, 0, len(nodes)*virtualNodes),
+		nodes:  make(map[uint64]string, len(nodes)*virtualNodes),
+	}
+	seen := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		if _, ok := seen[node]; ok || node == "" {
+			continue
+		}
+		seen[node] = struct{}{}
+		for i := 0; i < virtualNodes; i++ {
+			h := hashKey(node + "#" + strconv.Itoa(i))
+			// the collided virtual node is skipped, the node still has the others
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.nodes[h] = node
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	r.size = len(seen)
+	sort.Slice(r.hashes, func(i, j int) bool {
+		return r.hashes[i] < r.hashes[j]
+	})
+	return r
+}
+
+// Size returns the number of nodes on the ring
+func (r *Ring) Size() int {
+	return r.size
+}
+
+// Owners returns the n distinct nodes of key in ring order, the first is the primary owner. All the
+// nodes are returned in ring order if n not positive or larger than the nodes.
+func (r *Ring) Owners(key string, n int) []string {
+	if r.size == 0 {
+		return nil
+	}
+	if n <= 0 || n > r.size {
+		n = r.size
+	}
+	h := hashKey(key)
+	start := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	result := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	for i := 0; i < len(r.hashes) && len(result) < n; i++ {
+		node := r.nodes[r.hashes[(start+i)%len(r.hashes)]]
+		if _, ok := seen[node]; ok {
+			continue
+		}
+		seen[node] = struct{}{}
+		result = append(result, node)
+	}
+	return result
+}
+
+func hashKey(key string) uint64 {
+	// the digests and addresses are similar strings, sha256 spreads them evenly on the ring
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,108 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package hashring
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testNodes(n int) []string {
+	nodes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		nodes = append(nodes, fmt.Sprintf("10.0.0.%d:2080", i+1))
+	}
+	return nodes
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		keys = append(keys, fmt.Sprintf("sha256:%064x", i))
+	}
+	return keys
+}
+
+func TestOwners(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+		n     int
+		want  int
+	}{
+		{name: "empty ring", nodes: nil, n: 2, want: 0},
+		{name: "primary only", nodes: testNodes(5), n: 1, want: 1},
+		{name: "replicas", nodes: testNodes(5), n: 3, want: 3},
+		{name: "n larger than size", nodes: testNodes(3), n: 5, want: 3},
+		{name: "n not positive", nodes: testNodes(4), n: 0, want: 4},
+		{name: "duplicated and empty nodes", nodes: append(testNodes(2), "10.0.0.1:2080", ""), n: 3, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(tt.nodes, 50)
+			for _, key := range testKeys(100) {
+				owners := r.Owners(key, tt.n)
+				if len(owners) != tt.want {
+					t.Fatalf("Owners(%s) = %v, want %d owners", key, owners, tt.want)
+				}
+				seen := make(map[string]struct{}, len(owners))
+				for _, owner := range owners {
+					if _, ok := seen[owner]; ok {
+						t.Fatalf("Owners(%s) = %v has duplicated owner", key, owners)
+					}
+					seen[owner] = struct{}{}
+				}
+			}
+		})
+	}
+}
+
+func TestOwnersStable(t *testing.T) {
+	nodes := testNodes(10)
+	keys := testKeys(2000)
+	ring := New(nodes, 100)
+	// the order of nodes not affects the owners
+	reversed := make([]string, 0, len(nodes))
+	for i := len(nodes) - 1; i >= 0; i-- {
+		reversed = append(reversed, nodes[i])
+	}
+	reversedRing := New(reversed, 100)
+	for _, key := range keys {
+		if a, b := ring.Owners(key, 1)[0], reversedRing.Owners(key, 1)[0]; a != b {
+			t.Fatalf("owner of '%s' changed with the order of nodes: %s, %s", key, a, b)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		nodes []string
+		// changed the node joined or left, only the keys owned by it should move
+		changed string
+	}{
+		{name: "node join", nodes: append(testNodes(10), "10.0.0.100:2080"), changed: "10.0.0.100:2080"},
+		{name: "node leave", nodes: nodes[1:], changed: nodes[0]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changedRing := New(tt.nodes, 100)
+			moved := 0
+			for _, key := range keys {
+				before, after := ring.Owners(key, 1)[0], changedRing.Owners(key, 1)[0]
+				if before == after {
+					continue
+				}
+				moved++
+				if before != tt.changed && after != tt.changed {
+					t.Fatalf("owner of '%s' moved from %s to %s, not related to %s", key, before, after,
+						tt.changed)
+				}
+			}
+			// about 1/11 or 1/10 of keys move, allow twice for the unevenness of virtual nodes
+			if limit := len(keys) * 2 / 10; moved == 0 || moved > limit {
+				t.Errorf("moved %d keys, want in (0, %d]", moved, limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package integrity implements the background verifier of cached layers, it re-hashes the layers in the
+// transfer and small-file paths to find the bit rot or truncated files before clients pull them.
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/store"
+)
+
+const (
+	layerSuffix = ".tar.gzip"
+	chunkSize   = 256 << 10
+)
+
+// Verifier verifies a bounded number of cached layers every hour, the least recently verified first
+type Verifier struct {
+	cacheStore store.CacheStore
+	limiter    *rate.Limiter
+	// verified the last verified time of layer files, the files never verified are verified first
+	verified map[string]time.Time
+}
+
+// NewVerifier creates the layer integrity verifier
+func NewVerifier(cacheStore store.CacheStore) *Verifier {
+	return &Verifier{
+		cacheStore: cacheStore,
+		limiter:    rate.NewLimiter(rate.Inf, chunkSize),
+		verified:   make(map[string]time.Time),
+	}
+}
+
+// layerFile defines the cached layer file to be verified
+type layerFile struct {
+	path    string
+	digest  string
+	modTime time.Time
+}
+
+// Run verifies one layer every interval until ctx done, the interval is derived from LayersPerHour
+func (v *Verifier) Run(ctx context.Context) {
+	for {
+		op := options.GlobalOptions()
+		interval := time.Hour / time.Duration(op.IntegrityVerify.LayersPerHour)
+		if op.IntegrityVerify.Enable {
+			v.limiter.SetLimit(rate.Limit(op.IntegrityVerify.BandwidthLimit * options.MB))
+			v.verifyNext(ctx, op)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// verifyNext verifies the least recently verified layer, and quarantines it if mismatched
+func (v *Verifier) verifyNext(ctx context.Context, op *options.AccelerBoatOption) {
+	files := collectLayerFiles(op.StorageConfig.TransferPath, op.StorageConfig.SmallFilePath)
+	next := v.pick(files)
+	if next == nil {
+		return
+	}
+	actual, err := v.hashFile(ctx, next.path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		// the layer may be removed by cleaner, it is forgotten with next collection
+		v.verified[next.path] = time.Now()
+		metrics.LayerVerifyTotal.WithLabelValues("failed").Inc()
+		logger.WarnContextf(ctx, "[integrity] verify layer '%s' failed: %s", next.path, err.Error())
+		return
+	}
+	if actual == next.digest {
+		v.verified[next.path] = time.Now()
+		metrics.LayerVerifyTotal.WithLabelValues("passed").Inc()
+		logger.V(3).InfoContextf(ctx, "[integrity] layer '%s' verified", next.path)
+		return
+	}
+	metrics.LayerVerifyTotal.WithLabelValues("corrupted").Inc()
+	v.quarantine(ctx, next, actual)
+}
+
+// pick returns the least recently verified layer file, and forgets the removed files and updates the lag
+// metrics
+func (v *Verifier) pick(files []*layerFile) *layerFile {
+	now := time.Now()
+	existing := make(map[string]struct{}, len(files))
+	var next *layerFile
+	var nextVerified time.Time
+	var pending int
+	for _, f := range files {
+		existing[f.path] = struct{}{}
+		verifiedAt, ok := v.verified[f.path]
+		if !ok || f.modTime.After(verifiedAt) {
+			// the file is replaced after verified, it is counted from its modification time
+			verifiedAt = f.modTime
+			pending++
+		}
+		if next == nil || verifiedAt.Before(nextVerified) {
+			next = f
+			nextVerified = verifiedAt
+		}
+	}
+	for fp := range v.verified {
+		if _, ok := existing[fp]; !ok {
+			delete(v.verified, fp)
+		}
+	}
+	metrics.LayerVerifyPending.Set(float64(pending))
+	if next == nil {
+		metrics.LayerVerifyLagSeconds.Set(0)
+		return nil
+	}
+	metrics.LayerVerifyLagSeconds.Set(now.Sub(nextVerified).Seconds())
+	return next
+}
+
+// hashFile returns the sha256 hex of file, the reading is limited by the bandwidth limit
+func (v *Verifier) hashFile(ctx context.Context, fp string) (string, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return "", errors.Wrapf(err, "open file failed")
+	}
+	defer f.Close()
+	h := sha256.New()
+	buf := make([]byte, chunkSize)
+	for {
+		n, readErr := f.Read(buf)
+		if n > 0 {
+			if err = v.limiter.WaitN(ctx, n); err != nil {
+				return "", errors.Wrapf(err, "verify bandwidth limit wait failed")
+			}
+			h.Write(buf[:n])
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", errors.Wrapf(readErr, "read file failed")
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// quarantine deletes the corrupted layer and removes it from cache store, so the next pull downloads it
+// again instead of being served the corrupted one
+func (v *Verifier) quarantine(ctx context.Context, lf *layerFile, actual string) {
+	logger.ErrorContextf(ctx, "[integrity] layer '%s' is corrupted, actual digest 'sha256:%s'", lf.path, actual)
+	if err := os.Remove(lf.path); err != nil && !os.IsNotExist(err) {
+		logger.ErrorContextf(ctx, "[integrity] remove corrupted layer '%s' failed: %s", lf.path, err.Error())
+		return
+	}
+	delete(v.verified, lf.path)
+	if err := v.cacheStore.DeleteStaticLayer(ctx, lf.digest); err != nil {
+		logger.ErrorContextf(ctx, "[integrity] cache delete static '%s' failed: %s", lf.digest, err.Error())
+	}
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeLayerQuarantined,
+		EventStatus: recorder.Warning,
+		Details: map[string]interface{}{
+			"digest": "sha256:" + lf.digest, "file": lf.path, "actualDigest": "sha256:" + actual,
+			"modTime": lf.modTime.Format(time.RFC3339),
+		},
+		Message: "Layer quarantined because its content not matches the digest",
+	})
+}
+
+// collectLayerFiles returns the layer files of dirs, the file is named with the hex of its digest
+func collectLayerFiles(dirs ...string) []*layerFile {
+	result := make([]*layerFile, 0)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		_ = filepath.WalkDir(dir, func(fp string, de fs.DirEntry, err error) error {
+			if err != nil || de.IsDir() || !strings.HasSuffix(de.Name(), layerSuffix) {
+				return nil
+			}
+			info, err := de.Info()
+			if err != nil {
+				return nil
+			}
+			result = append(result, &layerFile{
+				path:    fp,
+				digest:  strings.TrimPrefix(strings.TrimSuffix(de.Name(), layerSuffix), "sha256:"),
+				modTime: info.ModTime(),
+			})
+			return nil
+		})
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package layerscan provides the hooks to scan the downloaded layers before they are promoted into cache.
+package layerscan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/utils/httputils"
+)
+
+// Layer defines the layer to be scanned
+type Layer struct {
+	Digest   string `json:"digest"`
+	Path     string `json:"path"`
+	Registry string `json:"registry"`
+	Repo     string `json:"repo"`
+}
+
+// Verdict defines the scan result of layer
+type Verdict struct {
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// Hook defines the interface of layer scan hook. Error is returned only if the hook itself failed, a
+// rejected layer should be returned with a not passed verdict.
+type Hook interface {
+	Scan(ctx context.Context, layer *Layer) (*Verdict, error)
+}
+
+// NewHook creates the hook with the layer scan config
+func NewHook(cfg *options.LayerScanConfig) (Hook, error) {
+	switch cfg.Type {
+	case options.LayerScanExec:
+		return &execHook{command: cfg.Command}, nil
+	case options.LayerScanHTTP:
+		return &httpHook{url: cfg.URL}, nil
+	default:
+		return nil, errors.Errorf("layer scan type '%s' not supported", cfg.Type)
+	}
+}
+
+// execHook executes the command to scan layer, exit code 0 means passed and the output is the message
+type execHook struct {
+	command []string
+}
+
+// Scan implements Hook
+func (h *execHook) Scan(ctx context.Context, layer *Layer) (*Verdict, error) {
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"LAYER_DIGEST="+layer.Digest,
+		"LAYER_PATH="+layer.Path,
+		"LAYER_REGISTRY="+layer.Registry,
+		"LAYER_REPO="+layer.Repo,
+	)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	message := strings.TrimSpace(output.String())
+	if err == nil {
+		return &Verdict{Passed: true, Message: message}, nil
+	}
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return &Verdict{Passed: false, Message: message}, nil
+	}
+	return nil, errors.Wrapf(err, "exec layer scan command failed: %s", message)
+}
+
+// httpHook posts the layer info to the scanner server and reads the verdict from response
+type httpHook struct {
+	url string
+}
+
+// Scan implements Hook
+func (h *httpHook) Scan(ctx context.Context, layer *Layer) (*Verdict, error) {
+	respBody, err := httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
+		Url:    h.url,
+		Method: http.MethodPost,
+		Body:   layer,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "request layer scan server failed")
+	}
+	verdict := &Verdict{}
+	if err = json.Unmarshal(respBody, verdict); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal layer scan verdict failed")
+	}
+	return verdict, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package loadsignal tracks the load signals of this node for autoscaling the proxy tier: the blob requests
+// queued, the bandwidth saturation and the p95 latency of blob responses. The signals are reported with the
+// node heartbeat, so that every node can aggregate the signals of cluster.
+package loadsignal
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	// throughputWindow the seconds of served bytes the throughput averaged over
+	throughputWindow = 60
+	// maxLatencySamples the max blob latencies kept, the oldest are overwritten
+	maxLatencySamples = 4096
+	gaugeInterval     = 15 * time.Second
+)
+
+// Global the tracker of the load signals of this node
+var Global = &Tracker{}
+
+type latencySample struct {
+	at       int64
+	duration time.Duration
+}
+
+// Tracker tracks the queued blob requests, the served bytes per second and the latencies of blob responses
+type Tracker struct {
+	queued atomic.Int64
+
+	sync.Mutex
+	// bytes the served bytes of the seconds within throughput window, indexed by the second modulo window
+	bytes     [throughputWindow]int64
+	seconds   [throughputWindow]int64
+	latencies [maxLatencySamples]latencySample
+	next      int
+}
+
+// Enqueue counts the blob request waiting for layer fetching or local serving, the returned func must be
+// called once it stops waiting
+func (t *Tracker) Enqueue() func() {
+	t.queued.Add(1)
+	return func() {
+		t.queued.Add(-1)
+	}
+}
+
+// ObserveBlob records the served bytes and the latency of blob response
+func (t *Tracker) ObserveBlob(n int64, d time.Duration) {
+	if !options.GlobalOptions().Autoscaling.Enable {
+		return
+	}
+	now := time.Now()
+	sec := now.Unix()
+	t.Lock()
+	defer t.Unlock()
+	i := sec % throughputWindow
+	if t.seconds[i] != sec {
+		t.seconds[i] = sec
+		t.bytes[i] = 0
+	}
+	t.bytes[i] += max(n, 0)
+	t.latencies[t.next] = latencySample{at: now.UnixNano(), duration: d}
+	t.next = (t.next + 1) % maxLatencySamples
+}
+
+// Signals returns the current load signals of this node
+func (t *Tracker) Signals() *apitypes.LoadSignals {
+	conf := options.GlobalOptions().Autoscaling
+	now := time.Now()
+	latencyDeadline := now.Add(-time.Duration(conf.LatencyWindow) * time.Second).UnixNano()
+	var served int64
+	durations := make([]time.Duration, 0)
+	t.Lock()
+	for i := range t.seconds {
+		if now.Unix()-t.seconds[i] < throughputWindow {
+			served += t.bytes[i]
+		}
+	}
+	for _, s := range t.latencies {
+		if s.at > latencyDeadline {
+			durations = append(durations, s.duration)
+		}
+	}
+	t.Unlock()
+
+	result := &apitypes.LoadSignals{
+		QueuedDownloads: max(t.queued.Load(), 0),
+		ThroughputBytes: served / throughputWindow,
+	}
+	if conf.NodeBandwidth > 0 {
+		result.BandwidthSaturation = float64(result.ThroughputBytes) / float64(conf.NodeBandwidth*options.MB)
+	}
+	if len(durations) != 0 {
+		sort.Slice(durations, func(i, j int) bool {
+			return durations[i] < durations[j]
+		})
+		p95 := durations[int(math.Ceil(float64(len(durations))*0.95))-1]
+		result.BlobLatencyP95Ms = p95.Milliseconds()
+	}
+	return result
+}
+
+// Run updates the load gauges of this node periodically until ctx done
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(gaugeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !options.GlobalOptions().Autoscaling.Enable {
+				continue
+			}
+			signals := t.Signals()
+			metrics.LoadQueuedDownloads.Set(float64(signals.QueuedDownloads))
+			metrics.LoadBandwidthSaturation.Set(signals.BandwidthSaturation)
+			metrics.LoadBlobLatencyP95Seconds.Set(float64(signals.BlobLatencyP95Ms) / 1000)
+		}
+	}
+}
+
+// Aggregate aggregates the load signals of nodes: the queued downloads and throughput are summed, the
+// bandwidth saturation is averaged and the p95 latency is the max of nodes
+func Aggregate(nodes []*apitypes.NodeLoadSignals) *apitypes.LoadSignals {
+	result := &apitypes.LoadSignals{}
+	if len(nodes) == 0 {
+		return result
+	}
+	for _, n := range nodes {
+		result.QueuedDownloads += n.QueuedDownloads
+		result.ThroughputBytes += n.ThroughputBytes
+		result.BandwidthSaturation += n.BandwidthSaturation
+		result.BlobLatencyP95Ms = max(result.BlobLatencyP95Ms, n.BlobLatencyP95Ms)
+	}
+	result.BandwidthSaturation /= float64(len(nodes))
+	return result
+}
@@ -14,6 +14,9 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// FileName the file name of log under the log dir
+const FileName = "accelerboat.log"
+
 type Option struct {
 	Filename   string
 	MaxSize    int
@@ -23,7 +26,8 @@ type Option struct {
 }
 
 var (
-	zapLogger *zap.Logger
+	// zapLogger discards the logs until InitLogger called
+	zapLogger = zap.NewNop()
 	maxLevel  int
 )
 
@@ -17,6 +17,10 @@ const (
 	ComponentOCIScan      = "ociscan"
 	ComponentReverseProxy = "reverse_proxy"
 	ComponentRedis        = "redis"
+	ComponentObjectStore  = "object_storage"
+	ComponentLayerScan    = "layer_scan"
+	ComponentHTTPServer   = "http_server"
+	ComponentFederation   = "federation"
 )
 
 // RecordError increments the errors_total counter for the given component, operation and error type.
@@ -25,6 +29,27 @@ func RecordError(component, action string) {
 	ErrorsTotal.WithLabelValues(component, action).Inc()
 }
 
+// exemplarValueMaxLen the exemplar labels are limited to 128 runes in total
+const exemplarValueMaxLen = 48
+
+// ObserveWithExemplar observes the value with the request id as exemplar, and the trace id if the request id
+// is a trace id. The exemplar is dropped if the observer not supports it.
+func ObserveWithExemplar(obs prometheus.Observer, value float64, requestID string, isTraceID bool) {
+	eo, ok := obs.(prometheus.ExemplarObserver)
+	if !ok {
+		obs.Observe(value)
+		return
+	}
+	if len(requestID) > exemplarValueMaxLen {
+		requestID = requestID[:exemplarValueMaxLen]
+	}
+	labels := prometheus.Labels{"request_id": requestID}
+	if isTraceID {
+		labels["trace_id"] = requestID
+	}
+	eo.ObserveWithExemplar(value, labels)
+}
+
 var (
 	// HTTPRequestsTotal HTTP request metrics (all HTTP traffic)
 	HTTPRequestsTotal = promauto.NewCounterVec(
@@ -111,8 +136,26 @@ var (
 		},
 	)
 
+	TorrentGenerateQueueLength = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "torrent_generate_queue_length",
+			Help:      "Number of layers waiting for torrent generation.",
+		},
+	)
+
+	// LocalServeQueueLength is the number of requests waiting to serve the local layers
+	LocalServeQueueLength = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "local_serve_queue_length",
+			Help:      "Number of requests waiting for the limit of serving local layers.",
+		},
+	)
+
 	// TransferSize defines transferred size
-	// download_from_registry, download_by_tcp, download_by_torrent, serve_blob_by_tcp, serve_blob_from_local
+	// download_from_registry, download_by_tcp, download_by_torrent, serve_blob_by_tcp, serve_blob_from_local,
+	// download_federation, serve_federation, serve_blob_by_grpc, serve_blob_by_redirect, download_by_multi_source
 	TransferSize = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
@@ -122,6 +165,107 @@ var (
 		[]string{"operation"},
 	)
 
+	// TransferMethodSelectedTotal counts the selected methods of layer transfer: torrent, tcp, race
+	TransferMethodSelectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfer_method_selected_total",
+			Help:      "Total number of selected layer transfer methods.",
+		},
+		[]string{"method"},
+	)
+
+	// LayerScanTotal counts the layer scan verdicts by result: passed, blocked, warned, error
+	LayerScanTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "layer_scan_total",
+			Help:      "Total number of layer scans by hook type and result.",
+		},
+		[]string{"type", "result"},
+	)
+
+	LayerScanDurationSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "layer_scan_duration_seconds",
+			Help:      "Layer scan latency in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"type"},
+	)
+
+	// ClientRequestsTotal counts the proxied registry requests by client and status
+	ClientRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_requests_total",
+			Help:      "Total number of proxied registry requests by client and status.",
+		},
+		[]string{"client", "status"},
+	)
+
+	// ClientBytesTotal counts the response bytes of proxied registry requests by client
+	ClientBytesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_bytes_total",
+			Help:      "Total response bytes of proxied registry requests by client.",
+		},
+		[]string{"client"},
+	)
+
+	// PodPullBytesTotal counts the response bytes of proxied registry requests by client pod, it is only
+	// counted when pod identity enabled
+	PodPullBytesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "pod_pull_bytes_total",
+			Help:      "Total response bytes of proxied registry requests by client namespace and pod.",
+		},
+		[]string{"namespace", "pod"},
+	)
+
+	// ClientThrottledTotal counts the throttled requests by client and reason
+	ClientThrottledTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_throttled_total",
+			Help:      "Total number of throttled requests by client and reason.",
+		},
+		[]string{"client", "reason"},
+	)
+
+	// FallbackDecisionsTotal counts the fallback decisions of failed requests by registry, category and decision
+	FallbackDecisionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fallback_decisions_total",
+			Help:      "Total number of fallback decisions of failed requests by registry, category and decision.",
+		},
+		[]string{"registry", "category", "decision"},
+	)
+
+	// PreheatRunsTotal counts the finished preheat runs by phase
+	PreheatRunsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "preheat_runs_total",
+			Help:      "Total number of finished preheat runs by phase.",
+		},
+		[]string{"phase"},
+	)
+
+	// HostViolationsTotal counts the proxy requests rejected by host validation by reason
+	HostViolationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "host_violations_total",
+			Help:      "Total number of proxy requests rejected by host validation.",
+		},
+		[]string{"reason"},
+	)
+
 	// DiskUsage defines the current disk used per storage path (unit: GB).
 	DiskUsage = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -132,6 +276,330 @@ var (
 		[]string{"path"},
 	)
 
+	// PanicsTotal counts the recovered panics of http handlers by route.
+	PanicsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "panics_total",
+			Help:      "Total number of recovered panics of http handlers by route.",
+		},
+		[]string{"route"},
+	)
+
+	// TokenRefreshTotal counts the background refreshes of hot service tokens by result.
+	TokenRefreshTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refresh_total",
+			Help:      "Total number of background refreshes of hot service tokens by result.",
+		},
+		[]string{"result"},
+	)
+
+	// LayerQueryCacheTotal counts the layer location queries by cache result (hit/miss/coalesced).
+	LayerQueryCacheTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "layer_query_cache_total",
+			Help:      "Total number of layer location queries by cache result.",
+		},
+		[]string{"result"},
+	)
+
+	// ParentLayerTotal counts the layers downloaded from the parent cluster by result (hit, failed)
+	ParentLayerTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "parent_layer_total",
+			Help:      "Total layers downloaded from the parent cluster by result",
+		},
+		[]string{"result"},
+	)
+
+	// FederationLayerTotal counts the layers fetched from other clusters by result (hit, miss, failed)
+	FederationLayerTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "federation_layer_total",
+			Help:      "Total layers fetched from other clusters of federation by result",
+		},
+		[]string{"result"},
+	)
+
+	// CacheStoreDegraded is 1 while redis is unavailable and the cache store runs in degraded mode.
+	CacheStoreDegraded = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cache_store_degraded",
+			Help:      "Whether the cache store runs in degraded mode because redis is unavailable.",
+		},
+	)
+
+	// CacheStorePendingWrites is the number of layer writes waiting to be replayed into redis.
+	CacheStorePendingWrites = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cache_store_pending_writes",
+			Help:      "Number of layer writes waiting to be replayed into redis.",
+		},
+	)
+
+	// DownloadCancelTotal counts the layer downloads whose clients are all disconnected by result
+	// (canceled, completed_anyway)
+	DownloadCancelTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "download_cancel_total",
+			Help:      "Total layer downloads whose pulling clients are disconnected by result",
+		},
+		[]string{"result"},
+	)
+
+	// LayerVerifyTotal counts the background verifications of cached layers by result
+	// (passed, corrupted, failed)
+	LayerVerifyTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "layer_verify_total",
+			Help:      "Total number of background verifications of cached layers by result.",
+		},
+		[]string{"result"},
+	)
+
+	// LayerVerifyLagSeconds is the time since the least recently verified layer was verified, the layers
+	// never verified are counted from their modification time
+	LayerVerifyLagSeconds = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "layer_verify_lag_seconds",
+			Help:      "Seconds since the least recently verified cached layer was verified.",
+		},
+	)
+
+	// LayerVerifyPending is the number of cached layers not verified since the node started
+	LayerVerifyPending = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "layer_verify_pending",
+			Help:      "Number of cached layers not verified since the node started.",
+		},
+	)
+
+	// BlobUploadRequestsTotal counts the proxied blob upload requests by method and status, the session
+	// label is "start" for the request starting the upload and "session" for the requests of session
+	BlobUploadRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blob_upload_requests_total",
+			Help:      "Total number of proxied blob upload requests by registry, session, method and status.",
+		},
+		[]string{"registry", "session", "method", "status"},
+	)
+
+	// BlobUploadBytesTotal counts the bytes of blob upload request bodies streamed to original registries
+	BlobUploadBytesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blob_upload_bytes_total",
+			Help:      "Total bytes of blob uploads streamed to original registries.",
+		},
+		[]string{"registry"},
+	)
+
+	// BlobUploadSessions is the number of blob upload sessions pinned to upstream addresses
+	BlobUploadSessions = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "blob_upload_sessions",
+			Help:      "Number of active blob upload sessions by registry.",
+		},
+		[]string{"registry"},
+	)
+
+	// BlobMemoryCacheRequestsTotal counts the lookups of in-memory blob cache by result (hit, miss)
+	BlobMemoryCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blob_memory_cache_requests_total",
+			Help:      "Total number of in-memory blob cache lookups by result.",
+		},
+		[]string{"result"},
+	)
+
+	// BlobMemoryCacheBytes is the total size of blobs kept in memory
+	BlobMemoryCacheBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "blob_memory_cache_bytes",
+			Help:      "Total size in bytes of blobs kept in the in-memory cache.",
+		},
+	)
+
+	// BlobRequestsTotal counts the get-blob requests by the tier which served it (local_hit, peer_tcp,
+	// peer_torrent, peer_multi_source, origin, client_redirect, fallback_reverse_proxy)
+	BlobRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blob_requests_total",
+			Help:      "Total number of get-blob requests by registry and serving outcome.",
+		},
+		[]string{"registry", "outcome"},
+	)
+
+	// ManifestCacheRequestsTotal counts the lookups of manifest cache on master by result (hit, miss)
+	ManifestCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "manifest_cache_requests_total",
+			Help:      "Total number of manifest cache lookups by result.",
+		},
+		[]string{"result"},
+	)
+
+	// TokenCacheRequestsTotal counts the lookups of service token cache on master by result (hit,
+	// store_hit, miss)
+	TokenCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_cache_requests_total",
+			Help:      "Total number of service token cache lookups by result.",
+		},
+		[]string{"result"},
+	)
+
+	// TransferAbortedTotal counts the layer transfers aborted by watchdog because they stalled, by method
+	// (origin, tcp, torrent)
+	TransferAbortedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfer_aborted_total",
+			Help:      "Total number of stalled layer transfers aborted by watchdog.",
+		},
+		[]string{"method"},
+	)
+
+	// ShadowRequestsTotal counts the manifest requests mirrored to shadow registry by result (match,
+	// status_mismatch, digest_mismatch, error, skipped)
+	ShadowRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "shadow_requests_total",
+			Help:      "Total number of manifest requests mirrored to shadow registry by result.",
+		},
+		[]string{"registry", "result"},
+	)
+
+	// OriginFailoverTotal counts the original hosts marked unhealthy and failed over by registry and host
+	OriginFailoverTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "origin_failover_total",
+			Help:      "Total number of original hosts marked unhealthy and failed over.",
+		},
+		[]string{"registry", "host"},
+	)
+
+	// RegistryAccountQuotaRemaining the remaining pull quota of the rotated accounts reported by the RateLimit
+	// headers of original registry
+	RegistryAccountQuotaRemaining = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "registry_account_quota_remaining",
+			Help:      "Remaining pull quota of the rotated registry accounts.",
+		},
+		[]string{"registry", "account"},
+	)
+
+	// MisdirectedRequestsTotal counts the master-only API requests sent to the node not master, by side
+	// (received: rejected by this node, followed: this node resent them to the master responded)
+	MisdirectedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "misdirected_requests_total",
+			Help:      "Total number of master-only API requests sent to the node not master.",
+		},
+		[]string{"side"},
+	)
+
+	// EstargzConversionsTotal counts the conversions of cached layers to eStargz by result (converted,
+	// already: the layer is eStargz already, failed)
+	EstargzConversionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "estargz_conversions_total",
+			Help:      "Total number of conversions of cached layers to eStargz.",
+		},
+		[]string{"result"},
+	)
+
+	// EstargzManifestsTotal counts the manifests generated for the lazy-pulling tags by result (converted,
+	// unconverted: no layer converted and the original served, failed)
+	EstargzManifestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "estargz_manifests_total",
+			Help:      "Total number of manifests generated for the lazy-pulling tags.",
+		},
+		[]string{"result"},
+	)
+
+	// BlobRangeProxiedBytes counts the bytes of the range requests served with the ranges of other nodes
+	BlobRangeProxiedBytes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blob_range_proxied_bytes_total",
+			Help:      "Total bytes of blob range requests served with the ranges of other nodes.",
+		},
+	)
+
+	// LoadQueuedDownloads is the number of blob requests waiting for layer fetching or local serving
+	LoadQueuedDownloads = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "load_queued_downloads",
+			Help:      "Number of blob requests waiting for layer fetching or local serving.",
+		},
+	)
+
+	// LoadBandwidthSaturation is the served throughput of the last minute divided by the node bandwidth
+	LoadBandwidthSaturation = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "load_bandwidth_saturation",
+			Help:      "Served throughput of the last minute divided by the node bandwidth.",
+		},
+	)
+
+	// LoadBlobLatencyP95Seconds is the p95 latency of blob responses within the latency window
+	LoadBlobLatencyP95Seconds = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "load_blob_latency_p95_seconds",
+			Help:      "P95 latency of blob responses within the latency window.",
+		},
+	)
+
+	// UpstreamUp is 1 if the original host of registry is probed healthy, 0 if down
+	UpstreamUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "upstream_up",
+			Help:      "Whether the original host of registry is probed healthy.",
+		},
+		[]string{"registry", "host"},
+	)
+
+	// UpstreamProbeDurationSeconds observes the probes of original hosts by endpoint (v2, token)
+	UpstreamProbeDurationSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_probe_duration_seconds",
+			Help:      "Duration of the probes of original hosts.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"host", "endpoint"},
+	)
+
 	// ErrorsTotal counts errors by component, operation and error_type (for alerting and debugging).
 	ErrorsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -0,0 +1,142 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package objectstore provides the S3-compatible object storage tier for layers, the objects are keyed
+// by layer digest.
+package objectstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+// LayerStore defines the interface of object storage which stores the layers
+type LayerStore interface {
+	// StatLayer returns the size of layer, returns false if the layer not exist
+	StatLayer(ctx context.Context, digest string) (int64, bool, error)
+	// GetLayer returns the reader of layer, the reader should be closed by caller
+	GetLayer(ctx context.Context, digest string) (io.ReadCloser, error)
+	// UploadLayer uploads the layer file, the file content will be verified with digest before upload
+	UploadLayer(ctx context.Context, digest, filePath string) error
+}
+
+// S3Store defines the object storage with S3-compatible API
+type S3Store struct {
+	bucket string
+	prefix string
+	client *minio.Client
+}
+
+var (
+	globalStore LayerStore
+	syncOnce    sync.Once
+)
+
+// GlobalLayerStore returns the global object storage, returns nil if object storage not enabled
+func GlobalLayerStore() LayerStore {
+	syncOnce.Do(func() {
+		op := options.GlobalOptions()
+		if !op.ObjectStorage.Enable {
+			return
+		}
+		s, err := NewS3Store(&op.ObjectStorage)
+		if err != nil {
+			logger.Errorf("create object storage failed: %s", err.Error())
+			return
+		}
+		globalStore = s
+	})
+	return globalStore
+}
+
+// NewS3Store create the S3-compatible object storage
+func NewS3Store(cfg *options.ObjectStorageConfig) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "create s3 client for '%s' failed", cfg.Endpoint)
+	}
+	return &S3Store{
+		bucket: cfg.Bucket,
+		prefix: cfg.Prefix,
+		client: client,
+	}, nil
+}
+
+func (s *S3Store) objectKey(digest string) string {
+	return path.Join(s.prefix, "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+// StatLayer returns the size of layer in bucket
+func (s *S3Store) StatLayer(ctx context.Context, digest string) (int64, bool, error) {
+	key := s.objectKey(digest)
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == 404 {
+			return 0, false, nil
+		}
+		metrics.RecordError(metrics.ComponentObjectStore, "stat")
+		return 0, false, errors.Wrapf(err, "stat object '%s/%s' failed", s.bucket, key)
+	}
+	return info.Size, true, nil
+}
+
+// GetLayer returns the reader of layer in bucket
+func (s *S3Store) GetLayer(ctx context.Context, digest string) (io.ReadCloser, error) {
+	key := s.objectKey(digest)
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		metrics.RecordError(metrics.ComponentObjectStore, "get")
+		return nil, errors.Wrapf(err, "get object '%s/%s' failed", s.bucket, key)
+	}
+	return obj, nil
+}
+
+// UploadLayer uploads the layer file into bucket. The file is hashed before upload to make sure
+// the object keyed by digest is not polluted.
+func (s *S3Store) UploadLayer(ctx context.Context, digest, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "open layer '%s' failed", filePath)
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return errors.Wrapf(err, "hash layer '%s' failed", filePath)
+	}
+	expected := strings.TrimPrefix(digest, "sha256:")
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != expected {
+		return errors.Errorf("layer '%s' digest '%s' not same as expected '%s'", filePath, actual, expected)
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "seek layer '%s' failed", filePath)
+	}
+	key := s.objectKey(digest)
+	if _, err = s.client.PutObject(ctx, s.bucket, key, f, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	}); err != nil {
+		metrics.RecordError(metrics.ComponentObjectStore, "upload")
+		return errors.Wrapf(err, "put object '%s/%s' failed", s.bucket, key)
+	}
+	metrics.TransferSize.WithLabelValues("upload_object_storage").Add(float64(size) / 1e9)
+	return nil
+}
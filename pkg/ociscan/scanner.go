@@ -19,6 +19,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/containerd/containerd"
@@ -34,6 +35,7 @@ import (
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/pkg/logger"
 	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
 	"github.com/penglongli/accelerboat/pkg/store"
 	"github.com/penglongli/accelerboat/pkg/utils"
 )
@@ -43,7 +45,8 @@ type ScanHandler struct {
 	op         *options.AccelerBoatOption
 	cacheStore store.CacheStore
 
-	cc               *containerdChecker
+	// cc the containerd checker, it is nil until the containerd socket is connected
+	cc               atomic.Pointer[containerdChecker]
 	containerdLayers map[string]string
 }
 
@@ -59,45 +62,95 @@ func NewScanHandler() *ScanHandler {
 
 // Init the scan handler
 func (s *ScanHandler) Init() error {
-	s.cc = s.initContainerdChecker()
-	s.reportOCILayers(context.Background())
+	if cc := s.initContainerdChecker(); cc != nil {
+		s.cc.Store(cc)
+	}
+	s.reportOCILayers(context.Background(), true)
 	return nil
 }
 
-// TickerReport ticker report oci layers
+// TickerReport ticker report oci layers, the added and removed layers are reported every interval, and all
+// the layers are reported every full interval to keep them alive in cache store
 func (s *ScanHandler) TickerReport(ctx context.Context) {
-	ticker := time.NewTicker(60 * time.Second)
+	interval := s.op.OCIReport.Interval
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
 	defer ticker.Stop()
+	lastFull := time.Now()
 	for {
 		select {
 		case <-ticker.C:
-			s.reportOCILayers(ctx)
+			if interval != s.op.OCIReport.Interval {
+				interval = s.op.OCIReport.Interval
+				ticker.Reset(time.Duration(interval) * time.Second)
+			}
+			full := time.Since(lastFull) >= time.Duration(s.op.OCIReport.FullInterval)*time.Second
+			if full {
+				lastFull = time.Now()
+			}
+			s.reportOCILayers(ctx, full)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-// reportOCILayers report docker and containerd oci-layers
-func (s *ScanHandler) reportOCILayers(ctx context.Context) {
-	if s.cc != nil {
-		layers := s.cc.Parse(ctx)
-		for k, v := range layers {
-			if err := s.cacheStore.SaveOCILayer(ctx, store.CONTAINERD, k, v); err != nil {
-				logger.Errorf("save oci layer '%s' failed: %s", k, err.Error())
-			}
+// reportOCILayers report containerd oci-layers, only the changed layers are reported if not full
+func (s *ScanHandler) reportOCILayers(ctx context.Context, full bool) {
+	cc := s.cc.Load()
+	if cc == nil {
+		// the containerd socket may become available after startup
+		if cc = s.initContainerdChecker(); cc == nil {
+			return
 		}
-		for k := range s.containerdLayers {
-			if _, ok := layers[k]; ok {
-				continue
-			}
-			if err := s.cacheStore.DeleteOCILayer(ctx, store.CONTAINERD, k); err != nil {
-				logger.Errorf("delete oci layer '%s' failed: %s", k, err.Error())
-			} else {
-				logger.Infof("delete oci layer '%s' success", k)
-			}
+		s.cc.Store(cc)
+		full = true
+	}
+	// the layers are not reported with partial result, otherwise the missing layers will be deleted
+	layers, err := cc.Parse(ctx)
+	if err != nil {
+		logger.ErrorContextf(ctx, "parse containerd layers failed: %s", err.Error())
+		return
+	}
+	added := make(map[string]string)
+	removed := make(map[string]string)
+	for k, v := range layers {
+		prev, ok := s.containerdLayers[k]
+		if ok && prev != v {
+			removed[k] = prev
+		}
+		if full || !ok || prev != v {
+			added[k] = v
+		}
+	}
+	for k, v := range s.containerdLayers {
+		if _, ok := layers[k]; !ok {
+			removed[k] = v
 		}
 	}
+	if err = s.cacheStore.DeleteOCILayers(ctx, store.CONTAINERD, removed); err != nil {
+		logger.Errorf("delete %d oci layers failed: %s", len(removed), err.Error())
+		return
+	}
+	if err = s.cacheStore.SaveOCILayers(ctx, store.CONTAINERD, added); err != nil {
+		logger.Errorf("save %d oci layers failed: %s", len(added), err.Error())
+		return
+	}
+	logger.V(3).Infof("report oci layers(full=%v) success, saved %d, deleted %d", full, len(added), len(removed))
+	for k := range removed {
+		if _, ok := layers[k]; ok {
+			continue
+		}
+		logger.Infof("delete oci layer '%s' success", k)
+		recorder.Global.Record(ctx, recorder.Event{
+			Type:        recorder.EventTypeCacheReconciled,
+			EventStatus: recorder.Normal,
+			Details: map[string]interface{}{
+				"digest": k, "source": string(store.CONTAINERD), "reason": "oci_layer_gone",
+			},
+			Message: "OCI layer removed from cache store because it is not in containerd anymore",
+		})
+	}
+	s.containerdLayers = layers
 }
 
 // GenerateLayer generate layers to target file with oci api
@@ -106,10 +159,11 @@ func (s *ScanHandler) GenerateLayer(ctx context.Context, ociType string, layer s
 	var err error
 	switch store.LayerType(ociType) {
 	case store.CONTAINERD:
-		if s.cc == nil {
+		cc := s.cc.Load()
+		if cc == nil {
 			return "", errors.Errorf("copy containerd layer no handler")
 		}
-		result, err = s.handleContainerdCopy(ctx, layer)
+		result, err = s.handleContainerdCopy(ctx, cc, layer)
 	default:
 		return "", errors.Errorf("layer path 'type(%s), file(%s)' is unknown", ociType, layer)
 	}
@@ -120,19 +174,16 @@ func (s *ScanHandler) GenerateLayer(ctx context.Context, ociType string, layer s
 	return result, nil
 }
 
-// handleContainerdCopy handle containerd copy
-func (s *ScanHandler) handleContainerdCopy(ctx context.Context, layer string) (string, error) {
+// handleContainerdCopy handle containerd copy, the layer is read from the first namespace that has it
+func (s *ScanHandler) handleContainerdCopy(ctx context.Context, cc *containerdChecker, layer string) (string, error) {
 	fullDigest := "sha256:" + strings.TrimPrefix(layer, "sha256:")
 	layerDigest := digest.Digest(fullDigest)
-	nsCtx := namespaces.WithNamespace(ctx, "k8s.io")
-	if _, err := s.cc.Client.ContentStore().Info(nsCtx, layerDigest); err != nil {
-		if errdefs.IsNotFound(err) {
-			return "", errors.Wrapf(err, "containerd get layer '%s' not found", layerDigest)
-		}
-		return "", errors.Wrapf(err, "containerd get layer info failed")
+	nsCtx, err := cc.locate(ctx, layerDigest)
+	if err != nil {
+		return "", err
 	}
 
-	ra, err := s.cc.Client.ContentStore().ReaderAt(nsCtx, ocispec.Descriptor{Digest: digest.Digest(fullDigest)})
+	ra, err := cc.Client.ContentStore().ReaderAt(nsCtx, ocispec.Descriptor{Digest: digest.Digest(fullDigest)})
 	if err != nil {
 		return "", errors.Wrapf(err, "containerd read digest failed")
 	}
@@ -144,7 +195,7 @@ func (s *ScanHandler) handleContainerdCopy(ctx context.Context, layer string) (s
 	reader := content.NewReader(ra)
 	targetFile := path.Join(s.op.StorageConfig.DownloadPath, layerFileName)
 	_ = os.RemoveAll(targetFile)
-	dstFile, err := os.Create(targetFile)
+	dstFile, err := os.OpenFile(targetFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, s.op.StorageConfig.FilePerm())
 	if err != nil {
 		return "", errors.Wrapf(err, "containerd create layer '%s' failed", targetFile)
 	}
@@ -168,9 +219,10 @@ type ImageLayerInfo struct {
 
 // ImageInfo holds image name, target digest and layer list for a managed OCI image.
 type ImageInfo struct {
-	Name   string           `json:"name"`
-	Target string           `json:"target"`
-	Layers []ImageLayerInfo `json:"layers"`
+	Name      string           `json:"name"`
+	Namespace string           `json:"namespace,omitempty"`
+	Target    string           `json:"target"`
+	Layers    []ImageLayerInfo `json:"layers"`
 }
 
 // OCIPathLayerInfo holds digest, size and path for a layer file under OCIPath.
@@ -183,18 +235,10 @@ type OCIPathLayerInfo struct {
 // ListManagedImages returns OCI images from containerd (if enabled) with each image's layer info.
 // ociPath is the directory to check for existing layer files (e.g. OCIPath); may be empty.
 func (s *ScanHandler) ListManagedImages(ctx context.Context, ociPath string) ([]ImageInfo, error) {
-	if s.cc == nil {
+	cc := s.cc.Load()
+	if cc == nil {
 		return nil, nil
 	}
-	nsCtx := namespaces.WithNamespace(ctx, "k8s.io")
-	client := s.cc.Client
-	cs := client.ContentStore()
-	platform := platforms.Default()
-
-	imageList, err := client.ListImages(nsCtx)
-	if err != nil {
-		return nil, errors.Wrap(err, "list containerd images failed")
-	}
 	// Build set of layer digests that have a file under ociPath (for LocalPath).
 	ociPathLayers := make(map[string]string)
 	if ociPath != "" {
@@ -210,6 +254,29 @@ func (s *ScanHandler) ListManagedImages(ctx context.Context, ociPath string) ([]
 		})
 	}
 
+	out := make([]ImageInfo, 0)
+	for _, ns := range s.op.ContainerdConfig.Namespaces {
+		nsImages, err := cc.listImages(ctx, ns, ociPathLayers)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list containerd images of namespace '%s' failed", ns)
+		}
+		out = append(out, nsImages...)
+	}
+	return out, nil
+}
+
+// listImages returns the images of containerd namespace with their layers
+func (c *containerdChecker) listImages(ctx context.Context, ns string,
+	ociPathLayers map[string]string) ([]ImageInfo, error) {
+	nsCtx := namespaces.WithNamespace(ctx, ns)
+	cs := c.Client.ContentStore()
+	platform := platforms.Default()
+	listCtx, cancel := context.WithTimeout(nsCtx, c.timeout)
+	imageList, err := c.Client.ListImages(listCtx)
+	cancel()
+	if err != nil {
+		return nil, errors.Wrap(err, "list containerd images failed")
+	}
 	out := make([]ImageInfo, 0, len(imageList))
 	for _, img := range imageList {
 		target := img.Target()
@@ -228,9 +295,10 @@ func (s *ScanHandler) ListManagedImages(ctx context.Context, ociPath string) ([]
 			layers = append(layers, li)
 		}
 		out = append(out, ImageInfo{
-			Name:   img.Name(),
-			Target: target.Digest.String(),
-			Layers: layers,
+			Name:      img.Name(),
+			Namespace: ns,
+			Target:    target.Digest.String(),
+			Layers:    layers,
 		})
 	}
 	return out, nil
@@ -265,43 +333,71 @@ func ListOCIPathLayers(ociPath string) ([]OCIPathLayerInfo, error) {
 // containerdChecker defines the containerd checker
 type containerdChecker struct {
 	Client *containerd.Client
+
+	namespaces []string
+	timeout    time.Duration
 }
 
-// initContainerdChecker init the containerd checker
+// initContainerdChecker init the containerd checker, returns nil if containerd is not enabled or the
+// socket is not available
 func (s *ScanHandler) initContainerdChecker() *containerdChecker {
 	if !s.op.EnableContainerd {
 		return nil
 	}
-	cc, err := containerd.New("/run/containerd/containerd.sock")
+	conf := s.op.ContainerdConfig
+	timeout := time.Duration(conf.Timeout) * time.Second
+	cc, err := containerd.New(conf.Socket, containerd.WithTimeout(timeout))
 	if err != nil {
-		logger.Errorf("ignore containerd. init containerd client failed: %s", err.Error())
+		logger.Errorf("ignore containerd. init containerd client '%s' failed: %s", conf.Socket, err.Error())
 		return nil
 	}
-	logger.Infof("init containerd client success")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	var vs containerd.Version
-	if vs, err = cc.Version(ctx); err != nil {
+	vs, err := cc.Version(ctx)
+	if err != nil {
 		logger.Warnf("ignore containerd. get containerd version failed: %s", err.Error())
-	} else {
-		logger.Infof("init containerd get version sucees: %s", vs.Version)
+		_ = cc.Close()
+		return nil
 	}
+	logger.Infof("init containerd client success, version: %s, namespaces: %v", vs.Version, conf.Namespaces)
 	return &containerdChecker{
-		Client: cc,
+		Client:     cc,
+		namespaces: conf.Namespaces,
+		timeout:    timeout,
 	}
 }
 
-// Parse the layers from containerd
-func (c *containerdChecker) Parse(ctx context.Context) map[string]string {
-	nsCtx := namespaces.WithNamespace(ctx, "k8s.io")
+// Parse the layers of all the namespaces from containerd
+func (c *containerdChecker) Parse(ctx context.Context) (map[string]string, error) {
 	result := make(map[string]string)
-	err := c.Client.ContentStore().Walk(nsCtx, func(info content.Info) error {
-		digestStr := strings.TrimPrefix(info.Digest.String(), "sha256:")
-		result[digestStr] = digestStr
-		return nil
-	})
-	if err != nil {
-		logger.ErrorContextf(ctx, "containerd walk get digests failed: %s", err.Error())
+	for _, ns := range c.namespaces {
+		nsCtx, cancel := context.WithTimeout(namespaces.WithNamespace(ctx, ns), c.timeout)
+		err := c.Client.ContentStore().Walk(nsCtx, func(info content.Info) error {
+			digestStr := strings.TrimPrefix(info.Digest.String(), "sha256:")
+			result[digestStr] = digestStr
+			return nil
+		})
+		cancel()
+		if err != nil {
+			return nil, errors.Wrapf(err, "containerd walk namespace '%s' get digests failed", ns)
+		}
+	}
+	return result, nil
+}
+
+// locate returns the context with the first namespace that has the layer
+func (c *containerdChecker) locate(ctx context.Context, layerDigest digest.Digest) (context.Context, error) {
+	for _, ns := range c.namespaces {
+		nsCtx := namespaces.WithNamespace(ctx, ns)
+		infoCtx, cancel := context.WithTimeout(nsCtx, c.timeout)
+		_, err := c.Client.ContentStore().Info(infoCtx, layerDigest)
+		cancel()
+		if err == nil {
+			return nsCtx, nil
+		}
+		if !errdefs.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "containerd get layer info of namespace '%s' failed", ns)
+		}
 	}
-	return result
+	return nil, errors.Errorf("containerd get layer '%s' not found in namespaces %v", layerDigest, c.namespaces)
 }
@@ -0,0 +1,90 @@
+/*
+ * Tencent is pleased to support the open source community by making Blueking Container Service available.
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ * Licensed under the MIT License (the "License"); you may not use this file except
+ * in compliance with the License. You may obtain a copy of the License at
+ * http://opensource.org/licenses/MIT
+ * Unless required by applicable law or agreed to in writing, software distributed under
+ * the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+ * either express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ociscan
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/store"
+)
+
+// SeedLayer defines the containerd layer exported into OCIPath for seeding
+type SeedLayer struct {
+	// Digest the hex of layer digest, without "sha256:" prefix
+	Digest string
+	Size   int64
+	Path   string
+	// Refs the number of containerd images referencing the layer
+	Refs int
+}
+
+// ExportSeedLayers exports the most common layers of containerd images into OCIPath, the layers referenced
+// by more images are exported first and then the larger ones. At most maxLayers are returned, the layers
+// already exported are not exported again.
+func (s *ScanHandler) ExportSeedLayers(ctx context.Context, maxLayers int) ([]*SeedLayer, error) {
+	imageList, err := s.ListManagedImages(ctx, s.op.StorageConfig.OCIPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list containerd images failed")
+	}
+	layers := make(map[string]*SeedLayer)
+	for _, img := range imageList {
+		// the same layer is counted once for the image
+		counted := make(map[string]struct{})
+		for _, li := range img.Layers {
+			d := strings.TrimPrefix(li.Digest, "sha256:")
+			if _, ok := counted[d]; ok {
+				continue
+			}
+			counted[d] = struct{}{}
+			sl, ok := layers[d]
+			if !ok {
+				sl = &SeedLayer{Digest: d, Size: li.Size, Path: li.LocalPath}
+				layers[d] = sl
+			}
+			sl.Refs++
+		}
+	}
+	candidates := make([]*SeedLayer, 0, len(layers))
+	for _, sl := range layers {
+		candidates = append(candidates, sl)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Refs != candidates[j].Refs {
+			return candidates[i].Refs > candidates[j].Refs
+		}
+		return candidates[i].Size > candidates[j].Size
+	})
+	if len(candidates) > maxLayers {
+		candidates = candidates[:maxLayers]
+	}
+	result := make([]*SeedLayer, 0, len(candidates))
+	for _, sl := range candidates {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if sl.Path == "" {
+			// the layer may be garbage collected by containerd after listed
+			if sl.Path, err = s.GenerateLayer(ctx, string(store.CONTAINERD), sl.Digest); err != nil {
+				logger.WarnContextf(ctx, "export seed layer '%s' failed: %s", sl.Digest, err.Error())
+				continue
+			}
+		}
+		result = append(result, sl)
+	}
+	return result, nil
+}
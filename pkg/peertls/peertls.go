@@ -0,0 +1,229 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package peertls manages the mutual-TLS channel of node-to-node layer transfer. Every node serves and
+// requests with the cert issued by the cluster CA, the cert of serving node is verified with its IP.
+package peertls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	// issuedCertValidity the validity of node cert issued by self-managed CA, it is re-issued at restart
+	issuedCertValidity = 365 * 24 * time.Hour
+)
+
+// Manager holds the CA and node cert of peer transfer
+type Manager struct {
+	sync.RWMutex
+	config    *options.PeerTLSConfig
+	caPool    *x509.CertPool
+	cert      *tls.Certificate
+	certMod   time.Time
+	clientTLS *tls.Config
+	client    *http.Client
+}
+
+// Global the global peer tls manager
+var Global = &Manager{}
+
+// Init loads the cluster CA, and issues or loads the cert of node with address
+func (m *Manager) Init(config *options.PeerTLSConfig, address string) error {
+	caPEM, err := os.ReadFile(config.CAFile)
+	if err != nil {
+		return errors.Wrapf(err, "read ca file '%s' failed", config.CAFile)
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caPEM) {
+		return errors.Errorf("parse ca file '%s' failed", config.CAFile)
+	}
+	m.config = config
+	m.caPool = caPool
+	if config.CertFile != "" && config.KeyFile != "" {
+		if err = m.loadCert(); err != nil {
+			return err
+		}
+	} else {
+		cert, err := issueCert(caPEM, config.CAKeyFile, address)
+		if err != nil {
+			return errors.Wrapf(err, "issue node cert failed")
+		}
+		m.cert = cert
+		logger.Infof("peer tls node cert issued for '%s' by self-managed ca", address)
+	}
+	m.clientTLS = &tls.Config{
+		RootCAs:              caPool,
+		GetClientCertificate: m.getClientCertificate,
+		MinVersion:           tls.VersionTLS12,
+	}
+	m.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           nil,
+			TLSClientConfig: m.clientTLS.Clone(),
+		},
+	}
+	return nil
+}
+
+// ServerConfig returns the tls config of peer transfer server, the client cert issued by CA is required
+func (m *Manager) ServerConfig() *tls.Config {
+	return &tls.Config{
+		ClientCAs:      m.caPool,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		GetCertificate: m.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// Client returns the http client to request the peer transfer server, the serving node is verified
+// by the IP in cert SANs
+func (m *Manager) Client() *http.Client {
+	return m.client
+}
+
+// ClientConfig returns the tls config to request the peer servers, e.g. the gRPC internal API
+func (m *Manager) ClientConfig() *tls.Config {
+	return m.clientTLS.Clone()
+}
+
+// VerifyPeer checks the target is one of the nodes discovered by service discovery
+func (m *Manager) VerifyPeer(target string) error {
+	for _, ep := range leaderselector.Endpoints() {
+		if host, _, err := net.SplitHostPort(ep); err == nil && host == target {
+			return nil
+		}
+	}
+	return errors.Errorf("peer '%s' is not in service discovery endpoints", target)
+}
+
+func (m *Manager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.currentCert()
+}
+
+func (m *Manager) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return m.currentCert()
+}
+
+// currentCert returns the node cert, the cert files are reloaded if modified (e.g. rotated by cert-manager)
+func (m *Manager) currentCert() (*tls.Certificate, error) {
+	if m.config.CertFile == "" {
+		return m.cert, nil
+	}
+	fi, err := os.Stat(m.config.CertFile)
+	m.RLock()
+	cert, certMod := m.cert, m.certMod
+	m.RUnlock()
+	if err != nil || !fi.ModTime().After(certMod) {
+		return cert, nil
+	}
+	if err = m.loadCert(); err != nil {
+		logger.Errorf("reload peer tls cert failed, keep the previous: %s", err.Error())
+		return cert, nil
+	}
+	m.RLock()
+	defer m.RUnlock()
+	return m.cert, nil
+}
+
+func (m *Manager) loadCert() error {
+	fi, err := os.Stat(m.config.CertFile)
+	if err != nil {
+		return errors.Wrapf(err, "stat cert file '%s' failed", m.config.CertFile)
+	}
+	cert, err := tls.LoadX509KeyPair(m.config.CertFile, m.config.KeyFile)
+	if err != nil {
+		return errors.Wrapf(err, "load cert '%s' and key '%s' failed", m.config.CertFile, m.config.KeyFile)
+	}
+	m.Lock()
+	m.cert = &cert
+	m.certMod = fi.ModTime()
+	m.Unlock()
+	logger.Infof("peer tls node cert loaded from '%s'", m.config.CertFile)
+	return nil
+}
+
+// issueCert issues the cert of node signed by CA, the node address is in IP SANs
+func issueCert(caPEM []byte, caKeyFile, address string) (*tls.Certificate, error) {
+	caKeyPEM, err := os.ReadFile(caKeyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read ca key file '%s' failed", caKeyFile)
+	}
+	caPair, err := tls.X509KeyPair(caPEM, caKeyPEM)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load ca key pair failed")
+	}
+	caCert, err := x509.ParseCertificate(caPair.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse ca cert failed")
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, errors.Errorf("node address '%s' is not ip", address)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "generate key failed")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrapf(err, "generate serial number failed")
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: address, Organization: []string{"accelerboat"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(issuedCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{ip},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caPair.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create cert failed")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal key failed")
+	}
+	cert, err := tls.X509KeyPair(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "load issued cert failed")
+	}
+	return &cert, nil
+}
+
+type peerRequestKey struct{}
+
+// WithPeerRequest marks the request is received by the peer transfer server
+func WithPeerRequest(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), peerRequestKey{}, true))
+}
+
+// IsPeerRequest returns whether the request is received by the peer transfer server
+func IsPeerRequest(req *http.Request) bool {
+	v, _ := req.Context().Value(peerRequestKey{}).(bool)
+	return v
+}
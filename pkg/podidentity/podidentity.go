@@ -0,0 +1,126 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package podidentity resolves the pod of client ip with an informer cache over pods, so the pulls can be
+// attributed to the namespaces and pods. The pods of host network share the ip of node and are not
+// indexed, the pulls of kubelet/containerd are from the node ip too.
+package podidentity
+
+import (
+	"context"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	// ContextFieldNamespace the logger context field of the namespace of client pod
+	ContextFieldNamespace = "podNamespace"
+	// ContextFieldPod the logger context field of the name of client pod
+	ContextFieldPod = "pod"
+
+	indexPodIP = "podIP"
+)
+
+// indexer is nil before the informer synced, no pod is resolved then
+var indexer atomic.Pointer[cache.Indexer]
+
+// Run runs the informer over pods until ctx done
+func Run(ctx context.Context, client kubernetes.Interface) error {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	informer := factory.Core().V1().Pods().Informer()
+	// only the fields to resolve pod ip are kept in cache
+	if err := informer.SetTransform(stripPod); err != nil {
+		return err
+	}
+	if err := informer.AddIndexers(cache.Indexers{indexPodIP: podIPIndex}); err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return ctx.Err()
+	}
+	idx := informer.GetIndexer()
+	indexer.Store(&idx)
+	logger.Infof("pod identity informer synced")
+	<-ctx.Done()
+	return nil
+}
+
+func stripPod(obj interface{}) (interface{}, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return obj, nil
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Spec: corev1.PodSpec{HostNetwork: pod.Spec.HostNetwork},
+		Status: corev1.PodStatus{
+			Phase:  pod.Status.Phase,
+			PodIP:  pod.Status.PodIP,
+			PodIPs: pod.Status.PodIPs,
+		},
+	}, nil
+}
+
+func podIPIndex(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.HostNetwork {
+		return nil, nil
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return nil, nil
+	}
+	result := make([]string, 0, len(pod.Status.PodIPs)+1)
+	if pod.Status.PodIP != "" {
+		result = append(result, pod.Status.PodIP)
+	}
+	for _, ip := range pod.Status.PodIPs {
+		if ip.IP != "" && ip.IP != pod.Status.PodIP {
+			result = append(result, ip.IP)
+		}
+	}
+	return result, nil
+}
+
+// Lookup returns the namespace and name of the pod with the ip, returns false if not found
+func Lookup(ip string) (string, string, bool) {
+	idx := indexer.Load()
+	if idx == nil || ip == "" {
+		return "", "", false
+	}
+	objs, err := (*idx).ByIndex(indexPodIP, ip)
+	if err != nil || len(objs) == 0 {
+		return "", "", false
+	}
+	pod := objs[0].(*corev1.Pod)
+	return pod.Namespace, pod.Name, true
+}
+
+// WithIdentity returns the context with the namespace and pod of client ip as logger fields, they are
+// attached to the logs and recorder events of the request
+func WithIdentity(ctx context.Context, clientIP string) context.Context {
+	namespace, name, ok := Lookup(clientIP)
+	if !ok {
+		return ctx
+	}
+	return logger.WithContextFields(ctx, ContextFieldNamespace, namespace, ContextFieldPod, name)
+}
+
+// FromContext returns the namespace and pod of the request, they are empty if the client is not a pod
+func FromContext(ctx context.Context) (string, string) {
+	return logger.GetContextField(ctx, ContextFieldNamespace), logger.GetContextField(ctx, ContextFieldPod)
+}
@@ -0,0 +1,339 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package preheat implements the declarative image preheating. Every ConfigMap selected by the preheat
+// config is a task, its data lists the images and the optional cron schedule:
+//
+//	images: |
+//	  docker.io/library/nginx:1.25
+//	  registry.example.com/app/server:v1
+//	schedule: "0 2 * * *"
+//	platforms: linux/amd64,linux/arm64
+//
+// The task without schedule runs once after it is created or changed. The master pulls the images through
+// the local proxy, and records the status of the last run into the annotation of ConfigMap.
+package preheat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	// StatusAnnotation the annotation of ConfigMap records the status of task
+	StatusAnnotation = "accelerboat.github.com/preheat-status"
+
+	dataImages    = "images"
+	dataSchedule  = "schedule"
+	dataPlatforms = "platforms"
+
+	triggerChanged  = "changed"
+	triggerSchedule = "schedule"
+)
+
+// taskSpec defines the preheat task parsed from ConfigMap
+type taskSpec struct {
+	images    []string
+	schedule  cron.Schedule
+	platforms platforms.MatchComparer
+	hash      string
+}
+
+// taskStatus defines the status of task recorded in the annotation of ConfigMap
+type taskStatus struct {
+	// SpecHash the hash of the spec of last run, the task without schedule runs again if changed
+	SpecHash string               `json:"specHash"`
+	LastRun  *apitypes.PreheatRun `json:"lastRun,omitempty"`
+	Error    string               `json:"error,omitempty"`
+	Updated  time.Time            `json:"updated"`
+}
+
+// Controller runs the preheat tasks on master
+type Controller struct {
+	client   kubernetes.Interface
+	endpoint string
+}
+
+// NewController creates the preheat controller
+func NewController(client kubernetes.Interface) *Controller {
+	return &Controller{
+		client:   client,
+		endpoint: localEndpoint(options.GlobalOptions()),
+	}
+}
+
+// op returns the current snapshot of options, the controller lives across config reloads so it is not kept
+func (c *Controller) op() *options.AccelerBoatOption {
+	return options.GlobalOptions()
+}
+
+func localEndpoint(op *options.AccelerBoatOption) string {
+	return fmt.Sprintf("http://127.0.0.1:%d", op.HTTPPort)
+}
+
+// runningTasks the tasks running now, one task runs only once at the same time
+var runningTasks = newTaskTracker()
+
+type taskTracker struct {
+	sync.Mutex
+	running map[string]struct{}
+}
+
+func newTaskTracker() *taskTracker {
+	return &taskTracker{running: make(map[string]struct{})}
+}
+
+func (t *taskTracker) acquire(task string) bool {
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.running[task]; ok {
+		return false
+	}
+	t.running[task] = struct{}{}
+	return true
+}
+
+func (t *taskTracker) release(task string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.running, task)
+}
+
+// Run syncs the preheat tasks while the node is master until ctx done
+func (c *Controller) Run(ctx context.Context) {
+	history.setLimit(c.op().Preheat.HistoryLimit)
+	ticker := time.NewTicker(time.Duration(c.op().Preheat.SyncInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !leaderselector.IsMaster(c.op().Address) {
+				continue
+			}
+			if err := c.sync(ctx); err != nil {
+				logger.Errorf("sync preheat tasks failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (c *Controller) sync(ctx context.Context) error {
+	cfg := c.op().Preheat
+	cms, err := c.client.CoreV1().ConfigMaps(cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: cfg.LabelSelector,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "list preheat configmaps failed")
+	}
+	now := time.Now()
+	for i := range cms.Items {
+		cm := &cms.Items[i]
+		task := cm.Namespace + "/" + cm.Name
+		status := parseStatus(cm)
+		spec, err := parseSpec(cm)
+		if err != nil {
+			if status.Error != err.Error() {
+				logger.Warnf("preheat task '%s' invalid: %s", task, err.Error())
+				c.updateStatus(ctx, cm.Namespace, cm.Name, func(s *taskStatus) { s.Error = err.Error() })
+			}
+			continue
+		}
+		trigger := dueTrigger(spec, status, now)
+		if trigger == "" || !runningTasks.acquire(task) {
+			continue
+		}
+		go func() {
+			defer runningTasks.release(task)
+			c.runTask(ctx, cm.Namespace, cm.Name, spec, trigger)
+		}()
+	}
+	return nil
+}
+
+// dueTrigger returns the trigger if the task should run, the task runs after changed, or at the schedule
+// time after the last run
+func dueTrigger(spec *taskSpec, status *taskStatus, now time.Time) string {
+	if spec.hash != status.SpecHash {
+		return triggerChanged
+	}
+	if spec.schedule == nil || status.LastRun == nil {
+		return ""
+	}
+	if !spec.schedule.Next(status.LastRun.StartTime).After(now) {
+		return triggerSchedule
+	}
+	return ""
+}
+
+func (c *Controller) runTask(ctx context.Context, namespace, name string, spec *taskSpec, trigger string) {
+	task := namespace + "/" + name
+	run := newRun(task, name, trigger, len(spec.images))
+	ctx = logger.WithContextFields(ctx, "preheatTask", task, "runID", run.RunID)
+	logger.InfoContextf(ctx, "preheat task started by '%s', images: %v", trigger, spec.images)
+	history.add(run)
+	c.updateStatus(ctx, namespace, name, func(s *taskStatus) {
+		s.SpecHash = spec.hash
+		s.LastRun = run
+		s.Error = ""
+	})
+	final := pullImages(ctx, c.endpoint, run, spec.images, spec.platforms)
+	c.updateStatus(ctx, namespace, name, func(s *taskStatus) { s.LastRun = final })
+}
+
+func newRun(task, name, trigger string, images int) *apitypes.PreheatRun {
+	return &apitypes.PreheatRun{
+		Task:      task,
+		RunID:     fmt.Sprintf("%s-%d", name, time.Now().UnixMilli()),
+		Trigger:   trigger,
+		Phase:     apitypes.PreheatPhaseRunning,
+		StartTime: time.Now(),
+		Images:    make([]*apitypes.PreheatImageResult, 0, images),
+	}
+}
+
+// pullImages pulls the images of run through the proxy of endpoint, returns the final run after recorded
+func pullImages(ctx context.Context, endpoint string, run *apitypes.PreheatRun, images []string,
+	platform platforms.MatchComparer) *apitypes.PreheatRun {
+	failed := 0
+	for _, image := range images {
+		result := newImagePuller(endpoint, platform).pull(ctx, image)
+		if result.Error != "" {
+			failed++
+			logger.WarnContextf(ctx, "preheat image '%s' failed: %s", image, result.Error)
+		} else {
+			logger.InfoContextf(ctx, "preheat image '%s' success, blobs: %d, size: %d", image, result.Blobs,
+				result.Size)
+		}
+		history.update(run.RunID, func(r *apitypes.PreheatRun) { r.Images = append(r.Images, result) })
+	}
+	final := history.update(run.RunID, func(r *apitypes.PreheatRun) {
+		r.EndTime = time.Now()
+		r.Phase = apitypes.PreheatPhaseSucceeded
+		if failed != 0 {
+			r.Phase = apitypes.PreheatPhaseFailed
+			r.Message = fmt.Sprintf("%d of %d images failed", failed, len(images))
+		}
+	})
+	metrics.PreheatRunsTotal.WithLabelValues(final.Phase).Inc()
+	eventStatus := recorder.Normal
+	if failed != 0 {
+		eventStatus = recorder.Warning
+	}
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypePreheat,
+		EventStatus: eventStatus,
+		Details: map[string]interface{}{
+			"task": run.Task, "runID": run.RunID, "trigger": run.Trigger, "phase": final.Phase,
+			"images": len(images), "failed": failed,
+			"duration_ms": final.EndTime.Sub(final.StartTime).Milliseconds(),
+		},
+		Message: fmt.Sprintf("Preheat task '%s' %s", run.Task, strings.ToLower(final.Phase)),
+	})
+	logger.InfoContextf(ctx, "preheat task finished with phase '%s'", final.Phase)
+	return final
+}
+
+// updateStatus updates the status annotation of ConfigMap with retry on conflict
+func (c *Controller) updateStatus(ctx context.Context, namespace, name string, update func(s *taskStatus)) {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := c.client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		status := parseStatus(cm)
+		update(status)
+		status.Updated = time.Now()
+		bs, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		if cm.Annotations == nil {
+			cm.Annotations = make(map[string]string)
+		}
+		cm.Annotations[StatusAnnotation] = string(bs)
+		_, err = c.client.CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		logger.WarnContextf(ctx, "update status of preheat task '%s/%s' failed: %s", namespace, name,
+			err.Error())
+	}
+}
+
+func parseStatus(cm *corev1.ConfigMap) *taskStatus {
+	status := &taskStatus{}
+	if v := cm.Annotations[StatusAnnotation]; v != "" {
+		_ = json.Unmarshal([]byte(v), status)
+	}
+	return status
+}
+
+func parseSpec(cm *corev1.ConfigMap) (*taskSpec, error) {
+	spec := &taskSpec{}
+	spec.images = strings.FieldsFunc(cm.Data[dataImages], func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(spec.images) == 0 {
+		return nil, errors.Errorf("data '%s' has no image", dataImages)
+	}
+	if expr := strings.TrimSpace(cm.Data[dataSchedule]); expr != "" {
+		schedule, err := cron.ParseStandard(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse schedule '%s' failed", expr)
+		}
+		spec.schedule = schedule
+	}
+	matcher, err := parsePlatforms(cm.Data[dataPlatforms])
+	if err != nil {
+		return nil, err
+	}
+	spec.platforms = matcher
+	h := sha256.New()
+	for _, key := range []string{dataImages, dataSchedule, dataPlatforms} {
+		h.Write([]byte(key + "=" + cm.Data[key] + "\n"))
+	}
+	spec.hash = hex.EncodeToString(h.Sum(nil))[:16]
+	return spec, nil
+}
+
+// parsePlatforms parses the comma separated platforms, returns the platform of node if empty
+func parsePlatforms(v string) (platforms.MatchComparer, error) {
+	if strings.TrimSpace(v) == "" {
+		return platforms.Default(), nil
+	}
+	var ps []ocispec.Platform
+	for _, s := range strings.Split(v, ",") {
+		p, err := platforms.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse platform '%s' failed", s)
+		}
+		ps = append(ps, p)
+	}
+	return platforms.Any(ps...), nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package preheat
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// history keeps the recent runs of preheat tasks on this node
+var history = newRunHistory()
+
+// runHistory keeps the recent runs, the oldest runs are dropped when exceeding the limit
+type runHistory struct {
+	sync.Mutex
+	limit int
+	runs  []*apitypes.PreheatRun
+}
+
+func newRunHistory() *runHistory {
+	return &runHistory{limit: 50}
+}
+
+func copyRun(run *apitypes.PreheatRun) *apitypes.PreheatRun {
+	result := *run
+	result.Images = slices.Clone(run.Images)
+	return &result
+}
+
+func (h *runHistory) setLimit(limit int) {
+	h.Lock()
+	defer h.Unlock()
+	h.limit = limit
+}
+
+func (h *runHistory) add(run *apitypes.PreheatRun) {
+	h.Lock()
+	defer h.Unlock()
+	h.runs = append(h.runs, copyRun(run))
+	if len(h.runs) > h.limit {
+		h.runs = h.runs[len(h.runs)-h.limit:]
+	}
+}
+
+// update updates the run of runID and returns its copy
+func (h *runHistory) update(runID string, update func(run *apitypes.PreheatRun)) *apitypes.PreheatRun {
+	h.Lock()
+	defer h.Unlock()
+	for _, run := range h.runs {
+		if run.RunID == runID {
+			update(run)
+			return copyRun(run)
+		}
+	}
+	// the run is dropped from history already
+	run := &apitypes.PreheatRun{RunID: runID}
+	update(run)
+	return run
+}
+
+// History returns the recent runs of task (namespace/name), all tasks if empty. The latest run is the first.
+func History(task string) []*apitypes.PreheatRun {
+	history.Lock()
+	defer history.Unlock()
+	result := make([]*apitypes.PreheatRun, 0, len(history.runs))
+	for i := len(history.runs) - 1; i >= 0; i-- {
+		if task != "" && history.runs[i].Task != task {
+			continue
+		}
+		result = append(result, copyRun(history.runs[i]))
+	}
+	return result
+}
@@ -0,0 +1,248 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package preheat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/platforms"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
+	"github.com/penglongli/accelerboat/pkg/utils/httputils"
+)
+
+const (
+	// manifestMaxBodySize the max size of manifest read into memory
+	manifestMaxBodySize = 4 * 1024 * 1024
+
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+var manifestAcceptTypes = strings.Join([]string{ocispec.MediaTypeImageIndex, ocispec.MediaTypeImageManifest,
+	mediaTypeDockerManifestList, mediaTypeDockerManifest}, ",")
+
+// imagePuller pulls the image through the registry-mirror endpoint of local proxy, so that the manifests and
+// layers go through the cache pipeline as the pulling of docker/containerd. The service tokens are requested
+// through the proxy too, master retries them with the configured credentials of registry mapping.
+type imagePuller struct {
+	endpoint  string
+	client    *http.Client
+	platforms platforms.MatchComparer
+
+	registry string
+	repo     string
+	token    string
+}
+
+func newImagePuller(endpoint string, platform platforms.MatchComparer) *imagePuller {
+	return &imagePuller{
+		endpoint:  endpoint,
+		client:    &http.Client{},
+		platforms: platform,
+	}
+}
+
+// pull pulls the manifests and blobs of image, the blobs are discarded after cached by proxy
+func (p *imagePuller) pull(ctx context.Context, image string) *apitypes.PreheatImageResult {
+	result := &apitypes.PreheatImageResult{Image: image}
+	if err := p.doPull(ctx, image, result); err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (p *imagePuller) doPull(ctx context.Context, image string, result *apitypes.PreheatImageResult) error {
+	blobs, err := p.resolveImage(ctx, image)
+	if err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		size, err := p.pullBlob(ctx, blob.Digest)
+		if err != nil {
+			return err
+		}
+		result.Blobs++
+		result.Size += size
+	}
+	return nil
+}
+
+// ResolveImage returns the config and layers of the image matched the platform, the manifests are requested
+// through the registry-mirror endpoint of local proxy
+func ResolveImage(ctx context.Context, op *options.AccelerBoatOption, image string,
+	platform platforms.MatchComparer) ([]ocispec.Descriptor, error) {
+	return newImagePuller(localEndpoint(op), platform).resolveImage(ctx, image)
+}
+
+func (p *imagePuller) resolveImage(ctx context.Context, image string) ([]ocispec.Descriptor, error) {
+	named, err := docker.ParseDockerRef(image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse image '%s' failed", image)
+	}
+	p.registry, p.repo, p.token = docker.Domain(named), docker.Path(named), ""
+	reference := "latest"
+	if digested, ok := named.(docker.Digested); ok {
+		reference = digested.Digest().String()
+	} else if tagged, ok := named.(docker.Tagged); ok {
+		reference = tagged.Tag()
+	}
+	return p.resolveBlobs(ctx, reference)
+}
+
+// resolveBlobs returns the config and layers of the manifests matched the platforms
+func (p *imagePuller) resolveBlobs(ctx context.Context, reference string) ([]ocispec.Descriptor, error) {
+	bs, err := p.getManifest(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	index := &ocispec.Index{}
+	if err = json.Unmarshal(bs, index); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal manifest '%s' failed", reference)
+	}
+	if index.MediaType != ocispec.MediaTypeImageIndex && index.MediaType != mediaTypeDockerManifestList {
+		return manifestBlobs(bs, reference)
+	}
+	blobs := make([]ocispec.Descriptor, 0)
+	for _, desc := range index.Manifests {
+		if desc.Platform != nil && !p.platforms.Match(*desc.Platform) {
+			continue
+		}
+		if bs, err = p.getManifest(ctx, desc.Digest.String()); err != nil {
+			return nil, err
+		}
+		child, err := manifestBlobs(bs, desc.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, child...)
+	}
+	if len(blobs) == 0 {
+		return nil, errors.Errorf("no manifest of '%s' matches the platforms", reference)
+	}
+	return blobs, nil
+}
+
+func manifestBlobs(bs []byte, reference string) ([]ocispec.Descriptor, error) {
+	manifest := &ocispec.Manifest{}
+	if err := json.Unmarshal(bs, manifest); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal manifest '%s' failed", reference)
+	}
+	return append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...), nil
+}
+
+func (p *imagePuller) getManifest(ctx context.Context, reference string) ([]byte, error) {
+	resp, err := p.do(ctx, fmt.Sprintf("/v2/%s/manifests/%s", p.repo, reference), manifestAcceptTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bs, err := httputils.ReadBody(resp, manifestMaxBodySize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read manifest '%s' failed", reference)
+	}
+	return bs, nil
+}
+
+func (p *imagePuller) pullBlob(ctx context.Context, dgst digest.Digest) (int64, error) {
+	resp, err := p.do(ctx, fmt.Sprintf("/v2/%s/blobs/%s", p.repo, dgst.String()), "")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	size, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return size, errors.Wrapf(err, "read blob '%s' failed", dgst.String())
+	}
+	return size, nil
+}
+
+// do requests the registry api through proxy, the service token is requested with the challenge of 401
+func (p *imagePuller) do(ctx context.Context, uri, accept string) (*http.Response, error) {
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.mirrorURL(uri, nil), nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create request '%s' failed", uri)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if p.token != "" {
+			req.Header.Set("Authorization", "Bearer "+p.token)
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "request '%s' failed", uri)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || i != 0 {
+			return nil, errors.Errorf("request '%s' responded status '%d'", uri, resp.StatusCode)
+		}
+		if err = p.requestToken(ctx, resp.Header.Get("Www-Authenticate")); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.Errorf("request '%s' unauthorized", uri)
+}
+
+// requestToken requests the service token of challenge through the service token endpoint of proxy
+func (p *imagePuller) requestToken(ctx context.Context, challenge string) error {
+	realm, service, scope := utils.ParseAuthRequest(challenge)
+	if realm == "" {
+		return errors.Errorf("unauthorized without bearer challenge '%s'", challenge)
+	}
+	realmURL, err := url.Parse(realm)
+	if err != nil {
+		return errors.Wrapf(err, "parse realm '%s' failed", realm)
+	}
+	query := realmURL.Query()
+	query.Set("service", service)
+	query.Set("scope", scope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.mirrorURL("/service/token", query), nil)
+	if err != nil {
+		return errors.Wrapf(err, "create token request failed")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "request service token failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("request service token responded status '%d'", resp.StatusCode)
+	}
+	token := &apitypes.RegistryAuthToken{}
+	if err = json.NewDecoder(resp.Body).Decode(token); err != nil {
+		return errors.Wrapf(err, "decode service token failed")
+	}
+	p.token = token.Token
+	if p.token == "" {
+		p.token = token.AccessToken
+	}
+	return nil
+}
+
+// mirrorURL returns the url of registry-mirror endpoint, the registry is passed with 'ns' query
+func (p *imagePuller) mirrorURL(uri string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("ns", p.registry)
+	return p.endpoint + uri + "?" + query.Encode()
+}
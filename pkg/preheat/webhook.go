@@ -0,0 +1,195 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package preheat
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	triggerWebhook = "webhook"
+
+	harborPushArtifact = "PUSH_ARTIFACT"
+	registryActionPush = "push"
+)
+
+// pushedImage defines the image pushed to registry
+type pushedImage struct {
+	registry   string
+	repository string
+	reference  string
+}
+
+// repo returns registry/repository
+func (i *pushedImage) repo() string {
+	return i.registry + "/" + i.repository
+}
+
+// image returns the image with tag or digest
+func (i *pushedImage) image() string {
+	if strings.Contains(i.reference, ":") {
+		return i.repo() + "@" + i.reference
+	}
+	return i.repo() + ":" + i.reference
+}
+
+// registryNotification defines the notification envelope of registry:2
+type registryNotification struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			MediaType  string `json:"mediaType"`
+			Digest     string `json:"digest"`
+			Repository string `json:"repository"`
+			URL        string `json:"url"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// harborNotification defines the webhook payload of Harbor
+type harborNotification struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			Digest      string `json:"digest"`
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+		Repository struct {
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+// VerifySignature verifies the signature (hex HMAC-SHA256 of body, with optional 'sha256=' prefix)
+func VerifySignature(secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// VerifyToken verifies the authorization header is 'Bearer <token>', it is compared in constant time
+func VerifyToken(token, authorization string) bool {
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+token)) == 1
+}
+
+// parseNotification parses the pushed images from the notification of Harbor or registry:2
+func parseNotification(body []byte) ([]*pushedImage, error) {
+	harbor := &harborNotification{}
+	if err := json.Unmarshal(body, harbor); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal notification failed")
+	}
+	if harbor.Type != "" {
+		return parseHarborNotification(harbor), nil
+	}
+	notification := &registryNotification{}
+	if err := json.Unmarshal(body, notification); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal notification failed")
+	}
+	result := make([]*pushedImage, 0)
+	for _, event := range notification.Events {
+		// the pushes of blobs are notified too, only the manifests are preheated
+		if event.Action != registryActionPush || !strings.Contains(event.Target.MediaType, "manifest") {
+			continue
+		}
+		registry := event.Request.Host
+		if u, err := url.Parse(event.Target.URL); err == nil && u.Host != "" {
+			registry = u.Host
+		}
+		reference := event.Target.Tag
+		if reference == "" {
+			reference = event.Target.Digest
+		}
+		if registry == "" || event.Target.Repository == "" || reference == "" {
+			continue
+		}
+		result = append(result, &pushedImage{registry: registry, repository: event.Target.Repository,
+			reference: reference})
+	}
+	return result, nil
+}
+
+func parseHarborNotification(harbor *harborNotification) []*pushedImage {
+	result := make([]*pushedImage, 0)
+	if harbor.Type != harborPushArtifact {
+		return result
+	}
+	for _, resource := range harbor.EventData.Resources {
+		// resource_url is the image with registry, e.g. harbor.example.com/library/nginx:1.25
+		registry, _, ok := strings.Cut(resource.ResourceURL, "/")
+		if !ok {
+			continue
+		}
+		reference := resource.Tag
+		if reference == "" {
+			reference = resource.Digest
+		}
+		if reference == "" || harbor.EventData.Repository.RepoFullName == "" {
+			continue
+		}
+		result = append(result, &pushedImage{registry: registry,
+			repository: harbor.EventData.Repository.RepoFullName, reference: reference})
+	}
+	return result
+}
+
+// HandleNotification preheats the pushed images of notification asynchronously, the images not matched the
+// configured repositories or being preheated are skipped
+func HandleNotification(ctx context.Context, op *options.AccelerBoatOption,
+	body []byte) (*apitypes.PreheatWebhookResponse, error) {
+	cfg := &op.Preheat.Webhook
+	images, err := parseNotification(body)
+	if err != nil {
+		return nil, err
+	}
+	platform, err := parsePlatforms(cfg.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	history.setLimit(op.Preheat.HistoryLimit)
+	resp := &apitypes.PreheatWebhookResponse{Accepted: make([]string, 0), Skipped: make([]string, 0)}
+	for _, pushed := range images {
+		image := pushed.image()
+		if !cfg.MatchRepository(pushed.repo()) || !runningTasks.acquire(image) {
+			resp.Skipped = append(resp.Skipped, image)
+			continue
+		}
+		resp.Accepted = append(resp.Accepted, image)
+		run := newRun(triggerWebhook+"/"+pushed.repo(), path.Base(pushed.repository), triggerWebhook, 1)
+		history.add(run)
+		runCtx := logger.WithContextFields(context.WithoutCancel(ctx), "preheatTask", run.Task, "runID", run.RunID)
+		logger.InfoContextf(runCtx, "preheat pushed image '%s'", image)
+		go func() {
+			defer runningTasks.release(image)
+			pullImages(runCtx, localEndpoint(op), run, []string{image}, platform)
+		}()
+	}
+	return resp, nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package pullsecret imports the entries of kubernetes image pull secrets as the credentials of registry
+// mappings, the secrets are watched to keep the credentials in sync.
+package pullsecret
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	k8swatch "k8s.io/client-go/tools/watch"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	// syncInterval the interval of checking the pull secrets of options
+	syncInterval = 30 * time.Second
+)
+
+// dockerHubAliases the hosts of docker hub in docker config
+var dockerHubAliases = map[string]string{
+	"index.docker.io/v1": "registry-1.docker.io",
+	"index.docker.io":    "registry-1.docker.io",
+	"docker.io":          "registry-1.docker.io",
+}
+
+var (
+	lock sync.RWMutex
+	// auths the credentials of every secret, keyed by secret and registry host
+	auths = make(map[string]map[string][]*options.RegistryAuth)
+)
+
+// Credentials returns the credentials imported from pull secrets for the registry mapping
+func Credentials(mp *options.RegistryMapping) []*options.RegistryAuth {
+	lock.RLock()
+	defer lock.RUnlock()
+	secrets := make([]string, 0, len(auths))
+	for secret := range auths {
+		secrets = append(secrets, secret)
+	}
+	sort.Strings(secrets)
+	result := make([]*options.RegistryAuth, 0)
+	for _, secret := range secrets {
+		result = append(result, auths[secret][mp.OriginalHost]...)
+		if hostname := mp.OriginalHostname(); hostname != mp.OriginalHost {
+			result = append(result, auths[secret][hostname]...)
+		}
+	}
+	return result
+}
+
+// Watch watches the pull secrets of options until ctx done, the secrets added or removed from options are
+// synced periodically
+func Watch(ctx context.Context, client kubernetes.Interface) {
+	watching := make(map[string]context.CancelFunc)
+	defer func() {
+		for _, cancel := range watching {
+			cancel()
+		}
+	}()
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	for {
+		desired := make(map[string]struct{})
+		for _, secret := range options.GlobalOptions().ExternalConfig.PullSecrets {
+			desired[secret] = struct{}{}
+		}
+		for secret, cancel := range watching {
+			if _, ok := desired[secret]; ok {
+				continue
+			}
+			cancel()
+			delete(watching, secret)
+			setAuths(secret, nil)
+			logger.Infof("pull secret '%s' removed from options", secret)
+		}
+		for secret := range desired {
+			if _, ok := watching[secret]; ok {
+				continue
+			}
+			namespace, name, ok := strings.Cut(secret, "/")
+			if !ok {
+				namespace, name = options.GlobalOptions().ServiceDiscovery.ServiceNamespace, secret
+			}
+			secretCtx, cancel := context.WithCancel(ctx)
+			watching[secret] = cancel
+			go watchSecret(secretCtx, client, secret, namespace, name)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func watchSecret(ctx context.Context, client kubernetes.Interface, key, namespace, name string) {
+	logger.Infof("watching pull secret '%s/%s'", namespace, name)
+	defer logger.Infof("pull secret '%s/%s' watcher stopped", namespace, name)
+	for {
+		if err := handleWatchSecret(ctx, client, key, namespace, name); err != nil {
+			logger.Errorf("watch pull secret '%s/%s' failed: %s", namespace, name, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func handleWatchSecret(ctx context.Context, client kubernetes.Interface, key, namespace, name string) error {
+	fieldSelector := fmt.Sprintf("metadata.name=%s", name)
+	secretList, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fieldSelector,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "list secret failed")
+	}
+	if len(secretList.Items) == 0 {
+		logger.Warnf("pull secret '%s/%s' not found", namespace, name)
+		setAuths(key, nil)
+	}
+	for i := range secretList.Items {
+		importSecret(key, &secretList.Items[i])
+	}
+	watcher, err := k8swatch.NewRetryWatcherWithContext(ctx, secretList.ResourceVersion, &cache.ListWatch{
+		WatchFuncWithContext: func(ctx context.Context, _ metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().Secrets(namespace).Watch(ctx, metav1.ListOptions{
+				FieldSelector: fieldSelector,
+			})
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "create watcher failed")
+	}
+	defer watcher.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-watcher.Done():
+			return errors.Errorf("watcher closed unexpectedly")
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return errors.Errorf("watch channel interrupted")
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if secret, ok := event.Object.(*corev1.Secret); ok {
+					importSecret(key, secret)
+				}
+			case watch.Deleted:
+				logger.Warnf("pull secret '%s/%s' deleted", namespace, name)
+				setAuths(key, nil)
+			case watch.Error:
+				return errors.Errorf("watch error: %v", k8serrors.FromObject(event.Object))
+			}
+		}
+	}
+}
+
+// dockerConfig defines the docker config of pull secret
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+func importSecret(key string, secret *corev1.Secret) {
+	result, err := parseSecret(secret)
+	if err != nil {
+		logger.Errorf("parse pull secret '%s/%s' failed: %s", secret.Namespace, secret.Name, err.Error())
+		return
+	}
+	setAuths(key, result)
+	hosts := make([]string, 0, len(result))
+	for host := range result {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	logger.Infof("imported pull secret '%s/%s' for registries: %s", secret.Namespace, secret.Name,
+		strings.Join(hosts, ", "))
+}
+
+func parseSecret(secret *corev1.Secret) (map[string][]*options.RegistryAuth, error) {
+	cfg := &dockerConfig{}
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], cfg); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal '%s' failed", corev1.DockerConfigJsonKey)
+		}
+	case corev1.SecretTypeDockercfg:
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &cfg.Auths); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal '%s' failed", corev1.DockerConfigKey)
+		}
+	default:
+		return nil, errors.Errorf("secret type '%s' not supported", secret.Type)
+	}
+	result := make(map[string][]*options.RegistryAuth)
+	for server, auth := range cfg.Auths {
+		username, password := auth.Username, auth.Password
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, errors.Wrapf(err, "decode auth of '%s' failed", server)
+			}
+			username, password, _ = strings.Cut(string(decoded), ":")
+		}
+		if username == "" || password == "" {
+			continue
+		}
+		host := normalizeHost(server)
+		result[host] = append(result[host], &options.RegistryAuth{Username: username, Password: password})
+	}
+	return result, nil
+}
+
+// normalizeHost returns the registry host of docker config server, e.g. https://index.docker.io/v1/
+func normalizeHost(server string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	host = strings.TrimSuffix(host, "/")
+	if alias, ok := dockerHubAliases[host]; ok {
+		return alias
+	}
+	return host
+}
+
+func setAuths(key string, result map[string][]*options.RegistryAuth) {
+	lock.Lock()
+	defer lock.Unlock()
+	if result == nil {
+		delete(auths, key)
+		return
+	}
+	auths[key] = result
+}
@@ -24,6 +24,7 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/podidentity"
 	"github.com/penglongli/accelerboat/pkg/server/common"
 	"github.com/penglongli/accelerboat/pkg/utils"
 )
@@ -58,6 +59,19 @@ const (
 	EventTypeCheckOCI              EventType = "check_oci_layer"
 	EventTypeReverseProxy          EventType = "reverse_proxy"
 	EventTypeTransferLayer         EventType = "transfer_layer_tcp"
+	EventTypeVerifySignature       EventType = "verify_signature"
+	EventTypePanic                 EventType = "panic"
+	EventTypeLayerEvicted          EventType = "layer_evicted"
+	EventTypeTorrentAdded          EventType = "torrent_added"
+	EventTypeTorrentDropped        EventType = "torrent_dropped"
+	EventTypeCacheReconciled       EventType = "cache_reconciled"
+	EventTypeHostViolation         EventType = "host_violation"
+	EventTypeFallback              EventType = "fallback"
+	EventTypePreheat               EventType = "preheat"
+	EventTypeLayerQuarantined      EventType = "layer_quarantined"
+	EventTypeConfigReloaded        EventType = "config_reloaded"
+	EventTypeTransferAborted       EventType = "transfer_aborted"
+	EventTypeShadowDiverged        EventType = "shadow_diverged"
 )
 
 type EventStatus string
@@ -89,6 +103,7 @@ type Recorder struct {
 	next       int
 	count      int
 	fileCh     chan Event // nil when file disabled; buffered for async write
+	fileConfCh chan FileConfig
 	fileWg     sync.WaitGroup
 	fileClosed atomic.Bool
 
@@ -98,6 +113,8 @@ type Recorder struct {
 	eventFileMu         sync.RWMutex
 	eventFilePath       string // set when InitEventFile is called; used by List() to read from file
 	eventFileMaxBackups int    // number of rotated backups to consider when reading
+
+	usage *usageIndex // digest -> last used, compacted into a snapshot beside the event file
 }
 
 // Global returns the global recorder instance (singleton).
@@ -111,56 +128,129 @@ func New(size int) *Recorder {
 	return &Recorder{
 		events: make([]Event, size),
 		size:   size,
+		usage:  newUsageIndex(),
+	}
+}
+
+// Resize changes the size of ring buffer, the most recent events are kept
+func (r *Recorder) Resize(size int) {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size == r.size {
+		return
+	}
+	n := r.count
+	if n > size {
+		n = size
+	}
+	events := make([]Event, size)
+	start := (r.next - n + r.size) % r.size
+	for i := 0; i < n; i++ {
+		events[i] = r.events[(start+i)%r.size]
+	}
+	r.events = events
+	r.size = size
+	r.count = n
+	r.next = n % size
+}
+
+// FileConfig defines the rotation of event file. MaxSizeMB is the max size in megabytes before rotation
+// (e.g. 1024 for 1GB), MaxBackups is the number of rotated files to keep (e.g. 5) and MaxAgeDays is the days
+// to keep the rotated files, 0 means the rotated files are not pruned by age.
+type FileConfig struct {
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+func (fc FileConfig) withDefaults() FileConfig {
+	if fc.MaxSizeMB <= 0 {
+		fc.MaxSizeMB = DefaultEventFileMaxSizeMB
+	}
+	if fc.MaxBackups <= 0 {
+		fc.MaxBackups = DefaultEventFileMaxBackups
+	}
+	if fc.MaxAgeDays < 0 {
+		fc.MaxAgeDays = 0
 	}
+	return fc
 }
 
 // InitEventFile enables async writing of events to a rotating file at eventFile.
-// maxSizeMB is the max size in megabytes before rotation (e.g. 1024 for 1GB);
-// maxBackups is the number of rotated files to keep (e.g. 5).
 // If eventFile is empty, file writing is disabled. Directory is created if needed.
 // Record() never blocks on disk I/O; when the write buffer is full, file writes are dropped (in-memory ring buffer is still updated).
-func (r *Recorder) InitEventFile(eventFile string, maxSizeMB, maxBackups int) error {
+func (r *Recorder) InitEventFile(eventFile string, fc FileConfig) error {
 	if eventFile == "" {
 		return nil
 	}
-	if maxSizeMB <= 0 {
-		maxSizeMB = DefaultEventFileMaxSizeMB
-	}
-	if maxBackups <= 0 {
-		maxBackups = DefaultEventFileMaxBackups
-	}
+	fc = fc.withDefaults()
 	dir := filepath.Dir(eventFile)
 	if err := os.MkdirAll(dir, 0750); err != nil {
 		return err
 	}
-	lj := &lumberjack.Logger{
-		Filename:   eventFile,
-		MaxSize:    maxSizeMB,
-		MaxBackups: maxBackups,
-		Compress:   false,
-	}
-	bw := bufio.NewWriterSize(lj, 64*1024)
 	ch := make(chan Event, eventFileChanCap)
 	r.fileCh = ch
+	r.fileConfCh = make(chan FileConfig, 1)
 	r.eventFileMu.Lock()
 	r.eventFilePath = eventFile
-	r.eventFileMaxBackups = maxBackups
+	r.eventFileMaxBackups = fc.MaxBackups
 	r.eventFileMu.Unlock()
-	r.fileWg.Add(1)
-	go r.runFileWriter(bw, ch)
+	r.usage.done = make(chan struct{})
+	r.fileWg.Add(2)
+	go r.runFileWriter(eventFile, fc, ch, r.fileConfCh)
+	go r.runUsageCompactor(eventFile, fc.MaxBackups, r.usage.done)
 	return nil
 }
 
-// runFileWriter reads events from ch, marshals to JSON lines, and writes to w. Flushes periodically.
-func (r *Recorder) runFileWriter(w *bufio.Writer, ch <-chan Event) {
+// ApplyFileConfig changes the rotation of event file, the file is reopened by the writer with the config.
+// It has no effect if the event file is not enabled.
+func (r *Recorder) ApplyFileConfig(fc FileConfig) {
+	ch := r.fileConfCh
+	if ch == nil || r.fileClosed.Load() {
+		return
+	}
+	fc = fc.withDefaults()
+	r.eventFileMu.Lock()
+	r.eventFileMaxBackups = fc.MaxBackups
+	r.eventFileMu.Unlock()
+	// only the latest config is applied
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- fc
+}
+
+func newEventFileLogger(eventFile string, fc FileConfig) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   eventFile,
+		MaxSize:    fc.MaxSizeMB,
+		MaxBackups: fc.MaxBackups,
+		MaxAge:     fc.MaxAgeDays,
+		Compress:   false,
+	}
+}
+
+// runFileWriter reads events from ch, marshals to JSON lines, and writes to the event file. Flushes
+// periodically. The file is reopened with the config received from confCh, the lumberjack logger is
+// replaced instead of modified because its fields are read by its own goroutine.
+func (r *Recorder) runFileWriter(eventFile string, fc FileConfig, ch <-chan Event, confCh <-chan FileConfig) {
 	defer r.fileWg.Done()
+	lj := newEventFileLogger(eventFile, fc)
+	w := bufio.NewWriterSize(lj, 64*1024)
+	defer func() {
+		_ = w.Flush()
+		_ = lj.Close()
+	}()
 	tick := time.NewTicker(eventFileFlushInterval)
 	defer tick.Stop()
 	for {
 		select {
 		case ev, ok := <-ch:
 			if !ok {
-				_ = w.Flush()
 				return
 			}
 			raw, err := json.Marshal(ev)
@@ -169,6 +259,11 @@ func (r *Recorder) runFileWriter(w *bufio.Writer, ch <-chan Event) {
 			}
 			_, _ = w.Write(raw)
 			_, _ = w.Write([]byte{'\n'})
+		case fc = <-confCh:
+			_ = w.Flush()
+			_ = lj.Close()
+			lj = newEventFileLogger(eventFile, fc)
+			w.Reset(lj)
 		case <-tick.C:
 			_ = w.Flush()
 		}
@@ -187,6 +282,7 @@ func (r *Recorder) CloseEventFile() {
 	}
 	r.fileCh = nil // ensure new Record() see nil and skip
 	close(ch)
+	close(r.usage.done)
 	r.fileWg.Wait()
 }
 
@@ -219,6 +315,16 @@ func (r *Recorder) Record(ctx context.Context, ev Event) {
 		ev.Timestamp = time.Now()
 	}
 	ev.RequestID = logger.GetContextField(ctx, common.RequestIDHeaderKey)
+	if namespace, pod := podidentity.FromContext(ctx); pod != "" {
+		// the details of caller are not modified
+		details := make(map[string]interface{}, len(ev.Details)+2)
+		for k, v := range ev.Details {
+			details[k] = v
+		}
+		details["namespace"] = namespace
+		details["pod"] = pod
+		ev.Details = details
+	}
 	r.mu.Lock()
 	r.events[r.next] = ev
 	r.next = (r.next + 1) % r.size
@@ -226,6 +332,7 @@ func (r *Recorder) Record(ctx context.Context, ev Event) {
 		r.count++
 	}
 	r.mu.Unlock()
+	r.usage.observe(&ev)
 
 	ch := r.fileCh
 	if ch != nil && !r.fileClosed.Load() {
@@ -0,0 +1,232 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package recorder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	// usageSnapshotSuffix is appended to the event file as the path of usage snapshot
+	usageSnapshotSuffix = ".usage.json"
+	// usageCompactInterval is how often the usage index is compacted into the snapshot
+	usageCompactInterval = 5 * time.Minute
+	// usageMaxAge the digests not used within are removed from the index when compacting
+	usageMaxAge = 180 * 24 * time.Hour
+	// usageReplayLimit is the max events to replay from the event file when the snapshot is behind
+	usageReplayLimit = 500000
+)
+
+// usageEventTypes are the events of serving or downloading blobs, the digest in Details is used
+var usageEventTypes = map[EventType]struct{}{
+	EventServeBlobFromLocal:        {},
+	EventTypeGetBlobFromMaster:     {},
+	EventTypeDownloadBlobByTCP:     {},
+	EventTypeDownloadBlobByTorrent: {},
+}
+
+// LayerUsage is the last time the layer digest was used
+type LayerUsage struct {
+	Digest   string    `json:"digest"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// usageSnapshot is the content of snapshot file, CompactedAt tells the events after it need replay
+type usageSnapshot struct {
+	CompactedAt time.Time            `json:"compactedAt"`
+	Layers      map[string]time.Time `json:"layers"`
+}
+
+// usageIndex maintains digest -> last used from the recorded events incrementally, so the readers (e.g.
+// cleaner) need not scan the event file
+type usageIndex struct {
+	mu          sync.RWMutex
+	lastUsed    map[string]time.Time
+	compactedAt time.Time
+	done        chan struct{}
+}
+
+func newUsageIndex() *usageIndex {
+	return &usageIndex{lastUsed: make(map[string]time.Time)}
+}
+
+func (u *usageIndex) observe(ev *Event) {
+	if _, ok := usageEventTypes[ev.Type]; !ok {
+		return
+	}
+	digest := digestFromDetails(ev.Details)
+	if digest == "" {
+		return
+	}
+	u.mu.Lock()
+	if ev.Timestamp.After(u.lastUsed[digest]) {
+		u.lastUsed[digest] = ev.Timestamp
+	}
+	u.mu.Unlock()
+}
+
+func digestFromDetails(details map[string]interface{}) string {
+	if details == nil {
+		return ""
+	}
+	s, _ := details["digest"].(string)
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	if strings.HasPrefix(s, "sha256:") {
+		return s
+	}
+	return "sha256:" + s
+}
+
+// LayerUsage returns digest -> last used of the layers used since the time, all layers in the index are
+// returned if since is nil
+func (r *Recorder) LayerUsage(since *time.Time) map[string]time.Time {
+	r.usage.mu.RLock()
+	defer r.usage.mu.RUnlock()
+	out := make(map[string]time.Time, len(r.usage.lastUsed))
+	for digest, t := range r.usage.lastUsed {
+		if since != nil && t.Before(*since) {
+			continue
+		}
+		out[digest] = t
+	}
+	return out
+}
+
+// LayerUsageList returns the layers used since the time, the last used first. The time of the last
+// compaction into snapshot is also returned, it is zero if the event file is not enabled.
+func (r *Recorder) LayerUsageList(since *time.Time) ([]*LayerUsage, time.Time) {
+	m := r.LayerUsage(since)
+	result := make([]*LayerUsage, 0, len(m))
+	for digest, t := range m {
+		result = append(result, &LayerUsage{Digest: digest, LastUsed: t})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastUsed.After(result[j].LastUsed)
+	})
+	r.usage.mu.RLock()
+	compactedAt := r.usage.compactedAt
+	r.usage.mu.RUnlock()
+	return result, compactedAt
+}
+
+// runUsageCompactor loads the usage snapshot and replays the events after it, then compacts the index
+// into the snapshot periodically and when the event file closed.
+func (r *Recorder) runUsageCompactor(eventFile string, maxBackups int, done <-chan struct{}) {
+	defer r.fileWg.Done()
+	snapshotPath := eventFile + usageSnapshotSuffix
+	var since *time.Time
+	snapshot, err := loadUsageSnapshot(snapshotPath)
+	if err != nil {
+		logger.Warnf("load layer usage snapshot failed, rebuild from event file: %s", err.Error())
+	}
+	if snapshot != nil {
+		since = &snapshot.CompactedAt
+		r.usage.mu.Lock()
+		for digest, t := range snapshot.Layers {
+			if t.After(r.usage.lastUsed[digest]) {
+				r.usage.lastUsed[digest] = t
+			}
+		}
+		r.usage.compactedAt = snapshot.CompactedAt
+		r.usage.mu.Unlock()
+	}
+	query := make([]string, 0, len(usageEventTypes))
+	for t := range usageEventTypes {
+		query = append(query, string(t))
+	}
+	events := r.listFromFile(eventFile, maxBackups, usageReplayLimit, query, since)
+	for i := range events {
+		r.usage.observe(&events[i])
+	}
+	logger.Infof("layer usage index loaded, replayed %d events", len(events))
+	r.compactUsage(snapshotPath)
+
+	tick := time.NewTicker(usageCompactInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			r.compactUsage(snapshotPath)
+			return
+		case <-tick.C:
+			r.compactUsage(snapshotPath)
+		}
+	}
+}
+
+// compactUsage removes the digests not used within usageMaxAge, and writes the index into snapshot
+func (r *Recorder) compactUsage(snapshotPath string) {
+	now := time.Now()
+	expired := now.Add(-usageMaxAge)
+	r.usage.mu.Lock()
+	snapshot := &usageSnapshot{CompactedAt: now, Layers: make(map[string]time.Time, len(r.usage.lastUsed))}
+	for digest, t := range r.usage.lastUsed {
+		if t.Before(expired) {
+			delete(r.usage.lastUsed, digest)
+			continue
+		}
+		snapshot.Layers[digest] = t
+	}
+	r.usage.mu.Unlock()
+	if err := saveUsageSnapshot(snapshotPath, snapshot); err != nil {
+		logger.Warnf("save layer usage snapshot failed: %s", err.Error())
+		return
+	}
+	r.usage.mu.Lock()
+	r.usage.compactedAt = now
+	r.usage.mu.Unlock()
+}
+
+func loadUsageSnapshot(path string) (*usageSnapshot, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "read file '%s' failed", path)
+	}
+	snapshot := new(usageSnapshot)
+	if err = json.Unmarshal(bs, snapshot); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal file '%s' failed", path)
+	}
+	return snapshot, nil
+}
+
+// saveUsageSnapshot writes the snapshot to a temp file and renames it, the snapshot is never partial
+func saveUsageSnapshot(path string, snapshot *usageSnapshot) error {
+	bs, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrapf(err, "marshal usage snapshot failed")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return errors.Wrapf(err, "create temp file failed")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(bs); err != nil {
+		_ = tmp.Close()
+		return errors.Wrapf(err, "write temp file '%s' failed", tmp.Name())
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrapf(err, "close temp file '%s' failed", tmp.Name())
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrapf(err, "rename '%s' to '%s' failed", tmp.Name(), path)
+	}
+	return nil
+}
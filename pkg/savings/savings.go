@@ -0,0 +1,104 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package savings accounts the blob bytes downloaded from original registries and served to clients per
+// registry per day. The bytes are accumulated in memory and flushed into cache store every minute, so the
+// report of all nodes is aggregated from cache store.
+package savings
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/store"
+)
+
+const (
+	flushInterval = time.Minute
+	flushTimeout  = 10 * time.Second
+	// DayLayout the layout of the days(UTC) of traffic
+	DayLayout = "2006-01-02"
+)
+
+// Global the accumulator of the traffic of this node
+var Global = &Accumulator{days: make(map[string]map[string]*apitypes.DailyTraffic)}
+
+// Accumulator accumulates the traffic bytes by day and registry until flushed
+type Accumulator struct {
+	sync.Mutex
+	days map[string]map[string]*apitypes.DailyTraffic
+}
+
+// AddOrigin adds the bytes downloaded from original registry
+func (a *Accumulator) AddOrigin(registry string, n int64) {
+	a.add(time.Now().UTC().Format(DayLayout), registry, n, 0)
+}
+
+// AddServed adds the bytes served to clients
+func (a *Accumulator) AddServed(registry string, n int64) {
+	a.add(time.Now().UTC().Format(DayLayout), registry, 0, n)
+}
+
+func (a *Accumulator) add(day, registry string, origin, served int64) {
+	if registry == "" || (origin <= 0 && served <= 0) || !options.GlobalOptions().Savings.Enable {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	registries, ok := a.days[day]
+	if !ok {
+		registries = make(map[string]*apitypes.DailyTraffic)
+		a.days[day] = registries
+	}
+	t, ok := registries[registry]
+	if !ok {
+		t = &apitypes.DailyTraffic{Date: day, Registry: registry}
+		registries[registry] = t
+	}
+	t.OriginBytes += max(origin, 0)
+	t.ServedBytes += max(served, 0)
+}
+
+// Run flushes the accumulated traffic into cache store every minute until ctx done
+func (a *Accumulator) Run(ctx context.Context, cacheStore store.CacheStore) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			a.flush(flushCtx, cacheStore)
+			cancel()
+			return
+		case <-ticker.C:
+			a.flush(ctx, cacheStore)
+		}
+	}
+}
+
+// flush writes the accumulated traffic into cache store, the traffic failed to write is kept for the next
+// flushing
+func (a *Accumulator) flush(ctx context.Context, cacheStore store.CacheStore) {
+	a.Lock()
+	days := a.days
+	a.days = make(map[string]map[string]*apitypes.DailyTraffic)
+	a.Unlock()
+	retention := time.Duration(options.GlobalOptions().Savings.Retention) * 24 * time.Hour
+	for day, registries := range days {
+		traffic := make([]*apitypes.DailyTraffic, 0, len(registries))
+		for _, t := range registries {
+			traffic = append(traffic, t)
+		}
+		if err := cacheStore.AddTrafficBytes(ctx, day, traffic, retention); err != nil {
+			logger.WarnContextf(ctx, "flush traffic of '%s' failed: %s", day, err.Error())
+			for _, t := range traffic {
+				a.add(day, t.Registry, t.OriginBytes, t.ServedBytes)
+			}
+		}
+	}
+}
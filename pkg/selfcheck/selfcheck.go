@@ -0,0 +1,235 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package selfcheck validates the runtime environment at startup, the problems are reported before the
+// server serves the first request.
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+)
+
+// Category defines the category of check item
+type Category string
+
+const (
+	CategoryStorage    Category = "storage"
+	CategoryPort       Category = "port"
+	CategoryRedis      Category = "redis"
+	CategoryContainerd Category = "containerd"
+	CategoryAnnounce   Category = "announce"
+	CategoryRunAs      Category = "runas"
+)
+
+// exitCodes the process exit code of every category when the check failed. The redis is only warned so it
+// has no exit code, 12 is kept unused to not change the codes of others.
+var exitCodes = map[Category]int{
+	CategoryStorage:    10,
+	CategoryPort:       11,
+	CategoryContainerd: 13,
+	CategoryAnnounce:   14,
+	CategoryRunAs:      15,
+}
+
+const checkTimeout = 5 * time.Second
+
+// Result defines the result of one check item
+type Result struct {
+	Category   Category `json:"category"`
+	Name       string   `json:"name"`
+	Passed     bool     `json:"passed"`
+	Message    string   `json:"message,omitempty"`
+	DurationMs int64    `json:"durationMs"`
+	// Warning the check item failed is tolerated, it does not fail the report
+	Warning bool `json:"warning,omitempty"`
+}
+
+// Report defines the report of startup self-check
+type Report struct {
+	Passed  bool      `json:"passed"`
+	Results []*Result `json:"results"`
+}
+
+// ExitCode returns the exit code of the first failed category, returns 0 if all passed
+func (r *Report) ExitCode() int {
+	for _, result := range r.Results {
+		if !result.Passed && !result.Warning {
+			return exitCodes[result.Category]
+		}
+	}
+	return 0
+}
+
+func (r *Report) check(category Category, name string, f func() error) {
+	r.Results = append(r.Results, runCheck(category, name, f))
+	if !r.Results[len(r.Results)-1].Passed {
+		r.Passed = false
+	}
+}
+
+// warn runs the check item whose failure is tolerated, it is reported as warning
+func (r *Report) warn(category Category, name string, f func() error) {
+	result := runCheck(category, name, f)
+	result.Warning = !result.Passed
+	r.Results = append(r.Results, result)
+}
+
+func runCheck(category Category, name string, f func() error) *Result {
+	start := time.Now()
+	result := &Result{Category: category, Name: name, Passed: true}
+	if err := f(); err != nil {
+		result.Passed = false
+		result.Message = err.Error()
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result
+}
+
+// Run runs all the check items with the options
+func Run(ctx context.Context, op *options.AccelerBoatOption) *Report {
+	report := &Report{Passed: true, Results: make([]*Result, 0)}
+	report.check(CategoryRunAs, fmt.Sprintf("uid:%d,gid:%d", os.Geteuid(), os.Getegid()), func() error {
+		return checkRunAs(&op.RunAs)
+	})
+	storagePaths := []string{
+		op.LogConfig.LogDir,
+		op.StorageConfig.DownloadPath,
+		op.StorageConfig.TorrentPath,
+		op.StorageConfig.TransferPath,
+		op.StorageConfig.SmallFilePath,
+		op.StorageConfig.OCIPath,
+	}
+	for _, p := range storagePaths {
+		report.check(CategoryStorage, p, func() error { return checkStoragePath(p) })
+	}
+	ports := []int64{op.HTTPPort, op.HTTPSPort, op.TorrentPort}
+	if op.PeerTLS.Enable {
+		ports = append(ports, op.PeerTLS.Port)
+	}
+	for _, port := range ports {
+		report.check(CategoryPort, fmt.Sprintf("tcp:%d", port), func() error { return checkBindable(port) })
+	}
+	// the layer writes are queued by write-behind while redis unavailable, the node keeps serving with
+	// the layers of itself
+	report.warn(CategoryRedis, op.RedisAddress, func() error {
+		return checkRedis(ctx, op.RedisAddress, op.RedisPassword)
+	})
+	if op.EnableContainerd {
+		report.check(CategoryContainerd, op.ContainerdConfig.Socket, func() error {
+			return checkSocket(op.ContainerdConfig.Socket)
+		})
+	}
+	if op.TorrentConfig.Enable {
+		report.check(CategoryAnnounce, op.TorrentConfig.Announce, func() error {
+			return checkAnnounce(ctx, op.TorrentConfig.Announce)
+		})
+	}
+	return report
+}
+
+// checkRunAs checks the effective user and group of process with the expected ones
+func checkRunAs(runAs *options.RunAsConfig) error {
+	uid, gid := os.Geteuid(), os.Getegid()
+	if runAs.NonRoot && uid == 0 {
+		return errors.Errorf("process runs as root, but nonRoot is required")
+	}
+	if runAs.UID != 0 && uid != runAs.UID {
+		return errors.Errorf("process runs as uid %d, but uid %d is expected", uid, runAs.UID)
+	}
+	if runAs.GID != 0 && gid != runAs.GID {
+		return errors.Errorf("process runs as gid %d, but gid %d is expected", gid, runAs.GID)
+	}
+	return nil
+}
+
+// checkStoragePath checks the effective user can list, read and write the files under dir
+func checkStoragePath(dir string) error {
+	if err := unix.Faccessat(unix.AT_FDCWD, dir, unix.R_OK|unix.W_OK|unix.X_OK, unix.AT_EACCESS); err != nil {
+		fi, statErr := os.Stat(dir)
+		if statErr != nil {
+			return errors.Wrapf(statErr, "stat path '%s' failed", dir)
+		}
+		return errors.Wrapf(err, "path '%s' (mode %s) not accessible for uid %d", dir, fi.Mode().Perm(),
+			os.Geteuid())
+	}
+	return checkWritable(dir)
+}
+
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".selfcheck-*")
+	if err != nil {
+		return errors.Wrapf(err, "path '%s' not writable", dir)
+	}
+	name := f.Name()
+	_ = f.Close()
+	if err = os.Remove(name); err != nil {
+		return errors.Wrapf(err, "remove temp file '%s' failed", name)
+	}
+	return nil
+}
+
+func checkBindable(port int64) error {
+	l, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		return errors.Wrapf(err, "port '%d' not bindable", port)
+	}
+	return l.Close()
+}
+
+func checkRedis(ctx context.Context, address, password string) error {
+	client := redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: password,
+	})
+	defer client.Close()
+	timeoutCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	if err := client.Ping(timeoutCtx).Err(); err != nil {
+		return errors.Wrapf(err, "ping redis '%s' failed", address)
+	}
+	return nil
+}
+
+func checkSocket(socket string) error {
+	fi, err := os.Stat(socket)
+	if err != nil {
+		return errors.Wrapf(err, "stat socket '%s' failed", socket)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("'%s' is not socket", socket)
+	}
+	// connecting the socket requires the write permission
+	if err = unix.Faccessat(unix.AT_FDCWD, socket, unix.R_OK|unix.W_OK, unix.AT_EACCESS); err != nil {
+		return errors.Wrapf(err, "socket '%s' (mode %s) not accessible for uid %d", socket, fi.Mode().Perm(),
+			os.Geteuid())
+	}
+	return nil
+}
+
+func checkAnnounce(ctx context.Context, announce string) error {
+	u, err := url.Parse(announce)
+	if err != nil {
+		return errors.Wrapf(err, "parse announce '%s' failed", announce)
+	}
+	if u.Hostname() == "" {
+		return errors.Errorf("announce '%s' not have host", announce)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	if _, err = net.DefaultResolver.LookupHost(timeoutCtx, u.Hostname()); err != nil {
+		return errors.Wrapf(err, "resolve announce host '%s' failed", u.Hostname())
+	}
+	return nil
+}
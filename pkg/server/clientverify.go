@@ -0,0 +1,91 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+)
+
+// initClientVerify sets the client certs verification of HTTPS server. The client certs are verified if
+// given, and required at handshake only when the verify mode is 'require' and the server name is not the
+// proxy host of exempted registry mapping.
+func (s *AccelerboatServer) initClientVerify(tlsConfig *tls.Config) {
+	cq := s.op().ClientQuota
+	cv := s.op().ClientVerify
+	quotaByCert := cq.Enable && cq.IdentifyBy == options.ClientIdentifyCert
+	if !quotaByCert && !cv.Enable {
+		return
+	}
+	clientCAs := x509.NewCertPool()
+	if quotaByCert {
+		clientCAs.AppendCertsFromPEM([]byte(cq.ClientCA))
+	}
+	if cv.Enable {
+		clientCAs.AppendCertsFromPEM([]byte(cv.ClientCA))
+		s.clientVerifyCAs = x509.NewCertPool()
+		s.clientVerifyCAs.AppendCertsFromPEM([]byte(cv.ClientCA))
+	}
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if !cv.Enable || cv.Mode != options.ClientVerifyRequire {
+		return
+	}
+	requireConfig := tlsConfig.Clone()
+	requireConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if mp := options.GlobalOptions().FilterRegistryMapping(hello.ServerName, options.DomainProxy); mp != nil &&
+			mp.SkipClientVerify {
+			return nil, nil
+		}
+		return requireConfig, nil
+	}
+}
+
+// verifyClient checks the client cert of HTTPS request is issued by the client verify CA, the pool of
+// handshake also contains the CA of client quota so the chain is verified again here. The plain HTTP
+// requests are only accepted from loopback, and the requests of exempted registry mappings are not checked.
+func (s *AccelerboatServer) verifyClient(req *http.Request, proxyHost string, proxyType options.ProxyType) error {
+	cv := s.op().ClientVerify
+	if !cv.Enable {
+		return nil
+	}
+	if mp := options.GlobalOptions().FilterRegistryMapping(proxyHost, proxyType); mp != nil && mp.SkipClientVerify {
+		return nil
+	}
+	if req.TLS == nil {
+		if ip := net.ParseIP(remoteIP(req)); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+		return errors.Errorf("plain http request from '%s' is not allowed for proxy host '%s'",
+			remoteIP(req), proxyHost)
+	}
+	if len(req.TLS.PeerCertificates) == 0 || s.clientVerifyCAs == nil {
+		return errors.Errorf("client cert is required for proxy host '%s'", proxyHost)
+	}
+	cert := req.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         s.clientVerifyCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errors.Wrapf(err, "client cert '%s' is not issued by client verify ca", cert.Subject.CommonName)
+	}
+	cn := cert.Subject.CommonName
+	if !cv.IsCNAllowed(cn) {
+		return errors.Errorf("client cert '%s' is not allowed", cn)
+	}
+	return nil
+}
@@ -5,5 +5,6 @@
 package common
 
 const (
-	RequestIDHeaderKey = "X-Request-ID"
+	RequestIDHeaderKey   = "X-Request-ID"
+	TraceparentHeaderKey = "traceparent"
 )
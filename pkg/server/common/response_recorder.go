@@ -5,6 +5,7 @@
 package common
 
 import (
+	"io"
 	"net/http"
 )
 
@@ -12,6 +13,7 @@ import (
 type ResponseRecorder struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
 }
 
 // NewResponseRecorder returns a new ResponseRecorder.
@@ -24,6 +26,29 @@ func (r *ResponseRecorder) Status() int {
 	return r.status
 }
 
+// Bytes returns the size of response body written
+func (r *ResponseRecorder) Bytes() int64 {
+	return r.bytes
+}
+
+func (r *ResponseRecorder) Write(bs []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(bs)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom delegates to the ReadFrom of underlying writer if supported, the net/http copies the file to
+// the plain tcp connection with sendfile
+func (r *ResponseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rf, ok := r.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(struct{ io.Writer }{r}, src)
+	}
+	n, err := rf.ReadFrom(src)
+	r.bytes += n
+	return n, err
+}
+
 func (r *ResponseRecorder) WriteHeader(code int) {
 	r.status = code
 	r.ResponseWriter.WriteHeader(code)
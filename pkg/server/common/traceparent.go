@@ -0,0 +1,83 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	traceparentVersion = "00"
+	// traceFlagSampled all the generated traces are sampled
+	traceFlagSampled = "01"
+	zeroTraceID      = "00000000000000000000000000000000"
+	zeroParentID     = "0000000000000000"
+	// maxRequestIDLength the max length of the request id passed by client
+	maxRequestIDLength = 128
+)
+
+func randomHex(n int) string {
+	bs := make([]byte, n)
+	_, _ = rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
+
+// NewTraceID generates the W3C trace-id (32 lowercase hex), it is used as the request id
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+// IsTraceID returns whether the id is a valid W3C trace-id
+func IsTraceID(id string) bool {
+	return len(id) == 32 && isLowerHex(id) && id != zeroTraceID
+}
+
+// IsValidRequestID returns whether the request id passed by client is valid, it is no longer than 128 and
+// only contains [A-Za-z0-9._-] so it is safe to be logged and passed to the next hops
+func IsValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && c != '.' && c != '_' &&
+			c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// BuildTraceparent builds the traceparent header with the trace-id and a new parent-id. The request id
+// not in trace-id format (e.g. uuid from old versions) returns empty.
+func BuildTraceparent(traceID string) string {
+	if !IsTraceID(traceID) {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s-%s-%s", traceparentVersion, traceID, randomHex(8), traceFlagSampled)
+}
+
+// ParseTraceparent returns the trace-id of traceparent header
+func ParseTraceparent(traceparent string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isLowerHex(parts[0]) {
+		return "", false
+	}
+	if !IsTraceID(parts[1]) || len(parts[2]) != 16 || !isLowerHex(parts[2]) || parts[2] == zeroParentID {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name        string
+		traceparent string
+		want        string
+		wantOK      bool
+	}{
+		{name: "valid", traceparent: "00-" + traceID + "-00f067aa0ba902b7-01", want: traceID, wantOK: true},
+		{name: "future version with more parts", traceparent: "01-" + traceID + "-00f067aa0ba902b7-01-x",
+			want: traceID, wantOK: true},
+		{name: "invalid version ff", traceparent: "ff-" + traceID + "-00f067aa0ba902b7-01"},
+		{name: "zero trace id", traceparent: "00-" + zeroTraceID + "-00f067aa0ba902b7-01"},
+		{name: "zero parent id", traceparent: "00-" + traceID + "-" + zeroParentID + "-01"},
+		{name: "upper case", traceparent: "00-" + strings.ToUpper(traceID) + "-00f067aa0ba902b7-01"},
+		{name: "short trace id", traceparent: "00-4bf92f35-00f067aa0ba902b7-01"},
+		{name: "missing parts", traceparent: "00-" + traceID},
+		{name: "empty", traceparent: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTraceparent(tt.traceparent)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParseTraceparent() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestBuildTraceparent(t *testing.T) {
+	traceID := NewTraceID()
+	if !IsTraceID(traceID) {
+		t.Fatalf("NewTraceID() = %s is not valid trace id", traceID)
+	}
+	got, ok := ParseTraceparent(BuildTraceparent(traceID))
+	if !ok || got != traceID {
+		t.Errorf("ParseTraceparent(BuildTraceparent()) = %s, %v, want %s, true", got, ok, traceID)
+	}
+	if traceparent := BuildTraceparent("3f2504e0-4f89-11d3-9a0c-0305e82c3301"); traceparent != "" {
+		t.Errorf("BuildTraceparent() of uuid = %s, want empty", traceparent)
+	}
+}
+
+func TestIsValidRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "trace id", id: "4bf92f3577b34da6a3ce929d0e0e4736", want: true},
+		{name: "uuid", id: "3f2504e0-4f89-11d3-9a0c-0305e82c3301", want: true},
+		{name: "dot and underscore", id: "req_1.A", want: true},
+		{name: "max length", id: strings.Repeat("a", maxRequestIDLength), want: true},
+		{name: "too long", id: strings.Repeat("a", maxRequestIDLength+1), want: false},
+		{name: "empty", id: "", want: false},
+		{name: "space", id: "req 1", want: false},
+		{name: "newline", id: "req\n1", want: false},
+		{name: "non ascii", id: "请求", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidRequestID(tt.id); got != tt.want {
+				t.Errorf("IsValidRequestID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+const (
+	// accountTokenExpiration the max time the token is bound to its account, it is longer than the tokens
+	// of registry lived
+	accountTokenExpiration = time.Hour
+	// defaultRateLimitWindow the window of rate limit if the 429 response not tells it
+	defaultRateLimitWindow = time.Hour
+)
+
+// accountQuota the remaining quota of account reported by the last manifest response, it is refilled at
+// resetAt
+type accountQuota struct {
+	remaining int64
+	resetAt   time.Time
+}
+
+// accountPool tracks the remaining pull quota of the rotated accounts, the tokens requested with the
+// accounts are bound to them so that the RateLimit headers of manifest responses are attributed
+type accountPool struct {
+	sync.Mutex
+	quotas map[string]*accountQuota
+	tokens *cache.Cache
+}
+
+func newAccountPool() *accountPool {
+	return &accountPool{
+		quotas: make(map[string]*accountQuota),
+		tokens: cache.New(accountTokenExpiration, 5*time.Minute),
+	}
+}
+
+func accountKey(registry, username string) string {
+	return registry + "," + username
+}
+
+// order returns the users with the most remaining quota first, the users not reported yet are regarded as
+// full. The users not above minRemaining are put at the end.
+func (a *accountPool) order(registry string, users []*options.RegistryAuth,
+	minRemaining int64) []*options.RegistryAuth {
+	now := time.Now()
+	remaining := make(map[string]int64, len(users))
+	a.Lock()
+	for _, user := range users {
+		q, ok := a.quotas[accountKey(registry, user.Username)]
+		if !ok || now.After(q.resetAt) {
+			remaining[user.Username] = -1
+			continue
+		}
+		remaining[user.Username] = q.remaining
+	}
+	a.Unlock()
+	usable := func(u *options.RegistryAuth) bool {
+		r := remaining[u.Username]
+		return r < 0 || r > minRemaining
+	}
+	result := append([]*options.RegistryAuth{}, users...)
+	sort.SliceStable(result, func(i, j int) bool {
+		ui, uj := usable(result[i]), usable(result[j])
+		if ui != uj {
+			return ui
+		}
+		ri, rj := remaining[result[i].Username], remaining[result[j].Username]
+		// unknown quota first, they are not used yet
+		if (ri < 0) != (rj < 0) {
+			return ri < 0
+		}
+		return ri > rj
+	})
+	return result
+}
+
+// bind binds the tokens of auth token to the account requested it
+func (a *accountPool) bind(registry, username string, tokens ...string) {
+	for _, token := range tokens {
+		if token != "" {
+			a.tokens.Set(token, accountKey(registry, username), cache.DefaultExpiration)
+		}
+	}
+}
+
+// observe updates the quota of the account whose token authorized the manifest request with the RateLimit
+// headers of response
+func (a *accountPool) observe(registry string, headers map[string][]string, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	var authorization string
+	for k, v := range headers {
+		if strings.EqualFold(k, "Authorization") && len(v) != 0 {
+			authorization = v[0]
+		}
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return
+	}
+	v, ok := a.tokens.Get(token)
+	if !ok {
+		return
+	}
+	key := v.(string)
+	q := &accountQuota{}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		q.remaining = 0
+		q.resetAt = time.Now().Add(retryAfter(resp))
+	} else {
+		remaining, window, ok := parseRateLimit(resp.Header.Get("Ratelimit-Remaining"))
+		if !ok {
+			return
+		}
+		// the quota is refilled within the window, it is regarded as unknown after that
+		q.remaining = remaining
+		q.resetAt = time.Now().Add(window)
+	}
+	a.Lock()
+	a.quotas[key] = q
+	a.Unlock()
+	_, username, _ := strings.Cut(key, ",")
+	metrics.RegistryAccountQuotaRemaining.WithLabelValues(registry, username).Set(float64(q.remaining))
+}
+
+// parseRateLimit parses the RateLimit header value, e.g. '76;w=21600'
+func parseRateLimit(v string) (int64, time.Duration, bool) {
+	if v == "" {
+		return 0, 0, false
+	}
+	parts := strings.Split(v, ";")
+	n, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	window := defaultRateLimitWindow
+	for _, p := range parts[1:] {
+		if w, ok := strings.CutPrefix(strings.TrimSpace(p), "w="); ok {
+			if sec, err := strconv.ParseInt(w, 10, 64); err == nil && sec > 0 {
+				window = time.Duration(sec) * time.Second
+			}
+		}
+	}
+	return n, window, true
+}
+
+// retryAfter returns the Retry-After of 429 response, or the window of RateLimit-Limit header
+func retryAfter(resp *http.Response) time.Duration {
+	if sec, err := strconv.ParseInt(resp.Header.Get("Retry-After"), 10, 64); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if _, window, ok := parseRateLimit(resp.Header.Get("Ratelimit-Limit")); ok {
+		return window
+	}
+	return defaultRateLimitWindow
+}
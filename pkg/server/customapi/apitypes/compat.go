@@ -0,0 +1,70 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package apitypes
+
+const (
+	// LegacyAPIVersion is the version of the messages without apiVersion, they are sent by the nodes built
+	// before the version negotiation
+	LegacyAPIVersion = 1
+	// CurrentAPIVersion is the version of the messages of this build
+	CurrentAPIVersion = 2
+)
+
+// The capabilities are reported by the heartbeats of nodes, the peers check them before using the
+// optional APIs of node, so that the nodes of different builds keep working during rolling upgrades.
+const (
+	// CapabilityGRPC the node serves the internal gRPC API
+	CapabilityGRPC = "supports-grpc"
+	// CapabilityChunkedTransfer the node streams the layers in chunks with TransferLayer of gRPC
+	CapabilityChunkedTransfer = "supports-chunked-transfer"
+	// CapabilityDownloadCancel the node cancels the layer downloads when requested by master
+	CapabilityDownloadCancel = "supports-download-cancel"
+	// CapabilityLayerZSet the node stores the layer locations in sorted sets, the layers are also written
+	// into the legacy hash while the nodes without it are alive
+	CapabilityLayerZSet = "supports-layer-zset"
+)
+
+// APIMeta is embedded in the requests and responses between nodes, the apiVersion is omitted by the
+// legacy nodes
+type APIMeta struct {
+	APIVersion int `json:"apiVersion,omitempty"`
+}
+
+// GetAPIVersion returns the api version of message, LegacyAPIVersion if not set
+func (m *APIMeta) GetAPIVersion() int {
+	if m.APIVersion <= 0 {
+		return LegacyAPIVersion
+	}
+	return m.APIVersion
+}
+
+// SetAPIVersion sets the api version of message
+func (m *APIMeta) SetAPIVersion(v int) {
+	m.APIVersion = v
+}
+
+// Versioned defines the message with api version
+type Versioned interface {
+	GetAPIVersion() int
+	SetAPIVersion(v int)
+}
+
+// NegotiateAPIVersion returns the api version both this node and the peer support
+func NegotiateAPIVersion(peer int) int {
+	if peer <= 0 {
+		return LegacyAPIVersion
+	}
+	return min(peer, CurrentAPIVersion)
+}
+
+// HasCapability returns whether capability is in capabilities
+func HasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
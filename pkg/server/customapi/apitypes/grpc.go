@@ -0,0 +1,322 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package apitypes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/nodepb"
+)
+
+const (
+	grpcErrorDomain = "accelerboat"
+
+	grpcReasonUpstreamStatus        = "UPSTREAM_STATUS"
+	grpcReasonLayerBlocked          = "LAYER_BLOCKED"
+	grpcReasonSignatureVerifyFailed = "SIGNATURE_VERIFY_FAILED"
+	grpcReasonNotMaster             = "NOT_MASTER"
+)
+
+// ToGRPCError converts the error of handler into gRPC status, the failure status of original registry and
+// the rejections of layer scan or signature verification are carried in the error details
+func ToGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var upErr *UpstreamStatusError
+	var nmErr *NotMasterError
+	switch {
+	case errors.As(err, &nmErr):
+		return grpcErrorWithReason(codes.FailedPrecondition, err.Error(), grpcReasonNotMaster,
+			map[string]string{"master": nmErr.Master})
+	case errors.As(err, &upErr):
+		return grpcErrorWithReason(codes.FailedPrecondition, err.Error(), grpcReasonUpstreamStatus,
+			map[string]string{
+				"statusCode":   strconv.Itoa(upErr.StatusCode),
+				"authenticate": upErr.Authenticate,
+				"message":      upErr.Message,
+			})
+	case errors.Is(err, ErrLayerBlocked):
+		return grpcErrorWithReason(codes.PermissionDenied, err.Error(), grpcReasonLayerBlocked, nil)
+	case errors.Is(err, ErrSignatureVerifyFailed):
+		return grpcErrorWithReason(codes.PermissionDenied, err.Error(), grpcReasonSignatureVerifyFailed, nil)
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Unknown, err.Error())
+	}
+}
+
+func grpcErrorWithReason(code codes.Code, msg, reason string, metadata map[string]string) error {
+	st, err := status.New(code, msg).WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   grpcErrorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
+// FromGRPCError converts the gRPC status carried the error details into the errors of apitypes, the other
+// errors are returned directly
+func FromGRPCError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.GetDomain() != grpcErrorDomain {
+			continue
+		}
+		switch info.GetReason() {
+		case grpcReasonUpstreamStatus:
+			code, _ := strconv.Atoi(info.GetMetadata()["statusCode"])
+			return &UpstreamStatusError{
+				StatusCode:   code,
+				Authenticate: info.GetMetadata()["authenticate"],
+				Message:      info.GetMetadata()["message"],
+			}
+		case grpcReasonNotMaster:
+			return &NotMasterError{Master: info.GetMetadata()["master"]}
+		case grpcReasonLayerBlocked:
+			return fmt.Errorf("%w: %s", ErrLayerBlocked, st.Message())
+		case grpcReasonSignatureVerifyFailed:
+			return fmt.Errorf("%w: %s", ErrSignatureVerifyFailed, st.Message())
+		}
+	}
+	return err
+}
+
+func headersToProto(headers map[string][]string) map[string]*nodepb.HeaderValues {
+	if headers == nil {
+		return nil
+	}
+	result := make(map[string]*nodepb.HeaderValues, len(headers))
+	for k, v := range headers {
+		result[k] = &nodepb.HeaderValues{Values: v}
+	}
+	return result
+}
+
+func headersFromProto(headers map[string]*nodepb.HeaderValues) map[string][]string {
+	if headers == nil {
+		return nil
+	}
+	result := make(map[string][]string, len(headers))
+	for k, v := range headers {
+		result[k] = v.GetValues()
+	}
+	return result
+}
+
+// ToProto converts the request into protobuf
+func (req *GetServiceTokenRequest) ToProto() *nodepb.GetServiceTokenRequest {
+	return &nodepb.GetServiceTokenRequest{
+		OriginalHost:    req.OriginalHost,
+		ServiceTokenUrl: req.ServiceTokenUrl,
+		Headers:         headersToProto(req.Headers),
+		Service:         req.Service,
+		Scope:           req.Scope,
+	}
+}
+
+// GetServiceTokenRequestFromProto converts the protobuf request
+func GetServiceTokenRequestFromProto(req *nodepb.GetServiceTokenRequest) *GetServiceTokenRequest {
+	return &GetServiceTokenRequest{
+		OriginalHost:    req.GetOriginalHost(),
+		ServiceTokenUrl: req.GetServiceTokenUrl(),
+		Headers:         headersFromProto(req.GetHeaders()),
+		Service:         req.GetService(),
+		Scope:           req.GetScope(),
+	}
+}
+
+// ToProto converts the token into protobuf, the zero issued time is kept as 0
+func (t *RegistryAuthToken) ToProto() *nodepb.GetServiceTokenResponse {
+	resp := &nodepb.GetServiceTokenResponse{
+		Token:       t.Token,
+		AccessToken: t.AccessToken,
+		ExpiresIn:   int64(t.ExpiresIn),
+	}
+	if !t.IssuedAt.IsZero() {
+		resp.IssuedAt = t.IssuedAt.UnixNano()
+	}
+	return resp
+}
+
+// RegistryAuthTokenFromProto converts the protobuf token
+func RegistryAuthTokenFromProto(resp *nodepb.GetServiceTokenResponse) *RegistryAuthToken {
+	token := &RegistryAuthToken{
+		Token:       resp.GetToken(),
+		AccessToken: resp.GetAccessToken(),
+		ExpiresIn:   int(resp.GetExpiresIn()),
+	}
+	if resp.GetIssuedAt() != 0 {
+		token.IssuedAt = time.Unix(0, resp.GetIssuedAt()).UTC()
+	}
+	return token
+}
+
+// ToProto converts the request into protobuf
+func (req *GetManifestRequest) ToProto() *nodepb.GetManifestRequest {
+	return &nodepb.GetManifestRequest{
+		OriginalHost: req.OriginalHost,
+		ManifestUrl:  req.ManifestUrl,
+		Headers:      headersToProto(req.Headers),
+		Repo:         req.Repo,
+		Tag:          req.Tag,
+	}
+}
+
+// GetManifestRequestFromProto converts the protobuf request
+func GetManifestRequestFromProto(req *nodepb.GetManifestRequest) *GetManifestRequest {
+	return &GetManifestRequest{
+		OriginalHost: req.GetOriginalHost(),
+		ManifestUrl:  req.GetManifestUrl(),
+		Headers:      headersFromProto(req.GetHeaders()),
+		Repo:         req.GetRepo(),
+		Tag:          req.GetTag(),
+	}
+}
+
+// ToProto converts the request of GetLayerInfo into protobuf
+func (req *DownloadLayerRequest) ToProto() *nodepb.GetLayerInfoRequest {
+	return &nodepb.GetLayerInfoRequest{
+		OriginalHost: req.OriginalHost,
+		LayerUrl:     req.LayerUrl,
+		Headers:      headersToProto(req.Headers),
+		Repo:         req.Repo,
+		Digest:       req.Digest,
+	}
+}
+
+// DownloadLayerRequestFromProto converts the protobuf request of GetLayerInfo
+func DownloadLayerRequestFromProto(req *nodepb.GetLayerInfoRequest) *DownloadLayerRequest {
+	return &DownloadLayerRequest{
+		OriginalHost: req.GetOriginalHost(),
+		LayerUrl:     req.GetLayerUrl(),
+		Headers:      headersFromProto(req.GetHeaders()),
+		Repo:         req.GetRepo(),
+		Digest:       req.GetDigest(),
+	}
+}
+
+// ToProto converts the response into protobuf
+func (resp *DownloadLayerResponse) ToProto() *nodepb.LayerInfo {
+	return &nodepb.LayerInfo{
+		TorrentBase64:  resp.TorrentBase64,
+		TorrentPending: resp.TorrentPending,
+		Located:        resp.Located,
+		FilePath:       resp.FilePath,
+		FileSize:       resp.FileSize,
+	}
+}
+
+// DownloadLayerResponseFromProto converts the protobuf layer info
+func DownloadLayerResponseFromProto(info *nodepb.LayerInfo) *DownloadLayerResponse {
+	return &DownloadLayerResponse{
+		TorrentBase64:  info.GetTorrentBase64(),
+		TorrentPending: info.GetTorrentPending(),
+		Located:        info.GetLocated(),
+		FilePath:       info.GetFilePath(),
+		FileSize:       info.GetFileSize(),
+	}
+}
+
+// ToProto converts the request into protobuf
+func (req *CheckStaticLayerRequest) ToProto() *nodepb.CheckStaticLayerRequest {
+	return &nodepb.CheckStaticLayerRequest{
+		OriginalHost:          req.OriginalHost,
+		Repo:                  req.Repo,
+		Digest:                req.Digest,
+		LayerPath:             req.LayerPath,
+		ExpectedContentLength: req.ExpectedContentLength,
+	}
+}
+
+// CheckStaticLayerRequestFromProto converts the protobuf request
+func CheckStaticLayerRequestFromProto(req *nodepb.CheckStaticLayerRequest) *CheckStaticLayerRequest {
+	return &CheckStaticLayerRequest{
+		OriginalHost:          req.GetOriginalHost(),
+		Repo:                  req.GetRepo(),
+		Digest:                req.GetDigest(),
+		LayerPath:             req.GetLayerPath(),
+		ExpectedContentLength: req.GetExpectedContentLength(),
+	}
+}
+
+// ToProto converts the response into protobuf
+func (resp *CheckStaticLayerResponse) ToProto() *nodepb.LayerInfo {
+	return &nodepb.LayerInfo{
+		TorrentBase64:  resp.TorrentBase64,
+		TorrentPending: resp.TorrentPending,
+		Located:        resp.Located,
+		FilePath:       resp.LayerPath,
+		FileSize:       resp.FileSize,
+	}
+}
+
+// CheckStaticLayerResponseFromProto converts the protobuf layer info
+func CheckStaticLayerResponseFromProto(info *nodepb.LayerInfo) *CheckStaticLayerResponse {
+	return &CheckStaticLayerResponse{
+		TorrentBase64:  info.GetTorrentBase64(),
+		TorrentPending: info.GetTorrentPending(),
+		Located:        info.GetLocated(),
+		LayerPath:      info.GetFilePath(),
+		FileSize:       info.GetFileSize(),
+	}
+}
+
+// ToProto converts the request into protobuf
+func (req *CheckOCILayerRequest) ToProto() *nodepb.CheckOCILayerRequest {
+	return &nodepb.CheckOCILayerRequest{
+		Digest:  req.Digest,
+		OciType: req.OCIType,
+	}
+}
+
+// CheckOCILayerRequestFromProto converts the protobuf request
+func CheckOCILayerRequestFromProto(req *nodepb.CheckOCILayerRequest) *CheckOCILayerRequest {
+	return &CheckOCILayerRequest{
+		Digest:  req.GetDigest(),
+		OCIType: req.GetOciType(),
+	}
+}
+
+// ToProto converts the response into protobuf
+func (resp *CheckOCILayerResponse) ToProto() *nodepb.LayerInfo {
+	return &nodepb.LayerInfo{
+		TorrentBase64: resp.TorrentBase64,
+		Located:       resp.Located,
+		FilePath:      resp.LayerPath,
+		FileSize:      resp.FileSize,
+	}
+}
+
+// CheckOCILayerResponseFromProto converts the protobuf layer info
+func CheckOCILayerResponseFromProto(info *nodepb.LayerInfo) *CheckOCILayerResponse {
+	return &CheckOCILayerResponse{
+		TorrentBase64: info.GetTorrentBase64(),
+		Located:       info.GetLocated(),
+		LayerPath:     info.GetFilePath(),
+		FileSize:      info.GetFileSize(),
+	}
+}
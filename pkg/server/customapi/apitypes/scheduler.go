@@ -0,0 +1,26 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package apitypes
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// MaxExtenderPriority the max score of node the scheduler extender returns
+const MaxExtenderPriority int64 = 10
+
+// ExtenderArgs defines the arguments of kube-scheduler extender (k8s.io/kube-scheduler/extender/v1), Nodes is
+// set if the extender is not node cache capable, otherwise NodeNames is set
+type ExtenderArgs struct {
+	Pod       *corev1.Pod      `json:"pod"`
+	Nodes     *corev1.NodeList `json:"nodes,omitempty"`
+	NodeNames *[]string        `json:"nodenames,omitempty"`
+}
+
+// HostPriority defines the score of node responded to kube-scheduler
+type HostPriority struct {
+	Host  string `json:"host"`
+	Score int64  `json:"score"`
+}
@@ -5,8 +5,13 @@
 package apitypes
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/penglongli/accelerboat/pkg/version"
 )
 
 const (
@@ -24,6 +29,39 @@ const (
 	APIMetrics          = "/customapi/metrics"
 	APIConfig           = "/customapi/config"
 	APIOCIImages        = "/customapi/oci-images"
+	APIImportLayer      = "/customapi/import-layer"
+	APIUpstreams        = "/customapi/upstreams"
+	APITorrentLimits    = "/customapi/torrent-limits"
+	APIPullTimeline     = "/customapi/pull-timeline"
+	APIReadiness        = "/customapi/readiness"
+	APICancelDownload   = "/customapi/cancel-download-layer"
+	APIPreheatHistory   = "/customapi/preheat-history"
+	APIRegistryWebhook  = "/customapi/webhooks/registry"
+	APILogs             = "/customapi/logs"
+	APITorrents         = "/customapi/torrents"
+	APIStorage          = "/customapi/storage"
+	APIDrain            = "/customapi/drain"
+	APIUncordon         = "/customapi/uncordon"
+	APIVersion          = "/customapi/version"
+	APIImagesSeen       = "/customapi/images-seen"
+	APILayerUsage       = "/customapi/layer-usage"
+	APIRuntime          = "/customapi/runtime"
+
+	APIFederationDownloadLayer = "/customapi/federation/download-layer"
+	APIFederationLayer         = "/customapi/federation/layer"
+
+	APILayerAvailability   = "/customapi/layer-availability"
+	APISchedulerPrioritize = "/customapi/scheduler/prioritize"
+	APIRegistryCredential  = "/customapi/registry-credential"
+	APIRedirectBlob        = "/customapi/redirect-blob"
+	APIEstargzLayer        = "/customapi/estargz-layer"
+	APISavings             = "/customapi/savings"
+	APIScalingSignals      = "/customapi/scaling-signals"
+	APIParentLayer         = "/customapi/parent/layer"
+
+	// APIExternalMetrics the external metrics API of HPA served by the built-in adapter
+	APIExternalMetrics     = "/apis/external.metrics.k8s.io/v1beta1"
+	APIExternalMetricValue = APIExternalMetrics + "/namespaces/:namespace/:metric"
 )
 
 var (
@@ -34,11 +72,101 @@ var (
 		APIMetrics:       {},
 		APIConfig:        {},
 		APIOCIImages:    {},
+		APIPullTimeline:  {},
+		APIReadiness:     {},
+		APIPreheatHistory: {},
+		APILogs:           {},
+		APIStorage:        {},
+		APIVersion:        {},
+		APIImagesSeen:     {},
+		APILayerUsage:     {},
+		APIRuntime:        {},
+		APILayerAvailability: {},
+		APISchedulerPrioritize: {},
+		APISavings:             {},
+		APIScalingSignals:      {},
+		APIExternalMetrics:     {},
+		APIExternalMetricValue: {},
 		"/metrics":       {},
 	}
 )
 
+// ErrSignatureVerifyFailed is returned by master when the manifest is rejected by signature verification,
+// the request should not be reversed to the original registry.
+var ErrSignatureVerifyFailed = errors.New("signature verification failed")
+
+// ErrLayerBlocked is returned when the layer is blocked by layer scan hook, the request should not be
+// reversed to the original registry.
+var ErrLayerBlocked = errors.New("layer blocked by scan")
+
+// ErrWebhookUnauthorized is returned when the signature of registry notification is invalid
+var ErrWebhookUnauthorized = errors.New("webhook signature invalid")
+
+// WebhookSignatureHeader the header carries the hex HMAC-SHA256 of registry notification body
+const WebhookSignatureHeader = "X-Accelerboat-Signature"
+
+// UpstreamStatusHeader the header of master response carries the failure status code of original registry
+const UpstreamStatusHeader = "X-Accelerboat-Upstream-Status"
+
+// UpstreamStatusError is returned when the original registry responds failure status to master, e.g. 401
+// with the WWW-Authenticate challenge. It is propagated to worker with UpstreamStatusHeader.
+type UpstreamStatusError struct {
+	StatusCode   int
+	Authenticate string
+	Message      string
+}
+
+// Error implements the error interface
+func (e *UpstreamStatusError) Error() string {
+	return fmt.Sprintf("original registry responded %d: %s", e.StatusCode, e.Message)
+}
+
+// NewUpstreamStatusError returns the UpstreamStatusError if the original registry responded failure status,
+// otherwise returns err directly
+func NewUpstreamStatusError(resp *http.Response, err error) error {
+	if resp == nil || resp.StatusCode < http.StatusBadRequest {
+		return err
+	}
+	return &UpstreamStatusError{
+		StatusCode:   resp.StatusCode,
+		Authenticate: resp.Header.Get("Www-Authenticate"),
+		Message:      err.Error(),
+	}
+}
+
+// ParseUpstreamStatusError returns the UpstreamStatusError carried by the response of master, returns nil
+// if the failure is not from original registry
+func ParseUpstreamStatusError(resp *http.Response, err error) *UpstreamStatusError {
+	if resp == nil {
+		return nil
+	}
+	code, _ := strconv.Atoi(resp.Header.Get(UpstreamStatusHeader))
+	if code == 0 {
+		return nil
+	}
+	return &UpstreamStatusError{
+		StatusCode:   code,
+		Authenticate: resp.Header.Get("Www-Authenticate"),
+		Message:      err.Error(),
+	}
+}
+
+// MasterAddressHeader the header of the misdirected response carries the address of current master
+const MasterAddressHeader = "X-Accelerboat-Master"
+
+// NotMasterError is returned by the master-only APIs called on the node not master, Master is the current
+// master this node watched. It is responded with 421 and MasterAddressHeader.
+type NotMasterError struct {
+	Master string
+}
+
+// Error implements the error interface
+func (e *NotMasterError) Error() string {
+	return fmt.Sprintf("this node is not master, current master is '%s'", e.Master)
+}
+
 type GetServiceTokenRequest struct {
+	APIMeta
 	OriginalHost    string              `json:"originalHost"`
 	ServiceTokenUrl string              `json:"serviceTokenUrl"`
 	Headers         map[string][]string `json:"headers"`
@@ -54,6 +182,7 @@ type RegistryAuthToken struct {
 }
 
 type HeadManifestRequest struct {
+	APIMeta
 	OriginalHost    string              `json:"originalHost"`
 	HeadManifestUrl string              `json:"headManifestUrl"`
 	Headers         map[string][]string `json:"headers"`
@@ -62,11 +191,13 @@ type HeadManifestRequest struct {
 }
 
 type HeadManifestResponse struct {
+	APIMeta
 	Headers map[string][]string `json:"headers"`
 }
 
 // GetManifestRequest defines the request of GetManifest
 type GetManifestRequest struct {
+	APIMeta
 	OriginalHost string              `json:"originalHost"`
 	ManifestUrl  string              `json:"manifestUrl"`
 	Headers      map[string][]string `json:"headers"`
@@ -76,25 +207,60 @@ type GetManifestRequest struct {
 
 // DownloadLayerRequest defines the request of download layer
 type DownloadLayerRequest struct {
+	APIMeta
 	OriginalHost string              `json:"originalHost"`
 	LayerUrl     string              `json:"layerUrl"`
 	Headers      map[string][]string `json:"headers"`
 	Repo         string              `json:"repo"`
 	Digest       string              `json:"digest"`
+	// FromObjectStorage download the layer from object storage instead of original registry
+	FromObjectStorage bool `json:"fromObjectStorage,omitempty"`
+	// ContentLength the content length of layer, required by the gateway to download from other clusters
+	ContentLength int64 `json:"contentLength,omitempty"`
+	// FederationSources the other clusters having the layer, the gateway downloads the layer from them
+	FederationSources []*FederationSource `json:"federationSources,omitempty"`
+}
+
+// FederationSource defines the cluster of federation which has the layer, its gateway is resolved by the
+// gateway node from the registered clusters
+type FederationSource struct {
+	Cluster string `json:"cluster"`
+}
+
+// CancelDownloadLayerRequest defines the request of master to cancel the layer downloading on node
+type CancelDownloadLayerRequest struct {
+	APIMeta
+	Digest string `json:"digest"`
+}
+
+// CancelDownloadLayerResponse defines the response of cancel download layer, the download is not
+// canceled if its progress reached the complete threshold
+type CancelDownloadLayerResponse struct {
+	APIMeta
+	Canceled bool `json:"canceled"`
+	// Progress the downloaded percent of layer
+	Progress float64 `json:"progress"`
 }
 
 // DownloadLayerResponse defines the response of download layer
 type DownloadLayerResponse struct {
+	APIMeta
 	TorrentBase64 string `json:"torrentBase64"`
-	Located       string `json:"located"`
-	FilePath      string `json:"filePath"`
-	FileSize      int64  `json:"fileSize"`
+	// TorrentPending the torrent of layer is generating, caller should download with tcp
+	TorrentPending bool   `json:"torrentPending,omitempty"`
+	Located        string `json:"located"`
+	FilePath       string `json:"filePath"`
+	FileSize       int64  `json:"fileSize"`
+	// FromOrigin the layer is downloaded from original registry for the request, not cached in cluster
+	FromOrigin bool `json:"fromOrigin,omitempty"`
 }
 
 func (resp *DownloadLayerResponse) ToJSONString() string {
 	var torrent string
 	if resp.TorrentBase64 != "" {
 		torrent = "(too long not print)"
+	} else if resp.TorrentPending {
+		torrent = "(torrent-pending)"
 	} else {
 		torrent = "(no-torrent)"
 	}
@@ -102,8 +268,17 @@ func (resp *DownloadLayerResponse) ToJSONString() string {
 		torrent, resp.Located, resp.FilePath, resp.FileSize)
 }
 
+// ImportLayerResponse defines the response of import layer
+type ImportLayerResponse struct {
+	APIMeta
+	Located  string `json:"located"`
+	FilePath string `json:"filePath"`
+	FileSize int64  `json:"fileSize"`
+}
+
 // CheckStaticLayerRequest defines the request of check static layer
 type CheckStaticLayerRequest struct {
+	APIMeta
 	OriginalHost          string `json:"originalHost"`
 	Repo                  string `json:"repo"`
 	Digest                string `json:"digest"`
@@ -113,22 +288,366 @@ type CheckStaticLayerRequest struct {
 
 // CheckStaticLayerResponse defines the response of CheckStaticLayer
 type CheckStaticLayerResponse struct {
+	APIMeta
 	Located       string `json:"located"`
 	LayerPath     string `json:"layerPath"`
 	TorrentBase64 string `json:"torrentBase64"`
-	FileSize      int64  `json:"fileSize"`
+	// TorrentPending the torrent of layer is generating, caller should download with tcp
+	TorrentPending bool  `json:"torrentPending,omitempty"`
+	FileSize       int64 `json:"fileSize"`
 }
 
 // CheckOCILayerRequest defines the request of CheckOCILayer
 type CheckOCILayerRequest struct {
+	APIMeta
 	Digest  string `json:"digest"`
 	OCIType string `json:"ociType"`
 }
 
 // CheckOCILayerResponse defines the response of CheckOCILayer
 type CheckOCILayerResponse struct {
+	APIMeta
 	Located       string `json:"located"`
 	LayerPath     string `json:"layerPath"`
 	TorrentBase64 string `json:"torrentBase64"`
 	FileSize      int64  `json:"fileSize"`
 }
+
+// TorrentLimitsRequest defines the request to override the torrent rate limits(MB/s) temporarily, the
+// limits revert to schedule or config after the duration (e.g. '8h')
+type TorrentLimitsRequest struct {
+	APIMeta
+	UploadLimit   int64  `json:"uploadLimit"`
+	DownloadLimit int64  `json:"downloadLimit"`
+	Duration      string `json:"duration"`
+}
+
+// TorrentInfo defines the torrent in the torrent client of node, the digest is empty if the info of torrent
+// is not got yet
+type TorrentInfo struct {
+	Digest         string  `json:"digest"`
+	InfoHash       string  `json:"infoHash"`
+	Size           int64   `json:"size"`
+	BytesCompleted int64   `json:"bytesCompleted"`
+	Progress       float64 `json:"progress"`
+	Seeding        bool    `json:"seeding"`
+	TotalPeers     int     `json:"totalPeers"`
+	ActivePeers    int     `json:"activePeers"`
+	Seeders        int     `json:"seeders"`
+}
+
+// TorrentListResponse defines the torrents of node
+type TorrentListResponse struct {
+	APIMeta
+	Torrents []*TorrentInfo `json:"torrents"`
+}
+
+// VersionHeader is the response header with the version of accelerboat
+const VersionHeader = "X-Accelerboat-Version"
+
+// VersionResponse defines the build of node, and the versions of all alive nodes if requested
+type VersionResponse struct {
+	APIMeta
+	*version.BuildInfo
+	Nodes []*NodeVersion `json:"nodes,omitempty"`
+}
+
+// NodeVersion defines the version of node reported by its heartbeat
+type NodeVersion struct {
+	Node          string    `json:"node"`
+	Version       string    `json:"version"`
+	GitCommit     string    `json:"gitCommit"`
+	APIVersion    int       `json:"apiVersion,omitempty"`
+	Capabilities  []string  `json:"capabilities,omitempty"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+}
+
+// ImagesSeenResponse defines the images pulled through the proxies of cluster since the time
+type ImagesSeenResponse struct {
+	APIMeta
+	Since  time.Time    `json:"since"`
+	Images []*ImageSeen `json:"images"`
+}
+
+// LayerUsageResponse defines the last used time of layers on the node, CompactedAt is the time the usage
+// index was last compacted into the snapshot
+type LayerUsageResponse struct {
+	APIMeta
+	CompactedAt time.Time     `json:"compactedAt"`
+	Layers      []*LayerUsage `json:"layers"`
+}
+
+// LayerUsage defines the last time the layer was served or downloaded by the node
+type LayerUsage struct {
+	Digest   string    `json:"digest"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// RuntimeResponse defines the runtime diagnostics of the process, the memory is in bytes and OpenFDs/MaxFDs
+// are -1 if unknown
+type RuntimeResponse struct {
+	APIMeta
+	GoVersion     string    `json:"goVersion"`
+	Goroutines    int       `json:"goroutines"`
+	GOMAXPROCS    int       `json:"gomaxprocs"`
+	HeapAlloc     uint64    `json:"heapAlloc"`
+	HeapInuse     uint64    `json:"heapInuse"`
+	HeapObjects   uint64    `json:"heapObjects"`
+	Sys           uint64    `json:"sys"`
+	NumGC         uint32    `json:"numGC"`
+	LastGC        time.Time `json:"lastGC"`
+	LastGCPauseMs float64   `json:"lastGCPauseMs"`
+	GCPauseMs     float64   `json:"gcPauseMs"`
+	GCCPUFraction float64   `json:"gcCPUFraction"`
+	OpenFDs       int       `json:"openFDs"`
+	MaxFDs        int64     `json:"maxFDs"`
+}
+
+// LayerAvailabilityResponse defines the bytes of image cached on each node, the nodes holding more bytes
+// first. The config and layers of the manifest matched the platform are counted.
+type LayerAvailabilityResponse struct {
+	APIMeta
+	Image     string              `json:"image"`
+	Platform  string              `json:"platform"`
+	Layers    int                 `json:"layers"`
+	TotalSize int64               `json:"totalSize"`
+	Nodes     []*NodeAvailability `json:"nodes"`
+}
+
+// NodeAvailability defines the layers of image cached on the node, Percent is of the bytes in [0, 100]
+type NodeAvailability struct {
+	Node         string  `json:"node"`
+	CachedLayers int     `json:"cachedLayers"`
+	CachedSize   int64   `json:"cachedSize"`
+	Percent      float64 `json:"percent"`
+}
+
+// RegistryCredentialResponse defines the credentials of the registry hosts for the kubelet credential provider,
+// Auths is empty if the registry of image is not mapped or has no credential
+type RegistryCredentialResponse struct {
+	APIMeta
+	CacheDuration int64                    `json:"cacheDuration"`
+	Auths         map[string]*RegistryAuth `json:"auths"`
+}
+
+// RegistryAuth defines the username/password of registry host
+type RegistryAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ImageSeen defines the image indexed when its manifest served, the tag can be a digest
+type ImageSeen struct {
+	Registry  string    `json:"registry"`
+	Repo      string    `json:"repo"`
+	Tag       string    `json:"tag"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// NodeCordonResponse defines the cordon state of node
+type NodeCordonResponse struct {
+	APIMeta
+	Node     string `json:"node"`
+	Cordoned bool   `json:"cordoned"`
+	// Since the time the node was cordoned
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// StorageResponse defines the inspection of storage directories of node
+type StorageResponse struct {
+	APIMeta
+	Directories []*StorageDirectory `json:"directories"`
+	// LargestLayers the largest layers of all directories, the largest first
+	LargestLayers []*StorageFile `json:"largestLayers"`
+	// OrphanedParts the part files of layer transfer not modified recently, left by broken transfers
+	OrphanedParts []*StorageFile `json:"orphanedParts"`
+	// SparseFiles the files whose logical size is far larger than the allocated size on disk
+	SparseFiles []*StorageFile `json:"sparseFiles"`
+}
+
+// StorageDirectory defines the usage of one storage directory, the sizes are in bytes
+type StorageDirectory struct {
+	Label         string `json:"label"`
+	Path          string `json:"path"`
+	Files         int    `json:"files"`
+	Size          int64  `json:"size"`
+	AllocatedSize int64  `json:"allocatedSize"`
+	Error         string `json:"error,omitempty"`
+}
+
+// StorageFile defines the file in storage directory
+type StorageFile struct {
+	Label         string    `json:"label"`
+	Path          string    `json:"path"`
+	Size          int64     `json:"size"`
+	AllocatedSize int64     `json:"allocatedSize"`
+	ModTime       time.Time `json:"modTime"`
+}
+
+// UpstreamSwitchResponse defines the response of enable/disable upstream
+type UpstreamSwitchResponse struct {
+	APIMeta
+	ProxyHost    string `json:"proxyHost"`
+	OriginalHost string `json:"originalHost"`
+	Enable       bool   `json:"enable"`
+}
+
+// Phases of preheat run
+const (
+	PreheatPhaseRunning   = "Running"
+	PreheatPhaseSucceeded = "Succeeded"
+	PreheatPhaseFailed    = "Failed"
+)
+
+// PreheatRun defines one run of the preheat task, the task is the namespace/name of ConfigMap
+type PreheatRun struct {
+	Task      string                `json:"task"`
+	RunID     string                `json:"runID"`
+	Trigger   string                `json:"trigger"`
+	Phase     string                `json:"phase"`
+	StartTime time.Time             `json:"startTime"`
+	EndTime   time.Time             `json:"endTime,omitempty"`
+	Message   string                `json:"message,omitempty"`
+	Images    []*PreheatImageResult `json:"images"`
+}
+
+// PreheatImageResult defines the preheat result of one image, the size is the bytes of blobs pulled
+type PreheatImageResult struct {
+	Image string `json:"image"`
+	Blobs int    `json:"blobs"`
+	Size  int64  `json:"size"`
+	Error string `json:"error,omitempty"`
+}
+
+// PreheatWebhookResponse defines the pushed images accepted to preheat, and the skipped ones which not
+// matched the configured repositories or are being preheated
+type PreheatWebhookResponse struct {
+	APIMeta
+	Accepted []string `json:"accepted"`
+	Skipped  []string `json:"skipped"`
+}
+
+// PreheatHistoryResponse defines the runs of preheat tasks, the latest first
+type PreheatHistoryResponse struct {
+	APIMeta
+	Runs []*PreheatRun `json:"runs"`
+}
+
+// PullTimelineResponse defines the ordered events of one image pull
+type PullTimelineResponse struct {
+	APIMeta
+	Registry   string               `json:"registry"`
+	Repo       string               `json:"repo"`
+	Tag        string               `json:"tag,omitempty"`
+	RequestIDs []string             `json:"requestIDs"`
+	Start      time.Time            `json:"start"`
+	End        time.Time            `json:"end"`
+	DurationMs int64                `json:"durationMs"`
+	Entries    []*PullTimelineEntry `json:"entries"`
+}
+
+// PullTimelineEntry defines one event of the pull timeline, offset is relative to the start of pull
+type PullTimelineEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	OffsetMs   int64     `json:"offsetMs"`
+	RequestID  string    `json:"requestID,omitempty"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	Digest     string    `json:"digest,omitempty"`
+	Method     string    `json:"method,omitempty"`
+	DurationMs int64     `json:"durationMs,omitempty"`
+	Message    string    `json:"message,omitempty"`
+}
+
+// EstargzLayerResponse defines the eStargz layer of digest, TOC is the TOC JSON of the converted layer if
+// requested and the layer is cached on the node
+type EstargzLayerResponse struct {
+	APIMeta
+	Layer *EstargzLayer `json:"layer"`
+	TOC   interface{}   `json:"toc,omitempty"`
+}
+
+// EstargzLayer defines the eStargz layer converted from the cached layer, Converted is same as Digest if
+// the layer is eStargz already. The digests are hex without 'sha256:'.
+type EstargzLayer struct {
+	Digest    string    `json:"digest"`
+	Converted string    `json:"converted"`
+	TOCDigest string    `json:"tocDigest"`
+	DiffID    string    `json:"diffID,omitempty"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+	// MediaType the media type of converted layer, it is empty if same as the original
+	MediaType string `json:"mediaType,omitempty"`
+	// Annotations the annotations of converted layer in manifest, e.g. the TOC digest and zstd:chunked
+	// manifest position which the lazy-pulling snapshotters locate the TOC with
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SavingsResponse defines the bytes downloaded from original registries compared with the bytes served to
+// clients from the days Since to Until, and the egress cost avoided by CostPerGB
+type SavingsResponse struct {
+	APIMeta
+	Since      string             `json:"since"`
+	Until      string             `json:"until"`
+	CostPerGB  float64            `json:"costPerGB"`
+	Total      *RegistrySavings   `json:"total"`
+	Registries []*RegistrySavings `json:"registries"`
+}
+
+// RegistrySavings defines the savings of original registry, SavedBytes is the bytes served not downloaded
+// from original registry
+type RegistrySavings struct {
+	Registry    string          `json:"registry,omitempty"`
+	OriginBytes int64           `json:"originBytes"`
+	ServedBytes int64           `json:"servedBytes"`
+	SavedBytes  int64           `json:"savedBytes"`
+	SavedCost   float64         `json:"savedCost"`
+	Days        []*DailyTraffic `json:"days,omitempty"`
+}
+
+// DailyTraffic defines the bytes downloaded from original registry and served to clients of the day(UTC)
+type DailyTraffic struct {
+	Date        string `json:"date"`
+	Registry    string `json:"registry"`
+	OriginBytes int64  `json:"originBytes"`
+	ServedBytes int64  `json:"servedBytes"`
+}
+
+// LoadSignals defines the load signals of node for autoscaling the proxy tier, BandwidthSaturation is the
+// served throughput divided by the node bandwidth
+type LoadSignals struct {
+	QueuedDownloads     int64   `json:"queuedDownloads"`
+	ThroughputBytes     int64   `json:"throughputBytes"`
+	BandwidthSaturation float64 `json:"bandwidthSaturation"`
+	BlobLatencyP95Ms    int64   `json:"blobLatencyP95Ms"`
+}
+
+// NodeLoadSignals defines the load signals reported by node with its heartbeat
+type NodeLoadSignals struct {
+	Node string `json:"node"`
+	LoadSignals
+}
+
+// ScalingSignalsResponse defines the load signals of the nodes and the aggregated of cluster: the queued
+// downloads and throughput are summed, the bandwidth saturation is averaged and the p95 latency is the max
+type ScalingSignalsResponse struct {
+	APIMeta
+	Replicas int                `json:"replicas"`
+	Cluster  *LoadSignals       `json:"cluster"`
+	Nodes    []*NodeLoadSignals `json:"nodes"`
+}
+
+// UpstreamHealth defines the probed health of the original host(or replica) of registry mapping, the
+// Availability is the ratio of the recent probes succeeded
+type UpstreamHealth struct {
+	Registry            string    `json:"registry"`
+	Host                string    `json:"host"`
+	Healthy             bool      `json:"healthy"`
+	V2LatencyMs         int64     `json:"v2LatencyMs"`
+	TokenLatencyMs      int64     `json:"tokenLatencyMs,omitempty"`
+	Availability        float64   `json:"availability"`
+	ConsecutiveFailures int64     `json:"consecutiveFailures"`
+	LastProbe           time.Time `json:"lastProbe"`
+	LastError           string    `json:"lastError,omitempty"`
+}
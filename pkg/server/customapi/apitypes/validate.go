@@ -0,0 +1,204 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package apitypes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxHeaderCount the max number of headers replayed to original registry
+	maxHeaderCount = 64
+	// maxHeaderValueSize the max size of the values of one header
+	maxHeaderValueSize = 16 << 10
+)
+
+var digestRegexp = regexp.MustCompile(`^(sha256:)?[a-fA-F0-9]{64}$`)
+
+// hopHeaders the headers of client connection, they are not replayed to original registry
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Host",
+	"Content-Length",
+	"Expect",
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+}
+
+// transportHeaders the headers negotiated by the http client of master itself, the responses compressed
+// with the Accept-Encoding of client are not decoded by it
+var transportHeaders = []string{
+	"Accept-Encoding",
+}
+
+// sanitizeHeaders drops the headers of client connection, and checks the size of headers
+func sanitizeHeaders(headers map[string][]string) error {
+	if len(headers) > maxHeaderCount {
+		return fmt.Errorf("too many headers: %d", len(headers))
+	}
+	h := http.Header(headers)
+	for _, name := range h.Values("Connection") {
+		for _, field := range strings.Split(name, ",") {
+			h.Del(strings.TrimSpace(field))
+		}
+	}
+	for _, name := range append(hopHeaders, transportHeaders...) {
+		h.Del(name)
+	}
+	for name, values := range headers {
+		size := 0
+		for _, v := range values {
+			if strings.ContainsAny(v, "\r\n") {
+				return fmt.Errorf("header '%s' contains line break", name)
+			}
+			size += len(v)
+		}
+		if size > maxHeaderValueSize {
+			return fmt.Errorf("header '%s' too large: %d", name, size)
+		}
+	}
+	return nil
+}
+
+// sanitizeDigest validates the digest and trims its 'sha256:' prefix, the layers are located by the hex of
+// digest in lower case
+func sanitizeDigest(digest *string) error {
+	if !digestRegexp.MatchString(*digest) {
+		return fmt.Errorf("digest '%s' is invalid", *digest)
+	}
+	*digest = strings.ToLower(strings.TrimPrefix(*digest, "sha256:"))
+	return nil
+}
+
+// validateRegistryURI checks the uri is the path of original registry, it is joined with the original host
+// so it should not change the host
+func validateRegistryURI(name, uri string) error {
+	if !strings.HasPrefix(uri, "/") || strings.HasPrefix(uri, "//") || strings.ContainsAny(uri, "\\\r\n") {
+		return fmt.Errorf("%s '%s' is not the path of registry", name, uri)
+	}
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return fmt.Errorf("%s '%s' is invalid: %w", name, uri, err)
+	}
+	if u.Host != "" || u.Scheme != "" || path.Clean(u.Path) != strings.TrimSuffix(u.Path, "/") {
+		return fmt.Errorf("%s '%s' is not the path of registry", name, uri)
+	}
+	return nil
+}
+
+func validateOriginalHost(originalHost string) error {
+	if originalHost == "" {
+		return errors.New("originalHost cannot be empty")
+	}
+	if strings.ContainsAny(originalHost, "@?#\\ \r\n") || strings.Contains(originalHost, "://") {
+		return fmt.Errorf("originalHost '%s' is invalid", originalHost)
+	}
+	return nil
+}
+
+// validateFilePath checks the path is absolute and without traversal
+func validateFilePath(name, p string) error {
+	if p == "" || !path.IsAbs(p) || path.Clean(p) != p {
+		return fmt.Errorf("%s '%s' should be clean absolute path", name, p)
+	}
+	return nil
+}
+
+// Sanitize validates the request from peer and drops the headers not to be replayed to original registry
+func (req *GetServiceTokenRequest) Sanitize() error {
+	if err := validateOriginalHost(req.OriginalHost); err != nil {
+		return err
+	}
+	u, err := url.Parse(req.ServiceTokenUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return fmt.Errorf("serviceTokenUrl '%s' is invalid", req.ServiceTokenUrl)
+	}
+	if req.Service == "" || req.Scope == "" {
+		return errors.New("service and scope cannot be empty")
+	}
+	return sanitizeHeaders(req.Headers)
+}
+
+// Sanitize validates the request from peer and drops the headers not to be replayed to original registry
+func (req *HeadManifestRequest) Sanitize() error {
+	if err := validateOriginalHost(req.OriginalHost); err != nil {
+		return err
+	}
+	if err := validateRegistryURI("headManifestUrl", req.HeadManifestUrl); err != nil {
+		return err
+	}
+	return sanitizeHeaders(req.Headers)
+}
+
+// Sanitize validates the request from peer and drops the headers not to be replayed to original registry
+func (req *GetManifestRequest) Sanitize() error {
+	if err := validateOriginalHost(req.OriginalHost); err != nil {
+		return err
+	}
+	if err := validateRegistryURI("manifestUrl", req.ManifestUrl); err != nil {
+		return err
+	}
+	return sanitizeHeaders(req.Headers)
+}
+
+// Sanitize validates the request from peer and drops the headers not to be replayed to original registry
+func (req *DownloadLayerRequest) Sanitize() error {
+	if err := validateOriginalHost(req.OriginalHost); err != nil {
+		return err
+	}
+	if err := validateRegistryURI("layerUrl", req.LayerUrl); err != nil {
+		return err
+	}
+	if err := sanitizeDigest(&req.Digest); err != nil {
+		return err
+	}
+	if req.ContentLength < 0 {
+		return fmt.Errorf("contentLength '%d' is invalid", req.ContentLength)
+	}
+	for _, source := range req.FederationSources {
+		if source == nil || source.Cluster == "" {
+			return errors.New("federation source should have cluster")
+		}
+	}
+	return sanitizeHeaders(req.Headers)
+}
+
+// Sanitize validates the request from master
+func (req *CheckStaticLayerRequest) Sanitize() error {
+	if err := sanitizeDigest(&req.Digest); err != nil {
+		return err
+	}
+	if req.ExpectedContentLength < 0 {
+		return fmt.Errorf("expectedContentLength '%d' is invalid", req.ExpectedContentLength)
+	}
+	return validateFilePath("path", req.LayerPath)
+}
+
+// Sanitize validates the request from master
+func (req *CheckOCILayerRequest) Sanitize() error {
+	return sanitizeDigest(&req.Digest)
+}
+
+// Sanitize validates the request from master
+func (req *CancelDownloadLayerRequest) Sanitize() error {
+	return sanitizeDigest(&req.Digest)
+}
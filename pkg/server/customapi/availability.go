@@ -0,0 +1,241 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/containerd/platforms"
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/preheat"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// nodeAddressesKey the cache key of node name -> addresses listed from apiserver
+const nodeAddressesKey = "nodes"
+
+var (
+	// imageAvailabilities caches the availability of image by image and platform
+	imageAvailabilities = cache.New(time.Minute, time.Minute)
+	// nodeAddresses caches the addresses of nodes for the extender requests only with node names
+	nodeAddresses = cache.New(time.Minute, time.Minute)
+)
+
+// LayerAvailability returns the bytes of image 'image' cached on each node, it is used by the scheduling
+// to prefer the nodes already holding the layers
+func (h *CustomHandler) LayerAvailability(c *gin.Context) (interface{}, error) {
+	if !h.op().SchedulerExtender.Enable {
+		return nil, errors.Errorf("scheduler extender is not enabled")
+	}
+	image := c.Query("image")
+	if image == "" {
+		return nil, errors.Errorf("query param image is required")
+	}
+	resp, err := h.imageAvailability(c.Request.Context(), image)
+	if err != nil {
+		return nil, err
+	}
+	// the cached response is shared, the api version is set on the copy
+	result := *resp
+	return &result, nil
+}
+
+// SchedulerPrioritize implements the prioritize verb of kube-scheduler extender, the node scores by the
+// percentage of pod images bytes cached on it. The images failed to resolve are not counted.
+func (h *CustomHandler) SchedulerPrioritize(c *gin.Context) (interface{}, error) {
+	if !h.op().SchedulerExtender.Enable {
+		return nil, errors.Errorf("scheduler extender is not enabled")
+	}
+	args := &apitypes.ExtenderArgs{}
+	if err := c.ShouldBindJSON(args); err != nil {
+		return nil, errors.Wrapf(err, "parse extender args failed")
+	}
+	if args.Pod == nil {
+		return nil, errors.Errorf("extender args not have pod")
+	}
+	ctx := c.Request.Context()
+	nodes, err := h.extenderNodes(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalSize int64
+	cachedSize := make(map[string]int64)
+	for _, image := range podImages(args.Pod) {
+		avail, err := h.imageAvailability(ctx, image)
+		if err != nil {
+			logger.WarnContextf(ctx, "get availability of image '%s' for pod '%s/%s' failed: %s", image,
+				args.Pod.Namespace, args.Pod.Name, err.Error())
+			continue
+		}
+		totalSize += avail.TotalSize
+		for _, na := range avail.Nodes {
+			cachedSize[na.Node] += na.CachedSize
+		}
+	}
+	result := make([]*apitypes.HostPriority, 0, len(nodes))
+	for name, addresses := range nodes {
+		hp := &apitypes.HostPriority{Host: name}
+		if totalSize > 0 {
+			var cached int64
+			for _, addr := range addresses {
+				cached = max(cached, cachedSize[addr])
+			}
+			hp.Score = cached * apitypes.MaxExtenderPriority / totalSize
+		}
+		result = append(result, hp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Host < result[j].Host
+	})
+	return result, nil
+}
+
+// imageAvailability returns the availability of image, the result is cached for CacheTTL seconds
+func (h *CustomHandler) imageAvailability(ctx context.Context, image string) (*apitypes.LayerAvailabilityResponse,
+	error) {
+	conf := h.op().SchedulerExtender
+	platform := conf.Platform
+	if platform == "" {
+		platform = platforms.DefaultString()
+	}
+	key := image + "," + platform
+	if v, ok := imageAvailabilities.Get(key); ok {
+		return v.(*apitypes.LayerAvailabilityResponse), nil
+	}
+	spec, err := platforms.Parse(platform)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse platform '%s' failed", platform)
+	}
+	descs, err := preheat.ResolveImage(ctx, h.op(), image, platforms.Only(spec))
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve image '%s' failed", image)
+	}
+	resp := &apitypes.LayerAvailabilityResponse{
+		Image:    image,
+		Platform: platform,
+		Nodes:    make([]*apitypes.NodeAvailability, 0),
+	}
+	nodes := make(map[string]*apitypes.NodeAvailability)
+	counted := make(map[string]struct{}, len(descs))
+	for _, desc := range descs {
+		layer := desc.Digest.Encoded()
+		if _, ok := counted[layer]; ok {
+			continue
+		}
+		counted[layer] = struct{}{}
+		resp.Layers++
+		resp.TotalSize += desc.Size
+		staticLayers, ociLayers, err := h.cacheStore.QueryLayers(ctx, layer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query layer '%s' failed", layer)
+		}
+		located := make(map[string]struct{})
+		for _, l := range append(staticLayers, ociLayers...) {
+			located[l.Located] = struct{}{}
+		}
+		for node := range located {
+			na, ok := nodes[node]
+			if !ok {
+				na = &apitypes.NodeAvailability{Node: node}
+				nodes[node] = na
+				resp.Nodes = append(resp.Nodes, na)
+			}
+			na.CachedLayers++
+			na.CachedSize += desc.Size
+		}
+	}
+	for _, na := range resp.Nodes {
+		if resp.TotalSize > 0 {
+			na.Percent = float64(na.CachedSize) * 100 / float64(resp.TotalSize)
+		}
+	}
+	sort.Slice(resp.Nodes, func(i, j int) bool {
+		if resp.Nodes[i].CachedSize != resp.Nodes[j].CachedSize {
+			return resp.Nodes[i].CachedSize > resp.Nodes[j].CachedSize
+		}
+		return resp.Nodes[i].Node < resp.Nodes[j].Node
+	})
+	imageAvailabilities.Set(key, resp, time.Duration(conf.CacheTTL)*time.Second)
+	return resp, nil
+}
+
+// extenderNodes returns node name -> addresses of the extender args, the nodes are got from apiserver if
+// the scheduler only sends the node names
+func (h *CustomHandler) extenderNodes(ctx context.Context, args *apitypes.ExtenderArgs) (map[string][]string,
+	error) {
+	result := make(map[string][]string)
+	if args.Nodes != nil {
+		for i := range args.Nodes.Items {
+			result[args.Nodes.Items[i].Name] = nodeIPs(&args.Nodes.Items[i])
+		}
+		return result, nil
+	}
+	if args.NodeNames == nil {
+		return result, nil
+	}
+	all, err := h.listNodeAddresses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range *args.NodeNames {
+		result[name] = all[name]
+	}
+	return result, nil
+}
+
+func (h *CustomHandler) listNodeAddresses(ctx context.Context) (map[string][]string, error) {
+	if v, ok := nodeAddresses.Get(nodeAddressesKey); ok {
+		return v.(map[string][]string), nil
+	}
+	client := h.op().K8sClient()
+	if client == nil {
+		return nil, errors.Errorf("kubernetes client is not initialized")
+	}
+	nodeList, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{ResourceVersion: "0"})
+	if err != nil {
+		return nil, errors.Wrapf(err, "list nodes failed")
+	}
+	result := make(map[string][]string, len(nodeList.Items))
+	for i := range nodeList.Items {
+		result[nodeList.Items[i].Name] = nodeIPs(&nodeList.Items[i])
+	}
+	nodeAddresses.Set(nodeAddressesKey, result, time.Minute)
+	return result, nil
+}
+
+// nodeIPs returns the ip addresses of node, the layers are located by the host ip of accelerboat
+func nodeIPs(node *corev1.Node) []string {
+	result := make([]string, 0, len(node.Status.Addresses))
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP || addr.Type == corev1.NodeExternalIP {
+			result = append(result, addr.Address)
+		}
+	}
+	return result
+}
+
+// podImages returns the distinct images of the init containers and containers of pod
+func podImages(pod *corev1.Pod) []string {
+	result := make([]string, 0)
+	seen := make(map[string]struct{})
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, ctr := range containers {
+		if _, ok := seen[ctr.Image]; ok || ctr.Image == "" {
+			continue
+		}
+		seen[ctr.Image] = struct{}{}
+		result = append(result, ctr.Image)
+	}
+	return result
+}
@@ -8,7 +8,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
@@ -16,7 +15,9 @@ import (
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/pkg/logger"
 	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/peertls"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
 	"github.com/penglongli/accelerboat/pkg/utils/httpfile"
 )
 
@@ -24,10 +25,19 @@ import (
 // used by master when resolving layer location.
 func (h *CustomHandler) CheckStaticLayer(c *gin.Context) (interface{}, error) {
 	req := &apitypes.CheckStaticLayerRequest{}
-	if err := c.ShouldBindJSON(req); err != nil {
-		return nil, errors.Wrapf(err, "parse request failed")
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
 	}
-	fileSize, err := checkLocalLayer(req.LayerPath)
+	return h.checkStaticLayer(c.Request.Context(), req)
+}
+
+func (h *CustomHandler) checkStaticLayer(ctx context.Context, req *apitypes.CheckStaticLayerRequest) (
+	*apitypes.CheckStaticLayerResponse, error) {
+	layerPath, err := h.resolveLayerFile(req.LayerPath)
+	if err != nil {
+		return nil, err
+	}
+	fileSize, err := checkLocalLayer(layerPath)
 	if err != nil {
 		return nil, errors.Wrapf(err, "check local layer failed")
 	}
@@ -36,33 +46,29 @@ func (h *CustomHandler) CheckStaticLayer(c *gin.Context) (interface{}, error) {
 			req.LayerPath, fileSize, req.ExpectedContentLength)
 	}
 	resp := &apitypes.CheckStaticLayerResponse{
-		Located:   h.op.Address,
+		Located:   h.op().Address,
 		LayerPath: req.LayerPath,
 		FileSize:  fileSize,
 	}
-	if !h.op.TorrentConfig.Enable || fileSize < h.op.TorrentConfig.Threshold*options.MB {
+	if !h.op().TorrentConfig.Enable || fileSize < h.op().TorrentConfig.Threshold*options.MB {
 		return resp, nil
 	}
 
-	ctx := c.Request.Context()
-	timeoutCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-	torrentBase64, err := h.torrentHandler.GenerateTorrent(timeoutCtx, req.Digest, req.LayerPath)
-	if err != nil {
-		logger.ErrorContextf(ctx, "generate torrent for '%s' failed: %s", req.LayerPath, err.Error())
-	} else {
-		resp.TorrentBase64 = torrentBase64
-	}
+	resp.TorrentBase64, resp.TorrentPending = h.torrentHandler.RequestTorrent(ctx, req.Digest, layerPath)
 	return resp, nil
 }
 
 // CheckOCILayer generates an OCI layer on demand and returns its location/size; used by master when resolving OCI layer location.
 func (h *CustomHandler) CheckOCILayer(c *gin.Context) (interface{}, error) {
 	req := &apitypes.CheckOCILayerRequest{}
-	if err := c.ShouldBindJSON(req); err != nil {
-		return nil, errors.Wrapf(err, "parse request failed")
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
 	}
-	ctx := c.Request.Context()
+	return h.checkOCILayer(c.Request.Context(), req)
+}
+
+func (h *CustomHandler) checkOCILayer(ctx context.Context, req *apitypes.CheckOCILayerRequest) (
+	*apitypes.CheckOCILayerResponse, error) {
 	layerPath, err := h.ociScanner.GenerateLayer(ctx, req.OCIType, req.Digest)
 	if err != nil {
 		return nil, errors.Wrapf(err, "generate oci layer failed")
@@ -72,36 +78,59 @@ func (h *CustomHandler) CheckOCILayer(c *gin.Context) (interface{}, error) {
 		return nil, errors.Wrapf(err, "stat oc-layer '%s' failed", layerPath)
 	}
 
-	return &apitypes.CheckOCILayerResponse{
-		// TODO: Currently, OCI layers are not being transferred using the BitTorrent protocol,
-		// but rather via direct TCP transfer. We may consider using the BitTorrent protocol in the future.
-		TorrentBase64: "",
-		Located:       h.op.Address,
-		LayerPath:     layerPath,
-		FileSize:      fi.Size(),
-	}, nil
+	resp := &apitypes.CheckOCILayerResponse{
+		Located:   h.op().Address,
+		LayerPath: layerPath,
+		FileSize:  fi.Size(),
+	}
+	// the torrents of OCI layers are not generated on demand, only the ones seeded at startup are
+	// returned, other layers are transferred with tcp
+	if h.op().TorrentConfig.Enable && fi.Size() >= h.op().TorrentConfig.Threshold*options.MB {
+		if to, torrentBase64 := h.torrentHandler.CheckTorrentLocalExist(ctx, req.Digest); to != nil {
+			resp.TorrentBase64 = torrentBase64
+		}
+	}
+	return resp, nil
 }
 
 // TransferLayerTCP serves a layer file over HTTP (query param file=path); used for direct TCP transfer between nodes.
 func (h *CustomHandler) TransferLayerTCP(c *gin.Context) (interface{}, error) {
+	if h.op().PeerTLS.Enable && !peertls.IsPeerRequest(c.Request) {
+		return nil, errors.Errorf("layer transfer is only served on the peer tls port")
+	}
 	requestFile := c.Query("file")
 	if requestFile == "" {
 		return nil, errors.Errorf("query param 'file' cannot be empty")
 	}
+	requestFile, err := h.resolveLayerFile(requestFile)
+	if err != nil {
+		return nil, err
+	}
 	ctx := c.Request.Context()
-	var fileSize int64
-	if fi, err := os.Stat(requestFile); err == nil && !fi.IsDir() {
-		fileSize = fi.Size()
+	size, err := httpfile.ServeLayer(ctx, c.Writer, c.Request, requestFile, h.op().TransferConfig.Compression)
+	if size > 0 {
+		metrics.TransferSize.WithLabelValues("serve_blob_by_tcp").Add(float64(size) / 1e9)
 	}
-	if err := httpfile.HTTPServeFile(ctx, c.Writer, c.Request, requestFile); err != nil {
+	if err != nil && !c.Writer.Written() {
 		return nil, err
 	}
-	if fileSize > 0 {
-		metrics.TransferSize.WithLabelValues("serve_blob_by_tcp").Add(float64(fileSize) / 1e9)
+	if err != nil {
+		logger.WarnContextf(ctx, "transfer layer '%s' broken: %s", requestFile, err.Error())
 	}
 	return nil, nil
 }
 
+// resolveLayerFile returns the real path of the layer file requested by peers, the files not under the
+// layer directories of storage are rejected. It is shared by the check and transfer endpoints of HTTP
+// and gRPC.
+func (h *CustomHandler) resolveLayerFile(filePath string) (string, error) {
+	realPath, err := utils.ResolveFileUnder(filePath, h.op().StorageConfig.LayerDirs()...)
+	if err != nil {
+		return "", errors.Wrapf(err, "layer file '%s' is not allowed", filePath)
+	}
+	return realPath, nil
+}
+
 func checkLocalLayer(filePath string) (int64, error) {
 	fi, err := os.Stat(filePath)
 	if err != nil {
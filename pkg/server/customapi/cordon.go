@@ -0,0 +1,47 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// Drain cordons this node before maintenance, the master does not assign downloads to it and its layers
+// are not returned to the other nodes. The node still serves its local clients.
+func (h *CustomHandler) Drain(c *gin.Context) (interface{}, error) {
+	ctx := c.Request.Context()
+	if err := h.cacheStore.CordonNode(ctx, h.op().Address); err != nil {
+		return nil, errors.Wrapf(err, "cordon node '%s' failed", h.op().Address)
+	}
+	logger.InfoContextf(ctx, "node '%s' cordoned", h.op().Address)
+	return h.cordonState(c)
+}
+
+// Uncordon removes the cordon of this node
+func (h *CustomHandler) Uncordon(c *gin.Context) (interface{}, error) {
+	ctx := c.Request.Context()
+	if err := h.cacheStore.UncordonNode(ctx, h.op().Address); err != nil {
+		return nil, errors.Wrapf(err, "uncordon node '%s' failed", h.op().Address)
+	}
+	logger.InfoContextf(ctx, "node '%s' uncordoned", h.op().Address)
+	return h.cordonState(c)
+}
+
+func (h *CustomHandler) cordonState(c *gin.Context) (*apitypes.NodeCordonResponse, error) {
+	cordoned, err := h.cacheStore.CordonedNodes(c.Request.Context())
+	if err != nil {
+		return nil, errors.Wrapf(err, "query cordoned nodes failed")
+	}
+	resp := &apitypes.NodeCordonResponse{Node: h.op().Address}
+	if since, ok := cordoned[h.op().Address]; ok {
+		resp.Cordoned = true
+		resp.Since = &since
+	}
+	return resp, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"net"
+
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/pullsecret"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// dockerHubDomain the domain of docker hub images, its registry mapping is on registry-1.docker.io
+const dockerHubDomain = "docker.io"
+
+// RegistryCredential returns the credentials of the registry mapping of query 'image' for the kubelet
+// credential provider on this node. The credentials are keyed by the proxy host and original host, so the
+// pulls from both are authorized.
+func (h *CustomHandler) RegistryCredential(c *gin.Context) (interface{}, error) {
+	op := options.GlobalOptions()
+	if !op.KubeletCredential.Enable {
+		return nil, errors.Errorf("kubelet credential is not enabled")
+	}
+	if ip := net.ParseIP(c.RemoteIP()); ip == nil || !ip.IsLoopback() {
+		return nil, errors.Errorf("registry credential is only served to loopback clients")
+	}
+	image := c.Query("image")
+	if image == "" {
+		return nil, errors.Errorf("query param image is required")
+	}
+	named, err := docker.ParseDockerRef(image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse image '%s' failed", image)
+	}
+	domain := docker.Domain(named)
+	if domain == dockerHubDomain {
+		domain = "registry-1.docker.io"
+	}
+	resp := &apitypes.RegistryCredentialResponse{
+		CacheDuration: op.KubeletCredential.CacheDuration,
+		Auths:         make(map[string]*apitypes.RegistryAuth),
+	}
+	for _, mp := range op.ExternalConfig.RegistryMappings {
+		if domain != mp.ProxyHost && domain != mp.OriginalHost && domain != mp.OriginalHostname() {
+			continue
+		}
+		auth := mappingCredential(mp)
+		if auth == nil {
+			break
+		}
+		for _, host := range []string{mp.ProxyHost, mp.OriginalHostname(), docker.Domain(named)} {
+			if host != "" {
+				resp.Auths[host] = auth
+			}
+		}
+		break
+	}
+	return resp, nil
+}
+
+// mappingCredential returns the first credential of registry mapping, the configured users first and then
+// the users imported from pull secrets
+func mappingCredential(mp *options.RegistryMapping) *apitypes.RegistryAuth {
+	users := append(append([]*options.RegistryAuth{}, mp.LegalUsers...), pullsecret.Credentials(mp)...)
+	for _, user := range users {
+		if user != nil && user.Username != "" {
+			return &apitypes.RegistryAuth{Username: user.Username, Password: user.Password}
+		}
+	}
+	return nil
+}
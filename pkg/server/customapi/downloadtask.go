@@ -0,0 +1,149 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/requester"
+)
+
+// downloadTask defines the layer downloading from original registry on this node, the written bytes
+// are counted to decide whether it is completed anyway when canceled
+type downloadTask struct {
+	cancel  context.CancelFunc
+	written atomic.Int64
+	total   atomic.Int64
+}
+
+// Write counts the downloaded bytes
+func (t *downloadTask) Write(p []byte) (int, error) {
+	t.written.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// progress returns the downloaded percent, 0 if the content length is unknown yet
+func (t *downloadTask) progress() float64 {
+	total := t.total.Load()
+	if total <= 0 {
+		return 0
+	}
+	return float64(t.written.Load()) / float64(total) * 100
+}
+
+type downloadTasks struct {
+	sync.Mutex
+	tasks map[string]*downloadTask
+}
+
+func newDownloadTasks() *downloadTasks {
+	return &downloadTasks{tasks: make(map[string]*downloadTask)}
+}
+
+func (dt *downloadTasks) add(digest string, task *downloadTask) {
+	dt.Lock()
+	defer dt.Unlock()
+	dt.tasks[digest] = task
+}
+
+func (dt *downloadTasks) remove(digest string, task *downloadTask) {
+	dt.Lock()
+	defer dt.Unlock()
+	if dt.tasks[digest] == task {
+		delete(dt.tasks, digest)
+	}
+}
+
+func (dt *downloadTasks) get(digest string) *downloadTask {
+	dt.Lock()
+	defer dt.Unlock()
+	return dt.tasks[digest]
+}
+
+// cancelDownloadTask cancels the downloading of layer unless its progress reached the complete threshold.
+// Returns whether it is canceled and the progress.
+func (h *CustomHandler) cancelDownloadTask(ctx context.Context, digest, reason string) (bool, float64) {
+	task := h.downloadTasks.get(digest)
+	if task == nil {
+		return false, 0
+	}
+	progress := task.progress()
+	if progress >= float64(h.op().DownloadCancel.CompleteThreshold) {
+		logger.InfoContextf(ctx, "layer download is not canceled(%s) because of progress %.2f%%", reason,
+			progress)
+		metrics.DownloadCancelTotal.WithLabelValues("completed_anyway").Inc()
+		return false, progress
+	}
+	task.cancel()
+	logger.WarnContextf(ctx, "layer download is canceled(%s) with progress %.2f%%", reason, progress)
+	metrics.DownloadCancelTotal.WithLabelValues("canceled").Inc()
+	return true, progress
+}
+
+// downloadLayerDetached downloads the layer detached from the request, so that it is completed to be
+// cached even if the clients are disconnected. If download cancel enabled, it is canceled when the
+// request is done or canceled by master, unless its progress reached the complete threshold.
+func (h *CustomHandler) downloadLayerDetached(ctx context.Context, req *apitypes.DownloadLayerRequest,
+	destPath string) error {
+	downloadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	task := &downloadTask{cancel: cancel}
+	h.downloadTasks.add(req.Digest, task)
+	defer h.downloadTasks.remove(req.Digest, task)
+	if h.op().DownloadCancel.Enable {
+		stop := context.AfterFunc(ctx, func() {
+			h.cancelDownloadTask(downloadCtx, req.Digest, "request done")
+		})
+		defer stop()
+	}
+	if err := h.downloadLayer(downloadCtx, req, destPath); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		logger.InfoContextf(ctx, "layer download completed after request done")
+	}
+	return nil
+}
+
+// cancelDistributedDownload requests the node to cancel the downloading of layer, the request context is
+// done already so it is detached
+func (h *CustomHandler) cancelDistributedDownload(ctx context.Context, target, digest string) {
+	if !requester.NodeSupports(ctx, target, apitypes.CapabilityDownloadCancel) {
+		logger.InfoContextf(ctx, "node '%s' does not support download cancel, keep downloading", target)
+		return
+	}
+	cancelCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	resp, err := requester.CancelDownloadLayer(cancelCtx, target, &apitypes.CancelDownloadLayerRequest{
+		Digest: digest,
+	})
+	if err != nil {
+		logger.WarnContextf(ctx, "cancel layer download on node '%s' failed: %s", target, err.Error())
+		return
+	}
+	logger.InfoContextf(ctx, "cancel layer download on node '%s', canceled: %t, progress: %.2f%%", target,
+		resp.Canceled, resp.Progress)
+}
+
+// CancelDownloadLayer handles the request of master to cancel the layer downloading on this node
+func (h *CustomHandler) CancelDownloadLayer(c *gin.Context) (interface{}, error) {
+	req := &apitypes.CancelDownloadLayerRequest{}
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
+	}
+	if !h.op().DownloadCancel.Enable {
+		return &apitypes.CancelDownloadLayerResponse{}, nil
+	}
+	canceled, progress := h.cancelDownloadTask(c.Request.Context(), req.Digest, "canceled by master")
+	return &apitypes.CancelDownloadLayerResponse{Canceled: canceled, Progress: progress}, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/estargz"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+// EstargzLayer returns the eStargz layer of query 'digest'(original or converted), the TOC of converted
+// layer is returned with query 'toc=true' if it is cached on this node. The TOC digest is used to build
+// the manifests referencing the converted layers(annotation containerd.io/snapshot/stargz/toc.digest).
+func (h *CustomHandler) EstargzLayer(c *gin.Context) (interface{}, error) {
+	if !h.op().Estargz.Enable {
+		return nil, errors.Errorf("estargz is not enabled")
+	}
+	digest := strings.TrimPrefix(c.Query("digest"), "sha256:")
+	if digest == "" {
+		return nil, errors.Errorf("query param 'digest' cannot be empty")
+	}
+	ctx := c.Request.Context()
+	layer, err := h.cacheStore.GetEstargzLayer(ctx, digest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "query estargz layer '%s' failed", digest)
+	}
+	if layer == nil {
+		return nil, errors.Errorf("layer '%s' not converted to estargz", digest)
+	}
+	resp := &apitypes.EstargzLayerResponse{Layer: layer}
+	if c.Query("toc") != "true" {
+		return resp, nil
+	}
+	file := path.Join(h.op().StorageConfig.TransferPath, utils.LayerFileName(layer.Converted))
+	toc, _, err := estargz.ReadTOC(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read toc of estargz layer '%s' failed", layer.Converted)
+	}
+	resp.TOC = toc
+	return resp, nil
+}
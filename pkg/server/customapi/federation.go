@@ -0,0 +1,258 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/federation"
+	"github.com/penglongli/accelerboat/pkg/layerscan"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/peertls"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/requester"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+// fetchLayerFromFederation requests the gateway node to download the layer from the other clusters which
+// have it, used by master before downloading from original registry
+func (h *CustomHandler) fetchLayerFromFederation(ctx context.Context, req *apitypes.DownloadLayerRequest,
+	contentLength int64) (*apitypes.DownloadLayerResponse, error) {
+	clusters, err := h.federation.QueryClusters(ctx, req.Digest)
+	if err != nil {
+		metrics.FederationLayerTotal.WithLabelValues("failed").Inc()
+		return nil, err
+	}
+	if len(clusters) == 0 {
+		metrics.FederationLayerTotal.WithLabelValues("miss").Inc()
+		return nil, errors.Errorf("not found layer in other clusters")
+	}
+	fedReq := *req
+	fedReq.ContentLength = contentLength
+	fedReq.FederationSources = make([]*apitypes.FederationSource, 0, len(clusters))
+	for _, cluster := range clusters {
+		fedReq.FederationSources = append(fedReq.FederationSources, &apitypes.FederationSource{
+			Cluster: cluster.Name,
+		})
+	}
+	gateway := h.federation.GatewayNode()
+	logger.InfoContextf(ctx, "request gateway '%s' to download layer from %d clusters", gateway, len(clusters))
+	resp, err := requester.FederationDownloadLayer(ctx, gateway, &fedReq)
+	if err != nil {
+		metrics.FederationLayerTotal.WithLabelValues("failed").Inc()
+		return nil, err
+	}
+	metrics.FederationLayerTotal.WithLabelValues("hit").Inc()
+	return resp, nil
+}
+
+// FederationDownloadLayer handles the request of master on gateway node, downloads the layer from the
+// other clusters in order
+func (h *CustomHandler) FederationDownloadLayer(c *gin.Context) (interface{}, error) {
+	if h.federation == nil {
+		return nil, errors.Errorf("federation not enabled")
+	}
+	req := &apitypes.DownloadLayerRequest{}
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
+	}
+	if err := h.checkOriginalHost(req.OriginalHost); err != nil {
+		return nil, err
+	}
+	if len(req.FederationSources) == 0 {
+		return nil, errors.Errorf("federation sources cannot be empty")
+	}
+	ctx := c.Request.Context()
+	// the gateways of clusters are resolved from the registered clusters, the endpoints of request are
+	// not trusted to receive the federation token
+	clusters, err := h.federation.QueryClusters(ctx, req.Digest)
+	if err != nil {
+		return nil, err
+	}
+	registered := make(map[string]*federation.Cluster, len(clusters))
+	for _, cluster := range clusters {
+		registered[cluster.Name] = cluster
+	}
+	resultPath := path.Join(h.op().StorageConfig.TransferPath, utils.LayerFileName(req.Digest))
+	err = errors.Errorf("no registered cluster has the layer")
+	for _, source := range req.FederationSources {
+		cluster, ok := registered[source.Cluster]
+		if !ok {
+			logger.WarnContextf(ctx, "cluster '%s' not registered with the layer", source.Cluster)
+			continue
+		}
+		if err = h.downloadLayerFromCluster(ctx, cluster, req, resultPath); err == nil {
+			break
+		}
+		logger.WarnContextf(ctx, "download layer from cluster '%s' failed: %s", cluster.Name, err.Error())
+		if errors.Is(err, apitypes.ErrLayerBlocked) {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "download layer from %d clusters failed", len(req.FederationSources))
+	}
+	return h.buildDownloadLayerResponse(ctx, req.Digest, resultPath)
+}
+
+// downloadLayerFromCluster downloads the layer from the gateway of other cluster, the content is verified
+// with the digest before moving to destPath
+func (h *CustomHandler) downloadLayerFromCluster(ctx context.Context, cluster *federation.Cluster,
+	req *apitypes.DownloadLayerRequest, destPath string) error {
+	query := url.Values{}
+	query.Set("digest", req.Digest)
+	query.Set("contentLength", strconv.FormatInt(req.ContentLength, 10))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		cluster.Gateway+apitypes.APIFederationLayer+"?"+query.Encode(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "create http.request failed")
+	}
+	h.federation.SetHeaders(httpReq)
+	logger.InfoContextf(ctx, "starting download layer from cluster '%s'", cluster.Name)
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return errors.Wrapf(err, "request gateway '%s' failed", cluster.Gateway)
+	}
+	defer resp.Body.Close()
+	layerFullPath := path.Join(h.op().StorageConfig.DownloadPath, utils.LayerFileName(req.Digest))
+	size, err := h.fetchVerifiedLayer(resp, req.Digest, layerFullPath)
+	if err != nil {
+		return errors.Wrapf(err, "download layer from gateway '%s' failed", cluster.Gateway)
+	}
+	if err = h.promoteLayer(ctx, &layerscan.Layer{Digest: req.Digest, Path: layerFullPath,
+		Registry: req.OriginalHost, Repo: req.Repo}, destPath); err != nil {
+		return err
+	}
+	metrics.TransferSize.WithLabelValues("download_federation").Add(float64(size) / 1e9)
+	logger.InfoContextf(ctx, "download layer '%s' from cluster '%s' successfully", destPath, cluster.Name)
+	return nil
+}
+
+// fetchVerifiedLayer writes the layer responded into layerFullPath, the content is verified with the digest
+// and the file is removed if failed
+func (h *CustomHandler) fetchVerifiedLayer(resp *http.Response, digest, layerFullPath string) (int64, error) {
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return 0, errors.Errorf("resp code not 200 but %d: %s", resp.StatusCode, string(bs))
+	}
+	_ = os.RemoveAll(layerFullPath)
+	layer, err := os.OpenFile(layerFullPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, h.op().StorageConfig.FilePerm())
+	if err != nil {
+		return 0, errors.Wrapf(err, "create layer file '%s' failed", layerFullPath)
+	}
+	defer layer.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(layer, hasher), resp.Body)
+	if err != nil {
+		_ = os.RemoveAll(layerFullPath)
+		return 0, errors.Wrapf(err, "io copy failed")
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != digest {
+		_ = os.RemoveAll(layerFullPath)
+		return 0, errors.Errorf("layer digest '%s' not same as expected '%s'", actual, digest)
+	}
+	return size, nil
+}
+
+// FederationLayer serves the layer cached in cluster to the gateway of other cluster, the speed is limited
+// by the bandwidth of every requesting cluster
+func (h *CustomHandler) FederationLayer(c *gin.Context) (interface{}, error) {
+	if h.federation == nil {
+		return nil, errors.Errorf("federation not enabled")
+	}
+	cluster, err := h.federation.Authorize(c.Request)
+	if err != nil {
+		return nil, err
+	}
+	digest := c.Query("digest")
+	if digest == "" {
+		return nil, errors.Errorf("query param 'digest' cannot be empty")
+	}
+	contentLength, err := strconv.ParseInt(c.Query("contentLength"), 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse query param 'contentLength' failed")
+	}
+	ctx := c.Request.Context()
+	located, err := h.locateFederationLayer(ctx, digest, contentLength)
+	if err != nil {
+		return nil, err
+	}
+	body, err := h.openLocatedLayer(ctx, located)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	c.Header("Content-Length", strconv.FormatInt(located.FileSize, 10))
+	c.Status(http.StatusOK)
+	size, err := io.Copy(h.federation.LimitWriter(ctx, cluster, c.Writer), body)
+	if err != nil {
+		logger.ErrorContextf(ctx, "serve layer to cluster '%s' failed: %s", cluster, err.Error())
+	} else {
+		logger.InfoContextf(ctx, "serve layer to cluster '%s' success", cluster)
+	}
+	metrics.TransferSize.WithLabelValues("serve_federation").Add(float64(size) / 1e9)
+	return nil, nil
+}
+
+func (h *CustomHandler) locateFederationLayer(ctx context.Context, digest string, contentLength int64) (
+	*apitypes.DownloadLayerResponse, error) {
+	h.downloadLayerLock.Lock(ctx, digest)
+	defer h.downloadLayerLock.UnLock(ctx, digest)
+	resp, err := h.checkLayerHasCached(ctx, &apitypes.DownloadLayerRequest{Digest: digest}, contentLength)
+	if err != nil {
+		return nil, errors.Wrapf(err, "check layer has cached failed")
+	}
+	return resp, nil
+}
+
+// openLocatedLayer opens the layer file of local, or requests the located node with tcp
+func (h *CustomHandler) openLocatedLayer(ctx context.Context, located *apitypes.DownloadLayerResponse) (
+	io.ReadCloser, error) {
+	if located.Located == h.op().Address {
+		f, err := os.Open(located.FilePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open layer file '%s' failed", located.FilePath)
+		}
+		return f, nil
+	}
+	client := http.DefaultClient
+	transferURL := fmt.Sprintf("http://%s:%d%s", located.Located, h.op().HTTPPort, apitypes.APITransferLayerTCP)
+	if h.op().PeerTLS.Enable {
+		if err := peertls.Global.VerifyPeer(located.Located); err != nil {
+			return nil, errors.Wrapf(err, "verify peer failed")
+		}
+		client = peertls.Global.Client()
+		transferURL = fmt.Sprintf("https://%s:%d%s", located.Located, h.op().PeerTLS.Port,
+			apitypes.APITransferLayerTCP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		transferURL+"?"+url.Values{"file": []string{located.FilePath}}.Encode(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create http.request failed")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request layer from node '%s' failed", located.Located)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("request layer from node '%s' resp code not 200 but %d", located.Located,
+			resp.StatusCode)
+	}
+	return resp.Body, nil
+}
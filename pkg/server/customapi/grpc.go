@@ -0,0 +1,219 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/common"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/nodepb"
+)
+
+// transferChunkSize the max bytes of one chunk when streaming the layer with gRPC
+const transferChunkSize = 256 << 10
+
+// nodeService implements the gRPC internal API with the same handling of HTTP endpoints
+type nodeService struct {
+	nodepb.UnimplementedNodeServiceServer
+	h *CustomHandler
+}
+
+// RegisterGRPC registers the gRPC internal API on the server
+func (h *CustomHandler) RegisterGRPC(s *grpc.Server) {
+	nodepb.RegisterNodeServiceServer(s, &nodeService{h: h})
+}
+
+// GRPCServerOptions returns the interceptors which set the request-id of caller into context
+func GRPCServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			return handler(grpcRequestContext(ctx), req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo,
+			handler grpc.StreamHandler) error {
+			return handler(srv, &requestContextStream{ServerStream: ss, ctx: grpcRequestContext(ss.Context())})
+		}),
+	}
+}
+
+func grpcRequestContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(common.RequestIDHeaderKey); len(values) != 0 && values[0] != "" {
+		return logger.WithContextFields(ctx, common.RequestIDHeaderKey, values[0])
+	}
+	return ctx
+}
+
+type requestContextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context with request-id
+func (s *requestContextStream) Context() context.Context {
+	return s.ctx
+}
+
+// GetServiceToken implements nodepb.NodeServiceServer
+func (s *nodeService) GetServiceToken(ctx context.Context, req *nodepb.GetServiceTokenRequest) (
+	*nodepb.GetServiceTokenResponse, error) {
+	if err := s.h.checkMaster(); err != nil {
+		return nil, apitypes.ToGRPCError(err)
+	}
+	r := apitypes.GetServiceTokenRequestFromProto(req)
+	if err := r.Sanitize(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.h.checkServiceTokenURL(r.OriginalHost, r.ServiceTokenUrl); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	token, err := s.h.getServiceToken(ctx, r)
+	if err != nil {
+		return nil, apitypes.ToGRPCError(err)
+	}
+	return token.ToProto(), nil
+}
+
+// GetManifest implements nodepb.NodeServiceServer
+func (s *nodeService) GetManifest(ctx context.Context, req *nodepb.GetManifestRequest) (
+	*nodepb.GetManifestResponse, error) {
+	if err := s.h.checkMaster(); err != nil {
+		return nil, apitypes.ToGRPCError(err)
+	}
+	r := apitypes.GetManifestRequestFromProto(req)
+	if err := r.Sanitize(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.h.checkOriginalHost(r.OriginalHost); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	manifest, err := s.h.getManifest(ctx, r)
+	if err != nil {
+		return nil, apitypes.ToGRPCError(err)
+	}
+	return &nodepb.GetManifestResponse{Manifest: manifest}, nil
+}
+
+// GetLayerInfo implements nodepb.NodeServiceServer
+func (s *nodeService) GetLayerInfo(ctx context.Context, req *nodepb.GetLayerInfoRequest) (*nodepb.LayerInfo,
+	error) {
+	if err := s.h.checkMaster(); err != nil {
+		return nil, apitypes.ToGRPCError(err)
+	}
+	r := apitypes.DownloadLayerRequestFromProto(req)
+	if err := r.Sanitize(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.h.checkOriginalHost(r.OriginalHost); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	resp, err := s.h.getLayerInfo(ctx, r)
+	if err != nil {
+		return nil, apitypes.ToGRPCError(err)
+	}
+	return resp.ToProto(), nil
+}
+
+// CheckStaticLayer implements nodepb.NodeServiceServer
+func (s *nodeService) CheckStaticLayer(ctx context.Context, req *nodepb.CheckStaticLayerRequest) (
+	*nodepb.LayerInfo, error) {
+	r := apitypes.CheckStaticLayerRequestFromProto(req)
+	if err := r.Sanitize(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp, err := s.h.checkStaticLayer(ctx, r)
+	if err != nil {
+		return nil, apitypes.ToGRPCError(err)
+	}
+	return resp.ToProto(), nil
+}
+
+// CheckOCILayer implements nodepb.NodeServiceServer
+func (s *nodeService) CheckOCILayer(ctx context.Context, req *nodepb.CheckOCILayerRequest) (*nodepb.LayerInfo,
+	error) {
+	r := apitypes.CheckOCILayerRequestFromProto(req)
+	if err := r.Sanitize(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp, err := s.h.checkOCILayer(ctx, r)
+	if err != nil {
+		return nil, apitypes.ToGRPCError(err)
+	}
+	return resp.ToProto(), nil
+}
+
+// TransferLayer implements nodepb.NodeServiceServer, streams the layer file from offset in chunks
+func (s *nodeService) TransferLayer(req *nodepb.TransferLayerRequest,
+	stream grpc.ServerStreamingServer[nodepb.LayerChunk]) error {
+	if req.GetFilePath() == "" {
+		return status.Error(codes.InvalidArgument, "file path cannot be empty")
+	}
+	filePath, err := s.h.resolveLayerFile(req.GetFilePath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return status.Errorf(codes.NotFound, "layer file '%s' not found", req.GetFilePath())
+		}
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return status.Errorf(codes.NotFound, "layer file '%s' not found", req.GetFilePath())
+		}
+		return status.Errorf(codes.Internal, "open layer file '%s' failed: %s", req.GetFilePath(), err.Error())
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return status.Errorf(codes.NotFound, "layer file '%s' not found", req.GetFilePath())
+	}
+	offset := req.GetOffset()
+	if offset < 0 || offset >= fi.Size() {
+		return status.Errorf(codes.OutOfRange, "offset %d out of file size %d", offset, fi.Size())
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return status.Errorf(codes.Internal, "seek layer file failed: %s", err.Error())
+	}
+	ctx := stream.Context()
+	buf := make([]byte, transferChunkSize)
+	var sent int64
+	defer func() {
+		metrics.TransferSize.WithLabelValues("serve_blob_by_grpc").Add(float64(sent) / 1e9)
+	}()
+	for {
+		n, readErr := f.Read(buf)
+		if n > 0 {
+			chunk := &nodepb.LayerChunk{Data: buf[:n]}
+			if sent == 0 {
+				chunk.FileSize = fi.Size()
+			}
+			if err = stream.Send(chunk); err != nil {
+				logger.WarnContextf(ctx, "transfer layer '%s' with grpc broken: %s", req.GetFilePath(),
+					err.Error())
+				return err
+			}
+			sent += int64(n)
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return status.Errorf(codes.Internal, "read layer file failed: %s", readErr.Error())
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// imagesSeenDaysDefault the default days of images seen to query
+const imagesSeenDaysDefault = 7
+
+// ImagesSeen returns the images pulled through the proxies of cluster in the last 'days' days, the result
+// can be filtered by 'registry' and 'repo'(substring)
+func (h *CustomHandler) ImagesSeen(c *gin.Context) (interface{}, error) {
+	if !h.op().ImageIndex.Enable {
+		return nil, errors.Errorf("image index is not enabled")
+	}
+	days := imagesSeenDaysDefault
+	if s := c.Query("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid query param days '%s'", s)
+		}
+		days = n
+	}
+	since := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	images, err := h.cacheStore.ImagesSeen(c.Request.Context(), since)
+	if err != nil {
+		return nil, errors.Wrapf(err, "query images seen failed")
+	}
+	registry := c.Query("registry")
+	repo := c.Query("repo")
+	resp := &apitypes.ImagesSeenResponse{
+		Since:  since,
+		Images: make([]*apitypes.ImageSeen, 0, len(images)),
+	}
+	for _, img := range images {
+		if registry != "" && img.Registry != registry {
+			continue
+		}
+		if repo != "" && !strings.Contains(img.Repo, repo) {
+			continue
+		}
+		resp.Images = append(resp.Images, img)
+	}
+	return resp, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/layerscan"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/peertls"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+var digestRegexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// ImportLayer saves the layer uploaded in request body (query param digest=sha256:xxx) into the transfer path,
+// and registers it into the cache store. It is used to seed the cluster cache for air-gapped environments.
+// The layer is only accepted from loopback or the nodes of cluster, and the body is read up to the declared
+// content-length.
+func (h *CustomHandler) ImportLayer(c *gin.Context) (interface{}, error) {
+	if !isLoopbackOrPeer(c) {
+		return nil, errors.Errorf("import layer is only served to loopback or cluster nodes")
+	}
+	if c.Request.ContentLength <= 0 {
+		return nil, errors.Errorf("import layer requires the content-length of layer")
+	}
+	digest := strings.TrimPrefix(c.Query("digest"), "sha256:")
+	if !digestRegexp.MatchString(digest) {
+		return nil, errors.Errorf("query param 'digest' '%s' is invalid", c.Query("digest"))
+	}
+	ctx := logger.WithContextFields(c.Request.Context(), "digest", digest)
+	resultPath := path.Join(h.op().StorageConfig.TransferPath, utils.LayerFileName(digest))
+	if fi, err := os.Stat(resultPath); err == nil && !fi.IsDir() {
+		logger.InfoContextf(ctx, "import layer '%s' already exists", resultPath)
+		if err = h.cacheStore.SaveStaticLayer(ctx, digest, resultPath, true); err != nil {
+			return nil, errors.Wrapf(err, "save static layer '%s' failed", resultPath)
+		}
+		return &apitypes.ImportLayerResponse{
+			Located:  h.op().Address,
+			FilePath: resultPath,
+			FileSize: fi.Size(),
+		}, nil
+	}
+
+	// the concurrent imports of the same digest write their own temp files, the verified one is renamed
+	layer, err := os.CreateTemp(h.op().StorageConfig.DownloadPath, utils.LayerFileName(digest)+".import-*")
+	if err != nil {
+		return nil, errors.Wrapf(err, "create layer file for '%s' failed", digest)
+	}
+	defer layer.Close()
+	layerFullPath := layer.Name()
+	if err = layer.Chmod(h.op().StorageConfig.FilePerm()); err != nil {
+		_ = os.RemoveAll(layerFullPath)
+		return nil, errors.Wrapf(err, "chmod layer file '%s' failed", layerFullPath)
+	}
+	hasher := sha256.New()
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, c.Request.ContentLength)
+	fileSize, err := io.Copy(io.MultiWriter(layer, hasher), body)
+	if err != nil {
+		_ = os.RemoveAll(layerFullPath)
+		return nil, errors.Wrapf(err, "handle import_layer io copy failed")
+	}
+	if fileSize != c.Request.ContentLength {
+		_ = os.RemoveAll(layerFullPath)
+		return nil, errors.Errorf("import layer size %d not same as content-length %d", fileSize,
+			c.Request.ContentLength)
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != digest {
+		_ = os.RemoveAll(layerFullPath)
+		return nil, fmt.Errorf("import layer digest mismatch, expected '%s' but got '%s'", digest, actual)
+	}
+	if err = h.promoteLayer(ctx, &layerscan.Layer{Digest: digest, Path: layerFullPath},
+		resultPath); err != nil {
+		return nil, err
+	}
+	if err = h.cacheStore.SaveStaticLayer(ctx, digest, resultPath, true); err != nil {
+		return nil, errors.Wrapf(err, "save static layer '%s' failed", resultPath)
+	}
+	logger.InfoContextf(ctx, "import layer '%s' successfully", resultPath)
+	return &apitypes.ImportLayerResponse{
+		Located:  h.op().Address,
+		FilePath: resultPath,
+		FileSize: fileSize,
+	}, nil
+}
+
+// isLoopbackOrPeer returns whether the request is from loopback, the peer tls port, or the nodes of cluster
+func isLoopbackOrPeer(c *gin.Context) bool {
+	if peertls.IsPeerRequest(c.Request) {
+		return true
+	}
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, ep := range leaderselector.Endpoints() {
+		if host, _, err := net.SplitHostPort(ep); err == nil && net.ParseIP(host).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,8 +6,11 @@ package customapi
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -19,13 +22,19 @@ import (
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/bandwidth"
+	"github.com/penglongli/accelerboat/pkg/failover"
+	"github.com/penglongli/accelerboat/pkg/layerscan"
 	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/savings"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/requester"
 	"github.com/penglongli/accelerboat/pkg/store"
 	"github.com/penglongli/accelerboat/pkg/utils"
 	"github.com/penglongli/accelerboat/pkg/utils/formatutils"
 	"github.com/penglongli/accelerboat/pkg/utils/httputils"
+	"github.com/penglongli/accelerboat/pkg/watchdog"
 )
 
 func buildContentLengthKey(host, digest string) string {
@@ -42,13 +51,16 @@ func (h *CustomHandler) getLayerContentLength(ctx context.Context, req *apitypes
 		return v.(int64), nil
 	}
 	logger.InfoContextf(ctx, "handling get layer content-length")
-	resp, _, err := httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
-		Url:         fmt.Sprintf("https://%s%s", req.OriginalHost, req.LayerUrl),
-		Method:      http.MethodHead,
-		HeaderMulti: req.Headers,
+	resp, err := failover.Do(ctx, req.OriginalHost, func(host string) (*http.Response, error) {
+		resp, _, err := httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
+			Url:         utils.RegistryURL(host, req.LayerUrl),
+			Method:      http.MethodHead,
+			HeaderMulti: req.Headers,
+		})
+		return resp, err
 	})
 	if err != nil {
-		return 0, errors.Wrapf(err, "get layer content-length failed")
+		return 0, apitypes.NewUpstreamStatusError(resp, errors.Wrapf(err, "get layer content-length failed"))
 	}
 	h.layerContentLengths.Set(lockKey, resp.ContentLength, 10*time.Second)
 	layerSize := formatutils.FormatSize(resp.ContentLength)
@@ -60,43 +72,87 @@ func (h *CustomHandler) getLayerContentLength(ctx context.Context, req *apitypes
 // distributes the download to another node.
 func (h *CustomHandler) GetLayerInfo(c *gin.Context) (interface{}, error) {
 	req := &apitypes.DownloadLayerRequest{}
-	if err := c.ShouldBindJSON(req); err != nil {
-		return nil, errors.Wrapf(err, "parse request failed")
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
 	}
-	ctx := c.Request.Context()
+	if err := h.checkOriginalHost(req.OriginalHost); err != nil {
+		return nil, err
+	}
+	return h.getLayerInfo(c.Request.Context(), req)
+}
+
+func (h *CustomHandler) getLayerInfo(ctx context.Context, req *apitypes.DownloadLayerRequest) (
+	*apitypes.DownloadLayerResponse, error) {
+	// the original registry is always requested with the headers of client, it authorizes the client
+	// for the layer even if the layer is in object storage
 	contentLength, err := h.getLayerContentLength(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	if h.objectStore != nil {
+		var storedLength int64
+		if storedLength, req.FromObjectStorage, err = h.objectStore.StatLayer(ctx, req.Digest); err != nil {
+			logger.WarnContextf(ctx, "stat layer from object storage failed: %s", err.Error())
+		}
+		if req.FromObjectStorage {
+			contentLength = storedLength
+		}
+	}
 
 	h.downloadLayerLock.Lock(ctx, req.Digest)
 	defer h.downloadLayerLock.UnLock(ctx, req.Digest)
+	if v, ok := h.blockedLayers.Get(req.Digest); ok && v != nil {
+		return nil, v.(error)
+	}
 	resp, err := h.checkLayerHasCached(ctx, req, contentLength)
 	if err == nil {
 		return resp, nil
 	}
 
 	logger.WarnContextf(ctx, "check layer has cached failed: %s", err.Error())
+	// the layer cached in other clusters is fetched through the gateway before original registry
+	if h.federation != nil && !req.FromObjectStorage {
+		if resp, err = h.fetchLayerFromFederation(ctx, req, contentLength); err == nil {
+			return resp, nil
+		}
+		if errors.Is(err, apitypes.ErrLayerBlocked) {
+			h.cacheBlockedLayer(req.Digest, err)
+			return nil, err
+		}
+		logger.WarnContextf(ctx, "fetch layer from federation failed: %s", err.Error())
+	}
 	// master should download directly if small layer
 	if contentLength < options.TwentyMB {
-		resultPath := path.Join(h.op.StorageConfig.SmallFilePath, utils.LayerFileName(req.Digest))
-		if err = h.requestDownloadLayer(ctx, req, resultPath); err != nil {
-			return nil, fmt.Errorf("download small-layer from original registry '%s/%s' failed",
-				req.OriginalHost, req.LayerUrl)
+		resultPath := path.Join(h.op().StorageConfig.SmallFilePath, utils.LayerFileName(req.Digest))
+		if err = h.downloadLayerDetached(ctx, req, resultPath); err != nil {
+			h.cacheBlockedLayer(req.Digest, err)
+			return nil, errors.Wrapf(err, "download small-layer '%s/%s' failed", req.OriginalHost, req.LayerUrl)
 		}
+		savings.Global.AddOrigin(req.OriginalHost, contentLength)
 		return &apitypes.DownloadLayerResponse{
-			Located:  h.op.Address,
-			FilePath: resultPath,
-			FileSize: contentLength,
+			Located:    h.op().Address,
+			FilePath:   resultPath,
+			FileSize:   contentLength,
+			FromOrigin: true,
 		}, nil
 	}
 	// distribute the layer download task to other nodes.
 	if resp, err = h.distributeDownloadLayer(ctx, req); err != nil {
+		h.cacheBlockedLayer(req.Digest, err)
 		return nil, err
 	}
+	resp.FromOrigin = true
+	savings.Global.AddOrigin(req.OriginalHost, contentLength)
 	return resp, nil
 }
 
+// cacheBlockedLayer caches the blocked result of layer scan to avoid downloading the layer repeatedly
+func (h *CustomHandler) cacheBlockedLayer(digest string, err error) {
+	if errors.Is(err, apitypes.ErrLayerBlocked) {
+		h.blockedLayers.Set(digest, err, time.Minute)
+	}
+}
+
 func sortLayerCache(layers []*store.LayerLocatedInfo, refer map[string]int64) []*store.LayerLocatedInfo {
 	for _, layer := range layers {
 		if _, ok := refer[layer.Located]; ok {
@@ -119,7 +175,7 @@ func (h *CustomHandler) checkLayerHasCached(ctx context.Context, req *apitypes.D
 	if h.staticLayerRefer[req.Digest] == nil {
 		h.staticLayerRefer[req.Digest] = make(map[string]int64)
 	}
-	staticLayers = sortLayerCache(staticLayers, h.staticLayerRefer[req.Digest])
+	staticLayers = h.preferOwners(req.Digest, sortLayerCache(staticLayers, h.staticLayerRefer[req.Digest]))
 	for _, sl := range staticLayers {
 		logger.InfoContextf(ctx, "check static layer '%s, %s' starting", sl.Located, sl.Data)
 		var resp *apitypes.CheckStaticLayerResponse
@@ -140,17 +196,18 @@ func (h *CustomHandler) checkLayerHasCached(ctx context.Context, req *apitypes.D
 		logger.InfoContextf(ctx, "check static layer '%s, %s' success", sl.Located, sl.Data)
 		h.staticLayerRefer[req.Digest][sl.Located]++
 		return &apitypes.DownloadLayerResponse{
-			TorrentBase64: resp.TorrentBase64,
-			Located:       resp.Located,
-			FileSize:      resp.FileSize,
-			FilePath:      resp.LayerPath,
+			TorrentBase64:  resp.TorrentBase64,
+			TorrentPending: resp.TorrentPending,
+			Located:        resp.Located,
+			FileSize:       resp.FileSize,
+			FilePath:       resp.LayerPath,
 		}, nil
 	}
 
 	if h.ociLayerRefer[req.Digest] == nil {
 		h.ociLayerRefer[req.Digest] = make(map[string]int64)
 	}
-	ociLayers = sortLayerCache(ociLayers, h.ociLayerRefer[req.Digest])
+	ociLayers = h.preferOwners(req.Digest, sortLayerCache(ociLayers, h.ociLayerRefer[req.Digest]))
 	for _, ocil := range ociLayers {
 		logger.InfoContextf(ctx, "check oci-layer '%s, %s' starting'", ocil.Located, ocil.Data)
 		var resp *apitypes.CheckOCILayerResponse
@@ -179,8 +236,10 @@ func (h *CustomHandler) distributeDownloadLayer(ctx context.Context, req *apityp
 	*apitypes.DownloadLayerResponse, error) {
 	var resp *apitypes.DownloadLayerResponse
 	var err error
+	tried := make(map[string]struct{})
 	for i := 0; i < 5; i++ {
-		targetNode := h.distributeNode()
+		targetNode := h.distributeNode(ctx, req.Digest, tried)
+		tried[targetNode] = struct{}{}
 		logger.InfoContextf(ctx, "distribute task to node '%s'", targetNode)
 		if resp, err = requester.DownloadLayerFromNode(ctx, targetNode, req); err != nil {
 			logger.ErrorContextf(ctx, "node '%s' download layer failed: %s", targetNode, err.Error())
@@ -191,15 +250,48 @@ func (h *CustomHandler) distributeDownloadLayer(ctx context.Context, req *apityp
 		if err == nil {
 			return resp, nil
 		}
+		// the pulling clients are disconnected, the node is requested to cancel the downloading
+		if ctx.Err() != nil {
+			if h.op().DownloadCancel.Enable {
+				h.cancelDistributedDownload(ctx, targetNode, req.Digest)
+			}
+			return nil, errors.Wrapf(err, "distribute download layer canceled")
+		}
+		if errors.Is(err, apitypes.ErrLayerBlocked) {
+			return nil, err
+		}
 	}
 	return nil, errors.Wrapf(err, "distribute download layer failed")
 }
 
-func (h *CustomHandler) distributeNode() string {
+// distributeNode returns the node with the least download tasks, the cordoned nodes are skipped unless
+// all nodes are cordoned. With consistent hash placement the owner nodes of digest not tried are returned
+// first.
+func (h *CustomHandler) distributeNode(ctx context.Context, digest string, tried map[string]struct{}) string {
+	cordoned, err := h.cacheStore.CordonedNodes(ctx)
+	if err != nil {
+		logger.WarnContextf(ctx, "query cordoned nodes failed: %s", err.Error())
+	}
 	h.nodeDownloadLock.Lock()
 	defer h.nodeDownloadLock.Unlock()
 
 	eps := leaderselector.Endpoints()
+	candidates := make(map[string]struct{})
+	for _, ep := range eps {
+		// the endpoints are 'ip:port', the nodes are cordoned by ip
+		if host, _, err := net.SplitHostPort(ep); err == nil {
+			if _, ok := cordoned[host]; ok {
+				continue
+			}
+		}
+		candidates[ep] = struct{}{}
+	}
+	if len(candidates) == 0 && len(eps) != 0 {
+		logger.WarnContextf(ctx, "all nodes are cordoned, distribute task to the cordoned nodes")
+		for _, ep := range eps {
+			candidates[ep] = struct{}{}
+		}
+	}
 	epMap := make(map[string]struct{})
 	for _, ep := range eps {
 		epMap[ep] = struct{}{}
@@ -213,9 +305,18 @@ func (h *CustomHandler) distributeNode() string {
 			delete(h.nodeDownloadTasks, k)
 		}
 	}
+	if h.op().Placement.Mode == options.PlacementConsistentHash {
+		if node := h.ownerNodeLocked(digest, eps, candidates, tried); node != "" {
+			h.nodeDownloadTasks[node]++
+			return node
+		}
+	}
 	var result string
 	ans := 100000
 	for k, v := range h.nodeDownloadTasks {
+		if _, ok := candidates[k]; !ok {
+			continue
+		}
 		if ans > v {
 			ans = v
 			result = k
@@ -236,67 +337,174 @@ func (h *CustomHandler) releaseNode(node string) {
 // DownloadLayer downloads a layer from the original registry to local storage and optionally returns a torrent.
 func (h *CustomHandler) DownloadLayer(c *gin.Context) (interface{}, error) {
 	req := &apitypes.DownloadLayerRequest{}
-	if err := c.ShouldBindJSON(req); err != nil {
-		return nil, errors.Wrapf(err, "parse request failed")
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
 	}
-	resultPath := path.Join(h.op.StorageConfig.TransferPath, utils.LayerFileName(req.Digest))
+	if err := h.checkOriginalHost(req.OriginalHost); err != nil {
+		return nil, err
+	}
+	resultPath := path.Join(h.op().StorageConfig.TransferPath, utils.LayerFileName(req.Digest))
 	ctx := c.Request.Context()
-	if err := h.requestDownloadLayer(ctx, req, resultPath); err != nil {
+	if err := h.downloadLayerDetached(ctx, req, resultPath); err != nil {
 		return nil, errors.Wrapf(err, "download layer failed")
 	}
+	return h.buildDownloadLayerResponse(ctx, req.Digest, resultPath)
+}
+
+// buildDownloadLayerResponse returns the location of the layer downloaded to local, the torrent is
+// requested if the layer exceeds the threshold
+func (h *CustomHandler) buildDownloadLayerResponse(ctx context.Context, digest, resultPath string) (
+	*apitypes.DownloadLayerResponse, error) {
 	fileSize, err := checkLocalLayer(resultPath)
 	if err != nil {
 		return nil, errors.Wrapf(err, "check local layer failed")
 	}
 	resp := &apitypes.DownloadLayerResponse{
-		Located:  h.op.Address,
+		Located:  h.op().Address,
 		FilePath: resultPath,
 		FileSize: fileSize,
 	}
 
-	if !h.op.TorrentConfig.Enable || fileSize < h.op.TorrentConfig.Threshold*options.MB {
+	if !h.op().TorrentConfig.Enable || fileSize < h.op().TorrentConfig.Threshold*options.MB {
 		return resp, nil
 	}
-	timeoutCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-	torrentBase64, err := h.torrentHandler.GenerateTorrent(timeoutCtx, req.Digest, resultPath)
+	resp.TorrentBase64, resp.TorrentPending = h.torrentHandler.RequestTorrent(ctx, digest, resultPath)
+	return resp, nil
+}
+
+// downloadLayer downloads the layer from object storage if it exists there, otherwise downloads from
+// the parent cluster or the original registry and uploads it into object storage if upload is enabled.
+func (h *CustomHandler) downloadLayer(ctx context.Context, req *apitypes.DownloadLayerRequest,
+	destPath string) error {
+	if req.FromObjectStorage && h.objectStore != nil {
+		err := h.downloadLayerFromObjectStorage(ctx, req, destPath)
+		if err == nil {
+			return nil
+		}
+		logger.WarnContextf(ctx, "download layer from object storage failed and will download from "+
+			"original registry: %s", err.Error())
+	}
+	// the layer missed in cluster is downloaded from the parent cluster before original registry
+	if h.op().Parent.Enable && !req.FromObjectStorage {
+		err := h.downloadLayerFromParent(ctx, req, destPath)
+		if err == nil {
+			return nil
+		}
+		logger.WarnContextf(ctx, "download layer from parent failed and will download from "+
+			"original registry: %s", err.Error())
+	}
+	if err := h.requestDownloadLayer(ctx, req, destPath); err != nil {
+		return err
+	}
+	if h.objectStore != nil && h.op().ObjectStorage.Upload {
+		go func() {
+			// the request context will be canceled after response
+			uploadCtx := context.WithoutCancel(ctx)
+			if err := h.objectStore.UploadLayer(uploadCtx, req.Digest, destPath); err != nil {
+				logger.ErrorContextf(uploadCtx, "upload layer '%s' to object storage failed: %s",
+					destPath, err.Error())
+				return
+			}
+			logger.InfoContextf(uploadCtx, "upload layer '%s' to object storage success", destPath)
+		}()
+	}
+	return nil
+}
+
+// downloadLayerFromObjectStorage downloads the layer from object storage, the content is verified
+// with the digest before moving to destPath.
+func (h *CustomHandler) downloadLayerFromObjectStorage(ctx context.Context, req *apitypes.DownloadLayerRequest,
+	destPath string) error {
+	logger.InfoContextf(ctx, "starting download layer from object storage")
+	reader, err := h.objectStore.GetLayer(ctx, req.Digest)
 	if err != nil {
-		logger.ErrorContextf(ctx, "generate torrent for '%s' failed: %s", resultPath, err.Error())
-	} else {
-		resp.TorrentBase64 = torrentBase64
+		return err
 	}
-	return resp, nil
+	defer reader.Close()
+
+	layerFullPath := path.Join(h.op().StorageConfig.DownloadPath, utils.LayerFileName(req.Digest))
+	_ = os.RemoveAll(layerFullPath)
+	layer, err := os.OpenFile(layerFullPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, h.op().StorageConfig.FilePerm())
+	if err != nil {
+		return errors.Wrapf(err, "create layer file '%s' failed", layerFullPath)
+	}
+	defer layer.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(layer, hasher), reader)
+	if err != nil {
+		_ = os.RemoveAll(layerFullPath)
+		return errors.Wrapf(err, "handle download layer from object storage io copy failed")
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != req.Digest {
+		_ = os.RemoveAll(layerFullPath)
+		return errors.Errorf("layer from object storage digest '%s' not same as expected '%s'",
+			actual, req.Digest)
+	}
+	if err = h.promoteLayer(ctx, &layerscan.Layer{Digest: req.Digest, Path: layerFullPath,
+		Registry: req.OriginalHost, Repo: req.Repo}, destPath); err != nil {
+		return err
+	}
+	metrics.TransferSize.WithLabelValues("download_object_storage").Add(float64(size) / 1e9)
+	logger.InfoContextf(ctx, "download layer '%s' from object storage successfully", destPath)
+	return nil
 }
 
-// requestDownloadLayer request the original registry to download layer
+// requestDownloadLayer request the original registry to download layer. The download is watched by watchdog,
+// the stalled download is aborted and retried once with a new request.
 func (h *CustomHandler) requestDownloadLayer(ctx context.Context, req *apitypes.DownloadLayerRequest,
 	destPath string) error {
+	layerFullPath := path.Join(h.op().StorageConfig.DownloadPath, utils.LayerFileName(req.Digest))
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		watchCtx, stop := watchdog.Watch(ctx, "origin", req.Digest, func() int64 {
+			if fi, statErr := os.Stat(layerFullPath); statErr == nil {
+				return fi.Size()
+			}
+			return 0
+		})
+		err = h.fetchOriginLayer(watchCtx, req, layerFullPath)
+		stalled := err != nil && watchdog.IsStalled(watchCtx, err)
+		if stalled {
+			err = errors.Wrapf(context.Cause(watchCtx), "download layer from original registry aborted")
+		}
+		stop()
+		if !stalled {
+			break
+		}
+		logger.WarnContextf(ctx, "download layer from original registry stalled: %s", err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return h.promoteLayer(ctx, &layerscan.Layer{Digest: req.Digest, Path: layerFullPath,
+		Registry: req.OriginalHost, Repo: req.Repo}, destPath)
+}
+
+// fetchOriginLayer downloads the layer from original registry into layerFullPath
+func (h *CustomHandler) fetchOriginLayer(ctx context.Context, req *apitypes.DownloadLayerRequest,
+	layerFullPath string) error {
 	logger.InfoContextf(ctx, "starting download layer from original registry")
-	resp, err := httputils.SendHTTPRequestOnlyResponse(ctx, &httputils.HTTPRequest{
-		Url:         fmt.Sprintf("https://%s%s", req.OriginalHost, req.LayerUrl),
-		Method:      http.MethodGet,
-		HeaderMulti: req.Headers,
+	resp, err := failover.Do(ctx, req.OriginalHost, func(host string) (*http.Response, error) {
+		return httputils.SendHTTPRequestOnlyResponse(ctx, &httputils.HTTPRequest{
+			Url:         utils.RegistryURL(host, req.LayerUrl),
+			Method:      http.MethodGet,
+			HeaderMulti: req.Headers,
+		})
 	})
 	if err != nil {
 		return errors.Wrapf(err, "download layer from original registry failed")
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		var bs []byte
-		bs, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("download layer from original registry failed, statusCode: %d", resp.StatusCode)
-		}
 		return fmt.Errorf("download layer from original registry failed, statusCode=%d: %s",
-			resp.StatusCode, string(bs))
+			resp.StatusCode, httputils.ReadErrorBody(resp))
 	}
 
 	contentLength := resp.ContentLength
 	layerSize := formatutils.FormatSize(contentLength)
 
-	layerFullPath := path.Join(h.op.StorageConfig.DownloadPath, utils.LayerFileName(req.Digest))
 	_ = os.RemoveAll(layerFullPath)
-	layer, err := os.Create(layerFullPath)
+	layer, err := os.OpenFile(layerFullPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, h.op().StorageConfig.FilePerm())
 	if err != nil {
 		return errors.Wrapf(err, "create layer file '%s' failed", layerFullPath)
 	}
@@ -325,13 +533,15 @@ func (h *CustomHandler) requestDownloadLayer(ctx context.Context, req *apitypes.
 		}
 	}()
 	defer close(progressCh)
-	if _, err = io.Copy(layer, resp.Body); err != nil {
+	var writer io.Writer = layer
+	if task := h.downloadTasks.get(req.Digest); task != nil {
+		task.total.Store(contentLength)
+		writer = io.MultiWriter(layer, task)
+	}
+	if _, err = io.Copy(writer, bandwidth.OriginReader(ctx, resp.Body)); err != nil {
 		_ = os.RemoveAll(layer.Name())
 		return errors.Wrapf(err, "handle download_layer io copy failed")
 	}
 	logger.InfoContextf(ctx, "download layer '%s' successfully", layerFullPath)
-	if err = os.Rename(layerFullPath, destPath); err != nil {
-		return errors.Wrapf(err, "renamse '%s' to '%s' failed", layerFullPath, destPath)
-	}
 	return nil
 }
@@ -0,0 +1,71 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/layerscan"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// promoteLayer scans the downloaded layer with the layer scan hook and moves it into destPath. The
+// downloaded layer will be removed if it is blocked.
+func (h *CustomHandler) promoteLayer(ctx context.Context, layer *layerscan.Layer, destPath string) error {
+	if err := h.scanLayer(ctx, layer); err != nil {
+		_ = os.RemoveAll(layer.Path)
+		return err
+	}
+	if err := os.Rename(layer.Path, destPath); err != nil {
+		_ = os.RemoveAll(layer.Path)
+		return errors.Wrapf(err, "rename '%s' to '%s' failed", layer.Path, destPath)
+	}
+	return nil
+}
+
+// scanLayer returns error wraps ErrLayerBlocked if the layer should not be cached
+func (h *CustomHandler) scanLayer(ctx context.Context, layer *layerscan.Layer) error {
+	cfg := h.op().LayerScan
+	if !cfg.Enable {
+		return nil
+	}
+	hook, err := layerscan.NewHook(&cfg)
+	if err != nil {
+		return errors.Wrapf(err, "create layer scan hook failed")
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout)*time.Second)
+	defer cancel()
+	start := time.Now()
+	verdict, err := hook.Scan(timeoutCtx, layer)
+	metrics.LayerScanDurationSeconds.WithLabelValues(string(cfg.Type)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.RecordError(metrics.ComponentLayerScan, "scan")
+		metrics.LayerScanTotal.WithLabelValues(string(cfg.Type), "error").Inc()
+		if cfg.FailOpen {
+			logger.WarnContextf(ctx, "scan layer '%s' failed and keep it (fail-open): %s", layer.Path, err.Error())
+			return nil
+		}
+		return errors.Wrapf(apitypes.ErrLayerBlocked, "scan layer failed: %s", err.Error())
+	}
+	if verdict.Passed {
+		metrics.LayerScanTotal.WithLabelValues(string(cfg.Type), "passed").Inc()
+		logger.InfoContextf(ctx, "scan layer '%s' passed", layer.Path)
+		return nil
+	}
+	if cfg.Action == options.LayerScanWarn {
+		metrics.LayerScanTotal.WithLabelValues(string(cfg.Type), "warned").Inc()
+		logger.WarnContextf(ctx, "scan layer '%s' not passed (warn): %s", layer.Path, verdict.Message)
+		return nil
+	}
+	metrics.LayerScanTotal.WithLabelValues(string(cfg.Type), "blocked").Inc()
+	return errors.Wrapf(apitypes.ErrLayerBlocked, "layer '%s' blocked: %s", layer.Digest, verdict.Message)
+}
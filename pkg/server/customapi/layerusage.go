@@ -0,0 +1,44 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// LayerUsage returns the last used time of layers on the node from the usage index of recorder, the result
+// can be filtered by 'days' and 'digest'(substring)
+func (h *CustomHandler) LayerUsage(c *gin.Context) (interface{}, error) {
+	var since *time.Time
+	if s := c.Query("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid query param days '%s'", s)
+		}
+		t := time.Now().Add(-time.Duration(n) * 24 * time.Hour)
+		since = &t
+	}
+	digest := c.Query("digest")
+	layers, compactedAt := recorder.Global.LayerUsageList(since)
+	resp := &apitypes.LayerUsageResponse{
+		CompactedAt: compactedAt,
+		Layers:      make([]*apitypes.LayerUsage, 0, len(layers)),
+	}
+	for _, l := range layers {
+		if digest != "" && !strings.Contains(l.Digest, digest) {
+			continue
+		}
+		resp.Layers = append(resp.Layers, &apitypes.LayerUsage{Digest: l.Digest, LastUsed: l.LastUsed})
+	}
+	return resp, nil
+}
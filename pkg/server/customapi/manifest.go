@@ -5,29 +5,71 @@
 package customapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/pkg/errors"
 
+	"github.com/penglongli/accelerboat/pkg/failover"
 	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
 	"github.com/penglongli/accelerboat/pkg/utils/httputils"
 )
 
+// manifestMaxBodySize the max size of manifest, the registries reject the manifests larger than 4MB and the
+// larger response is likely a misrouted blob
+const manifestMaxBodySize = 4 * 1024 * 1024
+
 func buildManifestKey(originalHost, repo, tag string) string {
 	return fmt.Sprintf("%s,%s,%s", originalHost, repo, tag)
 }
 
+// buildManifestCacheKey returns the cache key of manifest with the accept media types of request, the
+// registry may respond different manifests (e.g. image index or OCI artifact) for different accept types
+func buildManifestCacheKey(originalHost, repo, tag string, headers map[string][]string) string {
+	return fmt.Sprintf("%s,%s", buildManifestKey(originalHost, repo, tag),
+		strings.Join(normalizeAcceptTypes(headers), ";"))
+}
+
+// normalizeAcceptTypes returns the sorted and deduplicated media types of Accept headers, the parameters
+// (e.g. 'q=0.9') are ignored
+func normalizeAcceptTypes(headers map[string][]string) []string {
+	accepts := make([]string, 0)
+	exists := make(map[string]struct{})
+	for _, v := range http.Header(headers).Values("Accept") {
+		for _, mediaType := range strings.Split(v, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+			if mediaType == "" {
+				continue
+			}
+			if _, ok := exists[mediaType]; ok {
+				continue
+			}
+			exists[mediaType] = struct{}{}
+			accepts = append(accepts, mediaType)
+		}
+	}
+	sort.Strings(accepts)
+	return accepts
+}
+
 // RegistryHeadManifest performs a HEAD request to the upstream registry for the image manifest and returns headers.
 func (h *CustomHandler) RegistryHeadManifest(c *gin.Context) (interface{}, error) {
 	req := &apitypes.HeadManifestRequest{}
-	if err := c.ShouldBindJSON(req); err != nil {
-		return nil, errors.Wrapf(err, "parse request failed")
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
+	}
+	if err := h.checkOriginalHost(req.OriginalHost); err != nil {
+		return nil, err
 	}
-	lockKey := buildManifestKey(req.OriginalHost, req.Repo, req.Tag)
+	lockKey := buildManifestCacheKey(req.OriginalHost, req.Repo, req.Tag, req.Headers)
 	ctx := c.Request.Context()
 	h.headManifestLock.Lock(ctx, lockKey)
 	defer h.headManifestLock.UnLock(ctx, lockKey)
@@ -37,13 +79,18 @@ func (h *CustomHandler) RegistryHeadManifest(c *gin.Context) (interface{}, error
 		return &apitypes.HeadManifestResponse{Headers: v.(map[string][]string)}, nil
 	}
 	logger.InfoContextf(ctx, "handling head image manifest request")
-	resp, _, err := httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
-		Url:         fmt.Sprintf("https://%s%s", req.OriginalHost, req.HeadManifestUrl),
-		Method:      http.MethodHead,
-		HeaderMulti: req.Headers,
+	resp, err := failover.Do(ctx, req.OriginalHost, func(host string) (*http.Response, error) {
+		resp, _, err := httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
+			Url:         utils.RegistryURL(host, req.HeadManifestUrl),
+			Method:      http.MethodHead,
+			HeaderMulti: req.Headers,
+		})
+		return resp, err
 	})
+	h.accounts.observe(req.OriginalHost, req.Headers, resp)
+	h.shadowManifest(ctx, req.OriginalHost, http.MethodHead, req.HeadManifestUrl, req.Headers, resp, nil)
 	if err != nil {
-		return nil, err
+		return nil, apitypes.NewUpstreamStatusError(resp, err)
 	}
 	result := make(map[string][]string)
 	for k, v := range resp.Header {
@@ -56,26 +103,50 @@ func (h *CustomHandler) RegistryHeadManifest(c *gin.Context) (interface{}, error
 // RegistryGetManifest fetches the image manifest from the upstream registry and returns the manifest body.
 func (h *CustomHandler) RegistryGetManifest(c *gin.Context) (interface{}, error) {
 	req := &apitypes.GetManifestRequest{}
-	if err := c.ShouldBindJSON(req); err != nil {
-		return nil, errors.Wrapf(err, "parse request failed")
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
 	}
-	lockKey := buildManifestKey(req.OriginalHost, req.Repo, req.Tag)
-	ctx := c.Request.Context()
+	if err := h.checkOriginalHost(req.OriginalHost); err != nil {
+		return nil, err
+	}
+	manifest, err := h.getManifest(c.Request.Context(), req)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (h *CustomHandler) getManifest(ctx context.Context, req *apitypes.GetManifestRequest) (string, error) {
+	lockKey := buildManifestCacheKey(req.OriginalHost, req.Repo, req.Tag, req.Headers)
 	h.getManifestLock.Lock(ctx, lockKey)
 	defer h.getManifestLock.UnLock(ctx, lockKey)
 
 	v, ok := h.manifests.Get(lockKey)
 	if ok && v != nil {
+		metrics.ManifestCacheRequestsTotal.WithLabelValues("hit").Inc()
 		return v.(string), nil
 	}
+	metrics.ManifestCacheRequestsTotal.WithLabelValues("miss").Inc()
 	logger.InfoContextf(ctx, "handling get image manifest request")
-	respBody, err := httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
-		Url:         fmt.Sprintf("https://%s%s", req.OriginalHost, req.ManifestUrl),
-		Method:      http.MethodGet,
-		HeaderMulti: req.Headers,
+	var respBody []byte
+	resp, err := failover.Do(ctx, req.OriginalHost, func(host string) (*http.Response, error) {
+		var resp *http.Response
+		var err error
+		resp, respBody, err = httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
+			Url:         utils.RegistryURL(host, req.ManifestUrl),
+			Method:      http.MethodGet,
+			HeaderMulti: req.Headers,
+			MaxBodySize: manifestMaxBodySize,
+		})
+		return resp, err
 	})
+	h.accounts.observe(req.OriginalHost, req.Headers, resp)
+	h.shadowManifest(ctx, req.OriginalHost, http.MethodGet, req.ManifestUrl, req.Headers, resp, respBody)
 	if err != nil {
-		return nil, err
+		return "", apitypes.NewUpstreamStatusError(resp, err)
+	}
+	if err = h.verifyManifestSignature(ctx, req, respBody); err != nil {
+		return "", err
 	}
 	manifest := string(respBody)
 	h.manifests.Set(lockKey, manifest, 10*time.Second)
@@ -0,0 +1,105 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+func TestNormalizeAcceptTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string][]string
+		want    []string
+	}{
+		{
+			name:    "no accept",
+			headers: map[string][]string{"Authorization": {"Bearer x"}},
+			want:    []string{},
+		},
+		{
+			name:    "sorted",
+			headers: map[string][]string{"Accept": {mediaTypeOCIManifest, mediaTypeDockerManifest}},
+			want:    []string{mediaTypeDockerManifest, mediaTypeOCIManifest},
+		},
+		{
+			name: "comma separated with parameters",
+			headers: map[string][]string{"Accept": {
+				mediaTypeOCIIndex + ";q=0.9, " + mediaTypeDockerList + " ; q=0.5",
+			}},
+			want: []string{mediaTypeDockerList, mediaTypeOCIIndex},
+		},
+		{
+			name: "deduplicated and lower case",
+			headers: map[string][]string{"Accept": {
+				mediaTypeOCIManifest, "Application/VND.OCI.Image.Manifest.v1+json", ",",
+			}},
+			want: []string{mediaTypeOCIManifest},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeAcceptTypes(tt.headers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeAcceptTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildManifestCacheKey(t *testing.T) {
+	manifestOnly := map[string][]string{"Accept": {mediaTypeDockerManifest, mediaTypeOCIManifest}}
+	withIndex := map[string][]string{"Accept": {
+		mediaTypeDockerManifest, mediaTypeOCIManifest, mediaTypeOCIIndex, mediaTypeDockerList,
+	}}
+	tests := []struct {
+		name     string
+		a, b     map[string][]string
+		sameKeys bool
+	}{
+		{
+			name:     "index request separated from manifest request",
+			a:        manifestOnly,
+			b:        withIndex,
+			sameKeys: false,
+		},
+		{
+			name:     "accept order not matter",
+			a:        manifestOnly,
+			b:        map[string][]string{"Accept": {mediaTypeOCIManifest + "," + mediaTypeDockerManifest}},
+			sameKeys: true,
+		},
+		{
+			name: "accept parameters not matter",
+			a:    withIndex,
+			b: map[string][]string{"Accept": {
+				mediaTypeOCIIndex + ";q=0.5", mediaTypeDockerList, mediaTypeOCIManifest, mediaTypeDockerManifest,
+			}},
+			sameKeys: true,
+		},
+		{
+			name:     "no accept separated from manifest request",
+			a:        map[string][]string{},
+			b:        manifestOnly,
+			sameKeys: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyA := buildManifestCacheKey("registry-1.docker.io", "library/nginx", "latest", tt.a)
+			keyB := buildManifestCacheKey("registry-1.docker.io", "library/nginx", "latest", tt.b)
+			if (keyA == keyB) != tt.sameKeys {
+				t.Errorf("buildManifestCacheKey() keys '%s' and '%s', want same %v", keyA, keyB, tt.sameKeys)
+			}
+		})
+	}
+}
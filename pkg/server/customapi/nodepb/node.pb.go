@@ -0,0 +1,882 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: node.proto
+
+package nodepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// HeaderValues defines the values of one header
+type HeaderValues struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []string               `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeaderValues) Reset() {
+	*x = HeaderValues{}
+	mi := &file_node_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeaderValues) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeaderValues) ProtoMessage() {}
+
+func (x *HeaderValues) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeaderValues.ProtoReflect.Descriptor instead.
+func (*HeaderValues) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *HeaderValues) GetValues() []string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+// GetServiceTokenRequest defines the request of GetServiceToken
+type GetServiceTokenRequest struct {
+	state           protoimpl.MessageState   `protogen:"open.v1"`
+	OriginalHost    string                   `protobuf:"bytes,1,opt,name=original_host,json=originalHost,proto3" json:"original_host,omitempty"`
+	ServiceTokenUrl string                   `protobuf:"bytes,2,opt,name=service_token_url,json=serviceTokenUrl,proto3" json:"service_token_url,omitempty"`
+	Headers         map[string]*HeaderValues `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Service         string                   `protobuf:"bytes,4,opt,name=service,proto3" json:"service,omitempty"`
+	Scope           string                   `protobuf:"bytes,5,opt,name=scope,proto3" json:"scope,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *GetServiceTokenRequest) Reset() {
+	*x = GetServiceTokenRequest{}
+	mi := &file_node_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetServiceTokenRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetServiceTokenRequest) ProtoMessage() {}
+
+func (x *GetServiceTokenRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetServiceTokenRequest.ProtoReflect.Descriptor instead.
+func (*GetServiceTokenRequest) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetServiceTokenRequest) GetOriginalHost() string {
+	if x != nil {
+		return x.OriginalHost
+	}
+	return ""
+}
+
+func (x *GetServiceTokenRequest) GetServiceTokenUrl() string {
+	if x != nil {
+		return x.ServiceTokenUrl
+	}
+	return ""
+}
+
+func (x *GetServiceTokenRequest) GetHeaders() map[string]*HeaderValues {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *GetServiceTokenRequest) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *GetServiceTokenRequest) GetScope() string {
+	if x != nil {
+		return x.Scope
+	}
+	return ""
+}
+
+// GetServiceTokenResponse defines the service token, issued_at is in unix nanoseconds
+type GetServiceTokenResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	AccessToken   string                 `protobuf:"bytes,2,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
+	ExpiresIn     int64                  `protobuf:"varint,3,opt,name=expires_in,json=expiresIn,proto3" json:"expires_in,omitempty"`
+	IssuedAt      int64                  `protobuf:"varint,4,opt,name=issued_at,json=issuedAt,proto3" json:"issued_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetServiceTokenResponse) Reset() {
+	*x = GetServiceTokenResponse{}
+	mi := &file_node_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetServiceTokenResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetServiceTokenResponse) ProtoMessage() {}
+
+func (x *GetServiceTokenResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetServiceTokenResponse.ProtoReflect.Descriptor instead.
+func (*GetServiceTokenResponse) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetServiceTokenResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *GetServiceTokenResponse) GetAccessToken() string {
+	if x != nil {
+		return x.AccessToken
+	}
+	return ""
+}
+
+func (x *GetServiceTokenResponse) GetExpiresIn() int64 {
+	if x != nil {
+		return x.ExpiresIn
+	}
+	return 0
+}
+
+func (x *GetServiceTokenResponse) GetIssuedAt() int64 {
+	if x != nil {
+		return x.IssuedAt
+	}
+	return 0
+}
+
+// GetManifestRequest defines the request of GetManifest
+type GetManifestRequest struct {
+	state         protoimpl.MessageState   `protogen:"open.v1"`
+	OriginalHost  string                   `protobuf:"bytes,1,opt,name=original_host,json=originalHost,proto3" json:"original_host,omitempty"`
+	ManifestUrl   string                   `protobuf:"bytes,2,opt,name=manifest_url,json=manifestUrl,proto3" json:"manifest_url,omitempty"`
+	Headers       map[string]*HeaderValues `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Repo          string                   `protobuf:"bytes,4,opt,name=repo,proto3" json:"repo,omitempty"`
+	Tag           string                   `protobuf:"bytes,5,opt,name=tag,proto3" json:"tag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetManifestRequest) Reset() {
+	*x = GetManifestRequest{}
+	mi := &file_node_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetManifestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetManifestRequest) ProtoMessage() {}
+
+func (x *GetManifestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetManifestRequest.ProtoReflect.Descriptor instead.
+func (*GetManifestRequest) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetManifestRequest) GetOriginalHost() string {
+	if x != nil {
+		return x.OriginalHost
+	}
+	return ""
+}
+
+func (x *GetManifestRequest) GetManifestUrl() string {
+	if x != nil {
+		return x.ManifestUrl
+	}
+	return ""
+}
+
+func (x *GetManifestRequest) GetHeaders() map[string]*HeaderValues {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *GetManifestRequest) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *GetManifestRequest) GetTag() string {
+	if x != nil {
+		return x.Tag
+	}
+	return ""
+}
+
+// GetManifestResponse defines the response of GetManifest
+type GetManifestResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Manifest      string                 `protobuf:"bytes,1,opt,name=manifest,proto3" json:"manifest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetManifestResponse) Reset() {
+	*x = GetManifestResponse{}
+	mi := &file_node_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetManifestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetManifestResponse) ProtoMessage() {}
+
+func (x *GetManifestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetManifestResponse.ProtoReflect.Descriptor instead.
+func (*GetManifestResponse) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetManifestResponse) GetManifest() string {
+	if x != nil {
+		return x.Manifest
+	}
+	return ""
+}
+
+// GetLayerInfoRequest defines the request of GetLayerInfo
+type GetLayerInfoRequest struct {
+	state         protoimpl.MessageState   `protogen:"open.v1"`
+	OriginalHost  string                   `protobuf:"bytes,1,opt,name=original_host,json=originalHost,proto3" json:"original_host,omitempty"`
+	LayerUrl      string                   `protobuf:"bytes,2,opt,name=layer_url,json=layerUrl,proto3" json:"layer_url,omitempty"`
+	Headers       map[string]*HeaderValues `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Repo          string                   `protobuf:"bytes,4,opt,name=repo,proto3" json:"repo,omitempty"`
+	Digest        string                   `protobuf:"bytes,5,opt,name=digest,proto3" json:"digest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLayerInfoRequest) Reset() {
+	*x = GetLayerInfoRequest{}
+	mi := &file_node_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLayerInfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLayerInfoRequest) ProtoMessage() {}
+
+func (x *GetLayerInfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLayerInfoRequest.ProtoReflect.Descriptor instead.
+func (*GetLayerInfoRequest) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetLayerInfoRequest) GetOriginalHost() string {
+	if x != nil {
+		return x.OriginalHost
+	}
+	return ""
+}
+
+func (x *GetLayerInfoRequest) GetLayerUrl() string {
+	if x != nil {
+		return x.LayerUrl
+	}
+	return ""
+}
+
+func (x *GetLayerInfoRequest) GetHeaders() map[string]*HeaderValues {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *GetLayerInfoRequest) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *GetLayerInfoRequest) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+// LayerInfo defines the location of layer
+type LayerInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	TorrentBase64  string                 `protobuf:"bytes,1,opt,name=torrent_base64,json=torrentBase64,proto3" json:"torrent_base64,omitempty"`
+	TorrentPending bool                   `protobuf:"varint,2,opt,name=torrent_pending,json=torrentPending,proto3" json:"torrent_pending,omitempty"`
+	Located        string                 `protobuf:"bytes,3,opt,name=located,proto3" json:"located,omitempty"`
+	FilePath       string                 `protobuf:"bytes,4,opt,name=file_path,json=filePath,proto3" json:"file_path,omitempty"`
+	FileSize       int64                  `protobuf:"varint,5,opt,name=file_size,json=fileSize,proto3" json:"file_size,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *LayerInfo) Reset() {
+	*x = LayerInfo{}
+	mi := &file_node_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LayerInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LayerInfo) ProtoMessage() {}
+
+func (x *LayerInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LayerInfo.ProtoReflect.Descriptor instead.
+func (*LayerInfo) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *LayerInfo) GetTorrentBase64() string {
+	if x != nil {
+		return x.TorrentBase64
+	}
+	return ""
+}
+
+func (x *LayerInfo) GetTorrentPending() bool {
+	if x != nil {
+		return x.TorrentPending
+	}
+	return false
+}
+
+func (x *LayerInfo) GetLocated() string {
+	if x != nil {
+		return x.Located
+	}
+	return ""
+}
+
+func (x *LayerInfo) GetFilePath() string {
+	if x != nil {
+		return x.FilePath
+	}
+	return ""
+}
+
+func (x *LayerInfo) GetFileSize() int64 {
+	if x != nil {
+		return x.FileSize
+	}
+	return 0
+}
+
+// CheckStaticLayerRequest defines the request of CheckStaticLayer
+type CheckStaticLayerRequest struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	OriginalHost          string                 `protobuf:"bytes,1,opt,name=original_host,json=originalHost,proto3" json:"original_host,omitempty"`
+	Repo                  string                 `protobuf:"bytes,2,opt,name=repo,proto3" json:"repo,omitempty"`
+	Digest                string                 `protobuf:"bytes,3,opt,name=digest,proto3" json:"digest,omitempty"`
+	LayerPath             string                 `protobuf:"bytes,4,opt,name=layer_path,json=layerPath,proto3" json:"layer_path,omitempty"`
+	ExpectedContentLength int64                  `protobuf:"varint,5,opt,name=expected_content_length,json=expectedContentLength,proto3" json:"expected_content_length,omitempty"`
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *CheckStaticLayerRequest) Reset() {
+	*x = CheckStaticLayerRequest{}
+	mi := &file_node_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckStaticLayerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckStaticLayerRequest) ProtoMessage() {}
+
+func (x *CheckStaticLayerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckStaticLayerRequest.ProtoReflect.Descriptor instead.
+func (*CheckStaticLayerRequest) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CheckStaticLayerRequest) GetOriginalHost() string {
+	if x != nil {
+		return x.OriginalHost
+	}
+	return ""
+}
+
+func (x *CheckStaticLayerRequest) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *CheckStaticLayerRequest) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+func (x *CheckStaticLayerRequest) GetLayerPath() string {
+	if x != nil {
+		return x.LayerPath
+	}
+	return ""
+}
+
+func (x *CheckStaticLayerRequest) GetExpectedContentLength() int64 {
+	if x != nil {
+		return x.ExpectedContentLength
+	}
+	return 0
+}
+
+// CheckOCILayerRequest defines the request of CheckOCILayer
+type CheckOCILayerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Digest        string                 `protobuf:"bytes,1,opt,name=digest,proto3" json:"digest,omitempty"`
+	OciType       string                 `protobuf:"bytes,2,opt,name=oci_type,json=ociType,proto3" json:"oci_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckOCILayerRequest) Reset() {
+	*x = CheckOCILayerRequest{}
+	mi := &file_node_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckOCILayerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckOCILayerRequest) ProtoMessage() {}
+
+func (x *CheckOCILayerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckOCILayerRequest.ProtoReflect.Descriptor instead.
+func (*CheckOCILayerRequest) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CheckOCILayerRequest) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+func (x *CheckOCILayerRequest) GetOciType() string {
+	if x != nil {
+		return x.OciType
+	}
+	return ""
+}
+
+// TransferLayerRequest defines the request of TransferLayer
+type TransferLayerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FilePath      string                 `protobuf:"bytes,1,opt,name=file_path,json=filePath,proto3" json:"file_path,omitempty"`
+	Offset        int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransferLayerRequest) Reset() {
+	*x = TransferLayerRequest{}
+	mi := &file_node_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransferLayerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransferLayerRequest) ProtoMessage() {}
+
+func (x *TransferLayerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransferLayerRequest.ProtoReflect.Descriptor instead.
+func (*TransferLayerRequest) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TransferLayerRequest) GetFilePath() string {
+	if x != nil {
+		return x.FilePath
+	}
+	return ""
+}
+
+func (x *TransferLayerRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+// LayerChunk defines the chunk of layer file, file_size is only set in the first chunk
+type LayerChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	FileSize      int64                  `protobuf:"varint,2,opt,name=file_size,json=fileSize,proto3" json:"file_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LayerChunk) Reset() {
+	*x = LayerChunk{}
+	mi := &file_node_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LayerChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LayerChunk) ProtoMessage() {}
+
+func (x *LayerChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_node_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LayerChunk.ProtoReflect.Descriptor instead.
+func (*LayerChunk) Descriptor() ([]byte, []int) {
+	return file_node_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *LayerChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *LayerChunk) GetFileSize() int64 {
+	if x != nil {
+		return x.FileSize
+	}
+	return 0
+}
+
+var File_node_proto protoreflect.FileDescriptor
+
+const file_node_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"node.proto\x12\x13accelerboat.node.v1\"&\n" +
+	"\fHeaderValues\x12\x16\n" +
+	"\x06values\x18\x01 \x03(\tR\x06values\"\xcc\x02\n" +
+	"\x16GetServiceTokenRequest\x12#\n" +
+	"\roriginal_host\x18\x01 \x01(\tR\foriginalHost\x12*\n" +
+	"\x11service_token_url\x18\x02 \x01(\tR\x0fserviceTokenUrl\x12R\n" +
+	"\aheaders\x18\x03 \x03(\v28.accelerboat.node.v1.GetServiceTokenRequest.HeadersEntryR\aheaders\x12\x18\n" +
+	"\aservice\x18\x04 \x01(\tR\aservice\x12\x14\n" +
+	"\x05scope\x18\x05 \x01(\tR\x05scope\x1a]\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x127\n" +
+	"\x05value\x18\x02 \x01(\v2!.accelerboat.node.v1.HeaderValuesR\x05value:\x028\x01\"\x8e\x01\n" +
+	"\x17GetServiceTokenResponse\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12!\n" +
+	"\faccess_token\x18\x02 \x01(\tR\vaccessToken\x12\x1d\n" +
+	"\n" +
+	"expires_in\x18\x03 \x01(\x03R\texpiresIn\x12\x1b\n" +
+	"\tissued_at\x18\x04 \x01(\x03R\bissuedAt\"\xb1\x02\n" +
+	"\x12GetManifestRequest\x12#\n" +
+	"\roriginal_host\x18\x01 \x01(\tR\foriginalHost\x12!\n" +
+	"\fmanifest_url\x18\x02 \x01(\tR\vmanifestUrl\x12N\n" +
+	"\aheaders\x18\x03 \x03(\v24.accelerboat.node.v1.GetManifestRequest.HeadersEntryR\aheaders\x12\x12\n" +
+	"\x04repo\x18\x04 \x01(\tR\x04repo\x12\x10\n" +
+	"\x03tag\x18\x05 \x01(\tR\x03tag\x1a]\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x127\n" +
+	"\x05value\x18\x02 \x01(\v2!.accelerboat.node.v1.HeaderValuesR\x05value:\x028\x01\"1\n" +
+	"\x13GetManifestResponse\x12\x1a\n" +
+	"\bmanifest\x18\x01 \x01(\tR\bmanifest\"\xb3\x02\n" +
+	"\x13GetLayerInfoRequest\x12#\n" +
+	"\roriginal_host\x18\x01 \x01(\tR\foriginalHost\x12\x1b\n" +
+	"\tlayer_url\x18\x02 \x01(\tR\blayerUrl\x12O\n" +
+	"\aheaders\x18\x03 \x03(\v25.accelerboat.node.v1.GetLayerInfoRequest.HeadersEntryR\aheaders\x12\x12\n" +
+	"\x04repo\x18\x04 \x01(\tR\x04repo\x12\x16\n" +
+	"\x06digest\x18\x05 \x01(\tR\x06digest\x1a]\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x127\n" +
+	"\x05value\x18\x02 \x01(\v2!.accelerboat.node.v1.HeaderValuesR\x05value:\x028\x01\"\xaf\x01\n" +
+	"\tLayerInfo\x12%\n" +
+	"\x0etorrent_base64\x18\x01 \x01(\tR\rtorrentBase64\x12'\n" +
+	"\x0ftorrent_pending\x18\x02 \x01(\bR\x0etorrentPending\x12\x18\n" +
+	"\alocated\x18\x03 \x01(\tR\alocated\x12\x1b\n" +
+	"\tfile_path\x18\x04 \x01(\tR\bfilePath\x12\x1b\n" +
+	"\tfile_size\x18\x05 \x01(\x03R\bfileSize\"\xc1\x01\n" +
+	"\x17CheckStaticLayerRequest\x12#\n" +
+	"\roriginal_host\x18\x01 \x01(\tR\foriginalHost\x12\x12\n" +
+	"\x04repo\x18\x02 \x01(\tR\x04repo\x12\x16\n" +
+	"\x06digest\x18\x03 \x01(\tR\x06digest\x12\x1d\n" +
+	"\n" +
+	"layer_path\x18\x04 \x01(\tR\tlayerPath\x126\n" +
+	"\x17expected_content_length\x18\x05 \x01(\x03R\x15expectedContentLength\"I\n" +
+	"\x14CheckOCILayerRequest\x12\x16\n" +
+	"\x06digest\x18\x01 \x01(\tR\x06digest\x12\x19\n" +
+	"\boci_type\x18\x02 \x01(\tR\aociType\"K\n" +
+	"\x14TransferLayerRequest\x12\x1b\n" +
+	"\tfile_path\x18\x01 \x01(\tR\bfilePath\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\"=\n" +
+	"\n" +
+	"LayerChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x1b\n" +
+	"\tfile_size\x18\x02 \x01(\x03R\bfileSize2\xd4\x04\n" +
+	"\vNodeService\x12l\n" +
+	"\x0fGetServiceToken\x12+.accelerboat.node.v1.GetServiceTokenRequest\x1a,.accelerboat.node.v1.GetServiceTokenResponse\x12`\n" +
+	"\vGetManifest\x12'.accelerboat.node.v1.GetManifestRequest\x1a(.accelerboat.node.v1.GetManifestResponse\x12X\n" +
+	"\fGetLayerInfo\x12(.accelerboat.node.v1.GetLayerInfoRequest\x1a\x1e.accelerboat.node.v1.LayerInfo\x12`\n" +
+	"\x10CheckStaticLayer\x12,.accelerboat.node.v1.CheckStaticLayerRequest\x1a\x1e.accelerboat.node.v1.LayerInfo\x12Z\n" +
+	"\rCheckOCILayer\x12).accelerboat.node.v1.CheckOCILayerRequest\x1a\x1e.accelerboat.node.v1.LayerInfo\x12]\n" +
+	"\rTransferLayer\x12).accelerboat.node.v1.TransferLayerRequest\x1a\x1f.accelerboat.node.v1.LayerChunk0\x01B?Z=github.com/penglongli/accelerboat/pkg/server/customapi/nodepbb\x06proto3"
+
+var (
+	file_node_proto_rawDescOnce sync.Once
+	file_node_proto_rawDescData []byte
+)
+
+func file_node_proto_rawDescGZIP() []byte {
+	file_node_proto_rawDescOnce.Do(func() {
+		file_node_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_node_proto_rawDesc), len(file_node_proto_rawDesc)))
+	})
+	return file_node_proto_rawDescData
+}
+
+var file_node_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_node_proto_goTypes = []any{
+	(*HeaderValues)(nil),            // 0: accelerboat.node.v1.HeaderValues
+	(*GetServiceTokenRequest)(nil),  // 1: accelerboat.node.v1.GetServiceTokenRequest
+	(*GetServiceTokenResponse)(nil), // 2: accelerboat.node.v1.GetServiceTokenResponse
+	(*GetManifestRequest)(nil),      // 3: accelerboat.node.v1.GetManifestRequest
+	(*GetManifestResponse)(nil),     // 4: accelerboat.node.v1.GetManifestResponse
+	(*GetLayerInfoRequest)(nil),     // 5: accelerboat.node.v1.GetLayerInfoRequest
+	(*LayerInfo)(nil),               // 6: accelerboat.node.v1.LayerInfo
+	(*CheckStaticLayerRequest)(nil), // 7: accelerboat.node.v1.CheckStaticLayerRequest
+	(*CheckOCILayerRequest)(nil),    // 8: accelerboat.node.v1.CheckOCILayerRequest
+	(*TransferLayerRequest)(nil),    // 9: accelerboat.node.v1.TransferLayerRequest
+	(*LayerChunk)(nil),              // 10: accelerboat.node.v1.LayerChunk
+	nil,                             // 11: accelerboat.node.v1.GetServiceTokenRequest.HeadersEntry
+	nil,                             // 12: accelerboat.node.v1.GetManifestRequest.HeadersEntry
+	nil,                             // 13: accelerboat.node.v1.GetLayerInfoRequest.HeadersEntry
+}
+var file_node_proto_depIdxs = []int32{
+	11, // 0: accelerboat.node.v1.GetServiceTokenRequest.headers:type_name -> accelerboat.node.v1.GetServiceTokenRequest.HeadersEntry
+	12, // 1: accelerboat.node.v1.GetManifestRequest.headers:type_name -> accelerboat.node.v1.GetManifestRequest.HeadersEntry
+	13, // 2: accelerboat.node.v1.GetLayerInfoRequest.headers:type_name -> accelerboat.node.v1.GetLayerInfoRequest.HeadersEntry
+	0,  // 3: accelerboat.node.v1.GetServiceTokenRequest.HeadersEntry.value:type_name -> accelerboat.node.v1.HeaderValues
+	0,  // 4: accelerboat.node.v1.GetManifestRequest.HeadersEntry.value:type_name -> accelerboat.node.v1.HeaderValues
+	0,  // 5: accelerboat.node.v1.GetLayerInfoRequest.HeadersEntry.value:type_name -> accelerboat.node.v1.HeaderValues
+	1,  // 6: accelerboat.node.v1.NodeService.GetServiceToken:input_type -> accelerboat.node.v1.GetServiceTokenRequest
+	3,  // 7: accelerboat.node.v1.NodeService.GetManifest:input_type -> accelerboat.node.v1.GetManifestRequest
+	5,  // 8: accelerboat.node.v1.NodeService.GetLayerInfo:input_type -> accelerboat.node.v1.GetLayerInfoRequest
+	7,  // 9: accelerboat.node.v1.NodeService.CheckStaticLayer:input_type -> accelerboat.node.v1.CheckStaticLayerRequest
+	8,  // 10: accelerboat.node.v1.NodeService.CheckOCILayer:input_type -> accelerboat.node.v1.CheckOCILayerRequest
+	9,  // 11: accelerboat.node.v1.NodeService.TransferLayer:input_type -> accelerboat.node.v1.TransferLayerRequest
+	2,  // 12: accelerboat.node.v1.NodeService.GetServiceToken:output_type -> accelerboat.node.v1.GetServiceTokenResponse
+	4,  // 13: accelerboat.node.v1.NodeService.GetManifest:output_type -> accelerboat.node.v1.GetManifestResponse
+	6,  // 14: accelerboat.node.v1.NodeService.GetLayerInfo:output_type -> accelerboat.node.v1.LayerInfo
+	6,  // 15: accelerboat.node.v1.NodeService.CheckStaticLayer:output_type -> accelerboat.node.v1.LayerInfo
+	6,  // 16: accelerboat.node.v1.NodeService.CheckOCILayer:output_type -> accelerboat.node.v1.LayerInfo
+	10, // 17: accelerboat.node.v1.NodeService.TransferLayer:output_type -> accelerboat.node.v1.LayerChunk
+	12, // [12:18] is the sub-list for method output_type
+	6,  // [6:12] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_node_proto_init() }
+func file_node_proto_init() {
+	if File_node_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_node_proto_rawDesc), len(file_node_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_node_proto_goTypes,
+		DependencyIndexes: file_node_proto_depIdxs,
+		MessageInfos:      file_node_proto_msgTypes,
+	}.Build()
+	File_node_proto = out.File
+	file_node_proto_goTypes = nil
+	file_node_proto_depIdxs = nil
+}
@@ -0,0 +1,337 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: node.proto
+
+package nodepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	NodeService_GetServiceToken_FullMethodName  = "/accelerboat.node.v1.NodeService/GetServiceToken"
+	NodeService_GetManifest_FullMethodName      = "/accelerboat.node.v1.NodeService/GetManifest"
+	NodeService_GetLayerInfo_FullMethodName     = "/accelerboat.node.v1.NodeService/GetLayerInfo"
+	NodeService_CheckStaticLayer_FullMethodName = "/accelerboat.node.v1.NodeService/CheckStaticLayer"
+	NodeService_CheckOCILayer_FullMethodName    = "/accelerboat.node.v1.NodeService/CheckOCILayer"
+	NodeService_TransferLayer_FullMethodName    = "/accelerboat.node.v1.NodeService/TransferLayer"
+)
+
+// NodeServiceClient is the client API for NodeService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// NodeService is the internal API between nodes, the nodes request master for the service tokens,
+// manifests and layers, and master checks the layers located on the nodes.
+type NodeServiceClient interface {
+	// GetServiceToken returns the service token of registry from master
+	GetServiceToken(ctx context.Context, in *GetServiceTokenRequest, opts ...grpc.CallOption) (*GetServiceTokenResponse, error)
+	// GetManifest returns the manifest from master
+	GetManifest(ctx context.Context, in *GetManifestRequest, opts ...grpc.CallOption) (*GetManifestResponse, error)
+	// GetLayerInfo returns the location of layer from master
+	GetLayerInfo(ctx context.Context, in *GetLayerInfoRequest, opts ...grpc.CallOption) (*LayerInfo, error)
+	// CheckStaticLayer checks the static layer located on node
+	CheckStaticLayer(ctx context.Context, in *CheckStaticLayerRequest, opts ...grpc.CallOption) (*LayerInfo, error)
+	// CheckOCILayer checks the oci layer located on node
+	CheckOCILayer(ctx context.Context, in *CheckOCILayerRequest, opts ...grpc.CallOption) (*LayerInfo, error)
+	// TransferLayer streams the layer file from offset
+	TransferLayer(ctx context.Context, in *TransferLayerRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LayerChunk], error)
+}
+
+type nodeServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNodeServiceClient(cc grpc.ClientConnInterface) NodeServiceClient {
+	return &nodeServiceClient{cc}
+}
+
+func (c *nodeServiceClient) GetServiceToken(ctx context.Context, in *GetServiceTokenRequest, opts ...grpc.CallOption) (*GetServiceTokenResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetServiceTokenResponse)
+	err := c.cc.Invoke(ctx, NodeService_GetServiceToken_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) GetManifest(ctx context.Context, in *GetManifestRequest, opts ...grpc.CallOption) (*GetManifestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetManifestResponse)
+	err := c.cc.Invoke(ctx, NodeService_GetManifest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) GetLayerInfo(ctx context.Context, in *GetLayerInfoRequest, opts ...grpc.CallOption) (*LayerInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LayerInfo)
+	err := c.cc.Invoke(ctx, NodeService_GetLayerInfo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) CheckStaticLayer(ctx context.Context, in *CheckStaticLayerRequest, opts ...grpc.CallOption) (*LayerInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LayerInfo)
+	err := c.cc.Invoke(ctx, NodeService_CheckStaticLayer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) CheckOCILayer(ctx context.Context, in *CheckOCILayerRequest, opts ...grpc.CallOption) (*LayerInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LayerInfo)
+	err := c.cc.Invoke(ctx, NodeService_CheckOCILayer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) TransferLayer(ctx context.Context, in *TransferLayerRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LayerChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &NodeService_ServiceDesc.Streams[0], NodeService_TransferLayer_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TransferLayerRequest, LayerChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NodeService_TransferLayerClient = grpc.ServerStreamingClient[LayerChunk]
+
+// NodeServiceServer is the server API for NodeService service.
+// All implementations must embed UnimplementedNodeServiceServer
+// for forward compatibility.
+//
+// NodeService is the internal API between nodes, the nodes request master for the service tokens,
+// manifests and layers, and master checks the layers located on the nodes.
+type NodeServiceServer interface {
+	// GetServiceToken returns the service token of registry from master
+	GetServiceToken(context.Context, *GetServiceTokenRequest) (*GetServiceTokenResponse, error)
+	// GetManifest returns the manifest from master
+	GetManifest(context.Context, *GetManifestRequest) (*GetManifestResponse, error)
+	// GetLayerInfo returns the location of layer from master
+	GetLayerInfo(context.Context, *GetLayerInfoRequest) (*LayerInfo, error)
+	// CheckStaticLayer checks the static layer located on node
+	CheckStaticLayer(context.Context, *CheckStaticLayerRequest) (*LayerInfo, error)
+	// CheckOCILayer checks the oci layer located on node
+	CheckOCILayer(context.Context, *CheckOCILayerRequest) (*LayerInfo, error)
+	// TransferLayer streams the layer file from offset
+	TransferLayer(*TransferLayerRequest, grpc.ServerStreamingServer[LayerChunk]) error
+	mustEmbedUnimplementedNodeServiceServer()
+}
+
+// UnimplementedNodeServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedNodeServiceServer struct{}
+
+func (UnimplementedNodeServiceServer) GetServiceToken(context.Context, *GetServiceTokenRequest) (*GetServiceTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServiceToken not implemented")
+}
+func (UnimplementedNodeServiceServer) GetManifest(context.Context, *GetManifestRequest) (*GetManifestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetManifest not implemented")
+}
+func (UnimplementedNodeServiceServer) GetLayerInfo(context.Context, *GetLayerInfoRequest) (*LayerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLayerInfo not implemented")
+}
+func (UnimplementedNodeServiceServer) CheckStaticLayer(context.Context, *CheckStaticLayerRequest) (*LayerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckStaticLayer not implemented")
+}
+func (UnimplementedNodeServiceServer) CheckOCILayer(context.Context, *CheckOCILayerRequest) (*LayerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckOCILayer not implemented")
+}
+func (UnimplementedNodeServiceServer) TransferLayer(*TransferLayerRequest, grpc.ServerStreamingServer[LayerChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method TransferLayer not implemented")
+}
+func (UnimplementedNodeServiceServer) mustEmbedUnimplementedNodeServiceServer() {}
+func (UnimplementedNodeServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafeNodeServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NodeServiceServer will
+// result in compilation errors.
+type UnsafeNodeServiceServer interface {
+	mustEmbedUnimplementedNodeServiceServer()
+}
+
+func RegisterNodeServiceServer(s grpc.ServiceRegistrar, srv NodeServiceServer) {
+	// If the following call pancis, it indicates UnimplementedNodeServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&NodeService_ServiceDesc, srv)
+}
+
+func _NodeService_GetServiceToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServiceTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetServiceToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_GetServiceToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetServiceToken(ctx, req.(*GetServiceTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_GetManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetManifestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_GetManifest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetManifest(ctx, req.(*GetManifestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_GetLayerInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLayerInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetLayerInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_GetLayerInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetLayerInfo(ctx, req.(*GetLayerInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_CheckStaticLayer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckStaticLayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).CheckStaticLayer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_CheckStaticLayer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).CheckStaticLayer(ctx, req.(*CheckStaticLayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_CheckOCILayer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckOCILayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).CheckOCILayer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_CheckOCILayer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).CheckOCILayer(ctx, req.(*CheckOCILayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_TransferLayer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TransferLayerRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NodeServiceServer).TransferLayer(m, &grpc.GenericServerStream[TransferLayerRequest, LayerChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NodeService_TransferLayerServer = grpc.ServerStreamingServer[LayerChunk]
+
+// NodeService_ServiceDesc is the grpc.ServiceDesc for NodeService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var NodeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "accelerboat.node.v1.NodeService",
+	HandlerType: (*NodeServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetServiceToken",
+			Handler:    _NodeService_GetServiceToken_Handler,
+		},
+		{
+			MethodName: "GetManifest",
+			Handler:    _NodeService_GetManifest_Handler,
+		},
+		{
+			MethodName: "GetLayerInfo",
+			Handler:    _NodeService_GetLayerInfo_Handler,
+		},
+		{
+			MethodName: "CheckStaticLayer",
+			Handler:    _NodeService_CheckStaticLayer_Handler,
+		},
+		{
+			MethodName: "CheckOCILayer",
+			Handler:    _NodeService_CheckOCILayer_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TransferLayer",
+			Handler:       _NodeService_TransferLayer_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "node.proto",
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/layerscan"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/requester"
+	"github.com/penglongli/accelerboat/pkg/utils"
+	"github.com/penglongli/accelerboat/pkg/watchdog"
+)
+
+// parentTokenHeader the header of token in the requests of child cluster to parent
+const parentTokenHeader = "X-Accelerboat-Parent-Token"
+
+// downloadLayerFromParent downloads the layer from the parent cluster, the content is verified with the
+// digest before moving to destPath. The download is watched by watchdog, the slow WAN link is not retried.
+func (h *CustomHandler) downloadLayerFromParent(ctx context.Context, req *apitypes.DownloadLayerRequest,
+	destPath string) error {
+	layerFullPath := path.Join(h.op().StorageConfig.DownloadPath, utils.LayerFileName(req.Digest))
+	watchCtx, stop := watchdog.Watch(ctx, "parent", req.Digest, func() int64 {
+		if fi, statErr := os.Stat(layerFullPath); statErr == nil {
+			return fi.Size()
+		}
+		return 0
+	})
+	defer stop()
+	size, err := h.fetchParentLayer(watchCtx, req, layerFullPath)
+	if err != nil {
+		metrics.ParentLayerTotal.WithLabelValues("failed").Inc()
+		if watchdog.IsStalled(watchCtx, err) {
+			return errors.Wrapf(context.Cause(watchCtx), "download layer from parent aborted")
+		}
+		return err
+	}
+	if err = h.promoteLayer(ctx, &layerscan.Layer{Digest: req.Digest, Path: layerFullPath,
+		Registry: req.OriginalHost, Repo: req.Repo}, destPath); err != nil {
+		return err
+	}
+	metrics.ParentLayerTotal.WithLabelValues("hit").Inc()
+	metrics.TransferSize.WithLabelValues("download_parent").Add(float64(size) / 1e9)
+	logger.InfoContextf(ctx, "download layer '%s' from parent successfully", destPath)
+	return nil
+}
+
+func (h *CustomHandler) fetchParentLayer(ctx context.Context, req *apitypes.DownloadLayerRequest,
+	layerFullPath string) (int64, error) {
+	parentReq := &apitypes.DownloadLayerRequest{
+		OriginalHost: req.OriginalHost,
+		LayerUrl:     req.LayerUrl,
+		Headers:      req.Headers,
+		Repo:         req.Repo,
+		Digest:       req.Digest,
+	}
+	parentReq.SetAPIVersion(apitypes.CurrentAPIVersion)
+	bs, err := json.Marshal(parentReq)
+	if err != nil {
+		return 0, errors.Wrapf(err, "marshal request failed")
+	}
+	endpoint := h.op().Parent.Endpoint
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+apitypes.APIParentLayer,
+		bytes.NewReader(bs))
+	if err != nil {
+		return 0, errors.Wrapf(err, "create http.request failed")
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(parentTokenHeader, h.op().Parent.Token)
+	logger.InfoContextf(ctx, "starting download layer from parent '%s'", endpoint)
+	// the parent is requested through the proxy configured, it is usually across WAN
+	client := &http.Client{Transport: h.op().HTTPProxyTransport()}
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, errors.Wrapf(err, "request parent '%s' failed", endpoint)
+	}
+	defer resp.Body.Close()
+	size, err := h.fetchVerifiedLayer(resp, req.Digest, layerFullPath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "download layer from parent '%s' failed", endpoint)
+	}
+	return size, nil
+}
+
+// ParentLayer serves the layer to the child cluster, the layer is located by the master of this cluster
+// which downloads it from parent or original registry if not cached
+func (h *CustomHandler) ParentLayer(c *gin.Context) (interface{}, error) {
+	childToken := h.op().Parent.ChildToken
+	if childToken == "" {
+		return nil, errors.Errorf("serving child clusters not enabled")
+	}
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader(parentTokenHeader)), []byte(childToken)) != 1 {
+		return nil, errors.Errorf("parent token not matched")
+	}
+	req := &apitypes.DownloadLayerRequest{}
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
+	}
+	if err := h.checkOriginalHost(req.OriginalHost); err != nil {
+		return nil, err
+	}
+	ctx := c.Request.Context()
+	located, master, err := requester.DownloadLayerFromMaster(ctx, req, req.Digest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get layer from master '%s' failed", master)
+	}
+	body, err := h.openLocatedLayer(ctx, located)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	c.Header("Content-Length", strconv.FormatInt(located.FileSize, 10))
+	c.Status(http.StatusOK)
+	size, err := io.Copy(c.Writer, body)
+	if err != nil {
+		logger.ErrorContextf(ctx, "serve layer to child cluster failed: %s", err.Error())
+	} else {
+		logger.InfoContextf(ctx, "serve layer to child cluster success")
+	}
+	metrics.TransferSize.WithLabelValues("serve_child").Add(float64(size) / 1e9)
+	return nil, nil
+}
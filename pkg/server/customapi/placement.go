@@ -0,0 +1,90 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/hashring"
+	"github.com/penglongli/accelerboat/pkg/store"
+)
+
+// hashRingLocked returns the hash ring of the endpoints, it is rebuilt only if the endpoints changed.
+// The nodeDownloadLock must be held.
+func (h *CustomHandler) hashRingLocked(eps []string) *hashring.Ring {
+	sorted := append([]string{}, eps...)
+	sort.Strings(sorted)
+	key := strings.Join(sorted, ",")
+	if h.ring == nil || h.ringKey != key {
+		h.ring = hashring.New(sorted, h.op().Placement.VirtualNodes)
+		h.ringKey = key
+	}
+	return h.ring
+}
+
+// ownerNodeLocked returns the owner of digest with the least download tasks. The nodes after the owners
+// are used in ring order if all owners are tried or not candidates, returns empty if no node can be used.
+// The nodeDownloadLock must be held.
+func (h *CustomHandler) ownerNodeLocked(digest string, eps []string, candidates,
+	tried map[string]struct{}) string {
+	nodes := h.hashRingLocked(eps).Owners(digest, 0)
+	usable := func(node string) bool {
+		_, isCandidate := candidates[node]
+		_, isTried := tried[node]
+		return isCandidate && !isTried
+	}
+	var result string
+	owners := min(h.op().Placement.Owners, len(nodes))
+	for _, node := range nodes[:owners] {
+		if !usable(node) {
+			continue
+		}
+		if result == "" || h.nodeDownloadTasks[node] < h.nodeDownloadTasks[result] {
+			result = node
+		}
+	}
+	if result != "" {
+		return result
+	}
+	for _, node := range nodes[owners:] {
+		if usable(node) {
+			return node
+		}
+	}
+	return ""
+}
+
+// preferOwners moves the layers located on the owners of digest to the front in owner order, so the
+// clients are served by the owners and the copies on the other nodes are used only if the owners failed
+func (h *CustomHandler) preferOwners(digest string, layers []*store.LayerLocatedInfo) []*store.LayerLocatedInfo {
+	if h.op().Placement.Mode != options.PlacementConsistentHash || len(layers) < 2 {
+		return layers
+	}
+	h.nodeDownloadLock.Lock()
+	owners := h.hashRingLocked(leaderselector.Endpoints()).Owners(digest, h.op().Placement.Owners)
+	h.nodeDownloadLock.Unlock()
+
+	// the layers are located by node ip, the endpoints are 'ip:port'
+	rank := make(map[string]int, len(owners))
+	for i, owner := range owners {
+		if host, _, err := net.SplitHostPort(owner); err == nil {
+			rank[host] = i
+		}
+	}
+	rankOf := func(layer *store.LayerLocatedInfo) int {
+		if r, ok := rank[layer.Located]; ok {
+			return r
+		}
+		return len(owners)
+	}
+	sort.SliceStable(layers, func(i, j int) bool {
+		return rankOf(layers[i]) < rankOf(layers[j])
+	})
+	return layers
+}
@@ -0,0 +1,40 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/preheat"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// PreheatHistory returns the recent preheat runs on this node, filtered by query 'task' (namespace/name)
+func (h *CustomHandler) PreheatHistory(c *gin.Context) (interface{}, error) {
+	return &apitypes.PreheatHistoryResponse{Runs: preheat.History(c.Query("task"))}, nil
+}
+
+// RegistryWebhook receives the push notifications of Harbor or registry:2, and preheats the pushed images of
+// the configured repositories. The notification should be signed with the webhook secret, or carry the
+// webhook token as bearer authorization.
+func (h *CustomHandler) RegistryWebhook(c *gin.Context) (interface{}, error) {
+	op := h.op()
+	if !op.Preheat.Webhook.Enable {
+		return nil, errors.Errorf("registry webhook is disabled")
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read notification failed")
+	}
+	wc := &op.Preheat.Webhook
+	if !preheat.VerifyToken(wc.Token, c.GetHeader("Authorization")) &&
+		(wc.Secret == "" || !preheat.VerifySignature(wc.Secret, body, c.GetHeader(apitypes.WebhookSignatureHeader))) {
+		return nil, apitypes.ErrWebhookUnauthorized
+	}
+	return preheat.HandleNotification(c.Request.Context(), op, body)
+}
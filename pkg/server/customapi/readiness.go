@@ -0,0 +1,26 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// readinessJSON defines the response of readiness
+type readinessJSON struct {
+	Ready         bool `json:"ready"`
+	Degraded      bool `json:"degraded"`
+	PendingWrites int  `json:"pendingWrites"`
+}
+
+// Readiness returns the readiness of node. The node keeps ready while the cache store is degraded, the
+// layers are still served from local and the writes are replayed when redis returns.
+func (h *CustomHandler) Readiness(c *gin.Context) (interface{}, error) {
+	return &readinessJSON{
+		Ready:         true,
+		Degraded:      h.cacheStore.Degraded(),
+		PendingWrites: h.cacheStore.PendingWrites(),
+	}, nil
+}
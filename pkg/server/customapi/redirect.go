@@ -0,0 +1,62 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/utils"
+	"github.com/penglongli/accelerboat/pkg/utils/httpfile"
+)
+
+// RedirectBlob serves the layer file to the client redirected by other nodes, the query params
+// digest/file/expires are signed by the redirecting node with the secret of client redirect
+func (h *CustomHandler) RedirectBlob(c *gin.Context) (interface{}, error) {
+	conf := h.op().ClientRedirect
+	if !conf.Enable {
+		return nil, errors.Errorf("client redirect is not enabled")
+	}
+	digest, file := c.Query("digest"), c.Query("file")
+	if digest == "" || file == "" {
+		return nil, errors.Errorf("query param 'digest' and 'file' cannot be empty")
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse query param 'expires' failed")
+	}
+	if err = utils.VerifyBlobSignature(conf.Secret, digest, file, expires, c.Query("signature")); err != nil {
+		return nil, errors.Wrapf(err, "verify redirect of blob '%s' failed", digest)
+	}
+	if file, err = h.resolveLayerFile(file); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "stat layer file '%s' failed", file)
+	}
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Docker-Content-Digest", "sha256:"+digest)
+	ioConfig := h.op().LocalServe.IO
+	if err = httpfile.HTTPServeFile(ctx, c.Writer, c.Request, file, &httpfile.ReadOptions{
+		Mode:       httpfile.ReadMode(ioConfig.Mode),
+		BufferSize: ioConfig.BufferSize * 1024,
+		Fadvise:    ioConfig.Fadvise,
+	}); err != nil {
+		if !c.Writer.Written() {
+			return nil, err
+		}
+		logger.WarnContextf(ctx, "serve redirected blob '%s' broken: %s", file, err.Error())
+		return nil, nil
+	}
+	metrics.TransferSize.WithLabelValues("serve_blob_by_redirect").Add(float64(fi.Size()) / 1e9)
+	return nil, nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
 	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
 	"github.com/penglongli/accelerboat/pkg/server/common"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
 	"github.com/penglongli/accelerboat/pkg/utils/httputils"
@@ -27,22 +28,70 @@ func commonHeaders(ctx context.Context) map[string]string {
 	reqID := logger.GetContextField(ctx, common.RequestIDHeaderKey)
 	if reqID != "" {
 		result[common.RequestIDHeaderKey] = reqID
+		if traceparent := common.BuildTraceparent(reqID); traceparent != "" {
+			result[common.TraceparentHeaderKey] = traceparent
+		}
 	}
 	return result
 }
 
+// sendToMaster sends the request of master-only API to master. The node not master responds 421 with the
+// master it watched, the request is resent to that master once, so the change of master is followed before
+// this node watched it.
+func sendToMaster(ctx context.Context, master, api string, req apitypes.Versioned) (string, *http.Response,
+	[]byte, error) {
+	send := func(master string) (*http.Response, []byte, error) {
+		return httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
+			Url:    fmt.Sprintf("http://%s%s", master, api),
+			Method: http.MethodPost,
+			Body:   versioned(req),
+			Header: commonHeaders(ctx),
+		})
+	}
+	resp, body, err := send(master)
+	if resp != nil && resp.StatusCode == http.StatusMisdirectedRequest {
+		nmErr := &apitypes.NotMasterError{Master: resp.Header.Get(apitypes.MasterAddressHeader)}
+		if next := followMaster(ctx, master, nmErr); next != "" {
+			master = next
+			resp, body, err = send(master)
+		}
+	}
+	return master, resp, body, err
+}
+
+// followMaster returns the master told by the node not master, returns empty if err is not NotMasterError
+// or the master is the same
+func followMaster(ctx context.Context, prev string, err error) string {
+	var nmErr *apitypes.NotMasterError
+	if !errors.As(err, &nmErr) || nmErr.Master == "" || nmErr.Master == prev {
+		return ""
+	}
+	logger.WarnContextf(ctx, "node '%s' is not master, follow to master '%s'", prev, nmErr.Master)
+	metrics.MisdirectedRequestsTotal.WithLabelValues("followed").Inc()
+	return nmErr.Master
+}
+
 // GetServiceToken get token from master
 func GetServiceToken(ctx context.Context, req *apitypes.GetServiceTokenRequest) (string, string, error) {
 	master := leaderselector.CurrentMaster()
+	if useGRPC(ctx, master) {
+		token, err := getServiceTokenGRPC(ctx, master, req)
+		if next := followMaster(ctx, master, err); next != "" {
+			master = next
+			token, err = getServiceTokenGRPC(ctx, master, req)
+		}
+		if err == nil || !FallbackToHTTP(err) {
+			return master, token, err
+		}
+		logger.WarnContextf(ctx, "get service-token with grpc failed and will use http: %s", err.Error())
+	}
 	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	body, err := httputils.SendHTTPRequest(newCtx, &httputils.HTTPRequest{
-		Url:    fmt.Sprintf("http://%s%s", master, apitypes.APIGetServiceToken),
-		Method: http.MethodPost,
-		Body:   req,
-		Header: commonHeaders(ctx),
-	})
+	master, resp, body, err := sendToMaster(newCtx, master, apitypes.APIGetServiceToken, req)
 	if err != nil {
+		if upErr := apitypes.ParseUpstreamStatusError(resp, err); upErr != nil {
+			return master, "", errors.Wrapf(upErr, "get service-token failed")
+		}
 		return master, "", errors.Wrapf(err, "get service-token failed")
 	}
 	token := strings.TrimSpace(string(body))
@@ -53,16 +102,14 @@ func GetServiceToken(ctx context.Context, req *apitypes.GetServiceTokenRequest)
 }
 
 func HeadManifest(ctx context.Context, req *apitypes.HeadManifestRequest) (string, map[string][]string, error) {
-	master := leaderselector.CurrentMaster()
 	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	body, err := httputils.SendHTTPRequest(newCtx, &httputils.HTTPRequest{
-		Url:    fmt.Sprintf("http://%s%s", master, apitypes.APIHeadManifest),
-		Method: http.MethodPost,
-		Body:   req,
-		Header: commonHeaders(ctx),
-	})
+	master, httpResp, body, err := sendToMaster(newCtx, leaderselector.CurrentMaster(), apitypes.APIHeadManifest,
+		req)
 	if err != nil {
+		if upErr := apitypes.ParseUpstreamStatusError(httpResp, err); upErr != nil {
+			return master, nil, errors.Wrapf(upErr, "head image digest failed")
+		}
 		return master, nil, errors.Wrapf(err, "head image digest failed")
 	}
 	resp := new(apitypes.HeadManifestResponse)
@@ -75,15 +122,31 @@ func HeadManifest(ctx context.Context, req *apitypes.HeadManifestRequest) (strin
 // GetManifest get manifest from master
 func GetManifest(ctx context.Context, req *apitypes.GetManifestRequest) (string, string, error) {
 	master := leaderselector.CurrentMaster()
+	if useGRPC(ctx, master) {
+		manifest, err := getManifestGRPC(ctx, master, req)
+		if next := followMaster(ctx, master, err); next != "" {
+			master = next
+			manifest, err = getManifestGRPC(ctx, master, req)
+		}
+		if err == nil && manifest == "" {
+			return master, manifest, errors.New("empty manifest")
+		}
+		if err == nil || !FallbackToHTTP(err) {
+			return master, manifest, err
+		}
+		logger.WarnContextf(ctx, "get manifest with grpc failed and will use http: %s", err.Error())
+	}
 	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	body, err := httputils.SendHTTPRequest(newCtx, &httputils.HTTPRequest{
-		Url:    fmt.Sprintf("http://%s%s", master, apitypes.APIGetManifest),
-		Method: http.MethodPost,
-		Body:   req,
-		Header: commonHeaders(ctx),
-	})
+	master, resp, body, err := sendToMaster(newCtx, master, apitypes.APIGetManifest, req)
 	if err != nil {
+		if upErr := apitypes.ParseUpstreamStatusError(resp, err); upErr != nil {
+			return master, "", errors.Wrapf(upErr, "get manifest failed")
+		}
+		if resp != nil && resp.StatusCode == http.StatusForbidden {
+			return master, "", errors.Wrapf(apitypes.ErrSignatureVerifyFailed, "get manifest failed: %s",
+				err.Error())
+		}
 		return master, "", errors.Wrapf(err, "get manifest failed")
 	}
 	manifest := strings.TrimSpace(string(body))
@@ -97,12 +160,25 @@ func GetManifest(ctx context.Context, req *apitypes.GetManifestRequest) (string,
 func DownloadLayerFromMaster(ctx context.Context, req *apitypes.DownloadLayerRequest, digest string) (
 	*apitypes.DownloadLayerResponse, string, error) {
 	master := leaderselector.CurrentMaster()
-	body, err := httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
-		Url:    fmt.Sprintf("http://%s%s", master, apitypes.APIGetLayerInfo),
-		Method: http.MethodPost,
-		Body:   req,
-	})
+	if useGRPC(ctx, master) {
+		resp, err := getLayerInfoGRPC(ctx, master, req)
+		if next := followMaster(ctx, master, err); next != "" {
+			master = next
+			resp, err = getLayerInfoGRPC(ctx, master, req)
+		}
+		if err == nil || !FallbackToHTTP(err) {
+			return resp, master, err
+		}
+		logger.WarnContextf(ctx, "get layer with grpc failed and will use http: %s", err.Error())
+	}
+	master, httpResp, body, err := sendToMaster(ctx, master, apitypes.APIGetLayerInfo, req)
 	if err != nil {
+		if upErr := apitypes.ParseUpstreamStatusError(httpResp, err); upErr != nil {
+			return nil, master, errors.Wrapf(upErr, "get layer failed")
+		}
+		if httpResp != nil && httpResp.StatusCode == http.StatusForbidden {
+			return nil, master, errors.Wrapf(apitypes.ErrLayerBlocked, "get layer failed: %s", err.Error())
+		}
 		return nil, master, errors.Wrapf(err, "get layer failed")
 	}
 	resp := new(apitypes.DownloadLayerResponse)
@@ -116,10 +192,18 @@ func DownloadLayerFromMaster(ctx context.Context, req *apitypes.DownloadLayerReq
 func CheckStaticLayer(ctx context.Context, target string, req *apitypes.CheckStaticLayerRequest) (
 	*apitypes.CheckStaticLayerResponse, error) {
 	op := options.GlobalOptions()
+	if useGRPC(ctx, target) {
+		resp, err := checkStaticLayerGRPC(ctx, target, req)
+		if err == nil || !FallbackToHTTP(err) {
+			return resp, err
+		}
+		logger.WarnContextf(ctx, "check static-layer with grpc failed and will use http: %s", err.Error())
+	}
 	body, err := httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
 		Url:    fmt.Sprintf("http://%s:%d%s", target, op.HTTPPort, apitypes.APICheckStaticLayer), // nolint
 		Method: http.MethodGet,
-		Body:   req,
+		Body:   versioned(req),
+		Header: commonHeaders(ctx),
 	})
 	if err != nil {
 		return nil, errors.Wrapf(err, "check static-layer failed")
@@ -135,10 +219,18 @@ func CheckStaticLayer(ctx context.Context, target string, req *apitypes.CheckSta
 func CheckOCILayer(ctx context.Context, target string, req *apitypes.CheckOCILayerRequest) (
 	*apitypes.CheckOCILayerResponse, error) {
 	op := options.GlobalOptions()
+	if useGRPC(ctx, target) {
+		resp, err := checkOCILayerGRPC(ctx, target, req)
+		if err == nil || !FallbackToHTTP(err) {
+			return resp, err
+		}
+		logger.WarnContextf(ctx, "check oci-layer with grpc failed and will use http: %s", err.Error())
+	}
 	body, err := httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
 		Url:    fmt.Sprintf("http://%s:%d%s", target, op.HTTPPort, apitypes.APICheckOCILayer), // nolint
 		Method: http.MethodGet,
-		Body:   req,
+		Body:   versioned(req),
+		Header: commonHeaders(ctx),
 	})
 	if err != nil {
 		return nil, errors.Wrapf(err, "check oci-layer failed")
@@ -153,12 +245,17 @@ func CheckOCILayer(ctx context.Context, target string, req *apitypes.CheckOCILay
 // DownloadLayerFromNode download layer from node
 func DownloadLayerFromNode(ctx context.Context, target string, req *apitypes.DownloadLayerRequest) (
 	*apitypes.DownloadLayerResponse, error) {
-	body, err := httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
+	httpResp, body, err := httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
 		Url:    fmt.Sprintf("http://%s%s", target, apitypes.APIDownloadLayer), // nolint
 		Method: http.MethodGet,
-		Body:   req,
+		Body:   versioned(req),
+		Header: commonHeaders(ctx),
 	})
 	if err != nil {
+		if httpResp != nil && httpResp.StatusCode == http.StatusForbidden {
+			return nil, errors.Wrapf(apitypes.ErrLayerBlocked, "download layer from node failed: %s",
+				err.Error())
+		}
 		return nil, errors.Wrapf(err, "download layer from node failed")
 	}
 	resp := new(apitypes.DownloadLayerResponse)
@@ -167,3 +264,45 @@ func DownloadLayerFromNode(ctx context.Context, target string, req *apitypes.Dow
 	}
 	return resp, nil
 }
+
+// CancelDownloadLayer requests the node to cancel the layer downloading
+func CancelDownloadLayer(ctx context.Context, target string, req *apitypes.CancelDownloadLayerRequest) (
+	*apitypes.CancelDownloadLayerResponse, error) {
+	body, err := httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
+		Url:    fmt.Sprintf("http://%s%s", target, apitypes.APICancelDownload), // nolint
+		Method: http.MethodPost,
+		Body:   versioned(req),
+		Header: commonHeaders(ctx),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cancel download layer failed")
+	}
+	resp := new(apitypes.CancelDownloadLayerResponse)
+	if err = json.Unmarshal(body, resp); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal resp body failed")
+	}
+	return resp, nil
+}
+
+// FederationDownloadLayer requests the gateway node to download layer from other clusters
+func FederationDownloadLayer(ctx context.Context, gateway string, req *apitypes.DownloadLayerRequest) (
+	*apitypes.DownloadLayerResponse, error) {
+	httpResp, body, err := httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
+		Url:    fmt.Sprintf("http://%s%s", gateway, apitypes.APIFederationDownloadLayer), // nolint
+		Method: http.MethodPost,
+		Body:   versioned(req),
+		Header: commonHeaders(ctx),
+	})
+	if err != nil {
+		if httpResp != nil && httpResp.StatusCode == http.StatusForbidden {
+			return nil, errors.Wrapf(apitypes.ErrLayerBlocked, "download layer from federation failed: %s",
+				err.Error())
+		}
+		return nil, errors.Wrapf(err, "download layer from federation failed")
+	}
+	resp := new(apitypes.DownloadLayerResponse)
+	if err = json.Unmarshal(body, resp); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal resp body failed")
+	}
+	return resp, nil
+}
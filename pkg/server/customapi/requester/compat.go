@@ -0,0 +1,36 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package requester
+
+import (
+	"context"
+	"net"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/store"
+)
+
+// versioned sets the api version of this node to the request
+func versioned(req apitypes.Versioned) apitypes.Versioned {
+	req.SetAPIVersion(apitypes.CurrentAPIVersion)
+	return req
+}
+
+// NodeSupports returns whether the target node has the capability reported by its heartbeat, the
+// target may be with port. The nodes not reporting capabilities are regarded as supporting it.
+func NodeSupports(ctx context.Context, target, capability string) bool {
+	node := target
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		node = host
+	}
+	return store.GlobalRedisStore().NodeSupports(ctx, node, capability)
+}
+
+// useGRPC returns whether to request target with the internal gRPC API, the target not serving it (e.g.
+// the node of other build during rolling upgrade) is requested with http directly
+func useGRPC(ctx context.Context, target string) bool {
+	return options.GlobalOptions().InternalGRPC.Enable && NodeSupports(ctx, target, apitypes.CapabilityGRPC)
+}
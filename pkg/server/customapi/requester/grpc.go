@@ -0,0 +1,199 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package requester
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/peertls"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/nodepb"
+)
+
+// grpcServiceConfig retries the unavailable calls, the master may be switching or restarting
+const grpcServiceConfig = `{
+	"methodConfig": [{
+		"name": [{"service": "accelerboat.node.v1.NodeService"}],
+		"retryPolicy": {
+			"maxAttempts": 3,
+			"initialBackoff": "0.2s",
+			"maxBackoff": "1s",
+			"backoffMultiplier": 2,
+			"retryableStatusCodes": ["UNAVAILABLE"]
+		}
+	}]
+}`
+
+var (
+	grpcConnsLock sync.Mutex
+	grpcConns     = make(map[string]*grpc.ClientConn)
+)
+
+// grpcTarget returns the gRPC address of node, the address may be with the http port (e.g. master)
+func grpcTarget(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return net.JoinHostPort(host, strconv.FormatInt(options.GlobalOptions().InternalGRPC.Port, 10))
+}
+
+// grpcClient returns the cached client of target node
+func grpcClient(address string) (nodepb.NodeServiceClient, error) {
+	target := grpcTarget(address)
+	grpcConnsLock.Lock()
+	defer grpcConnsLock.Unlock()
+	if conn, ok := grpcConns[target]; ok {
+		return nodepb.NewNodeServiceClient(conn), nil
+	}
+	creds := insecure.NewCredentials()
+	if options.GlobalOptions().PeerTLS.Enable {
+		creds = credentials.NewTLS(peertls.Global.ClientConfig())
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(grpcServiceConfig))
+	if err != nil {
+		return nil, errors.Wrapf(err, "create grpc client for '%s' failed", target)
+	}
+	grpcConns[target] = conn
+	return nodepb.NewNodeServiceClient(conn), nil
+}
+
+func grpcContext(ctx context.Context) context.Context {
+	return metadata.NewOutgoingContext(ctx, metadata.New(commonHeaders(ctx)))
+}
+
+// FallbackToHTTP returns whether the gRPC call should fall back to the HTTP endpoints, the target node may
+// not enable the gRPC internal API yet (e.g. rolling upgrade)
+func FallbackToHTTP(err error) bool {
+	switch status.Code(errors.Cause(err)) {
+	case codes.Unimplemented, codes.Unavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+func getServiceTokenGRPC(ctx context.Context, master string, req *apitypes.GetServiceTokenRequest) (string,
+	error) {
+	client, err := grpcClient(master)
+	if err != nil {
+		return "", err
+	}
+	newCtx, cancel := context.WithTimeout(grpcContext(ctx), 10*time.Second)
+	defer cancel()
+	resp, err := client.GetServiceToken(newCtx, req.ToProto())
+	if err != nil {
+		return "", errors.Wrapf(apitypes.FromGRPCError(err), "get service-token with grpc failed")
+	}
+	bs, err := json.Marshal(apitypes.RegistryAuthTokenFromProto(resp))
+	if err != nil {
+		return "", errors.Wrapf(err, "marshal service-token failed")
+	}
+	return string(bs), nil
+}
+
+func getManifestGRPC(ctx context.Context, master string, req *apitypes.GetManifestRequest) (string, error) {
+	client, err := grpcClient(master)
+	if err != nil {
+		return "", err
+	}
+	newCtx, cancel := context.WithTimeout(grpcContext(ctx), 10*time.Second)
+	defer cancel()
+	resp, err := client.GetManifest(newCtx, req.ToProto())
+	if err != nil {
+		return "", errors.Wrapf(apitypes.FromGRPCError(err), "get manifest with grpc failed")
+	}
+	return resp.GetManifest(), nil
+}
+
+func getLayerInfoGRPC(ctx context.Context, master string, req *apitypes.DownloadLayerRequest) (
+	*apitypes.DownloadLayerResponse, error) {
+	client, err := grpcClient(master)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.GetLayerInfo(grpcContext(ctx), req.ToProto())
+	if err != nil {
+		return nil, errors.Wrapf(apitypes.FromGRPCError(err), "get layer with grpc failed")
+	}
+	return apitypes.DownloadLayerResponseFromProto(resp), nil
+}
+
+func checkStaticLayerGRPC(ctx context.Context, target string, req *apitypes.CheckStaticLayerRequest) (
+	*apitypes.CheckStaticLayerResponse, error) {
+	client, err := grpcClient(target)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.CheckStaticLayer(grpcContext(ctx), req.ToProto())
+	if err != nil {
+		return nil, errors.Wrapf(apitypes.FromGRPCError(err), "check static-layer with grpc failed")
+	}
+	return apitypes.CheckStaticLayerResponseFromProto(resp), nil
+}
+
+func checkOCILayerGRPC(ctx context.Context, target string, req *apitypes.CheckOCILayerRequest) (
+	*apitypes.CheckOCILayerResponse, error) {
+	client, err := grpcClient(target)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.CheckOCILayer(grpcContext(ctx), req.ToProto())
+	if err != nil {
+		return nil, errors.Wrapf(apitypes.FromGRPCError(err), "check oci-layer with grpc failed")
+	}
+	return apitypes.CheckOCILayerResponseFromProto(resp), nil
+}
+
+// TransferLayer streams the layer file of target from offset into writer, returns the file size of layer
+// and the written bytes. The OutOfRange code is returned if offset is not less than the file size.
+func TransferLayer(ctx context.Context, target, filePath string, offset int64, w io.Writer) (int64, int64,
+	error) {
+	client, err := grpcClient(target)
+	if err != nil {
+		return 0, 0, err
+	}
+	stream, err := client.TransferLayer(grpcContext(ctx), &nodepb.TransferLayerRequest{
+		FilePath: filePath,
+		Offset:   offset,
+	})
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "transfer layer with grpc failed")
+	}
+	var fileSize, written int64
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return fileSize, written, nil
+		}
+		if err != nil {
+			return fileSize, written, errors.Wrapf(err, "transfer layer with grpc failed")
+		}
+		if chunk.GetFileSize() != 0 {
+			fileSize = chunk.GetFileSize()
+		}
+		n, err := w.Write(chunk.GetData())
+		written += int64(n)
+		if err != nil {
+			return fileSize, written, errors.Wrapf(err, "write layer chunk failed")
+		}
+	}
+}
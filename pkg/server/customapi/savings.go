@@ -0,0 +1,97 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/savings"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	// savingsSinceDefault the default days of savings report
+	savingsSinceDefault = 30
+	// savingsSinceMax the max days of savings report
+	savingsSinceMax = 400
+	bytesPerGB      = 1 << 30
+)
+
+// Savings returns the report of the bytes downloaded from original registries compared with the bytes served
+// to clients since 'since'(e.g. 30d, today included), the egress cost avoided is estimated with 'costPerGB'
+// (the configured by default)
+func (h *CustomHandler) Savings(c *gin.Context) (interface{}, error) {
+	if !h.op().Savings.Enable {
+		return nil, errors.Errorf("savings is not enabled")
+	}
+	days, err := parseSinceDays(c.Query("since"))
+	if err != nil {
+		return nil, err
+	}
+	costPerGB := h.op().Savings.CostPerGB
+	if s := c.Query("costPerGB"); s != "" {
+		if costPerGB, err = strconv.ParseFloat(s, 64); err != nil || costPerGB < 0 {
+			return nil, errors.Errorf("invalid query param costPerGB '%s'", s)
+		}
+	}
+	now := time.Now().UTC()
+	dates := make([]string, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		dates = append(dates, now.AddDate(0, 0, -i).Format(savings.DayLayout))
+	}
+	traffic, err := h.cacheStore.TrafficBytes(c.Request.Context(), dates)
+	if err != nil {
+		return nil, errors.Wrapf(err, "query traffic bytes failed")
+	}
+	resp := &apitypes.SavingsResponse{
+		Since:      dates[0],
+		Until:      dates[len(dates)-1],
+		CostPerGB:  costPerGB,
+		Total:      &apitypes.RegistrySavings{},
+		Registries: make([]*apitypes.RegistrySavings, 0),
+	}
+	registries := make(map[string]*apitypes.RegistrySavings)
+	for _, t := range traffic {
+		rs, ok := registries[t.Registry]
+		if !ok {
+			rs = &apitypes.RegistrySavings{Registry: t.Registry}
+			registries[t.Registry] = rs
+			resp.Registries = append(resp.Registries, rs)
+		}
+		rs.OriginBytes += t.OriginBytes
+		rs.ServedBytes += t.ServedBytes
+		rs.Days = append(rs.Days, t)
+		resp.Total.OriginBytes += t.OriginBytes
+		resp.Total.ServedBytes += t.ServedBytes
+	}
+	for _, rs := range append(resp.Registries, resp.Total) {
+		// the blobs served more than once are downloaded from original registry only once
+		rs.SavedBytes = max(rs.ServedBytes-rs.OriginBytes, 0)
+		rs.SavedCost = float64(rs.SavedBytes) / bytesPerGB * costPerGB
+	}
+	sort.Slice(resp.Registries, func(i, j int) bool {
+		return resp.Registries[i].SavedBytes > resp.Registries[j].SavedBytes
+	})
+	return resp, nil
+}
+
+// parseSinceDays parses the days of 'since' like '30d' or '30', the default is used if empty
+func parseSinceDays(since string) (int, error) {
+	if since == "" {
+		return savingsSinceDefault, nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(since, "d"))
+	if err != nil || days <= 0 || days > savingsSinceMax {
+		return 0, errors.Errorf("invalid query param since '%s', should be days like '30d' and not more "+
+			"than %d", since, savingsSinceMax)
+	}
+	return days, nil
+}
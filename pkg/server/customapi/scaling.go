@@ -0,0 +1,158 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/penglongli/accelerboat/pkg/loadsignal"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	externalMetricsGroupVersion = "external.metrics.k8s.io/v1beta1"
+
+	metricQueuedDownloads     = "accelerboat_queued_downloads"
+	metricThroughputBytes     = "accelerboat_throughput_bytes"
+	metricBandwidthSaturation = "accelerboat_bandwidth_saturation"
+	metricBlobLatencyP95      = "accelerboat_blob_latency_p95_seconds"
+)
+
+// externalMetricValues returns the quantities of external metrics from the load signals of cluster
+var externalMetricValues = map[string]func(s *apitypes.LoadSignals) *resource.Quantity{
+	metricQueuedDownloads: func(s *apitypes.LoadSignals) *resource.Quantity {
+		return resource.NewQuantity(s.QueuedDownloads, resource.DecimalSI)
+	},
+	metricThroughputBytes: func(s *apitypes.LoadSignals) *resource.Quantity {
+		return resource.NewQuantity(s.ThroughputBytes, resource.DecimalSI)
+	},
+	metricBandwidthSaturation: func(s *apitypes.LoadSignals) *resource.Quantity {
+		return resource.NewMilliQuantity(int64(s.BandwidthSaturation*1000), resource.DecimalSI)
+	},
+	metricBlobLatencyP95: func(s *apitypes.LoadSignals) *resource.Quantity {
+		return resource.NewMilliQuantity(s.BlobLatencyP95Ms, resource.DecimalSI)
+	},
+}
+
+// externalMetricValue defines the ExternalMetricValue of external.metrics.k8s.io/v1beta1
+type externalMetricValue struct {
+	MetricName   string             `json:"metricName"`
+	MetricLabels map[string]string  `json:"metricLabels"`
+	Timestamp    metav1.Time        `json:"timestamp"`
+	Value        *resource.Quantity `json:"value"`
+}
+
+// externalMetricValueList defines the ExternalMetricValueList of external.metrics.k8s.io/v1beta1
+type externalMetricValueList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []*externalMetricValue `json:"items"`
+}
+
+// ScalingSignals returns the load signals of the nodes reported with heartbeats and the aggregated of
+// cluster, it is consumed by the metrics-api scaler of KEDA
+func (h *CustomHandler) ScalingSignals(c *gin.Context) (interface{}, error) {
+	if !h.op().Autoscaling.Enable {
+		return nil, errors.Errorf("autoscaling is not enabled")
+	}
+	return h.scalingSignals(c.Request.Context())
+}
+
+// scalingSignals aggregates the load signals of nodes, the signals of this node are the latest. The nodes
+// not reporting signals(legacy or autoscaling not enabled) are not counted.
+func (h *CustomHandler) scalingSignals(ctx context.Context) (*apitypes.ScalingSignalsResponse, error) {
+	heartbeats, err := h.cacheStore.NodeHeartbeats(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "query node heartbeats failed")
+	}
+	resp := &apitypes.ScalingSignalsResponse{Nodes: make([]*apitypes.NodeLoadSignals, 0, len(heartbeats))}
+	for _, hb := range heartbeats {
+		load := hb.Load
+		if hb.Node == h.op().Address {
+			load = loadsignal.Global.Signals()
+		}
+		if load == nil {
+			continue
+		}
+		resp.Nodes = append(resp.Nodes, &apitypes.NodeLoadSignals{Node: hb.Node, LoadSignals: *load})
+	}
+	resp.Replicas = len(resp.Nodes)
+	resp.Cluster = loadsignal.Aggregate(resp.Nodes)
+	return resp, nil
+}
+
+// ExternalMetrics returns the resources of the external metrics API for the discovery of HPA
+func (h *CustomHandler) ExternalMetrics(c *gin.Context) {
+	if !h.op().Autoscaling.Enable || !h.op().Autoscaling.ExternalMetrics {
+		externalMetricsError(c, http.StatusNotFound, "external metrics is not enabled")
+		return
+	}
+	resources := make([]metav1.APIResource, 0, len(externalMetricValues))
+	for _, name := range []string{metricQueuedDownloads, metricThroughputBytes, metricBandwidthSaturation,
+		metricBlobLatencyP95} {
+		resources = append(resources, metav1.APIResource{
+			Name:       name,
+			Namespaced: true,
+			Kind:       "ExternalMetricValueList",
+			Verbs:      metav1.Verbs{"get"},
+		})
+	}
+	c.JSON(http.StatusOK, &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: externalMetricsGroupVersion,
+		APIResources: resources,
+	})
+}
+
+// ExternalMetricValue returns the value of external metric aggregated of cluster for HPA, the namespace
+// and metric selector are ignored because the signals are of the whole proxy tier
+func (h *CustomHandler) ExternalMetricValue(c *gin.Context) {
+	if !h.op().Autoscaling.Enable || !h.op().Autoscaling.ExternalMetrics {
+		externalMetricsError(c, http.StatusNotFound, "external metrics is not enabled")
+		return
+	}
+	metric := c.Param("metric")
+	valueFunc, ok := externalMetricValues[metric]
+	if !ok {
+		externalMetricsError(c, http.StatusNotFound, "external metric '"+metric+"' not found")
+		return
+	}
+	signals, err := h.scalingSignals(c.Request.Context())
+	if err != nil {
+		externalMetricsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, &externalMetricValueList{
+		TypeMeta: metav1.TypeMeta{Kind: "ExternalMetricValueList", APIVersion: externalMetricsGroupVersion},
+		Items: []*externalMetricValue{{
+			MetricName:   metric,
+			MetricLabels: map[string]string{},
+			Timestamp:    metav1.NewTime(time.Now()),
+			Value:        valueFunc(signals.Cluster),
+		}},
+	})
+}
+
+// externalMetricsError responds the failure Status of kubernetes API
+func externalMetricsError(c *gin.Context, code int, message string) {
+	reason := metav1.StatusReasonInternalError
+	if code == http.StatusNotFound {
+		reason = metav1.StatusReasonNotFound
+	}
+	c.JSON(code, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
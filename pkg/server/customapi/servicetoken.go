@@ -17,8 +17,13 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/credprovider"
+	"github.com/penglongli/accelerboat/pkg/failover"
 	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/pullsecret"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
 	"github.com/penglongli/accelerboat/pkg/utils/httputils"
 )
 
@@ -28,13 +33,13 @@ func buildAuthTokenKey(originalHost, service, scope string) string {
 
 func getServiceTokenWithCheck(ctx context.Context, req *apitypes.GetServiceTokenRequest) (
 	*apitypes.RegistryAuthToken, error) {
-	respBody, err := httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
+	resp, respBody, err := httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
 		Url:         req.ServiceTokenUrl,
 		Method:      http.MethodGet,
 		HeaderMulti: req.Headers,
 	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get service token")
+		return nil, apitypes.NewUpstreamStatusError(resp, errors.Wrapf(err, "failed to get service token"))
 	}
 	token := &apitypes.RegistryAuthToken{}
 	if err = json.Unmarshal(respBody, token); err != nil {
@@ -50,7 +55,7 @@ func getServiceTokenWithCheck(ctx context.Context, req *apitypes.GetServiceToken
 	checkResp, err := httputils.SendHTTPRequestOnlyResponse(ctx, &httputils.HTTPRequest{
 		// We use the `latest` tag for validation, regardless of whether it actually has `latest`,
 		// because we only use it to determine if the token is valid.
-		Url:    fmt.Sprintf("https://%s/v2/%s/manifests/latest", req.OriginalHost, scopeArr[1]),
+		Url:    utils.RegistryURL(failover.ActiveHost(req.OriginalHost), fmt.Sprintf("/v2/%s/manifests/latest", scopeArr[1])),
 		Method: http.MethodHead,
 		Header: map[string]string{
 			"Authorization": fmt.Sprintf("Bearer %s", token.Token),
@@ -87,30 +92,64 @@ func (h *CustomHandler) saveAuthToken(authKey string, authToken *apitypes.Regist
 // GetServiceToken obtains a registry auth token from upstream and returns it (cached by originalHost, service, scope).
 func (h *CustomHandler) GetServiceToken(c *gin.Context) (interface{}, error) {
 	req := &apitypes.GetServiceTokenRequest{}
-	if err := c.ShouldBindJSON(req); err != nil {
-		return nil, errors.Wrapf(err, "parse request failed")
+	if err := h.bindRequest(c, req); err != nil {
+		return nil, err
+	}
+	if err := h.checkServiceTokenURL(req.OriginalHost, req.ServiceTokenUrl); err != nil {
+		return nil, err
 	}
+	return h.getServiceToken(c.Request.Context(), req)
+}
+
+func (h *CustomHandler) getServiceToken(ctx context.Context, req *apitypes.GetServiceTokenRequest) (
+	*apitypes.RegistryAuthToken, error) {
 	authKey := buildAuthTokenKey(req.OriginalHost, req.Service, req.Scope)
-	ctx := c.Request.Context()
+	if h.op().TokenRefresh.Enable {
+		h.tokenScopes.hit(authKey, req, time.Duration(h.op().TokenRefresh.HotWindow)*time.Second)
+	}
 	h.authLock.Lock(ctx, authKey)
 	defer h.authLock.UnLock(ctx, authKey)
 
 	auth, ok := h.authTokens.Get(authKey)
 	if ok && auth != nil {
+		metrics.TokenCacheRequestsTotal.WithLabelValues("hit").Inc()
 		return auth.(*apitypes.RegistryAuthToken), nil
 	}
+	// the token cached by other master, or before the master restarted
+	if storedToken := h.getCachedToken(ctx, authKey); storedToken != nil {
+		metrics.TokenCacheRequestsTotal.WithLabelValues("store_hit").Inc()
+		logger.InfoContextf(ctx, "get service token from cache store success")
+		h.saveAuthToken(authKey, storedToken)
+		return storedToken, nil
+	}
+	metrics.TokenCacheRequestsTotal.WithLabelValues("miss").Inc()
 	logger.InfoContextf(ctx, "cache authkey: %s", authKey)
 
-	delete(req.Headers, "Accept-Encoding")
+	registry := options.GlobalOptions().FilterRegistryMappingByOriginal(req.OriginalHost)
+	if registry != nil && registry.AccountRotation != nil && registry.AccountRotation.Enable &&
+		len(registry.LegalUsers) != 0 {
+		if authToken := h.getRotatedServiceToken(ctx, req, registry); authToken != nil {
+			h.saveCachedToken(ctx, authKey, authToken)
+			h.saveAuthToken(authKey, authToken)
+			return authToken, nil
+		}
+		delete(req.Headers, "Authorization")
+	}
 	originalAuthToken, err := getServiceTokenWithCheck(ctx, req)
 	if err == nil {
+		h.saveCachedToken(ctx, authKey, originalAuthToken)
 		h.saveAuthToken(authKey, originalAuthToken)
 		return originalAuthToken, nil
 	}
 	var legalUsers []*options.RegistryAuth
-	registry := h.op.FilterRegistryMappingByOriginal(req.OriginalHost)
 	if registry != nil {
-		legalUsers = registry.LegalUsers
+		if auth, authErr := credprovider.GetCredential(ctx, registry); authErr != nil {
+			logger.WarnContextf(ctx, "get credential from provider failed: %s", authErr.Error())
+		} else if auth != nil {
+			legalUsers = append(legalUsers, auth)
+		}
+		legalUsers = append(legalUsers, registry.LegalUsers...)
+		legalUsers = append(legalUsers, pullsecret.Credentials(registry)...)
 	}
 	if len(legalUsers) == 0 {
 		if originalAuthToken != nil {
@@ -122,14 +161,14 @@ func (h *CustomHandler) GetServiceToken(c *gin.Context) (interface{}, error) {
 	logger.WarnContextf(ctx, "get service token use original request failed: %s, "+
 		"will retry with configured auths", err.Error())
 	for i, user := range legalUsers {
-		req.Headers["Authorization"] = []string{fmt.Sprintf("Basic %s", base64.StdEncoding.
-			EncodeToString([]byte(fmt.Sprintf("%s:%s", user.Username, user.Password))))}
+		req.Headers["Authorization"] = []string{basicAuthorization(user)}
 		var authToken *apitypes.RegistryAuthToken
 		if authToken, err = getServiceTokenWithCheck(ctx, req); err != nil {
 			logger.WarnContextf(ctx, "get service token with user[%d] '%s' failed: %s",
 				i, user.Username, err.Error())
 			continue
 		}
+		h.saveCachedToken(ctx, authKey, authToken)
 		h.saveAuthToken(authKey, authToken)
 		return authToken, nil
 	}
@@ -139,3 +178,29 @@ func (h *CustomHandler) GetServiceToken(c *gin.Context) (interface{}, error) {
 	}
 	return nil, fmt.Errorf("get service token failed")
 }
+
+// getRotatedServiceToken requests the service token with the users of registry in the order of remaining
+// quota, the token is bound to the user. It returns nil if all the users failed.
+func (h *CustomHandler) getRotatedServiceToken(ctx context.Context, req *apitypes.GetServiceTokenRequest,
+	registry *options.RegistryMapping) *apitypes.RegistryAuthToken {
+	users := h.accounts.order(req.OriginalHost, registry.LegalUsers, registry.AccountRotation.MinRemaining)
+	for _, user := range users {
+		req.Headers["Authorization"] = []string{basicAuthorization(user)}
+		authToken, err := getServiceTokenWithCheck(ctx, req)
+		if err != nil {
+			logger.WarnContextf(ctx, "get service token with rotated user '%s' failed: %s", user.Username,
+				err.Error())
+			continue
+		}
+		h.accounts.bind(req.OriginalHost, user.Username, authToken.Token, authToken.AccessToken)
+		logger.InfoContextf(ctx, "get service token with rotated user '%s' success", user.Username)
+		return authToken
+	}
+	logger.WarnContextf(ctx, "get service token failed with all rotated users, fallback to original request")
+	return nil
+}
+
+func basicAuthorization(user *options.RegistryAuth) string {
+	return fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%s:%s", user.Username, user.Password))))
+}
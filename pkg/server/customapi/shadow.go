@@ -0,0 +1,153 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/utils"
+	"github.com/penglongli/accelerboat/pkg/utils/httputils"
+)
+
+const (
+	// shadowTimeout the timeout of the request mirrored to shadow registry
+	shadowTimeout = 10 * time.Second
+	// shadowMaxInflight the max mirrored requests in flight, the requests are not mirrored if exceeded so
+	// that the shadow registry never slows down the pulls
+	shadowMaxInflight = 16
+)
+
+var shadowInflight = make(chan struct{}, shadowMaxInflight)
+
+// shadowResult is the status code and manifest digest responded by registry
+type shadowResult struct {
+	statusCode int
+	digest     string
+}
+
+// manifestDigest returns the digest of manifest response, the Docker-Content-Digest header is preferred
+func manifestDigest(resp *http.Response, body []byte) string {
+	if d := resp.Header.Get("Docker-Content-Digest"); d != "" {
+		return d
+	}
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// shadowManifest mirrors the manifest request to the shadow registry of mapping asynchronously, and
+// compares the status code and digest with the primary. The client response is never affected.
+func (h *CustomHandler) shadowManifest(ctx context.Context, originalHost, method, requestURI string,
+	headers map[string][]string, primary *http.Response, primaryBody []byte) {
+	if primary == nil {
+		return
+	}
+	mapping, err := h.registryMapping(originalHost)
+	if err != nil || mapping.Shadow == nil || !mapping.Shadow.Enable || mapping.Shadow.OriginalHost == "" {
+		return
+	}
+	expected := shadowResult{statusCode: primary.StatusCode}
+	if primary.StatusCode == http.StatusOK {
+		// the digest of primary is unknown if its body is not read (e.g. too large)
+		if expected.digest = manifestDigest(primary, primaryBody); expected.digest == "" {
+			return
+		}
+	}
+	select {
+	case shadowInflight <- struct{}{}:
+	default:
+		metrics.ShadowRequestsTotal.WithLabelValues(originalHost, "skipped").Inc()
+		return
+	}
+	shadow := *mapping.Shadow
+	go func() {
+		defer func() { <-shadowInflight }()
+		shadowCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shadowTimeout)
+		defer cancel()
+		actual, err := requestShadow(shadowCtx, &shadow, method, requestURI, headers)
+		if err != nil {
+			metrics.ShadowRequestsTotal.WithLabelValues(originalHost, "error").Inc()
+			logger.WarnContextf(shadowCtx, "shadow request '%s, %s' to '%s' failed: %s", method, requestURI,
+				shadow.OriginalHost, err.Error())
+			return
+		}
+		result := "match"
+		switch {
+		case actual.statusCode != expected.statusCode:
+			result = "status_mismatch"
+		case actual.digest != expected.digest:
+			result = "digest_mismatch"
+		}
+		metrics.ShadowRequestsTotal.WithLabelValues(originalHost, result).Inc()
+		if result == "match" {
+			return
+		}
+		logger.WarnContextf(shadowCtx, "shadow registry '%s' diverged for '%s, %s': %s, expected %d(%s) "+
+			"but %d(%s)", shadow.OriginalHost, method, requestURI, result, expected.statusCode, expected.digest,
+			actual.statusCode, actual.digest)
+		recorder.Global.Record(shadowCtx, recorder.Event{
+			Type:        recorder.EventTypeShadowDiverged,
+			EventStatus: recorder.Warning,
+			Details: map[string]interface{}{
+				"registry": originalHost, "shadow": shadow.OriginalHost, "method": method, "uri": requestURI,
+				"result": result, "statusCode": expected.statusCode, "shadowStatusCode": actual.statusCode,
+				"digest": expected.digest, "shadowDigest": actual.digest,
+			},
+			Message: fmt.Sprintf("Shadow registry responded %s than original registry", result),
+		})
+	}()
+}
+
+// requestShadow requests the manifest from shadow registry with its own credential, the authorization of
+// primary is not sent to it
+func requestShadow(ctx context.Context, shadow *options.ShadowConfig, method, requestURI string,
+	headers map[string][]string) (*shadowResult, error) {
+	header := http.Header{}
+	for k, v := range headers {
+		if http.CanonicalHeaderKey(k) == "Authorization" {
+			continue
+		}
+		header[k] = v
+	}
+	if shadow.Username != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString(
+			[]byte(shadow.Username+":"+shadow.Password)))
+	}
+	resp, err := httputils.SendHTTPRequestOnlyResponse(ctx, &httputils.HTTPRequest{
+		Url:         utils.RegistryURL(shadow.OriginalHost, requestURI),
+		Method:      method,
+		HeaderMulti: header,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	result := &shadowResult{statusCode: resp.StatusCode}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, manifestMaxBodySize))
+		return result, nil
+	}
+	var body []byte
+	if method == http.MethodGet {
+		if body, err = httputils.ReadBody(resp, manifestMaxBodySize); err != nil {
+			return nil, err
+		}
+	}
+	result.digest = manifestDigest(resp, body)
+	return result, nil
+}
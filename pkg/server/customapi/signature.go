@@ -0,0 +1,183 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/cosign"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
+	"github.com/penglongli/accelerboat/pkg/utils/httputils"
+)
+
+var manifestAcceptTypes = []string{
+	ocispec.MediaTypeImageManifest,
+	ocispec.MediaTypeImageIndex,
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+// signatureResult is the cached verification result of manifest digest
+type signatureResult struct {
+	err error
+}
+
+// registryFetcher fetches the cosign signatures from original registry with the authorization of the
+// get-manifest request
+type registryFetcher struct {
+	originalHost string
+	repo         string
+	headers      map[string][]string
+}
+
+// FetchManifest fetches the manifest by tag or digest, the error wraps cosign.ErrNotFound if the
+// manifest not exists
+func (f *registryFetcher) FetchManifest(ctx context.Context, reference string) ([]byte, error) {
+	headers := map[string][]string{"Accept": manifestAcceptTypes}
+	if auth, ok := f.headers["Authorization"]; ok {
+		headers["Authorization"] = auth
+	}
+	resp, body, err := httputils.SendHTTPRequestReturnResponse(ctx, &httputils.HTTPRequest{
+		Url:         utils.RegistryURL(f.originalHost, fmt.Sprintf("/v2/%s/manifests/%s", f.repo, reference)),
+		Method:      http.MethodGet,
+		HeaderMulti: headers,
+	})
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, errors.Wrapf(cosign.ErrNotFound, "%s", err.Error())
+	}
+	return body, err
+}
+
+// FetchBlob fetches the blob by digest
+func (f *registryFetcher) FetchBlob(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	headers := make(map[string][]string)
+	if auth, ok := f.headers["Authorization"]; ok {
+		headers["Authorization"] = auth
+	}
+	return httputils.SendHTTPRequest(ctx, &httputils.HTTPRequest{
+		Url:         utils.RegistryURL(f.originalHost, fmt.Sprintf("/v2/%s/blobs/%s", f.repo, dgst.String())),
+		Method:      http.MethodGet,
+		HeaderMulti: headers,
+	})
+}
+
+// verifyManifestSignature verifies the cosign signature of manifest if the registry mapping enabled
+// signature verification. Returns error wraps ErrSignatureVerifyFailed only for enforce mode.
+func (h *CustomHandler) verifyManifestSignature(ctx context.Context, req *apitypes.GetManifestRequest,
+	manifest []byte) error {
+	mp := options.GlobalOptions().FilterRegistryMappingByOriginal(req.OriginalHost)
+	if mp == nil || mp.SignatureVerification == nil || !mp.SignatureVerification.Enable {
+		return nil
+	}
+	sv := mp.SignatureVerification
+	// the digest of request is not trusted, the manifest verified is identified by the fetched content
+	manifestDigest := digest.FromBytes(manifest)
+	if requested, err := digest.Parse(req.Tag); err == nil && requested.Algorithm().FromBytes(manifest) != requested {
+		return errors.Wrapf(apitypes.ErrSignatureVerifyFailed, "manifest '%s' content digest not matched: %s",
+			requested.String(), manifestDigest.String())
+	}
+	resultKey := buildManifestKey(req.OriginalHost, req.Repo, manifestDigest.String())
+	h.signatureLock.Lock(ctx, resultKey)
+	defer h.signatureLock.UnLock(ctx, resultKey)
+
+	var verifyErr error
+	if v, ok := h.signatureResults.Get(resultKey); ok && v != nil {
+		verifyErr = v.(*signatureResult).err
+	} else {
+		start := time.Now()
+		verifyErr = h.doVerifySignature(ctx, req, sv, manifestDigest)
+		h.recordVerifySignature(ctx, start, req, sv, manifestDigest, verifyErr)
+		// the errors of fetch or auth are not cached, they are not the result of this manifest
+		if errors.Is(verifyErr, cosign.ErrVerifyFailed) {
+			h.signatureResults.Set(resultKey, &signatureResult{err: verifyErr}, time.Minute)
+		} else if verifyErr == nil {
+			h.signatureResults.Set(resultKey, &signatureResult{}, 10*time.Minute)
+			h.markChildManifestsVerified(req, manifest)
+		}
+	}
+	if verifyErr == nil {
+		return nil
+	}
+	if sv.Mode == options.SignatureVerifyWarn {
+		logger.WarnContextf(ctx, "verify signature of manifest '%s' failed (warn mode): %s",
+			manifestDigest.String(), verifyErr.Error())
+		return nil
+	}
+	return errors.Wrapf(apitypes.ErrSignatureVerifyFailed, "manifest '%s' rejected: %s",
+		manifestDigest.String(), verifyErr.Error())
+}
+
+func (h *CustomHandler) doVerifySignature(ctx context.Context, req *apitypes.GetManifestRequest,
+	sv *options.SignatureVerification, manifestDigest digest.Digest) error {
+	verifier, err := cosign.NewVerifier(sv)
+	if err != nil {
+		return errors.Wrapf(err, "create signature verifier failed")
+	}
+	fetcher := &registryFetcher{
+		originalHost: req.OriginalHost,
+		repo:         req.Repo,
+		headers:      req.Headers,
+	}
+	return verifier.Verify(ctx, fetcher, manifestDigest)
+}
+
+// markChildManifestsVerified marks the platform manifests of a verified index as verified, the signature
+// of index covers its children.
+func (h *CustomHandler) markChildManifestsVerified(req *apitypes.GetManifestRequest, manifest []byte) {
+	index := &ocispec.Index{}
+	if err := json.Unmarshal(manifest, index); err != nil {
+		return
+	}
+	if !strings.Contains(index.MediaType, "index") && !strings.Contains(index.MediaType, "list") {
+		return
+	}
+	for _, m := range index.Manifests {
+		h.signatureResults.Set(buildManifestKey(req.OriginalHost, req.Repo, m.Digest.String()),
+			&signatureResult{}, 10*time.Minute)
+	}
+}
+
+func (h *CustomHandler) recordVerifySignature(ctx context.Context, start time.Time,
+	req *apitypes.GetManifestRequest, sv *options.SignatureVerification, manifestDigest digest.Digest,
+	err error) {
+	details := map[string]interface{}{
+		"registry": req.OriginalHost, "repo": req.Repo, "tag": req.Tag,
+		"digest": manifestDigest.String(), "mode": string(sv.Mode),
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		recorder.Global.Record(ctx, recorder.Event{
+			Type:        recorder.EventTypeVerifySignature,
+			EventStatus: recorder.Warning,
+			Details:     details,
+			Message:     fmt.Sprintf("Verify signature failed: %s", err.Error()),
+		})
+		metrics.RegistryRequestsTotal.WithLabelValues(req.OriginalHost, string(recorder.EventTypeVerifySignature),
+			"error").Inc()
+		return
+	}
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeVerifySignature,
+		EventStatus: recorder.Normal,
+		Details:     details,
+		Message:     "Verify signature success",
+	})
+	metrics.RegistryRequestsTotal.WithLabelValues(req.OriginalHost, string(recorder.EventTypeVerifySignature),
+		"success").Inc()
+}
@@ -15,7 +15,7 @@ import (
 
 // Config returns the current AccelerBoat configuration as JSON or formatted text (see HTTPWrapperWithOutput).
 func (h *CustomHandler) Config(c *gin.Context) (interface{}, string, error) {
-	op := h.op
+	op := options.GlobalOptions()
 	// Use an exported copy to avoid circular reference; JSON serializes fields by json tag
 	cfg := buildConfigSnapshot(op)
 	raw, err := json.MarshalIndent(cfg, "", "  ")
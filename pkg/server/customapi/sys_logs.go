@@ -0,0 +1,171 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	logsChunkSize    = 64 * 1024
+	logsPollInterval = 500 * time.Millisecond
+)
+
+// LogsHandler handles GET /customapi/logs with optional query: limit=N (the last N lines), follow=true,
+// grep=<substring>. It reads the log file of accelerboat, and follows the file across the rotations.
+func (h *CustomHandler) LogsHandler(c *gin.Context) {
+	file := filepath.Join(options.GlobalOptions().LogConfig.LogDir, logger.FileName)
+	grep := c.Query("grep")
+	lines, offset, err := tailLogLines(file, recorderLimitFromQuery(c), grep)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	for _, line := range lines {
+		_, _ = w.Write(append(line, '\n'))
+	}
+	w.Flush()
+	if c.Query("follow") != "true" {
+		return
+	}
+	err = followLogLines(c.Request.Context(), file, offset, grep, func(line []byte) error {
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.WarnContextf(c.Request.Context(), "follow log file '%s' failed: %s", file, err.Error())
+	}
+}
+
+// tailLogLines returns the last limit lines of file containing grep, read backward by chunks. The returned
+// offset is the size of file, where the following starts.
+func tailLogLines(file string, limit int, grep string) ([][]byte, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "open log file '%s' failed", file)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "stat log file '%s' failed", file)
+	}
+	size := fi.Size()
+	offset := size
+	// lines are collected from the end, partial is the head of the chunk that may be incomplete
+	reversed := make([][]byte, 0, limit)
+	var partial []byte
+	collect := func(line []byte) {
+		if len(line) != 0 && strings.Contains(string(line), grep) {
+			reversed = append(reversed, line)
+		}
+	}
+	for offset > 0 && len(reversed) < limit {
+		chunk := min(int64(logsChunkSize), offset)
+		offset -= chunk
+		buf := make([]byte, chunk, chunk+int64(len(partial)))
+		if _, err = f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, 0, errors.Wrapf(err, "read log file '%s' failed", file)
+		}
+		parts := bytes.Split(append(buf, partial...), []byte("\n"))
+		partial = parts[0]
+		for i := len(parts) - 1; i >= 1 && len(reversed) < limit; i-- {
+			collect(parts[i])
+		}
+	}
+	if offset == 0 && len(reversed) < limit {
+		collect(partial)
+	}
+	lines := make([][]byte, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		lines = append(lines, reversed[i])
+	}
+	return lines, size, nil
+}
+
+// followLogLines writes the lines containing grep appended to file after offset until ctx done. The file
+// rotated by lumberjack is drained before reading the new one from the beginning.
+func followLogLines(ctx context.Context, file string, offset int64, grep string,
+	write func(line []byte) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrapf(err, "open log file '%s' failed", file)
+	}
+	defer func() { _ = f.Close() }()
+	var partial []byte
+	// next is the new file after rotation, it is read after the old file drained
+	var next *os.File
+	buf := make([]byte, logsChunkSize)
+	ticker := time.NewTicker(logsPollInterval)
+	defer ticker.Stop()
+	for {
+		// read to the end of current file
+		for {
+			n, err := f.ReadAt(buf, offset)
+			offset += int64(n)
+			parts := bytes.Split(append(partial, buf[:n]...), []byte("\n"))
+			partial = parts[len(parts)-1]
+			for _, line := range parts[:len(parts)-1] {
+				if len(line) == 0 || !strings.Contains(string(line), grep) {
+					continue
+				}
+				if err := write(line); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF || n == 0 {
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(err, "read log file '%s' failed", file)
+			}
+		}
+		if next != nil {
+			_ = f.Close()
+			f, offset, partial, next = next, 0, nil, nil
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		cur, err := f.Stat()
+		if err != nil {
+			return errors.Wrapf(err, "stat log file '%s' failed", file)
+		}
+		latest, err := os.Stat(file)
+		if err != nil {
+			// the new file is not created yet after rotation
+			continue
+		}
+		if os.SameFile(cur, latest) && latest.Size() >= offset {
+			continue
+		}
+		// rotated or truncated, the new file is read after the remaining content of old file
+		if next, err = os.Open(file); err != nil {
+			next = nil
+		}
+	}
+}
@@ -43,6 +43,14 @@ var customMetricNames = []string{
 	"accelerboat_transfer_size",
 	"accelerboat_disk_usage",
 	"accelerboat_errors_total",
+	"accelerboat_federation_layer_total",
+	"accelerboat_cache_store_degraded",
+	"accelerboat_cache_store_pending_writes",
+	"accelerboat_download_cancel_total",
+	"accelerboat_host_violations_total",
+	"accelerboat_local_serve_queue_length",
+	"accelerboat_fallback_decisions_total",
+	"accelerboat_preheat_runs_total",
 }
 
 // Metrics returns Prometheus metrics in JSON or human-readable format (see HTTPWrapperWithOutput).
@@ -115,13 +123,19 @@ type StatsMetrics struct {
 	TransferSize      map[string]float64 // operation -> GB
 	ErrorsTotal       int64
 	TorrentActiveCount int
+	BlobOutcomes       map[string]float64 // outcome -> requests
+	ManifestCache      map[string]float64 // result -> lookups
+	TokenCache         map[string]float64 // result -> lookups
 }
 
-// getStatsMetrics gathers and aggregates the four metrics required for stats from Prometheus.
+// getStatsMetrics gathers and aggregates the metrics required for stats from Prometheus.
 func getStatsMetrics() (StatsMetrics, error) {
 	out := StatsMetrics{
-		DiskUsage:    make(map[string]float64),
-		TransferSize: make(map[string]float64),
+		DiskUsage:     make(map[string]float64),
+		TransferSize:  make(map[string]float64),
+		BlobOutcomes:  make(map[string]float64),
+		ManifestCache: make(map[string]float64),
+		TokenCache:    make(map[string]float64),
 	}
 	families, err := prometheus.DefaultGatherer.Gather()
 	if err != nil {
@@ -170,6 +184,9 @@ func getStatsMetrics() (StatsMetrics, error) {
 			}
 		}
 	}
+	sumCounterByLabel(nameToFamily["accelerboat_blob_requests_total"], "outcome", out.BlobOutcomes)
+	sumCounterByLabel(nameToFamily["accelerboat_manifest_cache_requests_total"], "result", out.ManifestCache)
+	sumCounterByLabel(nameToFamily["accelerboat_token_cache_requests_total"], "result", out.TokenCache)
 	if mf := nameToFamily["accelerboat_torrent_active_count"]; mf != nil {
 		for _, m := range mf.Metric {
 			if m.Gauge != nil && m.Gauge.Value != nil {
@@ -368,3 +385,23 @@ func writeGenericRows(b *strings.Builder, items []MetricItem) {
 	}
 	tbl.Render()
 }
+
+// sumCounterByLabel sums the counters of family into out, grouped by the value of label
+func sumCounterByLabel(mf *dto.MetricFamily, label string, out map[string]float64) {
+	if mf == nil {
+		return
+	}
+	for _, m := range mf.Metric {
+		if m.Counter == nil || m.Counter.Value == nil {
+			continue
+		}
+		var value string
+		for _, l := range m.Label {
+			if l.Name != nil && l.Value != nil && *l.Name == label {
+				value = *l.Value
+				break
+			}
+		}
+		out[value] += *m.Counter.Value
+	}
+}
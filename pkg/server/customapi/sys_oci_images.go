@@ -26,7 +26,7 @@ type OCIImagesResponse struct {
 // Use query output=json for JSON; otherwise returns human-readable text.
 func (h *CustomHandler) OCIImages(c *gin.Context) (interface{}, string, error) {
 	ctx := c.Request.Context()
-	op := h.op
+	op := h.op()
 	ociPath := op.StorageConfig.OCIPath
 
 	imagesList, err := h.ociScanner.ListManagedImages(ctx, ociPath)
@@ -58,6 +58,7 @@ func formatOCIImagesText(resp *OCIImagesResponse, ociPath string) string {
 		b.WriteString(fmt.Sprintf("Images: %d\n\n", len(resp.Images)))
 		for i, img := range resp.Images {
 			b.WriteString(fmt.Sprintf("  [%d] %s\n", i+1, img.Name))
+			b.WriteString(fmt.Sprintf("       namespace: %s\n", img.Namespace))
 			b.WriteString(fmt.Sprintf("       target: %s\n", img.Target))
 			b.WriteString(fmt.Sprintf("       layers: %d\n", len(img.Layers)))
 			for j, layer := range img.Layers {
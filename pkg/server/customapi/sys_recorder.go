@@ -217,6 +217,15 @@ func buildExtra(e *recorder.Event) string {
 	case recorder.EventTypeGetManifest:
 		details = append(details, "master="+convertString(e.Details["master"]))
 		details = append(details, "tag="+convertString(e.Details["tag"]))
+		if artifactType := e.Details["artifactType"]; artifactType != nil {
+			details = append(details, "artifactType="+convertString(artifactType))
+		}
+	case recorder.EventTypePanic:
+		details = append(details, "route="+convertString(e.Details["route"]))
+		details = append(details, "stackHash="+convertString(e.Details["stackHash"]))
+	case recorder.EventTypeVerifySignature:
+		details = append(details, "digest="+convertString(e.Details["digest"]))
+		details = append(details, "mode="+convertString(e.Details["mode"]))
 	case recorder.EventServeBlobFromLocal:
 		details = append(details, "digest="+convertString(e.Details["digest"]))
 		details = append(details, "size="+formatutils.FormatSize(convertInt64(e.Details["size"])))
@@ -231,6 +240,19 @@ func buildExtra(e *recorder.Event) string {
 		if size := e.Details["size"]; size != nil {
 			details = append(details, "size="+formatutils.FormatSize(convertInt64(size)))
 		}
+	case recorder.EventTypeLayerEvicted:
+		details = append(details, "digest="+convertString(e.Details["digest"]))
+		details = append(details, "size="+formatutils.FormatSize(convertInt64(e.Details["size"])))
+		details = append(details, "reason="+convertString(e.Details["reason"]))
+		details = append(details, "lastUsed="+convertString(e.Details["lastUsed"]))
+	case recorder.EventTypeTorrentAdded, recorder.EventTypeTorrentDropped:
+		details = append(details, "digest="+convertString(e.Details["digest"]))
+		details = append(details, "size="+formatutils.FormatSize(convertInt64(e.Details["size"])))
+		details = append(details, "reason="+convertString(e.Details["reason"]))
+	case recorder.EventTypeCacheReconciled:
+		details = append(details, "digest="+convertString(e.Details["digest"]))
+		details = append(details, "source="+convertString(e.Details["source"]))
+		details = append(details, "reason="+convertString(e.Details["reason"]))
 	case recorder.EventTypeDownloadBlobByTCP, recorder.EventTypeDownloadBlobByTorrent:
 		details = append(details, "digest="+convertString(e.Details["digest"]))
 		details = append(details, "target="+convertString(e.Details["target"]))
@@ -240,37 +262,68 @@ func buildExtra(e *recorder.Event) string {
 	return strings.Join(details, "\n")
 }
 
-// filterRecorderEvents filters events by query params: registry (exact match) and search (substring match on repoOrExtra).
-func filterRecorderEvents(events []recorder.Event, registry, search string) []recorder.Event {
-	if registry == "" && search == "" {
-		return events
-	}
-	out := make([]recorder.Event, 0, len(events))
-	for _, e := range events {
-		if registry != "" && detailStr(e.Details, "registry") != registry {
-			continue
-		}
-		if search != "" && !strings.Contains(buildExtra(&e), search) &&
-			!strings.Contains(detailStr(e.Details, "repo"), search) {
-			continue
+// recorderFilter filters events by query params: registry (exact match), search (substring match on
+// repoOrExtra) and type (comma-separated event types, e.g. layer_evicted,torrent_dropped).
+type recorderFilter struct {
+	registry string
+	search   string
+	types    map[recorder.EventType]struct{}
+}
+
+func recorderFilterFromQuery(c *gin.Context) *recorderFilter {
+	f := &recorderFilter{
+		registry: strings.TrimSpace(c.Query("registry")),
+		search:   strings.TrimSpace(c.Query("search")),
+		types:    make(map[recorder.EventType]struct{}),
+	}
+	for _, t := range strings.Split(c.Query("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			f.types[recorder.EventType(t)] = struct{}{}
 		}
-		out = append(out, e)
 	}
-	return out
+	return f
+}
+
+// listQuery returns the substring query to pre-filter the events read from event file, the type filter
+// is used only if search is empty because the query lines are matched with any of them.
+func (f *recorderFilter) listQuery() []string {
+	if f.search != "" || len(f.types) == 0 {
+		return []string{f.search}
+	}
+	query := make([]string, 0, len(f.types))
+	for t := range f.types {
+		query = append(query, fmt.Sprintf(`"type":"%s"`, t))
+	}
+	return query
 }
 
-// eventMatchesFilter returns true if the event passes registry (exact) and search (substring on repoOrExtra).
-func eventMatchesFilter(e *recorder.Event, registry, search string) bool {
-	if registry != "" && detailStr(e.Details, "registry") != registry {
+// match returns true if the event passes all the filters
+func (f *recorderFilter) match(e *recorder.Event) bool {
+	if len(f.types) != 0 {
+		if _, ok := f.types[e.Type]; !ok {
+			return false
+		}
+	}
+	if f.registry != "" && detailStr(e.Details, "registry") != f.registry {
 		return false
 	}
-	if search != "" && !strings.Contains(buildExtra(e), search) &&
-		!strings.Contains(detailStr(e.Details, "repo"), search) {
+	if f.search != "" && !strings.Contains(buildExtra(e), f.search) &&
+		!strings.Contains(detailStr(e.Details, "repo"), f.search) {
 		return false
 	}
 	return true
 }
 
+func (f *recorderFilter) filter(events []recorder.Event) []recorder.Event {
+	out := make([]recorder.Event, 0, len(events))
+	for i := range events {
+		if f.match(&events[i]) {
+			out = append(out, events[i])
+		}
+	}
+	return out
+}
+
 func formatRecorderEventsTable(events []recorder.Event) string {
 	var b strings.Builder
 	tbl := tablewriter.NewWriter(&b)
@@ -303,16 +356,11 @@ func formatRecorderEventsTable(events []recorder.Event) string {
 }
 
 // RecorderOutput returns (jsonData, tableText, error) for the recorder API (no follow).
-// Query params: limit, registry (exact match), search (substring match on repoOrExtra).
+// Query params: limit, registry (exact match), search (substring match on repoOrExtra), type.
 func (h *CustomHandler) RecorderOutput(c *gin.Context) (interface{}, string, error) {
 	limit := recorderLimitFromQuery(c)
-	registry := strings.TrimSpace(c.Query("registry"))
-	search := strings.TrimSpace(c.Query("search"))
-	events := recorder.Global.List(limit, []string{search}, nil)
-	if events == nil {
-		events = []recorder.Event{}
-	}
-	events = filterRecorderEvents(events, registry, search)
+	filter := recorderFilterFromQuery(c)
+	events := filter.filter(recorder.Global.List(limit, filter.listQuery(), nil))
 	out := make([]interface{}, 0, len(events))
 	for _, e := range events {
 		out = append(out, eventToMap(e))
@@ -323,18 +371,13 @@ func (h *CustomHandler) RecorderOutput(c *gin.Context) (interface{}, string, err
 }
 
 // recorderStream handles follow=true: stream initial events then new events until client disconnects.
-// Query params: limit, registry (exact match), search (substring match on repoOrExtra).
+// Query params: limit, registry (exact match), search (substring match on repoOrExtra), type.
 func (h *CustomHandler) recorderStream(c *gin.Context) {
 	limit := recorderLimitFromQuery(c)
 	outputJSON := c.Query("output") == "json"
-	registryFilter := strings.TrimSpace(c.Query("registry"))
-	searchFilter := strings.TrimSpace(c.Query("search"))
+	filter := recorderFilterFromQuery(c)
 
-	events := recorder.Global.List(limit, []string{searchFilter}, nil)
-	if events == nil {
-		events = []recorder.Event{}
-	}
-	events = filterRecorderEvents(events, registryFilter, searchFilter)
+	events := filter.filter(recorder.Global.List(limit, filter.listQuery(), nil))
 
 	w := c.Writer
 	header := w.Header()
@@ -379,7 +422,7 @@ func (h *CustomHandler) recorderStream(c *gin.Context) {
 			if !ok {
 				return
 			}
-			if !eventMatchesFilter(&e, registryFilter, searchFilter) {
+			if !filter.match(&e) {
 				continue
 			}
 			if outputJSON {
@@ -412,7 +455,7 @@ func (h *CustomHandler) recorderStream(c *gin.Context) {
 	}
 }
 
-// RecorderHandler handles GET /customapi/recorder with optional query: output=json, limit=N, follow=true, registry=<exact>, search=<substring>.
+// RecorderHandler handles GET /customapi/recorder with optional query: output=json, limit=N, follow=true, registry=<exact>, search=<substring>, type=<types>.
 func (h *CustomHandler) RecorderHandler(c *gin.Context) {
 	if c.Query("follow") == "true" {
 		h.recorderStream(c)
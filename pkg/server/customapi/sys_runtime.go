@@ -0,0 +1,53 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sys/unix"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// Runtime returns the goroutine count, GC stats and open file descriptors of the process, the profiles
+// are served by pprof under /debug/pprof.
+func (h *CustomHandler) Runtime(c *gin.Context) (interface{}, error) {
+	return collectRuntime(), nil
+}
+
+func collectRuntime() *apitypes.RuntimeResponse {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	resp := &apitypes.RuntimeResponse{
+		GoVersion:     runtime.Version(),
+		Goroutines:    runtime.NumGoroutine(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		HeapAlloc:     ms.HeapAlloc,
+		HeapInuse:     ms.HeapInuse,
+		HeapObjects:   ms.HeapObjects,
+		Sys:           ms.Sys,
+		NumGC:         ms.NumGC,
+		GCPauseMs:     float64(ms.PauseTotalNs) / 1e6,
+		GCCPUFraction: ms.GCCPUFraction,
+		OpenFDs:       -1,
+		MaxFDs:        -1,
+	}
+	if ms.NumGC > 0 {
+		resp.LastGC = time.Unix(0, int64(ms.LastGC))
+		resp.LastGCPauseMs = float64(ms.PauseNs[(ms.NumGC+255)%256]) / 1e6
+	}
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		resp.OpenFDs = len(entries)
+	}
+	var rlimit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit); err == nil {
+		resp.MaxFDs = int64(rlimit.Cur)
+	}
+	return resp
+}
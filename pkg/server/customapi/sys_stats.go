@@ -6,6 +6,7 @@ package customapi
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,6 +15,8 @@ import (
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/upstreamhealth"
 )
 
 // decimalFloat marshals as a normal decimal number in JSON (no scientific notation).
@@ -24,15 +27,42 @@ func (f decimalFloat) MarshalJSON() ([]byte, error) {
 }
 
 type statsJSON struct {
-	ContainerdEnabled bool                `json:"containerdEnabled"`
-	Torrent           torrentStatsJSON    `json:"torrent"`
-	Master            string              `json:"master"`
-	HTTPProxy         string              `json:"httpProxy"`
-	Upstreams         []upstreamEntryJSON `json:"upstreams"`
-	Storage           []storageEntryJSON  `json:"storage"`
-	Cleanup           cleanStatsJSON      `json:"cleanup"`
-	Transfer          []transferEntryJSON `json:"transfer"`
-	ErrorsTotal       int64               `json:"errorsTotal"`
+	ContainerdEnabled bool                      `json:"containerdEnabled"`
+	Torrent           torrentStatsJSON          `json:"torrent"`
+	Master            string                    `json:"master"`
+	HTTPProxy         string                    `json:"httpProxy"`
+	Upstreams         []upstreamEntryJSON       `json:"upstreams"`
+	Storage           []storageEntryJSON        `json:"storage"`
+	Cleanup           cleanStatsJSON            `json:"cleanup"`
+	Transfer          []transferEntryJSON       `json:"transfer"`
+	ErrorsTotal       int64                     `json:"errorsTotal"`
+	CacheStore        cacheStoreStatsJSON       `json:"cacheStore"`
+	HitRatio          hitRatioStatsJSON         `json:"hitRatio"`
+	Runtime           *apitypes.RuntimeResponse `json:"runtime"`
+}
+
+// hitRatioStatsJSON summarizes how the requests are served since started, the ratios are in [0, 1]
+type hitRatioStatsJSON struct {
+	BlobRequests   int64              `json:"blobRequests"`
+	BlobOutcomes   []outcomeEntryJSON `json:"blobOutcomes"`
+	ManifestLookup int64              `json:"manifestLookup"`
+	ManifestHit    decimalFloat       `json:"manifestHit"`
+	TokenLookup    int64              `json:"tokenLookup"`
+	TokenHit       decimalFloat       `json:"tokenHit"`
+}
+
+type outcomeEntryJSON struct {
+	Outcome  string       `json:"outcome"`
+	Requests int64        `json:"requests"`
+	Ratio    decimalFloat `json:"ratio"`
+}
+
+// blobOutcomeOrder the tiers of serving blob, from the nearest to the farthest
+var blobOutcomeOrder = []string{"local_hit", "peer_tcp", "peer_torrent", "origin", "fallback_reverse_proxy"}
+
+type cacheStoreStatsJSON struct {
+	Degraded      bool `json:"degraded"`
+	PendingWrites int  `json:"pendingWrites"`
 }
 
 type torrentStatsJSON struct {
@@ -65,6 +95,8 @@ type upstreamEntryJSON struct {
 	ProxyHost    string `json:"proxyHost"`
 	OriginalHost string `json:"originalHost"`
 	Enabled      bool   `json:"enabled"`
+	// Health the probed health of the original host and replicas, empty if upstream health not enabled
+	Health []*apitypes.UpstreamHealth `json:"health,omitempty"`
 }
 
 // storageLabelOrder matches options.StorageConfig fields for ordered output of directories.
@@ -82,7 +114,7 @@ var storageLabelOrder = []struct {
 // Stats returns runtime stats (storage, transfer, errors, torrent, upstreams) as JSON or formatted text
 // (see HTTPWrapperWithOutput).
 func (h *CustomHandler) Stats(c *gin.Context) (interface{}, string, error) {
-	op := h.op
+	op := options.GlobalOptions()
 	tc := op.TorrentConfig
 	sm, _ := getStatsMetrics()
 	storage := make([]storageEntryJSON, 0, len(storageLabelOrder))
@@ -118,23 +150,73 @@ func (h *CustomHandler) Stats(c *gin.Context) (interface{}, string, error) {
 		Cleanup:     cleanup,
 		Transfer:    transfer,
 		ErrorsTotal: sm.ErrorsTotal,
+		CacheStore: cacheStoreStatsJSON{
+			Degraded:      h.cacheStore.Degraded(),
+			PendingWrites: h.cacheStore.PendingWrites(),
+		},
+		HitRatio: buildHitRatio(sm),
+		Runtime:  collectRuntime(),
 	}
 	text := formatStats(js)
 	return js, text, nil
 }
 
+func buildHitRatio(sm StatsMetrics) hitRatioStatsJSON {
+	var blobTotal float64
+	for _, v := range sm.BlobOutcomes {
+		blobTotal += v
+	}
+	hr := hitRatioStatsJSON{
+		BlobRequests: int64(blobTotal),
+		BlobOutcomes: make([]outcomeEntryJSON, 0, len(blobOutcomeOrder)),
+	}
+	for _, outcome := range blobOutcomeOrder {
+		v := sm.BlobOutcomes[outcome]
+		hr.BlobOutcomes = append(hr.BlobOutcomes, outcomeEntryJSON{
+			Outcome:  outcome,
+			Requests: int64(v),
+			Ratio:    decimalFloat(ratio(v, blobTotal)),
+		})
+	}
+	manifestTotal := sm.ManifestCache["hit"] + sm.ManifestCache["miss"]
+	hr.ManifestLookup = int64(manifestTotal)
+	hr.ManifestHit = decimalFloat(ratio(sm.ManifestCache["hit"], manifestTotal))
+	tokenHit := sm.TokenCache["hit"] + sm.TokenCache["store_hit"]
+	tokenTotal := tokenHit + sm.TokenCache["miss"]
+	hr.TokenLookup = int64(tokenTotal)
+	hr.TokenHit = decimalFloat(ratio(tokenHit, tokenTotal))
+	return hr
+}
+
+func ratio(v, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(v/total*10000) / 10000
+}
+
 func sortTransferEntries(entries []transferEntryJSON) {
 	sort.Slice(entries, func(i, j int) bool { return entries[i].Operation < entries[j].Operation })
 }
 
 func buildUpstreamsList(op *options.AccelerBoatOption) []upstreamEntryJSON {
 	list := make([]upstreamEntryJSON, 0, 1+len(op.ExternalConfig.RegistryMappings))
+	healths := make(map[string]*apitypes.UpstreamHealth)
+	for _, h := range upstreamhealth.Statuses() {
+		healths[h.Host] = h
+	}
 	for _, m := range op.ExternalConfig.RegistryMappings {
-		list = append(list, upstreamEntryJSON{
+		entry := upstreamEntryJSON{
 			ProxyHost:    m.ProxyHost,
 			OriginalHost: m.OriginalHost,
 			Enabled:      m.Enable,
-		})
+		}
+		for _, host := range m.OriginalHosts() {
+			if h, ok := healths[host]; ok {
+				entry.Health = append(entry.Health, h)
+			}
+		}
+		list = append(list, entry)
 	}
 	return list
 }
@@ -166,13 +248,50 @@ func formatStats(js statsJSON) string {
 		b.WriteString(fmt.Sprintf("  %s  =>  %.4g GB\n", t.Operation, float64(t.SizeGB)))
 	}
 	b.WriteString(fmt.Sprintf("\nErrorsTotal:  %d\n", js.ErrorsTotal))
+	b.WriteString("\nCacheStore:\n")
+	b.WriteString(fmt.Sprintf("  Degraded:      %t\n", js.CacheStore.Degraded))
+	b.WriteString(fmt.Sprintf("  PendingWrites: %d\n", js.CacheStore.PendingWrites))
+	b.WriteString(fmt.Sprintf("\nHitRatio (since started, %d blob requests):\n", js.HitRatio.BlobRequests))
+	for _, o := range js.HitRatio.BlobOutcomes {
+		b.WriteString(fmt.Sprintf("  %-24s %8d  %6.2f%%\n", o.Outcome, o.Requests, float64(o.Ratio)*100))
+	}
+	b.WriteString(fmt.Sprintf("  %-24s %8d  %6.2f%%\n", "manifest_cache_hit", js.HitRatio.ManifestLookup,
+		float64(js.HitRatio.ManifestHit)*100))
+	b.WriteString(fmt.Sprintf("  %-24s %8d  %6.2f%%\n", "token_cache_hit", js.HitRatio.TokenLookup,
+		float64(js.HitRatio.TokenHit)*100))
+	b.WriteString("\nRuntime:\n")
+	b.WriteString(fmt.Sprintf("  Goroutines: %d\n", js.Runtime.Goroutines))
+	b.WriteString(fmt.Sprintf("  HeapInuse:  %.2f MB (sys %.2f MB)\n", float64(js.Runtime.HeapInuse)/1e6,
+		float64(js.Runtime.Sys)/1e6))
+	b.WriteString(fmt.Sprintf("  GC:         %d times, pause total %.2fms, last pause %.2fms\n", js.Runtime.NumGC,
+		js.Runtime.GCPauseMs, js.Runtime.LastGCPauseMs))
+	b.WriteString(fmt.Sprintf("  OpenFDs:    %d (max %d)\n", js.Runtime.OpenFDs, js.Runtime.MaxFDs))
 	b.WriteString("\nUpstreams:\n")
 	for _, u := range js.Upstreams {
 		b.WriteString(fmt.Sprintf("  - %s -> %s  [Enabled: %s]\n", u.ProxyHost, u.OriginalHost, formatBool(u.Enabled)))
+		for _, h := range u.Health {
+			b.WriteString(fmt.Sprintf("      %s  %s  v2 %dms, token %dms, availability %.0f%%%s\n", h.Host,
+				formatHealthy(h.Healthy), h.V2LatencyMs, h.TokenLatencyMs, h.Availability*100,
+				formatLastError(h.LastError)))
+		}
 	}
 	return b.String()
 }
 
+func formatHealthy(v bool) string {
+	if v {
+		return "up"
+	}
+	return "down"
+}
+
+func formatLastError(err string) string {
+	if err == "" {
+		return ""
+	}
+	return " (last error: " + err + ")"
+}
+
 func formatBool(v bool) string {
 	if v {
 		return "enabled"
@@ -0,0 +1,107 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	storageTopDefault = 10
+	// storageOrphanedAge the part file not modified for the age is treated as orphaned, the transferring
+	// part file is appended continuously
+	storageOrphanedAge = 10 * time.Minute
+	// storageSparseRatio the file is sparse if its logical size exceeds the allocated size by the ratio
+	storageSparseRatio = 10
+)
+
+// Storage inspects the storage directories with optional query: top=N (the largest N layers). It returns
+// the file counts and sizes of directories, the largest layers, the orphaned part files and the largest N
+// sparse files.
+func (h *CustomHandler) Storage(c *gin.Context) (interface{}, error) {
+	top := storageTopDefault
+	if s := c.Query("top"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			top = n
+		}
+	}
+	op := options.GlobalOptions()
+	resp := &apitypes.StorageResponse{
+		Directories:   make([]*apitypes.StorageDirectory, 0, len(storageLabelOrder)),
+		LargestLayers: make([]*apitypes.StorageFile, 0),
+		OrphanedParts: make([]*apitypes.StorageFile, 0),
+		SparseFiles:   make([]*apitypes.StorageFile, 0),
+	}
+	now := time.Now()
+	for _, e := range storageLabelOrder {
+		dir := &apitypes.StorageDirectory{Label: e.Label, Path: e.Path(op)}
+		resp.Directories = append(resp.Directories, dir)
+		if dir.Path == "" {
+			continue
+		}
+		err := filepath.WalkDir(dir.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				// the file is removed during walking
+				return nil
+			}
+			file := &apitypes.StorageFile{Label: e.Label, Path: path, Size: fi.Size(),
+				AllocatedSize: fi.Size(), ModTime: fi.ModTime()}
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+				file.AllocatedSize = st.Blocks * 512
+			}
+			dir.Files++
+			dir.Size += file.Size
+			dir.AllocatedSize += file.AllocatedSize
+			switch {
+			case strings.HasSuffix(path, ".part"):
+				if now.Sub(file.ModTime) > storageOrphanedAge {
+					resp.OrphanedParts = append(resp.OrphanedParts, file)
+				}
+			case strings.HasSuffix(path, ".tar.gzip"):
+				resp.LargestLayers = append(resp.LargestLayers, file)
+			}
+			if file.Size > file.AllocatedSize*storageSparseRatio {
+				resp.SparseFiles = append(resp.SparseFiles, file)
+			}
+			return nil
+		})
+		if err != nil {
+			dir.Error = err.Error()
+		}
+	}
+	sort.Slice(resp.LargestLayers, func(i, j int) bool {
+		return resp.LargestLayers[i].Size > resp.LargestLayers[j].Size
+	})
+	if len(resp.LargestLayers) > top {
+		resp.LargestLayers = resp.LargestLayers[:top]
+	}
+	// the sparse files with the most unallocated bytes first
+	sort.Slice(resp.SparseFiles, func(i, j int) bool {
+		return resp.SparseFiles[i].Size-resp.SparseFiles[i].AllocatedSize >
+			resp.SparseFiles[j].Size-resp.SparseFiles[j].AllocatedSize
+	})
+	if len(resp.SparseFiles) > top {
+		resp.SparseFiles = resp.SparseFiles[:top]
+	}
+	sort.Slice(resp.OrphanedParts, func(i, j int) bool {
+		return resp.OrphanedParts[i].ModTime.Before(resp.OrphanedParts[j].ModTime)
+	})
+	return resp, nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/version"
+)
+
+// Version handles GET /customapi/version with optional query nodes=true, it returns the build of this
+// node, and the versions of all alive nodes reported by their heartbeats if nodes is true.
+func (h *CustomHandler) Version(c *gin.Context) (interface{}, error) {
+	resp := &apitypes.VersionResponse{BuildInfo: version.Get()}
+	if c.Query("nodes") != "true" {
+		return resp, nil
+	}
+	heartbeats, err := h.cacheStore.NodeHeartbeats(c.Request.Context())
+	if err != nil {
+		return nil, errors.Wrapf(err, "query node heartbeats failed")
+	}
+	resp.Nodes = make([]*apitypes.NodeVersion, 0, len(heartbeats))
+	for _, hb := range heartbeats {
+		resp.Nodes = append(resp.Nodes, &apitypes.NodeVersion{
+			Node:          hb.Node,
+			Version:       hb.Version,
+			GitCommit:     hb.GitCommit,
+			APIVersion:    hb.APIVersion,
+			Capabilities:  hb.Capabilities,
+			LastHeartbeat: time.Unix(hb.TS, 0),
+		})
+	}
+	return resp, nil
+}
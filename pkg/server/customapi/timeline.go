@@ -0,0 +1,249 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	// timelineEventsLimit the max events to read for building the pull timeline
+	timelineEventsLimit = 100000
+	// timelineDefaultWindow the default window after the first event of pull to correlate events
+	timelineDefaultWindow = 10 * time.Minute
+	// timelineTokenLead the duration before the manifest event to correlate the service token events
+	timelineTokenLead = 30 * time.Second
+)
+
+// timelineMethods the transfer method of blob events
+var timelineMethods = map[recorder.EventType]string{
+	recorder.EventServeBlobFromLocal:        "local",
+	recorder.EventTypeGetBlobFromMaster:     "master",
+	recorder.EventTypeDownloadBlobByTCP:     "tcp",
+	recorder.EventTypeDownloadBlobByTorrent: "torrent",
+	recorder.EventTypeReverseProxy:          "origin",
+}
+
+// PullTimeline returns the ordered events of one image pull. The pull is located by query 'requestID', or
+// 'repo' and 'tag' (optional 'registry' and 'since'). The events of the same image within the 'window'
+// (default 10m) are correlated, and the events sharing request ID with them (e.g. recorded by master) are
+// also included.
+func (h *CustomHandler) PullTimeline(c *gin.Context) (interface{}, string, error) {
+	requestID := strings.TrimSpace(c.Query("requestID"))
+	registry := strings.TrimSpace(c.Query("registry"))
+	repo := strings.TrimSpace(c.Query("repo"))
+	tag := strings.TrimSpace(c.Query("tag"))
+	if requestID == "" && (repo == "" || tag == "") {
+		return nil, "", errors.Errorf("query 'requestID' or 'repo' with 'tag' is required")
+	}
+	window := timelineDefaultWindow
+	if s := c.Query("window"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, "", errors.Errorf("query 'window' '%s' is not valid duration", s)
+		}
+		window = d
+	}
+	var since *time.Time
+	if s := c.Query("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "query 'since' '%s' is not RFC3339 time", s)
+		}
+		since = &t
+	}
+	events := recorder.Global.List(timelineEventsLimit, nil, since)
+	var timeline *apitypes.PullTimelineResponse
+	if requestID != "" {
+		timeline = buildTimelineByRequestID(events, requestID, window)
+	} else {
+		timeline = buildTimelineByImage(events, registry, repo, tag, window)
+	}
+	return timeline, formatPullTimeline(timeline), nil
+}
+
+// timelineImage defines the image that events are correlated with
+type timelineImage struct {
+	registry string
+	repo     string
+}
+
+func (i *timelineImage) match(e *recorder.Event) bool {
+	if i.registry != "" && detailStr(e.Details, "registry") != i.registry {
+		return false
+	}
+	if detailStr(e.Details, "repo") == i.repo {
+		return true
+	}
+	return e.Type == recorder.EventTypeServiceToken &&
+		strings.Contains(detailStr(e.Details, "scope"), "repository:"+i.repo+":")
+}
+
+func buildTimelineByRequestID(events []recorder.Event, requestID string,
+	window time.Duration) *apitypes.PullTimelineResponse {
+	var anchors []*recorder.Event
+	for i := range events {
+		if events[i].RequestID == requestID {
+			anchors = append(anchors, &events[i])
+		}
+	}
+	image := &timelineImage{}
+	var tag string
+	for _, e := range anchors {
+		if image.repo == "" && detailStr(e.Details, "repo") != "" {
+			image.registry = detailStr(e.Details, "registry")
+			image.repo = detailStr(e.Details, "repo")
+		}
+		if tag == "" {
+			tag = detailStr(e.Details, "tag")
+		}
+	}
+	if image.repo == "" {
+		return newPullTimeline(image, tag, anchors)
+	}
+	// the manifest request is the start of pull, otherwise the blob request might be in the middle
+	start := anchors[0].Timestamp.Add(-window)
+	if tag != "" {
+		start = anchors[0].Timestamp.Add(-timelineTokenLead)
+	}
+	end := anchors[len(anchors)-1].Timestamp.Add(window)
+	return newPullTimeline(image, tag, correlateEvents(events, image, start, end, anchors))
+}
+
+func buildTimelineByImage(events []recorder.Event, registry, repo, tag string,
+	window time.Duration) *apitypes.PullTimelineResponse {
+	image := &timelineImage{registry: registry, repo: repo}
+	// the latest manifest request of the image is the start of pull
+	var anchor *recorder.Event
+	for i := range events {
+		e := &events[i]
+		if e.Type != recorder.EventTypeHeadManifest && e.Type != recorder.EventTypeGetManifest {
+			continue
+		}
+		if image.match(e) && detailStr(e.Details, "tag") == tag {
+			anchor = e
+		}
+	}
+	if anchor == nil {
+		return newPullTimeline(image, tag, nil)
+	}
+	start := anchor.Timestamp.Add(-timelineTokenLead)
+	end := anchor.Timestamp.Add(window)
+	return newPullTimeline(image, tag, correlateEvents(events, image, start, end, []*recorder.Event{anchor}))
+}
+
+// correlateEvents returns the events of image within [start, end], and the events sharing request ID with them
+func correlateEvents(events []recorder.Event, image *timelineImage, start, end time.Time,
+	anchors []*recorder.Event) []*recorder.Event {
+	requestIDs := make(map[string]struct{})
+	for _, e := range anchors {
+		if e.RequestID != "" {
+			requestIDs[e.RequestID] = struct{}{}
+		}
+	}
+	for i := range events {
+		e := &events[i]
+		if e.RequestID == "" || e.Timestamp.Before(start) || e.Timestamp.After(end) || !image.match(e) {
+			continue
+		}
+		requestIDs[e.RequestID] = struct{}{}
+	}
+	result := make([]*recorder.Event, 0)
+	for i := range events {
+		e := &events[i]
+		if _, ok := requestIDs[e.RequestID]; ok && e.RequestID != "" {
+			result = append(result, e)
+			continue
+		}
+		if !e.Timestamp.Before(start) && !e.Timestamp.After(end) && image.match(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func newPullTimeline(image *timelineImage, tag string, events []*recorder.Event) *apitypes.PullTimelineResponse {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	timeline := &apitypes.PullTimelineResponse{
+		Registry:   image.registry,
+		Repo:       image.repo,
+		Tag:        tag,
+		RequestIDs: make([]string, 0),
+		Entries:    make([]*apitypes.PullTimelineEntry, 0, len(events)),
+	}
+	if len(events) == 0 {
+		return timeline
+	}
+	timeline.Start = events[0].Timestamp
+	requestIDs := make(map[string]struct{})
+	for _, e := range events {
+		if _, ok := requestIDs[e.RequestID]; !ok && e.RequestID != "" {
+			requestIDs[e.RequestID] = struct{}{}
+			timeline.RequestIDs = append(timeline.RequestIDs, e.RequestID)
+		}
+		durationMs := convertInt64(e.Details["duration_ms"])
+		if end := e.Timestamp.Add(time.Duration(durationMs) * time.Millisecond); end.After(timeline.End) {
+			timeline.End = end
+		}
+		timeline.Entries = append(timeline.Entries, &apitypes.PullTimelineEntry{
+			Timestamp:  e.Timestamp,
+			OffsetMs:   e.Timestamp.Sub(timeline.Start).Milliseconds(),
+			RequestID:  e.RequestID,
+			Type:       string(e.Type),
+			Status:     string(e.EventStatus),
+			Digest:     detailStr(e.Details, "digest"),
+			Method:     timelineMethods[e.Type],
+			DurationMs: durationMs,
+			Message:    e.Message,
+		})
+	}
+	timeline.DurationMs = timeline.End.Sub(timeline.Start).Milliseconds()
+	return timeline
+}
+
+func formatPullTimeline(timeline *apitypes.PullTimelineResponse) string {
+	if len(timeline.Entries) == 0 {
+		return "No events found for the pull\n"
+	}
+	var b strings.Builder
+	image := timeline.Repo
+	if timeline.Registry != "" {
+		image = timeline.Registry + "/" + image
+	}
+	if timeline.Tag != "" {
+		image += ":" + timeline.Tag
+	}
+	fmt.Fprintf(&b, "Image:      %s\n", image)
+	fmt.Fprintf(&b, "Start:      %s\n", timeline.Start.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Duration:   %.3fs\n", float64(timeline.DurationMs)/1000)
+	fmt.Fprintf(&b, "RequestIDs: %s\n", strings.Join(timeline.RequestIDs, ", "))
+	tbl := tablewriter.NewWriter(&b)
+	tbl.SetHeader([]string{"Offset", "Type", "Status", "RequestID", "Digest", "Method", "Duration", "Message"})
+	tbl.SetAlignment(tablewriter.ALIGN_LEFT)
+	tbl.SetBorder(true)
+	tbl.SetColWidth(recorderMessageWrap)
+	for _, e := range timeline.Entries {
+		duration := "-"
+		if e.DurationMs != 0 {
+			duration = fmt.Sprintf("%.3fs", float64(e.DurationMs)/1000)
+		}
+		tbl.Append([]string{fmt.Sprintf("+%.3fs", float64(e.OffsetMs)/1000), formatEventType(e.Type),
+			e.Status, e.RequestID, e.Digest, e.Method, duration, wrapMessage(e.Message, recorderMessageWrap)})
+	}
+	tbl.Render()
+	return b.String()
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	// tokenCacheMargin the token is not cached or responded if it expires within the margin
+	tokenCacheMargin = 60 * time.Second
+)
+
+// cachedToken defines the service token saved in cache store
+type cachedToken struct {
+	Token    *apitypes.RegistryAuthToken `json:"token"`
+	ExpireAt time.Time                   `json:"expireAt"`
+}
+
+// tokenCipher returns the AES-GCM cipher with the key derived from the encryption key of option
+func (h *CustomHandler) tokenCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(h.op().TokenCache.EncryptionKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "create aes cipher failed")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create gcm cipher failed")
+	}
+	return aead, nil
+}
+
+// saveCachedToken encrypts the service token and saves it into cache store, the expiration honors the
+// ExpiresIn of token
+func (h *CustomHandler) saveCachedToken(ctx context.Context, authKey string, token *apitypes.RegistryAuthToken) {
+	if !h.op().TokenCache.Enable || token.ExpiresIn <= 0 {
+		return
+	}
+	issuedAt := token.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	expireAt := issuedAt.Add(time.Duration(token.ExpiresIn) * time.Second)
+	expire := time.Until(expireAt) - tokenCacheMargin
+	if expire <= 0 {
+		return
+	}
+	if err := h.handleSaveCachedToken(ctx, authKey, &cachedToken{Token: token, ExpireAt: expireAt},
+		expire); err != nil {
+		logger.WarnContextf(ctx, "save service token into cache store failed: %s", err.Error())
+	}
+}
+
+func (h *CustomHandler) handleSaveCachedToken(ctx context.Context, authKey string, ct *cachedToken,
+	expire time.Duration) error {
+	plain, err := json.Marshal(ct)
+	if err != nil {
+		return errors.Wrapf(err, "marshal token failed")
+	}
+	aead, err := h.tokenCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrapf(err, "generate nonce failed")
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(authKey))
+	return h.cacheStore.SaveServiceToken(ctx, authKey, sealed, expire)
+}
+
+// getCachedToken returns the service token from cache store, returns nil if not exist or nearly expired.
+// The ExpiresIn of returned token is the remaining seconds.
+func (h *CustomHandler) getCachedToken(ctx context.Context, authKey string) *apitypes.RegistryAuthToken {
+	if !h.op().TokenCache.Enable {
+		return nil
+	}
+	ct, err := h.handleGetCachedToken(ctx, authKey)
+	if err != nil {
+		logger.WarnContextf(ctx, "get service token from cache store failed: %s", err.Error())
+		return nil
+	}
+	if ct == nil || ct.Token == nil {
+		return nil
+	}
+	remaining := time.Until(ct.ExpireAt)
+	if remaining <= tokenCacheMargin {
+		return nil
+	}
+	ct.Token.ExpiresIn = int(remaining.Seconds())
+	return ct.Token
+}
+
+func (h *CustomHandler) handleGetCachedToken(ctx context.Context, authKey string) (*cachedToken, error) {
+	sealed, err := h.cacheStore.GetServiceToken(ctx, authKey)
+	if err != nil || sealed == nil {
+		return nil, err
+	}
+	aead, err := h.tokenCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.Errorf("cached token too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	// the token cannot be decrypted if the encryption key changed, it is treated as not exist
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(authKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "decrypt cached token failed")
+	}
+	ct := new(cachedToken)
+	if err = json.Unmarshal(plain, ct); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal cached token failed")
+	}
+	return ct, nil
+}
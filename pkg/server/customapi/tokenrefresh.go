@@ -0,0 +1,124 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	// tokenRefreshInterval the interval of checking the tokens of hot scopes
+	tokenRefreshInterval = 10 * time.Second
+	tokenRefreshTimeout  = 30 * time.Second
+)
+
+// tokenScope defines the requested scope of service token, the last request is kept to refresh the token
+type tokenScope struct {
+	req         *apitypes.GetServiceTokenRequest
+	windowStart time.Time
+	hits        int
+	lastHit     time.Time
+}
+
+// tokenScopes tracks the requested times of service token scopes
+type tokenScopes struct {
+	sync.Mutex
+	scopes map[string]*tokenScope
+}
+
+func newTokenScopes() *tokenScopes {
+	return &tokenScopes{scopes: make(map[string]*tokenScope)}
+}
+
+// hit records the request of scope, the request is copied because its headers are changed by handler
+func (ts *tokenScopes) hit(authKey string, req *apitypes.GetServiceTokenRequest, window time.Duration) {
+	headers := make(map[string][]string, len(req.Headers))
+	for k, v := range req.Headers {
+		headers[k] = append([]string(nil), v...)
+	}
+	reqCopy := *req
+	reqCopy.Headers = headers
+	now := time.Now()
+
+	ts.Lock()
+	defer ts.Unlock()
+	scope, ok := ts.scopes[authKey]
+	if !ok || now.Sub(scope.windowStart) > window {
+		scope = &tokenScope{windowStart: now}
+		ts.scopes[authKey] = scope
+	}
+	scope.req = &reqCopy
+	scope.hits++
+	scope.lastHit = now
+}
+
+// hotScopes returns the requests of hot scopes, and removes the scopes not requested within window
+func (ts *tokenScopes) hotScopes(threshold int, window time.Duration) map[string]*apitypes.GetServiceTokenRequest {
+	now := time.Now()
+	result := make(map[string]*apitypes.GetServiceTokenRequest)
+	ts.Lock()
+	defer ts.Unlock()
+	for authKey, scope := range ts.scopes {
+		if now.Sub(scope.lastHit) > window {
+			delete(ts.scopes, authKey)
+			continue
+		}
+		if scope.hits >= threshold {
+			result[authKey] = scope.req
+		}
+	}
+	return result
+}
+
+// RunTokenRefresher refreshes the tokens of hot scopes before they expire until ctx done
+func (h *CustomHandler) RunTokenRefresher(ctx context.Context) {
+	ticker := time.NewTicker(tokenRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !h.op().TokenRefresh.Enable {
+				continue
+			}
+			cfg := h.op().TokenRefresh
+			window := time.Duration(cfg.HotWindow) * time.Second
+			for authKey, req := range h.tokenScopes.hotScopes(cfg.HotThreshold, window) {
+				_, expireAt, ok := h.authTokens.GetWithExpiration(authKey)
+				if ok && (expireAt.IsZero() ||
+					time.Until(expireAt) > time.Duration(cfg.RefreshBefore)*time.Second) {
+					continue
+				}
+				h.refreshToken(ctx, authKey, req)
+			}
+		}
+	}
+}
+
+func (h *CustomHandler) refreshToken(ctx context.Context, authKey string, req *apitypes.GetServiceTokenRequest) {
+	ctx = logger.WithContextFields(ctx, "registry", req.OriginalHost, "scope", req.Scope)
+	ctx, cancel := context.WithTimeout(ctx, tokenRefreshTimeout)
+	defer cancel()
+	h.authLock.Lock(ctx, authKey)
+	defer h.authLock.UnLock(ctx, authKey)
+
+	token, err := getServiceTokenWithCheck(ctx, req)
+	if err != nil {
+		metrics.TokenRefreshTotal.WithLabelValues("error").Inc()
+		logger.WarnContextf(ctx, "refresh service token of hot scope failed: %s", err.Error())
+		return
+	}
+	metrics.TokenRefreshTotal.WithLabelValues("success").Inc()
+	h.saveCachedToken(ctx, authKey, token)
+	h.saveAuthToken(authKey, token)
+	logger.InfoContextf(ctx, "refresh service token of hot scope success")
+}
@@ -0,0 +1,39 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// GetTorrentLimits returns the effective rate limits of torrent client
+func (h *CustomHandler) GetTorrentLimits(c *gin.Context) (interface{}, error) {
+	return h.torrentHandler.RateLimits(), nil
+}
+
+// OverrideTorrentLimits overrides the rate limits of torrent client temporarily, e.g. restrict the
+// bandwidth during business hours. The limits revert to schedule or config after the duration.
+func (h *CustomHandler) OverrideTorrentLimits(c *gin.Context) (interface{}, error) {
+	req := &apitypes.TorrentLimitsRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return nil, errors.Wrapf(err, "parse request failed")
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse duration '%s' failed", req.Duration)
+	}
+	return h.torrentHandler.OverrideLimits(req.UploadLimit, req.DownloadLimit, duration)
+}
+
+// ClearTorrentLimits removes the temporary override, the rate limits revert to schedule or config
+func (h *CustomHandler) ClearTorrentLimits(c *gin.Context) (interface{}, error) {
+	h.torrentHandler.ClearOverrideLimits()
+	return h.torrentHandler.RateLimits(), nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	torrentActionDrop   = "drop"
+	torrentActionVerify = "verify"
+)
+
+// ListTorrents returns the torrents in the torrent client of node with completion and peers
+func (h *CustomHandler) ListTorrents(c *gin.Context) (interface{}, error) {
+	return &apitypes.TorrentListResponse{Torrents: h.torrentHandler.ListTorrents()}, nil
+}
+
+// TorrentAction drops or re-verifies the torrent, the path is '/customapi/torrents/{digest}:drop' or
+// '/customapi/torrents/{digest}:verify'
+func (h *CustomHandler) TorrentAction(c *gin.Context) (interface{}, error) {
+	param := c.Param("torrent")
+	idx := strings.LastIndex(param, ":")
+	if idx <= 0 {
+		return nil, errors.Errorf("path should be '%s/{digest}:drop|verify'", apitypes.APITorrents)
+	}
+	digest, action := param[:idx], param[idx+1:]
+	switch action {
+	case torrentActionDrop:
+		return h.torrentHandler.DropTorrent(c.Request.Context(), digest)
+	case torrentActionVerify:
+		return h.torrentHandler.VerifyTorrent(c.Request.Context(), digest)
+	default:
+		return nil, errors.Errorf("action '%s' not supported, should be drop or verify", action)
+	}
+}
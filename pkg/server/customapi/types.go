@@ -6,14 +6,19 @@ package customapi
 
 import (
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/pkg/bittorrent"
+	"github.com/penglongli/accelerboat/pkg/federation"
+	"github.com/penglongli/accelerboat/pkg/hashring"
+	"github.com/penglongli/accelerboat/pkg/objectstore"
 	"github.com/penglongli/accelerboat/pkg/ociscan"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
 	"github.com/penglongli/accelerboat/pkg/store"
@@ -23,8 +28,9 @@ import (
 // CustomHandler defines a set of methods for external services. It is typically used by regular nodes to call
 // the master's external API capabilities.
 type CustomHandler struct {
-	op         *options.AccelerBoatOption
-	cacheStore store.CacheStore
+	cacheStore  store.CacheStore
+	objectStore objectstore.LayerStore
+	federation  *federation.Federation
 
 	authLock               lock.Interface
 	authTokens             *cache.Cache
@@ -32,35 +38,49 @@ type CustomHandler struct {
 	headManifests          *cache.Cache
 	getManifestLock        lock.Interface
 	manifests              *cache.Cache
+	signatureLock          lock.Interface
+	signatureResults       *cache.Cache
 	layerContentLengthLock lock.Interface
 	layerContentLengths    *cache.Cache
 	downloadLayerLock      lock.Interface
+	blockedLayers          *cache.Cache
+	tokenScopes            *tokenScopes
+	accounts               *accountPool
+	downloadTasks          *downloadTasks
 
 	staticLayerRefer map[string]map[string]int64
 	ociLayerRefer    map[string]map[string]int64
 
 	nodeDownloadLock  sync.Mutex
 	nodeDownloadTasks map[string]int
+	ring              *hashring.Ring
+	ringKey           string
 
 	torrentHandler *bittorrent.TorrentHandler
 	ociScanner     *ociscan.ScanHandler
 }
 
-// NewCustomHandler creates a CustomHandler with the given options, torrent handler, and OCI scanner.
-func NewCustomHandler(op *options.AccelerBoatOption, torrentHandler *bittorrent.TorrentHandler,
-	ociScanner *ociscan.ScanHandler) *CustomHandler {
+// NewCustomHandler creates a CustomHandler with the given torrent handler and OCI scanner.
+func NewCustomHandler(torrentHandler *bittorrent.TorrentHandler, ociScanner *ociscan.ScanHandler) *CustomHandler {
 	return &CustomHandler{
-		op:                     op,
 		cacheStore:             store.GlobalRedisStore(),
+		objectStore:            objectstore.GlobalLayerStore(),
+		federation:             federation.Global(),
 		authLock:               lock.NewLocalLock(),
 		authTokens:             cache.New(0, 5*time.Second),
 		headManifestLock:       lock.NewLocalLock(),
 		headManifests:          cache.New(0, 5*time.Second),
 		getManifestLock:        lock.NewLocalLock(),
 		manifests:              cache.New(0, 5*time.Second),
+		signatureLock:          lock.NewLocalLock(),
+		signatureResults:       cache.New(0, time.Minute),
 		layerContentLengthLock: lock.NewLocalLock(),
 		layerContentLengths:    cache.New(0, 5*time.Second),
 		downloadLayerLock:      lock.NewLocalLock(),
+		blockedLayers:          cache.New(0, time.Minute),
+		tokenScopes:            newTokenScopes(),
+		accounts:               newAccountPool(),
+		downloadTasks:          newDownloadTasks(),
 		nodeDownloadTasks:      make(map[string]int),
 		staticLayerRefer:       make(map[string]map[string]int64),
 		ociLayerRefer:          make(map[string]map[string]int64),
@@ -69,26 +89,65 @@ func NewCustomHandler(op *options.AccelerBoatOption, torrentHandler *bittorrent.
 	}
 }
 
+// op returns the current snapshot of options, the handler lives across config reloads so it is not kept
+func (h *CustomHandler) op() *options.AccelerBoatOption {
+	return options.GlobalOptions()
+}
+
 // Register mounts all custom API routes on the given Gin engine.
 func (h *CustomHandler) Register(ginSvr *gin.Engine) {
-	ginSvr.Handle(http.MethodPost, apitypes.APIGetServiceToken, h.HTTPWrapper(h.GetServiceToken))
-	ginSvr.Handle(http.MethodPost, apitypes.APIHeadManifest, h.HTTPWrapper(h.RegistryHeadManifest))
-	ginSvr.Handle(http.MethodPost, apitypes.APIGetManifest, h.HTTPWrapper(h.RegistryGetManifest))
+	ginSvr.Handle(http.MethodPost, apitypes.APIGetServiceToken, h.HTTPWrapper(h.masterOnly(h.GetServiceToken)))
+	ginSvr.Handle(http.MethodPost, apitypes.APIHeadManifest, h.HTTPWrapper(h.masterOnly(h.RegistryHeadManifest)))
+	ginSvr.Handle(http.MethodPost, apitypes.APIGetManifest, h.HTTPWrapper(h.masterOnly(h.RegistryGetManifest)))
 
 	ginSvr.Handle(http.MethodGet, apitypes.APICheckStaticLayer, h.HTTPWrapper(h.CheckStaticLayer))
 	ginSvr.Handle(http.MethodGet, apitypes.APICheckOCILayer, h.HTTPWrapper(h.CheckOCILayer))
 
-	ginSvr.Handle(http.MethodPost, apitypes.APIGetLayerInfo, h.HTTPWrapper(h.GetLayerInfo))
+	ginSvr.Handle(http.MethodPost, apitypes.APIGetLayerInfo, h.HTTPWrapper(h.masterOnly(h.GetLayerInfo)))
 	ginSvr.Handle(http.MethodGet, apitypes.APIDownloadLayer, h.HTTPWrapper(h.DownloadLayer))
+	ginSvr.Handle(http.MethodPost, apitypes.APICancelDownload, h.HTTPWrapper(h.CancelDownloadLayer))
 	ginSvr.Handle(http.MethodGet, apitypes.APIRecorder, h.RecorderHandler)
+	ginSvr.Handle(http.MethodGet, apitypes.APILogs, h.LogsHandler)
+	ginSvr.Handle(http.MethodGet, apitypes.APIReadiness, h.HTTPWrapper(h.Readiness))
 	ginSvr.Handle(http.MethodGet, apitypes.APITorrentStatus, h.HTTPWrapper(h.TorrentStatus))
+	ginSvr.Handle(http.MethodGet, apitypes.APITorrents, h.HTTPWrapper(h.ListTorrents))
+	ginSvr.Handle(http.MethodPost, apitypes.APITorrents+"/:torrent", h.HTTPWrapper(h.TorrentAction))
+	ginSvr.Handle(http.MethodPost, apitypes.APIDrain, h.HTTPWrapper(h.Drain))
+	ginSvr.Handle(http.MethodPost, apitypes.APIUncordon, h.HTTPWrapper(h.Uncordon))
 
 	ginSvr.Handle(http.MethodGet, apitypes.APITransferLayerTCP, h.HTTPWrapper(h.TransferLayerTCP))
+	ginSvr.Handle(http.MethodPost, apitypes.APIImportLayer, h.HTTPWrapper(h.ImportLayer))
+	ginSvr.Handle(http.MethodPost, apitypes.APIFederationDownloadLayer, h.HTTPWrapper(h.FederationDownloadLayer))
+	ginSvr.Handle(http.MethodGet, apitypes.APIFederationLayer, h.HTTPWrapper(h.FederationLayer))
+	ginSvr.Handle(http.MethodPost, apitypes.APIParentLayer, h.HTTPWrapper(h.ParentLayer))
 
 	ginSvr.Handle(http.MethodGet, apitypes.APIStats, h.HTTPWrapperWithOutput(h.Stats))
+	ginSvr.Handle(http.MethodGet, apitypes.APIStorage, h.HTTPWrapper(h.Storage))
+	ginSvr.Handle(http.MethodGet, apitypes.APIVersion, h.HTTPWrapper(h.Version))
+	ginSvr.Handle(http.MethodGet, apitypes.APIImagesSeen, h.HTTPWrapper(h.ImagesSeen))
+	ginSvr.Handle(http.MethodGet, apitypes.APILayerUsage, h.HTTPWrapper(h.LayerUsage))
+	ginSvr.Handle(http.MethodGet, apitypes.APIRuntime, h.HTTPWrapper(h.Runtime))
+	ginSvr.Handle(http.MethodGet, apitypes.APILayerAvailability, h.HTTPWrapper(h.LayerAvailability))
+	ginSvr.Handle(http.MethodPost, apitypes.APISchedulerPrioritize, h.HTTPWrapper(h.SchedulerPrioritize))
+	ginSvr.Handle(http.MethodGet, apitypes.APIRegistryCredential, h.HTTPWrapper(h.RegistryCredential))
+	ginSvr.Handle(http.MethodGet, apitypes.APIRedirectBlob, h.HTTPWrapper(h.RedirectBlob))
+	ginSvr.Handle(http.MethodHead, apitypes.APIRedirectBlob, h.HTTPWrapper(h.RedirectBlob))
+	ginSvr.Handle(http.MethodGet, apitypes.APIEstargzLayer, h.HTTPWrapper(h.EstargzLayer))
+	ginSvr.Handle(http.MethodGet, apitypes.APISavings, h.HTTPWrapper(h.Savings))
+	ginSvr.Handle(http.MethodGet, apitypes.APIScalingSignals, h.HTTPWrapper(h.ScalingSignals))
+	ginSvr.Handle(http.MethodGet, apitypes.APIExternalMetrics, h.ExternalMetrics)
+	ginSvr.Handle(http.MethodGet, apitypes.APIExternalMetricValue, h.ExternalMetricValue)
 	ginSvr.Handle(http.MethodGet, apitypes.APIMetrics, h.HTTPWrapperWithOutput(h.Metrics))
 	ginSvr.Handle(http.MethodGet, apitypes.APIConfig, h.HTTPWrapperWithOutput(h.Config))
 	ginSvr.Handle(http.MethodGet, apitypes.APIOCIImages, h.HTTPWrapperWithOutput(h.OCIImages))
+	ginSvr.Handle(http.MethodGet, apitypes.APIPullTimeline, h.HTTPWrapperWithOutput(h.PullTimeline))
+
+	ginSvr.Handle(http.MethodPost, apitypes.APIUpstreams+"/:upstream", h.HTTPWrapper(h.SwitchUpstream))
+	ginSvr.Handle(http.MethodGet, apitypes.APITorrentLimits, h.HTTPWrapper(h.GetTorrentLimits))
+	ginSvr.Handle(http.MethodPut, apitypes.APITorrentLimits, h.HTTPWrapper(h.OverrideTorrentLimits))
+	ginSvr.Handle(http.MethodDelete, apitypes.APITorrentLimits, h.HTTPWrapper(h.ClearTorrentLimits))
+	ginSvr.Handle(http.MethodGet, apitypes.APIPreheatHistory, h.HTTPWrapper(h.PreheatHistory))
+	ginSvr.Handle(http.MethodPost, apitypes.APIRegistryWebhook, h.HTTPWrapper(h.RegistryWebhook))
 }
 
 // HTTPWrapperWithOutput wraps handlers for stats/metrics/config etc.: if query param output=json
@@ -113,6 +172,31 @@ func (h *CustomHandler) HTTPWrapperWithOutput(f func(c *gin.Context) (interface{
 func (h *CustomHandler) HTTPWrapper(f func(c *gin.Context) (interface{}, error)) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		obj, err := f(c)
+		// the failure status of original registry is responded to worker with header, the worker decides
+		// whether to propagate it to client
+		var upErr *apitypes.UpstreamStatusError
+		if errors.As(err, &upErr) {
+			c.Header(apitypes.UpstreamStatusHeader, strconv.Itoa(upErr.StatusCode))
+			if upErr.Authenticate != "" {
+				c.Header("Www-Authenticate", upErr.Authenticate)
+			}
+			c.String(upErr.StatusCode, err.Error())
+			return
+		}
+		var nmErr *apitypes.NotMasterError
+		if errors.As(err, &nmErr) {
+			c.Header(apitypes.MasterAddressHeader, nmErr.Master)
+			c.String(http.StatusMisdirectedRequest, err.Error())
+			return
+		}
+		if errors.Is(err, apitypes.ErrSignatureVerifyFailed) || errors.Is(err, apitypes.ErrLayerBlocked) {
+			c.String(http.StatusForbidden, err.Error())
+			return
+		}
+		if errors.Is(err, apitypes.ErrWebhookUnauthorized) {
+			c.String(http.StatusUnauthorized, err.Error())
+			return
+		}
 		if err != nil {
 			c.String(http.StatusBadRequest, err.Error())
 			return
@@ -122,6 +206,10 @@ func (h *CustomHandler) HTTPWrapper(f func(c *gin.Context) (interface{}, error))
 			return
 		}
 
+		// the response is in the api version negotiated with peer
+		if v, ok := obj.(apitypes.Versioned); ok {
+			v.SetAPIVersion(apiVersion(c))
+		}
 		switch obj.(type) {
 		case string:
 			c.String(http.StatusOK, obj.(string))
@@ -0,0 +1,53 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	upstreamActionEnable  = "enable"
+	upstreamActionDisable = "disable"
+)
+
+// SwitchUpstream enables or disables the registry mapping at runtime, the path is
+// '/customapi/upstreams/{proxyHost}:enable' or '/customapi/upstreams/{proxyHost}:disable'. The disabled
+// registry mapping will reverse all requests to the original registry directly.
+func (h *CustomHandler) SwitchUpstream(c *gin.Context) (interface{}, error) {
+	upstream := c.Param("upstream")
+	idx := strings.LastIndex(upstream, ":")
+	if idx <= 0 {
+		return nil, errors.Errorf("path should be '%s/{proxyHost}:enable|disable'", apitypes.APIUpstreams)
+	}
+	proxyHost, action := upstream[:idx], upstream[idx+1:]
+	var enable bool
+	switch action {
+	case upstreamActionEnable:
+		enable = true
+	case upstreamActionDisable:
+		enable = false
+	default:
+		return nil, errors.Errorf("action '%s' not supported, should be enable or disable", action)
+	}
+	mapping, err := options.SetUpstreamEnable(proxyHost, enable)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s upstream '%s' failed", action, proxyHost)
+	}
+	logger.InfoContextf(c.Request.Context(), "%s upstream '%s' (original: %s) success", action,
+		proxyHost, mapping.OriginalHost)
+	return &apitypes.UpstreamSwitchResponse{
+		ProxyHost:    mapping.ProxyHost,
+		OriginalHost: mapping.OriginalHost,
+		Enable:       mapping.Enable,
+	}, nil
+}
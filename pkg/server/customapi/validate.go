@@ -0,0 +1,116 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package customapi
+
+import (
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// apiVersionKey the key of gin context with the api version negotiated with peer
+const apiVersionKey = "apiVersion"
+
+// peerRequest defines the request from peers which is sanitized before handling
+type peerRequest interface {
+	apitypes.Versioned
+	Sanitize() error
+}
+
+// bindRequest binds the json body of peer into request and sanitizes it. The request of legacy peer
+// (without apiVersion) is handled as LegacyAPIVersion, and the request of newer peer is handled as the
+// version of this node, the fields unknown to this node are ignored.
+func (h *CustomHandler) bindRequest(c *gin.Context, req peerRequest) error {
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.Wrapf(err, "parse request failed")
+	}
+	if err := req.Sanitize(); err != nil {
+		return errors.Wrapf(err, "invalid request")
+	}
+	version := apitypes.NegotiateAPIVersion(req.GetAPIVersion())
+	// the legacy node reads the layer locations from the legacy hash, they are written in both formats
+	// while it alive
+	if version == apitypes.LegacyAPIVersion {
+		h.cacheStore.MarkLegacyPeer()
+	}
+	c.Set(apiVersionKey, version)
+	return nil
+}
+
+// apiVersion returns the api version negotiated with peer, the version of this node if the request is
+// not from peer
+func apiVersion(c *gin.Context) int {
+	if v, ok := c.Get(apiVersionKey); ok {
+		return v.(int)
+	}
+	return apitypes.CurrentAPIVersion
+}
+
+// checkMaster returns NotMasterError if this node is not the master, the master-only APIs called on it are
+// misdirected (e.g. the caller not watched the change of master yet). The master unknown is not checked.
+func (h *CustomHandler) checkMaster() error {
+	master := leaderselector.CurrentMaster()
+	if master == "" || leaderselector.IsMaster(h.op().Address) {
+		return nil
+	}
+	metrics.MisdirectedRequestsTotal.WithLabelValues("received").Inc()
+	return &apitypes.NotMasterError{Master: master}
+}
+
+// masterOnly wraps the handler of master-only API with the master check
+func (h *CustomHandler) masterOnly(f func(c *gin.Context) (interface{}, error)) func(c *gin.Context) (
+	interface{}, error) {
+	return func(c *gin.Context) (interface{}, error) {
+		if err := h.checkMaster(); err != nil {
+			logger.WarnContextf(c.Request.Context(), "master-only api '%s' misdirected: %s", c.Request.URL.Path,
+				err.Error())
+			return nil, err
+		}
+		return f(c)
+	}
+}
+
+// registryMapping returns the mapping of original host, the host not mapped is only allowed when
+// MappedHostsOnly is disabled (e.g. containerd mirror of any registry)
+func (h *CustomHandler) registryMapping(originalHost string) (*options.RegistryMapping, error) {
+	if mapping := options.GlobalOptions().FilterRegistryMappingByOriginal(originalHost); mapping != nil {
+		return mapping, nil
+	}
+	if h.op().APIValidation.MappedHostsOnly {
+		return nil, errors.Errorf("original host '%s' is not in registry mappings", originalHost)
+	}
+	return &options.RegistryMapping{Enable: true, ProxyHost: originalHost, OriginalHost: originalHost}, nil
+}
+
+// checkOriginalHost checks the original host of peer request is allowed
+func (h *CustomHandler) checkOriginalHost(originalHost string) error {
+	_, err := h.registryMapping(originalHost)
+	return err
+}
+
+// checkServiceTokenURL checks the token service of peer request is on the allowed hosts of mapping, so
+// that the credentials of registry are not sent to the other hosts
+func (h *CustomHandler) checkServiceTokenURL(originalHost, tokenURL string) error {
+	mapping, err := h.registryMapping(originalHost)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(tokenURL)
+	if err != nil {
+		return errors.Wrapf(err, "parse service token url '%s' failed", tokenURL)
+	}
+	if !mapping.IsTokenURLAllowed(u) {
+		return errors.Errorf("service token url '%s' not allowed for original host '%s'", tokenURL,
+			originalHost)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/server/common"
+)
+
+const (
+	hostViolationSNIMismatch = "sni_mismatch"
+	hostViolationCertUncover = "cert_uncovered"
+	hostViolationClientCIDR  = "client_not_allowed"
+	hostViolationUnknown     = "unknown_host"
+)
+
+// verifyHost checks the proxy host derived from Host header. The Host of DomainProxy request should be
+// the proxy host of registry mapping on both listeners. Over TLS it should also be the server name of
+// handshake, or covered by the served default cert if the client not sent SNI, otherwise the request would
+// read through the cache and credentials of another mapping. The client should be in the allowed networks
+// of the mapping for both proxy types. Returns the status code to reject the request.
+func (s *AccelerboatServer) verifyHost(req *http.Request, proxyHost string, proxyType options.ProxyType) (int,
+	error) {
+	mp := options.GlobalOptions().FilterRegistryMapping(proxyHost, proxyType)
+	if s.op().HostValidation.Enable && proxyType == options.DomainProxy {
+		switch {
+		case mp == nil:
+			return s.hostViolation(req.Context(), proxyHost, hostViolationUnknown, http.StatusMisdirectedRequest,
+				fmt.Sprintf("host '%s' is not the proxy host of any registry mapping", proxyHost))
+		case req.TLS == nil:
+			// the plain http request not have server name to compare
+		case req.TLS.ServerName != "" && !strings.EqualFold(req.TLS.ServerName, proxyHost):
+			return s.hostViolation(req.Context(), proxyHost, hostViolationSNIMismatch, http.StatusMisdirectedRequest,
+				fmt.Sprintf("host '%s' is not the tls server name '%s'", proxyHost, req.TLS.ServerName))
+		case req.TLS.ServerName == "":
+			if cert := s.defaultCert; cert == nil || cert.VerifyHostname(proxyHost) != nil {
+				return s.hostViolation(req.Context(), proxyHost, hostViolationCertUncover,
+					http.StatusMisdirectedRequest, fmt.Sprintf("host '%s' is not covered by the served cert",
+						proxyHost))
+			}
+		}
+	}
+	if mp != nil && len(mp.AllowedClientCIDRs) != 0 {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		if !mp.IsClientAllowed(net.ParseIP(host)) {
+			return s.hostViolation(req.Context(), proxyHost, hostViolationClientCIDR, http.StatusForbidden,
+				fmt.Sprintf("client '%s' is not allowed for proxy host '%s'", host, proxyHost))
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// hostViolation records the rejected request of host validation
+func (s *AccelerboatServer) hostViolation(ctx context.Context, proxyHost, reason string, status int,
+	message string) (int, error) {
+	metrics.HostViolationsTotal.WithLabelValues(reason).Inc()
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeHostViolation,
+		RequestID:   logger.GetContextField(ctx, common.RequestIDHeaderKey),
+		EventStatus: recorder.Warning,
+		Details: map[string]interface{}{
+			"proxyHost": proxyHost, "reason": reason,
+		},
+		Message: message,
+	})
+	return status, errors.New(message)
+}
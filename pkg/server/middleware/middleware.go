@@ -6,31 +6,84 @@ package middleware
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
 	"github.com/penglongli/accelerboat/pkg/logger"
 	"github.com/penglongli/accelerboat/pkg/server/common"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/version"
 )
 
+// isTrustedClient returns whether the client is allowed to pass the request id. Loopback, cluster nodes and
+// the configured trusted CIDRs are trusted.
+func isTrustedClient(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, ep := range leaderselector.Endpoints() {
+		if epHost, _, err := net.SplitHostPort(ep); err == nil && epHost == host {
+			return true
+		}
+	}
+	for _, cidr := range options.GlobalOptions().TrustedRequestIDCIDRs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// completeRequestID accepts the valid request id from X-Request-ID or traceparent of trusted clients,
+// otherwise generates a new W3C trace-id as request id
 func completeRequestID(req *http.Request) (context.Context, string) {
-	requestID := req.Header.Get(common.RequestIDHeaderKey)
+	var requestID string
+	if isTrustedClient(req) {
+		if requestID = req.Header.Get(common.RequestIDHeaderKey); !common.IsValidRequestID(requestID) {
+			requestID = ""
+		}
+		if requestID == "" {
+			requestID, _ = common.ParseTraceparent(req.Header.Get(common.TraceparentHeaderKey))
+		}
+	}
 	if requestID == "" {
-		requestID = uuid.New().String()
+		requestID = common.NewTraceID()
 	}
 	reqCtx := logger.WithContextFields(req.Context(), common.RequestIDHeaderKey, requestID)
 	return reqCtx, requestID
 }
 
+// setRequestIDHeaders echoes the request id to client and overrides the request headers which will be
+// passed to the next hops
+func setRequestIDHeaders(respHeader, reqHeader http.Header, requestID string) {
+	respHeader.Set(common.RequestIDHeaderKey, requestID)
+	reqHeader.Set(common.RequestIDHeaderKey, requestID)
+	reqHeader.Del(common.TraceparentHeaderKey)
+	if traceparent := common.BuildTraceparent(requestID); traceparent != "" {
+		respHeader.Set(common.TraceparentHeaderKey, traceparent)
+		reqHeader.Set(common.TraceparentHeaderKey, traceparent)
+	}
+}
+
 func GinMiddleware() func(ctx *gin.Context) {
 	return func(ctx *gin.Context) {
 		reqCtx, requestID := completeRequestID(ctx.Request)
 		ctx.Request = ctx.Request.WithContext(reqCtx)
-		ctx.Writer.Header().Set(common.RequestIDHeaderKey, requestID)
-		ctx.Request.Header.Set(common.RequestIDHeaderKey, requestID)
+		setRequestIDHeaders(ctx.Writer.Header(), ctx.Request.Header, requestID)
+		ctx.Writer.Header().Set(apitypes.VersionHeader, version.Version)
 		req := ctx.Request
 		if _, ok := apitypes.NotPrintLog[req.RequestURI]; !ok {
 			logger.InfoContextf(reqCtx, "received request: %s, %s%s", req.Method, req.Host, req.URL.String())
@@ -39,11 +92,22 @@ func GinMiddleware() func(ctx *gin.Context) {
 	}
 }
 
+// LimitRequestBody limits the body size of custom api requests, the layer import uploads the layer so it
+// is limited by the declared content-length in handler
+func LimitRequestBody(maxBytes int64) func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		path := ctx.Request.URL.Path
+		if strings.HasPrefix(path, "/customapi/") && path != apitypes.APIImportLayer && ctx.Request.Body != nil {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBytes)
+		}
+		ctx.Next()
+	}
+}
+
 func GeneralMiddleware(rw http.ResponseWriter, req *http.Request) *http.Request {
 	reqCtx, requestID := completeRequestID(req)
 	newReq := req.WithContext(reqCtx)
-	rw.Header().Set(common.RequestIDHeaderKey, requestID)
-	newReq.Header.Set(common.RequestIDHeaderKey, requestID)
+	setRequestIDHeaders(rw.Header(), newReq.Header, requestID)
 	logger.InfoContextf(reqCtx, "received request: %s, %s%s", req.Method, req.Host, req.URL.String())
 	return newReq
 }
@@ -0,0 +1,52 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/penglongli/accelerboat/pkg/server/common"
+)
+
+func TestCompleteRequestID(t *testing.T) {
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name        string
+		requestID   string
+		traceparent string
+		want        string
+	}{
+		{name: "valid request id", requestID: "req-1", want: "req-1"},
+		{name: "request id before traceparent", requestID: "req-1",
+			traceparent: "00-" + traceID + "-00f067aa0ba902b7-01", want: "req-1"},
+		{name: "invalid request id falls back to traceparent", requestID: "req 1\r\nX-Injected: 1",
+			traceparent: "00-" + traceID + "-00f067aa0ba902b7-01", want: traceID},
+		{name: "traceparent", traceparent: "00-" + traceID + "-00f067aa0ba902b7-01", want: traceID},
+		{name: "invalid request id is regenerated", requestID: "<script>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/customapi/version", nil)
+			req.RemoteAddr = "127.0.0.1:12345"
+			if tt.requestID != "" {
+				req.Header.Set(common.RequestIDHeaderKey, tt.requestID)
+			}
+			if tt.traceparent != "" {
+				req.Header.Set(common.TraceparentHeaderKey, tt.traceparent)
+			}
+			_, got := completeRequestID(req)
+			if tt.want == "" {
+				if !common.IsTraceID(got) {
+					t.Errorf("completeRequestID() = %s, want generated trace id", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("completeRequestID() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"runtime/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/server/common"
+)
+
+// GinRecovery recovers the panic of handlers and responds 500 with json error. The panic is recorded
+// as event with the hash of stack, so the same panic can be grouped.
+func GinRecovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			ctx := c.Request.Context()
+			route := c.FullPath()
+			if route == "" {
+				route = c.Request.URL.Path
+			}
+			stack := debug.Stack()
+			stackHash := hashStack(stack)
+			logger.ErrorContextf(ctx, "handle request '%s' panic(%s): %v\n%s", route, stackHash, r, string(stack))
+			metrics.PanicsTotal.WithLabelValues(route).Inc()
+			metrics.RecordError(metrics.ComponentHTTPServer, "panic")
+			details := map[string]interface{}{
+				"route":     route,
+				"method":    c.Request.Method,
+				"stackHash": stackHash,
+			}
+			if dumpFile := dumpGoroutines(stackHash); dumpFile != "" {
+				details["dumpFile"] = dumpFile
+			}
+			recorder.Global.Record(ctx, recorder.Event{
+				Type:        recorder.EventTypePanic,
+				RequestID:   logger.GetContextField(ctx, common.RequestIDHeaderKey),
+				EventStatus: recorder.Warning,
+				Details:     details,
+				Message:     fmt.Sprintf("Handle request panic: %v", r),
+			})
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":     "internal server error",
+				"stackHash": stackHash,
+			})
+		}()
+		c.Next()
+	}
+}
+
+var (
+	// stackArgsRegexp matches the argument values of function line, e.g. 'main.handle(0xc000123450, 0x1)'
+	stackArgsRegexp = regexp.MustCompile(`\([^()]*\)$`)
+	// stackOffsetRegexp matches the pc offset of file line, e.g. '/src/main.go:10 +0x25'
+	stackOffsetRegexp = regexp.MustCompile(` \+0x[0-9a-f]+$`)
+	// stackGoroutineRegexp matches the goroutine id of creator line, e.g. 'created by main.run in goroutine 7'
+	stackGoroutineRegexp = regexp.MustCompile(` in goroutine \d+$`)
+)
+
+// hashStack returns the short hash of stack. The first line with goroutine id, the argument values and
+// pc offsets are ignored, so the same panic always has the same hash.
+func hashStack(stack []byte) string {
+	if idx := bytes.IndexByte(stack, '\n'); idx >= 0 {
+		stack = stack[idx+1:]
+	}
+	lines := bytes.Split(stack, []byte("\n"))
+	for i := range lines {
+		line := bytes.TrimRight(lines[i], " ")
+		line = stackArgsRegexp.ReplaceAll(line, []byte("()"))
+		line = stackOffsetRegexp.ReplaceAll(line, nil)
+		lines[i] = stackGoroutineRegexp.ReplaceAll(line, nil)
+	}
+	sum := sha256.Sum256(bytes.Join(lines, []byte("\n")))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+const (
+	// dumpInterval the goroutines are dumped once in the interval for the panics of same stack
+	dumpInterval = 10 * time.Minute
+	// maxDumpSize the dump file is truncated beyond the size
+	maxDumpSize = 32 * 1024 * 1024
+)
+
+// dumpedStacks the hashes of stack whose goroutines are dumped in the interval
+var dumpedStacks = cache.New(dumpInterval, 2*dumpInterval)
+
+// limitedWriter writes at most n bytes, the bytes beyond are discarded
+type limitedWriter struct {
+	f *os.File
+	n int64
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		return len(p), nil
+	}
+	bs := p
+	if int64(len(bs)) > w.n {
+		bs = bs[:w.n]
+	}
+	n, err := w.f.Write(bs)
+	w.n -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	return len(p), nil
+}
+
+// dumpGoroutines dumps the traces of all goroutines into log directory if enabled, returns the dump file.
+// The panics of same stack are dumped once in the interval, and the dump file is truncated to the max size
+// so the repeated panics cannot fill the log directory.
+func dumpGoroutines(stackHash string) string {
+	logConfig := options.GlobalOptions().LogConfig
+	if !logConfig.DumpGoroutineOnPanic {
+		return ""
+	}
+	if err := dumpedStacks.Add(stackHash, struct{}{}, cache.DefaultExpiration); err != nil {
+		return ""
+	}
+	dumpFile := filepath.Join(logConfig.LogDir, fmt.Sprintf("goroutine-%s-%s.dump",
+		time.Now().Format("20060102150405.000"), stackHash))
+	f, err := os.Create(dumpFile)
+	if err != nil {
+		logger.Errorf("create goroutine dump file '%s' failed: %s", dumpFile, err.Error())
+		return ""
+	}
+	defer f.Close()
+	if err = pprof.Lookup("goroutine").WriteTo(&limitedWriter{f: f, n: maxDumpSize}, 2); err != nil {
+		logger.Errorf("dump goroutines to '%s' failed: %s", dumpFile, err.Error())
+		return ""
+	}
+	return dumpFile
+}
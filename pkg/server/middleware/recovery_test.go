@@ -0,0 +1,32 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLimitedWriter(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "dump"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := &limitedWriter{f: f, n: 5}
+	for _, s := range []string{"abc", "defg", "hij"} {
+		if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("Write(%s) = %d, %v", s, n, err)
+		}
+	}
+	bs, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != "abcde" {
+		t.Errorf("written = %s, want abcde", string(bs))
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"encoding/json"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+)
+
+const (
+	// artifactBlobExpiration the expiration of small artifact blobs which parsed from manifest
+	artifactBlobExpiration = 10 * time.Minute
+
+	dockerImageConfigMediaType = "application/vnd.docker.container.image.v1+json"
+)
+
+// artifactManifest wraps the manifest to parse the artifact info, the manifest is empty if parse failed
+type artifactManifest struct {
+	ocispec.Manifest
+}
+
+func parseManifest(manifest string) *artifactManifest {
+	m := &artifactManifest{}
+	_ = json.Unmarshal([]byte(manifest), &m.Manifest)
+	return m
+}
+
+// artifactType returns the artifact type of manifest, returns empty if it is container image
+func (m *artifactManifest) artifactType() string {
+	if m.ArtifactType != "" {
+		return m.ArtifactType
+	}
+	switch m.Config.MediaType {
+	case "", ocispec.MediaTypeImageConfig, dockerImageConfigMediaType:
+		return ""
+	default:
+		return m.Config.MediaType
+	}
+}
+
+// recordArtifactBlobs records the blobs of artifact which smaller than bypass threshold, they are
+// reversed to the original registry directly because the peer distribution costs more than transfer.
+func (p *upstreamProxy) recordArtifactBlobs(m *artifactManifest) {
+	threshold := p.op().ArtifactConfig.BypassThreshold * options.MB
+	if threshold <= 0 || m.artifactType() == "" {
+		return
+	}
+	descriptors := append([]ocispec.Descriptor{m.Config}, m.Layers...)
+	for _, desc := range descriptors {
+		if desc.Digest == "" || desc.Size >= threshold {
+			continue
+		}
+		p.artifactBlobs.SetDefault(desc.Digest.String(), struct{}{})
+	}
+}
+
+func (p *upstreamProxy) isBypassArtifactBlob(digest string) bool {
+	if p.op().ArtifactConfig.BypassThreshold <= 0 {
+		return false
+	}
+	_, ok := p.artifactBlobs.Get(digest)
+	return ok
+}
@@ -0,0 +1,43 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+// rewriteAuthenticate rewrites the realm of WWW-Authenticate to the token service of proxy, the client
+// requests the token through the same listener which received the request
+func (p *upstreamProxy) rewriteAuthenticate(ctx context.Context, header http.Header) {
+	clientAddr, _ := ctx.Value(clientAddrKey{}).(string)
+	utils.RewriteAuthenticateHeader(header, p.authRealmAddr(clientAddr), p.authRealmNamespace())
+}
+
+// authRealmAddr returns the scheme and host of the rewritten realm. The AuthRealmAddr of registry mapping
+// takes precedence, then the address client requested (plain http for the mirror port without TLS). The
+// https port of proxy host is used if the client address is unknown.
+func (p *upstreamProxy) authRealmAddr(clientAddr string) string {
+	if mp := p.op().FilterRegistryMapping(p.proxyHost, p.proxyType); mp != nil && mp.AuthRealmAddr != "" {
+		return strings.TrimSuffix(mp.AuthRealmAddr, "/")
+	}
+	if clientAddr != "" {
+		return clientAddr
+	}
+	return fmt.Sprintf("https://%s:%d", p.proxyRegistry.ProxyHost, p.op().HTTPSPort)
+}
+
+// authRealmNamespace returns the 'ns' query of realm, the requests of RegistryMirror mode are routed by it
+func (p *upstreamProxy) authRealmNamespace() string {
+	if p.proxyType == options.RegistryMirror {
+		return p.proxyHost
+	}
+	return ""
+}
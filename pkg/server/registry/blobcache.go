@@ -0,0 +1,120 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/accesslog"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+// blobMemoryCache is the size-bounded LRU of small blobs keyed by digest, it is shared by all the proxies
+// because the blobs are content addressed
+type blobMemoryCache struct {
+	sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type blobMemoryEntry struct {
+	digest  string
+	data    []byte
+	modTime time.Time
+}
+
+var globalBlobMemoryCache = &blobMemoryCache{
+	entries: make(map[string]*list.Element),
+	lru:     list.New(),
+}
+
+// get returns the blob of digest and moves it to the front
+func (c *blobMemoryCache) get(digest string) *blobMemoryEntry {
+	c.Lock()
+	defer c.Unlock()
+	elem, ok := c.entries[digest]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*blobMemoryEntry)
+}
+
+// add keeps the blob and evicts the least recently used blobs until the total size within maxSize
+func (c *blobMemoryCache) add(entry *blobMemoryEntry, maxSize int64) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.entries[entry.digest]; ok {
+		return
+	}
+	c.entries[entry.digest] = c.lru.PushFront(entry)
+	c.size += int64(len(entry.data))
+	for c.size > maxSize && c.lru.Len() > 0 {
+		oldest := c.lru.Back()
+		evicted := c.lru.Remove(oldest).(*blobMemoryEntry)
+		delete(c.entries, evicted.digest)
+		c.size -= int64(len(evicted.data))
+	}
+	metrics.BlobMemoryCacheBytes.Set(float64(c.size))
+}
+
+// serveBlobFromMemory serves the blob from the in-memory cache, returns false if not cached
+func (p *upstreamProxy) serveBlobFromMemory(ctx context.Context, req *http.Request, rw http.ResponseWriter,
+	digest string) bool {
+	if !p.op().BlobMemoryCache.Enable {
+		return false
+	}
+	entry := globalBlobMemoryCache.get(digest)
+	if entry == nil {
+		metrics.BlobMemoryCacheRequestsTotal.WithLabelValues("miss").Inc()
+		return false
+	}
+	metrics.BlobMemoryCacheRequestsTotal.WithLabelValues("hit").Inc()
+	accesslog.SetCacheOutcome(ctx, accesslog.CacheMemory)
+	// the content type is set to avoid sniffing, and the Range requests are served by ServeContent
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(rw, req, "", entry.modTime, bytes.NewReader(entry.data))
+	logger.V(3).InfoContextf(ctx, "serve blob from memory, size: %d", len(entry.data))
+	return true
+}
+
+// cacheBlobInMemory keeps the local blob in memory if it is small enough, the blob is verified with the
+// digest before kept because it is served without the local file anymore
+func (p *upstreamProxy) cacheBlobInMemory(ctx context.Context, digest, layerPath string, fi os.FileInfo) {
+	conf := p.op().BlobMemoryCache
+	if !conf.Enable || fi.Size() > conf.MaxBlobSize*1024 {
+		return
+	}
+	if globalBlobMemoryCache.get(digest) != nil {
+		return
+	}
+	data, err := os.ReadFile(layerPath)
+	if err != nil {
+		logger.WarnContextf(ctx, "read blob '%s' into memory failed: %s", layerPath, err.Error())
+		return
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != strings.TrimPrefix(digest, "sha256:") {
+		logger.WarnContextf(ctx, "blob '%s' not matches the digest, not cached in memory", layerPath)
+		return
+	}
+	globalBlobMemoryCache.add(&blobMemoryEntry{
+		digest:  digest,
+		data:    data,
+		modTime: fi.ModTime(),
+	}, conf.MaxSize*options.MB)
+}
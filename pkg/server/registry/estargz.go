@@ -0,0 +1,152 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/accesslog"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+// authorizedExpiration the expiration of the origin references authorized for the credential of client
+const authorizedExpiration = time.Minute
+
+// authorizeOrigin checks the client is authorized for the reference(e.g. 'blobs/sha256:...') of repo by
+// requesting HEAD of it on the original registry with the headers of client, the content derived from
+// the origin is served only if authorized. The result is cached by the credential of client.
+func (p *upstreamProxy) authorizeOrigin(ctx context.Context, req *http.Request, reference string) error {
+	if reference == "" {
+		return errors.Errorf("source reference is unknown")
+	}
+	credential := sha256.Sum256([]byte(req.Header.Get("Authorization")))
+	cacheKey := hex.EncodeToString(credential[:]) + "," + req.URL.Host + "," + reference
+	if _, ok := p.authorized.Get(cacheKey); ok {
+		return nil
+	}
+	u := *req.URL
+	for _, kind := range []string{"/blobs/", "/manifests/"} {
+		if i := strings.LastIndex(u.Path, kind); i >= 0 {
+			u.Path = u.Path[:i]
+			break
+		}
+	}
+	u.Path = u.Path + "/" + reference
+	u.RawPath = ""
+	u.RawQuery = ""
+	headReq, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "create http.request failed")
+	}
+	headReq.Header = req.Header.Clone()
+	headReq.Header.Del("Range")
+	resp, err := (&http.Client{Transport: p.reverseProxy.Transport}).Do(headReq)
+	if err != nil {
+		return errors.Wrapf(err, "request origin '%s' failed", u.Host)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("origin responds '%d' for '%s'", resp.StatusCode, reference)
+	}
+	p.authorized.Set(cacheKey, struct{}{}, cache.DefaultExpiration)
+	return nil
+}
+
+// parseSingleRange parses the 'bytes=a-b' or 'bytes=a-' range header of layer with size, the multiple
+// ranges and suffix ranges are not supported
+func parseSingleRange(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok || startStr == "" {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// serveEstargzRange serves the range request of eStargz layer with the range of the node holding it, the
+// lazy-pulling snapshotters fetch the TOC and files of layer with ranges and not need the whole layer
+// cached on this node. Returns false if the request is not served, then it is handled as normal.
+func (p *upstreamProxy) serveEstargzRange(ctx context.Context, req *http.Request, rw http.ResponseWriter,
+	digest string) (bool, error) {
+	op := p.op()
+	rangeHeader := req.Header.Get("Range")
+	if !op.Estargz.Enable || rangeHeader == "" {
+		return false, nil
+	}
+	layer, err := p.cacheStore.GetEstargzLayer(ctx, digest)
+	if err != nil {
+		logger.WarnContextf(ctx, "query estargz layer failed: %s", err.Error())
+		return false, nil
+	}
+	if layer == nil || layer.Converted != digest {
+		return false, nil
+	}
+	// the converted layer is not in origin, the client is authorized with the original layer
+	if err = p.authorizeOrigin(ctx, req, "blobs/sha256:"+layer.Digest); err != nil {
+		logger.WarnContextf(ctx, "estargz layer '%s' not authorized: %s", digest, err.Error())
+		return false, nil
+	}
+	start, end, ok := parseSingleRange(rangeHeader, layer.Size)
+	if !ok {
+		return false, nil
+	}
+	staticLayers, _, err := p.cacheStore.QueryLayers(ctx, digest)
+	if err != nil {
+		logger.WarnContextf(ctx, "query located of estargz layer failed: %s", err.Error())
+		return false, nil
+	}
+	for _, sl := range staticLayers {
+		if sl.Located == op.Address || sl.Data == "" {
+			continue
+		}
+		body, err := p.layerRangeFetcher(sl.Located, sl.Data)(ctx, start, end-start+1)
+		if err != nil {
+			logger.WarnContextf(ctx, "fetch estargz range from '%s' failed: %s", sl.Located, err.Error())
+			continue
+		}
+		rw.Header().Set("Content-Type", "application/octet-stream")
+		rw.Header().Set("Docker-Content-Digest", "sha256:"+digest)
+		rw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, layer.Size))
+		rw.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		rw.WriteHeader(http.StatusPartialContent)
+		n, err := io.Copy(rw, body)
+		_ = body.Close()
+		metrics.BlobRangeProxiedBytes.Add(float64(n))
+		accesslog.SetCacheOutcome(ctx, accesslog.CacheCluster)
+		if err != nil {
+			return true, errors.Wrapf(errResponseStarted, "copy estargz range from '%s' failed: %s",
+				sl.Located, err.Error())
+		}
+		logger.InfoContextf(ctx, "served estargz range %d-%d from '%s'", start, end, sl.Located)
+		return true, nil
+	}
+	return false, nil
+}
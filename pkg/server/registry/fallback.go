@@ -0,0 +1,101 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/accesslog"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+)
+
+const (
+	fallbackDecisionReverse  = "reverse"
+	fallbackDecisionRejected = "rejected"
+)
+
+// fallbackBudget counts the fallbacks of one registry and category in the current minute
+type fallbackBudget struct {
+	sync.Mutex
+	windowStart time.Time
+	count       int
+}
+
+// take returns whether the fallback is within the budget of current minute
+func (b *fallbackBudget) take(limit int) bool {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	if now.Sub(b.windowStart) >= time.Minute {
+		b.windowStart = now
+		b.count = 0
+	}
+	if b.count >= limit {
+		return false
+	}
+	b.count++
+	return true
+}
+
+// fallbackBudgets the budgets with registry and category as key, they are shared by the proxies of the same
+// registry
+var fallbackBudgets = &sync.Map{}
+
+func (p *upstreamProxy) fallbackBudget(category string) *fallbackBudget {
+	v, _ := fallbackBudgets.LoadOrStore(p.originalHost+"/"+category, &fallbackBudget{})
+	return v.(*fallbackBudget)
+}
+
+// allowFallback decides whether the failed request of category falls back to reverse proxy with the
+// fallback policy, the decision is counted and recorded with the reason
+func (p *upstreamProxy) allowFallback(ctx context.Context, category string, err error) bool {
+	rule := p.op().Fallback.RuleOf(category)
+	var allowed bool
+	var reason string
+	switch rule.Mode {
+	case options.FallbackNever:
+		reason = "fallback is disabled"
+	case options.FallbackBudgeted:
+		allowed = p.fallbackBudget(category).take(rule.Budget)
+		if allowed {
+			reason = fmt.Sprintf("within budget %d/min", rule.Budget)
+		} else {
+			reason = fmt.Sprintf("budget %d/min exhausted", rule.Budget)
+		}
+	default:
+		allowed = true
+		reason = "fallback always"
+	}
+	decision := fallbackDecisionReverse
+	if !allowed {
+		decision = fallbackDecisionRejected
+	}
+	metrics.FallbackDecisionsTotal.WithLabelValues(p.originalHost, category, decision).Inc()
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeFallback,
+		EventStatus: recorder.Warning,
+		Details: map[string]interface{}{
+			"registry": p.originalHost, "category": category, "mode": rule.Mode, "decision": decision,
+			"reason": reason, "error": err.Error(),
+		},
+		Message: fmt.Sprintf("Failed %s request %s: %s", category, decision, reason),
+	})
+	return allowed
+}
+
+// respondFallbackRejected responds 502 to client for the failed request not falling back
+func (p *upstreamProxy) respondFallbackRejected(ctx context.Context, rw http.ResponseWriter, category string,
+	err error) {
+	accesslog.SetCacheOutcome(ctx, accesslog.CacheRejected)
+	logger.ErrorContextf(ctx, "%s request failed and fallback rejected: %s", category, err.Error())
+	http.Error(rw, err.Error(), http.StatusBadGateway)
+}
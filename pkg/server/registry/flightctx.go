@@ -0,0 +1,75 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"sync"
+)
+
+// flightContexts holds the cancellation of the coalesced layer fetching. The fetching is canceled only
+// when all the requests waiting for it are done (e.g. the clients disconnected), the disconnect of the
+// first client does not break the other waiters.
+type flightContexts struct {
+	sync.Mutex
+	flights map[string]*flightContext
+}
+
+type flightContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	refs   int
+}
+
+func newFlightContexts() *flightContexts {
+	return &flightContexts{flights: make(map[string]*flightContext)}
+}
+
+// join returns the context which is done when all the requests of key are done, the returned func should
+// be called after the request finished waiting
+func (fc *flightContexts) join(ctx context.Context, key string) (context.Context, func()) {
+	fc.Lock()
+	f, ok := fc.flights[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.Background())
+		f = &flightContext{ctx: flightCtx, cancel: cancel}
+		fc.flights[key] = f
+	}
+	f.refs++
+	fc.Unlock()
+
+	var once sync.Once
+	leave := func() {
+		once.Do(func() { fc.leave(key, f) })
+	}
+	stop := context.AfterFunc(ctx, leave)
+	return f.ctx, func() {
+		stop()
+		leave()
+	}
+}
+
+func (fc *flightContexts) leave(key string, f *flightContext) {
+	fc.Lock()
+	defer fc.Unlock()
+	f.refs--
+	if f.refs > 0 {
+		return
+	}
+	f.cancel()
+	if fc.flights[key] == f {
+		delete(fc.flights, key)
+	}
+}
+
+// fetchContext returns the context with the values of request, it is canceled when the flight is done
+func fetchContext(ctx, flightCtx context.Context) (context.Context, context.CancelFunc) {
+	fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(flightCtx, cancel)
+	return fetchCtx, func() {
+		stop()
+		cancel()
+	}
+}
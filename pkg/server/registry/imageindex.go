@@ -0,0 +1,45 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	// imageSeenInterval the same image is recorded into cache store at most once within the interval, the
+	// manifests are requested repeatedly by the pulls of every node
+	imageSeenInterval = time.Minute
+	imageSeenTimeout  = 5 * time.Second
+)
+
+var recentImagesSeen = cache.New(imageSeenInterval, time.Minute)
+
+// recordImageSeen records the image into the index of cache store without blocking the request
+func (p *upstreamProxy) recordImageSeen(ctx context.Context, repo, tag string) {
+	conf := p.op().ImageIndex
+	if !conf.Enable {
+		return
+	}
+	key := fmt.Sprintf("%s,%s,%s", p.originalHost, repo, tag)
+	if err := recentImagesSeen.Add(key, struct{}{}, imageSeenInterval); err != nil {
+		return
+	}
+	retention := time.Duration(conf.Retention) * 24 * time.Hour
+	go func() {
+		saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), imageSeenTimeout)
+		defer cancel()
+		if err := p.cacheStore.SaveImageSeen(saveCtx, p.originalHost, repo, tag, retention); err != nil {
+			logger.WarnContextf(saveCtx, "record image seen '%s' failed: %s", key, err.Error())
+			recentImagesSeen.Delete(key)
+		}
+	}()
+}
@@ -0,0 +1,265 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/accesslog"
+	"github.com/penglongli/accelerboat/pkg/estargz"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/requester"
+)
+
+// maxImageConfigSize the max size of image config read to generate the lazy-pulling manifest
+const maxImageConfigSize = 16 * 1024 * 1024
+
+// lazyPullTag returns the original tag of the lazy-pulling tag which ends with the tag suffix
+func (p *upstreamProxy) lazyPullTag(tag string) (string, bool) {
+	conf := p.op().Estargz
+	if !conf.Enable {
+		return "", false
+	}
+	original, ok := strings.CutSuffix(tag, conf.TagSuffix)
+	return original, ok && original != ""
+}
+
+// serveEstargzManifest serves the manifest of lazy-pulling tag or the manifest generated for it by digest,
+// returns false if the reference is neither of them
+func (p *upstreamProxy) serveEstargzManifest(ctx context.Context, req *http.Request, rw http.ResponseWriter,
+	repo, reference string) (bool, error) {
+	if !p.op().Estargz.Enable {
+		return false, nil
+	}
+	var manifest []byte
+	var mediaType string
+	if original, ok := p.lazyPullTag(reference); ok {
+		var err error
+		if manifest, mediaType, err = p.lazyPullManifest(ctx, req, repo, original); err != nil {
+			metrics.EstargzManifestsTotal.WithLabelValues("failed").Inc()
+			return true, errors.Wrapf(err, "generate lazy-pulling manifest of '%s' failed", original)
+		}
+	} else if dgst, err := digest.Parse(reference); err == nil {
+		var source string
+		if manifest, source, err = p.cacheStore.GetEstargzBlob(ctx, dgst.Encoded()); err != nil || manifest == nil {
+			return false, nil
+		}
+		if err = p.authorizeOrigin(ctx, req, source); err != nil {
+			logger.WarnContextf(ctx, "generated manifest '%s' not authorized: %s", reference, err.Error())
+			return false, nil
+		}
+		mediaType = parseManifest(string(manifest)).MediaType
+	} else {
+		return false, nil
+	}
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	rw.Header().Set("Content-Type", mediaType)
+	rw.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+	rw.Header().Set("Content-Length", strconv.Itoa(len(manifest)))
+	rw.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		_, _ = rw.Write(manifest)
+	}
+	accesslog.SetCacheOutcome(ctx, accesslog.CacheMaster)
+	return true, nil
+}
+
+// lazyPullManifest generates the manifest of original tag referencing the eStargz layers, the manifests of
+// index are generated one by one. The original manifest is returned if no layer converted, the snapshotter
+// pulls it as normal.
+func (p *upstreamProxy) lazyPullManifest(ctx context.Context, req *http.Request, repo, tag string) ([]byte,
+	string, error) {
+	raw, err := p.fetchManifest(ctx, req, repo, tag)
+	if err != nil {
+		return nil, "", err
+	}
+	m := parseManifest(string(raw))
+	if m.MediaType != ocispec.MediaTypeImageIndex && m.MediaType != images.MediaTypeDockerSchema2ManifestList {
+		converted, err := p.convertImageManifest(ctx, req, repo, raw)
+		if err != nil {
+			return nil, "", err
+		}
+		if converted == nil {
+			metrics.EstargzManifestsTotal.WithLabelValues("unconverted").Inc()
+			return raw, m.MediaType, nil
+		}
+		metrics.EstargzManifestsTotal.WithLabelValues("converted").Inc()
+		return converted.Manifest, converted.MediaType, nil
+	}
+
+	index := &ocispec.Index{}
+	if err = json.Unmarshal(raw, index); err != nil {
+		return nil, "", errors.Wrapf(err, "unmarshal index failed")
+	}
+	var converted int
+	for i := range index.Manifests {
+		desc := &index.Manifests[i]
+		child, err := p.fetchManifest(ctx, req, repo, desc.Digest.String())
+		if err != nil {
+			return nil, "", err
+		}
+		result, err := p.convertImageManifest(ctx, req, repo, child)
+		if err != nil {
+			logger.WarnContextf(ctx, "convert manifest '%s' of index failed: %s", desc.Digest, err.Error())
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		converted++
+		desc.Digest = digest.FromBytes(result.Manifest)
+		desc.Size = int64(len(result.Manifest))
+		desc.MediaType = result.MediaType
+	}
+	if converted == 0 {
+		metrics.EstargzManifestsTotal.WithLabelValues("unconverted").Inc()
+		return raw, index.MediaType, nil
+	}
+	bs, err := json.Marshal(index)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "marshal index failed")
+	}
+	if err = p.cacheStore.SaveEstargzBlob(ctx, digest.FromBytes(bs).Encoded(),
+		"manifests/"+digest.FromBytes(raw).String(), bs); err != nil {
+		return nil, "", err
+	}
+	metrics.EstargzManifestsTotal.WithLabelValues("converted").Inc()
+	logger.InfoContextf(ctx, "generated lazy-pulling index of '%s' with %d manifests converted", tag, converted)
+	return bs, index.MediaType, nil
+}
+
+// convertImageManifest converts the image manifest with its config, the generated manifest and config are
+// saved into cache store. Returns nil if no layer converted.
+func (p *upstreamProxy) convertImageManifest(ctx context.Context, req *http.Request, repo string,
+	raw []byte) (*estargz.ConvertedManifest, error) {
+	m := parseManifest(string(raw))
+	if m.Config.Digest == "" || m.artifactType() != "" {
+		return nil, nil
+	}
+	config, err := p.fetchImageConfig(ctx, req, repo, m.Config)
+	if err != nil {
+		return nil, err
+	}
+	result, err := estargz.ConvertManifest(ctx, p.cacheStore, raw, config)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	if err = p.cacheStore.SaveEstargzBlob(ctx, digest.FromBytes(result.Config).Encoded(),
+		"blobs/"+m.Config.Digest.String(), result.Config); err != nil {
+		return nil, err
+	}
+	if err = p.cacheStore.SaveEstargzBlob(ctx, digest.FromBytes(result.Manifest).Encoded(),
+		"manifests/"+digest.FromBytes(raw).String(), result.Manifest); err != nil {
+		return nil, err
+	}
+	logger.InfoContextf(ctx, "generated lazy-pulling manifest with %d layers converted", result.Layers)
+	return result, nil
+}
+
+// registryPathURI returns the uri of the manifest or blob in repo, it is built from the manifest uri of
+// request
+func (p *upstreamProxy) registryPathURI(req *http.Request, kind, reference string) string {
+	uri := p.registryURI(req)
+	if i := strings.Index(uri, "?"); i >= 0 {
+		uri = uri[:i]
+	}
+	if i := strings.LastIndex(uri, "/manifests/"); i >= 0 {
+		uri = uri[:i]
+	}
+	return uri + "/" + kind + "/" + reference
+}
+
+// fetchManifest gets the manifest of reference from master
+func (p *upstreamProxy) fetchManifest(ctx context.Context, req *http.Request, repo, reference string) ([]byte,
+	error) {
+	_, manifest, err := requester.GetManifest(ctx, &apitypes.GetManifestRequest{
+		OriginalHost: p.originalHost,
+		ManifestUrl:  p.registryPathURI(req, "manifests", reference),
+		Headers:      req.Header,
+		Repo:         repo,
+		Tag:          reference,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get manifest '%s' failed", reference)
+	}
+	return []byte(manifest), nil
+}
+
+// fetchImageConfig reads the image config from local, or from the node holding it which master located
+func (p *upstreamProxy) fetchImageConfig(ctx context.Context, req *http.Request, repo string,
+	desc ocispec.Descriptor) ([]byte, error) {
+	if desc.Size > maxImageConfigSize {
+		return nil, errors.Errorf("image config '%s' too large: %d", desc.Digest, desc.Size)
+	}
+	configDigest := desc.Digest.Encoded()
+	if lfi, lp := p.checkLocalLayer(configDigest); lfi != nil {
+		return os.ReadFile(lp)
+	}
+	resp, master, err := p.recorderWrapGetBlobFromMaster(ctx, &apitypes.DownloadLayerRequest{
+		OriginalHost: p.originalHost,
+		LayerUrl:     p.registryPathURI(req, "blobs", desc.Digest.String()),
+		Headers:      req.Header,
+		Repo:         repo,
+		Digest:       configDigest,
+	}, configDigest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get image config from master failed, master=%s", master)
+	}
+	if resp.Located == p.op().Address {
+		return os.ReadFile(resp.FilePath)
+	}
+	body, err := p.layerRangeFetcher(resp.Located, resp.FilePath)(ctx, 0, desc.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	bs, err := io.ReadAll(io.LimitReader(body, maxImageConfigSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read image config from '%s' failed", resp.Located)
+	}
+	if digest.FromBytes(bs) != desc.Digest {
+		return nil, errors.Errorf("image config from '%s' digest not match", resp.Located)
+	}
+	return bs, nil
+}
+
+// serveEstargzBlob serves the image config generated for the lazy-pulling manifest from cache store,
+// returns false if the blob is not generated or the client is not authorized for its source
+func (p *upstreamProxy) serveEstargzBlob(ctx context.Context, req *http.Request, rw http.ResponseWriter,
+	digest string) bool {
+	if !p.op().Estargz.Enable {
+		return false
+	}
+	bs, source, err := p.cacheStore.GetEstargzBlob(ctx, digest)
+	if err != nil || bs == nil {
+		return false
+	}
+	if err = p.authorizeOrigin(ctx, req, source); err != nil {
+		logger.WarnContextf(ctx, "generated blob '%s' not authorized: %s", digest, err.Error())
+		return false
+	}
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Docker-Content-Digest", "sha256:"+digest)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(bs)))
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bs)
+	accesslog.SetCacheOutcome(ctx, accesslog.CacheMaster)
+	return true
+}
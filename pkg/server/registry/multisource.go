@@ -0,0 +1,183 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/bittorrent"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
+	"github.com/penglongli/accelerboat/pkg/utils/formatutils"
+)
+
+// layerSource the node holding the layer file
+type layerSource struct {
+	located  string
+	filePath string
+}
+
+// layerChunk the range of layer fetched from one source
+type layerChunk struct {
+	offset int64
+	length int64
+}
+
+// useMultiSource returns whether the layer is fetched from multiple sources, the layer should be mid-size
+// and cached on more than one node
+func (p *upstreamProxy) useMultiSource(ctx context.Context, resp *apitypes.DownloadLayerResponse,
+	digest string) bool {
+	ms := p.op().TransferConfig.MultiSource
+	if !ms.Enable || resp.FileSize < ms.MinSize*options.MB || resp.FileSize > ms.MaxSize*options.MB {
+		return false
+	}
+	return p.countSeeders(ctx, digest) >= 2
+}
+
+// layerSources returns the nodes holding the layer, the node located by master is the first. The other
+// nodes are queried from cache store, at most MaxSources are returned.
+func (p *upstreamProxy) layerSources(ctx context.Context, resp *apitypes.DownloadLayerResponse,
+	digest string) []layerSource {
+	maxSources := p.op().TransferConfig.MultiSource.MaxSources
+	result := []layerSource{{located: resp.Located, filePath: resp.FilePath}}
+	seen := map[string]struct{}{resp.Located: {}, p.op().Address: {}}
+	staticLayers, ociLayers, err := p.cacheStore.QueryLayers(ctx, digest)
+	if err != nil {
+		logger.WarnContextf(ctx, "query layer sources failed: %s", err.Error())
+		return result
+	}
+	for _, layer := range append(staticLayers, ociLayers...) {
+		if len(result) >= maxSources {
+			break
+		}
+		if _, ok := seen[layer.Located]; ok || layer.Data == "" {
+			continue
+		}
+		seen[layer.Located] = struct{}{}
+		result = append(result, layerSource{located: layer.Located, filePath: layer.Data})
+	}
+	return result
+}
+
+// downloadByMultiSource splits the layer into chunks and fetches them from the sources in parallel with
+// tcp range requests, each source fetches the next pending chunk after it completed one. The chunk of
+// failed source is fetched by the other sources, and the failed source is not used anymore. The layer is
+// verified with digest after all chunks are fetched.
+func (p *upstreamProxy) downloadByMultiSource(ctx context.Context, resp *apitypes.DownloadLayerResponse,
+	digest string, written *atomic.Int64) error {
+	sources := p.layerSources(ctx, resp, digest)
+	if len(sources) < 2 {
+		return errors.Errorf("layer only have %d sources", len(sources))
+	}
+	partFile := path.Join(p.op().StorageConfig.DownloadPath, utils.LayerFileName(digest)+".multi")
+	_ = os.RemoveAll(partFile)
+	out, err := os.OpenFile(partFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, p.op().StorageConfig.FilePerm())
+	if err != nil {
+		return errors.Wrapf(err, "create file %s failed", partFile)
+	}
+	defer out.Close()
+	if err = out.Truncate(resp.FileSize); err != nil {
+		_ = os.Remove(partFile)
+		return errors.Wrapf(err, "truncate file %s failed", partFile)
+	}
+
+	chunkSize := p.op().TransferConfig.MultiSource.ChunkSize * options.MB
+	chunkNum := (resp.FileSize + chunkSize - 1) / chunkSize
+	chunks := make(chan layerChunk, chunkNum)
+	for offset := int64(0); offset < resp.FileSize; offset += chunkSize {
+		chunks <- layerChunk{offset: offset, length: min(chunkSize, resp.FileSize-offset)}
+	}
+	logger.InfoContextf(ctx, "download layer from %d sources starting, chunks: %d, size: %s", len(sources),
+		chunkNum, formatutils.FormatSize(resp.FileSize))
+	start := time.Now()
+	var remaining atomic.Int64
+	remaining.Store(chunkNum)
+	done := make(chan struct{})
+	var closeOnce sync.Once
+	var errLock sync.Mutex
+	errs := make([]string, 0, len(sources))
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source layerSource) {
+			defer wg.Done()
+			fetcher := p.layerRangeFetcher(source.located, source.filePath)
+			for {
+				select {
+				case <-done:
+					return
+				case <-ctx.Done():
+					return
+				case chunk := <-chunks:
+					if err := fetchLayerChunk(ctx, fetcher, out, chunk, written); err != nil {
+						// the chunk is returned for the other sources
+						chunks <- chunk
+						logger.WarnContextf(ctx, "fetch layer chunk from source '%s' failed: %s", source.located,
+							err.Error())
+						errLock.Lock()
+						errs = append(errs, source.located+": "+err.Error())
+						errLock.Unlock()
+						return
+					}
+					if remaining.Add(-1) == 0 {
+						closeOnce.Do(func() { close(done) })
+					}
+				}
+			}
+		}(source)
+	}
+	wg.Wait()
+	if remaining.Load() != 0 {
+		_ = os.Remove(partFile)
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "download layer from multiple sources canceled")
+		}
+		return errors.Errorf("download layer from multiple sources failed, %d chunks not fetched: %s",
+			remaining.Load(), strings.Join(errs, "; "))
+	}
+	if err = verifyLayerDigest(partFile, digest); err != nil {
+		_ = os.Remove(partFile)
+		return err
+	}
+	if err = os.Rename(partFile, resp.FilePath); err != nil {
+		_ = os.Remove(partFile)
+		return errors.Wrapf(err, "rename file %s to %s failed", partFile, resp.FilePath)
+	}
+	metrics.TransferSize.WithLabelValues("download_by_multi_source").Add(float64(resp.FileSize) / 1e9)
+	logger.InfoContextf(ctx, "download layer from %d sources success, cost: %v", len(sources),
+		time.Since(start))
+	return nil
+}
+
+// fetchLayerChunk writes the chunk fetched with fetcher into the offset of out
+func fetchLayerChunk(ctx context.Context, fetcher bittorrent.RangeFetcher, out *os.File, chunk layerChunk,
+	written *atomic.Int64) error {
+	body, err := fetcher(ctx, chunk.offset, chunk.length)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	writer := &progressWriter{w: io.NewOffsetWriter(out, chunk.offset), written: written}
+	n, err := io.Copy(writer, io.LimitReader(body, chunk.length))
+	if err != nil {
+		return errors.Wrapf(err, "copy chunk at offset %d failed", chunk.offset)
+	}
+	if n != chunk.length {
+		return errors.Errorf("chunk at offset %d got %d bytes, expected %d", chunk.offset, n, chunk.length)
+	}
+	return nil
+}
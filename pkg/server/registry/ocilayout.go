@@ -0,0 +1,180 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/accesslog"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+const containerdImageNameAnnotation = "io.containerd.image.name"
+
+// ociLayoutProxy serves the images from a local OCI layout directory as a read-only registry, there is
+// no original registry behind it.
+type ociLayoutProxy struct {
+	originalHost string
+	layoutPath   string
+}
+
+func newOCILayoutProxy(proxyRegistry *options.RegistryMapping) *ociLayoutProxy {
+	return &ociLayoutProxy{
+		originalHost: proxyRegistry.OriginalHost,
+		layoutPath:   proxyRegistry.Path,
+	}
+}
+
+func (p *ociLayoutProxy) httpError(ctx context.Context, rw http.ResponseWriter, errMsg string, code int) {
+	logger.ErrorContextf(ctx, "oci-layout response error: %s", errMsg)
+	http.Error(rw, errMsg, code)
+}
+
+// ServeHTTP handles the manifest and blob requests with the files of OCI layout
+func (p *ociLayoutProxy) ServeHTTP(requestURI string, rw http.ResponseWriter, req *http.Request) {
+	ctx := logger.WithContextFields(req.Context(), "registry", p.originalHost, "layout", p.layoutPath)
+	accesslog.SetCacheOutcome(ctx, accesslog.CacheOCILayout)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		p.httpError(ctx, rw, fmt.Sprintf("method '%s' not allowed for oci layout", req.Method),
+			http.StatusMethodNotAllowed)
+		return
+	}
+	if req.URL.Path == "/v2" || req.URL.Path == "/v2/" {
+		rw.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
+	headRepo, headTag, isHeadManifest := utils.IsHeadImageDigest(req)
+	getRepo, getTag, isGetManifest := utils.IsManifestGet(req)
+	blobRepo, blobDigest, isBlob := utils.IsBlobGet(req.URL.Path)
+	switch {
+	case isHeadManifest:
+		p.serveManifest(ctx, rw, req, recorder.EventTypeHeadManifest, headRepo, headTag)
+	case isGetManifest:
+		p.serveManifest(ctx, rw, req, recorder.EventTypeGetManifest, getRepo, getTag)
+	case isBlob:
+		ctx = logger.WithContextFields(ctx, "repo", blobRepo, "digest", blobDigest)
+		desc := ocispec.Descriptor{
+			MediaType: "application/octet-stream",
+			Digest:    digest.NewDigestFromEncoded(digest.SHA256, blobDigest),
+		}
+		if err := p.serveBlob(ctx, rw, req, desc); err != nil {
+			metrics.RegistryRequestsTotal.WithLabelValues(p.originalHost, string(recorder.EventServeBlobFromLocal),
+				"error").Inc()
+			p.httpError(ctx, rw, err.Error(), http.StatusNotFound)
+			return
+		}
+		metrics.RegistryRequestsTotal.WithLabelValues(p.originalHost, string(recorder.EventServeBlobFromLocal),
+			"success").Inc()
+	default:
+		p.httpError(ctx, rw, fmt.Sprintf("request '%s' not supported by oci layout", requestURI),
+			http.StatusNotFound)
+	}
+}
+
+func (p *ociLayoutProxy) serveManifest(ctx context.Context, rw http.ResponseWriter, req *http.Request,
+	eventType recorder.EventType, repo, tag string) {
+	ctx = logger.WithContextFields(ctx, "repo", repo, "tag", tag)
+	desc, err := p.resolveManifest(repo, tag)
+	if err == nil {
+		err = p.serveBlob(ctx, rw, req, desc)
+	}
+	if err != nil {
+		metrics.RegistryRequestsTotal.WithLabelValues(p.originalHost, string(eventType), "error").Inc()
+		p.httpError(ctx, rw, err.Error(), http.StatusNotFound)
+		return
+	}
+	metrics.RegistryRequestsTotal.WithLabelValues(p.originalHost, string(eventType), "success").Inc()
+	logger.InfoContextf(ctx, "serve manifest '%s' from oci layout success", desc.Digest.String())
+}
+
+// resolveManifest returns the manifest descriptor of the repo/tag. The tag is matched with the ref-name
+// annotation ("tag" or "repo:tag") or the containerd image name annotation of index.json.
+func (p *ociLayoutProxy) resolveManifest(repo, tag string) (ocispec.Descriptor, error) {
+	if dgst, err := digest.Parse(tag); err == nil {
+		mediaType, err := p.blobMediaType(dgst)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		return ocispec.Descriptor{MediaType: mediaType, Digest: dgst}, nil
+	}
+	bs, err := os.ReadFile(filepath.Join(p.layoutPath, ocispec.ImageIndexFile))
+	if err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "read oci layout index failed")
+	}
+	index := &ocispec.Index{}
+	if err = json.Unmarshal(bs, index); err != nil {
+		return ocispec.Descriptor{}, errors.Wrapf(err, "unmarshal oci layout index failed")
+	}
+	repoTag := repo + ":" + tag
+	for _, m := range index.Manifests {
+		refName := m.Annotations[ocispec.AnnotationRefName]
+		imageName := m.Annotations[containerdImageNameAnnotation]
+		if imageName == repoTag || strings.HasSuffix(imageName, "/"+repoTag) || refName == repoTag ||
+			(refName == tag && imageName == "") {
+			return m, nil
+		}
+	}
+	return ocispec.Descriptor{}, errors.Errorf("manifest '%s' not found in oci layout", repoTag)
+}
+
+func (p *ociLayoutProxy) blobPath(dgst digest.Digest) string {
+	return filepath.Join(p.layoutPath, ocispec.ImageBlobsDir, dgst.Algorithm().String(), dgst.Encoded())
+}
+
+// blobMediaType returns the media type of the manifest blob
+func (p *ociLayoutProxy) blobMediaType(dgst digest.Digest) (string, error) {
+	bs, err := os.ReadFile(p.blobPath(dgst))
+	if err != nil {
+		return "", errors.Wrapf(err, "read manifest '%s' failed", dgst.String())
+	}
+	mediaType := struct {
+		MediaType string `json:"mediaType"`
+	}{}
+	if err = json.Unmarshal(bs, &mediaType); err != nil {
+		return "", errors.Wrapf(err, "unmarshal manifest '%s' failed", dgst.String())
+	}
+	if mediaType.MediaType == "" {
+		return ocispec.MediaTypeImageManifest, nil
+	}
+	return mediaType.MediaType, nil
+}
+
+func (p *ociLayoutProxy) serveBlob(ctx context.Context, rw http.ResponseWriter, req *http.Request,
+	desc ocispec.Descriptor) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid digest '%s'", desc.Digest.String())
+	}
+	blobPath := p.blobPath(desc.Digest)
+	f, err := os.Open(blobPath)
+	if err != nil {
+		return errors.Wrapf(err, "open blob '%s' failed", blobPath)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "stat blob '%s' failed", blobPath)
+	}
+	rw.Header().Set("Content-Type", desc.MediaType)
+	rw.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	logger.V(3).InfoContextf(ctx, "serve blob '%s' from oci layout", blobPath)
+	http.ServeContent(rw, req, "", fi.ModTime(), f)
+	return nil
+}
@@ -6,30 +6,46 @@ package registry
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/accesslog"
 	"github.com/penglongli/accelerboat/pkg/bittorrent"
+	"github.com/penglongli/accelerboat/pkg/credprovider"
+	"github.com/penglongli/accelerboat/pkg/failover"
+	"github.com/penglongli/accelerboat/pkg/loadsignal"
 	"github.com/penglongli/accelerboat/pkg/logger"
 	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/peertls"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/requester"
 	"github.com/penglongli/accelerboat/pkg/store"
+	"github.com/penglongli/accelerboat/pkg/upstreamhealth"
 	"github.com/penglongli/accelerboat/pkg/utils"
 	"github.com/penglongli/accelerboat/pkg/utils/formatutils"
 	"github.com/penglongli/accelerboat/pkg/utils/httpfile"
-	"github.com/penglongli/accelerboat/pkg/utils/lock"
+	"github.com/penglongli/accelerboat/pkg/watchdog"
 )
 
 // UpstreamProxyInterface defines the interface of upstream
@@ -38,14 +54,24 @@ type UpstreamProxyInterface interface {
 }
 
 type upstreamProxy struct {
-	op            *options.AccelerBoatOption
 	proxyHost     string
 	originalHost  string
 	proxyType     options.ProxyType
 	proxyRegistry *options.RegistryMapping
 	reverseProxy  *httputil.ReverseProxy
 
-	layerLock lock.Interface
+	// layerFlight deduplicates the concurrent fetching of the same layer
+	layerFlight *singleflight.Group
+	// layerFlightCtx cancels the layer fetching when all its waiting clients are disconnected
+	layerFlightCtx *flightContexts
+	// artifactBlobs the small blobs of artifacts which bypass the peer distribution
+	artifactBlobs *cache.Cache
+	// uploads the blob upload sessions pushed through the proxy
+	uploads *uploadSessions
+	// redirects the redirected URLs of blobs which the rewritten Locations point to
+	redirects *cache.Cache
+	// authorized the origin references which the clients are authorized for, keyed by credential
+	authorized *cache.Cache
 
 	cacheStore     store.CacheStore
 	torrentHandler *bittorrent.TorrentHandler
@@ -56,6 +82,11 @@ var (
 	proxies    = &sync.Map{}
 )
 
+// op returns the current snapshot of options, the proxy lives across config reloads so it is not kept
+func (p *upstreamProxy) op() *options.AccelerBoatOption {
+	return options.GlobalOptions()
+}
+
 func buildProxyKey(proxyType options.ProxyType, proxyHost string) string {
 	return fmt.Sprintf("%s_%s", proxyType, proxyHost)
 }
@@ -75,23 +106,36 @@ func NewUpstreamProxy(proxyType options.ProxyType, proxyHost string,
 	if ok {
 		return v.(UpstreamProxyInterface)
 	}
-	op := options.GlobalOptions()
-	proxyRegistry := op.FilterRegistryMapping(proxyHost, proxyType)
+	proxyRegistry := options.GlobalOptions().FilterRegistryMapping(proxyHost, proxyType)
 	if proxyRegistry == nil {
 		return nil
 	}
+	up := createUpstreamProxy(proxyType, proxyHost, proxyRegistry, torrentHandler)
+	proxies.Store(pk, up)
+	return up
+}
+
+// createUpstreamProxy creates the proxy of registry mapping, the caller should store it into proxies
+func createUpstreamProxy(proxyType options.ProxyType, proxyHost string, proxyRegistry *options.RegistryMapping,
+	torrentHandler *bittorrent.TorrentHandler) UpstreamProxyInterface {
+	if proxyRegistry.Type == options.RegistryTypeOCILayout {
+		return newOCILayoutProxy(proxyRegistry)
+	}
 	p := &upstreamProxy{
-		op:             op,
 		proxyHost:      proxyHost,
 		proxyType:      proxyType,
 		originalHost:   proxyRegistry.OriginalHost,
 		proxyRegistry:  proxyRegistry,
 		cacheStore:     store.GlobalRedisStore(),
-		layerLock:      lock.NewLocalLock(),
 		torrentHandler: torrentHandler,
+		layerFlight:    new(singleflight.Group),
+		artifactBlobs:  cache.New(artifactBlobExpiration, time.Minute),
+		layerFlightCtx: newFlightContexts(),
+		uploads:        newUploadSessions(proxyRegistry.OriginalHost),
+		redirects:      cache.New(redirectExpiration, time.Minute),
+		authorized:     cache.New(authorizedExpiration, time.Minute),
 	}
 	p.initReverseProxy()
-	proxies.Store(pk, p)
 	return p
 }
 
@@ -104,19 +148,28 @@ func (p *upstreamProxy) initReverseProxy() {
 			logger.ErrorContextf(req.Context(), "reverse proxy to '%s, %s' failed: %s (req-headers: %+v)",
 				req.Method, req.URL.String(), err.Error(), req.Header)
 			p.recorderReverseProxyFailed(req.Context(), req, err)
+			activeHost, _ := req.Context().Value(activeHostKey{}).(string)
+			failover.MarkFailed(req.Context(), p.originalHost, activeHost, err)
 		},
-		Transport: p.op.HTTPProxyTransport(),
+		Transport: p.op().HTTPProxyTransport(),
 		ModifyResponse: func(resp *http.Response) error {
 			req := resp.Request
 			logger.InfoContextf(req.Context(), "reverse proxy to '%s, %s' response code '%d'",
 				req.Method, req.URL.String(), resp.StatusCode)
-			utils.ChangeAuthenticateHeader(resp, fmt.Sprintf("https://%s:%d", p.proxyRegistry.ProxyHost,
-				p.op.HTTPSPort))
-			return nil
+			if failover.IsFailure(resp, nil) {
+				activeHost, _ := req.Context().Value(activeHostKey{}).(string)
+				failover.MarkFailed(req.Context(), p.originalHost, activeHost,
+					errors.Errorf("response code '%d'", resp.StatusCode))
+			}
+			p.rewriteAuthenticate(req.Context(), resp.Header)
+			return p.handleBlobRedirect(resp)
 		},
 	}
 }
 
+// activeHostKey the context key of the original host or replica which the request is reversed to
+type activeHostKey struct{}
+
 func (p *upstreamProxy) httpError(ctx context.Context, rw http.ResponseWriter, errMsg string, code int) {
 	logger.ErrorContextf(ctx, "upstream-proxy response error: %s", errMsg)
 	http.Error(rw, errMsg, http.StatusBadRequest)
@@ -127,28 +180,75 @@ func (p *upstreamProxy) httpError(ctx context.Context, rw http.ResponseWriter, e
 func (p *upstreamProxy) ServeHTTP(requestURI string, rw http.ResponseWriter, req *http.Request) {
 	originalHost := p.originalHost
 	ctx := logger.WithContextFields(req.Context(), "registry", originalHost)
-	fullPath := fmt.Sprintf("https://%s%s", originalHost, requestURI)
+	clientAddr := "http://" + req.Host
+	if req.TLS != nil {
+		clientAddr = "https://" + req.Host
+	}
+	ctx = context.WithValue(ctx, clientAddrKey{}, clientAddr)
+	// the reversed requests are sent to the replica when original host failed over
+	activeHost := failover.ActiveHost(originalHost)
+	ctx = context.WithValue(ctx, activeHostKey{}, activeHost)
+	fullPath := utils.RegistryURL(activeHost, requestURI)
 	newURL, err := url.Parse(fullPath)
 	if err != nil {
 		p.httpError(ctx, rw, fmt.Sprintf("build new full path '%s' failed: %s", fullPath, err.Error()),
 			http.StatusBadRequest)
 		return
 	}
+	// the request types are detected with the request uri without path prefix of original registry
+	req.URL, _ = url.ParseRequestURI(requestURI)
+	if req.URL == nil {
+		req.URL = newURL
+	}
+	registryService, registryScope, isServiceToken := utils.IsServiceToken(req)
+	headManifestRepo, headManifestTag, isHeadManifest := utils.IsHeadImageDigest(req)
+	manifestRepo, manifestTag, isGetManifest := utils.IsManifestGet(req)
+	blobRepo, digest, isGetBlob := utils.IsBlobGet(req.URL.Path)
+	uploadRepo, uploadSession, isBlobUpload := utils.IsBlobUpload(req.URL.Path)
+	redirectToken, isBlobRedirect := strings.CutPrefix(req.URL.Path, redirectPathPrefix)
 	req.URL = newURL
-	req.Host = originalHost
+	req.Host = newURL.Host
 
 	// directly reverse if registry-mapping is disabled
-	proxyRegistry := p.op.FilterRegistryMapping(p.proxyHost, p.proxyType)
+	proxyRegistry := p.op().FilterRegistryMapping(p.proxyHost, p.proxyType)
+	// the headers are scrubbed before reversed or sent to master, all the paths forward the same headers
+	if proxyRegistry != nil {
+		proxyRegistry.ApplyHeaderPolicy(req.Header)
+	}
 	if proxyRegistry != nil && !proxyRegistry.Enable {
-		p.reverseProxy.ServeHTTP(rw, req)
+		accesslog.SetCacheOutcome(ctx, accesslog.CacheReverse)
+		p.reverseProxy.ServeHTTP(rw, req.WithContext(ctx))
+		return
+	}
+	if isBlobRedirect {
+		accesslog.SetCacheOutcome(ctx, accesslog.CacheReverse)
+		p.serveBlobRedirect(ctx, rw, req, redirectToken)
+		return
+	}
+	// the credential of provider is for pulling, the pushing client should login itself
+	if isBlobUpload && p.op().BlobUpload.Enable {
+		ctx = logger.WithContextFields(ctx, "repo", uploadRepo, "session", uploadSession)
+		accesslog.SetCacheOutcome(ctx, accesslog.CacheReverse)
+		p.handleBlobUpload(ctx, rw, req, uploadSession, clientAddr)
 		return
 	}
+	p.injectProviderCredential(ctx, req, proxyRegistry)
 
-	registryService, registryScope, isServiceToken := utils.IsServiceToken(req)
-	headManifestRepo, headManifestTag, isHeadManifest := utils.IsHeadImageDigest(req)
-	manifestRepo, manifestTag, isGetManifest := utils.IsManifestGet(req)
-	blobRepo, digest, isGetBlob := utils.IsBlobGet(req.URL.Path)
 	switch {
+	case (isServiceToken || (isHeadManifest || isGetManifest) && !p.signatureEnforced()) &&
+		upstreamhealth.Down(activeHost):
+		// the custom path waits for master requesting the host down, it falls back directly. The manifests
+		// of enforced registry are not reversed without verification.
+		category := options.FallbackCategoryManifest
+		if isServiceToken {
+			category = options.FallbackCategoryToken
+		}
+		err = errors.Errorf("original host '%s' is probed down", activeHost)
+		if !p.allowFallback(ctx, category, err) {
+			p.respondFallbackRejected(ctx, rw, category, err)
+			return
+		}
+		logger.WarnContextf(ctx, "%s request skips custom path and will reverse: %s", category, err.Error())
 	case isServiceToken:
 		if registryService == "" || registryScope == "" {
 			break
@@ -156,6 +256,14 @@ func (p *upstreamProxy) ServeHTTP(requestURI string, rw http.ResponseWriter, req
 		ctx = logger.WithContextFields(ctx, "service", registryService, "scope", registryScope)
 		err = p.handleGetServiceToken(ctx, req, rw, registryService, registryScope)
 		if err == nil {
+			accesslog.SetCacheOutcome(ctx, accesslog.CacheMaster)
+			return
+		}
+		if p.respondUpstreamError(ctx, rw, err) {
+			return
+		}
+		if !p.allowFallback(ctx, options.FallbackCategoryToken, err) {
+			p.respondFallbackRejected(ctx, rw, options.FallbackCategoryToken, err)
 			return
 		}
 		logger.ErrorContextf(ctx, "service-token request failed and will reverse: %s", err.Error())
@@ -164,38 +272,146 @@ func (p *upstreamProxy) ServeHTTP(requestURI string, rw http.ResponseWriter, req
 		if auth := req.Header.Get("Authorization"); auth != "" {
 			err = p.handleHeadManifest(ctx, req, rw, headManifestRepo, headManifestTag)
 			if err == nil {
+				accesslog.SetCacheOutcome(ctx, accesslog.CacheMaster)
+				return
+			}
+			if p.respondUpstreamError(ctx, rw, err) {
+				return
+			}
+			if !p.allowFallback(ctx, options.FallbackCategoryManifest, err) {
+				p.respondFallbackRejected(ctx, rw, options.FallbackCategoryManifest, err)
 				return
 			}
 			logger.ErrorContextf(ctx, "head-manifest request failed and will reverse: %s", err.Error())
 		}
 	case isGetManifest:
 		ctx = logger.WithContextFields(ctx, "repo", manifestRepo, "tag", manifestTag)
-		if auth := req.Header.Get("Authorization"); auth != "" {
+		// signature verification enforced on master, the anonymous request should not be reversed directly
+		if auth := req.Header.Get("Authorization"); auth != "" || p.signatureEnforced() {
 			err = p.handleGetManifest(ctx, req, rw, manifestRepo, manifestTag)
 			if err == nil {
+				accesslog.SetCacheOutcome(ctx, accesslog.CacheMaster)
+				return
+			}
+			if errors.Is(err, apitypes.ErrSignatureVerifyFailed) {
+				accesslog.SetCacheOutcome(ctx, accesslog.CacheRejected)
+				logger.ErrorContextf(ctx, "get-manifest request rejected: %s", err.Error())
+				http.Error(rw, err.Error(), http.StatusForbidden)
+				return
+			}
+			if p.respondUpstreamError(ctx, rw, err) {
+				return
+			}
+			// the reversed manifest is not verified, the enforced registry fails closed
+			if p.signatureEnforced() {
+				accesslog.SetCacheOutcome(ctx, accesslog.CacheRejected)
+				logger.ErrorContextf(ctx, "get-manifest request failed with signature enforced: %s", err.Error())
+				http.Error(rw, err.Error(), http.StatusBadGateway)
+				return
+			}
+			if !p.allowFallback(ctx, options.FallbackCategoryManifest, err) {
+				p.respondFallbackRejected(ctx, rw, options.FallbackCategoryManifest, err)
 				return
 			}
 			logger.ErrorContextf(ctx, "get-manifest request failed and will reverse: %s", err.Error())
 		}
 	case isGetBlob:
 		ctx = logger.WithContextFields(ctx, "repo", blobRepo, "digest", digest)
+		if p.isBypassArtifactBlob(digest) {
+			logger.InfoContextf(ctx, "small artifact blob bypass the peer distribution")
+			break
+		}
 		if err = p.handleGetBlob(ctx, req, rw, blobRepo, digest); err == nil {
 			return
 		}
+		if errors.Is(err, apitypes.ErrLayerBlocked) {
+			accesslog.SetCacheOutcome(ctx, accesslog.CacheRejected)
+			logger.ErrorContextf(ctx, "get-blob request rejected: %s", err.Error())
+			http.Error(rw, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, errLocalServeBusy) {
+			logger.WarnContextf(ctx, "get-blob request rejected: %s", err.Error())
+			rw.Header().Set("Retry-After", strconv.FormatInt(p.op().LocalServe.MaxWait, 10))
+			http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, context.Canceled) {
+			logger.WarnContextf(ctx, "get-blob request canceled: %s", err.Error())
+			return
+		}
+		if p.respondUpstreamError(ctx, rw, err) {
+			return
+		}
+		// the client will retry with the truncated response
+		if errors.Is(err, errResponseStarted) {
+			logger.ErrorContextf(ctx, "get-blob request failed after response started: %s", err.Error())
+			return
+		}
+		if !p.allowFallback(ctx, options.FallbackCategoryBlob, err) {
+			p.respondFallbackRejected(ctx, rw, options.FallbackCategoryBlob, err)
+			return
+		}
 		logger.ErrorContextf(ctx, "get-blob request failed: %s", err.Error())
 	}
 	req = req.WithContext(ctx)
+	accesslog.SetCacheOutcome(ctx, accesslog.CacheReverse)
+	if isGetBlob {
+		p.recordBlobOutcome(blobOutcomeFallbackReverse)
+	}
 	p.recorderReverseProxy(ctx, req)
 	p.reverseProxy.ServeHTTP(rw, req)
 }
 
+// injectProviderCredential sets the basic auth minted by the credential provider of registry mapping if
+// the client not sends credential, the client has no need to login the cloud registry
+func (p *upstreamProxy) injectProviderCredential(ctx context.Context, req *http.Request,
+	mp *options.RegistryMapping) {
+	if mp == nil || mp.CredentialProvider == nil || req.Header.Get("Authorization") != "" {
+		return
+	}
+	auth, err := credprovider.GetCredential(ctx, mp)
+	if err != nil {
+		logger.WarnContextf(ctx, "get credential from provider failed: %s", err.Error())
+		return
+	}
+	req.SetBasicAuth(auth.Username, auth.Password)
+}
+
+// respondUpstreamError responds the failure status and WWW-Authenticate challenge of original registry to
+// client, returns false if the error is not from original registry or the status should fall back to
+// reverse proxy
+func (p *upstreamProxy) respondUpstreamError(ctx context.Context, rw http.ResponseWriter, err error) bool {
+	var upErr *apitypes.UpstreamStatusError
+	if !errors.As(err, &upErr) || p.op().UpstreamError.ShouldFallback(upErr.StatusCode) {
+		return false
+	}
+	if upErr.Authenticate != "" {
+		rw.Header().Set("Www-Authenticate", upErr.Authenticate)
+		p.rewriteAuthenticate(ctx, rw.Header())
+	}
+	accesslog.SetCacheOutcome(ctx, accesslog.CacheUpstreamError)
+	logger.WarnContextf(ctx, "respond the failure of original registry to client: %s", err.Error())
+	http.Error(rw, upErr.Message, upErr.StatusCode)
+	return true
+}
+
+func (p *upstreamProxy) signatureEnforced() bool {
+	sv := p.proxyRegistry.SignatureVerification
+	return sv != nil && sv.Enable && sv.Mode == options.SignatureVerifyEnforce
+}
+
 func (p *upstreamProxy) handleGetServiceToken(ctx context.Context, req *http.Request, rw http.ResponseWriter,
 	service, scope string) error {
 	start := time.Now()
 	logger.InfoContextf(ctx, "handle service-token request")
+	serviceTokenURL, err := p.buildServiceTokenURL(req)
+	if err != nil {
+		return err
+	}
 	getServiceTokenReq := &apitypes.GetServiceTokenRequest{
 		OriginalHost:    p.originalHost,
-		ServiceTokenUrl: req.URL.String(),
+		ServiceTokenUrl: serviceTokenURL,
 		Headers:         req.Header,
 		Service:         service,
 		Scope:           scope,
@@ -213,13 +429,52 @@ func (p *upstreamProxy) handleGetServiceToken(ctx context.Context, req *http.Req
 	return nil
 }
 
+// buildServiceTokenURL returns the token service url of original registry. The original realm is
+// carried in query if the response of original registry is rewritten by proxy, it should be on the
+// original host or the configured auth host.
+func (p *upstreamProxy) buildServiceTokenURL(req *http.Request) (string, error) {
+	query := req.URL.Query()
+	realm := query.Get(utils.OriginalRealmQuery)
+	if realm == "" {
+		return req.URL.String(), nil
+	}
+	originalRealm, err := url.Parse(realm)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse realm '%s' failed", realm)
+	}
+	if !p.proxyRegistry.IsAuthHostAllowed(originalRealm.Hostname()) {
+		return "", errors.Errorf("realm '%s' not allowed, should be on original host or auth host", realm)
+	}
+	// the rewrite rules are configured by admin, the rewritten realm is trusted
+	realmURL, err := url.Parse(p.proxyRegistry.RewriteRealm(realm))
+	if err != nil {
+		return "", errors.Wrapf(err, "parse rewritten realm of '%s' failed", realm)
+	}
+	query.Del(utils.OriginalRealmQuery)
+	realmQuery := realmURL.Query()
+	for k, v := range query {
+		realmQuery[k] = v
+	}
+	realmURL.RawQuery = realmQuery.Encode()
+	return realmURL.String(), nil
+}
+
+// registryURI returns the request uri without the path prefix of original registry, the master joins
+// it with the original host
+func (p *upstreamProxy) registryURI(req *http.Request) string {
+	return strings.TrimPrefix(req.URL.RequestURI(), p.proxyRegistry.OriginalPathPrefix())
+}
+
 func (p *upstreamProxy) handleHeadManifest(ctx context.Context, req *http.Request, rw http.ResponseWriter,
 	repo, tag string) error {
 	start := time.Now()
 	logger.InfoContextf(ctx, "handle head-manifest request")
+	if served, err := p.serveEstargzManifest(ctx, req, rw, repo, tag); served {
+		return err
+	}
 	headManifestReq := &apitypes.HeadManifestRequest{
-		OriginalHost:    req.Host,
-		HeadManifestUrl: req.URL.RequestURI(),
+		OriginalHost:    p.originalHost,
+		HeadManifestUrl: p.registryURI(req),
 		Headers:         req.Header,
 		Repo:            repo,
 		Tag:             tag,
@@ -235,6 +490,7 @@ func (p *upstreamProxy) handleHeadManifest(ctx context.Context, req *http.Reques
 		}
 	}
 	logger.InfoContextf(ctx, "head-manifest from master(%s) success", master)
+	p.recordImageSeen(ctx, repo, tag)
 	rw.WriteHeader(http.StatusOK)
 	return nil
 }
@@ -243,9 +499,12 @@ func (p *upstreamProxy) handleGetManifest(ctx context.Context, req *http.Request
 	repo, tag string) error {
 	start := time.Now()
 	logger.InfoContextf(ctx, "handle get-manifest request")
+	if served, err := p.serveEstargzManifest(ctx, req, rw, repo, tag); served {
+		return err
+	}
 	getManifestReq := &apitypes.GetManifestRequest{
-		OriginalHost: req.Host,
-		ManifestUrl:  req.URL.RequestURI(),
+		OriginalHost: p.originalHost,
+		ManifestUrl:  p.registryURI(req),
 		Headers:      req.Header,
 		Repo:         repo,
 		Tag:          tag,
@@ -256,7 +515,14 @@ func (p *upstreamProxy) handleGetManifest(ctx context.Context, req *http.Request
 		return err
 	}
 	logger.InfoContextf(ctx, "get manifest from master(%s) success", master)
-	rw.Header().Add("Content-Type", "application/json")
+	p.recordImageSeen(ctx, repo, tag)
+	m := parseManifest(manifest)
+	p.recordArtifactBlobs(m)
+	contentType := "application/json"
+	if m.MediaType != "" {
+		contentType = m.MediaType
+	}
+	rw.Header().Add("Content-Type", contentType)
 	rw.WriteHeader(http.StatusOK)
 	_, _ = rw.Write([]byte(manifest))
 	return nil
@@ -265,78 +531,238 @@ func (p *upstreamProxy) handleGetManifest(ctx context.Context, req *http.Request
 func (p *upstreamProxy) handleGetBlob(ctx context.Context, req *http.Request, rw http.ResponseWriter,
 	repo, digest string) error {
 	logger.InfoContextf(ctx, "handle get-blob request")
-	p.layerLock.Lock(ctx, digest)
+	// the small blobs are served from memory without the limit of serving local layers
+	if p.serveBlobFromMemory(ctx, req, rw, digest) {
+		p.recordBlobOutcome(blobOutcomeLocalHit)
+		return nil
+	}
 	// directly download if check layer existed in-local
 	lfi, lp := p.checkLocalLayer(digest)
 	if lfi != nil {
 		start := time.Now()
-		p.layerLock.UnLock(ctx, digest)
-		if p.downloadLayerFromLocalLimit(ctx, digest, req, rw) {
+		served, err := p.downloadLayerFromLocalLimit(ctx, digest, req, rw)
+		if err != nil {
+			return err
+		}
+		if served {
+			accesslog.SetCacheOutcome(ctx, accesslog.CacheLocal)
+			p.recordBlobOutcome(blobOutcomeLocalHit)
 			p.recorderServeBlobFromLocal(ctx, start, repo, digest, lfi.Size(), nil)
+			p.cacheBlobInMemory(ctx, digest, lp, lfi)
 			return nil
 		}
 		p.recorderServeBlobFromLocal(ctx, start, repo, digest, lfi.Size(),
 			fmt.Errorf("serve local file '%s' not success", lp))
 		return fmt.Errorf("download from local '%s' not success(local exist)", lp)
 	}
-	defer p.layerLock.UnLock(ctx, digest)
+	if p.serveEstargzBlob(ctx, req, rw, digest) {
+		return nil
+	}
+	if served, err := p.serveEstargzRange(ctx, req, rw, digest); served {
+		return err
+	}
+
+	// The concurrent requests of the same layer wait for only one fetching, then every waiter serves the
+	// layer from local independently.
+	start := time.Now()
+	var leader bool
+	flightCtx, leave := p.layerFlightCtx.join(ctx, digest)
+	dequeue := loadsignal.Global.Enqueue()
+	v, err, shared := p.layerFlight.Do(digest, func() (interface{}, error) {
+		leader = true
+		fetchCtx, cancel := fetchContext(ctx, flightCtx)
+		defer cancel()
+		return p.fetchLayer(fetchCtx, req, rw, repo, digest)
+	})
+	dequeue()
+	leave()
+	if err != nil {
+		// only the response of leader is started, the waiters can be reversed
+		if !leader && errors.Is(err, errResponseStarted) {
+			return errors.Errorf("waiting for layer fetching failed: %s", err.Error())
+		}
+		return err
+	}
+	result := v.(*layerFetchResult)
+	// the waiters are redirected too, the layer is not fetched into local
+	if result.redirect != "" {
+		p.respondClientRedirect(ctx, rw, result.redirect)
+		return nil
+	}
+	if leader && result.streamed {
+		accesslog.SetCacheOutcome(ctx, accesslog.CacheCluster)
+		p.recordBlobOutcome(result.outcome)
+		return nil
+	}
+	if shared && !leader {
+		logger.InfoContextf(ctx, "layer is fetched by other waiting request")
+	}
+	// Serve blob layer from local to client(docker/containerd)
+	served, err := p.downloadLayerFromLocalLimit(ctx, digest, req, rw)
+	if err != nil {
+		return err
+	}
+	if served {
+		accesslog.SetCacheOutcome(ctx, accesslog.CacheCluster)
+		p.recordBlobOutcome(result.outcome)
+		p.recorderServeBlobFromLocal(ctx, start, repo, digest, result.fileSize, nil)
+		return nil
+	}
+	p.recorderServeBlobFromLocal(ctx, start, repo, digest, result.fileSize,
+		fmt.Errorf("download from local not success"))
+	return fmt.Errorf("download layer from local not success(after download)")
+}
+
+// layerFetchResult defines the result of fetching layer into local
+type layerFetchResult struct {
+	fileSize int64
+	// streamed the layer is streamed to the client of fetching request already
+	streamed bool
+	// redirect the signed URL of the node holding the layer, the clients are redirected to it
+	redirect string
+	// outcome the tier which the layer is fetched from
+	outcome string
+}
 
+// fetchLayer gets the layer info from master and downloads the layer into local. The layer is streamed
+// to the client of request directly if it is downloaded with torrent.
+func (p *upstreamProxy) fetchLayer(ctx context.Context, req *http.Request, rw http.ResponseWriter,
+	repo, digest string) (*layerFetchResult, error) {
 	logger.InfoContextf(ctx, "start get layer-info from master")
 	layerReq := &apitypes.DownloadLayerRequest{
-		OriginalHost: req.Host,
-		LayerUrl:     req.URL.RequestURI(),
+		OriginalHost: p.originalHost,
+		LayerUrl:     p.registryURI(req),
 		Headers:      req.Header,
 		Repo:         repo,
 		Digest:       digest,
 	}
 	layerResp, master, err := p.recorderWrapGetBlobFromMaster(ctx, layerReq, digest)
 	if err != nil {
-		return errors.Wrapf(err, "download layer from master failed, master=%s", master)
+		return nil, errors.Wrapf(err, "download layer from master failed, master=%s", master)
 	}
 	haveTorrent := "no-torrent"
 	if layerResp.TorrentBase64 != "" {
 		haveTorrent = "(too long not print)"
+	} else if layerResp.TorrentPending {
+		haveTorrent = "torrent-pending"
 	}
 
 	logger.InfoContextf(ctx, "get layer-info from master(%s) success, located: %s, "+
 		"filePath: %s, size: %s, torrent: %s", master, layerResp.Located, layerResp.FilePath,
 		formatutils.FormatSize(layerResp.FileSize), haveTorrent)
-	start := time.Now()
-	// Should download layer from local again, maybe already have it on local
+	result := &layerFetchResult{fileSize: layerResp.FileSize, outcome: blobOutcomeLocalHit}
+	if layerResp.FromOrigin {
+		result.outcome = blobOutcomeOrigin
+	}
+	// Maybe already have it on local
 	// Because when we download the layer from the master, the master may assign the task of downloading the
 	// layer to us. When we get the layer information, the layer may have been downloaded to the current node.
-	if p.downloadLayerFromLocalLimit(ctx, digest, req, rw) {
-		p.recorderServeBlobFromLocal(ctx, start, repo, digest, layerResp.FileSize, nil)
-		return nil
+	if lfi, _ := p.checkLocalLayer(digest); lfi != nil {
+		return result, nil
+	}
+	if result.redirect = p.clientRedirectURL(req, layerResp, digest); result.redirect != "" {
+		return result, nil
 	}
 
+	method := p.selectTransferMethod(ctx, layerResp, digest)
+	// Stream the layer to client while downloading with torrent, the client not need to wait for the
+	// completion. The range request is served after download completed.
+	if method == transferTorrent && req.Header.Get("Range") == "" {
+		var started bool
+		start := time.Now()
+		started, err = p.recorderWrapStreamBlobByTorrent(ctx, rw, layerResp, repo, digest)
+		if err == nil {
+			transferThroughput.observe(transferTorrent, layerResp.FileSize, time.Since(start))
+			result.streamed = true
+			result.setPeerOutcome(transferTorrent)
+			return result, nil
+		}
+		if started {
+			return nil, errors.Wrapf(errResponseStarted, "stream layer by torrent failed: %s", err.Error())
+		}
+		logger.WarnContextf(ctx, "stream layer by torrent failed and will download-by-tcp: %s", err.Error())
+		if err = p.downloadWithMethod(ctx, transferTCP, layerResp, repo, digest); err != nil {
+			return nil, errors.Wrapf(err, "download by tcp failed")
+		}
+		result.setPeerOutcome(transferTCP)
+		return result, nil
+	}
 	// Download layer from remote to localhost
-	if err = p.handleLayerDownload(ctx, layerResp, repo, digest); err != nil {
-		return errors.Wrapf(err, "handle download layer failed")
+	method, err = p.handleLayerDownload(ctx, layerResp, repo, digest, method)
+	if err != nil {
+		return nil, errors.Wrapf(err, "handle download layer failed")
 	}
-	// Serve blob layer from local to client(docker/containerd)
-	if p.downloadLayerFromLocalLimit(ctx, digest, req, rw) {
-		p.recorderServeBlobFromLocal(ctx, start, repo, digest, layerResp.FileSize, nil)
-		return nil
+	result.setPeerOutcome(method)
+	return result, nil
+}
+
+// setPeerOutcome sets the outcome by the method of transferring layer from peer, the layer downloaded from
+// original registry for the request is still counted as origin
+func (r *layerFetchResult) setPeerOutcome(method transferMethod) {
+	if r.outcome == blobOutcomeOrigin {
+		return
+	}
+	switch method {
+	case transferTorrent:
+		r.outcome = blobOutcomePeerTorrent
+	case transferMultiSource:
+		r.outcome = blobOutcomePeerMultiSource
+	default:
+		r.outcome = blobOutcomePeerTCP
 	}
-	p.recorderServeBlobFromLocal(ctx, start, repo, digest, layerResp.FileSize,
-		fmt.Errorf("download from local not success"))
-	return fmt.Errorf("download layer from local not success(after download)")
+}
+
+// the outcomes of get-blob request, by the tier which served it
+const (
+	blobOutcomeLocalHit        = "local_hit"
+	blobOutcomePeerTCP         = "peer_tcp"
+	blobOutcomePeerTorrent     = "peer_torrent"
+	blobOutcomePeerMultiSource = "peer_multi_source"
+	blobOutcomeOrigin          = "origin"
+	blobOutcomeClientRedirect  = "client_redirect"
+	blobOutcomeFallbackReverse = "fallback_reverse_proxy"
+)
+
+func (p *upstreamProxy) recordBlobOutcome(outcome string) {
+	metrics.BlobRequestsTotal.WithLabelValues(p.originalHost, outcome).Inc()
+}
+
+// errResponseStarted the response is partially written to client, the request cannot be reversed
+var errResponseStarted = errors.New("response already started")
+
+// blobStreamWriter writes the response headers of blob before the first streamed bytes
+type blobStreamWriter struct {
+	rw      http.ResponseWriter
+	size    int64
+	digest  string
+	started bool
+}
+
+// Write implements io.Writer
+func (w *blobStreamWriter) Write(bs []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.rw.Header().Set("Content-Type", "application/octet-stream")
+		w.rw.Header().Set("Content-Length", strconv.FormatInt(w.size, 10))
+		w.rw.Header().Set("Docker-Content-Digest", w.digest)
+		w.rw.WriteHeader(http.StatusOK)
+	}
+	return w.rw.Write(bs)
 }
 
 func (p *upstreamProxy) checkLocalLayer(digest string) (os.FileInfo, string) {
 	layerName := utils.LayerFileName(digest)
-	localLayer := path.Join(p.op.StorageConfig.TransferPath, layerName)
+	localLayer := path.Join(p.op().StorageConfig.TransferPath, layerName)
 	fi, err := os.Stat(localLayer)
 	if err == nil {
 		return fi, localLayer
 	}
-	localLayer = path.Join(p.op.StorageConfig.SmallFilePath, layerName)
+	localLayer = path.Join(p.op().StorageConfig.SmallFilePath, layerName)
 	fi, err = os.Stat(localLayer)
 	if err == nil {
 		return fi, localLayer
 	}
-	localLayer = path.Join(p.op.StorageConfig.OCIPath, layerName)
+	localLayer = path.Join(p.op().StorageConfig.OCIPath, layerName)
 	fi, err = os.Stat(localLayer)
 	if err == nil {
 		return fi, localLayer
@@ -344,16 +770,52 @@ func (p *upstreamProxy) checkLocalLayer(digest string) (os.FileInfo, string) {
 	return nil, ""
 }
 
-var downloadSem = make(chan struct{}, 20)
+// errLocalServeBusy the request waited for the limit of serving local layers too long
+var errLocalServeBusy = errors.New("too many requests serving local layers")
 
+var (
+	downloadSemOnce sync.Once
+	downloadSem     chan struct{}
+)
+
+// localServeSem returns the semaphore of serving local layers, the size is not changed with config reload
+func localServeSem() chan struct{} {
+	downloadSemOnce.Do(func() {
+		downloadSem = make(chan struct{}, options.GlobalOptions().LocalServe.MaxConcurrency)
+	})
+	return downloadSem
+}
+
+// downloadLayerFromLocalLimit serves the local layer within the concurrency limit. Returns errLocalServeBusy
+// if waited for the limit too long, or the error of ctx if the client is gone while waiting.
 func (p *upstreamProxy) downloadLayerFromLocalLimit(ctx context.Context, digest string, req *http.Request,
-	rw http.ResponseWriter) bool {
+	rw http.ResponseWriter) (bool, error) {
 	logger.V(3).InfoContextf(ctx, "download layer from local waiting limit lock")
+	sem := localServeSem()
 	select {
-	case downloadSem <- struct{}{}:
-		defer func() { <-downloadSem }()
+	case sem <- struct{}{}:
+	default:
+		metrics.LocalServeQueueLength.Inc()
+		dequeue := loadsignal.Global.Enqueue()
+		timer := time.NewTimer(time.Duration(p.op().LocalServe.MaxWait) * time.Second)
+		select {
+		case sem <- struct{}{}:
+		case <-timer.C:
+			metrics.LocalServeQueueLength.Dec()
+			dequeue()
+			return false, errLocalServeBusy
+		case <-ctx.Done():
+			timer.Stop()
+			metrics.LocalServeQueueLength.Dec()
+			dequeue()
+			return false, errors.Wrapf(ctx.Err(), "waiting for the limit of serving local layer")
+		}
+		timer.Stop()
+		metrics.LocalServeQueueLength.Dec()
+		dequeue()
 	}
-	return p.downloadLayerFromLocal(ctx, digest, req, rw)
+	defer func() { <-sem }()
+	return p.downloadLayerFromLocal(ctx, digest, req, rw), nil
 }
 
 // downloadLayerFromLocal download layer from local, if local have the layer
@@ -366,7 +828,12 @@ func (p *upstreamProxy) downloadLayerFromLocal(ctx context.Context, digest strin
 	}
 	logger.InfoContextf(ctx, "download layer from local starting")
 	start := time.Now()
-	if err := httpfile.HTTPServeFile(ctx, rw, req, layerPath); err != nil {
+	ioConfig := p.op().LocalServe.IO
+	if err := httpfile.HTTPServeFile(ctx, rw, req, layerPath, &httpfile.ReadOptions{
+		Mode:       httpfile.ReadMode(ioConfig.Mode),
+		BufferSize: ioConfig.BufferSize * 1024,
+		Fadvise:    ioConfig.Fadvise,
+	}); err != nil {
 		logger.WarnContextf(ctx, "download layer from local failed with error: %s", err.Error())
 		return false
 	}
@@ -376,66 +843,288 @@ func (p *upstreamProxy) downloadLayerFromLocal(ctx context.Context, digest strin
 }
 
 func (p *upstreamProxy) handleLayerDownload(ctx context.Context, resp *apitypes.DownloadLayerResponse,
-	repo, digest string) error {
-	// download layer from target directly with tcp
-	if resp.TorrentBase64 == "" {
-		err := p.recorderWrapDownloadBlobByTCP(ctx, resp, repo, digest)
+	repo, digest string, method transferMethod) (transferMethod, error) {
+	switch method {
+	case transferTCP:
+		// download layer from target directly with tcp
+		err := p.downloadWithMethod(ctx, transferTCP, resp, repo, digest)
+		if err == nil {
+			return transferTCP, nil
+		}
+		// the stalled tcp transfer is retried with torrent if the layer has
+		if !errors.Is(err, watchdog.ErrStalled) || resp.TorrentBase64 == "" {
+			return "", errors.Wrapf(err, "download by tcp failed")
+		}
+		logger.WarnContextf(ctx, "download layer with tcp stalled and will download-by-torrent: %s", err.Error())
+		if err = p.downloadWithMethod(ctx, transferTorrent, resp, repo, digest); err != nil {
+			return "", errors.Wrapf(err, "download by torrent failed")
+		}
+		return transferTorrent, nil
+	case transferRace:
+		if won, err := p.raceLayerDownload(ctx, resp, repo, digest); err == nil {
+			return won, nil
+		} else {
+			logger.WarnContextf(ctx, "download layer with race failed and will download-by-tcp: %s",
+				err.Error())
+		}
+	case transferHedge:
+		if won, err := p.hedgeLayerDownload(ctx, resp, repo, digest); err == nil {
+			return won, nil
+		} else {
+			logger.WarnContextf(ctx, "download layer with hedge failed and will download-by-tcp: %s",
+				err.Error())
+		}
+	case transferMultiSource:
+		if err := p.downloadWithMethod(ctx, transferMultiSource, resp, repo, digest); err == nil {
+			return transferMultiSource, nil
+		} else {
+			logger.WarnContextf(ctx, "download layer with multi-source failed and will download-by-tcp: %s",
+				err.Error())
+		}
+	default:
+		if err := p.downloadWithMethod(ctx, transferTorrent, resp, repo, digest); err == nil {
+			return transferTorrent, nil
+		} else {
+			logger.WarnContextf(ctx, "downlaod layer with torrent failed and will download-by-tcp: %s",
+				err.Error())
+		}
+	}
+
+	if err := p.downloadWithMethod(ctx, transferTCP, resp, repo, digest); err != nil {
+		return "", errors.Wrapf(err, "download by tcp failed")
+	}
+	return transferTCP, nil
+}
+
+// transferEndpoint returns the client and url to transfer layer from target with tcp, the target is
+// requested with the peer tls if enabled
+func (p *upstreamProxy) transferEndpoint(target string) (*http.Client, string, error) {
+	if p.op().PeerTLS.Enable {
+		if err := peertls.Global.VerifyPeer(target); err != nil {
+			return nil, "", errors.Wrapf(err, "verify peer failed")
+		}
+		return peertls.Global.Client(),
+			fmt.Sprintf("https://%s:%d%s", target, p.op().PeerTLS.Port, apitypes.APITransferLayerTCP), nil
+	}
+	return http.DefaultClient, fmt.Sprintf("http://%s:%d%s", target, p.op().HTTPPort,
+		apitypes.APITransferLayerTCP), nil
+}
+
+// layerRangeFetcher returns the fetcher of layer ranges from target with tcp, it repairs the holes of the
+// layer downloaded with torrent
+func (p *upstreamProxy) layerRangeFetcher(target, filePath string) bittorrent.RangeFetcher {
+	return func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		client, transferURL, err := p.transferEndpoint(target)
 		if err != nil {
-			return errors.Wrapf(err, "download by tcp failed")
+			return nil, err
 		}
-		return nil
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, transferURL, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create http.request failed")
+		}
+		query := req.URL.Query()
+		query.Set("file", filePath)
+		req.URL.RawQuery = query.Encode()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch layer range from target '%s' failed", target)
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			_ = resp.Body.Close()
+			return nil, errors.Errorf("fetch layer range from target '%s' resp code not 206 but %d", target,
+				resp.StatusCode)
+		}
+		return resp.Body, nil
 	}
+}
 
-	if err := p.recorderWrapDownloadBlobByTorrent(ctx, resp, repo, digest); err == nil {
-		return nil
-	} else {
-		logger.WarnContextf(ctx, "downlaod layer with torrent failed and will download-by-tcp: %s",
-			err.Error())
+const (
+	// resumeBackoffBase the backoff before the first resumption, it is doubled for every attempt
+	resumeBackoffBase = 500 * time.Millisecond
+	// resumeBackoffMax the max backoff between resumptions
+	resumeBackoffMax = 10 * time.Second
+)
+
+// resumeBackoff returns the capped exponential backoff with jitter before the resumption of attempt, it is
+// randomized in [d/2, d] so the nodes resuming from the same broken target are not synchronized
+func resumeBackoff(attempt int) time.Duration {
+	d := resumeBackoffMax
+	if attempt < 16 && resumeBackoffBase<<attempt < resumeBackoffMax {
+		d = resumeBackoffBase << attempt
 	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// tcpPartFile returns the partial file of layer downloaded with tcp
+func (p *upstreamProxy) tcpPartFile(digest string) string {
+	return path.Join(p.op().StorageConfig.DownloadPath, utils.LayerFileName(digest)+".part")
+}
 
-	if err := p.recorderWrapDownloadBlobByTCP(ctx, resp, repo, digest); err != nil {
-		return errors.Wrapf(err, "download by tcp failed")
+func (p *upstreamProxy) downloadByTCP(ctx context.Context, target string, filePath, digest string) error {
+	client, transferURL, err := p.transferEndpoint(target)
+	if err != nil {
+		return err
 	}
+	partFile := p.tcpPartFile(digest)
+	maxAttempts := p.op().TransferConfig.MaxResumeAttempts
+	for attempt := 0; attempt <= maxAttempts; attempt++ {
+		var resumable bool
+		if p.op().InternalGRPC.Enable && requester.NodeSupports(ctx, target, apitypes.CapabilityChunkedTransfer) {
+			resumable, err = p.requestPartTransferGRPC(ctx, target, filePath, partFile)
+			if err != nil && requester.FallbackToHTTP(err) {
+				logger.WarnContextf(ctx, "download layer from target '%s' with grpc failed and will use http: %s",
+					target, err.Error())
+				resumable, err = p.requestPartTransfer(ctx, client, transferURL, target, filePath, partFile)
+			}
+		} else {
+			resumable, err = p.requestPartTransfer(ctx, client, transferURL, target, filePath, partFile)
+		}
+		if err == nil {
+			break
+		}
+		// the canceled transfer (e.g. lost the race) will not be resumed
+		if !resumable || ctx.Err() != nil {
+			_ = os.Remove(partFile)
+			return err
+		}
+		if attempt == maxAttempts {
+			break
+		}
+		backoff := resumeBackoff(attempt)
+		logger.WarnContextf(ctx, "download layer from target '%s' with tcp broken and will resume(%d/%d) "+
+			"after %s: %s", target, attempt+1, maxAttempts, backoff.String(), err.Error())
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			_ = os.Remove(partFile)
+			return errors.Wrapf(ctx.Err(), "download layer from target '%s' with tcp canceled before resume", target)
+		case <-timer.C:
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "download layer from target '%s' with tcp failed after %d resume attempts",
+			target, maxAttempts)
+	}
+	if err = verifyLayerDigest(partFile, digest); err != nil {
+		_ = os.Remove(partFile)
+		return err
+	}
+	if !bittorrent.LinkAllowed(ctx) {
+		_ = os.Remove(partFile)
+		return errors.Errorf("layer '%s' is already downloaded by other method, not rename", digest)
+	}
+	if err = os.Rename(partFile, filePath); err != nil {
+		return errors.Wrapf(err, "rename file %s to %s failed", partFile, filePath)
+	}
+	logger.InfoContextf(ctx, "rename file %s to %s success", partFile, filePath)
 	return nil
 }
 
-func (p *upstreamProxy) downloadByTCP(ctx context.Context, target string, filePath, digest string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s:%d%s", target,
-		p.op.HTTPPort, apitypes.APITransferLayerTCP), nil)
+// requestPartTransfer requests the remainder of layer from target with Range, and appends it into the
+// part file. Returns whether the part file is kept for resumption when failed.
+func (p *upstreamProxy) requestPartTransfer(ctx context.Context, client *http.Client, transferURL, target,
+	filePath, partFile string) (bool, error) {
+	var offset int64
+	if fi, err := os.Stat(partFile); err == nil {
+		offset = fi.Size()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, transferURL, nil)
 	if err != nil {
-		return errors.Wrapf(err, "create http.request failed")
+		return false, errors.Wrapf(err, "create http.request failed")
 	}
 	query := req.URL.Query()
 	query.Set("file", filePath)
 	req.URL.RawQuery = query.Encode()
-	logger.InfoContextf(ctx, "download layer from target '%s' with tcp starting", target)
-	resp, err := http.DefaultClient.Do(req)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else if p.op().TransferConfig.Compression == options.TransferCompressionZstd {
+		req.Header.Set("Accept-Encoding", options.TransferCompressionZstd)
+	}
+	logger.InfoContextf(ctx, "download layer from target '%s' with tcp starting, offset: %d", target, offset)
+	resp, err := client.Do(req)
 	if err != nil {
-		return errors.Wrapf(err, "download layer from target '%s' with tcp failed", target)
+		return true, errors.Wrapf(err, "download layer from target '%s' with tcp failed", target)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("download layer from target '%s' with tcp resp code not 200 but %d",
+	flag := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flag |= os.O_APPEND
+	case http.StatusOK:
+		// the target not support range, download from the beginning
+		flag |= os.O_TRUNC
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the part file is not shorter than the layer, it is verified by digest
+		return false, nil
+	default:
+		return false, errors.Errorf("download layer from target '%s' with tcp resp code not 200 but %d",
 			target, resp.StatusCode)
 	}
-	if err = p.saveLayerToLocal(ctx, resp, digest, filePath); err != nil {
-		return errors.Wrapf(err, "download to local failed")
+	// the layer re-compressed by target is decoded on the fly, the part file is always the original layer
+	if resp.Header.Get("Content-Encoding") == options.TransferCompressionZstd {
+		dec, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			return false, errors.Wrapf(err, "create zstd reader failed")
+		}
+		defer dec.Close()
+		resp.Body = dec.IOReadCloser()
+		resp.ContentLength = -1
 	}
-	return nil
+	out, err := os.OpenFile(partFile, flag, p.op().StorageConfig.FilePerm())
+	if err != nil {
+		return false, errors.Wrapf(err, "open file %s failed", partFile)
+	}
+	defer out.Close()
+	if err = p.saveLayerToLocal(ctx, resp, out, offset); err != nil {
+		return true, err
+	}
+	return false, nil
 }
 
-func (p *upstreamProxy) saveLayerToLocal(ctx context.Context, resp *http.Response,
-	digest, newFile string) error {
-	tmpFile := path.Join(p.op.StorageConfig.DownloadPath, digest+".tar.gzip")
-	out, err := os.Create(tmpFile)
+// requestPartTransferGRPC streams the remainder of layer from target with the gRPC internal API, and
+// appends it into the part file. Returns whether the part file is kept for resumption when failed.
+func (p *upstreamProxy) requestPartTransferGRPC(ctx context.Context, target, filePath, partFile string) (bool,
+	error) {
+	var offset int64
+	if fi, err := os.Stat(partFile); err == nil {
+		offset = fi.Size()
+	}
+	out, err := os.OpenFile(partFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, p.op().StorageConfig.FilePerm())
 	if err != nil {
-		return errors.Wrapf(err, "create file %s failed", tmpFile)
+		return false, errors.Wrapf(err, "open file %s failed", partFile)
 	}
 	defer out.Close()
+	logger.InfoContextf(ctx, "download layer from target '%s' with grpc starting, offset: %d", target, offset)
+	start := time.Now()
+	_, written, err := requester.TransferLayer(ctx, target, filePath, offset, out)
+	if err != nil {
+		switch status.Code(errors.Cause(err)) {
+		case codes.OutOfRange:
+			// the part file is not shorter than the layer, it is verified by digest
+			return false, nil
+		case codes.NotFound, codes.InvalidArgument:
+			return false, err
+		default:
+			return true, err
+		}
+	}
+	logger.InfoContextf(ctx, "layer download to local '%s' with grpc success, total %s, cost: %v",
+		out.Name(), formatutils.FormatSize(offset+written), time.Since(start))
+	return false, nil
+}
 
+func (p *upstreamProxy) saveLayerToLocal(ctx context.Context, resp *http.Response, out *os.File,
+	offset int64) error {
 	start := time.Now()
 	var written atomic.Int64
+	written.Store(offset)
 	total := resp.ContentLength
+	if total >= 0 {
+		total += offset
+	}
 	done := make(chan struct{})
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
@@ -448,29 +1137,43 @@ func (p *upstreamProxy) saveLayerToLocal(ctx context.Context, resp *http.Respons
 				n := written.Load()
 				if total >= 0 {
 					pct := float64(n) / float64(total) * 100
-					logger.InfoContextf(ctx, "layer download progress: %s / %s (%.1f%%) digest=%s",
-						formatutils.FormatSize(n), formatutils.FormatSize(total), pct, digest)
+					logger.InfoContextf(ctx, "layer download progress: %s / %s (%.1f%%) file=%s",
+						formatutils.FormatSize(n), formatutils.FormatSize(total), pct, out.Name())
 				} else {
-					logger.InfoContextf(ctx, "layer download progress: %s downloaded digest=%s",
-						formatutils.FormatSize(n), digest)
+					logger.InfoContextf(ctx, "layer download progress: %s downloaded file=%s",
+						formatutils.FormatSize(n), out.Name())
 				}
 			}
 		}
 	}()
 
 	writer := &progressWriter{w: out, written: &written}
-	if _, err = io.Copy(writer, resp.Body); err != nil {
+	if _, err := io.Copy(writer, resp.Body); err != nil {
 		close(done)
 		return errors.Wrapf(err, "download-by-tcp io.copy failed")
 	}
 	close(done)
-
 	logger.InfoContextf(ctx, "layer download to local '%s' success, total %s, cost: %v",
-		tmpFile, formatutils.FormatSize(written.Load()), time.Since(start))
-	if err = os.Rename(tmpFile, newFile); err != nil {
-		return errors.Wrapf(err, "rename file %s to %s failed", tmpFile, newFile)
+		out.Name(), formatutils.FormatSize(written.Load()), time.Since(start))
+	return nil
+}
+
+// verifyLayerDigest checks the sha256 of layer file is same as the digest
+func verifyLayerDigest(layerFile, digest string) error {
+	f, err := os.Open(layerFile)
+	if err != nil {
+		return errors.Wrapf(err, "open file %s failed", layerFile)
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return errors.Wrapf(err, "read file %s failed", layerFile)
+	}
+	expected := strings.TrimPrefix(digest, "sha256:")
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != expected {
+		return errors.Errorf("layer file '%s' digest '%s' not same as expected '%s'", layerFile, actual,
+			expected)
 	}
-	logger.InfoContextf(ctx, "rename file %s to %s success", tmpFile, newFile)
 	return nil
 }
 
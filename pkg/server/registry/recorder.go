@@ -10,12 +10,28 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/penglongli/accelerboat/pkg/logger"
 	"github.com/penglongli/accelerboat/pkg/metrics"
 	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/server/common"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/requester"
 )
 
+// observeRequestDuration observes the latency of registry request, the request id is attached as exemplar
+// if the request is slow
+func (p *upstreamProxy) observeRequestDuration(ctx context.Context, eventType recorder.EventType,
+	duration time.Duration) {
+	obs := metrics.RegistryRequestDurationSeconds.WithLabelValues(p.originalHost, string(eventType))
+	conf := p.op().Exemplars
+	requestID := logger.GetContextField(ctx, common.RequestIDHeaderKey)
+	if !conf.Enable || requestID == "" || duration < time.Duration(conf.SlowThreshold)*time.Millisecond {
+		obs.Observe(duration.Seconds())
+		return
+	}
+	metrics.ObserveWithExemplar(obs, duration.Seconds(), requestID, common.IsTraceID(requestID))
+}
+
 func (p *upstreamProxy) recorderReverseProxy(ctx context.Context, req *http.Request) {
 	if req.URL.Path == "/v2/" {
 		return
@@ -51,8 +67,7 @@ func (p *upstreamProxy) recorderReverseProxyFailed(ctx context.Context, req *htt
 func (p *upstreamProxy) recorderServiceToken(ctx context.Context, start time.Time, master, service, scope string,
 	err error) {
 	duration := time.Since(start)
-	metrics.RegistryRequestDurationSeconds.WithLabelValues(p.originalHost, string(recorder.EventTypeServiceToken)).
-		Observe(duration.Seconds())
+	p.observeRequestDuration(ctx, recorder.EventTypeServiceToken, duration)
 	details := map[string]interface{}{
 		"registry": p.originalHost, "service": service, "scope": scope,
 		"duration_ms": duration.Milliseconds(), "master": master,
@@ -81,8 +96,7 @@ func (p *upstreamProxy) recorderServiceToken(ctx context.Context, start time.Tim
 func (p *upstreamProxy) recorderHeadManifest(ctx context.Context, start time.Time, master,
 	repo, tag string, err error) {
 	duration := time.Since(start)
-	metrics.RegistryRequestDurationSeconds.WithLabelValues(p.originalHost, string(recorder.EventTypeHeadManifest)).
-		Observe(duration.Seconds())
+	p.observeRequestDuration(ctx, recorder.EventTypeHeadManifest, duration)
 	details := map[string]interface{}{
 		"registry": p.originalHost, "repo": repo, "tag": tag,
 		"master":      master,
@@ -112,13 +126,17 @@ func (p *upstreamProxy) recorderHeadManifest(ctx context.Context, start time.Tim
 func (p *upstreamProxy) recorderGetManifest(ctx context.Context, start time.Time, master, repo, tag,
 	manifest string, err error) {
 	duration := time.Since(start)
-	metrics.RegistryRequestDurationSeconds.WithLabelValues(p.originalHost, string(recorder.EventTypeGetManifest)).
-		Observe(duration.Seconds())
+	p.observeRequestDuration(ctx, recorder.EventTypeGetManifest, duration)
 	details := map[string]interface{}{
 		"registry": p.originalHost, "repo": repo, "tag": tag,
 		"duration_ms": duration.Milliseconds(),
 		"master":      master,
 	}
+	if err == nil {
+		if artifactType := parseManifest(manifest).artifactType(); artifactType != "" {
+			details["artifactType"] = artifactType
+		}
+	}
 	if err != nil {
 		recorder.Global.Record(ctx, recorder.Event{
 			Type:        recorder.EventTypeGetManifest,
@@ -258,6 +276,40 @@ func (p *upstreamProxy) recorderWrapDownloadBlobByTCP(ctx context.Context, resp
 	return err
 }
 
+func (p *upstreamProxy) recorderWrapStreamBlobByTorrent(ctx context.Context, rw http.ResponseWriter,
+	resp *apitypes.DownloadLayerResponse, repo, digest string) (bool, error) {
+	start := time.Now()
+	started, err := p.torrentHandler.StreamTorrent(ctx, digest, resp.TorrentBase64, resp.FilePath,
+		&blobStreamWriter{rw: rw, size: resp.FileSize, digest: digest},
+		p.layerRangeFetcher(resp.Located, resp.FilePath))
+	details := map[string]interface{}{
+		"registry": p.originalHost, "repo": repo, "digest": digest,
+		"target": resp.Located, "file": resp.FilePath, "size": resp.FileSize,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		recorder.Global.Record(ctx, recorder.Event{
+			Type:        recorder.EventTypeDownloadBlobByTorrent,
+			EventStatus: recorder.Warning,
+			Details:     details,
+			Message:     fmt.Sprintf("Stream blob by torrent failed: %s", err.Error()),
+		})
+		metrics.RegistryRequestsTotal.WithLabelValues(p.originalHost, string(recorder.EventTypeDownloadBlobByTorrent),
+			"error").Inc()
+		return started, err
+	}
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeDownloadBlobByTorrent,
+		EventStatus: recorder.Normal,
+		Details:     details,
+		Message:     "Stream blob by torrent success",
+	})
+	metrics.RegistryRequestsTotal.WithLabelValues(p.originalHost, string(recorder.EventTypeDownloadBlobByTorrent),
+		"success").Inc()
+	metrics.TransferSize.WithLabelValues("download_by_torrent").Add(float64(resp.FileSize) / 1e9)
+	return started, nil
+}
+
 func (p *upstreamProxy) recorderWrapDownloadBlobByTorrent(ctx context.Context, resp *apitypes.DownloadLayerResponse,
 	repo, digest string) error {
 	recorder.Global.Record(ctx, recorder.Event{
@@ -271,7 +323,8 @@ func (p *upstreamProxy) recorderWrapDownloadBlobByTorrent(ctx context.Context, r
 	})
 
 	start := time.Now()
-	err := p.torrentHandler.DownloadTorrent(ctx, digest, resp.TorrentBase64, resp.FilePath)
+	err := p.torrentHandler.DownloadTorrent(ctx, digest, resp.TorrentBase64, resp.FilePath,
+		p.layerRangeFetcher(resp.Located, resp.FilePath))
 
 	duration := time.Since(start)
 	details := map[string]interface{}{
@@ -0,0 +1,296 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/accesslog"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+const (
+	// redirectPathPrefix the path of proxy which the rewritten Location points to, it is followed by the
+	// token of redirected URL
+	redirectPathPrefix = "/_accelerboat/redirect/"
+	// redirectExpiration the redirected URLs are signed with short expiration by registries
+	redirectExpiration = 10 * time.Minute
+)
+
+// clientAddrKey the context key of the scheme and host which the client requested
+type clientAddrKey struct{}
+
+// isRedirectStatus returns whether the status code is a redirect with Location
+func isRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// handleBlobRedirect handles the redirect of blob response with the BlobRedirect mode of registry mapping,
+// the redirect is responded to client if passthrough
+func (p *upstreamProxy) handleBlobRedirect(resp *http.Response) error {
+	req := resp.Request
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || !isRedirectStatus(resp.StatusCode) {
+		return nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil
+	}
+	mp := p.op().FilterRegistryMapping(p.proxyHost, p.proxyType)
+	if mp == nil || mp.BlobRedirect == options.BlobRedirectPassthrough {
+		return nil
+	}
+	_, digest, isGetBlob := utils.IsBlobGet(strings.TrimPrefix(req.URL.Path, mp.OriginalPathPrefix()))
+	if !isGetBlob {
+		return nil
+	}
+	target, err := req.URL.Parse(location)
+	if err != nil {
+		return errors.Wrapf(err, "parse redirect location '%s' failed", location)
+	}
+	ctx := req.Context()
+	switch mp.BlobRedirect {
+	case options.BlobRedirectFollow:
+		if err = p.followBlobRedirect(resp, target, digest); err != nil {
+			metrics.RegistryRequestsTotal.WithLabelValues(p.originalHost, "blob_redirect", "error").Inc()
+			return err
+		}
+		logger.InfoContextf(ctx, "blob redirect to '%s' followed, response code '%d'", target.Host,
+			resp.StatusCode)
+	case options.BlobRedirectRewrite:
+		clientAddr, _ := ctx.Value(clientAddrKey{}).(string)
+		if clientAddr == "" {
+			return nil
+		}
+		token, err := randomToken()
+		if err != nil {
+			return err
+		}
+		p.redirects.Set(token, target.String(), redirectExpiration)
+		newLocation := clientAddr + redirectPathPrefix + token
+		if p.proxyType == options.RegistryMirror {
+			newLocation += "?ns=" + url.QueryEscape(p.proxyHost)
+		}
+		resp.Header.Set("Location", newLocation)
+		logger.InfoContextf(ctx, "blob redirect to '%s' rewritten to proxy", target.Host)
+	}
+	metrics.RegistryRequestsTotal.WithLabelValues(p.originalHost, "blob_redirect", string(mp.BlobRedirect)).Inc()
+	return nil
+}
+
+// followBlobRedirect replaces the redirect response with the response of redirected URL. The full blob
+// is cached into local storage while streamed to client, unless the layer scan is enabled because the
+// blob is responded before it could be scanned.
+func (p *upstreamProxy) followBlobRedirect(resp *http.Response, target *url.URL, digest string) error {
+	req := resp.Request
+	ctx := req.Context()
+	// the signed URL carries its own credential, the Authorization of registry is not sent
+	redirectReq, err := http.NewRequestWithContext(ctx, req.Method, target.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "create redirect request failed")
+	}
+	if r := req.Header.Get("Range"); r != "" {
+		redirectReq.Header.Set("Range", r)
+	}
+	client := &http.Client{Transport: p.reverseProxy.Transport}
+	redirected, err := client.Do(redirectReq)
+	if err != nil {
+		return errors.Wrapf(err, "follow blob redirect to '%s' failed", target.Host)
+	}
+	_ = resp.Body.Close()
+	resp.StatusCode = redirected.StatusCode
+	resp.Status = redirected.Status
+	resp.Header = redirected.Header
+	resp.ContentLength = redirected.ContentLength
+	resp.Body = redirected.Body
+	if redirected.StatusCode == http.StatusOK && req.Method == http.MethodGet && !p.op().LayerScan.Enable {
+		resp.Body = p.newBlobCacheReader(ctx, redirected.Body, digest)
+	}
+	return nil
+}
+
+// serveBlobRedirect reverses the request of rewritten Location to the redirected URL
+func (p *upstreamProxy) serveBlobRedirect(ctx context.Context, rw http.ResponseWriter, req *http.Request,
+	token string) {
+	v, ok := p.redirects.Get(token)
+	if !ok {
+		http.Error(rw, fmt.Sprintf("redirect '%s' not found or expired", token), http.StatusNotFound)
+		return
+	}
+	target, err := url.Parse(v.(string))
+	if err != nil {
+		p.httpError(ctx, rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rp := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL = target
+			r.Host = target.Host
+			r.Header.Del("Authorization")
+		},
+		Transport: p.reverseProxy.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			metrics.RecordError(metrics.ComponentReverseProxy, "blob_redirect")
+			logger.ErrorContextf(r.Context(), "reverse blob redirect to '%s' failed: %s", target.Host,
+				err.Error())
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	rp.ServeHTTP(rw, req.WithContext(ctx))
+}
+
+// blobCacheReader writes the blob streamed to client into the download path, the file is moved to the
+// static path if the blob is fully read and matches the digest
+type blobCacheReader struct {
+	ctx    context.Context
+	body   io.ReadCloser
+	file   *os.File
+	hasher hash.Hash
+	digest string
+	size   int64
+}
+
+func (p *upstreamProxy) newBlobCacheReader(ctx context.Context, body io.ReadCloser, digest string) io.ReadCloser {
+	op := p.op()
+	layerName := utils.LayerFileName(digest)
+	if fi, _ := p.checkLocalLayer(digest); fi != nil {
+		return body
+	}
+	tmpPath := path.Join(op.StorageConfig.DownloadPath, fmt.Sprintf("%s.redirect-%d", layerName,
+		time.Now().UnixNano()))
+	f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, op.StorageConfig.FilePerm())
+	if err != nil {
+		logger.WarnContextf(ctx, "create blob cache file '%s' failed: %s", tmpPath, err.Error())
+		return body
+	}
+	return &blobCacheReader{
+		ctx:    ctx,
+		body:   body,
+		file:   f,
+		hasher: sha256.New(),
+		digest: digest,
+	}
+}
+
+func (r *blobCacheReader) Read(bs []byte) (int, error) {
+	n, err := r.body.Read(bs)
+	if n > 0 && r.file != nil {
+		if _, werr := r.file.Write(bs[:n]); werr != nil {
+			logger.WarnContextf(r.ctx, "write blob cache file failed: %s", werr.Error())
+			r.discard()
+		} else {
+			r.hasher.Write(bs[:n])
+			r.size += int64(n)
+		}
+	}
+	if err == io.EOF && r.file != nil {
+		r.complete()
+	}
+	return n, err
+}
+
+func (r *blobCacheReader) Close() error {
+	if r.file != nil {
+		r.discard()
+	}
+	return r.body.Close()
+}
+
+// complete moves the fully read blob into the static path, it is registered by the static files watcher
+func (r *blobCacheReader) complete() {
+	tmpPath := r.file.Name()
+	_ = r.file.Close()
+	r.file = nil
+	if actual := hex.EncodeToString(r.hasher.Sum(nil)); actual != strings.TrimPrefix(r.digest, "sha256:") {
+		logger.WarnContextf(r.ctx, "redirected blob digest '%s' not same as expected '%s'", actual, r.digest)
+		_ = os.Remove(tmpPath)
+		return
+	}
+	op := options.GlobalOptions()
+	destDir := op.StorageConfig.TransferPath
+	if r.size < options.TwentyMB {
+		destDir = op.StorageConfig.SmallFilePath
+	}
+	destPath := path.Join(destDir, utils.LayerFileName(r.digest))
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		logger.WarnContextf(r.ctx, "rename blob cache file to '%s' failed: %s", destPath, err.Error())
+		_ = os.Remove(tmpPath)
+		return
+	}
+	logger.InfoContextf(r.ctx, "redirected blob cached to '%s', size %d", destPath, r.size)
+}
+
+func (r *blobCacheReader) discard() {
+	tmpPath := r.file.Name()
+	_ = r.file.Close()
+	r.file = nil
+	_ = os.Remove(tmpPath)
+}
+
+func randomToken() (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", errors.Wrapf(err, "generate random token failed")
+	}
+	return hex.EncodeToString(bs), nil
+}
+
+// clientRedirectURL returns the signed URL of the holder node to redirect the client, returns empty if
+// the client redirect is not enabled or the layer is small or located on this node
+func (p *upstreamProxy) clientRedirectURL(req *http.Request, layerResp *apitypes.DownloadLayerResponse,
+	digest string) string {
+	op := p.op()
+	conf := op.ClientRedirect
+	if !conf.Enable || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+		return ""
+	}
+	if layerResp.Located == "" || layerResp.Located == op.Address || layerResp.FilePath == "" ||
+		layerResp.FileSize < conf.MinSize*options.MB {
+		return ""
+	}
+	expires := time.Now().Add(time.Duration(conf.Expiration) * time.Second).Unix()
+	query := url.Values{
+		"digest":    []string{digest},
+		"file":      []string{layerResp.FilePath},
+		"expires":   []string{strconv.FormatInt(expires, 10)},
+		"signature": []string{utils.SignBlob(conf.Secret, digest, layerResp.FilePath, expires)},
+	}
+	return fmt.Sprintf("http://%s:%d%s?%s", layerResp.Located, op.HTTPPort, apitypes.APIRedirectBlob,
+		query.Encode())
+}
+
+// respondClientRedirect responds 307 to client with the signed URL of holder node
+func (p *upstreamProxy) respondClientRedirect(ctx context.Context, rw http.ResponseWriter, location string) {
+	logger.InfoContextf(ctx, "redirect client to the holder of blob: %s", location)
+	accesslog.SetCacheOutcome(ctx, accesslog.CacheRedirect)
+	p.recordBlobOutcome(blobOutcomeClientRedirect)
+	rw.Header().Set("Location", location)
+	rw.WriteHeader(http.StatusTemporaryRedirect)
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/bittorrent"
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+// ReloadedProxy defines the upstream proxy reloaded for the changes of options
+type ReloadedProxy struct {
+	ProxyType options.ProxyType `json:"proxyType"`
+	ProxyHost string            `json:"proxyHost"`
+	// Action is 'recreated' or 'removed'
+	Action string `json:"action"`
+	// Carried the in-flight layer fetching, upload sessions and redirects are carried to the new proxy
+	Carried bool `json:"carried"`
+}
+
+// ReloadUpstreamProxies re-creates the created proxies whose registry mapping changed, all the proxies are
+// re-created if the http proxy changed because the reverse proxy is dialed by it. The proxies not affected
+// are kept. The replaced proxy keeps serving the requests it already handling, and its layer fetching,
+// upload sessions and redirects are carried to the new proxy if the original host not changed, so the
+// active downloads are not dropped.
+func ReloadUpstreamProxies(prev, cur *options.AccelerBoatOption,
+	torrentHandler *bittorrent.TorrentHandler) []*ReloadedProxy {
+	httpProxyChanged := prev.ExternalConfig.HTTPProxy != cur.ExternalConfig.HTTPProxy
+	createLock.Lock()
+	defer createLock.Unlock()
+	result := make([]*ReloadedProxy, 0)
+	proxies.Range(func(key, value any) bool {
+		pk := key.(string)
+		typ, host, ok := strings.Cut(pk, "_")
+		if !ok {
+			return true
+		}
+		proxyType := options.ProxyType(typ)
+		prevMapping := prev.FilterRegistryMapping(host, proxyType)
+		curMapping := cur.FilterRegistryMapping(host, proxyType)
+		old, isUpstream := value.(*upstreamProxy)
+		if reflect.DeepEqual(prevMapping, curMapping) && !(httpProxyChanged && isUpstream) {
+			return true
+		}
+		rp := &ReloadedProxy{ProxyType: proxyType, ProxyHost: host}
+		result = append(result, rp)
+		if curMapping == nil {
+			rp.Action = "removed"
+			proxies.Delete(pk)
+			logger.Infof("upstream proxy '%s' removed because its registry mapping deleted", pk)
+			return true
+		}
+		rp.Action = "recreated"
+		created := createUpstreamProxy(proxyType, host, curMapping, torrentHandler)
+		if np, ok := created.(*upstreamProxy); ok && isUpstream && np.originalHost == old.originalHost {
+			np.carryState(old, !httpProxyChanged)
+			rp.Carried = true
+		}
+		proxies.Store(pk, created)
+		logger.Infof("upstream proxy '%s' re-created, carried state: %t", pk, rp.Carried)
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ProxyType != result[j].ProxyType {
+			return result[i].ProxyType < result[j].ProxyType
+		}
+		return result[i].ProxyHost < result[j].ProxyHost
+	})
+	return result
+}
+
+// carryState shares the state of old proxy with the new one, the concurrent fetching of the same layer on
+// both proxies is still deduplicated. The upload sessions are not carried if the http proxy changed, their
+// transports are dialed by the old http proxy and the sessions are pinned again.
+func (p *upstreamProxy) carryState(old *upstreamProxy, withUploads bool) {
+	p.layerFlight = old.layerFlight
+	p.layerFlightCtx = old.layerFlightCtx
+	p.artifactBlobs = old.artifactBlobs
+	p.redirects = old.redirects
+	p.authorized = old.authorized
+	if withUploads {
+		p.uploads = old.uploads
+	}
+}
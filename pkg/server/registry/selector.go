@@ -0,0 +1,321 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/bittorrent"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/watchdog"
+)
+
+// transferMethod defines the method to transfer layer between nodes
+type transferMethod string
+
+const (
+	transferTorrent transferMethod = "torrent"
+	transferTCP     transferMethod = "tcp"
+	// transferRace downloads with torrent and tcp at the same time, the first completed wins
+	transferRace transferMethod = "race"
+	// transferHedge downloads with torrent, and starts tcp at the same time if torrent is slow
+	transferHedge transferMethod = "hedge"
+	// transferMultiSource downloads the chunks of layer from multiple nodes with tcp in parallel
+	transferMultiSource transferMethod = "multi_source"
+
+	// throughputDecay the weight of history when observing the new throughput
+	throughputDecay = 0.7
+	// throughputMargin the method is chosen only when its throughput exceeds the other by the margin
+	throughputMargin = 1.2
+)
+
+// throughputStats holds the moving average of observed throughput (bytes/s) of transfer methods
+type throughputStats struct {
+	sync.RWMutex
+	values map[transferMethod]float64
+}
+
+var transferThroughput = &throughputStats{values: make(map[transferMethod]float64)}
+
+func (s *throughputStats) observe(method transferMethod, size int64, duration time.Duration) {
+	if size <= 0 || duration <= 0 {
+		return
+	}
+	current := float64(size) / duration.Seconds()
+	s.Lock()
+	defer s.Unlock()
+	if prev, ok := s.values[method]; ok {
+		current = throughputDecay*prev + (1-throughputDecay)*current
+	}
+	s.values[method] = current
+}
+
+func (s *throughputStats) get(method transferMethod) (float64, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	v, ok := s.values[method]
+	return v, ok
+}
+
+// selectTransferMethod chooses the transfer method of layer. The mid-size layer cached on multiple nodes is
+// downloaded from them in parallel if multi-source enabled. TCP is used if the layer not have torrent or
+// the seeders are too few, otherwise the faster method by recent throughput is used. The methods are
+// raced if the throughput of any method is not observed yet.
+func (p *upstreamProxy) selectTransferMethod(ctx context.Context, resp *apitypes.DownloadLayerResponse,
+	digest string) transferMethod {
+	method := p.handleSelectTransferMethod(ctx, resp, digest)
+	metrics.TransferMethodSelectedTotal.WithLabelValues(string(method)).Inc()
+	return method
+}
+
+func (p *upstreamProxy) handleSelectTransferMethod(ctx context.Context, resp *apitypes.DownloadLayerResponse,
+	digest string) transferMethod {
+	if p.useMultiSource(ctx, resp, digest) {
+		return transferMultiSource
+	}
+	if resp.TorrentBase64 == "" {
+		return transferTCP
+	}
+	if seeders := p.countSeeders(ctx, digest); seeders < p.op().TorrentConfig.MinSeeders {
+		logger.InfoContextf(ctx, "layer only have %d seeders, less than %d and choose tcp", seeders,
+			p.op().TorrentConfig.MinSeeders)
+		return transferTCP
+	}
+	torrentRate, torrentOK := transferThroughput.get(transferTorrent)
+	tcpRate, tcpOK := transferThroughput.get(transferTCP)
+	if !torrentOK || !tcpOK {
+		return transferRace
+	}
+	if tcpRate > torrentRate*throughputMargin {
+		logger.InfoContextf(ctx, "tcp throughput %.0fB/s is faster than torrent %.0fB/s and choose tcp",
+			tcpRate, torrentRate)
+		return transferTCP
+	}
+	if hedge := p.op().TorrentConfig.Hedge; hedge.Enable && resp.FileSize >= hedge.Threshold*options.MB {
+		return transferHedge
+	}
+	return transferTorrent
+}
+
+// countSeeders returns the number of nodes which have the layer in cache store
+func (p *upstreamProxy) countSeeders(ctx context.Context, digest string) int {
+	staticLayers, ociLayers, err := p.cacheStore.QueryLayers(ctx, digest)
+	if err != nil {
+		logger.WarnContextf(ctx, "query layer seeders failed: %s", err.Error())
+		return 0
+	}
+	nodes := make(map[string]struct{})
+	for _, layer := range append(staticLayers, ociLayers...) {
+		nodes[layer.Located] = struct{}{}
+	}
+	return len(nodes)
+}
+
+// downloadWithMethod downloads the layer with the method, the throughput is observed if success. The
+// download is watched by watchdog and aborted if it stalled.
+func (p *upstreamProxy) downloadWithMethod(ctx context.Context, method transferMethod,
+	resp *apitypes.DownloadLayerResponse, repo, digest string) error {
+	start := time.Now()
+	var err error
+	switch method {
+	case transferTorrent:
+		watchCtx, stop := watchdog.Watch(ctx, string(method), digest, func() int64 {
+			return p.transferProgress(method, resp, digest)
+		})
+		err = p.recorderWrapDownloadBlobByTorrent(watchCtx, resp, repo, digest)
+		err = stalledError(watchCtx, err)
+		stop()
+	case transferMultiSource:
+		var written atomic.Int64
+		watchCtx, stop := watchdog.Watch(ctx, string(method), digest, written.Load)
+		err = p.downloadByMultiSource(watchCtx, resp, digest, &written)
+		err = stalledError(watchCtx, err)
+		stop()
+	default:
+		watchCtx, stop := watchdog.Watch(ctx, string(transferTCP), digest, func() int64 {
+			return p.transferProgress(transferTCP, resp, digest)
+		})
+		err = p.recorderWrapDownloadBlobByTCP(watchCtx, resp, repo, digest)
+		err = stalledError(watchCtx, err)
+		stop()
+	}
+	if err == nil {
+		transferThroughput.observe(method, resp.FileSize, time.Since(start))
+	}
+	return err
+}
+
+// transferProgress returns the bytes transferred of the layer downloading with torrent or tcp
+func (p *upstreamProxy) transferProgress(method transferMethod, resp *apitypes.DownloadLayerResponse,
+	digest string) int64 {
+	if method == transferTorrent {
+		completed, _ := p.torrentHandler.TorrentProgress(resp.TorrentBase64)
+		return completed
+	}
+	if fi, err := os.Stat(p.tcpPartFile(digest)); err == nil {
+		return fi.Size()
+	}
+	return 0
+}
+
+// stalledError returns the cause of watchdog if the download is aborted by it
+func stalledError(watchCtx context.Context, err error) error {
+	if err != nil && watchdog.IsStalled(watchCtx, err) {
+		return errors.Wrapf(context.Cause(watchCtx), "download aborted")
+	}
+	return err
+}
+
+// raceGate commits the first completed download of the racing methods, the others are canceled after
+// the winner committed so that they never overwrite the layer of winner
+type raceGate struct {
+	sync.Mutex
+	winner  transferMethod
+	cancels map[transferMethod]context.CancelFunc
+	// onCommit is called with the winner before the others are canceled
+	onCommit func(winner transferMethod)
+}
+
+func newRaceGate() *raceGate {
+	return &raceGate{cancels: make(map[transferMethod]context.CancelFunc)}
+}
+
+// start returns the context of the racing method, the layer downloaded is put into target path only
+// if the method committed
+func (g *raceGate) start(ctx context.Context, method transferMethod) context.Context {
+	methodCtx, cancel := context.WithCancel(ctx)
+	g.Lock()
+	g.cancels[method] = cancel
+	g.Unlock()
+	return bittorrent.WithLinkGate(methodCtx, func() bool { return g.commit(method) })
+}
+
+// commit returns whether the method wins, the other methods are canceled if it wins
+func (g *raceGate) commit(method transferMethod) bool {
+	g.Lock()
+	defer g.Unlock()
+	if g.winner != "" {
+		return g.winner == method
+	}
+	g.winner = method
+	if g.onCommit != nil {
+		g.onCommit(method)
+	}
+	for m, cancel := range g.cancels {
+		if m != method {
+			cancel()
+		}
+	}
+	return true
+}
+
+// stop cancels all the racing methods
+func (g *raceGate) stop() {
+	g.Lock()
+	defer g.Unlock()
+	for _, cancel := range g.cancels {
+		cancel()
+	}
+}
+
+type raceResult struct {
+	method transferMethod
+	err    error
+}
+
+// raceLayerDownload downloads the layer with torrent and tcp at the same time, the loser is canceled
+// once the first completed is committed into target path. The throughput of loser is observed with the
+// bytes it transferred, so the methods are not raced again once both observed. The method which won is
+// returned.
+func (p *upstreamProxy) raceLayerDownload(ctx context.Context, resp *apitypes.DownloadLayerResponse,
+	repo, digest string) (transferMethod, error) {
+	gate := newRaceGate()
+	defer gate.stop()
+	methods := []transferMethod{transferTorrent, transferTCP}
+	start := time.Now()
+	gate.onCommit = func(winner transferMethod) {
+		for _, method := range methods {
+			if method == winner {
+				continue
+			}
+			// the loser transferred nothing is observed with the lowest throughput
+			transferred := max(p.transferProgress(method, resp, digest), 1)
+			transferThroughput.observe(method, transferred, time.Since(start))
+		}
+	}
+	resultCh := make(chan raceResult, len(methods))
+	for _, method := range methods {
+		raceCtx := gate.start(ctx, method)
+		go func(method transferMethod) {
+			resultCh <- raceResult{method: method, err: p.downloadWithMethod(raceCtx, method, resp, repo, digest)}
+		}(method)
+	}
+	errs := make([]string, 0, len(methods))
+	for range methods {
+		result := <-resultCh
+		if result.err == nil {
+			logger.InfoContextf(ctx, "download layer race won by %s", result.method)
+			return result.method, nil
+		}
+		errs = append(errs, string(result.method)+": "+result.err.Error())
+	}
+	return "", errors.Errorf("download layer race failed: %s", strings.Join(errs, "; "))
+}
+
+// hedgeLayerDownload downloads the layer with torrent, and starts the tcp transfer at the same time if
+// the torrent progress is not sufficient after the hedge delay. The loser is canceled, and the method which
+// won is returned.
+func (p *upstreamProxy) hedgeLayerDownload(ctx context.Context, resp *apitypes.DownloadLayerResponse,
+	repo, digest string) (transferMethod, error) {
+	hedge := p.op().TorrentConfig.Hedge
+	gate := newRaceGate()
+	defer gate.stop()
+	resultCh := make(chan raceResult, 2)
+	startDownload := func(method transferMethod) {
+		hedgeCtx := gate.start(ctx, method)
+		go func() {
+			resultCh <- raceResult{method: method, err: p.downloadWithMethod(hedgeCtx, method, resp, repo, digest)}
+		}()
+	}
+	startDownload(transferTorrent)
+	running := 1
+	timer := time.NewTimer(time.Duration(hedge.Delay) * time.Second)
+	defer timer.Stop()
+	errs := make([]string, 0, 2)
+	for running > 0 {
+		select {
+		case <-timer.C:
+			completed, total := p.torrentHandler.TorrentProgress(resp.TorrentBase64)
+			if total > 0 && completed*100 >= total*hedge.MinProgress {
+				logger.InfoContextf(ctx, "torrent progress %d/%d is sufficient after %ds, not hedge",
+					completed, total, hedge.Delay)
+				continue
+			}
+			logger.InfoContextf(ctx, "torrent progress %d/%d is not sufficient after %ds, start hedged tcp",
+				completed, total, hedge.Delay)
+			metrics.TransferMethodSelectedTotal.WithLabelValues("hedged_tcp").Inc()
+			startDownload(transferTCP)
+			running++
+		case result := <-resultCh:
+			running--
+			if result.err == nil {
+				logger.InfoContextf(ctx, "download layer hedge won by %s", result.method)
+				return result.method, nil
+			}
+			errs = append(errs, string(result.method)+": "+result.err.Error())
+		}
+	}
+	return "", errors.Errorf("download layer hedge failed: %s", strings.Join(errs, "; "))
+}
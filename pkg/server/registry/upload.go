@@ -0,0 +1,222 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+// uploadSessions pins the blob upload sessions to the upstream addresses resolved when they started
+type uploadSessions struct {
+	registry string
+	// sessions the upstream address of session uuid, it expires if the session is idle
+	sessions *cache.Cache
+	// transports the transport of upstream address, the connections are only dialed to the address
+	transports sync.Map
+}
+
+func newUploadSessions(registry string) *uploadSessions {
+	us := &uploadSessions{
+		registry: registry,
+		sessions: cache.New(time.Hour, time.Minute),
+	}
+	us.sessions.OnEvicted(func(string, interface{}) {
+		us.updateMetrics()
+	})
+	return us
+}
+
+// get returns the pinned address of session, and refreshes its expiration
+func (us *uploadSessions) get(session string, timeout time.Duration) string {
+	v, ok := us.sessions.Get(session)
+	if !ok {
+		return ""
+	}
+	addr := v.(string)
+	us.sessions.Set(session, addr, timeout)
+	return addr
+}
+
+func (us *uploadSessions) pin(session, addr string, timeout time.Duration) {
+	us.sessions.Set(session, addr, timeout)
+	us.updateMetrics()
+}
+
+func (us *uploadSessions) forget(session string) {
+	us.sessions.Delete(session)
+}
+
+func (us *uploadSessions) updateMetrics() {
+	metrics.BlobUploadSessions.WithLabelValues(us.registry).Set(float64(us.sessions.ItemCount()))
+}
+
+// resolve returns one of the addresses of upstream host, returns empty if any proxy(of registry mapping,
+// global or environment) applies to the upstream because it is dialed by the proxy
+func (us *uploadSessions) resolve(ctx context.Context, op *options.AccelerBoatOption, u *url.URL) (string, error) {
+	proxyURL, err := op.HTTPProxyTransport().(*http.Transport).Proxy(&http.Request{URL: u})
+	if err != nil || proxyURL != nil {
+		return "", nil
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	ips, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+	if err != nil {
+		return "", errors.Wrapf(err, "resolve upstream '%s' failed", u.Hostname())
+	}
+	if len(ips) == 0 {
+		return "", errors.Errorf("resolve upstream '%s' got no address", u.Hostname())
+	}
+	return net.JoinHostPort(ips[rand.Intn(len(ips))], port), nil
+}
+
+// transport returns the transport which only dials to addr, the tls server name is still the request host
+func (us *uploadSessions) transport(op *options.AccelerBoatOption, addr string) http.RoundTripper {
+	if v, ok := us.transports.Load(addr); ok {
+		return v.(http.RoundTripper)
+	}
+	tp := op.HTTPProxyTransport().(*http.Transport)
+	if addr != "" {
+		dialer := &net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		tp.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	v, _ := us.transports.LoadOrStore(addr, tp)
+	return v.(http.RoundTripper)
+}
+
+// countReader counts the bytes read from request body
+type countReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// handleBlobUpload streams the blob upload request to the upstream address of its session without
+// buffering, the session is pinned when the upstream responds the Location of it. The client address is
+// the scheme and host which the client requested, the Location is rewritten to it.
+func (p *upstreamProxy) handleBlobUpload(ctx context.Context, rw http.ResponseWriter, req *http.Request,
+	session, clientAddr string) {
+	op := p.op()
+	timeout := time.Duration(op.BlobUpload.SessionTimeout) * time.Second
+	sessionLabel := "session"
+	var addr string
+	if session == "" {
+		sessionLabel = "start"
+	} else {
+		addr = p.uploads.get(session, timeout)
+	}
+	if addr == "" {
+		var err error
+		if addr, err = p.uploads.resolve(ctx, op, req.URL); err != nil {
+			metrics.RecordError(metrics.ComponentReverseProxy, "blob_upload")
+			p.httpError(ctx, rw, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if session != "" {
+			// the session started before restart or expired, the registry may still accept it
+			logger.WarnContextf(ctx, "blob upload session '%s' not pinned, pin to '%s'", session, addr)
+			p.uploads.pin(session, addr, timeout)
+		}
+	}
+	body := &countReader{ReadCloser: http.NoBody}
+	if req.Body != nil && req.Body != http.NoBody {
+		body.ReadCloser = req.Body
+		req.Body = body
+	}
+	rp := &httputil.ReverseProxy{
+		Director:      func(*http.Request) {},
+		Transport:     p.uploads.transport(op, addr),
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			metrics.RecordError(metrics.ComponentReverseProxy, "blob_upload")
+			metrics.BlobUploadRequestsTotal.WithLabelValues(p.originalHost, sessionLabel, r.Method,
+				strconv.Itoa(http.StatusBadGateway)).Inc()
+			logger.ErrorContextf(r.Context(), "blob upload '%s, %s' to '%s' failed: %s", r.Method,
+				r.URL.Path, addr, err.Error())
+			w.WriteHeader(http.StatusBadGateway)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			metrics.BlobUploadRequestsTotal.WithLabelValues(p.originalHost, sessionLabel, req.Method,
+				strconv.Itoa(resp.StatusCode)).Inc()
+			utils.ChangeAuthenticateHeader(resp, p.authRealmAddr(clientAddr), p.authRealmNamespace())
+			if location := resp.Header.Get("Location"); location != "" {
+				newLocation, locationSession := p.rewriteUploadLocation(location, clientAddr)
+				resp.Header.Set("Location", newLocation)
+				if locationSession != "" {
+					p.uploads.pin(locationSession, addr, timeout)
+				}
+			}
+			// the upload is completed or canceled
+			if session != "" && (resp.StatusCode == http.StatusCreated ||
+				(req.Method == http.MethodDelete && resp.StatusCode < http.StatusMultipleChoices)) {
+				p.uploads.forget(session)
+			}
+			logger.InfoContextf(ctx, "blob upload '%s, %s' to '%s' response code '%d'", req.Method,
+				req.URL.Path, addr, resp.StatusCode)
+			return nil
+		},
+	}
+	rp.ServeHTTP(rw, req.WithContext(ctx))
+	metrics.BlobUploadBytesTotal.WithLabelValues(p.originalHost).Add(float64(body.n.Load()))
+}
+
+// rewriteUploadLocation rewrites the Location of original registry to the client address, and returns
+// the session uuid if the Location is an upload session. The Location of other hosts(e.g. the storage
+// backend) is not rewritten.
+func (p *upstreamProxy) rewriteUploadLocation(location, clientAddr string) (string, string) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location, ""
+	}
+	if u.Host != "" && u.Host != p.proxyRegistry.OriginalHostname() {
+		return location, ""
+	}
+	target, err := url.Parse(clientAddr)
+	if err != nil {
+		return location, ""
+	}
+	u.Scheme, u.Host = target.Scheme, target.Host
+	if prefix := p.proxyRegistry.OriginalPathPrefix(); prefix != "" {
+		u.Path = strings.TrimPrefix(u.Path, prefix)
+		u.RawPath = ""
+	}
+	if p.proxyType == options.RegistryMirror {
+		query := u.Query()
+		query.Set("ns", p.proxyHost)
+		u.RawQuery = query.Encode()
+	}
+	_, session, _ := utils.IsBlobUpload(u.Path)
+	return u.String(), session
+}
@@ -0,0 +1,149 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/server/registry"
+)
+
+// reloadComponent defines the component reloaded when its options changed, the components not affected
+// are kept running
+type reloadComponent struct {
+	name string
+	// fields the top-level options handled by the component
+	fields []string
+	// changed returns whether the component should be reloaded
+	changed func(prev, cur *options.AccelerBoatOption) bool
+	// apply reloads the component, returns the details of reloaded
+	apply func(ctx context.Context, changes *options.OptionChanges) interface{}
+}
+
+// lifecycleManager diffs the changes of options and reloads the affected components only
+type lifecycleManager struct {
+	components []*reloadComponent
+}
+
+func (s *AccelerboatServer) newLifecycleManager() *lifecycleManager {
+	return &lifecycleManager{
+		components: []*reloadComponent{
+			{
+				// the torrent client is kept, only its rate limits are applied
+				name:   "torrent_limits",
+				fields: []string{"torrentConfig"},
+				changed: func(prev, cur *options.AccelerBoatOption) bool {
+					return prev.TorrentConfig.UploadLimit != cur.TorrentConfig.UploadLimit ||
+						prev.TorrentConfig.DownloadLimit != cur.TorrentConfig.DownloadLimit
+				},
+				apply: func(_ context.Context, _ *options.OptionChanges) interface{} {
+					s.torrentHandler.ApplyConfigLimits()
+					return nil
+				},
+			},
+			{
+				name:   "recorder",
+				fields: []string{"recorder"},
+				changed: func(prev, cur *options.AccelerBoatOption) bool {
+					return prev.Recorder != cur.Recorder
+				},
+				apply: func(_ context.Context, changes *options.OptionChanges) interface{} {
+					conf := changes.Current.Recorder
+					recorder.Global.Resize(conf.BufferSize)
+					recorder.Global.ApplyFileConfig(recorderFileConfig(&conf))
+					return conf
+				},
+			},
+			{
+				name:   "upstream_proxies",
+				fields: []string{"externalConfig"},
+				changed: func(prev, cur *options.AccelerBoatOption) bool {
+					return prev.ExternalConfig.HTTPProxy != cur.ExternalConfig.HTTPProxy ||
+						!reflect.DeepEqual(prev.ExternalConfig.RegistryMappings, cur.ExternalConfig.RegistryMappings)
+				},
+				apply: func(_ context.Context, changes *options.OptionChanges) interface{} {
+					return registry.ReloadUpstreamProxies(changes.Prev, changes.Current, s.torrentHandler)
+				},
+			},
+		},
+	}
+}
+
+// handle reloads the components affected by the changes, and records what was reloaded
+func (m *lifecycleManager) handle(ctx context.Context, changes *options.OptionChanges) {
+	changedFields := diffOptionFields(changes.Prev, changes.Current)
+	if len(changedFields) == 0 {
+		return
+	}
+	handled := make(map[string]struct{})
+	reloaded := make(map[string]interface{})
+	names := make([]string, 0, len(m.components))
+	for _, c := range m.components {
+		if !c.changed(changes.Prev, changes.Current) {
+			continue
+		}
+		for _, f := range c.fields {
+			handled[f] = struct{}{}
+		}
+		reloaded[c.name] = c.apply(ctx, changes)
+		names = append(names, c.name)
+		logger.InfoContextf(ctx, "component '%s' reloaded", c.name)
+	}
+	// only the rebuilt components are reported, the other changes take effect after restart
+	restartRequired := make([]string, 0)
+	for _, f := range changedFields {
+		if _, ok := handled[f]; !ok {
+			restartRequired = append(restartRequired, f)
+		}
+	}
+	status := recorder.Normal
+	message := fmt.Sprintf("Config reloaded, components: [%s]", strings.Join(names, ", "))
+	if len(restartRequired) != 0 {
+		status = recorder.Warning
+		message += fmt.Sprintf(", restart required for: [%s]", strings.Join(restartRequired, ", "))
+		logger.WarnContextf(ctx, "changed options require restart to take effect: %v", restartRequired)
+	}
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeConfigReloaded,
+		EventStatus: status,
+		Details: map[string]interface{}{
+			"changed": changedFields, "reloaded": reloaded, "restartRequired": restartRequired,
+		},
+		Message: message,
+	})
+}
+
+// diffOptionFields returns the json names of top-level options changed
+func diffOptionFields(prev, cur *options.AccelerBoatOption) []string {
+	result := make([]string, 0)
+	pv, cv := reflect.ValueOf(prev).Elem(), reflect.ValueOf(cur).Elem()
+	t := pv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(pv.Field(i).Interface(), cv.Field(i).Interface()) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// recorderFileConfig returns the rotation of event file from the recorder config
+func recorderFileConfig(conf *options.RecorderConfig) recorder.FileConfig {
+	return recorder.FileConfig{
+		MaxSizeMB:  conf.MaxSizeMB,
+		MaxBackups: conf.MaxBackups,
+		MaxAgeDays: conf.RetentionDays,
+	}
+}
@@ -7,8 +7,10 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	syserrors "errors"
 	"fmt"
+	"net"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -18,26 +20,46 @@ import (
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/netutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/accesslog"
+	"github.com/penglongli/accelerboat/pkg/bandwidth"
 	"github.com/penglongli/accelerboat/pkg/bittorrent"
 	"github.com/penglongli/accelerboat/pkg/cleaner"
+	"github.com/penglongli/accelerboat/pkg/clientquota"
+	"github.com/penglongli/accelerboat/pkg/estargz"
+	"github.com/penglongli/accelerboat/pkg/failover"
+	"github.com/penglongli/accelerboat/pkg/federation"
+	"github.com/penglongli/accelerboat/pkg/integrity"
+	"github.com/penglongli/accelerboat/pkg/loadsignal"
 	"github.com/penglongli/accelerboat/pkg/logger"
 	"github.com/penglongli/accelerboat/pkg/metrics"
 	"github.com/penglongli/accelerboat/pkg/ociscan"
+	"github.com/penglongli/accelerboat/pkg/peertls"
+	"github.com/penglongli/accelerboat/pkg/podidentity"
+	"github.com/penglongli/accelerboat/pkg/preheat"
+	"github.com/penglongli/accelerboat/pkg/pullsecret"
 	"github.com/penglongli/accelerboat/pkg/recorder"
+	"github.com/penglongli/accelerboat/pkg/savings"
 	"github.com/penglongli/accelerboat/pkg/server/common"
 	"github.com/penglongli/accelerboat/pkg/server/customapi"
 	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
 	"github.com/penglongli/accelerboat/pkg/server/middleware"
 	"github.com/penglongli/accelerboat/pkg/server/registry"
 	"github.com/penglongli/accelerboat/pkg/staticwatcher"
+	"github.com/penglongli/accelerboat/pkg/store"
+	"github.com/penglongli/accelerboat/pkg/upstreamhealth"
+	"github.com/penglongli/accelerboat/pkg/utils"
+	"github.com/penglongli/accelerboat/pkg/version"
 )
 
 // AccelerboatServer defines the accelerboat server
 type AccelerboatServer struct {
-	op        *options.AccelerBoatOption
 	opWatcher options.OptionChangeWatcher
 
 	globalCtx    context.Context
@@ -46,24 +68,34 @@ type AccelerboatServer struct {
 	ginSvr      *gin.Engine
 	httpServer  *http.Server
 	httpSServer *http.Server
+	peerServer  *http.Server
+	// defaultCert the cert served to the HTTPS clients without SNI
+	defaultCert *x509.Certificate
 	ociScanner  *ociscan.ScanHandler
+	// clientVerifyCAs the pool of client verify CA, the certs of client quota CA are not trusted by it
+	clientVerifyCAs *x509.CertPool
+
+	customHandler *customapi.CustomHandler
 
 	torrentHandler *bittorrent.TorrentHandler
 	staticWatcher  *staticwatcher.StaticFilesWatcher
 }
 
 // NewAccelerboatServer create the instance of Accelerboat
-func NewAccelerboatServer(globalCtx context.Context, op *options.AccelerBoatOption,
-	opWatcher options.OptionChangeWatcher) *AccelerboatServer {
+func NewAccelerboatServer(globalCtx context.Context, opWatcher options.OptionChangeWatcher) *AccelerboatServer {
 	ctx, cancel := context.WithCancel(globalCtx)
 	return &AccelerboatServer{
-		op:           op,
 		opWatcher:    opWatcher,
 		globalCtx:    ctx,
 		globalCancel: cancel,
 	}
 }
 
+// op returns the current snapshot of options, the server lives across config reloads so it is not kept
+func (s *AccelerboatServer) op() *options.AccelerBoatOption {
+	return options.GlobalOptions()
+}
+
 func (s *AccelerboatServer) Init() error {
 	s.torrentHandler = bittorrent.NewTorrentHandler()
 	if err := s.torrentHandler.Init(); err != nil {
@@ -78,13 +110,25 @@ func (s *AccelerboatServer) Init() error {
 	if err := s.staticWatcher.Init(s.globalCtx); err != nil {
 		return err
 	}
-	if s.op.StorageConfig.EventFile != "" {
-		if err := recorder.Global.InitEventFile(s.op.StorageConfig.EventFile, recorder.DefaultEventFileMaxSizeMB,
-			recorder.DefaultEventFileMaxBackups); err != nil {
+	recorder.Global.Resize(s.op().Recorder.BufferSize)
+	if s.op().StorageConfig.EventFile != "" {
+		if err := recorder.Global.InitEventFile(s.op().StorageConfig.EventFile,
+			recorderFileConfig(&s.op().Recorder)); err != nil {
 			return err
 		}
-		logger.Infof("event file sink enabled: %s (rotate at 1GB, keep %d backups)", s.op.StorageConfig.EventFile,
-			recorder.DefaultEventFileMaxBackups)
+		logger.Infof("event file sink enabled: %s (rotate at %dMB, keep %d backups for %d days)",
+			s.op().StorageConfig.EventFile, s.op().Recorder.MaxSizeMB, s.op().Recorder.MaxBackups,
+			s.op().Recorder.RetentionDays)
+	}
+	if s.op().AccessLog.Enable {
+		accesslog.Global.Init(&s.op().AccessLog, &s.op().LogConfig)
+		logger.Infof("access log enabled: %s", s.op().AccessLog.Output)
+	}
+	if s.op().PeerTLS.Enable {
+		if err := peertls.Global.Init(&s.op().PeerTLS, s.op().Address); err != nil {
+			return errors.Wrapf(err, "init peer tls failed")
+		}
+		logger.Infof("peer tls enabled, layers are transferred on port %d", s.op().PeerTLS.Port)
 	}
 	s.initHTTPRouter()
 	return nil
@@ -92,25 +136,37 @@ func (s *AccelerboatServer) Init() error {
 
 func (s *AccelerboatServer) initHTTPRouter() {
 	ginSvr := gin.New()
-	ginSvr.Use(gin.Recovery())
+	ginSvr.Use(middleware.GinRecovery())
 	ginSvr.UseRawPath = true
 	gin.SetMode(gin.ReleaseMode)
 	ginSvr.Use(middleware.GinMiddleware())
+	ginSvr.Use(middleware.LimitRequestBody(s.op().APIValidation.MaxBodySize * 1024))
 	pprof.Register(ginSvr)
-	ginSvr.GET("/metrics", gin.WrapH(promhttp.Handler()))
-	ch := customapi.NewCustomHandler(s.op, s.torrentHandler, s.ociScanner)
+	// the exemplars are only exposed with the OpenMetrics format
+	ginSvr.GET("/metrics", gin.WrapH(promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))))
+	ch := customapi.NewCustomHandler(s.torrentHandler, s.ociScanner)
 	ch.Register(ginSvr)
+	s.customHandler = ch
 	s.ginSvr = ginSvr
 }
 
 func (s *AccelerboatServer) Run() error {
 	fs := []func(errCh chan error){s.runHTTPServer, s.runHTTPSServer, s.runOCITickReporter,
-		s.runStaticFilesWatcher, s.runOptionFileWatcher, s.runDiskUsageUpdater}
+		s.runStaticFilesWatcher, s.runOptionFileWatcher, s.runDiskUsageUpdater, s.runBandwidthScheduler,
+		s.runPeerTLSServer, s.runTokenRefresher, s.runPullSecretWatcher,
+		s.runCacheStoreWriteBehind, s.runFederationPublisher, s.runInternalGRPCServer,
+		s.runPreheatController, s.runNodeHeartbeat, s.runIntegrityVerifier, s.runOCISeeder,
+		s.runOriginFailover, s.runPodIdentityInformer, s.runEstargzConverter, s.runSavingsAccumulator,
+		s.runLoadSignals, s.runUpstreamHealthProber}
+	if s.op().PeerTLS.Enable {
+		s.peerServer = s.newPeerServer()
+	}
 	errCh := make(chan error, len(fs))
 	for i := range fs {
 		go fs[i](errCh)
 	}
-	imageCleaner := cleaner.NewImageCleaner(s.op)
+	imageCleaner := cleaner.NewImageCleaner()
 	if err := imageCleaner.Init(); err != nil {
 		return errors.Wrapf(err, "failed to init image cleaner")
 	}
@@ -118,6 +174,9 @@ func (s *AccelerboatServer) Run() error {
 		<-s.globalCtx.Done()
 		s.httpServer.Shutdown(context.Background())
 		s.httpSServer.Shutdown(context.Background())
+		if s.peerServer != nil {
+			s.peerServer.Shutdown(context.Background())
+		}
 	}()
 	// for-loop wait every goroutine normal finish
 	for i := 0; i < len(fs); i++ {
@@ -133,13 +192,17 @@ func (s *AccelerboatServer) Run() error {
 
 func (s *AccelerboatServer) runHTTPServer(errCh chan error) {
 	defer logger.Warnf("http server exit")
-	serverAddr := fmt.Sprintf("0.0.0.0:%d", s.op.HTTPPort)
-	s.httpServer = &http.Server{
-		Addr:    serverAddr,
-		Handler: s,
+	serverAddr := fmt.Sprintf("0.0.0.0:%d", s.op().HTTPPort)
+	s.httpServer = s.newProxyServer(serverAddr, false)
+	lis, err := s.listenProxy(serverAddr)
+	if err != nil {
+		errCh <- err
+		logger.Errorf("failed to listen http server: %s", err.Error())
+		return
 	}
 	logger.Infof("http server listening on %s", serverAddr)
-	if err := s.httpServer.ListenAndServe(); err != nil && !syserrors.Is(err, http.ErrServerClosed) {
+	if err = s.httpServer.Serve(lis); err != nil && !syserrors.Is(err, http.ErrServerClosed) {
+		errCh <- err
 		logger.Errorf("failed to start http server: %s", err.Error())
 		return
 	}
@@ -148,9 +211,9 @@ func (s *AccelerboatServer) runHTTPServer(errCh chan error) {
 
 func (s *AccelerboatServer) runHTTPSServer(errCh chan error) {
 	defer logger.Warnf("http(s) server exit")
-	serverAddr := fmt.Sprintf("0.0.0.0:%d", s.op.HTTPSPort)
+	serverAddr := fmt.Sprintf("0.0.0.0:%d", s.op().HTTPSPort)
 	tlsCerts := make([]tls.Certificate, 0)
-	defaultCert := s.op.ExternalConfig.BuiltInCerts[options.LocalhostCert]
+	defaultCert := s.op().ExternalConfig.BuiltInCerts[options.LocalhostCert]
 	if defaultCert == nil {
 		errCh <- fmt.Errorf("not have default 'localhost' tls cert")
 		return
@@ -161,7 +224,8 @@ func (s *AccelerboatServer) runHTTPSServer(errCh chan error) {
 		return
 	}
 	tlsCerts = append(tlsCerts, defaultKeyPair)
-	for _, mp := range s.op.ExternalConfig.RegistryMappings {
+	s.defaultCert = defaultKeyPair.Leaf
+	for _, mp := range s.op().ExternalConfig.RegistryMappings {
 		if mp.ProxyCert == "" || mp.ProxyKey == "" {
 			continue
 		}
@@ -174,15 +238,19 @@ func (s *AccelerboatServer) runHTTPSServer(errCh chan error) {
 		logger.Infof("load tls cert, host: %s, original: %s", mp.ProxyHost, mp.OriginalHost)
 		tlsCerts = append(tlsCerts, kp)
 	}
-	s.httpSServer = &http.Server{
-		Addr:    serverAddr,
-		Handler: s,
-		TLSConfig: &tls.Config{
-			Certificates: tlsCerts,
-		},
+	s.httpSServer = s.newProxyServer(serverAddr, true)
+	s.httpSServer.TLSConfig = &tls.Config{
+		Certificates: tlsCerts,
+	}
+	s.initClientVerify(s.httpSServer.TLSConfig)
+	lis, err := s.listenProxy(serverAddr)
+	if err != nil {
+		errCh <- err
+		logger.Errorf("failed to listen http(s) server: %s", err.Error())
+		return
 	}
 	logger.Infof("http(s) server listening on %s", serverAddr)
-	if err = s.httpSServer.ListenAndServeTLS("", ""); err != nil &&
+	if err = s.httpSServer.ServeTLS(lis, "", ""); err != nil &&
 		!syserrors.Is(err, http.ErrServerClosed) {
 		errCh <- err
 		logger.Errorf("failed to start http(s) server: %s", err.Error())
@@ -191,6 +259,107 @@ func (s *AccelerboatServer) runHTTPSServer(errCh chan error) {
 	errCh <- nil
 }
 
+// newProxyServer returns the server of HTTP/HTTPS listener with the timeouts and h2 settings of config
+func (s *AccelerboatServer) newProxyServer(addr string, withTLS bool) *http.Server {
+	sc := s.op().ServerConfig
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	if withTLS {
+		protocols.SetHTTP2(!sc.DisableHTTP2)
+	} else {
+		protocols.SetUnencryptedHTTP2(sc.EnableH2C)
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		MaxHeaderBytes:    int(s.op().APIValidation.MaxHeaderSize * 1024),
+		ReadHeaderTimeout: time.Duration(sc.ReadHeaderTimeout) * time.Second,
+		ReadTimeout:       time.Duration(sc.ReadTimeout) * time.Second,
+		IdleTimeout:       time.Duration(sc.IdleTimeout) * time.Second,
+		Protocols:         protocols,
+		HTTP2: &http.HTTP2Config{
+			MaxConcurrentStreams: sc.MaxConcurrentStreams,
+		},
+	}
+}
+
+// listenProxy listens the address of HTTP/HTTPS listener, the accepted connections are limited by MaxConns
+func (s *AccelerboatServer) listenProxy(addr string) (net.Listener, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listen '%s' failed", addr)
+	}
+	if s.op().ServerConfig.MaxConns > 0 {
+		lis = netutil.LimitListener(lis, s.op().ServerConfig.MaxConns)
+	}
+	return lis, nil
+}
+
+// newPeerServer returns the server of node-to-node layer transfer, it is created before the servers run so
+// that the shutdown reads it without race
+func (s *AccelerboatServer) newPeerServer() *http.Server {
+	return &http.Server{
+		Addr: fmt.Sprintf("0.0.0.0:%d", s.op().PeerTLS.Port),
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != apitypes.APITransferLayerTCP || req.Method != http.MethodGet {
+				http.NotFound(rw, req)
+				return
+			}
+			s.ginSvr.ServeHTTP(rw, peertls.WithPeerRequest(req))
+		}),
+		TLSConfig: peertls.Global.ServerConfig(),
+	}
+}
+
+// runPeerTLSServer serves the node-to-node layer transfer with mutual-TLS
+func (s *AccelerboatServer) runPeerTLSServer(errCh chan error) {
+	if s.peerServer == nil {
+		errCh <- nil
+		return
+	}
+	defer logger.Warnf("peer tls server exit")
+	logger.Infof("peer tls server listening on %s", s.peerServer.Addr)
+	if err := s.peerServer.ListenAndServeTLS("", ""); err != nil && !syserrors.Is(err, http.ErrServerClosed) {
+		errCh <- err
+		logger.Errorf("failed to start peer tls server: %s", err.Error())
+		return
+	}
+	errCh <- nil
+}
+
+// runInternalGRPCServer serves the gRPC internal API between nodes, with the mutual-TLS if peer tls enabled
+func (s *AccelerboatServer) runInternalGRPCServer(errCh chan error) {
+	if !s.op().InternalGRPC.Enable {
+		errCh <- nil
+		return
+	}
+	defer logger.Warnf("internal grpc server exit")
+	serverAddr := fmt.Sprintf("0.0.0.0:%d", s.op().InternalGRPC.Port)
+	lis, err := net.Listen("tcp", serverAddr)
+	if err != nil {
+		errCh <- errors.Wrapf(err, "listen internal grpc on '%s' failed", serverAddr)
+		return
+	}
+	opts := append(customapi.GRPCServerOptions(),
+		grpc.MaxRecvMsgSize(int(s.op().APIValidation.MaxBodySize*1024)))
+	if s.op().PeerTLS.Enable {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(peertls.Global.ServerConfig())))
+	}
+	grpcServer := grpc.NewServer(opts...)
+	s.customHandler.RegisterGRPC(grpcServer)
+	go func() {
+		<-s.globalCtx.Done()
+		grpcServer.GracefulStop()
+	}()
+	logger.Infof("internal grpc server listening on %s", serverAddr)
+	if err = grpcServer.Serve(lis); err != nil {
+		errCh <- err
+		logger.Errorf("failed to start internal grpc server: %s", err.Error())
+		return
+	}
+	errCh <- nil
+}
+
 func (s *AccelerboatServer) runOCITickReporter(errCh chan error) {
 	defer logger.Warnf("oci tick reporter exit")
 	logger.Infof("oci reporter started")
@@ -211,18 +380,161 @@ func (s *AccelerboatServer) runStaticFilesWatcher(errCh chan error) {
 
 func (s *AccelerboatServer) runOptionFileWatcher(errCh chan error) {
 	defer logger.Warnf("option watcher exit")
-	ch := s.opWatcher.Watch(s.globalCtx)
+	ch := options.Subscribe(s.globalCtx)
+	go s.opWatcher.Watch(s.globalCtx)
 	logger.Infof("option watcher started")
-L:
-	for {
-		select {
-		case _, ok := <-ch:
-			if !ok {
-				break L
-			}
-			// TODO: need do something but now do nothing
+	lm := s.newLifecycleManager()
+	for changes := range ch {
+		lm.handle(s.globalCtx, changes)
+	}
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runBandwidthScheduler(errCh chan error) {
+	defer logger.Warnf("bandwidth scheduler exit")
+	logger.Infof("bandwidth scheduler started")
+	bandwidth.NewScheduler(s.torrentHandler).Run(s.globalCtx)
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runTokenRefresher(errCh chan error) {
+	defer logger.Warnf("token refresher exit")
+	logger.Infof("token refresher started")
+	s.customHandler.RunTokenRefresher(s.globalCtx)
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runPullSecretWatcher(errCh chan error) {
+	defer logger.Warnf("pull secret watcher exit")
+	logger.Infof("pull secret watcher started")
+	pullsecret.Watch(s.globalCtx, s.op().K8sClient())
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runPodIdentityInformer(errCh chan error) {
+	if !s.op().PodIdentity.Enable || s.op().K8sClient() == nil {
+		errCh <- nil
+		return
+	}
+	defer logger.Warnf("pod identity informer exit")
+	logger.Infof("pod identity informer started")
+	if err := podidentity.Run(s.globalCtx, s.op().K8sClient()); err != nil {
+		logger.Errorf("pod identity informer failed: %s", err.Error())
+	}
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runCacheStoreWriteBehind(errCh chan error) {
+	defer logger.Warnf("cache store write-behind exit")
+	logger.Infof("cache store write-behind started")
+	store.RunWriteBehind(s.globalCtx)
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runNodeHeartbeat(errCh chan error) {
+	defer logger.Warnf("node heartbeat exit")
+	logger.Infof("node heartbeat started, version: %s", version.Version)
+	store.RunHeartbeat(s.globalCtx)
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runIntegrityVerifier(errCh chan error) {
+	defer logger.Warnf("integrity verifier exit")
+	logger.Infof("integrity verifier started")
+	integrity.NewVerifier(store.GlobalRedisStore()).Run(s.globalCtx)
+	errCh <- nil
+}
+
+// runEstargzConverter converts the cached layers to eStargz if enabled, it follows the reloaded options
+func (s *AccelerboatServer) runEstargzConverter(errCh chan error) {
+	defer logger.Warnf("estargz converter exit")
+	logger.Infof("estargz converter started")
+	estargz.NewConverter(store.GlobalRedisStore()).Run(s.globalCtx)
+	errCh <- nil
+}
+
+// runSavingsAccumulator flushes the traffic bytes of this node into cache store
+func (s *AccelerboatServer) runSavingsAccumulator(errCh chan error) {
+	defer logger.Warnf("savings accumulator exit")
+	logger.Infof("savings accumulator started")
+	savings.Global.Run(s.globalCtx, store.GlobalRedisStore())
+	errCh <- nil
+}
+
+// runLoadSignals updates the load gauges of this node for autoscaling
+func (s *AccelerboatServer) runLoadSignals(errCh chan error) {
+	defer logger.Warnf("load signals exit")
+	logger.Infof("load signals started")
+	loadsignal.Global.Run(s.globalCtx)
+	errCh <- nil
+}
+
+// runUpstreamHealthProber probes the original hosts of the enabled registry mappings if enabled
+func (s *AccelerboatServer) runUpstreamHealthProber(errCh chan error) {
+	defer logger.Warnf("upstream health prober exit")
+	logger.Infof("upstream health prober started")
+	upstreamhealth.Run(s.globalCtx)
+	errCh <- nil
+}
+
+// runOriginFailover probes the unhealthy original hosts of the mappings with replicas, they are used
+// again once probed healthy
+func (s *AccelerboatServer) runOriginFailover(errCh chan error) {
+	defer logger.Warnf("origin failover prober exit")
+	logger.Infof("origin failover prober started")
+	failover.Run(s.globalCtx)
+	errCh <- nil
+}
+
+// runOCISeeder exports the containerd layers once at startup, and generates the torrents of layers exceed
+// the threshold to seed them before any peer requests
+func (s *AccelerboatServer) runOCISeeder(errCh chan error) {
+	if !s.op().OCISeed.Enable || !s.op().EnableContainerd {
+		errCh <- nil
+		return
+	}
+	defer logger.Warnf("oci seeder exit")
+	logger.Infof("oci seeder started")
+	layers, err := s.ociScanner.ExportSeedLayers(s.globalCtx, s.op().OCISeed.MaxLayers)
+	if err != nil {
+		logger.Errorf("export oci seed layers failed: %s", err.Error())
+	}
+	seeded := 0
+	for _, sl := range layers {
+		if !s.op().TorrentConfig.Enable || sl.Size < s.op().TorrentConfig.Threshold*options.MB {
+			continue
+		}
+		ctx := logger.WithContextFields(s.globalCtx, "digest", sl.Digest)
+		if _, err = s.torrentHandler.GenerateTorrent(ctx, sl.Digest, sl.Path); err != nil {
+			logger.ErrorContextf(ctx, "generate seed torrent for '%s' failed: %s", sl.Path, err.Error())
+			continue
 		}
+		seeded++
+	}
+	logger.Infof("oci seeder exported %d layers, seeded %d torrents", len(layers), seeded)
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runFederationPublisher(errCh chan error) {
+	fed := federation.Global()
+	if fed == nil {
+		errCh <- nil
+		return
+	}
+	defer logger.Warnf("federation publisher exit")
+	logger.Infof("federation publisher started")
+	fed.RunPublisher(s.globalCtx, store.GlobalRedisStore())
+	errCh <- nil
+}
+
+func (s *AccelerboatServer) runPreheatController(errCh chan error) {
+	if !s.op().Preheat.Enable {
+		errCh <- nil
+		return
 	}
+	defer logger.Warnf("preheat controller exit")
+	logger.Infof("preheat controller started")
+	preheat.NewController(s.op().K8sClient()).Run(s.globalCtx)
 	errCh <- nil
 }
 
@@ -231,11 +543,11 @@ func (s *AccelerboatServer) runDiskUsageUpdater(errCh chan error) {
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
 	paths := map[string]string{
-		"transfer":  s.op.StorageConfig.TransferPath,
-		"download":  s.op.StorageConfig.DownloadPath,
-		"smallfile": s.op.StorageConfig.SmallFilePath,
-		"torrent":   s.op.StorageConfig.TorrentPath,
-		"oci":       s.op.StorageConfig.OCIPath,
+		"transfer":  s.op().StorageConfig.TransferPath,
+		"download":  s.op().StorageConfig.DownloadPath,
+		"smallfile": s.op().StorageConfig.SmallFilePath,
+		"torrent":   s.op().StorageConfig.TorrentPath,
+		"oci":       s.op().StorageConfig.OCIPath,
 	}
 	metrics.UpdateDiskUsage(paths)
 	for {
@@ -271,7 +583,7 @@ func (s *AccelerboatServer) ServeHTTP(rw http.ResponseWriter, req *http.Request)
 	method := req.Method
 
 	for _, v := range s.ginSvr.Routes() {
-		if req.URL.Path == v.Path && req.Method == v.Method {
+		if matchRoutePath(req.URL.Path, v.Path) && req.Method == v.Method {
 			s.ginSvr.ServeHTTP(rec, req)
 			path := v.Path
 			if path == "" {
@@ -288,15 +600,21 @@ func (s *AccelerboatServer) ServeHTTP(rw http.ResponseWriter, req *http.Request)
 	}
 
 	req = middleware.GeneralMiddleware(rec, req)
+	req = req.WithContext(accesslog.WithCacheOutcome(req.Context()))
+	if s.op().PodIdentity.Enable {
+		req = req.WithContext(podidentity.WithIdentity(req.Context(), remoteIP(req)))
+	}
 	ctx := req.Context()
+	var proxyHost string
+	proxyType := options.DomainProxy
+	defer s.logAccess(ctx, rec, req, start, &proxyHost, &proxyType)
 	hosts := strings.Split(req.Host, ":")
 	if len(hosts) != 2 {
 		s.httpError(ctx, rec, fmt.Sprintf("invalid host: %s", req.Host), http.StatusBadRequest)
 		return
 	}
-	proxyHost := hosts[0]
+	proxyHost = hosts[0]
 	requestURI := req.RequestURI
-	var upstreamProxy registry.UpstreamProxyInterface
 	switch proxyHost {
 	case LocalHost, LocalHostAddr:
 		queryNS := strings.TrimSpace(req.URL.Query().Get("ns"))
@@ -305,20 +623,144 @@ func (s *AccelerboatServer) ServeHTTP(rw http.ResponseWriter, req *http.Request)
 				http.StatusBadRequest)
 			return
 		}
-		proxyHost = queryNS
-		upstreamProxy = registry.NewUpstreamProxy(options.RegistryMirror, proxyHost, s.torrentHandler)
-	default:
-		upstreamProxy = registry.NewUpstreamProxy(options.DomainProxy, proxyHost, s.torrentHandler)
+		proxyHost, requestURI = s.op().MirrorProxyHost(queryNS, requestURI)
+		proxyType = options.RegistryMirror
+	}
+	if err := s.verifyClient(req, proxyHost, proxyType); err != nil {
+		logger.WarnContextf(ctx, "client verify rejected: %s", err.Error())
+		http.Error(rec, err.Error(), http.StatusForbidden)
+		return
+	}
+	if status, err := s.verifyHost(req, proxyHost, proxyType); err != nil {
+		logger.WarnContextf(ctx, "host verify rejected: %s", err.Error())
+		http.Error(rec, err.Error(), status)
+		return
 	}
+	upstreamProxy := registry.NewUpstreamProxy(proxyType, proxyHost, s.torrentHandler)
 	if upstreamProxy == nil {
 		s.httpError(ctx, rec, fmt.Sprintf("no handler for proxy host '%s'", proxyHost), http.StatusBadRequest)
 		return
 	}
 
-	upstreamProxy.ServeHTTP(requestURI, rec, req)
+	var proxyWriter http.ResponseWriter = rec
+	if cq := s.op().ClientQuota; cq.Enable {
+		clientID := clientquota.ClientID(req, cq.IdentifyBy)
+		quota := cq.QuotaOf(clientID)
+		release, err := clientquota.Global.Acquire(ctx, clientID, quota)
+		if err != nil {
+			logger.WarnContextf(ctx, "client quota rejected: %s", err.Error())
+			http.Error(rec, err.Error(), http.StatusTooManyRequests)
+			metrics.ClientRequestsTotal.WithLabelValues(clientID, strconv.Itoa(rec.Status())).Inc()
+			return
+		}
+		defer func() {
+			release()
+			metrics.ClientRequestsTotal.WithLabelValues(clientID, strconv.Itoa(rec.Status())).Inc()
+		}()
+		proxyWriter = clientquota.Global.LimitWriter(ctx, clientID, quota, rec)
+	}
+	upstreamProxy.ServeHTTP(requestURI, proxyWriter, req)
 	metrics.HTTPRequestsTotal.WithLabelValues(proxyHost, method, "", strconv.Itoa(rec.Status())).Inc()
 	if !strings.Contains(req.URL.Path, "/blobs/") {
 		metrics.HTTPRequestDurationSeconds.WithLabelValues(proxyHost, method, proxyHost).
 			Observe(time.Since(start).Seconds())
 	}
 }
+
+// matchRoutePath returns whether the path matches the gin route path, the route path can have path
+// parameters, e.g. '/customapi/upstreams/:upstream'
+func matchRoutePath(path, routePath string) bool {
+	if !strings.Contains(routePath, "/:") {
+		return path == routePath
+	}
+	segments := strings.Split(path, "/")
+	routeSegments := strings.Split(routePath, "/")
+	if len(segments) != len(routeSegments) {
+		return false
+	}
+	for i := range routeSegments {
+		if strings.HasPrefix(routeSegments[i], ":") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segments[i] != routeSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// logAccess writes the access log entry of the proxied registry request
+func (s *AccelerboatServer) logAccess(ctx context.Context, rec *common.ResponseRecorder, req *http.Request,
+	start time.Time, proxyHost *string, proxyType *options.ProxyType) {
+	namespace, pod := podidentity.FromContext(ctx)
+	if pod != "" {
+		metrics.PodPullBytesTotal.WithLabelValues(namespace, pod).Add(float64(rec.Bytes()))
+	}
+	cacheOutcome := accesslog.CacheOutcome(ctx)
+	accountBlobTraffic(req, rec, *proxyHost, *proxyType, cacheOutcome)
+	if _, _, ok := utils.IsBlobGet(req.URL.Path); ok && req.Method == http.MethodGet && rec.Status() < 400 {
+		loadsignal.Global.ObserveBlob(rec.Bytes(), time.Since(start))
+	}
+	accesslog.Global.Log(&accesslog.Entry{
+		RequestID: logger.GetContextField(ctx, common.RequestIDHeaderKey),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Registry:  *proxyHost,
+		Digest:    requestDigest(req.URL.Path),
+		Status:    rec.Status(),
+		Bytes:     rec.Bytes(),
+		Duration:  time.Since(start),
+		ClientIP:  remoteIP(req),
+		Cache:     cacheOutcome,
+		Namespace: namespace,
+		Pod:       pod,
+	})
+}
+
+// accountBlobTraffic accounts the bytes of blob responses served to clients by the original host, the
+// blobs reversed to original registry are downloaded from it too
+func accountBlobTraffic(req *http.Request, rec *common.ResponseRecorder, proxyHost string,
+	proxyType options.ProxyType, cacheOutcome string) {
+	if req.Method != http.MethodGet || rec.Bytes() <= 0 {
+		return
+	}
+	if status := rec.Status(); status != http.StatusOK && status != http.StatusPartialContent {
+		return
+	}
+	if _, _, ok := utils.IsBlobGet(req.URL.Path); !ok {
+		return
+	}
+	mapping := options.GlobalOptions().FilterRegistryMapping(proxyHost, proxyType)
+	if mapping == nil {
+		return
+	}
+	savings.Global.AddServed(mapping.OriginalHost, rec.Bytes())
+	if cacheOutcome == accesslog.CacheReverse {
+		savings.Global.AddOrigin(mapping.OriginalHost, rec.Bytes())
+	}
+}
+
+// remoteIP returns the ip of the request client
+func remoteIP(req *http.Request) string {
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return clientIP
+}
+
+// requestDigest returns the digest of blob or manifest-by-digest request
+func requestDigest(urlPath string) string {
+	if _, digest, ok := utils.IsBlobGet(urlPath); ok {
+		return "sha256:" + digest
+	}
+	if i := strings.LastIndex(urlPath, "/manifests/"); i >= 0 {
+		if ref := urlPath[i+len("/manifests/"):]; strings.HasPrefix(ref, "sha256:") {
+			return ref
+		}
+	}
+	return ""
+}
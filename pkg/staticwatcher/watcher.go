@@ -25,6 +25,7 @@ import (
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/recorder"
 	"github.com/penglongli/accelerboat/pkg/store"
 )
 
@@ -108,7 +109,17 @@ func (w *StaticFilesWatcher) Watch(ctx context.Context) error {
 				case fsnotify.Remove:
 					if err = w.cacheStore.DeleteStaticLayer(ctx, digest); err != nil {
 						logger.ErrorContextf(ctx, "cache delete static '%s' failed: %s", event.Name, err.Error())
+						continue
 					}
+					recorder.Global.Record(ctx, recorder.Event{
+						Type:        recorder.EventTypeCacheReconciled,
+						EventStatus: recorder.Normal,
+						Details: map[string]interface{}{
+							"digest": digest, "file": event.Name, "source": string(store.StaticFile),
+							"reason": "file_removed",
+						},
+						Message: "Static layer removed from cache store because the file is deleted",
+					})
 				default:
 				}
 			case <-ticker.C:
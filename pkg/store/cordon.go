@@ -0,0 +1,106 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+)
+
+const (
+	// cordonedKey the hash of cordoned nodes, the fields are the nodes and the values are the unix time
+	// they were cordoned
+	cordonedKey = "cordoned"
+	// cordonedRefreshInterval the cordoned nodes are cached in memory within the interval, they are
+	// queried on every layer query and download distribution
+	cordonedRefreshInterval = 5 * time.Second
+)
+
+// cordonedCache caches the cordoned nodes, the last result is kept while redis unavailable
+type cordonedCache struct {
+	sync.Mutex
+	nodes   map[string]time.Time
+	updated time.Time
+}
+
+// CordonNode marks the node cordoned, it is not assigned downloads and its layers are not returned by
+// the layer queries until uncordoned. The node still serves its local clients.
+func (r *RedisStore) CordonNode(ctx context.Context, located string) error {
+	if err := r.redisClient.HSetNX(ctx, cordonedKey, located, time.Now().Unix()).Err(); err != nil {
+		return errors.Wrapf(err, "redis hset key '%s' failed", cordonedKey)
+	}
+	r.cordoned.Lock()
+	r.cordoned.updated = time.Time{}
+	r.cordoned.Unlock()
+	return nil
+}
+
+// UncordonNode removes the cordoned mark of node
+func (r *RedisStore) UncordonNode(ctx context.Context, located string) error {
+	if err := r.redisClient.HDel(ctx, cordonedKey, located).Err(); err != nil {
+		return errors.Wrapf(err, "redis hdel key '%s' failed", cordonedKey)
+	}
+	r.cordoned.Lock()
+	r.cordoned.updated = time.Time{}
+	r.cordoned.Unlock()
+	return nil
+}
+
+// CordonedNodes returns the cordoned nodes with the time they were cordoned, the result is shared and
+// must not be modified
+func (r *RedisStore) CordonedNodes(ctx context.Context) (map[string]time.Time, error) {
+	r.cordoned.Lock()
+	defer r.cordoned.Unlock()
+	if r.cordoned.nodes != nil && time.Since(r.cordoned.updated) < cordonedRefreshInterval {
+		return r.cordoned.nodes, nil
+	}
+	values, err := r.redisClient.HGetAll(ctx, cordonedKey).Result()
+	if err != nil {
+		r.markDegraded(err)
+		if r.cordoned.nodes != nil {
+			logger.WarnContextf(ctx, "query cordoned nodes failed, use the last result: %s", err.Error())
+			return r.cordoned.nodes, nil
+		}
+		return nil, errors.Wrapf(err, "redis hgetall key '%s' failed", cordonedKey)
+	}
+	nodes := make(map[string]time.Time, len(values))
+	for node, v := range values {
+		ts, _ := strconv.ParseInt(v, 10, 64)
+		nodes[node] = time.Unix(ts, 0)
+	}
+	r.cordoned.nodes = nodes
+	r.cordoned.updated = time.Now()
+	return nodes, nil
+}
+
+// filterCordoned removes the layers located on the cordoned nodes, the layers are not filtered if the
+// cordoned nodes cannot be queried
+func (r *RedisStore) filterCordoned(ctx context.Context, layers []*LayerLocatedInfo) []*LayerLocatedInfo {
+	if len(layers) == 0 {
+		return layers
+	}
+	cordoned, err := r.CordonedNodes(ctx)
+	if err != nil {
+		logger.WarnContextf(ctx, "query cordoned nodes failed: %s", err.Error())
+		return layers
+	}
+	if len(cordoned) == 0 {
+		return layers
+	}
+	result := make([]*LayerLocatedInfo, 0, len(layers))
+	for _, layer := range layers {
+		if _, ok := cordoned[layer.Located]; ok {
+			continue
+		}
+		result = append(result, layer)
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	// estargzLayersKey the hash of original digest -> eStargz layer
+	estargzLayersKey = "estargz-layers"
+	// estargzConvertedKey the hash of converted digest -> original digest
+	estargzConvertedKey = "estargz-converted"
+	// estargzBlobExpiration the expiration of the manifests and configs referencing eStargz layers, they are
+	// generated again when the lazy-pulling manifest requested
+	estargzBlobExpiration = 7 * 24 * time.Hour
+)
+
+// SaveEstargzLayer saves the eStargz layer converted from the original layer, both digests are mapped
+func (r *RedisStore) SaveEstargzLayer(ctx context.Context, layer *apitypes.EstargzLayer) error {
+	bs, err := json.Marshal(layer)
+	if err != nil {
+		return errors.Wrapf(err, "marshal estargz layer failed")
+	}
+	if _, err = r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, estargzLayersKey, layer.Digest, string(bs))
+		pipe.HSet(ctx, estargzConvertedKey, layer.Converted, layer.Digest)
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "redis save estargz layer '%s' failed", layer.Digest)
+	}
+	return nil
+}
+
+// GetEstargzLayer returns the eStargz layer by the original or converted digest, returns nil if the layer
+// not converted
+func (r *RedisStore) GetEstargzLayer(ctx context.Context, digest string) (*apitypes.EstargzLayer, error) {
+	original, err := r.redisClient.HGet(ctx, estargzConvertedKey, digest).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, errors.Wrapf(err, "redis get estargz converted '%s' failed", digest)
+	}
+	if original != "" {
+		digest = original
+	}
+	value, err := r.redisClient.HGet(ctx, estargzLayersKey, digest).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "redis get estargz layer '%s' failed", digest)
+	}
+	layer := &apitypes.EstargzLayer{}
+	if err = json.Unmarshal([]byte(value), layer); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal estargz layer '%s' failed", digest)
+	}
+	return layer, nil
+}
+
+func (r *RedisStore) buildEstargzBlobKey(digest string) string {
+	return fmt.Sprintf("estargz-blob/%s", digest)
+}
+
+func (r *RedisStore) buildEstargzBlobSourceKey(digest string) string {
+	return fmt.Sprintf("estargz-blob-source/%s", digest)
+}
+
+// SaveEstargzBlob saves the manifest or config generated for the eStargz layers, they are not cached on
+// any node and served from cache store by digest. The source is the reference of origin content it is
+// generated from (e.g. 'manifests/sha256:...'), the clients are authorized with it before served.
+func (r *RedisStore) SaveEstargzBlob(ctx context.Context, digest, source string, data []byte) error {
+	key := r.buildEstargzBlobKey(digest)
+	if _, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, estargzBlobExpiration)
+		pipe.Set(ctx, r.buildEstargzBlobSourceKey(digest), source, estargzBlobExpiration)
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "redis set key '%s' failed", key)
+	}
+	return nil
+}
+
+// GetEstargzBlob returns the manifest or config generated for the eStargz layers with the reference of its
+// source, returns nil if not exist. The blob saved without source is regarded as not exist.
+func (r *RedisStore) GetEstargzBlob(ctx context.Context, digest string) ([]byte, string, error) {
+	key := r.buildEstargzBlobKey(digest)
+	values, err := r.redisClient.MGet(ctx, key, r.buildEstargzBlobSourceKey(digest)).Result()
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "redis get key '%s' failed", key)
+	}
+	data, ok := values[0].(string)
+	source, _ := values[1].(string)
+	if !ok || source == "" {
+		return nil, "", nil
+	}
+	return []byte(data), source, nil
+}
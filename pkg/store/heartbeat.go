@@ -0,0 +1,189 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/loadsignal"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/version"
+)
+
+const (
+	// heartbeatKey the hash of node heartbeats, the fields are the nodes
+	heartbeatKey = "heartbeats"
+	// heartbeatInterval the interval of nodes saving their heartbeats
+	heartbeatInterval = 30 * time.Second
+	// heartbeatExpiration the node not sending heartbeat within the duration is removed
+	heartbeatExpiration = 3 * heartbeatInterval
+)
+
+// NodeHeartbeat defines the heartbeat of node with its build, the api version and capabilities are
+// empty in the heartbeats of legacy nodes
+type NodeHeartbeat struct {
+	Node         string   `json:"node"`
+	Version      string   `json:"version"`
+	GitCommit    string   `json:"gitCommit"`
+	APIVersion   int      `json:"apiVersion,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Load the load signals of node, reported if autoscaling enabled
+	Load *apitypes.LoadSignals `json:"load,omitempty"`
+	TS   int64                 `json:"ts"`
+}
+
+// heartbeatCache caches the heartbeats of nodes by node for the capability checks, the last result is
+// kept while redis unavailable
+type heartbeatCache struct {
+	sync.Mutex
+	nodes   map[string]*NodeHeartbeat
+	updated time.Time
+}
+
+// Capabilities returns the capabilities of this node, they depend on the config
+func Capabilities() []string {
+	op := options.GlobalOptions()
+	result := []string{apitypes.CapabilityLayerZSet}
+	if op.InternalGRPC.Enable {
+		result = append(result, apitypes.CapabilityGRPC, apitypes.CapabilityChunkedTransfer)
+	}
+	if op.DownloadCancel.Enable {
+		result = append(result, apitypes.CapabilityDownloadCancel)
+	}
+	return result
+}
+
+// SaveHeartbeat saves the heartbeat of this node
+func (r *RedisStore) SaveHeartbeat(ctx context.Context) error {
+	hb := &NodeHeartbeat{
+		Node:         r.op.Address,
+		Version:      version.Version,
+		GitCommit:    version.GitCommit,
+		APIVersion:   apitypes.CurrentAPIVersion,
+		Capabilities: Capabilities(),
+		TS:           time.Now().Unix(),
+	}
+	if options.GlobalOptions().Autoscaling.Enable {
+		hb.Load = loadsignal.Global.Signals()
+	}
+	bs, _ := json.Marshal(hb)
+	if err := r.redisClient.HSet(ctx, heartbeatKey, r.op.Address, bs).Err(); err != nil {
+		return errors.Wrapf(err, "redis hset key '%s' failed", heartbeatKey)
+	}
+	return nil
+}
+
+// NodeHeartbeats returns the heartbeats of alive nodes sorted by node, the expired ones are removed
+func (r *RedisStore) NodeHeartbeats(ctx context.Context) ([]*NodeHeartbeat, error) {
+	values, err := r.redisClient.HGetAll(ctx, heartbeatKey).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "redis hgetall key '%s' failed", heartbeatKey)
+	}
+	deadline := time.Now().Add(-heartbeatExpiration).Unix()
+	result := make([]*NodeHeartbeat, 0, len(values))
+	expired := make([]string, 0)
+	for node, v := range values {
+		hb := &NodeHeartbeat{}
+		if err = json.Unmarshal([]byte(v), hb); err != nil || hb.TS < deadline {
+			expired = append(expired, node)
+			continue
+		}
+		result = append(result, hb)
+	}
+	if len(expired) != 0 {
+		if err = r.redisClient.HDel(ctx, heartbeatKey, expired...).Err(); err != nil {
+			logger.WarnContextf(ctx, "redis hdel expired heartbeats failed: %s", err.Error())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Node < result[j].Node
+	})
+	return result, nil
+}
+
+// NodeSupports returns whether the node has the capability. The node is regarded as supporting it if
+// its capabilities are unknown (e.g. legacy node or redis unavailable), so the behavior of the nodes
+// not reporting capabilities is not changed.
+func (r *RedisStore) NodeSupports(ctx context.Context, node, capability string) bool {
+	hb := r.cachedHeartbeat(ctx, node)
+	if hb == nil || hb.APIVersion < apitypes.CurrentAPIVersion {
+		return true
+	}
+	return apitypes.HasCapability(hb.Capabilities, capability)
+}
+
+func (r *RedisStore) cachedHeartbeat(ctx context.Context, node string) *NodeHeartbeat {
+	r.heartbeats.Lock()
+	defer r.heartbeats.Unlock()
+	if r.heartbeats.nodes == nil || time.Since(r.heartbeats.updated) >= heartbeatInterval {
+		heartbeats, err := r.NodeHeartbeats(ctx)
+		if err != nil {
+			r.markDegraded(err)
+			logger.WarnContextf(ctx, "query node heartbeats failed: %s", err.Error())
+		} else {
+			nodes := make(map[string]*NodeHeartbeat, len(heartbeats))
+			for _, hb := range heartbeats {
+				nodes[hb.Node] = hb
+			}
+			r.heartbeats.nodes = nodes
+		}
+		// the failed query is not retried until next interval
+		r.heartbeats.updated = time.Now()
+	}
+	return r.heartbeats.nodes[node]
+}
+
+// checkNewerNodes warns the nodes with newer api version than this node, this node should be upgraded
+// to use their new APIs. The node is warned once for each of its versions.
+func (r *RedisStore) checkNewerNodes(ctx context.Context, warned map[string]string) {
+	heartbeats, err := r.NodeHeartbeats(ctx)
+	if err != nil {
+		return
+	}
+	for _, hb := range heartbeats {
+		if hb.APIVersion <= apitypes.CurrentAPIVersion || warned[hb.Node] == hb.Version {
+			continue
+		}
+		warned[hb.Node] = hb.Version
+		logger.Warnf("node '%s' runs version '%s' with api version %d newer than %d of this node (version "+
+			"'%s'), this node should be upgraded", hb.Node, hb.Version, hb.APIVersion,
+			apitypes.CurrentAPIVersion, version.Version)
+	}
+}
+
+// RunHeartbeat saves the heartbeat of this node periodically until ctx done, and checks whether this
+// node is older than the others. The legacy hashes of layers are cleaned once by master after the legacy
+// nodes upgraded.
+func RunHeartbeat(ctx context.Context) {
+	r := GlobalRedisStore().(*RedisStore)
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	warned := make(map[string]string)
+	legacyCleaned := false
+	for {
+		if err := r.SaveHeartbeat(ctx); err != nil {
+			r.markDegraded(err)
+			logger.V(3).Infof("save heartbeat failed: %s", err.Error())
+		} else {
+			r.checkNewerNodes(ctx, warned)
+			if !legacyCleaned {
+				legacyCleaned = r.cleanLegacyLayersOnce(ctx)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	// imagesSeenKey the sorted set of images seen, the members are 'registry,repo,tag' and the scores are
+	// the unix time they were last seen
+	imagesSeenKey = "images-seen"
+	// imagesFirstSeenKey the hash of the unix time images were first seen, the fields are the members of
+	// imagesSeenKey
+	imagesFirstSeenKey = "images-first-seen"
+)
+
+func buildImageSeenMember(registry, repo, tag string) string {
+	return fmt.Sprintf("%s,%s,%s", registry, repo, tag)
+}
+
+// SaveImageSeen records the image is seen now, the images not seen within retention are removed
+func (r *RedisStore) SaveImageSeen(ctx context.Context, registry, repo, tag string,
+	retention time.Duration) error {
+	member := buildImageSeenMember(registry, repo, tag)
+	now := time.Now()
+	if _, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, imagesSeenKey, &redis.Z{Score: float64(now.Unix()), Member: member})
+		pipe.HSetNX(ctx, imagesFirstSeenKey, member, now.Unix())
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "redis save image seen '%s' failed", member)
+	}
+	expired, err := r.redisClient.ZRangeByScore(ctx, imagesSeenKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(now.Add(-retention).Unix(), 10),
+	}).Result()
+	if err != nil {
+		return errors.Wrapf(err, "redis query expired images failed")
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	members := make([]interface{}, 0, len(expired))
+	fields := make([]string, 0, len(expired))
+	for _, m := range expired {
+		members = append(members, m)
+		fields = append(fields, m)
+	}
+	if _, err = r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, imagesSeenKey, members...)
+		pipe.HDel(ctx, imagesFirstSeenKey, fields...)
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "redis remove expired images failed")
+	}
+	logger.InfoContextf(ctx, "removed %d images not seen within %s", len(expired), retention.String())
+	return nil
+}
+
+// ImagesSeen returns the images seen since the time, the last seen first
+func (r *RedisStore) ImagesSeen(ctx context.Context, since time.Time) ([]*apitypes.ImageSeen, error) {
+	members, err := r.redisClient.ZRevRangeByScoreWithScores(ctx, imagesSeenKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "redis get key '%s' failed", imagesSeenKey)
+	}
+	result := make([]*apitypes.ImageSeen, 0, len(members))
+	if len(members) == 0 {
+		return result, nil
+	}
+	fields := make([]string, 0, len(members))
+	for _, z := range members {
+		member, _ := z.Member.(string)
+		fields = append(fields, member)
+	}
+	firstSeen, err := r.redisClient.HMGet(ctx, imagesFirstSeenKey, fields...).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "redis get key '%s' failed", imagesFirstSeenKey)
+	}
+	for i, z := range members {
+		parts := strings.SplitN(fields[i], ",", 3)
+		if len(parts) != 3 {
+			logger.WarnContextf(ctx, "invalid image seen member '%s'", fields[i])
+			continue
+		}
+		lastSeen := time.Unix(int64(z.Score), 0)
+		img := &apitypes.ImageSeen{
+			Registry:  parts[0],
+			Repo:      parts[1],
+			Tag:       parts[2],
+			FirstSeen: lastSeen,
+			LastSeen:  lastSeen,
+		}
+		if v, ok := firstSeen[i].(string); ok {
+			if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+				img.FirstSeen = time.Unix(ts, 0)
+			}
+		}
+		result = append(result, img)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result, nil
+}
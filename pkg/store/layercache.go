@@ -0,0 +1,78 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+// layerQueryResult defines the cached result of layer query
+type layerQueryResult struct {
+	staticLayers []*LayerLocatedInfo
+	ociLayers    []*LayerLocatedInfo
+}
+
+// QueryLayers returns the static layers and oci layers located on the nodes, the layers located on the
+// cordoned nodes are not returned. The result is cached in memory for a short while if enabled, and the
+// concurrent queries of the same layer share one redis request.
+func (r *RedisStore) QueryLayers(ctx context.Context, layer string) ([]*LayerLocatedInfo, []*LayerLocatedInfo,
+	error) {
+	staticLayers, ociLayers, err := r.queryLayersCached(ctx, layer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.filterCordoned(ctx, staticLayers), r.filterCordoned(ctx, ociLayers), nil
+}
+
+func (r *RedisStore) queryLayersCached(ctx context.Context, layer string) ([]*LayerLocatedInfo,
+	[]*LayerLocatedInfo, error) {
+	cfg := r.op.LayerQueryCache
+	if !cfg.Enable {
+		return r.queryLayersWithFallback(ctx, layer)
+	}
+	if v, ok := r.layerCache.Get(layer); ok {
+		metrics.LayerQueryCacheTotal.WithLabelValues("hit").Inc()
+		result := v.(*layerQueryResult)
+		return copyLayers(result.staticLayers), copyLayers(result.ociLayers), nil
+	}
+	v, err, shared := r.layerFlight.Do(layer, func() (interface{}, error) {
+		// the query is shared by callers, it should not be canceled with the first caller
+		staticLayers, ociLayers, err := r.queryLayersWithFallback(context.WithoutCancel(ctx), layer)
+		if err != nil {
+			return nil, err
+		}
+		result := &layerQueryResult{staticLayers: staticLayers, ociLayers: ociLayers}
+		r.layerCache.Set(layer, result, time.Duration(cfg.TTL)*time.Millisecond)
+		return result, nil
+	})
+	if shared {
+		metrics.LayerQueryCacheTotal.WithLabelValues("coalesced").Inc()
+	} else {
+		metrics.LayerQueryCacheTotal.WithLabelValues("miss").Inc()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	result := v.(*layerQueryResult)
+	return copyLayers(result.staticLayers), copyLayers(result.ociLayers), nil
+}
+
+// invalidateLayer removes the cached query result of layer after it is written
+func (r *RedisStore) invalidateLayer(layer string) {
+	r.layerCache.Delete(layer)
+}
+
+// copyLayers returns the copy of layers, the callers sort and change the refer of them
+func copyLayers(layers []*LayerLocatedInfo) []*LayerLocatedInfo {
+	result := make([]*LayerLocatedInfo, 0, len(layers))
+	for _, layer := range layers {
+		copied := *layer
+		result = append(result, &copied)
+	}
+	return result
+}
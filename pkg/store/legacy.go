@@ -0,0 +1,164 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options/leaderselector"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+// The nodes of legacy builds store the layer locations in the hash named by layer, the fields are
+// '<located>/<type>' with the value '<filepath>:<unix time>'. The layers are also written into and read
+// from the hash while the legacy nodes are alive, so the clusters keep working during rolling upgrades.
+
+// MarkLegacyPeer marks the legacy node is alive, it is called when the request of legacy api version is
+// received from peer
+func (r *RedisStore) MarkLegacyPeer() {
+	r.legacyPeerSeen.Store(time.Now().Unix())
+}
+
+// legacyNodesAlive returns whether the legacy nodes are alive in cluster. The node not reporting the
+// capability of layer sorted set with its heartbeat is regarded as legacy node.
+func (r *RedisStore) legacyNodesAlive(ctx context.Context) bool {
+	if time.Now().Unix()-r.legacyPeerSeen.Load() < int64(heartbeatExpiration.Seconds()) {
+		return true
+	}
+	for _, ep := range leaderselector.Endpoints() {
+		node := ep
+		if host, _, err := net.SplitHostPort(ep); err == nil {
+			node = host
+		}
+		hb := r.cachedHeartbeat(ctx, node)
+		if hb == nil || !apitypes.HasCapability(hb.Capabilities, apitypes.CapabilityLayerZSet) {
+			return true
+		}
+	}
+	return false
+}
+
+func buildLegacyLayerField(located string, layerType LayerType) string {
+	return fmt.Sprintf("%s/%s", located, string(layerType))
+}
+
+// saveLegacyLayer sets the layer field of this node into the legacy hash, the hash expires if not
+// refreshed so it is cleaned after the legacy nodes are upgraded
+func (r *RedisStore) saveLegacyLayer(ctx context.Context, pipe redis.Pipeliner, layerType LayerType,
+	layer, filePath string) {
+	pipe.HSet(ctx, layer, buildLegacyLayerField(r.op.Address, layerType),
+		fmt.Sprintf("%s:%d", filePath, time.Now().Unix()))
+	pipe.Expire(ctx, layer, r.layerExpiration(CONTAINERD))
+}
+
+// queryLegacyLayers returns the layers located by the legacy nodes, the expired ones are ignored
+func (r *RedisStore) queryLegacyLayers(ctx context.Context, layer string) []*LayerLocatedInfo {
+	all, err := r.redisClient.HGetAll(ctx, layer).Result()
+	if err != nil {
+		logger.WarnContextf(ctx, "redis get legacy layer '%s' failed: %s", layer, err.Error())
+		return nil
+	}
+	now := time.Now().Unix()
+	result := make([]*LayerLocatedInfo, 0, len(all))
+	for field, value := range all {
+		located, layerType, ok := strings.Cut(field, "/")
+		idx := strings.LastIndex(value, ":")
+		if !ok || idx < 0 {
+			continue
+		}
+		ts, err := strconv.ParseInt(value[idx+1:], 10, 64)
+		if err != nil || now-ts > int64(r.layerExpiration(LayerType(layerType)).Seconds()) {
+			continue
+		}
+		result = append(result, &LayerLocatedInfo{
+			Layer:   layer,
+			Type:    LayerType(layerType),
+			Located: located,
+			Data:    value[:idx],
+			TS:      ts,
+		})
+	}
+	return result
+}
+
+// mergeLegacyLayers merges the legacy layers not in layers, the result is sorted by time with the latest
+// first. The layers of nodes writing both formats are not duplicated.
+func mergeLegacyLayers(layers, legacyLayers []*LayerLocatedInfo) []*LayerLocatedInfo {
+	if len(legacyLayers) == 0 {
+		return layers
+	}
+	exists := make(map[string]struct{}, len(layers))
+	for _, layer := range layers {
+		exists[buildLayerMember(layer.Located, layer.Type, layer.Data)] = struct{}{}
+	}
+	for _, layer := range legacyLayers {
+		if _, ok := exists[buildLayerMember(layer.Located, layer.Type, layer.Data)]; !ok {
+			layers = append(layers, layer)
+		}
+	}
+	sort.SliceStable(layers, func(i, j int) bool {
+		return layers[i].TS > layers[j].TS
+	})
+	return layers
+}
+
+// legacyLayerKeyRegexp matches the key of legacy hash, it is the digest hex of layer
+var legacyLayerKeyRegexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// CleanLegacyLayers deletes the legacy hashes of layers after all the legacy nodes upgraded, the hashes
+// written by legacy nodes never expire. The keys are scanned and deleted in batches, returns the number
+// of keys deleted.
+func (r *RedisStore) CleanLegacyLayers(ctx context.Context) (int, error) {
+	var cursor uint64
+	counts := 0
+	for {
+		keys, next, err := r.redisClient.ScanType(ctx, cursor, "*", cleanBatchSize, "hash").Result()
+		if err != nil {
+			return counts, errors.Wrapf(err, "redis scan legacy layer keys failed")
+		}
+		legacyKeys := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if legacyLayerKeyRegexp.MatchString(key) {
+				legacyKeys = append(legacyKeys, key)
+			}
+		}
+		if len(legacyKeys) != 0 {
+			if err = r.redisClient.Unlink(ctx, legacyKeys...).Err(); err != nil {
+				return counts, errors.Wrapf(err, "redis unlink legacy layer keys failed")
+			}
+			counts += len(legacyKeys)
+		}
+		if next == 0 {
+			return counts, nil
+		}
+		cursor = next
+	}
+}
+
+// cleanLegacyLayersOnce cleans the legacy hashes of layers by master once all the nodes in cluster
+// reported the capability of layer sorted set, returns whether they are cleaned
+func (r *RedisStore) cleanLegacyLayersOnce(ctx context.Context) bool {
+	if !leaderselector.IsMaster(r.op.Address) || r.legacyNodesAlive(ctx) {
+		return false
+	}
+	counts, err := r.CleanLegacyLayers(ctx)
+	if err != nil {
+		logger.WarnContextf(ctx, "clean legacy layers failed after %d deleted: %s", counts, err.Error())
+		return false
+	}
+	logger.InfoContextf(ctx, "clean legacy layers %d success", counts)
+	return true
+}
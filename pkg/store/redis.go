@@ -14,18 +14,23 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
 	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
 )
 
 // LayerType defines the layer type
@@ -49,12 +54,34 @@ type LayerLocatedInfo struct {
 
 // CacheStore defines the interface of cache store
 type CacheStore interface {
-	SaveOCILayer(ctx context.Context, ociType LayerType, layer, filePath string) error
-	DeleteOCILayer(ctx context.Context, ociType LayerType, layer string) error
+	SaveOCILayers(ctx context.Context, ociType LayerType, layers map[string]string) error
+	DeleteOCILayers(ctx context.Context, ociType LayerType, layers map[string]string) error
 	SaveStaticLayer(ctx context.Context, layer, filePath string, printLog bool) error
 	DeleteStaticLayer(ctx context.Context, layer string) error
 	DeleteLocatedStaticLayer(ctx context.Context, located, layer string) error
 	QueryLayers(ctx context.Context, layer string) ([]*LayerLocatedInfo, []*LayerLocatedInfo, error)
+	CordonNode(ctx context.Context, located string) error
+	UncordonNode(ctx context.Context, located string) error
+	CordonedNodes(ctx context.Context) (map[string]time.Time, error)
+	SaveHeartbeat(ctx context.Context) error
+	NodeHeartbeats(ctx context.Context) ([]*NodeHeartbeat, error)
+	NodeSupports(ctx context.Context, node, capability string) bool
+	MarkLegacyPeer()
+	SaveTorrent(ctx context.Context, layer, torrentBase64 string) (string, error)
+	GetTorrent(ctx context.Context, layer string) (string, error)
+	SaveServiceToken(ctx context.Context, key string, value []byte, expire time.Duration) error
+	GetServiceToken(ctx context.Context, key string) ([]byte, error)
+	Degraded() bool
+	PendingWrites() int
+	ScanLayers(ctx context.Context, fn func(layers []string) error) error
+	SaveImageSeen(ctx context.Context, registry, repo, tag string, retention time.Duration) error
+	ImagesSeen(ctx context.Context, since time.Time) ([]*apitypes.ImageSeen, error)
+	SaveEstargzLayer(ctx context.Context, layer *apitypes.EstargzLayer) error
+	GetEstargzLayer(ctx context.Context, digest string) (*apitypes.EstargzLayer, error)
+	SaveEstargzBlob(ctx context.Context, digest, source string, data []byte) error
+	GetEstargzBlob(ctx context.Context, digest string) ([]byte, string, error)
+	AddTrafficBytes(ctx context.Context, day string, traffic []*apitypes.DailyTraffic, retention time.Duration) error
+	TrafficBytes(ctx context.Context, days []string) ([]*apitypes.DailyTraffic, error)
 
 	CleanHostCache(ctx context.Context) error
 }
@@ -64,8 +91,18 @@ type RedisStore struct {
 	op          *options.AccelerBoatOption
 	redisClient *redis.Client
 
-	// used to do clean host cache
-	localCache *sync.Map
+	layerCache  *cache.Cache
+	layerFlight singleflight.Group
+
+	// the layer writes are queued and the last query results are served while redis unavailable
+	degraded   atomic.Bool
+	queue      writeBehindQueue
+	lastLayers *cache.Cache
+
+	cordoned   cordonedCache
+	heartbeats heartbeatCache
+	// legacyPeerSeen the unix time of the last request received from legacy node
+	legacyPeerSeen atomic.Int64
 }
 
 var (
@@ -85,166 +122,391 @@ func GlobalRedisStore() CacheStore {
 		globalRS = &RedisStore{
 			op:          op,
 			redisClient: redisClient,
-			localCache:  &sync.Map{},
+			layerCache:  cache.New(0, time.Minute),
+			queue:       writeBehindQueue{writes: make(map[string]*pendingWrite)},
+			lastLayers:  cache.New(lastLayersExpiration, time.Minute),
 		}
 	})
 	return globalRS
 }
 
-func (r *RedisStore) buildLayerKey(ociType LayerType) string {
-	return fmt.Sprintf("%s/%s", r.op.Address, string(ociType))
+const (
+	// staticLayerExpiration the static layer not refreshed within the duration is expired, the nodes
+	// refresh their static layers every minute
+	staticLayerExpiration = 120 * time.Second
+	// reportBatchSize the number of layers saved or deleted in one pipeline
+	reportBatchSize = 1000
+	// cleanBatchSize the number of layer keys scanned and cleaned in one batch when clean host cache
+	cleanBatchSize = 1000
+)
+
+// buildLayerKey returns the key of sorted set that stores the nodes having the layer. The members are
+// '<located>/<type>/<filepath>' scored by the refreshed unix time.
+func (r *RedisStore) buildLayerKey(layer string) string {
+	return fmt.Sprintf("layer/%s", layer)
 }
 
-func (r *RedisStore) buildLayerValue(filePath string) string {
-	return fmt.Sprintf("%s:%d", filePath, time.Now().Unix())
+func buildLayerMember(located string, layerType LayerType, filePath string) string {
+	return fmt.Sprintf("%s/%s/%s", located, string(layerType), filePath)
 }
 
-func (r *RedisStore) parseLayerValue(value string) (string, int64, error) {
-	vs := strings.Split(value, ":")
-	if len(vs) != 2 {
-		return "", 0, errors.Errorf("invalid layer value: %s", value)
+func parseLayerMember(member string) (string, LayerType, string, error) {
+	vs := strings.SplitN(member, "/", 3)
+	if len(vs) != 3 {
+		return "", "", "", errors.Errorf("invalid layer member: %s", member)
 	}
-	tstr := vs[1]
-	ts, err := strconv.ParseInt(tstr, 10, 64)
-	if err != nil {
-		return "", 0, errors.Wrapf(err, "invalid layer value: %s", tstr)
+	return vs[0], LayerType(vs[1]), vs[2], nil
+}
+
+// layerExpiration returns the expiration of layer member with type, the oci layers are refreshed with
+// the full report of ociscan
+func (r *RedisStore) layerExpiration(layerType LayerType) time.Duration {
+	switch layerType {
+	case CONTAINERD, DOCKERD:
+		return max(staticLayerExpiration, 2*time.Duration(r.op.OCIReport.FullInterval)*time.Second)
+	default:
+		return staticLayerExpiration
 	}
-	return vs[0], ts, nil
 }
 
-// SaveOCILayer save the dockerd/containerd layers with filepath
-func (r *RedisStore) SaveOCILayer(ctx context.Context, ociType LayerType, layer, filePath string) error {
-	key := r.buildLayerKey(ociType)
-	value := r.buildLayerValue(filePath)
-	if err := r.redisClient.HSet(ctx, layer, key, value).Err(); err != nil {
-		return errors.Wrapf(err, "redis set key '%s' with vaule '%s' failed", key, filePath)
+// saveLayer adds the layer member of this node, the expired members are removed and the expiration of
+// key is refreshed in the same pipeline
+func (r *RedisStore) saveLayer(ctx context.Context, pipe redis.Pipeliner, layerType LayerType,
+	layer, filePath string) {
+	key := r.buildLayerKey(layer)
+	now := time.Now()
+	// the oci layers have the longest expiration of layer types
+	expiration := r.layerExpiration(CONTAINERD)
+	pipe.ZAdd(ctx, key, &redis.Z{
+		Score:  float64(now.Unix()),
+		Member: buildLayerMember(r.op.Address, layerType, filePath),
+	})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", now.Add(-expiration).Unix()))
+	pipe.Expire(ctx, key, expiration)
+}
+
+// deleteLayer removes the layer members of the located node with type
+func (r *RedisStore) deleteLayer(ctx context.Context, located string, layerType LayerType, layer string) error {
+	key := r.buildLayerKey(layer)
+	members, err := r.redisClient.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return errors.Wrapf(err, "redis zrange key '%s' failed", key)
 	}
-	r.localCache.Store(layer, struct{}{})
-	logger.V(3).InfoContextf(ctx, "cache save oci layer '%s = %s' success", key, filePath)
+	prefix := fmt.Sprintf("%s/%s/", located, string(layerType))
+	removed := make([]interface{}, 0)
+	for _, member := range members {
+		if strings.HasPrefix(member, prefix) {
+			removed = append(removed, member)
+		}
+	}
+	if len(removed) != 0 {
+		if err = r.redisClient.ZRem(ctx, key, removed...).Err(); err != nil {
+			return errors.Wrapf(err, "redis zrem key '%s' failed", key)
+		}
+	}
+	r.invalidateLayer(layer)
 	return nil
 }
 
-// DeleteOCILayer delete the oci layers
-func (r *RedisStore) DeleteOCILayer(ctx context.Context, ociType LayerType, layer string) error {
-	key := r.buildLayerKey(ociType)
-	if err := r.redisClient.HDel(ctx, layer, key).Err(); err != nil {
-		return errors.Wrapf(err, "redis del key '%s' failed", key)
+// SaveOCILayers saves the dockerd/containerd layers with filepath, the layers are saved with pipelines
+// in batches
+func (r *RedisStore) SaveOCILayers(ctx context.Context, ociType LayerType, layers map[string]string) error {
+	writes := make([]*pendingWrite, 0, len(layers))
+	for layer, filePath := range layers {
+		writes = append(writes, &pendingWrite{Type: ociType, Layer: layer, Located: r.op.Address,
+			FilePath: filePath})
+	}
+	return r.writeLayers(ctx, writes)
+}
+
+// DeleteOCILayers deletes the dockerd/containerd layers of this node with the reported filepath
+func (r *RedisStore) DeleteOCILayers(ctx context.Context, ociType LayerType, layers map[string]string) error {
+	writes := make([]*pendingWrite, 0, len(layers))
+	for layer, filePath := range layers {
+		writes = append(writes, &pendingWrite{Delete: true, Type: ociType, Layer: layer, Located: r.op.Address,
+			FilePath: filePath})
+	}
+	return r.writeLayers(ctx, writes)
+}
+
+// writeLayers writes the layers with pipelines in batches, the writes are queued if redis unavailable
+func (r *RedisStore) writeLayers(ctx context.Context, writes []*pendingWrite) error {
+	for i := 0; i < len(writes); i += reportBatchSize {
+		batch := writes[i:min(i+reportBatchSize, len(writes))]
+		if err := r.writeBatch(ctx, batch); err != nil {
+			return r.queueWrites(errors.Wrapf(err, "redis pipeline of %d layers failed", len(batch)),
+				writes[i:]...)
+		}
+		r.queue.discard(batch)
 	}
 	return nil
 }
 
+// writeBatch writes the layers with one pipeline, the delete without filepath removes all the members of
+// located node with type. The layers are also written into the legacy hash while legacy nodes alive.
+func (r *RedisStore) writeBatch(ctx context.Context, writes []*pendingWrite) error {
+	legacy := r.legacyNodesAlive(ctx)
+	for _, w := range writes {
+		if w.Delete && w.FilePath == "" {
+			if err := r.deleteLayer(ctx, w.Located, w.Type, w.Layer); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := r.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, w := range writes {
+			switch {
+			case !w.Delete:
+				r.saveLayer(ctx, pipe, w.Type, w.Layer, w.FilePath)
+				if legacy {
+					r.saveLegacyLayer(ctx, pipe, w.Type, w.Layer, w.FilePath)
+				}
+			case w.FilePath != "":
+				pipe.ZRem(ctx, r.buildLayerKey(w.Layer), buildLayerMember(w.Located, w.Type, w.FilePath))
+			case legacy:
+				pipe.HDel(ctx, w.Layer, buildLegacyLayerField(w.Located, w.Type))
+			}
+		}
+		return nil
+	})
+	for _, w := range writes {
+		r.invalidateLayer(w.Layer)
+	}
+	return err
+}
+
 // SaveStaticLayer save static layer
 func (r *RedisStore) SaveStaticLayer(ctx context.Context, layer string, filePath string, printLog bool) error {
-	key := r.buildLayerKey(StaticFile)
-	value := r.buildLayerValue(filePath)
-	if err := r.redisClient.HSet(ctx, layer, key, value).Err(); err != nil {
-		return errors.Wrapf(err, "redis set key '%s' with vaule '%s' failed", key, filePath)
+	if err := r.writeLayers(ctx, []*pendingWrite{{Type: StaticFile, Layer: layer, Located: r.op.Address,
+		FilePath: filePath}}); err != nil {
+		return err
 	}
 	if printLog {
-		logger.InfoContextf(ctx, "cache save static layer '%s = %s' success", key, filePath)
+		logger.InfoContextf(ctx, "cache save static layer '%s = %s' success", layer, filePath)
 	}
-	r.localCache.Store(layer, struct{}{})
 	return nil
 }
 
 // DeleteStaticLayer delete static layer
 func (r *RedisStore) DeleteStaticLayer(ctx context.Context, layer string) error {
-	key := r.buildLayerKey(StaticFile)
-	if err := r.redisClient.HDel(ctx, layer, key).Err(); err != nil {
-		return errors.Wrapf(err, "redis del key '%s' failed", key)
-	}
-	return nil
+	return r.writeLayers(ctx, []*pendingWrite{{Delete: true, Type: StaticFile, Layer: layer,
+		Located: r.op.Address}})
 }
 
 func (r *RedisStore) DeleteLocatedStaticLayer(ctx context.Context, located, layer string) error {
-	key := fmt.Sprintf("%s/%s", located, string(StaticFile))
-	if err := r.redisClient.HDel(ctx, layer, key).Err(); err != nil {
-		return errors.Wrapf(err, "redis del key '%s' failed", key)
-	}
-	return nil
+	return r.writeLayers(ctx, []*pendingWrite{{Delete: true, Type: StaticFile, Layer: layer, Located: located}})
 }
 
-// CleanHostCache clean host cache
+// CleanHostCache removes the layer members of this node. The layer keys are scanned in batches, and the
+// members of every batch are queried and removed with one pipeline each.
 func (r *RedisStore) CleanHostCache(ctx context.Context) error {
-	clean := func(wg *sync.WaitGroup, layer string) {
-		defer wg.Done()
-		keys := []string{
-			r.buildLayerKey(StaticFile),
-			r.buildLayerKey(CONTAINERD),
-			r.buildLayerKey(DOCKERD),
+	prefix := r.op.Address + "/"
+	var cursor uint64
+	counts := 0
+	for {
+		keys, next, err := r.redisClient.Scan(ctx, cursor, "layer/*", cleanBatchSize).Result()
+		if err != nil {
+			return errors.Wrapf(err, "redis scan layer keys failed")
 		}
-		for _, key := range keys {
-			r.redisClient.HDel(ctx, layer, key)
+		if len(keys) != 0 {
+			var removed int
+			if removed, err = r.cleanHostLayers(ctx, prefix, keys); err != nil {
+				return err
+			}
+			counts += removed
+		}
+		if next == 0 {
+			break
 		}
+		cursor = next
 	}
-	wg := &sync.WaitGroup{}
-	counts := 0
-	r.localCache.Range(func(key, value interface{}) bool {
-		wg.Add(1)
-		layer := key.(string)
-		go clean(wg, layer)
-		counts++
-		return true
-	})
-	wg.Wait()
 	logger.InfoContextf(ctx, "clean host cache %d success", counts)
 	return nil
 }
 
-func (r *RedisStore) QueryLayers(ctx context.Context, layer string) ([]*LayerLocatedInfo, []*LayerLocatedInfo, error) {
-	keyTypes := map[string]struct{}{
-		string(StaticFile): {},
-		string(CONTAINERD): {},
-		string(DOCKERD):    {},
-	}
-	all, err := r.redisClient.HGetAll(ctx, layer).Result()
-	if err != nil {
-		return nil, nil, errors.Wrapf(err, "redis get key '%s' failed", layer)
+// ScanLayers scans the layers located in cluster, fn is called with the layers of every batch
+func (r *RedisStore) ScanLayers(ctx context.Context, fn func(layers []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.redisClient.Scan(ctx, cursor, "layer/*", cleanBatchSize).Result()
+		if err != nil {
+			return errors.Wrapf(err, "redis scan layer keys failed")
+		}
+		if len(keys) != 0 {
+			layers := make([]string, 0, len(keys))
+			for _, key := range keys {
+				layers = append(layers, strings.TrimPrefix(key, "layer/"))
+			}
+			if err = fn(layers); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
 	}
-	staticLayers := make([]*LayerLocatedInfo, 0)
-	ociLayers := make([]*LayerLocatedInfo, 0)
-	for k, v := range all {
-		ks := strings.Split(k, "/")
-		if len(ks) != 2 {
-			continue
+}
+
+func (r *RedisStore) cleanHostLayers(ctx context.Context, prefix string, keys []string) (int, error) {
+	cmds, err := r.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.ZRange(ctx, key, 0, -1)
 		}
-		keyType := ks[1]
-		if _, ok := keyTypes[keyType]; !ok {
-			continue
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, errors.Wrapf(err, "redis query layer members failed")
+	}
+	counts := 0
+	if _, err = r.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, cmd := range cmds {
+			members, _ := cmd.(*redis.StringSliceCmd).Result()
+			removed := make([]interface{}, 0)
+			for _, member := range members {
+				if strings.HasPrefix(member, prefix) {
+					removed = append(removed, member)
+				}
+			}
+			if len(removed) == 0 {
+				continue
+			}
+			pipe.ZRem(ctx, keys[i], removed...)
+			r.invalidateLayer(strings.TrimPrefix(keys[i], "layer/"))
+			counts++
 		}
+		return nil
+	}); err != nil {
+		return 0, errors.Wrapf(err, "redis remove layer members failed")
+	}
+	return counts, nil
+}
 
-		filePath, ts, err := r.parseLayerValue(v)
+func (r *RedisStore) queryLayers(ctx context.Context, layer string) ([]*LayerLocatedInfo, []*LayerLocatedInfo, error) {
+	key := r.buildLayerKey(layer)
+	now := time.Now()
+	members, err := r.redisClient.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Add(-r.layerExpiration(CONTAINERD)).Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "redis get key '%s' failed", key)
+	}
+	layers := make([]*LayerLocatedInfo, 0, len(members))
+	for _, z := range members {
+		member, _ := z.Member.(string)
+		located, layerType, filePath, err := parseLayerMember(member)
 		if err != nil {
-			logger.ErrorContextf(ctx, "parse key '%s -> %s' layer value '%s' failed: %s",
-				layer, k, v, err.Error())
+			logger.ErrorContextf(ctx, "parse layer '%s' member failed: %s", layer, err.Error())
 			continue
 		}
-		if (time.Now().Unix() - ts) > 120 {
+		if now.Unix()-int64(z.Score) > int64(r.layerExpiration(layerType).Seconds()) {
 			continue
 		}
-		layerInfo := &LayerLocatedInfo{
+		layers = append(layers, &LayerLocatedInfo{
 			Layer:   layer,
-			Type:    LayerType(keyType),
-			Located: ks[0],
+			Type:    layerType,
+			Located: located,
 			Data:    filePath,
-			TS:      ts,
-		}
-		switch keyType {
-		case string(StaticFile):
+			TS:      int64(z.Score),
+		})
+	}
+	// the layers of legacy nodes are merged while they alive, the members are sorted by time already
+	if r.legacyNodesAlive(ctx) {
+		layers = mergeLegacyLayers(layers, r.queryLegacyLayers(ctx, layer))
+	}
+	staticLayers := make([]*LayerLocatedInfo, 0)
+	ociLayers := make([]*LayerLocatedInfo, 0)
+	for _, layerInfo := range layers {
+		switch layerInfo.Type {
+		case StaticFile:
 			staticLayers = append(staticLayers, layerInfo)
-		case string(CONTAINERD), string(DOCKERD):
+		case CONTAINERD, DOCKERD:
 			ociLayers = append(ociLayers, layerInfo)
 		}
 	}
-	sort.Slice(staticLayers, func(i, j int) bool {
-		return staticLayers[i].TS > staticLayers[j].TS
-	})
-	sort.Slice(ociLayers, func(i, j int) bool {
-		return ociLayers[i].TS > ociLayers[j].TS
-	})
 	return getTopN(staticLayers, 50), getTopN(ociLayers, 50), nil
 }
 
+const (
+	// torrentExpiration the expiration of torrent metainfo, it is refreshed when torrent generated again
+	torrentExpiration = 7 * 24 * time.Hour
+)
+
+func (r *RedisStore) buildTorrentKey(layer string) string {
+	return fmt.Sprintf("torrent/%s", layer)
+}
+
+// SaveTorrent save the base64 torrent metainfo of layer if not exist, all the seeders of layer should use
+// the same metainfo to join the same swarm. Returns the stored metainfo, the caller should adopt it if it
+// is not the one saved.
+func (r *RedisStore) SaveTorrent(ctx context.Context, layer, torrentBase64 string) (string, error) {
+	key := r.buildTorrentKey(layer)
+	// retry once if the stored one expired after setnx
+	for i := 0; i < 2; i++ {
+		ok, err := r.redisClient.SetNX(ctx, key, torrentBase64, torrentExpiration).Result()
+		if err != nil {
+			return "", errors.Wrapf(err, "redis setnx key '%s' failed", key)
+		}
+		if ok {
+			return torrentBase64, nil
+		}
+		stored, err := r.redisClient.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "redis get key '%s' failed", key)
+		}
+		if stored == torrentBase64 {
+			r.redisClient.Expire(ctx, key, torrentExpiration)
+		}
+		return stored, nil
+	}
+	return "", errors.Errorf("redis save key '%s' failed because it expired repeatedly", key)
+}
+
+// GetTorrent returns the base64 torrent metainfo of layer, returns empty if not exist
+func (r *RedisStore) GetTorrent(ctx context.Context, layer string) (string, error) {
+	key := r.buildTorrentKey(layer)
+	torrentBase64, err := r.redisClient.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		return "", errors.Wrapf(err, "redis get key '%s' failed", key)
+	}
+	return torrentBase64, nil
+}
+
+func (r *RedisStore) buildServiceTokenKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("servicetoken/%s", hex.EncodeToString(sum[:]))
+}
+
+// SaveServiceToken save the encrypted service token with expiration, the key is hashed to not expose
+// the scope of token
+func (r *RedisStore) SaveServiceToken(ctx context.Context, key string, value []byte, expire time.Duration) error {
+	storeKey := r.buildServiceTokenKey(key)
+	if err := r.redisClient.Set(ctx, storeKey, value, expire).Err(); err != nil {
+		return errors.Wrapf(err, "redis set key '%s' failed", storeKey)
+	}
+	return nil
+}
+
+// GetServiceToken returns the encrypted service token, returns nil if not exist
+func (r *RedisStore) GetServiceToken(ctx context.Context, key string) ([]byte, error) {
+	storeKey := r.buildServiceTokenKey(key)
+	value, err := r.redisClient.Get(ctx, storeKey).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "redis get key '%s' failed", storeKey)
+	}
+	return value, nil
+}
+
 func getTopN(slice []*LayerLocatedInfo, n int) []*LayerLocatedInfo {
 	if len(slice) <= n {
 		return slice
@@ -0,0 +1,95 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+)
+
+const (
+	trafficFieldOrigin = "origin"
+	trafficFieldServed = "served"
+)
+
+// buildTrafficKey returns the hash of the traffic bytes of day, the fields are 'registry,origin' and
+// 'registry,served'
+func (r *RedisStore) buildTrafficKey(day string) string {
+	return fmt.Sprintf("traffic/%s", day)
+}
+
+// AddTrafficBytes adds the bytes downloaded from original registries and served to clients of the day, the
+// traffic of day is expired after retention
+func (r *RedisStore) AddTrafficBytes(ctx context.Context, day string, traffic []*apitypes.DailyTraffic,
+	retention time.Duration) error {
+	key := r.buildTrafficKey(day)
+	if _, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, t := range traffic {
+			if t.OriginBytes != 0 {
+				pipe.HIncrBy(ctx, key, t.Registry+","+trafficFieldOrigin, t.OriginBytes)
+			}
+			if t.ServedBytes != 0 {
+				pipe.HIncrBy(ctx, key, t.Registry+","+trafficFieldServed, t.ServedBytes)
+			}
+		}
+		pipe.Expire(ctx, key, retention)
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "redis add traffic of '%s' failed", day)
+	}
+	return nil
+}
+
+// TrafficBytes returns the traffic bytes of registries of the days, sorted by day and registry
+func (r *RedisStore) TrafficBytes(ctx context.Context, days []string) ([]*apitypes.DailyTraffic, error) {
+	result := make([]*apitypes.DailyTraffic, 0)
+	for _, day := range days {
+		key := r.buildTrafficKey(day)
+		values, err := r.redisClient.HGetAll(ctx, key).Result()
+		if err != nil {
+			return nil, errors.Wrapf(err, "redis get key '%s' failed", key)
+		}
+		registries := make(map[string]*apitypes.DailyTraffic)
+		for field, value := range values {
+			i := strings.LastIndex(field, ",")
+			if i < 0 {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			registry := field[:i]
+			t, ok := registries[registry]
+			if !ok {
+				t = &apitypes.DailyTraffic{Date: day, Registry: registry}
+				registries[registry] = t
+				result = append(result, t)
+			}
+			switch field[i+1:] {
+			case trafficFieldOrigin:
+				t.OriginBytes = n
+			case trafficFieldServed:
+				t.ServedBytes = n
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Date != result[j].Date {
+			return result[i].Date < result[j].Date
+		}
+		return result[i].Registry < result[j].Registry
+	})
+	return result, nil
+}
@@ -0,0 +1,325 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+)
+
+const (
+	// replayInterval the interval of checking redis and replaying the pending writes
+	replayInterval = 5 * time.Second
+	// maxPendingWrites the max pending writes kept while redis unavailable, the writes beyond it are dropped
+	maxPendingWrites = 200000
+	// lastLayersExpiration the last query result of layer is served within the duration while redis unavailable
+	lastLayersExpiration = 10 * time.Minute
+)
+
+// pendingWrite defines the layer write not saved into redis, the later write of the same layer member
+// overrides the earlier one, and the delete without filepath overrides the earlier writes of all the
+// members of located node with type
+type pendingWrite struct {
+	Delete   bool      `json:"delete,omitempty"`
+	Type     LayerType `json:"type"`
+	Layer    string    `json:"layer"`
+	Located  string    `json:"located"`
+	FilePath string    `json:"filePath,omitempty"`
+	// Seq the order of write queued, the writes are replayed in order
+	Seq uint64 `json:"seq"`
+}
+
+// key returns the layer member of write, the member of delete without filepath is empty
+func (w *pendingWrite) key() string {
+	return fmt.Sprintf("%s,%s,%s,%s", w.Layer, w.Located, w.Type, w.FilePath)
+}
+
+// overrides returns whether the write overrides the earlier write o
+func (w *pendingWrite) overrides(o *pendingWrite) bool {
+	if w.key() == o.key() {
+		return true
+	}
+	return w.Delete && w.FilePath == "" && w.Layer == o.Layer && w.Located == o.Located && w.Type == o.Type
+}
+
+// writeBehindQueue keeps the pending writes while redis unavailable, they are persisted into the queue file
+// if configured
+type writeBehindQueue struct {
+	sync.Mutex
+	writes map[string]*pendingWrite
+	seq    uint64
+	dirty  bool
+}
+
+func (q *writeBehindQueue) add(writes ...*pendingWrite) {
+	q.Lock()
+	defer q.Unlock()
+	for _, w := range writes {
+		q.removeOverridden(w)
+		if len(q.writes) >= maxPendingWrites {
+			logger.Warnf("pending writes of cache store exceed %d, drop the write of layer '%s'",
+				maxPendingWrites, w.Layer)
+			continue
+		}
+		q.seq++
+		w.Seq = q.seq
+		q.writes[w.key()] = w
+	}
+	q.dirty = true
+	metrics.CacheStorePendingWrites.Set(float64(len(q.writes)))
+}
+
+// removeOverridden removes the pending writes overridden by w, the caller should hold the lock
+func (q *writeBehindQueue) removeOverridden(w *pendingWrite) {
+	if _, ok := q.writes[w.key()]; ok {
+		delete(q.writes, w.key())
+		q.dirty = true
+	}
+	if !w.Delete || w.FilePath != "" {
+		return
+	}
+	for key, o := range q.writes {
+		if w.overrides(o) {
+			delete(q.writes, key)
+			q.dirty = true
+		}
+	}
+}
+
+// discard removes the pending writes overridden by the newer writes
+func (q *writeBehindQueue) discard(writes []*pendingWrite) {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.writes) == 0 {
+		return
+	}
+	for _, w := range writes {
+		q.removeOverridden(w)
+		// the older delete without filepath should not be replayed over the member written
+		allKey := (&pendingWrite{Layer: w.Layer, Located: w.Located, Type: w.Type}).key()
+		if _, ok := q.writes[allKey]; ok {
+			delete(q.writes, allKey)
+			q.dirty = true
+		}
+	}
+	metrics.CacheStorePendingWrites.Set(float64(len(q.writes)))
+}
+
+func (q *writeBehindQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.writes)
+}
+
+// Degraded returns whether redis is unavailable, the writes are queued and the layer queries are served
+// from the last results
+func (r *RedisStore) Degraded() bool {
+	return r.degraded.Load()
+}
+
+// PendingWrites returns the number of writes waiting to be replayed into redis
+func (r *RedisStore) PendingWrites() int {
+	return r.queue.len()
+}
+
+// isRedisOutage returns whether the error is the failure of redis, the redis.Nil and the errors of
+// caller's context canceled or deadline exceeded are not
+func isRedisOutage(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil) && !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// markDegraded enters degraded mode if the error is the failure of redis
+func (r *RedisStore) markDegraded(err error) {
+	if !isRedisOutage(err) {
+		return
+	}
+	if !r.degraded.Swap(true) {
+		logger.Errorf("cache store enters degraded mode: %s", err.Error())
+		metrics.CacheStoreDegraded.Set(1)
+	}
+}
+
+// queueWrites queues the writes if redis is unavailable, returns the original error if it is not the
+// failure of redis
+func (r *RedisStore) queueWrites(err error, writes ...*pendingWrite) error {
+	if !isRedisOutage(err) {
+		return err
+	}
+	r.markDegraded(err)
+	r.queue.add(writes...)
+	logger.V(3).Infof("queued %d writes of cache store: %s", len(writes), err.Error())
+	return nil
+}
+
+// queryLayersWithFallback queries the layers from redis, the last result of layer is returned if redis
+// unavailable
+func (r *RedisStore) queryLayersWithFallback(ctx context.Context, layer string) ([]*LayerLocatedInfo,
+	[]*LayerLocatedInfo, error) {
+	staticLayers, ociLayers, err := r.queryLayers(ctx, layer)
+	if err == nil {
+		r.lastLayers.SetDefault(layer, &layerQueryResult{staticLayers: staticLayers, ociLayers: ociLayers})
+		return staticLayers, ociLayers, nil
+	}
+	r.markDegraded(err)
+	v, ok := r.lastLayers.Get(layer)
+	if !ok {
+		return nil, nil, err
+	}
+	metrics.LayerQueryCacheTotal.WithLabelValues("stale").Inc()
+	logger.WarnContextf(ctx, "query layer '%s' from redis failed, use the last result: %s", layer, err.Error())
+	result := v.(*layerQueryResult)
+	return copyLayers(result.staticLayers), copyLayers(result.ociLayers), nil
+}
+
+// RunWriteBehind loads the pending writes from queue file, and replays them into redis when it is
+// available again until ctx done
+func RunWriteBehind(ctx context.Context) {
+	r := GlobalRedisStore().(*RedisStore)
+	r.loadQueueFile()
+	ticker := time.NewTicker(replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.persistQueueFile()
+			return
+		case <-ticker.C:
+			r.replay(ctx)
+			r.persistQueueFile()
+		}
+	}
+}
+
+func (r *RedisStore) replay(ctx context.Context) {
+	if !r.Degraded() && r.PendingWrites() == 0 {
+		return
+	}
+	if err := r.redisClient.Ping(ctx).Err(); err != nil {
+		r.markDegraded(err)
+		return
+	}
+	r.queue.Lock()
+	writes := make([]*pendingWrite, 0, len(r.queue.writes))
+	for _, w := range r.queue.writes {
+		writes = append(writes, w)
+	}
+	r.queue.Unlock()
+	// the queued writes of the same member are overridden already, the delete without filepath is
+	// replayed before the later writes of the members
+	sort.Slice(writes, func(i, j int) bool {
+		return writes[i].Seq < writes[j].Seq
+	})
+	for i := 0; i < len(writes); i += reportBatchSize {
+		batch := writes[i:min(i+reportBatchSize, len(writes))]
+		if err := r.writeBatch(ctx, batch); err != nil {
+			logger.Errorf("replay %d writes of cache store failed: %s", len(batch), err.Error())
+			return
+		}
+		r.queue.Lock()
+		for _, w := range batch {
+			// the write might be overridden during replay
+			if r.queue.writes[w.key()] == w {
+				delete(r.queue.writes, w.key())
+			}
+		}
+		r.queue.dirty = true
+		metrics.CacheStorePendingWrites.Set(float64(len(r.queue.writes)))
+		r.queue.Unlock()
+	}
+	if len(writes) != 0 {
+		logger.Infof("replayed %d writes of cache store", len(writes))
+	}
+	if r.degraded.Swap(false) {
+		logger.Infof("cache store leaves degraded mode")
+		metrics.CacheStoreDegraded.Set(0)
+	}
+}
+
+func (r *RedisStore) loadQueueFile() {
+	queueFile := r.op.StorageConfig.RedisQueueFile
+	if queueFile == "" {
+		return
+	}
+	bs, err := os.ReadFile(queueFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("read queue file '%s' failed: %s", queueFile, err.Error())
+		}
+		return
+	}
+	writes := make([]*pendingWrite, 0)
+	if err = json.Unmarshal(bs, &writes); err != nil {
+		logger.Errorf("unmarshal queue file '%s' failed: %s", queueFile, err.Error())
+		return
+	}
+	var maxSeq uint64
+	for _, w := range writes {
+		maxSeq = max(maxSeq, w.Seq)
+	}
+	r.queue.Lock()
+	// the writes queued after started are newer than the persisted ones, they are ordered after them
+	for _, w := range r.queue.writes {
+		w.Seq += maxSeq
+	}
+	r.queue.seq += maxSeq
+	for _, w := range writes {
+		if _, ok := r.queue.writes[w.key()]; !ok {
+			r.queue.writes[w.key()] = w
+		}
+	}
+	r.queue.Unlock()
+	if len(writes) != 0 {
+		logger.Infof("loaded %d pending writes of cache store from '%s'", len(writes), queueFile)
+		r.degraded.Store(true)
+	}
+}
+
+// persistQueueFile writes the pending writes into queue file if changed, the file is replaced atomically
+func (r *RedisStore) persistQueueFile() {
+	queueFile := r.op.StorageConfig.RedisQueueFile
+	if queueFile == "" {
+		return
+	}
+	r.queue.Lock()
+	if !r.queue.dirty {
+		r.queue.Unlock()
+		return
+	}
+	writes := make([]*pendingWrite, 0, len(r.queue.writes))
+	for _, w := range r.queue.writes {
+		writes = append(writes, w)
+	}
+	r.queue.dirty = false
+	r.queue.Unlock()
+
+	bs, err := json.Marshal(writes)
+	if err == nil {
+		tmp := queueFile + ".tmp"
+		if err = os.MkdirAll(filepath.Dir(queueFile), 0755); err == nil {
+			if err = os.WriteFile(tmp, bs, 0644); err == nil {
+				err = os.Rename(tmp, queueFile)
+			}
+		}
+	}
+	if err != nil {
+		logger.Errorf("persist queue file '%s' failed: %s", queueFile, err.Error())
+		r.queue.Lock()
+		r.queue.dirty = true
+		r.queue.Unlock()
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+)
+
+// queuedKeys returns the keys of pending writes ordered by seq
+func queuedKeys(q *writeBehindQueue) []string {
+	writes := make([]*pendingWrite, 0, len(q.writes))
+	for _, w := range q.writes {
+		writes = append(writes, w)
+	}
+	sort.Slice(writes, func(i, j int) bool {
+		return writes[i].Seq < writes[j].Seq
+	})
+	keys := make([]string, 0, len(writes))
+	for _, w := range writes {
+		keys = append(keys, w.key())
+	}
+	return keys
+}
+
+func TestWriteBehindQueueAdd(t *testing.T) {
+	write := func(layerType LayerType, filePath string) *pendingWrite {
+		return &pendingWrite{Type: layerType, Layer: "l1", Located: "n1", FilePath: filePath}
+	}
+	deleteAll := func(layerType LayerType) *pendingWrite {
+		return &pendingWrite{Delete: true, Type: layerType, Layer: "l1", Located: "n1"}
+	}
+	tests := []struct {
+		name   string
+		writes []*pendingWrite
+		want   []string
+	}{
+		{
+			name:   "later write of member is moved to the end",
+			writes: []*pendingWrite{write(StaticFile, "/a"), write(StaticFile, "/b"), write(StaticFile, "/a")},
+			want:   []string{"l1,n1,STATIC,/b", "l1,n1,STATIC,/a"},
+		},
+		{
+			name:   "delete without filepath overrides the members of type",
+			writes: []*pendingWrite{write(StaticFile, "/a"), write(CONTAINERD, "/c"), deleteAll(StaticFile)},
+			want:   []string{"l1,n1,CONTAINERD,/c", "l1,n1,STATIC,"},
+		},
+		{
+			name:   "write after delete without filepath is kept",
+			writes: []*pendingWrite{write(StaticFile, "/a"), deleteAll(StaticFile), write(StaticFile, "/b")},
+			want:   []string{"l1,n1,STATIC,", "l1,n1,STATIC,/b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &writeBehindQueue{writes: make(map[string]*pendingWrite)}
+			for _, w := range tt.writes {
+				q.add(w)
+			}
+			if got := queuedKeys(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queued keys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteBehindQueueDiscard(t *testing.T) {
+	q := &writeBehindQueue{writes: make(map[string]*pendingWrite)}
+	q.add(&pendingWrite{Delete: true, Type: StaticFile, Layer: "l1", Located: "n1"},
+		&pendingWrite{Type: StaticFile, Layer: "l2", Located: "n1", FilePath: "/b"})
+	q.discard([]*pendingWrite{{Type: StaticFile, Layer: "l1", Located: "n1", FilePath: "/a"}})
+	want := []string{"l2,n1,STATIC,/b"}
+	if got := queuedKeys(q); !reflect.DeepEqual(got, want) {
+		t.Errorf("queued keys = %v, want %v", got, want)
+	}
+}
+
+func TestIsRedisOutage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "redis nil", err: errors.Wrapf(redis.Nil, "get"), want: false},
+		{name: "context canceled", err: errors.Wrapf(context.Canceled, "pipeline"), want: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: false},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: errors.New("refused")}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRedisOutage(tt.err); got != tt.want {
+				t.Errorf("isRedisOutage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadQueueFile(t *testing.T) {
+	queueFile := filepath.Join(t.TempDir(), "queue.json")
+	persisted := []*pendingWrite{
+		{Type: StaticFile, Layer: "l1", Located: "n1", FilePath: "/a", Seq: 5},
+		{Type: StaticFile, Layer: "l2", Located: "n1", FilePath: "/b", Seq: 7},
+	}
+	bs, err := json.Marshal(persisted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(queueFile, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	op := &options.AccelerBoatOption{}
+	op.StorageConfig.RedisQueueFile = queueFile
+	r := &RedisStore{op: op, queue: writeBehindQueue{writes: make(map[string]*pendingWrite)}}
+	// the write queued before loaded is newer than the persisted ones
+	r.queue.add(&pendingWrite{Type: StaticFile, Layer: "l3", Located: "n1", FilePath: "/c"})
+	r.loadQueueFile()
+	r.queue.add(&pendingWrite{Type: StaticFile, Layer: "l4", Located: "n1", FilePath: "/d"})
+
+	want := []string{"l1,n1,STATIC,/a", "l2,n1,STATIC,/b", "l3,n1,STATIC,/c", "l4,n1,STATIC,/d"}
+	if got := queuedKeys(&r.queue); !reflect.DeepEqual(got, want) {
+		t.Errorf("queued keys = %v, want %v", got, want)
+	}
+	if !r.Degraded() {
+		t.Errorf("Degraded() = false after pending writes loaded")
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package upstreamhealth probes the original hosts(and replicas) of the enabled registry mappings with the
+// /v2/ and token pings periodically. The latency and availability of hosts are reported in stats, and the
+// requests needing the original registry skip the custom path while their host is down.
+package upstreamhealth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/failover"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/server/customapi/apitypes"
+	"github.com/penglongli/accelerboat/pkg/utils"
+)
+
+// historySize the count of recent probes the availability is calculated with
+const historySize = 20
+
+// hostStatus the health of host with the results of recent probes
+type hostStatus struct {
+	health  apitypes.UpstreamHealth
+	history []bool
+}
+
+var (
+	statusLock sync.RWMutex
+	// statuses the health of the probed hosts by host
+	statuses = make(map[string]*hostStatus)
+)
+
+// Down returns whether the host is probed down, the host not probed yet is regarded as healthy
+func Down(host string) bool {
+	if !options.GlobalOptions().UpstreamHealth.Enable {
+		return false
+	}
+	statusLock.RLock()
+	defer statusLock.RUnlock()
+	s, ok := statuses[host]
+	return ok && !s.health.Healthy
+}
+
+// Statuses returns the health of the probed hosts sorted by registry and host
+func Statuses() []*apitypes.UpstreamHealth {
+	statusLock.RLock()
+	result := make([]*apitypes.UpstreamHealth, 0, len(statuses))
+	for _, s := range statuses {
+		health := s.health
+		result = append(result, &health)
+	}
+	statusLock.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Registry != result[j].Registry {
+			return result[i].Registry < result[j].Registry
+		}
+		return result[i].Host < result[j].Host
+	})
+	return result
+}
+
+// Run probes the hosts every interval until ctx done, the interval of reloaded options is used from the
+// next round
+func Run(ctx context.Context) {
+	for {
+		conf := options.GlobalOptions().UpstreamHealth
+		if conf.Enable {
+			probeAll(ctx)
+		}
+		timer := time.NewTimer(time.Duration(conf.Interval) * time.Second)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func probeAll(ctx context.Context) {
+	op := options.GlobalOptions()
+	client := &http.Client{
+		Transport: op.HTTPProxyTransport(),
+		Timeout:   time.Duration(op.UpstreamHealth.Timeout) * time.Second,
+	}
+	probed := make(map[string]struct{})
+	wg := &sync.WaitGroup{}
+	for _, mp := range op.ExternalConfig.RegistryMappings {
+		if !mp.Enable {
+			continue
+		}
+		for _, host := range mp.OriginalHosts() {
+			if _, ok := probed[host]; ok {
+				continue
+			}
+			probed[host] = struct{}{}
+			wg.Add(1)
+			go func(mp *options.RegistryMapping, host string) {
+				defer wg.Done()
+				v2Latency, tokenLatency, err := probe(ctx, client, mp, host)
+				if ctx.Err() != nil {
+					return
+				}
+				record(ctx, mp, host, v2Latency, tokenLatency, err)
+			}(mp, host)
+		}
+	}
+	wg.Wait()
+
+	// the hosts removed from registry mappings are not reported any more
+	statusLock.Lock()
+	for host, s := range statuses {
+		if _, ok := probed[host]; !ok {
+			delete(statuses, host)
+			metrics.UpstreamUp.DeleteLabelValues(s.health.Registry, host)
+		}
+	}
+	statusLock.Unlock()
+}
+
+// probe pings the /v2/ endpoint of host, and the token endpoint of the Bearer challenge anonymously. The
+// response with server error is failure, the unauthorized response of private registry is not.
+func probe(ctx context.Context, client *http.Client, mp *options.RegistryMapping, host string) (
+	time.Duration, time.Duration, error) {
+	// the /v2/ endpoint is on the root of host without the path prefix
+	hostname, _, _ := strings.Cut(host, "/")
+	v2Latency, resp, err := ping(ctx, client, mp, host, "v2", utils.RegistryURL(hostname, "/v2/"))
+	if err != nil {
+		return v2Latency, 0, err
+	}
+	realm, service, _ := utils.ParseAuthRequest(resp.Header.Get("Www-Authenticate"))
+	if resp.StatusCode != http.StatusUnauthorized || realm == "" {
+		return v2Latency, 0, nil
+	}
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return v2Latency, 0, errors.Wrapf(err, "parse realm '%s' failed", realm)
+	}
+	if service != "" {
+		query := tokenURL.Query()
+		query.Set("service", service)
+		tokenURL.RawQuery = query.Encode()
+	}
+	tokenLatency, _, err := ping(ctx, client, mp, host, "token", tokenURL.String())
+	return v2Latency, tokenLatency, err
+}
+
+func ping(ctx context.Context, client *http.Client, mp *options.RegistryMapping, host, endpoint,
+	target string) (time.Duration, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "create %s request failed", endpoint)
+	}
+	mp.ApplyHeaderPolicy(req.Header)
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+	metrics.UpstreamProbeDurationSeconds.WithLabelValues(host, endpoint).Observe(latency.Seconds())
+	if err != nil {
+		return latency, nil, errors.Wrapf(err, "ping %s endpoint failed", endpoint)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return latency, resp, errors.Errorf("ping %s endpoint responded %d", endpoint, resp.StatusCode)
+	}
+	return latency, resp, nil
+}
+
+// record updates the health of host with the probe result, the host failed over if it is a replicated
+// host and turns down
+func record(ctx context.Context, mp *options.RegistryMapping, host string, v2Latency, tokenLatency time.Duration,
+	err error) {
+	threshold := options.GlobalOptions().UpstreamHealth.FailureThreshold
+	statusLock.Lock()
+	s, ok := statuses[host]
+	if !ok {
+		s = &hostStatus{health: apitypes.UpstreamHealth{Registry: mp.OriginalHost, Host: host, Healthy: true}}
+		statuses[host] = s
+	}
+	wasHealthy := s.health.Healthy
+	s.history = append(s.history, err == nil)
+	if len(s.history) > historySize {
+		s.history = s.history[len(s.history)-historySize:]
+	}
+	var succeeded int
+	for _, passed := range s.history {
+		if passed {
+			succeeded++
+		}
+	}
+	h := &s.health
+	h.Registry = mp.OriginalHost
+	h.Availability = float64(succeeded) / float64(len(s.history))
+	h.V2LatencyMs = v2Latency.Milliseconds()
+	h.TokenLatencyMs = tokenLatency.Milliseconds()
+	h.LastProbe = time.Now()
+	if err != nil {
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+	} else {
+		h.ConsecutiveFailures = 0
+		h.LastError = ""
+	}
+	h.Healthy = h.ConsecutiveFailures < threshold
+	healthy := h.Healthy
+	statusLock.Unlock()
+
+	up := 0.0
+	if healthy {
+		up = 1
+	}
+	metrics.UpstreamUp.WithLabelValues(mp.OriginalHost, host).Set(up)
+	switch {
+	case wasHealthy && !healthy:
+		logger.Warnf("original host '%s' of registry '%s' is probed down: %s", host, mp.OriginalHost,
+			err.Error())
+		failover.MarkFailed(ctx, mp.OriginalHost, host, err)
+	case !wasHealthy && healthy:
+		logger.Infof("original host '%s' of registry '%s' is probed healthy", host, mp.OriginalHost)
+	case err != nil:
+		logger.V(3).Infof("probe original host '%s' failed: %s", host, err.Error())
+	}
+}
@@ -14,26 +14,105 @@ import (
 	"syscall"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
+// CopyFile copies the source file to target, the target is created with the permission of source
 func CopyFile(source, target string) error {
 	_ = os.RemoveAll(target)
-	targetFi, err := os.Create(target)
+	sourceFi, err := os.Open(source)
+	if err != nil {
+		return errors.Wrapf(err, "open source file '%s' failed", source)
+	}
+	defer sourceFi.Close()
+	info, err := sourceFi.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "stat source file '%s' failed", source)
+	}
+	targetFi, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 	if err != nil {
 		return errors.Wrapf(err, "create target file '%s' failed", target)
 	}
 	defer targetFi.Close()
+	if _, err = io.Copy(targetFi, sourceFi); err != nil {
+		return errors.Wrapf(err, "copy faile '%s' to '%s' failed", source, target)
+	}
+	return nil
+}
+
+// ResolveFileUnder returns the real path of file with the symlinks resolved, returns error if it is not
+// under any of the dirs
+func ResolveFileUnder(file string, dirs ...string) (string, error) {
+	realFile, err := filepath.EvalSymlinks(filepath.Clean(file))
+	if err != nil {
+		return "", errors.Wrapf(err, "resolve file '%s' failed", file)
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		realDir, err := filepath.EvalSymlinks(filepath.Clean(dir))
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(realDir, realFile); err == nil && rel != "." && filepath.IsLocal(rel) {
+			return realFile, nil
+		}
+	}
+	return "", errors.Errorf("file '%s' is not under the directories %v", file, dirs)
+}
+
+// LinkOrCopyFile hard links the source file to target, the file is copied only if hard link is not
+// supported, e.g. the source and target are on different devices. The file is copied into a unique temp
+// file in the target dir and renamed to target after completed, so the target is never read partially.
+func LinkOrCopyFile(source, target string) error {
+	_ = os.RemoveAll(target)
+	err := os.Link(source, target)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) && !errors.Is(err, syscall.EPERM) && !errors.Is(err, syscall.ENOTSUP) {
+		return errors.Wrapf(err, "link '%s' to '%s' failed", source, target)
+	}
 	sourceFi, err := os.Open(source)
 	if err != nil {
 		return errors.Wrapf(err, "open source file '%s' failed", source)
 	}
 	defer sourceFi.Close()
-	if _, err = io.Copy(targetFi, sourceFi); err != nil {
-		return errors.Wrapf(err, "copy faile '%s' to '%s' failed", source, target)
+	info, err := sourceFi.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "stat source file '%s' failed", source)
+	}
+	// the temp file has the suffix of partial file, it is cleaned by cleaner if left by crash
+	tmpFi, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".copy-*.part")
+	if err != nil {
+		return errors.Wrapf(err, "create temp file of '%s' failed", target)
+	}
+	tmpTarget := tmpFi.Name()
+	if err = copyToTemp(sourceFi, tmpFi, info.Mode().Perm()); err != nil {
+		_ = os.RemoveAll(tmpTarget)
+		return errors.Wrapf(err, "copy file '%s' to '%s' failed", source, tmpTarget)
+	}
+	if err = os.Rename(tmpTarget, target); err != nil {
+		_ = os.RemoveAll(tmpTarget)
+		return errors.Wrapf(err, "rename '%s' to '%s' failed", tmpTarget, target)
 	}
 	return nil
 }
 
+// copyToTemp copies the source into temp file with the perm, the temp file is closed
+func copyToTemp(source io.Reader, tmpFi *os.File, perm os.FileMode) error {
+	if err := tmpFi.Chmod(perm); err != nil {
+		_ = tmpFi.Close()
+		return err
+	}
+	if _, err := io.Copy(tmpFi, source); err != nil {
+		_ = tmpFi.Close()
+		return err
+	}
+	return tmpFi.Close()
+}
+
 // IsSparseFile check linux file is sparse file
 func IsSparseFile(filePath string) (int64, int64, bool, error) {
 	fileInfo, err := os.Stat(filePath)
@@ -56,6 +135,53 @@ func IsSparseFile(filePath string) (int64, int64, bool, error) {
 	return logicalSize, physicalSize, logicalSize > physicalSize*threshold, nil
 }
 
+// FileRange defines the byte range of file
+type FileRange struct {
+	Offset int64
+	Length int64
+}
+
+// FileHoles returns the holes (the ranges not allocated on disk) of file with SEEK_HOLE/SEEK_DATA. The
+// file system not supporting them reports the whole file as data, so no hole is returned.
+func FileHoles(filePath string) ([]FileRange, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open file '%s' failed", filePath)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "stat file '%s' failed", filePath)
+	}
+	size := fi.Size()
+	fd := int(f.Fd())
+	holes := make([]FileRange, 0)
+	var offset int64
+	for offset < size {
+		hole, err := unix.Seek(fd, offset, unix.SEEK_HOLE)
+		if err != nil {
+			if errors.Is(err, unix.ENXIO) {
+				break
+			}
+			return nil, errors.Wrapf(err, "seek hole of file '%s' failed", filePath)
+		}
+		if hole >= size {
+			break
+		}
+		data, err := unix.Seek(fd, hole, unix.SEEK_DATA)
+		if err != nil {
+			// no data after the hole, the file ends with hole
+			if !errors.Is(err, unix.ENXIO) {
+				return nil, errors.Wrapf(err, "seek data of file '%s' failed", filePath)
+			}
+			data = size
+		}
+		holes = append(holes, FileRange{Offset: hole, Length: data - hole})
+		offset = data
+	}
+	return holes, nil
+}
+
 // CreateTarGz create tar.gz file
 func CreateTarGz(srcDir, dstFile string) error {
 	_ = os.RemoveAll(dstFile)
@@ -0,0 +1,97 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveFileUnder(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerDir := filepath.Join(root, "transfer")
+	otherDir := filepath.Join(root, "other")
+	for _, dir := range []string{layerDir, otherDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	layerFile := filepath.Join(layerDir, "layer")
+	otherFile := filepath.Join(otherDir, "secret")
+	for _, file := range []string{layerFile, otherFile} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Symlink(otherFile, filepath.Join(layerDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{name: "under dir", file: layerFile, want: layerFile},
+		{name: "not clean", file: layerDir + "/./layer", want: layerFile},
+		{name: "traversal", file: layerDir + "/../other/secret", wantErr: true},
+		{name: "symlink out of dir", file: filepath.Join(layerDir, "link"), wantErr: true},
+		{name: "dir itself", file: layerDir, wantErr: true},
+		{name: "not exist", file: filepath.Join(layerDir, "missing"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveFileUnder(tt.file, "", layerDir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveFileUnder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveFileUnder() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkOrCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	if err := os.WriteFile(source, []byte("layer"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "target")
+	if err := os.WriteFile(target, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkOrCopyFile(source, target); err != nil {
+		t.Fatalf("LinkOrCopyFile() error = %v", err)
+	}
+	sourceInfo, _ := os.Stat(source)
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(sourceInfo, targetInfo) {
+		t.Errorf("target is not hard linked to source")
+	}
+
+	// the error of link other than not supported is returned without copying
+	missing := filepath.Join(dir, "missing")
+	if err = LinkOrCopyFile(missing, target); err == nil {
+		t.Fatalf("LinkOrCopyFile() of missing source succeeded")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "source" {
+			t.Errorf("unexpected file '%s' left", entry.Name())
+		}
+	}
+}
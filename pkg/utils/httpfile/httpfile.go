@@ -9,10 +9,13 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	"syscall"
 	"unsafe"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 
 	"github.com/penglongli/accelerboat/pkg/logger"
 	"github.com/penglongli/accelerboat/pkg/utils/formatutils"
@@ -20,6 +23,39 @@ import (
 
 const blockSize = 4096
 
+// ReadMode defines how the local layer file is read when served to clients
+type ReadMode string
+
+const (
+	// ReadDirect reads the file with O_DIRECT bypassing the page cache, the layers streamed simultaneously
+	// do not evict each other from page cache. It is the default mode.
+	ReadDirect ReadMode = "direct"
+	// ReadBuffered reads the file with pread through the page cache, the layer served to many local pods
+	// is read from disk once
+	ReadBuffered ReadMode = "buffered"
+	// ReadSendfile copies the file to the connection with sendfile through the page cache, there is no
+	// copy in user space. The file is copied in user space if the connection is TLS or rate limited.
+	ReadSendfile ReadMode = "sendfile"
+)
+
+// ReadOptions defines the I/O strategy of serving local layers
+type ReadOptions struct {
+	Mode ReadMode
+	// BufferSize the size of read buffer in bytes, it is aligned to 4KB
+	BufferSize int
+	// Fadvise advises the kernel with SEQUENTIAL before reading and DONTNEED after the last concurrent
+	// reader of the file done, it is ignored with ReadDirect
+	Fadvise bool
+}
+
+var (
+	bufferPools sync.Map
+	// fileReaders the number of concurrent readers of files, the page cache of file is only dropped after
+	// all its readers done
+	fileReaders     = make(map[string]int)
+	fileReadersLock sync.Mutex
+)
+
 func alignedBuffer(size int) []byte {
 	// Allocate extra space for alignment
 	b := make([]byte, size+blockSize)
@@ -28,25 +64,109 @@ func alignedBuffer(size int) []byte {
 	return b[alignOffset : alignOffset+uintptr(size)]
 }
 
-// HTTPServeFile serves a file over HTTP using O_DIRECT when possible for efficient transfer.
-func HTTPServeFile(ctx context.Context, rw http.ResponseWriter, req *http.Request, reqFile string) error {
-	if fi, err := os.Stat(reqFile); err != nil {
+// getBuffer returns the aligned buffer from the pool of size
+func getBuffer(size int) *[]byte {
+	v, _ := bufferPools.LoadOrStore(size, &sync.Pool{New: func() interface{} {
+		b := alignedBuffer(size)
+		return &b
+	}})
+	return v.(*sync.Pool).Get().(*[]byte)
+}
+
+func putBuffer(size int, b *[]byte) {
+	if v, ok := bufferPools.Load(size); ok {
+		v.(*sync.Pool).Put(b)
+	}
+}
+
+func (o *ReadOptions) bufferSize() int {
+	size := 32 * 1024
+	if o != nil && o.BufferSize > 0 {
+		size = o.BufferSize
+	}
+	if size%blockSize != 0 {
+		size = (size/blockSize + 1) * blockSize
+	}
+	return size
+}
+
+// acquireReader counts the reader of file and advises sequential reading for the first one
+func acquireReader(f *os.File, fadvise bool) {
+	fileReadersLock.Lock()
+	defer fileReadersLock.Unlock()
+	fileReaders[f.Name()]++
+	if fadvise && fileReaders[f.Name()] == 1 {
+		_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+	}
+}
+
+// releaseReader drops the page cache of file after its last reader done
+func releaseReader(f *os.File, fadvise bool) {
+	fileReadersLock.Lock()
+	defer fileReadersLock.Unlock()
+	fileReaders[f.Name()]--
+	if fileReaders[f.Name()] > 0 {
+		return
+	}
+	delete(fileReaders, f.Name())
+	if fadvise {
+		_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+	}
+}
+
+// HTTPServeFile serves a file over HTTP with the I/O strategy of opts, it reads with O_DIRECT if opts
+// is nil.
+func HTTPServeFile(ctx context.Context, rw http.ResponseWriter, req *http.Request, reqFile string,
+	opts *ReadOptions) error {
+	fi, err := os.Stat(reqFile)
+	if err != nil {
 		return errors.Wrapf(err, "query file '%s' stat failed", reqFile)
-	} else {
-		logger.InfoContextf(ctx, "start read and write layer, file: %s, size: %s", reqFile,
-			formatutils.FormatSize(fi.Size()))
 	}
+	mode := ReadDirect
+	if opts != nil && opts.Mode != "" {
+		mode = opts.Mode
+	}
+	logger.InfoContextf(ctx, "start read and write layer, file: %s, size: %s, mode: %s", reqFile,
+		formatutils.FormatSize(fi.Size()), mode)
 
-	file, err := os.OpenFile(reqFile, syscall.O_RDONLY|syscall.O_DIRECT, 0)
+	// the range requests are used to resume the broken transfer
+	if req.Header.Get("Range") != "" {
+		http.ServeFile(rw, req, reqFile)
+		return nil
+	}
+	flag := syscall.O_RDONLY
+	if mode == ReadDirect {
+		flag |= syscall.O_DIRECT
+	}
+	file, err := os.OpenFile(reqFile, flag, 0)
 	if err != nil {
-		logger.WarnContextf(ctx, "read file '%s' with directio failed: %s", reqFile, err.Error())
+		logger.WarnContextf(ctx, "read file '%s' with mode '%s' failed: %s", reqFile, mode, err.Error())
 		http.ServeFile(rw, req, reqFile)
 		return nil
 	}
 	defer file.Close()
+	fadvise := mode != ReadDirect && opts != nil && opts.Fadvise
+	acquireReader(file, fadvise)
+	defer releaseReader(file, fadvise)
 
-	buf := alignedBuffer(32 * 1024) // 32KB aligned buffer
-	if _, err = io.CopyBuffer(rw, file, buf); err != nil {
+	rw.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	switch mode {
+	case ReadSendfile:
+		rw.WriteHeader(http.StatusOK)
+		// write the header through the wrapper so that it records the status
+		if w, ok := rw.(interface{ WriteHeaderNow() }); ok {
+			w.WriteHeaderNow()
+		}
+		_, err = io.Copy(unwrapWriter(rw), file)
+	default:
+		size := opts.bufferSize()
+		buf := getBuffer(size)
+		defer putBuffer(size, buf)
+		// the section reader reads with pread, and the writer is wrapped to hide its ReadFrom so that the
+		// aligned buffer is used
+		_, err = io.CopyBuffer(struct{ io.Writer }{rw}, io.NewSectionReader(file, 0, fi.Size()), *buf)
+	}
+	if err != nil {
 		return errors.Wrapf(err, "io copy with file '%s' failed", reqFile)
 	}
 	logger.InfoContextf(ctx, "complete transfer layer, file: %s", reqFile)
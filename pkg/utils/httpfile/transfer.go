@@ -0,0 +1,138 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package httpfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/utils/formatutils"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// layerContentType returns the content-type of layer by the magic number, and whether the layer is
+// compressed already
+func layerContentType(f *os.File) (string, bool) {
+	magic := make([]byte, len(zstdMagic))
+	n, _ := f.ReadAt(magic, 0)
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return "application/gzip", true
+	case bytes.HasPrefix(magic, zstdMagic):
+		return "application/zstd", true
+	default:
+		return "application/octet-stream", false
+	}
+}
+
+// acceptEncoding returns whether the request accepts the content-encoding
+func acceptEncoding(req *http.Request, encoding string) bool {
+	for _, value := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		if strings.EqualFold(strings.TrimSpace(strings.SplitN(value, ";", 2)[0]), encoding) {
+			return true
+		}
+	}
+	return false
+}
+
+// unwrapWriter returns the underlying writer of the wrapped writer (e.g. gin), the io.Copy on it
+// goes to the ReadFrom of net/http which uses sendfile on the plain tcp connection
+func unwrapWriter(rw http.ResponseWriter) http.ResponseWriter {
+	for {
+		u, ok := rw.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return rw
+		}
+		rw = u.Unwrap()
+	}
+}
+
+type countWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+// Write counts the written bytes
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// ServeLayer serves the layer file to the peer node and returns the bytes of file served. The file is
+// copied to the raw connection with sendfile, and the Range requests are served for the resumption.
+// If compression is zstd and the peer accepts it, the layer not compressed yet is re-compressed on the
+// fly with Content-Encoding, the gzip/zstd layers are always served as they are.
+func ServeLayer(ctx context.Context, rw http.ResponseWriter, req *http.Request, reqFile,
+	compression string) (int64, error) {
+	f, err := os.Open(reqFile)
+	if err != nil {
+		return 0, errors.Wrapf(err, "open file '%s' failed", reqFile)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, errors.Wrapf(err, "query file '%s' stat failed", reqFile)
+	}
+	if fi.IsDir() {
+		return 0, errors.Errorf("file '%s' is directory", reqFile)
+	}
+	contentType, compressed := layerContentType(f)
+	rw.Header().Set("Content-Type", contentType)
+	logger.InfoContextf(ctx, "start transfer layer, file: %s, size: %s, content-type: %s", reqFile,
+		formatutils.FormatSize(fi.Size()), contentType)
+
+	// the range requests are used to resume the broken transfer
+	if req.Header.Get("Range") != "" {
+		cw := &countWriter{ResponseWriter: rw}
+		http.ServeContent(cw, req, "", fi.ModTime(), f)
+		return cw.n, nil
+	}
+	var n int64
+	if compression == "zstd" && !compressed && acceptEncoding(req, "zstd") {
+		rw.Header().Set("Content-Encoding", "zstd")
+		rw.Header().Set("Vary", "Accept-Encoding")
+		rw.WriteHeader(http.StatusOK)
+		enc, err := zstd.NewWriter(rw, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			return 0, errors.Wrapf(err, "create zstd writer failed")
+		}
+		n, err = io.Copy(enc, f)
+		if err == nil {
+			err = enc.Close()
+		} else {
+			_ = enc.Close()
+		}
+		if err != nil {
+			return n, errors.Wrapf(err, "io copy with file '%s' compressed failed", reqFile)
+		}
+	} else {
+		rw.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		rw.WriteHeader(http.StatusOK)
+		// write the header through the wrapper so that it records the status
+		if w, ok := rw.(interface{ WriteHeaderNow() }); ok {
+			w.WriteHeaderNow()
+		}
+		if n, err = io.Copy(unwrapWriter(rw), f); err != nil {
+			return n, errors.Wrapf(err, "io copy with file '%s' failed", reqFile)
+		}
+	}
+	logger.InfoContextf(ctx, "complete transfer layer, file: %s", reqFile)
+	return n, nil
+}
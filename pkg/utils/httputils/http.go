@@ -40,6 +40,24 @@ type HTTPRequest struct {
 	Body        interface{}
 	Header      map[string]string
 	HeaderMulti map[string][]string
+	// MaxBodySize the max bytes of response body read into memory, the responseLimit of options is used
+	// if not set
+	MaxBodySize int64
+}
+
+// ErrBodyTooLarge is returned when the response body exceeds the max size to buffer
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// IsBodyTooLarge returns whether the error is caused by ErrBodyTooLarge
+func IsBodyTooLarge(err error) bool {
+	return errors.Is(err, ErrBodyTooLarge)
+}
+
+func maxBodySize(hr *HTTPRequest) int64 {
+	if hr.MaxBodySize > 0 {
+		return hr.MaxBodySize
+	}
+	return options.GlobalOptions().ResponseLimit.MaxBodySize * 1024 * 1024
 }
 
 // SendHTTPRequest the http request
@@ -56,16 +74,72 @@ func SendHTTPRequestReturnResponse(ctx context.Context, hr *HTTPRequest) (*http.
 	}
 	defer resp.Body.Close()
 
-	var respBody []byte
-	respBody, err = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil, fmt.Errorf("http response %d: %s", resp.StatusCode, ReadErrorBody(resp))
+	}
+	respBody, err := ReadBody(resp, maxBodySize(hr))
+	if err != nil {
+		return resp, nil, err
+	}
+	return resp, respBody, nil
+}
+
+// SendHTTPRequestStream the http request and copies the response body to w without buffering it, it is
+// used for the responses may be large. The bytes copied are returned.
+func SendHTTPRequestStream(ctx context.Context, hr *HTTPRequest, w io.Writer) (*http.Response, int64, error) {
+	resp, err := SendHTTPRequestOnlyResponse(ctx, hr)
 	if err != nil {
-		return resp, nil, errors.Wrap(err, "read response body failed")
+		return nil, 0, err
 	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return resp, nil, fmt.Errorf("http response %d: %s", resp.StatusCode,
-			strings.ReplaceAll(utils.BytesToString(respBody), "\n", "\\n"))
+		return resp, 0, fmt.Errorf("http response %d: %s", resp.StatusCode, ReadErrorBody(resp))
 	}
-	return resp, respBody, nil
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return resp, n, errors.Wrap(err, "copy response body failed")
+	}
+	return resp, n, nil
+}
+
+// ReadBody reads the response body into memory, the body larger than limit is refused with
+// ErrBodyTooLarge. The content-length is checked first so the large body is not read at all.
+func ReadBody(resp *http.Response, limit int64) ([]byte, error) {
+	if limit > 0 && resp.ContentLength > limit {
+		return nil, errors.Wrapf(ErrBodyTooLarge, "content-length %d exceeds %d", resp.ContentLength, limit)
+	}
+	var reader io.Reader = resp.Body
+	if limit > 0 {
+		reader = io.LimitReader(resp.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response body failed")
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, errors.Wrapf(ErrBodyTooLarge, "body exceeds %d", limit)
+	}
+	return body, nil
+}
+
+// ReadErrorBody reads the body of the error response truncated to the maxErrorBodySize of options, the
+// newlines are escaped so it can be put into the error message
+func ReadErrorBody(resp *http.Response) string {
+	limit := options.GlobalOptions().ResponseLimit.MaxErrorBodySize * 1024
+	if limit <= 0 {
+		limit = 4096
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	truncated := int64(len(body)) > limit
+	if truncated {
+		body = body[:limit]
+	}
+	s := strings.ReplaceAll(utils.BytesToString(body), "\n", "\\n")
+	if truncated {
+		s += "...(truncated)"
+	}
+	return s
 }
 
 func SendHTTPRequestOnlyResponse(ctx context.Context, hr *HTTPRequest) (*http.Response, error) {
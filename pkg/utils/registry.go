@@ -15,14 +15,28 @@ package utils
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 )
 
+// RegistryURL joins the original host (may have path prefix) and the request uri of registry
+func RegistryURL(originalHost, requestURI string) string {
+	return "https://" + strings.TrimSuffix(originalHost, "/") + "/" + strings.TrimPrefix(requestURI, "/")
+}
+
+// OriginalRealmQuery the query param of proxy's service/token URL which holds the original realm
+const OriginalRealmQuery = "realm"
+
 // ChangeAuthenticateHeader rewrites Www-Authenticate realm to the proxy's service/token URL.
-// TODO: refactor as needed.
-func ChangeAuthenticateHeader(resp *http.Response, proxyHost string) {
-	v := resp.Header.Get("Www-Authenticate")
+func ChangeAuthenticateHeader(resp *http.Response, proxyAddr, namespace string) {
+	RewriteAuthenticateHeader(resp.Header, proxyAddr, namespace)
+}
+
+// RewriteAuthenticateHeader rewrites Www-Authenticate realm of header to the service/token URL of proxyAddr
+// (scheme and host with port). The namespace is added as 'ns' query for the RegistryMirror mode.
+func RewriteAuthenticateHeader(header http.Header, proxyAddr, namespace string) {
+	v := header.Get("Www-Authenticate")
 	if v == "" {
 		return
 	}
@@ -30,9 +44,15 @@ func ChangeAuthenticateHeader(resp *http.Response, proxyHost string) {
 	if realm == "" {
 		return
 	}
-	realm = fmt.Sprintf("%s/service/token", proxyHost)
+	// the original realm is kept in query, the token service may be on a different host
+	query := url.Values{}
+	query.Set(OriginalRealmQuery, realm)
+	if namespace != "" {
+		query.Set("ns", namespace)
+	}
+	realm = fmt.Sprintf("%s/service/token?%s", strings.TrimSuffix(proxyAddr, "/"), query.Encode())
 	newV := BuildAuthenticateHeader(realm, scope, service)
-	resp.Header.Set("Www-Authenticate", newV)
+	header.Set("Www-Authenticate", newV)
 }
 
 func BuildAuthenticateHeader(realm, service, scope string) string {
@@ -83,6 +103,7 @@ func parseAuthenticateHeader(header string) (string, string, string) {
 var (
 	manifestUriRegexp = regexp.MustCompile(`^/v[1-2]/(.*)/manifests/(.*)`)
 	blobUriRegexp     = regexp.MustCompile(`^/v[1-2]/(.*)/blobs/sha256:([a-z0-9A-Z]{64})$`)
+	uploadUriRegexp   = regexp.MustCompile(`^/v2/(.*)/blobs/uploads/([^/]*)$`)
 )
 
 func IsServiceToken(r *http.Request) (string, string, bool) {
@@ -144,6 +165,17 @@ func IsBlobGet(url string) (string, string, bool) {
 	return repo, sha256, true
 }
 
+// IsBlobUpload used to check the uri whether is blob-upload, the session uuid is empty for the request
+// starting the upload
+// e.p: /v2/library/nginx/blobs/uploads/6b3c4f5e-1a2b => library/nginx, 6b3c4f5e-1a2b, true
+func IsBlobUpload(url string) (string, string, bool) {
+	result := uploadUriRegexp.FindStringSubmatch(url)
+	if len(result) != 3 {
+		return "", "", false
+	}
+	return result[1], result[2], true
+}
+
 // LayerFileName return layer name
 func LayerFileName(digest string) string {
 	digest = strings.TrimPrefix(digest, "sha256:")
@@ -0,0 +1,38 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SignBlob returns the signature of the layer file of digest served until expires(unix seconds)
+func SignBlob(secret, digest, file string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%d", digest, file, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyBlobSignature verifies the signature of the layer file is signed with secret and not expired
+func VerifyBlobSignature(secret, digest, file string, expires int64, signature string) error {
+	if time.Now().Unix() > expires {
+		return errors.Errorf("signature expired at '%s'", time.Unix(expires, 0).Format(time.RFC3339))
+	}
+	expected, err := hex.DecodeString(SignBlob(secret, digest, file, expires))
+	if err != nil {
+		return errors.Wrapf(err, "decode expected signature failed")
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return errors.Errorf("signature not matched")
+	}
+	return nil
+}
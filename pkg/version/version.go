@@ -0,0 +1,41 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package version holds the build information set by ldflags, e.g.
+// -X github.com/penglongli/accelerboat/pkg/version.Version=v0.1.0
+package version
+
+import (
+	"runtime"
+)
+
+// DevVersion is the version of the builds without ldflags
+const DevVersion = "dev"
+
+var (
+	// Version the released version or git describe of the build
+	Version = DevVersion
+	// GitCommit the git commit of the build
+	GitCommit = ""
+	// BuildTime the time of the build
+	BuildTime = ""
+)
+
+// BuildInfo defines the build information of binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information of the current binary
+func Get() *BuildInfo {
+	return &BuildInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
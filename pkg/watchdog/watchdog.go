@@ -0,0 +1,99 @@
+// Copyright 2025 The AccelerBoat Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package watchdog aborts the layer transfers which are stuck, the transfer is canceled when its progress
+// within the stall window is below the minimum throughput.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/penglongli/accelerboat/cmd/accelerboat/options"
+	"github.com/penglongli/accelerboat/pkg/logger"
+	"github.com/penglongli/accelerboat/pkg/metrics"
+	"github.com/penglongli/accelerboat/pkg/recorder"
+)
+
+// checkInterval how often the progress of transfer is sampled
+var checkInterval = 10 * time.Second
+
+// ErrStalled is the cause of the context canceled by watchdog
+var ErrStalled = errors.New("transfer stalled")
+
+// IsStalled returns whether the transfer is aborted by watchdog
+func IsStalled(ctx context.Context, err error) bool {
+	return errors.Is(err, ErrStalled) || errors.Is(context.Cause(ctx), ErrStalled)
+}
+
+// Watch returns the context canceled with ErrStalled if the bytes progressed within the stall window are
+// below the minimum throughput, progress returns the bytes transferred so far. The returned stop must be
+// called after the transfer. The context is returned as is if the watchdog is disabled.
+func Watch(ctx context.Context, method, digest string, progress func() int64) (context.Context, func()) {
+	conf := options.GlobalOptions().TransferConfig.Watchdog
+	if !conf.Enable {
+		return ctx, func() {}
+	}
+	window := time.Duration(conf.StallWindow) * time.Second
+	minBytes := conf.MinThroughput * 1024 * int64(window) / int64(time.Minute)
+	watchCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		// samples of progress, the oldest sample within window is compared with the latest
+		type sample struct {
+			at    time.Time
+			bytes int64
+		}
+		start := time.Now()
+		samples := []sample{{at: start, bytes: progress()}}
+		for {
+			select {
+			case <-done:
+				return
+			case <-watchCtx.Done():
+				return
+			case now := <-ticker.C:
+				cur := sample{at: now, bytes: progress()}
+				samples = append(samples, cur)
+				for len(samples) > 1 && now.Sub(samples[1].at) >= window {
+					samples = samples[1:]
+				}
+				if now.Sub(start) < window {
+					continue
+				}
+				progressed := cur.bytes - samples[0].bytes
+				if progressed >= minBytes {
+					continue
+				}
+				reason := fmt.Sprintf("only %d bytes transferred in %s, below %dKB/min", progressed,
+					now.Sub(samples[0].at).Truncate(time.Second), conf.MinThroughput)
+				abort(ctx, method, digest, cur.bytes, reason)
+				cancel(errors.Wrap(ErrStalled, reason))
+				return
+			}
+		}
+	}()
+	return watchCtx, func() {
+		close(done)
+		cancel(nil)
+	}
+}
+
+func abort(ctx context.Context, method, digest string, transferred int64, reason string) {
+	metrics.TransferAbortedTotal.WithLabelValues(method).Inc()
+	logger.WarnContextf(ctx, "transfer of layer '%s' with %s aborted by watchdog: %s", digest, method, reason)
+	recorder.Global.Record(ctx, recorder.Event{
+		Type:        recorder.EventTypeTransferAborted,
+		EventStatus: recorder.Warning,
+		Details: map[string]interface{}{
+			"digest": digest, "method": method, "transferred": transferred, "reason": reason,
+		},
+		Message: fmt.Sprintf("Transfer with %s aborted because it stalled", method),
+	})
+}